@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/alexferrari88/sbstck-dl/lib"
+	"github.com/spf13/cobra"
+)
+
+// apiCmd represents the api command
+var (
+	apiDir  string
+	apiAddr string
+	apiCmd  = &cobra.Command{
+		Use:   "api",
+		Short: "Run a REST API server to trigger and monitor downloads",
+		Long: `Run a long-running HTTP server exposing a JSON API, so downloads can be driven
+from dashboards, home-automation systems and other services.
+
+Endpoints:
+  GET    /api/health      Check that the server is up
+  POST   /api/runs        Start a download run, e.g. {"url": "https://example.substack.com", "format": "md"}
+  GET    /api/runs        List the download runs
+  GET    /api/runs/{id}   Get the status of a download run
+  DELETE /api/runs/{id}   Cancel a download run
+  GET    /api/posts       List the downloaded posts (use ?output= for a subdirectory)
+
+Runs are executed one at a time and write their files under the --dir directory.
+The proxy, rate and cookie flags apply to every run.
+
+Example usage:
+  sbstck-dl api --dir ./downloads --addr :8081`,
+		Run: func(cmd *cobra.Command, args []string) {
+			server := lib.NewAPIServer(apiDir, fetcher)
+
+			fmt.Printf("API listening on http://%s, downloading to %s\n", displayAddr(apiAddr), apiDir)
+			if err := listenAndServe(apiAddr, server); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+)
+
+func init() {
+	apiCmd.Flags().StringVar(&apiDir, "dir", ".", "Directory where downloaded posts are written")
+	apiCmd.Flags().StringVar(&apiAddr, "addr", "localhost:8081", "Address to listen on")
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"net/url"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/alexferrari88/sbstck-dl/lib"
@@ -168,147 +169,6 @@ func TestMakeDateFilterFunc(t *testing.T) {
 	}
 }
 
-// Test makePath function
-func TestMakePath(t *testing.T) {
-	post := lib.Post{
-		PostDate: "2023-01-01T10:30:00.000Z", // Use RFC3339 format
-		Slug:     "test-post",
-	}
-
-	tests := []struct {
-		name         string
-		post         lib.Post
-		outputFolder string
-		format       string
-		expected     string
-	}{
-		{
-			name:         "basic path",
-			post:         post,
-			outputFolder: "/tmp/downloads",
-			format:       "html",
-			expected:     "/tmp/downloads/20230101_103000_test-post.html",
-		},
-		{
-			name:         "markdown format",
-			post:         post,
-			outputFolder: "/tmp/downloads",
-			format:       "md",
-			expected:     "/tmp/downloads/20230101_103000_test-post.md",
-		},
-		{
-			name:         "text format",
-			post:         post,
-			outputFolder: "/tmp/downloads",
-			format:       "txt",
-			expected:     "/tmp/downloads/20230101_103000_test-post.txt",
-		},
-		{
-			name:         "no output folder",
-			post:         post,
-			outputFolder: "",
-			format:       "html",
-			expected:     "/20230101_103000_test-post.html",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := makePath(tt.post, tt.outputFolder, tt.format)
-			assert.Equal(t, tt.expected, result)
-		})
-	}
-}
-
-// Test convertDateTime function
-func TestConvertDateTime(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    string
-		expected string
-	}{
-		{
-			name:     "basic date", 
-			input:    "2023-01-01",
-			expected: "", // Invalid format, should return empty string
-		},
-		{
-			name:     "date with time",
-			input:    "2023-01-01T10:30:00.000Z",
-			expected: "20230101_103000",
-		},
-		{
-			name:     "different date format",
-			input:    "2023-12-31T23:59:59.999Z",
-			expected: "20231231_235959",
-		},
-		{
-			name:     "empty string",
-			input:    "",
-			expected: "",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := convertDateTime(tt.input)
-			assert.Equal(t, tt.expected, result)
-		})
-	}
-}
-
-// Test extractSlug function
-func TestExtractSlug(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    string
-		expected string
-	}{
-		{
-			name:     "basic substack URL",
-			input:    "https://example.substack.com/p/test-post",
-			expected: "test-post",
-		},
-		{
-			name:     "URL with query parameters",
-			input:    "https://example.substack.com/p/test-post?utm_source=newsletter",
-			expected: "test-post?utm_source=newsletter", // extractSlug doesn't handle query params
-		},
-		{
-			name:     "URL with anchor",
-			input:    "https://example.substack.com/p/test-post#comments",
-			expected: "test-post#comments", // extractSlug doesn't handle anchors
-		},
-		{
-			name:     "URL with trailing slash",
-			input:    "https://example.substack.com/p/test-post/",
-			expected: "", // extractSlug returns empty string for trailing slash
-		},
-		{
-			name:     "complex slug with dashes",
-			input:    "https://example.substack.com/p/this-is-a-very-long-post-title",
-			expected: "this-is-a-very-long-post-title",
-		},
-		{
-			name:     "no /p/ in URL",
-			input:    "https://example.substack.com/test-post",
-			expected: "test-post", // extractSlug just returns the last segment
-		},
-		{
-			name:     "empty string",
-			input:    "",
-			expected: "",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := extractSlug(tt.input)
-			assert.Equal(t, tt.expected, result)
-		})
-	}
-}
-
 // Test cookieName type
 func TestCookieName(t *testing.T) {
 	t.Run("String method", func(t *testing.T) {
@@ -344,7 +204,7 @@ func TestCookieName(t *testing.T) {
 	})
 }
 
-// Test that we can create paths and handle files correctly
+// Test that we can write files correctly
 func TestFileHandling(t *testing.T) {
 	// Create a temporary directory for testing
 	tempDir := t.TempDir()
@@ -358,33 +218,6 @@ func TestFileHandling(t *testing.T) {
 	// Test that file was created successfully
 	_, err = os.Stat(existingFile)
 	assert.NoError(t, err)
-	
-	// Test path creation
-	testPost := lib.Post{PostDate: "2023-01-01T10:30:00.000Z", Slug: "test-post"}
-	path := makePath(testPost, tempDir, "html")
-	expectedPath := tempDir + "/20230101_103000_test-post.html"
-	assert.Equal(t, expectedPath, path)
-}
-
-// Test time parsing and formatting
-func TestTimeFormatting(t *testing.T) {
-	t.Run("convertDateTime with various formats", func(t *testing.T) {
-		// Test the actual time parsing logic
-		testCases := []struct {
-			input    string
-			expected string
-		}{
-			{"2023-01-01T10:30:00.000Z", "20230101_103000"},
-			{"2023-01-01T10:30:00Z", "20230101_103000"},
-			{"2023-01-01", ""}, // Invalid format, should return empty string
-			{"2023-12-31T23:59:59.999Z", "20231231_235959"},
-		}
-
-		for _, tc := range testCases {
-			result := convertDateTime(tc.input)
-			assert.Equal(t, tc.expected, result)
-		}
-	})
 }
 
 // Integration test for date filtering
@@ -409,10 +242,83 @@ func TestDateFilteringIntegration(t *testing.T) {
 	})
 }
 
+// Test filterEntriesByDate function
+func TestFilterEntriesByDate(t *testing.T) {
+	entries := []lib.ManifestEntry{
+		{Slug: "old", PostDate: "2022-12-31T10:00:00Z"},
+		{Slug: "in-range", PostDate: "2023-03-15T10:00:00Z"},
+		{Slug: "new", PostDate: "2023-07-01T10:00:00Z"},
+	}
+
+	t.Run("no filter", func(t *testing.T) {
+		assert.Equal(t, entries, filterEntriesByDate(entries, nil))
+	})
+
+	t.Run("before and after", func(t *testing.T) {
+		filtered := filterEntriesByDate(entries, makeDateFilterFunc("2023-06-15", "2023-01-01"))
+		require.Len(t, filtered, 1)
+		assert.Equal(t, "in-range", filtered[0].Slug)
+	})
+}
+
 // Test constants
 func TestConstants(t *testing.T) {
 	t.Run("cookie name constants", func(t *testing.T) {
 		assert.Equal(t, "substack.sid", string(substackSid))
 		assert.Equal(t, "connect.sid", string(connectSid))
 	})
-}
\ No newline at end of file
+}
+// Test formatting sizes in bytes
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "0 B", formatBytes(0))
+	assert.Equal(t, "1023 B", formatBytes(1023))
+	assert.Equal(t, "1.0 KB", formatBytes(1024))
+	assert.Equal(t, "1.5 MB", formatBytes(3*1024*1024/2))
+	assert.Equal(t, "2.0 GB", formatBytes(2*1024*1024*1024))
+}
+
+// Test choosing when publications are each downloaded into their own folder
+func TestPublicationFolders(t *testing.T) {
+	t.Run("single url", func(t *testing.T) {
+		feeds, err := publicationFolders([]string{"https://example.substack.com"}, nil)
+		require.NoError(t, err)
+		assert.Nil(t, feeds)
+	})
+
+	t.Run("single entry of a list", func(t *testing.T) {
+		feeds, err := publicationFolders(nil, []string{"https://example.substack.com"})
+		require.NoError(t, err)
+		require.Len(t, feeds, 1)
+		assert.Equal(t, "example", feeds[0].Folder)
+	})
+
+	t.Run("repeated url", func(t *testing.T) {
+		feeds, err := publicationFolders([]string{"https://example.substack.com", "https://example.substack.com/"}, nil)
+		require.NoError(t, err)
+		require.Len(t, feeds, 1, "the same publication is downloaded once")
+		assert.Equal(t, "example", feeds[0].Folder)
+
+		feeds, err = publicationFolders([]string{"https://example.substack.com"}, []string{"other.substack.com"})
+		require.NoError(t, err)
+		require.Len(t, feeds, 2)
+		assert.Equal(t, "other", feeds[1].Folder)
+	})
+
+	t.Run("post in a list", func(t *testing.T) {
+		_, err := publicationFolders(nil, []string{"https://example.substack.com/p/post"})
+		assert.Error(t, err)
+	})
+}
+
+// Test that the locks of the output folders are released before a fatal exit
+func TestReleaseLocks(t *testing.T) {
+	dir := t.TempDir()
+	lock := lockOutput(dir)
+	require.FileExists(t, filepath.Join(dir, lib.LockFile))
+
+	releaseLocks()
+	assert.NoFileExists(t, filepath.Join(dir, lib.LockFile))
+	assert.Empty(t, heldLocks)
+	// The deferred unlock of the command still succeeds
+	assert.NoError(t, lock.Unlock())
+}
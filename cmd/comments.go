@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/alexferrari88/sbstck-dl/lib"
+	"github.com/spf13/cobra"
+)
+
+// commentsCmd represents the comments command
+var (
+	commentsOutputDir string
+	commentsFormat    string
+	commentsMaxPages  int
+	commentsMonthly   bool
+	commentsCmd       = &cobra.Command{
+		Use:   "comments",
+		Short: "Archive the comments you wrote across all publications",
+		Long: `Download all the comments the logged in user has written on posts, across every
+publication, from their activity feed. Notes are left out, see the notes command.
+
+The comments are saved in one folder per publication. The cookie of the user is required.
+
+Example usage:
+  sbstck-dl comments --cookie_name substack.sid --cookie_val ... --output-dir ./comments
+  sbstck-dl comments --cookie_name substack.sid --cookie_val ... --monthly --format html`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if fetcher.Cookie == nil {
+				log.Fatal("the comments of the logged in user require --cookie_name and --cookie_val")
+			}
+
+			notesClient := lib.NewNotesClient(fetcher)
+			self, err := notesClient.FetchSelf(ctx)
+			if err != nil {
+				log.Fatalf("Error fetching the logged in user: %v", err)
+			}
+			fmt.Printf("Downloading the comments of %s (@%s)\n", self.Name, self.Handle)
+
+			items, err := notesClient.FetchAllUserActivity(ctx, strconv.Itoa(self.ID), commentsMaxPages, verbose)
+			if err != nil {
+				log.Fatalf("Error fetching user activity: %v", err)
+			}
+
+			groups := notesClient.GroupCommentsByPublication(items)
+			comments := 0
+			for _, group := range groups {
+				comments += len(group.Comments)
+				if verbose {
+					fmt.Printf("%s: %d comments\n", group.Name, len(group.Comments))
+				}
+			}
+			if comments == 0 {
+				fmt.Println("No comments found")
+				return
+			}
+
+			files, err := notesClient.SaveComments(groups, commentsOutputDir, commentsFormat, commentsMonthly)
+			if err != nil {
+				log.Fatalf("Error saving comments: %v", err)
+			}
+			fmt.Printf("Successfully saved %d comments on %d publications in %d files to: %s\n", comments, len(groups), files, commentsOutputDir)
+		},
+	}
+)
+
+func init() {
+	commentsCmd.Flags().StringVar(&commentsOutputDir, "output-dir", "./comments", "Output directory")
+	commentsCmd.Flags().StringVar(&commentsFormat, "format", "md", "Output format (html, md, txt)")
+	commentsCmd.Flags().IntVar(&commentsMaxPages, "max-pages", 0, "Maximum pages of activity to fetch (0 for all)")
+	commentsCmd.Flags().BoolVar(&commentsMonthly, "monthly", false, "Save the comments of each month of a publication together in one file (YYYY-MM.{format})")
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/alexferrari88/sbstck-dl/lib"
+	"github.com/spf13/cobra"
+)
+
+// convertCmd represents the convert command
+var (
+	convertDir    string
+	convertTo     string
+	convertFrom   string
+	convertOutput string
+	convertForce  bool
+	convertCmd    = &cobra.Command{
+		Use:   "convert",
+		Short: "Convert downloaded posts to another format",
+		Long: `Re-render posts already downloaded in a directory into another format, without fetching
+anything from the network.
+
+When a post was downloaded in several formats, the richest one is used as the source
+(html, then md, then txt) unless --from is given. Converted files keep the original file name
+with the new extension and are recorded in the manifest of the output directory.
+
+Supported output formats: html, md, txt, epub (one book per post, with local images embedded).
+
+Example usage:
+  sbstck-dl convert --dir ./downloads --to epub
+  sbstck-dl convert --dir ./downloads --from html --to txt --output ./text`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if !containsFormat(lib.ConvertFormats, convertTo) {
+				log.Fatalf("unknown format: %s", convertTo)
+			}
+			outputDir := convertOutput
+			if outputDir == "" {
+				outputDir = convertDir
+			}
+
+			posts, err := lib.ScanLocalPosts(convertDir)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if posts, err = lib.PreferredLocalPosts(posts, convertFrom); err != nil {
+				log.Fatal(err)
+			}
+			if len(posts) == 0 {
+				fmt.Println("No downloaded posts found in", convertDir)
+				return
+			}
+
+			sourceManifest, err := lib.LoadManifest(convertDir)
+			if err != nil {
+				log.Fatal(err)
+			}
+			manifest, err := lib.LoadManifest(outputDir)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			converted, skipped, failed := 0, 0, 0
+			for _, post := range posts {
+				if post.Format == convertTo && outputDir == convertDir {
+					skipped++
+					continue
+				}
+				path := lib.ConvertedPath(post, outputDir, convertTo)
+				if _, err := os.Stat(path); err == nil && !convertForce {
+					if verbose {
+						fmt.Printf("Skipping %s: %s already exists\n", post.Slug, path)
+					}
+					skipped++
+					continue
+				}
+
+				if verbose {
+					fmt.Printf("Converting %s to %s\n", post.Path, path)
+				}
+				if err := lib.ConvertLocalPost(post, convertTo, path); err != nil {
+					log.Printf("Error converting %s: %v\n", post.Path, err)
+					failed++
+					continue
+				}
+				converted++
+
+				entry, ok := sourceManifest.Entry(post.Slug)
+				if !ok {
+					entry = lib.ManifestEntry{Slug: post.Slug, Title: post.Title, Subtitle: post.Subtitle, URL: post.URL, Tags: post.Tags}
+					if !post.Date.IsZero() {
+						entry.PostDate = post.Date.Format(time.RFC3339)
+					}
+				}
+				entry.Files = map[string]string{convertTo: manifest.RelPath(path)}
+				manifest.AddEntry(entry)
+			}
+
+			if converted > 0 {
+				if err := manifest.Save(); err != nil {
+					log.Printf("Error saving manifest: %v\n", err)
+				}
+			}
+
+			fmt.Printf("Converted %d posts to %s (%d skipped, %d failed)\n", converted, convertTo, skipped, failed)
+		},
+	}
+)
+
+func init() {
+	convertCmd.Flags().StringVar(&convertDir, "dir", ".", "Directory containing the downloaded posts")
+	convertCmd.Flags().StringVarP(&convertTo, "to", "t", "", "Format to convert to (options: \"html\", \"md\", \"txt\", \"epub\")")
+	convertCmd.Flags().StringVar(&convertFrom, "from", "", "Preferred source format when a post was downloaded in several formats")
+	convertCmd.Flags().StringVarP(&convertOutput, "output", "o", "", "Directory for the converted files (default: the --dir directory)")
+	convertCmd.Flags().BoolVar(&convertForce, "force", false, "Overwrite files that were already converted")
+	convertCmd.MarkFlagRequired("to")
+}
+
+// containsFormat reports whether the format is in the list
+func containsFormat(formats []string, format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alexferrari88/sbstck-dl/lib"
+	"github.com/spf13/cobra"
+)
+
+// diffCmd represents the diff command
+var (
+	diffDir       string
+	diffURL       string
+	diffSaveDir   string
+	diffShowAll   bool
+	diffOutputFmt string
+	diffCmd       = &cobra.Command{
+		Use:   "diff",
+		Short: "Compare downloaded posts with the live site",
+		Long: `Fetch the current version of downloaded posts and report the ones that were edited
+(with the number of paragraphs added and removed) or removed from the site.
+
+Post URLs are read from the manifest of the directory. For posts downloaded without a manifest,
+give the publication URL with --url. With --save-diffs, a unified diff of the text of each
+edited post is written to the given directory, one paragraph per line.
+
+Example usage:
+  sbstck-dl diff --dir ./downloads
+  sbstck-dl diff --dir ./downloads --url https://example.substack.com --save-diffs ./diffs`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if diffOutputFmt != "table" && diffOutputFmt != "json" {
+				log.Fatalf("unknown format: %s", diffOutputFmt)
+			}
+
+			posts, err := lib.ScanLocalPosts(diffDir)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if posts, err = lib.PreferredLocalPosts(posts, ""); err != nil {
+				log.Fatal(err)
+			}
+			if len(posts) == 0 {
+				fmt.Println("No downloaded posts found in", diffDir)
+				return
+			}
+			if diffURL != "" {
+				for i := range posts {
+					if posts[i].URL == "" {
+						posts[i].URL = strings.TrimRight(diffURL, "/") + "/p/" + posts[i].Slug
+					}
+				}
+			}
+
+			if diffSaveDir != "" {
+				if err := os.MkdirAll(diffSaveDir, 0755); err != nil {
+					log.Fatal(err)
+				}
+			}
+
+			if verbose {
+				fmt.Printf("Comparing %d posts with the live site\n", len(posts))
+			}
+			results, err := lib.DiffLocalPosts(ctx, extractor, posts, func(d lib.PostDiff) {
+				if diffSaveDir == "" || d.Status != lib.DiffChanged {
+					return
+				}
+				path := filepath.Join(diffSaveDir, d.Slug+".diff")
+				if err := os.WriteFile(path, []byte(d.Diff), 0644); err != nil {
+					log.Printf("Error writing diff %s: %v\n", path, err)
+				} else if verbose {
+					fmt.Printf("Saved diff of %s to %s\n", d.Slug, path)
+				}
+			})
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			counts := make(map[lib.DiffStatus]int)
+			var shown []lib.PostDiff
+			for _, d := range results {
+				counts[d.Status]++
+				if d.Status != lib.DiffUnchanged || diffShowAll {
+					shown = append(shown, d)
+				}
+			}
+
+			if diffOutputFmt == "json" {
+				data, err := json.MarshalIndent(shown, "", "  ")
+				if err != nil {
+					log.Fatal(err)
+				}
+				fmt.Println(string(data))
+				return
+			}
+
+			for _, d := range shown {
+				switch d.Status {
+				case lib.DiffChanged:
+					fmt.Printf("changed    %s (+%d -%d paragraphs)\n", d.Slug, d.Added, d.Removed)
+				case lib.DiffError:
+					fmt.Printf("error      %s: %v\n", d.Slug, d.Err)
+				default:
+					fmt.Printf("%-10s %s\n", d.Status, d.Slug)
+				}
+			}
+			fmt.Printf("%d posts compared: %d changed, %d removed, %d unchanged, %d errors\n",
+				len(results), counts[lib.DiffChanged], counts[lib.DiffRemoved], counts[lib.DiffUnchanged], counts[lib.DiffError])
+		},
+	}
+)
+
+func init() {
+	diffCmd.Flags().StringVar(&diffDir, "dir", ".", "Directory containing the downloaded posts")
+	diffCmd.Flags().StringVarP(&diffURL, "url", "u", "", "Publication URL, for posts whose URL isn't in the manifest")
+	diffCmd.Flags().StringVar(&diffSaveDir, "save-diffs", "", "Directory to save a unified diff of each edited post")
+	diffCmd.Flags().BoolVar(&diffShowAll, "all", false, "Also list unchanged posts")
+	diffCmd.Flags().StringVarP(&diffOutputFmt, "format", "f", "table", "Output format (options: \"table\", \"json\")")
+}
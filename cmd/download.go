@@ -1,14 +1,18 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/url"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/alexferrari88/sbstck-dl/lib"
+	"github.com/alexferrari88/sbstck-dl/lib/store"
 	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
 )
@@ -16,202 +20,187 @@ import (
 // downloadCmd represents the download command
 var (
 	downloadUrl    string
+	downloadURLs   []string
+	urlsFile       string
 	format         string
 	outputFolder   string
 	dryRun         bool
 	addSourceURL   bool
+	emailLayout    bool
+	accessibleText bool
 	downloadImages bool
 	imageQuality   string
 	imagesDir      string
 	downloadFiles  bool
 	fileExtensions string
 	filesDir       string
+	mediaTemplate  string
+	origFilenames  bool
 	createArchive  bool
+	archiveHeatmap bool
+	readingOrder   string
+	relatedPosts   int
+	postComments   bool
+	threadFormat   string
+	keepRaw        bool
+	rawHTML        bool
+	postCache      bool
+	postCacheDir   string
+	mirror         bool
+	byAuthor       bool
+	keepVersions   bool
+	updateChanged  bool
+	skipExisting   bool
+	resume         bool
+	downloadAudio  bool
+	audioDir       string
+	opmlFile       string
+	sections       []string
+	authors        []string
+	series         []string
+	postDelay      time.Duration
+	imageWorkers   int
+	fileWorkers    int
+	mediaWorkers   int
+	maxDuration    time.Duration
+	maxBytes       string
+	failFast       bool
+	maxFailures    int
+	maxRequests    int
+	postLimit      int
+	execAfter      []string
+	transforms     []string
+	ignoreSelector []string
+	paywallMarker  bool
+	redact         bool
+	warc           bool
+	progressJSON   string
+	imageErrors    string
+	imageSizes     string
+	stripImageMeta bool
+	excludeExts    string
+	fileMaxSize    string
+	maxFilesPost   int
+	optimizeImages bool
+	onProgress     lib.ProgressFunc
+	indexDB        string
+	postIndex      *store.Store
 	downloadCmd    = &cobra.Command{
 		Use:   "download",
 		Short: "Download individual posts or the entire public archive",
-		Long:  `You can provide the url of a single post or the main url of the Substack you want to download.`,
+		Long: `You can provide the url of a single post or the main url of the Substack you want to download.
+
+With --opml, every Substack feed of an OPML file (as exported from RSS readers) is downloaded,
+each into its own folder of the output directory. Requests to all publications share the rate limit.
+Several publications can also be given by repeating --url, or listed in a file with --urls-file.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			startTime := time.Now()
-			
-			// Create archive instance if flag is set
-			var archive *lib.Archive
-			if createArchive {
-				archive = lib.NewArchive()
+			if _, err := lib.ParseFormats(format); err != nil {
+				log.Fatalln(err)
 			}
-
-			// if url contains "/p/", we are downloading a single post
-			if strings.Contains(downloadUrl, "/p/") {
-				if verbose {
-					fmt.Printf("Downloading post %s\n", downloadUrl)
-				}
-				if dryRun {
-					fmt.Println("Dry run, exiting...")
-					return
+			if _, err := lib.ParseImageQuality(imageQuality); err != nil {
+				log.Fatalln(err)
+			}
+			if _, err := lib.ParseImageSizes(imageSizes); err != nil {
+				log.Fatalln(err)
+			}
+			if _, err := lib.ParseReadingOrder(readingOrder); err != nil {
+				log.Fatalln(err)
+			}
+			if _, err := lib.ParseImageErrors(imageErrors); err != nil {
+				log.Fatalln(err)
+			}
+			if _, err := lib.ParseCommentsFormat(threadFormat); err != nil {
+				log.Fatalln(err)
+			}
+			if mediaTemplate != "" {
+				if _, err := lib.ParseMediaTemplate(mediaTemplate); err != nil {
+					log.Fatalln(err)
 				}
-				if (beforeDate != "" || afterDate != "") && verbose {
-					fmt.Println("Warning: --before and --after flags are ignored when downloading a single post")
+			}
+			if maxBytes != "" {
+				if _, err := lib.ParseByteSize(maxBytes); err != nil {
+					log.Fatalln(err)
 				}
-
-				post, err := extractor.ExtractPost(ctx, downloadUrl)
-				if err != nil {
+			}
+			if fileMaxSize != "" {
+				if _, err := lib.ParseByteSize(fileMaxSize); err != nil {
 					log.Fatalln(err)
 				}
-				downloadTime := time.Since(startTime)
-				if verbose {
-					fmt.Printf("Downloaded post %s in %s\n", downloadUrl, downloadTime)
+			}
+			if maxFilesPost < 0 {
+				log.Fatalln("--max-files-per-post must not be negative")
+			}
+			if relatedPosts < 0 {
+				log.Fatalln("--related-posts must not be negative")
+			}
+			if imageWorkers < 1 || fileWorkers < 1 {
+				log.Fatalln("--image-workers and --file-workers must be at least 1")
+			}
+			if mediaWorkers < 0 {
+				log.Fatalln("--media-workers must not be negative")
+			}
+			if mediaWorkers > 0 {
+				if !cmd.Flags().Changed("image-workers") {
+					imageWorkers = mediaWorkers
 				}
-
-				path := makePath(post, outputFolder, format)
-				if verbose {
-					fmt.Printf("Writing post to file %s\n", path)
+				if !cmd.Flags().Changed("file-workers") {
+					fileWorkers = mediaWorkers
 				}
-
-				if downloadImages || downloadFiles {
-					imageQualityEnum := lib.ImageQuality(imageQuality)
-					// Parse file extensions if specified
-					var fileExtensionsSlice []string
-					if fileExtensions != "" {
-						fileExtensionsSlice = strings.Split(strings.ReplaceAll(fileExtensions, " ", ""), ",")
-					}
-					imageResult, err := post.WriteToFileWithImages(ctx, path, format, addSourceURL, downloadImages, imageQualityEnum, imagesDir, downloadFiles, fileExtensionsSlice, filesDir, fetcher)
-					if err != nil {
-						log.Printf("Error writing file %s: %v\n", path, err)
-					} else if verbose && imageResult.Success > 0 {
-						fmt.Printf("Downloaded %d images (%d failed) for post %s\n", imageResult.Success, imageResult.Failed, post.Slug)
-					}
-				} else {
-					err = post.WriteToFile(path, format, addSourceURL)
-					if err != nil {
-						log.Printf("Error writing file %s: %v\n", path, err)
-					}
+			}
+			if !dryRun {
+				defer lockOutput(outputFolder).Unlock()
+			}
+			if warc {
+				defer startWARC(startTime).Close()
+			}
+			if progressJSON != "" {
+				if f := startProgressJSON(); f != nil {
+					defer f.Close()
 				}
+			}
+			if indexDB != "" && !dryRun {
+				defer openIndex().Close()
+			}
 
-				// Add to archive if enabled
-				if archive != nil {
-					archive.AddEntry(post, path, startTime)
+			if opmlFile != "" {
+				if offline {
+					fatalln("--opml lists the publications online, it can't be used with --offline")
 				}
+				downloadOPML(opmlFile, startTime)
+				return
+			}
 
-				if verbose {
-					fmt.Println("Done in ", time.Since(startTime))
-				}
-			} else {
-				// we are downloading the entire archive
-				var downloadedPostsCount int
-				dateFilterfunc := makeDateFilterFunc(beforeDate, afterDate)
-				urls, err := extractor.GetAllPostsURLs(ctx, downloadUrl, dateFilterfunc)
-				urlsCount := len(urls)
-				if err != nil {
-					log.Fatalln(err)
-				}
-				if urlsCount == 0 {
-					if verbose {
-						fmt.Println("No posts found, exiting...")
-					}
-					return
+			var listed []string
+			if urlsFile != "" {
+				var err error
+				if listed, err = lib.LoadURLList(urlsFile); err != nil {
+					fatalln(err)
 				}
-				if verbose {
-					fmt.Printf("Found %d posts\n", urlsCount)
-				}
-				if dryRun {
-					fmt.Printf("Found %d posts\n", urlsCount)
-					fmt.Println("Dry run, exiting...")
-					return
-				}
-				urls, err = filterExistingPosts(urls, outputFolder, format)
-				if err != nil {
-					if verbose {
-						fmt.Println("Error filtering existing posts:", err)
-					}
-				}
-				if len(urls) == 0 {
-					if verbose {
-						fmt.Println("No new posts found, exiting...")
-					}
-					return
-				}
-				bar := progressbar.NewOptions(len(urls),
-					progressbar.OptionSetWidth(25),
-					progressbar.OptionSetDescription("downloading"),
-					progressbar.OptionShowBytes(true))
-				for result := range extractor.ExtractAllPosts(ctx, urls) {
-					select {
-					case <-ctx.Done():
-						log.Fatalln("context cancelled")
-					default:
-					}
-					if result.Err != nil {
-						if verbose {
-							fmt.Printf("Error downloading post %s: %s\n", result.Post.CanonicalUrl, result.Err)
-							fmt.Println("Skipping...")
-						}
-						continue
-					}
-					bar.Add(1)
-					downloadedPostsCount++
-					if verbose {
-						fmt.Printf("Downloading post %s\n", result.Post.CanonicalUrl)
-					}
-					post := result.Post
-
-					path := makePath(post, outputFolder, format)
-					if verbose {
-						fmt.Printf("Writing post to file %s\n", path)
-					}
-
-					if downloadImages || downloadFiles {
-						imageQualityEnum := lib.ImageQuality(imageQuality)
-						// Parse file extensions if specified
-						var fileExtensionsSlice []string
-						if fileExtensions != "" {
-							fileExtensionsSlice = strings.Split(strings.ReplaceAll(fileExtensions, " ", ""), ",")
-						}
-						imageResult, err := post.WriteToFileWithImages(ctx, path, format, addSourceURL, downloadImages, imageQualityEnum, imagesDir, downloadFiles, fileExtensionsSlice, filesDir, fetcher)
-						if err != nil {
-							log.Printf("Error writing file %s: %v\n", path, err)
-						} else if verbose && imageResult.Success > 0 {
-							fmt.Printf("Downloaded %d images (%d failed) for post %s\n", imageResult.Success, imageResult.Failed, post.Slug)
-						}
-					} else {
-						err = post.WriteToFile(path, format, addSourceURL)
-						if err != nil {
-							log.Printf("Error writing file %s: %v\n", path, err)
-						}
-					}
-
-					// Add to archive if enabled and post was successfully written
-					if archive != nil {
-						archive.AddEntry(post, path, time.Now())
-					}
-				}
-				if verbose {
-					fmt.Println("Downloaded", downloadedPostsCount, "posts, out of", len(urls))
-					fmt.Println("Done in ", time.Since(startTime))
+			}
+			feeds, err := publicationFolders(downloadURLs, listed)
+			if err != nil {
+				fatalln(err)
+			}
+			if feeds != nil {
+				if offline {
+					fatalln("several publications can't be downloaded with --offline")
 				}
+				downloadPublications(feeds, startTime)
+				return
 			}
+			downloadUrl = downloadURLs[0]
 
-			// Generate archive page if enabled
-			if archive != nil && len(archive.Entries) > 0 {
-				if verbose {
-					fmt.Printf("Generating archive page in %s format...\n", format)
-				}
-				
-				var archiveErr error
-				switch format {
-				case "html":
-					archiveErr = archive.GenerateHTML(outputFolder)
-				case "md":
-					archiveErr = archive.GenerateMarkdown(outputFolder)
-				case "txt":
-					archiveErr = archive.GenerateText(outputFolder)
-				default:
-					archiveErr = fmt.Errorf("unknown format for archive: %s", format)
-				}
-				
-				if archiveErr != nil {
-					log.Printf("Error generating archive page: %v\n", archiveErr)
-				} else if verbose {
-					fmt.Printf("Archive page generated: %s/index.%s\n", outputFolder, format)
+			// if url contains "/p/", we are downloading a single post
+			if strings.Contains(downloadUrl, "/p/") {
+				downloadSinglePost(downloadUrl, makeDownloadOptions(), startTime)
+			} else if offline {
+				// the posts can't be listed, the ones already downloaded are used
+				regenerateOffline(makeDownloadOptions(), startTime)
+			} else {
+				// we are downloading the entire archive
+				if _, err := downloadPublication(downloadUrl, makeDownloadOptions(), startTime); err != nil {
+					fatalln(err)
 				}
 			}
 		},
@@ -219,76 +208,657 @@ var (
 )
 
 func init() {
-	downloadCmd.Flags().StringVarP(&downloadUrl, "url", "u", "", "Specify the Substack url")
-	downloadCmd.Flags().StringVarP(&format, "format", "f", "html", "Specify the output format (options: \"html\", \"md\", \"txt\"")
+	downloadCmd.Flags().StringArrayVarP(&downloadURLs, "url", "u", nil, "Specify the Substack url, or the urls of several publications by repeating it, each downloaded into its own folder")
+	downloadCmd.Flags().StringVar(&urlsFile, "urls-file", "", "Download the publications listed in this file, one url per line, each into its own folder")
+	downloadCmd.Flags().StringVarP(&format, "format", "f", "html", "Specify the output format (options: \"html\", \"md\", \"txt\", \"json\", \"jsonl\"), or several comma-separated formats written from a single download, e.g. \"html,md\"")
 	downloadCmd.Flags().StringVarP(&outputFolder, "output", "o", ".", "Specify the download directory")
 	downloadCmd.Flags().BoolVarP(&dryRun, "dry-run", "d", false, "Enable dry run")
 	downloadCmd.Flags().BoolVar(&addSourceURL, "add-source-url", false, "Add the original post URL at the end of the downloaded file")
+	downloadCmd.Flags().BoolVar(&emailLayout, "email-layout", false, "Lay posts out as in the emails sent to subscribers, with the header image, date line and footer of the publication")
+	downloadCmd.Flags().BoolVar(&accessibleText, "accessible-text", false, "With --format txt, announce each image by its description (\"[Image: ...]\") and list the image addresses at the end, for screen readers")
 	downloadCmd.Flags().BoolVar(&downloadImages, "download-images", false, "Download images locally and update content to reference local files")
-	downloadCmd.Flags().StringVar(&imageQuality, "image-quality", "high", "Image quality to download (options: \"high\", \"medium\", \"low\")")
+	downloadCmd.Flags().StringVar(&imageQuality, "image-quality", "high", "Image quality to download (options: \"high\", \"medium\", \"low\", \"original\", or a width in pixels such as \"1200\")")
+	downloadCmd.Flags().StringVar(&imageSizes, "image-sizes", "", "Comma-separated widths in pixels the images are also downloaded at, e.g. \"424,848\", listed in their srcset so that HTML output stays responsive")
+	downloadCmd.Flags().BoolVar(&stripImageMeta, "strip-image-metadata", false, "Remove the EXIF (except the orientation), XMP and IPTC metadata and the comments of the downloaded JPEG and PNG images")
+	downloadCmd.Flags().BoolVar(&optimizeImages, "optimize-images", false, "Losslessly recompress the downloaded PNG images when it makes them smaller")
 	downloadCmd.Flags().StringVar(&imagesDir, "images-dir", "images", "Directory name for downloaded images")
 	downloadCmd.Flags().BoolVar(&downloadFiles, "download-files", false, "Download file attachments locally and update content to reference local files")
 	downloadCmd.Flags().StringVar(&fileExtensions, "file-extensions", "", "Comma-separated list of file extensions to download (e.g., 'pdf,docx,txt'). If empty, downloads all file types")
+	downloadCmd.Flags().StringVar(&excludeExts, "exclude-file-extensions", "", "Comma-separated list of file extensions never downloaded (e.g., 'mp4,mov'), even if allowed by --file-extensions")
+	downloadCmd.Flags().StringVar(&fileMaxSize, "file-max-size", "", "Don't download attachments larger than this size, e.g. 100MB, leaving them linked to Substack")
+	downloadCmd.Flags().IntVar(&maxFilesPost, "max-files-per-post", 0, "Download at most this many attachments per post, the others being left linked to Substack (0 for no limit)")
 	downloadCmd.Flags().StringVar(&filesDir, "files-dir", "files", "Directory name for downloaded file attachments")
+	downloadCmd.Flags().StringVar(&imageErrors, "image-errors", string(lib.ImageErrorsWarn), "What to do with a post whose images or attachments fail to download (options: \"skip\" to write it with their remote URL, \"warn\" to also record it as a failure to retry, \"fail\" to not write it and exit with an error)")
+	downloadCmd.Flags().StringVar(&mediaTemplate, "media-template", "", "Template of the paths of downloaded images and files, relative to their directory, e.g. '{{.PostSlug}}/{{.Index}}-{{.Basename}}' (fields: PostSlug, Index, Basename, Name, Ext, Hash; default '"+lib.DefaultMediaTemplate+"')")
+	downloadCmd.Flags().BoolVar(&origFilenames, "original-filenames", false, "Name file attachments after the filename they were uploaded with, as sent by the server, rather than after their URL")
+	downloadCmd.Flags().BoolVar(&downloadAudio, "download-audio", false, "Download the narration of posts (\"listen to this post\") and link it at the top of the output")
+	downloadCmd.Flags().StringVar(&audioDir, "audio-dir", "audio", "Directory name for downloaded narrations")
 	downloadCmd.Flags().BoolVar(&createArchive, "create-archive", false, "Create an archive index page linking all downloaded posts")
-	downloadCmd.MarkFlagRequired("url")
+	downloadCmd.Flags().StringVar(&readingOrder, "reading-order", string(lib.ReadingOrderNewestFirst), "Order of the posts on the archive page (options: \"newest-first\", \"oldest-first\")")
+	downloadCmd.Flags().BoolVar(&archiveHeatmap, "archive-heatmap", false, "Show a calendar heatmap of the posting days on the HTML archive page (with --create-archive)")
+	downloadCmd.Flags().IntVar(&relatedPosts, "related-posts", 0, "List up to this many related posts, sharing tags or title words, at the end of each HTML post (0 for none)")
+	downloadCmd.Flags().BoolVar(&postComments, "comments", false, "Also save the comments of each post in a .comments.json file next to it (included in books made by export)")
+	downloadCmd.Flags().BoolVar(&postComments, "include-comments", false, "Same as --comments")
+	downloadCmd.Flags().StringVar(&threadFormat, "comments-format", "json", "With --comments, also write the threaded comments of each post in a .comments.{format} file next to it, the .comments.json file being always saved (options: \"json\" (default), \"html\", \"md\", \"txt\")")
+	downloadCmd.Flags().BoolVar(&keepRaw, "keep-raw", false, "Also save the data Substack embeds in the page of each post, unmodified, in a .raw.json file next to it, to write the post again later without downloading it")
+	downloadCmd.Flags().BoolVar(&rawHTML, "raw-html", false, "Also save the body HTML of each post exactly as extracted, without title, conversion or rewriting, in a .raw.html file next to it")
+	downloadCmd.Flags().BoolVar(&postCache, "cache", false, "Keep the data of downloaded posts in a cache outside the output directory, and write the posts that haven't changed since from it instead of fetching them")
+	downloadCmd.Flags().StringVar(&postCacheDir, "cache-dir", "", "Directory of the cache of posts (implies --cache, default: sbstck-dl/posts in the user cache directory)")
+	downloadCmd.Flags().BoolVar(&mirror, "mirror", false, "Write posts to {output}/{host}/p/{slug}/index.{format} with their media, linking them to each other with relative paths, as a browsable offline mirror")
+	downloadCmd.Flags().BoolVar(&byAuthor, "by-author", false, "Write posts to {output}/{author}/{year}/{slug}.{format}, the author being the first one credited, and group them by author on the archive page")
+	downloadCmd.Flags().BoolVar(&skipExisting, "skip-existing", true, "Skip the posts already in the output directory (--skip-existing=false downloads them all again)")
+	downloadCmd.Flags().BoolVar(&resume, "resume", false, "Continue the last run interrupted or stopped in the output directory, downloading the posts it left pending in manifest.json instead of listing the publication again")
+	downloadCmd.Flags().BoolVar(&updateChanged, "update-changed", false, "Also download again the posts edited on Substack since they were downloaded, according to the sitemap")
+	downloadCmd.Flags().BoolVar(&keepVersions, "keep-versions", false, "When a post downloaded again has changed, keep its previous content as {name}.v{n}.{format} instead of overwriting it")
+	downloadCmd.Flags().StringVar(&opmlFile, "opml", "", "Download every Substack feed of an OPML file, each into its own folder")
+	downloadCmd.Flags().StringSliceVar(&sections, "section", nil, "Only download posts of these sections (slug or name, see \"list sections\")")
+	downloadCmd.Flags().StringSliceVar(&authors, "author", nil, "Only download posts by these authors (handle or name, see \"list authors\")")
+	downloadCmd.Flags().StringSliceVar(&series, "series", nil, "Only download posts of these series, detected from the titles, or of sections of these names (see \"list series\")")
+	downloadCmd.Flags().DurationVar(&postDelay, "post-delay", 0, "Download posts one at a time, pausing this long between them, e.g. 5s")
+	downloadCmd.Flags().IntVar(&imageWorkers, "image-workers", 1, "Number of images of a post downloaded at once")
+	downloadCmd.Flags().IntVar(&fileWorkers, "file-workers", 1, "Number of attachments of a post downloaded at once")
+	downloadCmd.Flags().IntVar(&mediaWorkers, "media-workers", 0, "Number of images and of attachments of a post downloaded at once, unless set by --image-workers or --file-workers")
+	downloadCmd.Flags().DurationVar(&maxDuration, "max-duration", 0, "Stop the run cleanly, saving the manifest, once it has lasted this long, e.g. 30m")
+	downloadCmd.Flags().StringVar(&maxBytes, "max-bytes", "", "Stop the run cleanly, saving the manifest, once this much has been downloaded, e.g. 2GB")
+	downloadCmd.Flags().BoolVar(&failFast, "fail-fast", false, "Abort the run with an error on the first post that fails, instead of logging it and going on")
+	downloadCmd.Flags().IntVar(&maxRequests, "max-requests", 0, "Stop the run cleanly, saving the manifest, once this many requests have been made (0 for no limit)")
+	downloadCmd.Flags().IntVar(&postLimit, "limit", 0, "Download at most this many new posts of each publication per run, leaving the others for the next runs (0 for no limit)")
+	downloadCmd.Flags().IntVar(&maxFailures, "max-failures", 0, "Abort the run with an error once this many posts failed (0 to always go on)")
+	downloadCmd.Flags().StringArrayVar(&execAfter, "exec-after", nil, "Run a shell command after each post is written, {} being replaced by its path and its metadata given as JSON on stdin (can be repeated)")
+	downloadCmd.Flags().StringArrayVar(&ignoreSelector, "ignore-selector", nil, "Remove the elements matching this CSS selector from the body of each post before writing it, e.g. a custom footer (can be repeated)")
+	downloadCmd.Flags().BoolVar(&paywallMarker, "paywall-marker", false, "Mark where the paywall of posts with a free preview falls, with a comment and a notice in the written post")
+	downloadCmd.Flags().StringArrayVar(&transforms, "transform", nil, "Pipe the HTML body of each post through a shell command before writing it, e.g. a translation tool (can be repeated)")
+	downloadCmd.Flags().BoolVar(&redact, "redact", false, "Strip email addresses, subscriber counts and referral links from posts, e.g. to share the archive publicly")
+	downloadCmd.Flags().BoolVar(&warc, "warc", false, "Also record the raw HTTP requests and responses of posts and media in a WARC file of the output directory")
+	downloadCmd.Flags().StringVar(&indexDB, "index-db", "", "Also record each downloaded post (metadata, files, text hash, download time) in this SQLite database, which can be shared by several output directories")
+	downloadCmd.Flags().StringVar(&progressJSON, "progress-json", "", "Write the progress of the run as newline-delimited JSON events to this file, or to stderr with \"-\", for GUIs and wrappers")
+	downloadCmd.MarkFlagsOneRequired("url", "urls-file", "opml")
+	downloadCmd.MarkFlagsMutuallyExclusive("url", "opml")
+	downloadCmd.MarkFlagsMutuallyExclusive("urls-file", "opml")
+	// The raw data would keep what --redact strips
+	downloadCmd.MarkFlagsMutuallyExclusive("keep-raw", "redact")
+	downloadCmd.MarkFlagsMutuallyExclusive("raw-html", "redact")
+	downloadCmd.MarkFlagsMutuallyExclusive("mirror", "by-author")
 }
 
-func convertDateTime(datetime string) string {
-	// Parse the datetime string
-	parsedTime, err := time.Parse(time.RFC3339, datetime)
-	if err != nil {
-		// Return an empty string or an error message if parsing fails
-		return ""
+// downloadSinglePost downloads a single post with the same options as a whole publication,
+// recording it in the manifest and, if enabled, the archive page
+func downloadSinglePost(postURL string, opts lib.DownloadOptions, startTime time.Time) {
+	if verbose {
+		fmt.Printf("Downloading post %s\n", postURL)
+	}
+	if dryRun {
+		// The archive API describes the post without fetching its body
+		if post, err := extractor.GetPostMetadata(ctx, postURL); err == nil {
+			if err := lib.WritePostListings(os.Stdout, []lib.PostListing{lib.NewPostListing(post)}, "table", true); err != nil {
+				log.Println(err)
+			}
+		} else if verbose {
+			fmt.Printf("Error reading the metadata of the post: %v\n", err)
+		}
+		fmt.Println("Dry run, exiting...")
+		return
+	}
+	if (beforeDate != "" || afterDate != "") && verbose {
+		fmt.Println("Warning: --before and --after flags are ignored when downloading a single post")
 	}
 
-	// Format the datetime to the desired format
-	formattedDateTime := fmt.Sprintf("%d%02d%02d_%02d%02d%02d",
-		parsedTime.Year(), parsedTime.Month(), parsedTime.Day(),
-		parsedTime.Hour(), parsedTime.Minute(), parsedTime.Second())
+	result, err := lib.NewDownloader(fetcher, opts).DownloadPost(ctx, postURL)
+	if result.Path == "" {
+		fatalln(err)
+	}
+	if verbose {
+		fmt.Printf("Writing post to file %s\n", result.Path)
+	}
+	if err != nil {
+		if opts.MaxFailures > 0 || errors.Is(err, lib.ErrMediaFailed) {
+			fatalln(err)
+		}
+		log.Println(err)
+	} else if verbose && result.Images != nil && result.Images.Success > 0 {
+		fmt.Printf("Downloaded %d images (%d failed) for post %s\n", result.Images.Success, result.Images.Failed, result.Post.Slug)
+	}
+	warnIfIncomplete(result)
+	indexPost(result)
+	if verbose {
+		if err == nil && opts.CreateArchive {
+			fmt.Printf("Archive page generated: %s/index.%s\n", opts.OutputDir, opts.Formats()[0])
+		}
+		printFetchStats()
+		fmt.Println("Done in ", time.Since(startTime))
+	}
+}
 
-	return formattedDateTime
+// regenerateOffline rebuilds the archive page and the links between the posts already downloaded
+// in the output directory, as the posts of the publication can't be listed offline
+func regenerateOffline(opts lib.DownloadOptions, startTime time.Time) {
+	if dryRun {
+		fmt.Println("Dry run, exiting...")
+		return
+	}
+	n, err := lib.NewDownloader(fetcher, opts).Regenerate(ctx)
+	if err != nil {
+		fatalln(err)
+	}
+	if opts.CreateArchive {
+		fmt.Printf("Archive page of %d posts generated: %s/index.%s\n", n, opts.OutputDir, lib.ArchivePageFormat(opts.Formats()))
+	}
+	if verbose {
+		fmt.Println("Done in ", time.Since(startTime))
+	}
 }
 
-func parseURL(toTest string) (*url.URL, error) {
-	_, err := url.ParseRequestURI(toTest)
+// downloadPublication downloads the posts of a publication not downloaded yet, showing a progress bar.
+// It returns a nil summary when there is nothing to download.
+func downloadPublication(pubURL string, opts lib.DownloadOptions, startTime time.Time) (*lib.DownloadSummary, error) {
+	// Report the images as they complete, the progress bar only counting posts
+	var bar *progressbar.ProgressBar
+	var images, imageBytes int64
+	if opts.DownloadImages {
+		opts.OnImage = func(postSlug string, image lib.ImageInfo) {
+			n := atomic.AddInt64(&images, 1)
+			size := atomic.AddInt64(&imageBytes, image.Bytes)
+			bar.Describe(fmt.Sprintf("downloading (%d images, %s)", n, formatBytes(size)))
+			if verbose && image.Error != nil {
+				fmt.Printf("Error downloading image %s of post %s: %s\n", image.OriginalURL, postSlug, image.Error)
+			}
+		}
+	}
+	downloader := lib.NewDownloader(fetcher, opts)
+	allURLs, urls, err := downloader.ListPostURLs(ctx, pubURL)
 	if err != nil {
 		return nil, err
 	}
+	if len(allURLs) == 0 {
+		if verbose {
+			fmt.Println("No posts found, exiting...")
+		}
+		return nil, nil
+	}
+	if verbose {
+		fmt.Printf("Found %d posts\n", len(allURLs))
+	}
+	if dryRun {
+		fmt.Printf("Found %d posts\n", len(allURLs))
+		fmt.Println("Dry run, exiting...")
+		return nil, nil
+	}
+	deleted, err := downloader.DetectDeletedPosts(ctx)
+	if err != nil {
+		log.Println(err)
+	}
+	for _, entry := range deleted {
+		fmt.Printf("Post %s was deleted or unpublished, its local copy is kept\n", entry.URL)
+	}
+	if len(urls) == 0 {
+		if verbose {
+			fmt.Println("No new posts found, exiting...")
+		}
+		return nil, nil
+	}
+	bar = progressbar.NewOptions(len(urls),
+		progressbar.OptionSetWidth(25),
+		progressbar.OptionSetDescription("downloading"),
+		progressbar.OptionShowBytes(true))
+	var mediaFailed int
+	summary, err := downloader.DownloadPosts(ctx, urls, func(result lib.PostResult) {
+		if result.Err != nil && result.Path == "" {
+			if verbose {
+				fmt.Printf("Error downloading post %s: %s\n", result.URL, result.Err)
+				fmt.Println("Skipping...")
+			}
+			return
+		}
+		bar.Add(1)
+		if verbose {
+			fmt.Printf("Downloading post %s\n", result.URL)
+			fmt.Printf("Writing post to file %s\n", result.Path)
+		}
+		if errors.Is(result.Err, lib.ErrMediaFailed) {
+			mediaFailed++
+		}
+		if result.Err != nil {
+			log.Println(result.Err)
+		} else if verbose && result.Images != nil && result.Images.Success > 0 {
+			fmt.Printf("Downloaded %d images (%d failed) for post %s\n", result.Images.Success, result.Images.Failed, result.Post.Slug)
+		}
+		warnIfIncomplete(result)
+		indexPost(result)
+	})
+	if errors.Is(err, lib.ErrTooManyFailures) {
+		fmt.Printf("%d posts failed, see %s for details and the commands to download them again\n", summary.Failed, filepath.Join(opts.OutputDir, lib.FailureLogName))
+		return summary, err
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			fatalln("context cancelled")
+		}
+		log.Println(err)
+	} else if verbose && opts.CreateArchive && summary.Downloaded > 0 {
+		fmt.Printf("Archive page generated: %s/index.%s\n", opts.OutputDir, opts.Formats()[0])
+	}
+	if summary.Stopped != "" {
+		fmt.Printf("Stopped early: %s, run the command again to download the remaining posts\n", summary.Stopped)
+	}
+	if summary.Failed > 0 {
+		fmt.Printf("%d posts failed, see %s for details and the commands to download them again\n", summary.Failed, filepath.Join(opts.OutputDir, lib.FailureLogName))
+	}
+	if summary.Renamed > 0 {
+		fmt.Printf("%d downloaded posts changed slug, their files are kept under their previous name\n", summary.Renamed)
+	}
+	if summary.Deleted > 0 {
+		fmt.Printf("%d downloaded posts were deleted or unpublished, their local copy is kept and they are marked \"deleted_at\" in %s\n", summary.Deleted, filepath.Join(opts.OutputDir, lib.ManifestFile))
+	}
+	if summary.Incomplete > 0 {
+		fmt.Printf("%d posts look incomplete (paywalled or partially extracted), they are marked \"incomplete\" in %s\n", summary.Incomplete, filepath.Join(opts.OutputDir, lib.ManifestFile))
+	}
+	if verbose {
+		fmt.Println("Downloaded", summary.Downloaded, "posts, out of", len(urls))
+		if opts.DownloadImages {
+			fmt.Printf("Downloaded %d images (%s), %d failed\n", summary.ImagesOK, formatBytes(summary.ImageBytes), summary.ImagesFailed)
+		}
+		printFetchStats()
+		fmt.Println("Done in ", time.Since(startTime))
+	}
+	if mediaFailed > 0 {
+		return summary, fmt.Errorf("%d posts weren't written because some of their images or attachments failed to download", mediaFailed)
+	}
+	return summary, nil
+}
 
-	u, err := url.Parse(toTest)
-	if err != nil || u.Scheme == "" || u.Host == "" {
-		return nil, err
+// warnIfIncomplete warns when far fewer words were written for a post than Substack reports
+func warnIfIncomplete(result lib.PostResult) {
+	if result.Err == nil && result.Post.Incomplete() {
+		log.Printf("Warning: post %s looks incomplete, %d of its %d words were extracted (paywalled or partially extracted?)\n",
+			result.URL, result.Post.ExtractedWordCount(), result.Post.WordCount)
 	}
+}
 
-	return u, err
+// formatBytes formats a size in bytes for humans, e.g. 1.5 MB
+func formatBytes(n int64) string {
+	return lib.FormatByteSize(n)
 }
 
-func makePath(post lib.Post, outputFolder string, format string) string {
-	return fmt.Sprintf("%s/%s_%s.%s", outputFolder, convertDateTime(post.PostDate), post.Slug, format)
+// downloadOPML downloads every Substack publication of an OPML file into its own folder
+func downloadOPML(path string, startTime time.Time) {
+	feeds, skipped, err := lib.LoadOPML(path)
+	if err != nil {
+		fatalln(err)
+	}
+	if verbose {
+		for _, feedURL := range skipped {
+			fmt.Printf("Skipping %s: not a Substack feed\n", feedURL)
+		}
+	}
+	if len(feeds) == 0 {
+		fmt.Println("No Substack feeds found in", path)
+		return
+	}
+	fmt.Printf("Found %d Substack publications in %s\n", len(feeds), path)
+	downloadPublications(feeds, startTime)
 }
 
-// extractSlug extracts the slug from a Substack post URL
-// e.g. https://example.substack.com/p/this-is-the-post-title -> this-is-the-post-title
-func extractSlug(url string) string {
-	split := strings.Split(url, "/")
-	return split[len(split)-1]
+// publicationResult is the outcome of the download of one of several publications
+type publicationResult struct {
+	feed    lib.OPMLFeed
+	summary *lib.DownloadSummary // nil when there was nothing to download
+	err     error
 }
 
-// filterExistingPosts filters out posts that already exist in the output folder.
-// It looks for files whose name ends with the post slug.
-func filterExistingPosts(urls []string, outputFolder string, format string) ([]string, error) {
-	var filtered []string
-	for _, url := range urls {
-		slug := extractSlug(url)
-		path := fmt.Sprintf("%s/%s_%s.%s", outputFolder, "*", slug, format)
-		matches, err := filepath.Glob(path)
+// publicationFolders returns the publications to download each into its own folder: the ones
+// listed with --urls-file, even a single one, and the ones of a repeated --url. It returns no
+// publications for a single --url, downloaded into the output directory itself.
+func publicationFolders(urls []string, listed []string) ([]lib.OPMLFeed, error) {
+	if len(listed) == 0 && len(urls) <= 1 {
+		return nil, nil
+	}
+	return lib.PublicationFeeds(append(append([]string(nil), urls...), listed...))
+}
+
+// downloadPublications downloads several publications, each into its own folder, then reports
+// the result of each of them. The publications are downloaded one after the other, sharing the
+// fetcher and its rate limit.
+func downloadPublications(feeds []lib.OPMLFeed, startTime time.Time) {
+	var results []publicationResult
+	downloaded, failed := 0, 0
+	startBytes := fetcher.BytesRead()
+	startRequests := fetcher.Stats().Requests
+	failedPosts := 0
+	for i, feed := range feeds {
+		opts := makeDownloadOptions()
+		opts.OutputDir = filepath.Join(outputFolder, feed.Folder)
+		// The budgets are shared by all the publications
+		exceeded := false
+		if opts.MaxDuration > 0 {
+			opts.MaxDuration -= time.Since(startTime)
+			exceeded = opts.MaxDuration <= 0
+		}
+		if opts.MaxBytes > 0 {
+			opts.MaxBytes -= fetcher.BytesRead() - startBytes
+			exceeded = exceeded || opts.MaxBytes <= 0
+		}
+		if opts.MaxRequests > 0 {
+			opts.MaxRequests -= fetcher.Stats().Requests - startRequests
+			exceeded = exceeded || opts.MaxRequests <= 0
+		}
+		// So are the failures allowed
+		if opts.MaxFailures > 0 {
+			opts.MaxFailures -= failedPosts
+		}
+		if exceeded {
+			fmt.Printf("Budget exceeded, skipping the remaining %d publications\n", len(feeds)-i)
+			break
+		}
+		name := feed.Title
+		if name == "" {
+			name = feed.Folder
+		}
+		fmt.Printf("[%d/%d] %s (%s)\n", i+1, len(feeds), name, feed.PublicationURL)
+
+		summary, err := downloadPublication(feed.PublicationURL, opts, startTime)
+		if errors.Is(err, lib.ErrTooManyFailures) {
+			fatalln(err)
+		}
+		results = append(results, publicationResult{feed: feed, summary: summary, err: err})
+		if summary != nil {
+			failedPosts += summary.Failed
+		}
 		if err != nil {
-			return urls, err
+			if failFast {
+				fatalf("Error downloading %s: %v\n", feed.PublicationURL, err)
+			}
+			log.Printf("Error downloading %s: %v\n", feed.PublicationURL, err)
+			failed++
+			continue
+		}
+		if summary != nil {
+			downloaded += summary.Downloaded
+			if summary.Stopped != "" {
+				fmt.Printf("Skipping the remaining %d publications\n", len(feeds)-i-1)
+				break
+			}
+		}
+	}
+
+	printPublicationResults(results)
+	fmt.Printf("Downloaded %d posts from %d publications (%d failed)\n", downloaded, len(feeds)-failed, failed)
+
+	if createArchive {
+		writeSuperIndex(feeds)
+	}
+}
+
+// printPublicationResults prints a line per publication downloaded by downloadPublications
+func printPublicationResults(results []publicationResult) {
+	fmt.Println("Summary:")
+	for _, result := range results {
+		line := fmt.Sprintf("  %s: ", filepath.Join(outputFolder, result.feed.Folder))
+		switch {
+		case result.err != nil:
+			line += fmt.Sprintf("error: %v", result.err)
+		case result.summary == nil:
+			line += "no new posts"
+		default:
+			line += fmt.Sprintf("%d downloaded, %d failed", result.summary.Downloaded, result.summary.Failed)
+			if result.summary.Stopped != "" {
+				line += ", stopped early: " + result.summary.Stopped
+			}
+		}
+		fmt.Println(line)
+	}
+}
+
+// writeSuperIndex generates the index page of the output folder, linking to the archive page
+// of every publication downloaded into it, named after its OPML title when it has one
+func writeSuperIndex(feeds []lib.OPMLFeed) {
+	pubs, err := lib.FindPublications(outputFolder)
+	if err != nil {
+		log.Printf("Error listing the downloaded publications: %v\n", err)
+		return
+	}
+	titles := make(map[string]string)
+	for _, feed := range feeds {
+		if feed.Title != "" {
+			titles[feed.Folder] = feed.Title
+		}
+	}
+	for i := range pubs {
+		if title, ok := titles[filepath.Base(pubs[i].Dir)]; ok {
+			pubs[i].Name = title
+		}
+	}
+	if err := lib.GenerateSuperIndex(outputFolder, pubs); err != nil {
+		log.Printf("Error generating the index of the publications: %v\n", err)
+		return
+	}
+	if verbose {
+		fmt.Printf("Indexed %d publications in %s\n", len(pubs), filepath.Join(outputFolder, "index.html"))
+	}
+}
+
+// makeDownloadOptions builds the downloader options from the command flags
+func makeDownloadOptions() lib.DownloadOptions {
+	// Parse file extensions if specified
+	var fileExtensionsSlice []string
+	if fileExtensions != "" {
+		fileExtensionsSlice = strings.Split(strings.ReplaceAll(fileExtensions, " ", ""), ",")
+	}
+	var excludeExtsSlice []string
+	if excludeExts != "" {
+		excludeExtsSlice = strings.Split(strings.ReplaceAll(excludeExts, " ", ""), ",")
+	}
+	// --max-bytes, --file-max-size, --image-sizes and --comments-format are validated when the command starts
+	maxBytesLimit, _ := lib.ParseByteSize(maxBytes)
+	fileMaxSizeLimit, _ := lib.ParseByteSize(fileMaxSize)
+	imageSizesList, _ := lib.ParseImageSizes(imageSizes)
+	commentsFormatName, _ := lib.ParseCommentsFormat(threadFormat)
+	failureLimit := maxFailures
+	if failFast {
+		failureLimit = 1
+	}
+	var cache *lib.PostCache
+	if postCache || postCacheDir != "" {
+		var err error
+		if cache, err = lib.NewPostCache(postCacheDir); err != nil {
+			fatalln(err)
+		}
+	}
+	return lib.DownloadOptions{
+		OutputDir:         outputFolder,
+		Format:            format,
+		AddSourceURL:      addSourceURL,
+		EmailLayout:       emailLayout,
+		AccessibleText:    accessibleText,
+		DownloadImages:    downloadImages,
+		ImageQuality:      lib.ImageQuality(imageQuality),
+		ImageSizes:        imageSizesList,
+		StripImageMeta:    stripImageMeta,
+		OptimizeImages:    optimizeImages,
+		ImagesDir:         imagesDir,
+		DownloadFiles:     downloadFiles,
+		FileExtensions:    fileExtensionsSlice,
+		ExcludeExtensions: excludeExtsSlice,
+		FileMaxSize:       fileMaxSizeLimit,
+		MaxFilesPerPost:   maxFilesPost,
+		FilesDir:          filesDir,
+		ImageErrors:       lib.ImageErrors(imageErrors),
+		MediaTemplate:     mediaTemplate,
+		OriginalFilenames: origFilenames,
+		CreateArchive:     createArchive,
+		ArchiveHeatmap:    archiveHeatmap,
+		RelatedPosts:      relatedPosts,
+		ReadingOrder:      lib.ReadingOrder(readingOrder),
+		Comments:          postComments,
+		CommentsFormat:    commentsFormatName,
+		KeepRaw:           keepRaw,
+		RawHTML:           rawHTML,
+		Mirror:            mirror,
+		ByAuthor:          byAuthor,
+		KeepVersions:      keepVersions,
+		DownloadAudio:     downloadAudio,
+		AudioDir:          audioDir,
+		SkipExisting:      skipExisting,
+		Resume:            resume,
+		UpdateChanged:     updateChanged,
+		DateFilter:        makeDateFilterFunc(beforeDate, afterDate),
+		Sections:          sections,
+		Authors:           authors,
+		Series:            series,
+		PostDelay:         postDelay,
+		ImageWorkers:      imageWorkers,
+		FileWorkers:       fileWorkers,
+		MaxDuration:       maxDuration,
+		MaxBytes:          maxBytesLimit,
+		MaxRequests:       maxRequests,
+		Limit:             postLimit,
+		MaxFailures:       failureLimit,
+		PostProcessors:    makePostProcessors(),
+		Transformers:      makeTransformers(),
+		Cache:             cache,
+		OnProgress:        onProgress,
+	}
+}
+
+// heldLocks are the output folders locked by the run, released by fatal before exiting
+var heldLocks []*lib.DirLock
+
+// lockOutput locks the output folder for the run, exiting if another run is writing to it
+func lockOutput(dir string) *lib.DirLock {
+	lock, err := lib.LockDir(dir)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	heldLocks = append(heldLocks, lock)
+	return lock
+}
+
+// releaseLocks releases the locks of the output folders, which os.Exit would leave behind
+// by skipping the deferred calls
+func releaseLocks() {
+	for _, lock := range heldLocks {
+		if err := lock.Unlock(); err != nil {
+			log.Println(err)
 		}
-		if len(matches) == 0 {
-			filtered = append(filtered, url)
+	}
+	heldLocks = nil
+}
+
+// fatalf and fatalln are log.Fatalf and log.Fatalln for the commands holding the lock of an
+// output folder, released before exiting
+func fatalf(format string, v ...any) {
+	releaseLocks()
+	log.Fatalf(format, v...)
+}
+
+func fatalln(v ...any) {
+	releaseLocks()
+	log.Fatalln(v...)
+}
+
+// startWARC records the HTTP exchanges of the fetcher in a new WARC file of the output directory
+func startWARC(startTime time.Time) *lib.WARCWriter {
+	if err := os.MkdirAll(outputFolder, 0755); err != nil {
+		fatalln(err)
+	}
+	path := filepath.Join(outputFolder, lib.WARCFileName(startTime))
+	w, err := lib.CreateWARC(path)
+	if err != nil {
+		fatalln(err)
+	}
+	fetcher.WARC = w
+	if verbose {
+		fmt.Printf("Recording HTTP exchanges in %s\n", path)
+	}
+	return w
+}
+
+// startProgressJSON writes the progress events of the runs as JSON lines to the file of
+// --progress-json, or to stderr for "-". The file to close is returned, if any.
+func startProgressJSON() *os.File {
+	if progressJSON == "-" {
+		onProgress = lib.JSONProgress(os.Stderr)
+		return nil
+	}
+	f, err := os.Create(progressJSON)
+	if err != nil {
+		fatalln(err)
+	}
+	onProgress = lib.JSONProgress(f)
+	return f
+}
+
+// openIndex opens the SQLite index of --index-db, in which downloaded posts are recorded
+func openIndex() *store.Store {
+	index, err := store.Open(indexDB)
+	if err != nil {
+		fatalln(err)
+	}
+	postIndex = index
+	if verbose {
+		fmt.Printf("Recording downloaded posts in %s\n", indexDB)
+	}
+	return index
+}
+
+// indexPost records a written post in the index of --index-db, if any. As in the manifest,
+// a post that failed to be post-processed is recorded, being written.
+func indexPost(result lib.PostResult) {
+	var postProcessErr *lib.PostProcessError
+	if postIndex == nil || result.Path == "" || (result.Err != nil && !errors.As(result.Err, &postProcessErr)) {
+		return
+	}
+	files := result.Files
+	if len(files) == 0 {
+		files = map[string]string{strings.TrimPrefix(filepath.Ext(result.Path), "."): result.Path}
+	}
+	if err := postIndex.RecordPost(result.Post, files, time.Now()); err != nil {
+		log.Printf("Error recording post %s in the index: %v\n", result.URL, err)
+	}
+}
+
+// makeTransformers returns the transformers of the ignored selectors, --paywall-marker, the --transform commands and --redact
+func makeTransformers() []lib.PostTransformer {
+	var transformers []lib.PostTransformer
+	// The ignored elements are removed first, so that the commands don't process them
+	if selectors := append(append([]string{}, config.IgnoreSelectors...), ignoreSelector...); len(selectors) > 0 {
+		remover, err := lib.NewSelectorRemover(selectors)
+		if err != nil {
+			fatalln(err)
 		}
+		transformers = append(transformers, remover)
+	}
+	if paywallMarker {
+		transformers = append(transformers, lib.PaywallMarker{})
+	}
+	for _, command := range transforms {
+		transformers = append(transformers, lib.NewExecTransformer(command))
 	}
-	return filtered, nil
+	// Redact last so that the output of the commands is redacted too
+	if redact {
+		transformers = append(transformers, lib.Redactor{})
+	}
+	return transformers
+}
+
+// makePostProcessors returns the post-processors of the --exec-after commands
+func makePostProcessors() []lib.PostProcessor {
+	var processors []lib.PostProcessor
+	for _, command := range execAfter {
+		processors = append(processors, lib.NewExecPostProcessor(command))
+	}
+	return processors
+}
+
+func parseURL(toTest string) (*url.URL, error) {
+	_, err := url.ParseRequestURI(toTest)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(toTest)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, err
+	}
+
+	return u, err
 }
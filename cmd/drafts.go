@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/alexferrari88/sbstck-dl/lib"
+	"github.com/spf13/cobra"
+)
+
+// draftsCmd represents the drafts command
+var (
+	draftsURL       string
+	draftsOutputDir string
+	draftsFormat    string
+	draftsScheduled bool
+	draftsCmd       = &cobra.Command{
+		Use:   "drafts",
+		Short: "Back up the drafts and scheduled posts of your publication",
+		Long: `Download the unpublished posts of a publication you own or edit, through the publisher API,
+to protect work that isn't published yet. The cookie of an owner or editor is required.
+
+Drafts are saved in the drafts directory of the output directory, apart from the published
+posts, and scheduled posts in drafts/scheduled. Each post is saved in the chosen format and
+as the JSON returned by the API, which keeps the editor document as is.
+
+Example usage:
+  sbstck-dl drafts --url https://example.substack.com --cookie_name substack.sid --cookie_val ... --output ./archive
+  sbstck-dl drafts --url https://example.substack.com --cookie_name substack.sid --cookie_val ... --format html --scheduled=false`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if fetcher.Cookie == nil {
+				log.Fatal("the drafts of a publication require the --cookie_name and --cookie_val of its owner")
+			}
+			if !containsFormat([]string{"html", "md", "txt"}, draftsFormat) {
+				log.Fatalf("unknown format: %s", draftsFormat)
+			}
+			parsedURL, err := parseURL(draftsURL)
+			if err != nil {
+				log.Fatalf("invalid URL: %s", draftsURL)
+			}
+			client, err := lib.NewPublicationAPIClient(fetcher, parsedURL.Scheme+"://"+parsedURL.Host)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			kinds := []string{lib.DraftKindDraft}
+			if draftsScheduled {
+				kinds = append(kinds, lib.DraftKindScheduled)
+			}
+			defer lockOutput(draftsOutputDir).Unlock()
+
+			for _, kind := range kinds {
+				drafts, err := lib.FetchDrafts(ctx, client, kind)
+				if err != nil {
+					fatalf("Error fetching the %s of %s: %v", kind, parsedURL.Host, err)
+				}
+				paths, err := lib.SaveDrafts(drafts, draftsOutputDir, draftsFormat)
+				if verbose {
+					for _, path := range paths {
+						fmt.Println("Saved", path)
+					}
+				}
+				if err != nil {
+					fatalf("Error saving %s: %v", kind, err)
+				}
+				dir := filepath.Join(draftsOutputDir, lib.DraftsDir)
+				if kind == lib.DraftKindScheduled {
+					dir = filepath.Join(dir, lib.DraftKindScheduled)
+				}
+				fmt.Printf("Saved %d %s to: %s\n", len(paths), kind, dir)
+			}
+		},
+	}
+)
+
+func init() {
+	draftsCmd.Flags().StringVarP(&draftsURL, "url", "u", "", "URL of the publication")
+	draftsCmd.Flags().StringVarP(&draftsOutputDir, "output", "o", ".", "Output directory; drafts are saved in its drafts directory")
+	draftsCmd.Flags().StringVarP(&draftsFormat, "format", "f", "html", "Format of the drafts (options: \"html\", \"md\", \"txt\")")
+	draftsCmd.Flags().BoolVar(&draftsScheduled, "scheduled", true, "Also back up the scheduled posts")
+	draftsCmd.MarkFlagRequired("url")
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/alexferrari88/sbstck-dl/lib"
+	"github.com/spf13/cobra"
+)
+
+// exportCmd represents the export command
+var (
+	exportDir        string
+	exportFormat     string
+	exportSelect     []string
+	exportSlugs      string
+	exportOutput     string
+	exportTitle      string
+	exportAuthor     string
+	exportCover      string
+	exportNoComments bool
+	exportDataset    string
+	exportRSS        string
+	exportJSONFeed   string
+	exportBaseURL    string
+	exportOrder      string
+	exportCmd        = &cobra.Command{
+		Use:   "export",
+		Short: "Compile downloaded posts into a single book",
+		Long: `Merge a selection of downloaded posts into a single EPUB, PDF or Markdown book, with a cover,
+a table of contents and one chapter per post, oldest first unless --reading-order newest-first.
+
+Posts are selected with glob patterns matched against their date (YYYY-MM-DD) or slug.
+Without --select, all the posts of the directory are exported. With --slugs, the posts listed
+in a file, one slug or post URL per line, are exported in the order of the list, e.g. to compile
+a course or a series. Nothing is fetched from
+the network: local images are included, remote ones are left out.
+
+The comments of posts downloaded with "download --comments" are added in an appendix,
+one chapter per post, each reply quoted inside the comment it answers.
+
+The PDF output uses the standard PDF fonts, which only cover Western European characters.
+
+With --dataset, the selected posts are instead exported as a research dataset, with one record
+per post holding its plain text, metadata and engagement counts, as JSON lines (.jsonl) or CSV (.csv).
+
+With --rss, they are exported as an RSS 2.0 feed holding the full HTML of each post, the import
+format accepted by most blogging platforms, and with --json-feed as a JSON Feed 1.1. Local images
+are linked from --base-url when given.
+
+Example usage:
+  sbstck-dl export --from ./archive --format epub --select "2023-*"
+  sbstck-dl export --from ./archive --format pdf --select "2023-0[1-6]-*" --title "Early 2023" -o early-2023.pdf
+  sbstck-dl export --from ./archive --format md --slugs course.txt --title "The Course"
+  sbstck-dl export --from ./archive --dataset dataset.jsonl
+  sbstck-dl export --from ./archive --rss feed.xml --base-url https://example.com/archive
+  sbstck-dl export --from ./archive --json-feed feed.json`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if exportDataset == "" && exportRSS == "" && exportJSONFeed == "" && !containsFormat(lib.ExportFormats, exportFormat) {
+				log.Fatalf("unknown format: %s", exportFormat)
+			}
+			order, err := lib.ParseReadingOrder(exportOrder)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			posts, err := lib.ScanLocalPosts(exportDir)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if exportSlugs != "" {
+				slugs, err := lib.LoadSlugList(exportSlugs)
+				if err != nil {
+					log.Fatal(err)
+				}
+				posts, err = lib.SelectLocalPostsBySlug(posts, slugs)
+			} else {
+				posts, err = lib.SelectLocalPosts(posts, exportSelect)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(posts) == 0 {
+				fmt.Println("No downloaded posts selected in", exportDir)
+				return
+			}
+
+			if exportDataset != "" {
+				manifest, err := lib.LoadManifest(exportDir)
+				if err != nil {
+					log.Fatal(err)
+				}
+				records, err := lib.ExportDataset(posts, manifest, exportDataset)
+				if err != nil {
+					log.Fatal(err)
+				}
+				fmt.Printf("Exported %d posts to %s\n", records, exportDataset)
+				return
+			}
+
+			name := exportDefaultTitle(exportDir)
+			title := exportTitle
+			if title == "" {
+				title = name
+			}
+
+			if exportRSS != "" || exportJSONFeed != "" {
+				manifest, err := lib.LoadManifest(exportDir)
+				if err != nil {
+					log.Fatal(err)
+				}
+				feedOptions := lib.FeedOptions{Title: title, BaseURL: exportBaseURL}
+				if exportRSS != "" {
+					items, err := lib.ExportFeed(posts, manifest, exportRSS, feedOptions)
+					if err != nil {
+						log.Fatal(err)
+					}
+					fmt.Printf("Exported %d posts to %s\n", items, exportRSS)
+				}
+				if exportJSONFeed != "" {
+					items, err := lib.ExportJSONFeed(posts, manifest, exportJSONFeed, feedOptions)
+					if err != nil {
+						log.Fatal(err)
+					}
+					fmt.Printf("Exported %d posts to %s\n", items, exportJSONFeed)
+				}
+				return
+			}
+			output := exportOutput
+			if output == "" {
+				output = name + "." + exportFormat
+			}
+
+			if verbose {
+				fmt.Printf("Exporting %d files to %s\n", len(posts), output)
+			}
+			chapters, err := lib.ExportBook(posts, output, lib.ExportOptions{
+				Format:     exportFormat,
+				Title:      title,
+				Author:     exportAuthor,
+				CoverImage: exportCover,
+				Logo:       lib.FindPublicationLogo(exportDir),
+				NoComments: exportNoComments,
+				Order:      order,
+				KeepOrder:  exportSlugs != "",
+			})
+			if err != nil {
+				log.Fatalf("Error exporting book: %v\n", err)
+			}
+
+			fmt.Printf("Exported %d posts to %s\n", chapters, output)
+		},
+	}
+)
+
+func init() {
+	exportCmd.Flags().StringVar(&exportDir, "from", ".", "Directory containing the downloaded posts")
+	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", "epub", "Book format (options: \"epub\", \"pdf\", \"md\")")
+	exportCmd.Flags().StringSliceVar(&exportSelect, "select", nil, "Glob patterns selecting posts by date (YYYY-MM-DD) or slug, e.g. \"2023-*\"")
+	exportCmd.Flags().StringVar(&exportSlugs, "slugs", "", "File listing the posts to export, one slug or URL per line, in the order of the book")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Path of the book (default: the name of the --from directory with the format extension)")
+	exportCmd.Flags().StringVar(&exportTitle, "title", "", "Title of the book (default: the name of the --from directory)")
+	exportCmd.Flags().StringVar(&exportAuthor, "author", "", "Author shown on the cover")
+	exportCmd.Flags().StringVar(&exportCover, "cover", "", "Image to use as the cover (default: a generated cover)")
+	exportCmd.Flags().BoolVar(&exportNoComments, "no-comments", false, "Leave out the appendix of the comments downloaded with \"download --comments\"")
+	exportCmd.Flags().StringVar(&exportOrder, "reading-order", string(lib.ReadingOrderOldestFirst), "Order of the chapters (options: \"oldest-first\", \"newest-first\")")
+	exportCmd.Flags().StringVar(&exportDataset, "dataset", "", "Export a research dataset to this .jsonl or .csv file instead of a book")
+	exportCmd.Flags().StringVar(&exportRSS, "rss", "", "Export an RSS 2.0 feed with the full content of the posts to this file instead of a book")
+	exportCmd.Flags().StringVar(&exportJSONFeed, "json-feed", "", "Export a JSON Feed 1.1 with the full content of the posts to this file instead of a book")
+	exportCmd.Flags().StringVar(&exportBaseURL, "base-url", "", "URL the --from directory is served from, to link the local images of the feeds")
+	exportCmd.MarkFlagsMutuallyExclusive("select", "slugs")
+	exportCmd.MarkFlagsMutuallyExclusive("dataset", "rss")
+	exportCmd.MarkFlagsMutuallyExclusive("dataset", "json-feed")
+}
+
+// exportDefaultTitle derives the title of a book from the name of the download directory
+func exportDefaultTitle(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return filepath.Base(dir)
+}
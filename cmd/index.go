@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/alexferrari88/sbstck-dl/lib"
+	"github.com/spf13/cobra"
+)
+
+// indexCmd represents the index command
+var (
+	indexDir string
+	indexCmd = &cobra.Command{
+		Use:   "index",
+		Short: "Build a full-text search index over downloaded posts",
+		Long: `Build a full-text search index over all the posts downloaded in a directory.
+
+The posts of the subdirectories are indexed too. The index is a SQLite full-text (FTS5)
+database stored as search-index.db inside the directory, and is used by the search command.
+
+Example usage:
+  sbstck-dl index --dir ./downloads`,
+		Run: func(cmd *cobra.Command, args []string) {
+			posts, err := lib.ScanLocalPosts(indexDir)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(posts) == 0 {
+				fmt.Println("No downloaded posts found in", indexDir)
+				return
+			}
+			if verbose {
+				fmt.Printf("Indexing %d posts...\n", len(posts))
+			}
+
+			indexPath := filepath.Join(indexDir, lib.SearchIndexFile)
+			idx, err := lib.BuildSearchIndex(indexPath, posts)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := idx.Close(); err != nil {
+				log.Fatal(err)
+			}
+
+			fmt.Printf("Indexed %d posts into %s\n", len(posts), indexPath)
+		},
+	}
+)
+
+func init() {
+	indexCmd.Flags().StringVar(&indexDir, "dir", ".", "Directory containing the downloaded posts")
+}
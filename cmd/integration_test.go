@@ -157,7 +157,7 @@ func TestCommandExecution(t *testing.T) {
 				}
 				
 				// Write to file
-				filePath := makePath(post, outputFolder, format)
+				filePath := lib.PostFilePath(post, outputFolder, format)
 				err = post.WriteToFile(filePath, format, addSourceURL)
 				if err != nil {
 					t.Fatalf("Failed to write file: %v", err)
@@ -169,7 +169,7 @@ func TestCommandExecution(t *testing.T) {
 		assert.NoError(t, err)
 		
 		// Check that file was created - use the correct expected format
-		// Since mockPost.PostDate is "2023-01-01" (not RFC3339), convertDateTime will return ""
+		// Since mockPost.PostDate is "2023-01-01" (not RFC3339), the file name has no date
 		expectedFile := filepath.Join(tempDir, "_test-post.html")
 		_, err = os.Stat(expectedFile)
 		assert.NoError(t, err)
@@ -224,8 +224,8 @@ func TestCommandFlags(t *testing.T) {
 	t.Run("list command flags", func(t *testing.T) {
 		cmd := listCmd
 		
-		// Check local flags
-		assert.NotNil(t, cmd.Flags().Lookup("url"))
+		// Check persistent flags, shared with the sections and authors subcommands
+		assert.NotNil(t, cmd.PersistentFlags().Lookup("url"))
 	})
 }
 
@@ -3,43 +3,170 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"os"
 
+	"github.com/alexferrari88/sbstck-dl/lib"
 	"github.com/spf13/cobra"
 )
 
 // listCmd represents the list command
 var (
-	pubUrl  string
-	listCmd = &cobra.Command{
+	pubUrl      string
+	listDetails bool
+	listOutput  string
+	listMissing bool
+	listDir     string
+	listCmd     = &cobra.Command{
 		Use:   "list",
 		Short: "List the posts of a Substack",
-		Long:  `List the posts of a Substack`,
+		Long: `List the posts of a Substack.
+
+By default only the post URLs are listed. With --details, the title, publication date, type,
+paid status and word count of each post are read from the archive API.
+
+With --missing, only the posts not downloaded in the --dir directory yet are listed, along with
+the posts modified on the site after they were downloaded (marked as outdated).
+
+Example usage:
+  sbstck-dl list --url https://example.substack.com
+  sbstck-dl list --url https://example.substack.com --details --output csv > posts.csv
+  sbstck-dl list --url https://example.substack.com --missing --dir ./downloads
+
+Use the sections, authors and series subcommands to enumerate the sections, contributors and
+series of the publication, for the --section, --author and --series filters of the download command.`,
 		Run: func(cmd *cobra.Command, args []string) {
+			if !containsFormat(lib.ListingFormats, listOutput) {
+				log.Fatalf("unknown format: %s", listOutput)
+			}
 			parsedURL, err := parseURL(pubUrl)
 			if err != nil {
 				log.Fatal(err)
 			}
 			mainWebsite := fmt.Sprintf("%s://%s", parsedURL.Scheme, parsedURL.Host)
 			if verbose {
-				fmt.Printf("Main website: %s\n", mainWebsite)
-				fmt.Println("Getting all posts URLs...")
+				fmt.Fprintf(os.Stderr, "Main website: %s\n", mainWebsite)
+				fmt.Fprintln(os.Stderr, "Getting all posts URLs...")
 			}
 			dateFilterfunc := makeDateFilterFunc(beforeDate, afterDate)
-			urls, err := extractor.GetAllPostsURLs(ctx, mainWebsite, dateFilterfunc)
-			if err != nil {
-				log.Fatal(err)
+
+			var listings []lib.PostListing
+			if listMissing {
+				entries, err := extractor.GetSitemapPosts(ctx, mainWebsite, dateFilterfunc)
+				if err != nil {
+					log.Fatal(err)
+				}
+				listings, err = lib.MissingPosts(entries, listDir)
+				if err != nil {
+					log.Fatal(err)
+				}
+				if listDetails && len(listings) > 0 {
+					posts, err := extractor.GetArchivePosts(ctx, mainWebsite, nil)
+					if err != nil {
+						log.Fatal(err)
+					}
+					listings = lib.AddListingDetails(listings, posts)
+				}
+			} else if listDetails {
+				posts, err := extractor.GetArchivePosts(ctx, mainWebsite, dateFilterfunc)
+				if err != nil {
+					log.Fatal(err)
+				}
+				for _, post := range posts {
+					listings = append(listings, lib.NewPostListing(post))
+				}
+			} else {
+				urls, err := extractor.GetAllPostsURLs(ctx, mainWebsite, dateFilterfunc)
+				if err != nil {
+					log.Fatal(err)
+				}
+				for _, url := range urls {
+					listings = append(listings, lib.PostListing{URL: url})
+				}
 			}
 			if verbose {
-				fmt.Printf("Found %d posts.\n", len(urls))
+				fmt.Fprintf(os.Stderr, "Found %d posts.\n", len(listings))
 			}
-			for _, url := range urls {
-				fmt.Println(url)
+
+			if err := lib.WritePostListings(os.Stdout, listings, listOutput, listDetails); err != nil {
+				log.Fatal(err)
 			}
 		},
 	}
 )
 
+// listSectionsCmd represents the list sections command
+var listSectionsCmd = &cobra.Command{
+	Use:   "sections",
+	Short: "List the sections of a Substack with their number of posts",
+	Long: `List the sections of a Substack with their number of posts, read from the archive API.
+The section slugs and names can be given to "download --section".`,
+	Run: func(cmd *cobra.Command, args []string) {
+		posts := listArchivePosts()
+		if err := lib.WriteSectionCounts(os.Stdout, lib.CountSections(posts), listOutput); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// listAuthorsCmd represents the list authors command
+var listAuthorsCmd = &cobra.Command{
+	Use:   "authors",
+	Short: "List the contributors of a Substack with their number of posts",
+	Long: `List the contributors of a Substack with the number of posts they're credited on, read
+from the archive API. The handles and names can be given to "download --author".`,
+	Run: func(cmd *cobra.Command, args []string) {
+		posts := listArchivePosts()
+		if err := lib.WriteAuthorCounts(os.Stdout, lib.CountAuthors(posts), listOutput); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// listSeriesCmd represents the list series command
+var listSeriesCmd = &cobra.Command{
+	Use:   "series",
+	Short: "List the series of a Substack with their number of posts",
+	Long: `List the series of a Substack with their number of posts, detected from the titles of the
+posts read from the archive API: posts numbering their part of the same name ("The Crisis,
+Part 2") or sharing a prefix ("The Crisis: Origins"). The names and slugs can be given to
+"download --series".`,
+	Run: func(cmd *cobra.Command, args []string) {
+		posts := listArchivePosts()
+		if err := lib.WriteSeriesCounts(os.Stdout, lib.CountSeries(posts), listOutput); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// listArchivePosts returns the posts of the publication given with --url, with their metadata
+func listArchivePosts() []lib.Post {
+	if !containsFormat(lib.ListingFormats, listOutput) {
+		log.Fatalf("unknown format: %s", listOutput)
+	}
+	parsedURL, err := parseURL(pubUrl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mainWebsite := fmt.Sprintf("%s://%s", parsedURL.Scheme, parsedURL.Host)
+	posts, err := extractor.GetArchivePosts(ctx, mainWebsite, makeDateFilterFunc(beforeDate, afterDate))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Found %d posts.\n", len(posts))
+	}
+	return posts
+}
+
 func init() {
-	listCmd.Flags().StringVarP(&pubUrl, "url", "u", "", "Specify the Substack url")
-	listCmd.MarkFlagRequired("url")
+	listCmd.PersistentFlags().StringVarP(&pubUrl, "url", "u", "", "Specify the Substack url")
+	listCmd.PersistentFlags().StringVar(&listOutput, "output", "table", "Output format (options: \"table\", \"json\", \"csv\")")
+	listCmd.Flags().BoolVar(&listDetails, "details", false, "Include the title, date, type, paid status and word count of each post")
+	listCmd.Flags().BoolVar(&listMissing, "missing", false, "Only list the posts not downloaded yet or modified since they were downloaded")
+	listCmd.Flags().StringVar(&listDir, "dir", ".", "Download directory checked by --missing")
+	listCmd.MarkPersistentFlagRequired("url")
+
+	listCmd.AddCommand(listSectionsCmd)
+	listCmd.AddCommand(listAuthorsCmd)
+	listCmd.AddCommand(listSeriesCmd)
 }
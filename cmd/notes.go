@@ -18,6 +18,16 @@ var (
 	notesFormat    string
 	notesMaxPages  int
 	notesOnly      bool
+	notesMonthly   bool
+	notesMinReacts int
+	notesSort      string
+	notesFeed      string
+	notesImages    bool
+	notesQuality   string
+	notesImagesDir string
+	notesFiles     bool
+	notesFileExts  string
+	notesFilesDir  string
 	notesCmd       = &cobra.Command{
 		Use:   "notes",
 		Short: "Download Substack Notes for a specific user",
@@ -28,26 +38,48 @@ all activity and filters for notes vs regular comments.
 
 Example usage:
   sbstck-dl notes --user-id 303863305 --username nweiss --output-dir ./notes
-  sbstck-dl notes --user-id 303863305 --format md --max-pages 5`,
+  sbstck-dl notes --user-id 303863305 --format md --max-pages 5
+  sbstck-dl notes --user-id 303863305 --monthly
+  sbstck-dl notes --user-id 303863305 --min-reactions 50 --sort reactions
+  sbstck-dl notes --user-id 303863305 --feed likes
+  sbstck-dl notes --user-id 303863305 --download-images --download-files
+  sbstck-dl notes --feed saves --cookie_name substack.sid --cookie_val ...`,
 		Run: func(cmd *cobra.Command, args []string) {
-			if notesUserID == "" {
+			if notesUserID == "" && notesFeed != lib.NotesFeedSaves {
 				log.Fatal("user-id is required")
 			}
+			if !containsFormat(lib.NoteSortOrders, notesSort) {
+				log.Fatalf("invalid sort order %q, expected one of %s", notesSort, strings.Join(lib.NoteSortOrders, ", "))
+			}
+			if !containsFormat(lib.NotesFeeds, notesFeed) {
+				log.Fatalf("invalid feed %q, expected one of %s", notesFeed, strings.Join(lib.NotesFeeds, ", "))
+			}
+			quality, err := lib.ParseImageQuality(notesQuality)
+			if err != nil {
+				log.Fatalln(err)
+			}
 
 			// Setup output directory
 			outputDir := notesOutputDir
 			if notesUsername != "" {
 				outputDir = filepath.Join(notesOutputDir, notesUsername)
-			} else {
+			} else if notesUserID != "" {
 				outputDir = filepath.Join(notesOutputDir, fmt.Sprintf("user_%s", notesUserID))
 			}
+			if notesFeed != lib.NotesFeedActivity {
+				outputDir = filepath.Join(outputDir, notesFeed)
+			}
 
 			// Create output directory
 			if err := os.MkdirAll(outputDir, 0755); err != nil {
 				log.Fatalf("Error creating output directory: %v", err)
 			}
 
-			fmt.Printf("Downloading notes for user ID: %s\n", notesUserID)
+			if notesFeed == lib.NotesFeedSaves {
+				fmt.Println("Downloading saved posts")
+			} else {
+				fmt.Printf("Downloading %s notes for user ID: %s\n", notesFeed, notesUserID)
+			}
 			fmt.Printf("Output directory: %s\n", outputDir)
 			fmt.Printf("Format: %s\n", notesFormat)
 			fmt.Println()
@@ -56,7 +88,7 @@ Example usage:
 			notesClient := lib.NewNotesClient(fetcher)
 
 			// Fetch all notes/comments
-			items, err := notesClient.FetchAllUserActivity(notesUserID, notesMaxPages, verbose)
+			items, err := notesClient.FetchFeed(ctx, notesFeed, notesUserID, notesMaxPages, verbose)
 			if err != nil {
 				log.Fatalf("Error fetching user activity: %v", err)
 			}
@@ -83,16 +115,70 @@ Example usage:
 					if note != nil {
 						notes = append(notes, note)
 					}
+				} else if notesFeed == lib.NotesFeedSaves {
+					if note := notesClient.ConvertPostToNote(item); note != nil {
+						notes = append(notes, note)
+					}
+				}
+			}
+
+			if notesMinReacts > 0 {
+				notes = lib.FilterNotesByReactions(notes, notesMinReacts)
+				if verbose {
+					fmt.Printf("%d notes have at least %d reactions\n", len(notes), notesMinReacts)
 				}
 			}
+			lib.SortNotes(notes, notesSort)
 
 			fmt.Printf("Processing %d potential notes...\n", len(notes))
 			fmt.Println()
 
+			if notesImages || notesFiles {
+				var fileExts []string
+				if notesFileExts != "" {
+					fileExts = strings.Split(strings.ReplaceAll(notesFileExts, " ", ""), ",")
+				}
+				mediaOpts := lib.NotesMediaOptions{
+					DownloadImages: notesImages,
+					ImageQuality:   quality,
+					ImagesDir:      notesImagesDir,
+					DownloadFiles:  notesFiles,
+					FileExtensions: fileExts,
+					FilesDir:       notesFilesDir,
+				}
+				var images, files, failed int
+				for _, note := range notes {
+					result, err := notesClient.DownloadNoteMedia(ctx, note, outputDir, mediaOpts)
+					if err != nil {
+						log.Printf("Error downloading media of note %s: %v", note.ID, err)
+						continue
+					}
+					images += result.Success
+					failed += result.Failed
+					for _, file := range result.Files {
+						if file.Success {
+							files++
+						} else {
+							failed++
+						}
+					}
+				}
+				fmt.Printf("Downloaded %d images and %d attachments, %d failed\n", images, files, failed)
+			}
+
+			if notesMonthly {
+				paths, err := notesClient.SaveMonthlyDigests(notes, outputDir, notesFormat)
+				if err != nil {
+					log.Fatalf("Error saving monthly digests: %v", err)
+				}
+				fmt.Printf("Successfully saved %d items in %d monthly files to: %s\n", len(notes), len(paths), outputDir)
+				return
+			}
+
 			// Save all notes
 			for i, note := range notes {
 				if verbose {
-					fmt.Printf("[%d/%d] Saving note: %s\n", i+1, len(notes), note.ID)
+					fmt.Printf("[%d/%d] Saving note: %s (%d reactions)\n", i+1, len(notes), note.ID, note.ReactionCount)
 				}
 				if err := notesClient.SaveNote(note, outputDir, notesFormat); err != nil {
 					log.Printf("Error saving note %s: %v", note.ID, err)
@@ -105,12 +191,20 @@ Example usage:
 )
 
 func init() {
-	notesCmd.Flags().StringVar(&notesUserID, "user-id", "", "User ID (required, e.g., 303863305 for @nweiss)")
+	notesCmd.Flags().StringVar(&notesUserID, "user-id", "", "User ID (required except for --feed saves, e.g., 303863305 for @nweiss)")
 	notesCmd.Flags().StringVar(&notesUsername, "username", "", "Username for organizing output (e.g., nweiss)")
 	notesCmd.Flags().StringVar(&notesOutputDir, "output-dir", "./notes", "Output directory")
 	notesCmd.Flags().StringVar(&notesFormat, "format", "md", "Output format (html, md, txt)")
 	notesCmd.Flags().IntVar(&notesMaxPages, "max-pages", 10, "Maximum pages to fetch")
 	notesCmd.Flags().BoolVar(&notesOnly, "notes-only", false, "Try to filter for notes vs regular comments")
-
-	notesCmd.MarkFlagRequired("user-id")
+	notesCmd.Flags().BoolVar(&notesMonthly, "monthly", false, "Save the notes of each month together in one file (YYYY-MM.{format}) instead of one file per note")
+	notesCmd.Flags().IntVar(&notesMinReacts, "min-reactions", 0, "Only save the notes with at least this many reactions")
+	notesCmd.Flags().StringVar(&notesFeed, "feed", lib.NotesFeedActivity, "Feed to download: activity (the notes of the user), likes (the notes they liked) or saves (the posts saved by the logged in user)")
+	notesCmd.Flags().StringVar(&notesSort, "sort", "date", "Order of the notes: date (oldest first) or reactions (most first)")
+	notesCmd.Flags().BoolVar(&notesImages, "download-images", false, "Download the images of the notes locally and update them to reference the local files")
+	notesCmd.Flags().StringVar(&notesQuality, "image-quality", "high", "Image quality to download (options: \"high\", \"medium\", \"low\", \"original\", or a width in pixels such as \"1200\")")
+	notesCmd.Flags().StringVar(&notesImagesDir, "images-dir", "images", "Directory name for downloaded images")
+	notesCmd.Flags().BoolVar(&notesFiles, "download-files", false, "Download the file attachments of the notes locally and update them to reference the local files")
+	notesCmd.Flags().StringVar(&notesFileExts, "file-extensions", "", "Comma-separated list of file extensions to download (e.g., 'pdf,docx,txt'). If empty, downloads all file types")
+	notesCmd.Flags().StringVar(&notesFilesDir, "files-dir", "files", "Directory name for downloaded file attachments")
 }
\ No newline at end of file
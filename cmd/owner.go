@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/alexferrari88/sbstck-dl/lib"
+	"github.com/spf13/cobra"
+)
+
+// ownerCmd represents the owner command
+var (
+	ownerURL       string
+	ownerOutputDir string
+	ownerDrafts    bool
+	ownerFormat    string
+	ownerCmd       = &cobra.Command{
+		Use:   "owner",
+		Short: "Back up the subscribers and settings of your publication",
+		Long: `Download the data only available to the owner of a publication, through the publisher API:
+the subscriber list, as the CSV of the dashboard, and the settings of the publication. The
+cookie of the owner is required.
+
+The files are saved in the owner directory of the output directory, only readable by you as
+the subscriber list holds personal data. With --drafts, the drafts and scheduled posts are
+backed up too, as with the drafts command. Together with download, this saves everything
+needed to leave Substack.
+
+Example usage:
+  sbstck-dl owner --url https://example.substack.com --cookie_name substack.sid --cookie_val ... --output ./archive
+  sbstck-dl owner --url https://example.substack.com --cookie_name substack.sid --cookie_val ... --output ./archive --drafts`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if fetcher.Cookie == nil {
+				log.Fatal("the data of a publication owner requires the --cookie_name and --cookie_val of the owner")
+			}
+			if ownerDrafts && !containsFormat([]string{"html", "md", "txt"}, ownerFormat) {
+				log.Fatalf("unknown format: %s", ownerFormat)
+			}
+			parsedURL, err := parseURL(ownerURL)
+			if err != nil {
+				log.Fatalf("invalid URL: %s", ownerURL)
+			}
+			client, err := lib.NewPublicationAPIClient(fetcher, parsedURL.Scheme+"://"+parsedURL.Host)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer lockOutput(ownerOutputDir).Unlock()
+
+			backup, err := lib.BackupOwnerData(ctx, client, ownerOutputDir)
+			if err != nil {
+				fatalf("Error backing up %s: %v", parsedURL.Host, err)
+			}
+			fmt.Printf("Saved %d subscribers to: %s\n", backup.Subscribers, backup.SubscribersPath)
+			fmt.Printf("Saved the publication settings to: %s\n", backup.SettingsPath)
+
+			if !ownerDrafts {
+				return
+			}
+			for _, kind := range []string{lib.DraftKindDraft, lib.DraftKindScheduled} {
+				drafts, err := lib.FetchDrafts(ctx, client, kind)
+				if err != nil {
+					fatalf("Error fetching the %s of %s: %v", kind, parsedURL.Host, err)
+				}
+				paths, err := lib.SaveDrafts(drafts, ownerOutputDir, ownerFormat)
+				if err != nil {
+					fatalf("Error saving %s: %v", kind, err)
+				}
+				fmt.Printf("Saved %d %s\n", len(paths), kind)
+			}
+		},
+	}
+)
+
+func init() {
+	ownerCmd.Flags().StringVarP(&ownerURL, "url", "u", "", "URL of the publication")
+	ownerCmd.Flags().StringVarP(&ownerOutputDir, "output", "o", ".", "Output directory; the data is saved in its owner directory")
+	ownerCmd.Flags().BoolVar(&ownerDrafts, "drafts", false, "Also back up the drafts and scheduled posts")
+	ownerCmd.Flags().StringVarP(&ownerFormat, "format", "f", "html", "Format of the drafts (options: \"html\", \"md\", \"txt\")")
+	ownerCmd.MarkFlagRequired("url")
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/alexferrari88/sbstck-dl/lib"
+	"github.com/spf13/cobra"
+)
+
+// repairMediaCmd represents the repair-media command
+var (
+	repairDir       string
+	repairImagesDir string
+	repairQuality   string
+	repairDryRun    bool
+	repairMediaCmd  = &cobra.Command{
+		Use:   "repair-media",
+		Short: "Download the images of downloaded posts still linked to Substack",
+		Long: `Scan the HTML and Markdown posts of a directory and its subdirectories for images still
+linked to Substack's servers, e.g. posts downloaded without --download-images, then download
+the images and rewrite the posts to link them locally.
+
+The images of each post are saved in the images directory next to it, as with
+download --download-images. Images that can't be downloaded are left linked to Substack,
+so the command can be run again later.
+
+Example usage:
+  sbstck-dl repair-media --dir ./archive
+  sbstck-dl repair-media --dir ./archive --image-quality original
+  sbstck-dl repair-media --dir ./archive --dry-run`,
+		Run: func(cmd *cobra.Command, args []string) {
+			quality, err := lib.ParseImageQuality(repairQuality)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if !repairDryRun {
+				defer lockOutput(repairDir).Unlock()
+			}
+
+			downloader := lib.NewImageDownloader(fetcher, repairDir, repairImagesDir, quality)
+			if verbose {
+				downloader.OnImage = func(slug string, image lib.ImageInfo) {
+					if image.Success {
+						fmt.Printf("%s: downloaded %s\n", slug, image.OriginalURL)
+					} else {
+						fmt.Printf("%s: failed to download %s: %v\n", slug, image.OriginalURL, image.Error)
+					}
+				}
+			}
+
+			repairs, err := downloader.RepairMedia(ctx, repairDir, repairDryRun)
+			if err != nil {
+				fatalf("Error repairing the images of %s: %v", repairDir, err)
+			}
+			if len(repairs) == 0 {
+				fmt.Println("No posts with remote images found in", repairDir)
+				return
+			}
+
+			var images, failed int
+			var bytes int64
+			for _, repair := range repairs {
+				images += repair.Images
+				failed += repair.Failed
+				bytes += repair.Bytes
+				if repairDryRun {
+					fmt.Printf("%s: %d remote images\n", repair.Path, repair.Failed)
+				} else if repair.Failed > 0 {
+					fmt.Printf("%s: %d images couldn't be downloaded\n", repair.Path, repair.Failed)
+				}
+			}
+			if repairDryRun {
+				fmt.Printf("Found %d remote images in %d posts\n", failed, len(repairs))
+				return
+			}
+			fmt.Printf("Downloaded %d images (%s) in %d posts", images, formatBytes(bytes), len(repairs))
+			if failed > 0 {
+				fmt.Printf(", %d failed", failed)
+			}
+			fmt.Println()
+		},
+	}
+)
+
+func init() {
+	repairMediaCmd.Flags().StringVar(&repairDir, "dir", ".", "Directory containing the downloaded posts")
+	repairMediaCmd.Flags().StringVar(&repairImagesDir, "images-dir", "images", "Directory name for downloaded images")
+	repairMediaCmd.Flags().StringVar(&repairQuality, "image-quality", "high", "Image quality to download (options: \"high\", \"medium\", \"low\", \"original\", or a width in pixels such as \"1200\")")
+	repairMediaCmd.Flags().BoolVar(&repairDryRun, "dry-run", false, "Only list the posts with remote images")
+}
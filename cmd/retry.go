@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alexferrari88/sbstck-dl/lib"
+	"github.com/spf13/cobra"
+)
+
+// retryCmd represents the retry command
+var (
+	retryManifest string
+	retryList     bool
+	retryCmd      = &cobra.Command{
+		Use:   "retry",
+		Short: "Retry the posts that failed to download",
+		Long: `Download again only the posts recorded as failed in the manifest of a download directory,
+each with the options of the run it failed in (format, images, attachments...).
+
+Posts are recorded as failed when they couldn't be fetched or written, or when some of their
+images or attachments couldn't be downloaded. Posts that succeed are removed from the failures.
+
+Example usage:
+  sbstck-dl retry --manifest ./downloads/manifest.json
+  sbstck-dl retry --manifest ./downloads --list`,
+		Run: func(cmd *cobra.Command, args []string) {
+			startTime := time.Now()
+			dir := manifestDir(retryManifest)
+
+			manifest, err := lib.LoadManifest(dir)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(manifest.Failures) == 0 {
+				fmt.Println("No failed posts to retry in", manifest.Path())
+				return
+			}
+
+			if retryList {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "SLUG\tSTAGE\tFORMAT\tFAILED AT\tERROR")
+				for _, failure := range manifest.Failures {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", failure.Slug, failure.Stage, failure.Options.Format,
+						failure.FailedAt.Local().Format("2006-01-02 15:04"), failure.Error)
+				}
+				w.Flush()
+				return
+			}
+
+			defer lockOutput(dir).Unlock()
+			if verbose {
+				fmt.Printf("Retrying %d failed posts\n", len(manifest.Failures))
+			}
+			summary, err := lib.RetryFailedPosts(ctx, fetcher, dir, func(result lib.PostResult) {
+				if result.Err != nil {
+					log.Printf("Error downloading post %s: %v\n", result.URL, result.Err)
+				} else if verbose {
+					fmt.Printf("Downloaded post %s to %s\n", result.URL, result.Path)
+				}
+			})
+			if err != nil {
+				fatalln(err)
+			}
+
+			fmt.Printf("Retried %d posts: %d downloaded, %d still failing\n", summary.Found, summary.Downloaded, summary.Failed)
+			if summary.ImagesFailed > 0 {
+				fmt.Printf("%d images or attachments still failed to download\n", summary.ImagesFailed)
+			}
+			if verbose {
+				printFetchStats()
+				fmt.Println("Done in ", time.Since(startTime))
+			}
+		},
+	}
+)
+
+func init() {
+	retryCmd.Flags().StringVar(&retryManifest, "manifest", lib.ManifestFile, "Manifest of the download to retry, or the directory containing it")
+	retryCmd.Flags().BoolVar(&retryList, "list", false, "List the failed posts without retrying them")
+}
+
+// manifestDir returns the download directory of a manifest path, which can also be the directory itself
+func manifestDir(path string) string {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return path
+	}
+	return filepath.Dir(path)
+}
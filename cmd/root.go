@@ -3,10 +3,14 @@ package cmd
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/alexferrari88/sbstck-dl/lib"
 	"github.com/spf13/cobra"
@@ -47,7 +51,22 @@ var (
 	afterDate      string
 	idCookieName   cookieName
 	idCookieVal    string
+	requestTimeout time.Duration
+	urlTimeout     time.Duration
+	runDeadline    time.Duration
+	respectRobots  bool
+	jitter         time.Duration
+	retryBudget    int
+	maxRetries     int
+	initialBackoff time.Duration
+	maxElapsedTime time.Duration
+	http1          bool
+	brotli         bool
+	offline        bool
+	configPath     string
+	config         = &lib.Config{}
 	ctx            = context.Background()
+	cancelRun      = context.CancelFunc(func() {})
 	parsedProxyURL *url.URL
 	fetcher        *lib.Fetcher
 	extractor      *lib.Extractor
@@ -71,6 +90,37 @@ var (
 			if ratePerSecond == 0 {
 				log.Fatal("rate must be greater than 0")
 			}
+			if requestTimeout < 0 {
+				log.Fatal("timeout must not be negative")
+			}
+			if maxRetries < 0 {
+				log.Fatal("max-retries must not be negative")
+			}
+
+			if configPath != "" {
+				var err error
+				config, err = lib.LoadConfig(configPath)
+				if err != nil {
+					log.Fatal(err)
+				}
+			} else if path := lib.DefaultConfigPath(); path != "" {
+				if loaded, err := lib.LoadConfig(path); err == nil {
+					config = loaded
+				} else if !os.IsNotExist(err) {
+					log.Fatal(err)
+				}
+			}
+
+			// Ctrl-C cancels the run, which stops cleanly, saving the manifest. A second one exits at once.
+			signalCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			go func() {
+				<-signalCtx.Done()
+				stopSignals()
+			}()
+			ctx, cancelRun = signalCtx, stopSignals
+			if runDeadline > 0 {
+				ctx, cancelRun = context.WithTimeout(signalCtx, runDeadline)
+			}
 
 			if idCookieVal != "" && idCookieName != "" {
 				if idCookieName == substackSid {
@@ -86,7 +136,33 @@ var (
 				}
 			}
 
-			fetcher = lib.NewFetcher(lib.WithRatePerSecond(ratePerSecond), lib.WithProxyURL(parsedProxyURL), lib.WithCookie(cookie))
+			fetcherOpts := []lib.FetcherOption{
+				lib.WithRatePerSecond(ratePerSecond),
+				lib.WithProxyURL(parsedProxyURL),
+				lib.WithCookie(cookie),
+				lib.WithTimeout(requestTimeout),
+				lib.WithURLTimeout(urlTimeout),
+				lib.WithRespectRobots(respectRobots),
+				lib.WithJitter(jitter),
+				lib.WithMaxRetries(maxRetries),
+				lib.WithBackOffConfig(lib.NewBackOff(initialBackoff, maxElapsedTime)),
+			}
+			if retryBudget > 0 {
+				fetcherOpts = append(fetcherOpts, lib.WithRetryBudget(lib.NewRetryBudget(retryBudget)))
+			}
+			if http1 {
+				fetcherOpts = append(fetcherOpts, lib.WithHTTP2(false))
+			}
+			if brotli {
+				fetcherOpts = append(fetcherOpts, lib.WithBrotli(true))
+			}
+			if offline {
+				fetcherOpts = append(fetcherOpts, lib.WithOffline(true))
+			}
+			fetcher = lib.NewFetcher(append(fetcherOpts, config.Transport.FetcherOptions()...)...)
+			if verbose {
+				fetcher.OnEvent = printFetchEvent
+			}
 			extractor = lib.NewExtractor(fetcher)
 		},
 	}
@@ -96,6 +172,7 @@ var (
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	err := rootCmd.Execute()
+	cancelRun()
 	if err != nil {
 		os.Exit(1)
 	}
@@ -109,28 +186,61 @@ func init() {
 	rootCmd.PersistentFlags().IntVarP(&ratePerSecond, "rate", "r", lib.DefaultRatePerSecond, "Specify the rate of requests per second")
 	rootCmd.PersistentFlags().StringVar(&beforeDate, "before", "", "Download posts published before this date (format: YYYY-MM-DD)")
 	rootCmd.PersistentFlags().StringVar(&afterDate, "after", "", "Download posts published after this date (format: YYYY-MM-DD)")
+	rootCmd.PersistentFlags().DurationVar(&requestTimeout, "timeout", lib.DefaultTimeout, "Timeout of a single HTTP request attempt, raise it for slow hosts (0 for no timeout)")
+	rootCmd.PersistentFlags().DurationVar(&urlTimeout, "url-timeout", lib.DefaultURLTimeout, "Total time spent fetching a URL, retries included (0 for no limit)")
+	rootCmd.PersistentFlags().DurationVar(&runDeadline, "deadline", 0, "Stop the whole run after this duration, e.g. 2h (0 for no deadline)")
+	rootCmd.PersistentFlags().BoolVar(&respectRobots, "respect-robots", false, "Obey the robots.txt of the hosts, including their Crawl-delay")
+	rootCmd.PersistentFlags().DurationVar(&jitter, "jitter", 0, "Add a random delay of up to this duration before each request, e.g. 500ms")
+	rootCmd.PersistentFlags().IntVar(&retryBudget, "retry-budget", 0, "Maximum number of retries of the whole run, after which failing requests aren't retried (0 for no limit)")
+	rootCmd.PersistentFlags().IntVar(&maxRetries, "max-retries", lib.DefaultMaxRetries, "Maximum number of retries of a request failing with a transient error (0 for no retries)")
+	rootCmd.PersistentFlags().DurationVar(&initialBackoff, "initial-backoff", lib.DefaultInitialBackoff, "Wait before the first retry of a request, growing for the next ones")
+	rootCmd.PersistentFlags().DurationVar(&maxElapsedTime, "max-elapsed-time", lib.DefaultMaxElapsedTime, "Stop retrying a request once this much time has passed since its first attempt (0 for no limit)")
+	rootCmd.PersistentFlags().BoolVar(&http1, "http1", false, "Use HTTP/1.1 only, for proxies that break HTTP/2")
+	rootCmd.PersistentFlags().BoolVar(&brotli, "brotli", false, "Accept brotli compressed responses besides gzip ones")
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "Never access the network: work from the downloaded posts and caches only, failing if data is missing")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Configuration file (default sbstck-dl/config.json in the user configuration directory, if it exists)")
 	rootCmd.MarkFlagsRequiredTogether("cookie_name", "cookie_val")
 
 	rootCmd.AddCommand(downloadCmd)
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(notesCmd)
+	rootCmd.AddCommand(commentsCmd)
+	rootCmd.AddCommand(indexCmd)
+	rootCmd.AddCommand(searchCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(apiCmd)
+	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(convertCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(retryCmd)
+	rootCmd.AddCommand(draftsCmd)
+	rootCmd.AddCommand(ownerCmd)
+	rootCmd.AddCommand(repairMediaCmd)
 }
 
 func makeDateFilterFunc(beforeDate string, afterDate string) lib.DateFilterFunc {
-	var dateFilterFunc lib.DateFilterFunc
-	if beforeDate != "" && afterDate != "" {
-		dateFilterFunc = func(date string) bool {
-			return date > afterDate && date < beforeDate
-		}
-	} else if beforeDate != "" {
-		dateFilterFunc = func(date string) bool {
-			return date < beforeDate
-		}
-	} else if afterDate != "" {
-		dateFilterFunc = func(date string) bool {
-			return date > afterDate
+	return lib.NewDateFilter(beforeDate, afterDate)
+}
+
+// printFetchEvent tells in verbose mode why requests are delayed, and the protocol used with
+// each host. Short waits for the rate limiter happen at most requests, so only the ones of a
+// second or more are shown.
+func printFetchEvent(event lib.FetchEvent) {
+	switch event.Kind {
+	case lib.FetchEventRateLimit:
+		if event.Wait >= time.Second {
+			fmt.Printf("Rate limited: waited %s before requesting %s\n", event.Wait.Round(time.Millisecond), event.URL)
 		}
+	case lib.FetchEventRetry:
+		fmt.Printf("Retrying %s in %s after %d attempts: %v\n", event.URL, event.Wait.Round(time.Millisecond), event.Attempt, event.Err)
+	case lib.FetchEventProtocol:
+		fmt.Printf("Using %s for %s\n", event.Proto, event.URL)
 	}
-	return dateFilterFunc
+}
+
+// printFetchStats tells in verbose mode where the time of the run went
+func printFetchStats() {
+	fmt.Println("Network:", fetcher.Stats())
 }
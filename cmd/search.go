@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/alexferrari88/sbstck-dl/lib"
+	"github.com/spf13/cobra"
+)
+
+// searchCmd represents the search command
+var (
+	searchDir   string
+	searchLimit int
+	searchCmd   = &cobra.Command{
+		Use:   "search [query]",
+		Short: "Search the downloaded posts",
+		Long: `Search the posts of a directory previously indexed with the index command.
+
+Only posts containing every word of the query are returned, best matches first (ranked
+with BM25, matches in the title counting more).
+
+Example usage:
+  sbstck-dl search "climate policy" --dir ./downloads`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			indexPath := filepath.Join(searchDir, lib.SearchIndexFile)
+			idx, err := lib.OpenSearchIndex(indexPath)
+			if err != nil {
+				log.Fatalf("%v (run \"sbstck-dl index --dir %s\" first)", err, searchDir)
+			}
+			defer idx.Close()
+
+			query := strings.Join(args, " ")
+			results, err := idx.Search(query, searchLimit)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(results) == 0 {
+				fmt.Printf("No posts found for %q\n", query)
+				return
+			}
+
+			for _, result := range results {
+				fmt.Printf("%s  %s\n", result.Document.Date, result.Document.Title)
+				fmt.Printf("  %s\n", result.Document.Path)
+				fmt.Printf("  %s\n\n", result.Snippet)
+			}
+			if verbose {
+				fmt.Printf("Found %d posts\n", len(results))
+			}
+		},
+	}
+)
+
+func init() {
+	searchCmd.Flags().StringVar(&searchDir, "dir", ".", "Directory containing the downloaded posts and the search index")
+	searchCmd.Flags().IntVarP(&searchLimit, "limit", "l", 10, "Maximum number of results to show (0 for all)")
+}
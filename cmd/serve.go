@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/alexferrari88/sbstck-dl/lib"
+	"github.com/spf13/cobra"
+)
+
+// serveCmd represents the serve command
+var (
+	serveDir  string
+	serveAddr string
+	serveCmd  = &cobra.Command{
+		Use:   "serve",
+		Short: "Browse downloaded posts in a local web interface",
+		Long: `Serve a directory of downloaded posts as a small website with a browseable index,
+a search box, tag and year filters, and a clean reading view.
+
+Example usage:
+  sbstck-dl serve --dir ./downloads --addr :8080`,
+		Run: func(cmd *cobra.Command, args []string) {
+			server, err := lib.NewArchiveServer(serveDir)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer server.Close()
+
+			fmt.Printf("Serving %d posts from %s on http://%s\n", server.PostCount(), serveDir, displayAddr(serveAddr))
+			if err := listenAndServe(serveAddr, server); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+)
+
+func init() {
+	serveCmd.Flags().StringVar(&serveDir, "dir", ".", "Directory containing the downloaded posts")
+	serveCmd.Flags().StringVar(&serveAddr, "addr", "localhost:8080", "Address to listen on")
+}
+
+// listenAndServe serves handler on addr until the run is interrupted
+func listenAndServe(addr string, handler http.Handler) error {
+	server := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// displayAddr turns a listen address into something that can be opened in a browser
+func displayAddr(addr string) string {
+	if len(addr) > 0 && addr[0] == ':' {
+		return "localhost" + addr
+	}
+	return addr
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/alexferrari88/sbstck-dl/lib"
+	"github.com/spf13/cobra"
+)
+
+// statsCmd represents the stats command
+var (
+	statsDir    string
+	statsURL    string
+	statsFormat string
+	statsOutput string
+	statsTop    int
+	statsCmd    = &cobra.Command{
+		Use:   "stats",
+		Short: "Print statistics about a publication",
+		Long: `Compute statistics over the posts of a publication: posts per month, average word count,
+paid/free ratio, top tags, longest posts and weekly posting streaks.
+
+By default the posts downloaded in --dir are used (metadata comes from the download manifest).
+Use --url to compute the statistics directly from the publication's archive instead.
+
+Example usage:
+  sbstck-dl stats --dir ./downloads
+  sbstck-dl stats --url https://example.substack.com --format html --output report.html`,
+		Run: func(cmd *cobra.Command, args []string) {
+			var entries []lib.ManifestEntry
+			title := statsDir
+			if statsURL != "" {
+				parsedURL, err := parseURL(statsURL)
+				if err != nil {
+					log.Fatal(err)
+				}
+				title = parsedURL.Host
+				mainWebsite := fmt.Sprintf("%s://%s", parsedURL.Scheme, parsedURL.Host)
+				if verbose {
+					fmt.Fprintf(os.Stderr, "Fetching the archive of %s...\n", mainWebsite)
+				}
+				posts, err := extractor.GetArchivePosts(ctx, mainWebsite, makeDateFilterFunc(beforeDate, afterDate))
+				if err != nil {
+					log.Fatal(err)
+				}
+				for _, post := range posts {
+					entries = append(entries, lib.NewManifestEntry(post, nil, time.Time{}))
+				}
+			} else {
+				var err error
+				entries, err = lib.LocalManifestEntries(statsDir)
+				if err != nil {
+					log.Fatal(err)
+				}
+				entries = filterEntriesByDate(entries, makeDateFilterFunc(beforeDate, afterDate))
+			}
+
+			stats := lib.ComputeStats(entries, statsTop, time.Now())
+
+			var w io.Writer = os.Stdout
+			if statsOutput != "" {
+				f, err := os.Create(statsOutput)
+				if err != nil {
+					log.Fatal(err)
+				}
+				defer f.Close()
+				w = f
+			}
+
+			var err error
+			switch statsFormat {
+			case "table":
+				err = stats.WriteTable(w)
+			case "json":
+				encoder := json.NewEncoder(w)
+				encoder.SetIndent("", "  ")
+				err = encoder.Encode(stats)
+			case "html":
+				err = stats.WriteHTML(w, title)
+			default:
+				log.Fatalf("unknown format: %s", statsFormat)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if statsOutput != "" && verbose {
+				fmt.Printf("Statistics written to %s\n", statsOutput)
+			}
+		},
+	}
+)
+
+func init() {
+	statsCmd.Flags().StringVar(&statsDir, "dir", ".", "Directory containing the downloaded posts")
+	statsCmd.Flags().StringVarP(&statsURL, "url", "u", "", "Compute the statistics from the archive of this Substack instead of a local directory")
+	statsCmd.Flags().StringVarP(&statsFormat, "format", "f", "table", "Specify the output format (options: \"table\", \"json\", \"html\")")
+	statsCmd.Flags().StringVarP(&statsOutput, "output", "o", "", "Write the statistics to this file instead of the standard output")
+	statsCmd.Flags().IntVar(&statsTop, "top", 10, "Number of tags and longest posts to show")
+}
+
+// filterEntriesByDate keeps the manifest entries whose post date (YYYY-MM-DD) matches the filter
+func filterEntriesByDate(entries []lib.ManifestEntry, f lib.DateFilterFunc) []lib.ManifestEntry {
+	if f == nil {
+		return entries
+	}
+	var filtered []lib.ManifestEntry
+	for _, entry := range entries {
+		date := entry.PostDate
+		if len(date) > 10 {
+			date = date[:10]
+		}
+		if f(date) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
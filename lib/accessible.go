@@ -0,0 +1,60 @@
+package lib
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// AccessibleImagesHTML prepares the HTML body of a post for a text output read with a screen
+// reader: each image is announced where it stands by an "[Image: description]" paragraph made
+// of its alt text, and the addresses of the images are listed at the end. The images are kept,
+// as text conversion leaves them out anyway.
+func AccessibleImagesHTML(body string) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse post body: %w", err)
+	}
+
+	var list strings.Builder
+	count := 0
+	doc.Find("img").Each(func(i int, img *goquery.Selection) {
+		count++
+		alt := strings.Join(strings.Fields(img.AttrOr("alt", "")), " ")
+		placeholder := "[Image]"
+		if alt != "" {
+			placeholder = "[Image: " + alt + "]"
+		}
+
+		// Substack wraps images in a link to the full size image, itself in a figure with the caption
+		target := img
+		if figure := img.Closest("figure"); figure.Length() > 0 {
+			target = figure
+		} else if link := img.Closest("a"); link.Length() > 0 {
+			target = link
+		}
+		target.BeforeHtml("<p>" + html.EscapeString(placeholder) + "</p>")
+
+		if src := img.AttrOr("src", ""); src != "" {
+			line := fmt.Sprintf("%d. %s", count, src)
+			if alt != "" {
+				line += " (" + alt + ")"
+			}
+			list.WriteString("<p>" + html.EscapeString(line) + "</p>\n")
+		}
+	})
+	if count == 0 {
+		return body, nil
+	}
+
+	updated, err := doc.Find("body").Html()
+	if err != nil {
+		return "", fmt.Errorf("failed to render post body: %w", err)
+	}
+	if list.Len() > 0 {
+		updated += "\n<p>Images:</p>\n" + list.String()
+	}
+	return updated, nil
+}
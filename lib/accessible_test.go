@@ -0,0 +1,28 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessibleImagesHTML(t *testing.T) {
+	body := `<p>Before</p>
+<figure><a class="image-link" href="https://cdn.example.com/full.jpg"><img src="https://cdn.example.com/chart.jpg" alt="Chart of   monthly sales"></a><figcaption>Sales in 2023</figcaption></figure>
+<p>Between</p>
+<img src="https://cdn.example.com/photo.png">
+<p>After</p>`
+
+	updated, err := AccessibleImagesHTML(body)
+	require.NoError(t, err)
+	assert.Contains(t, updated, "<p>[Image: Chart of monthly sales]</p><figure>")
+	assert.Contains(t, updated, "<p>[Image]</p><img")
+	assert.Contains(t, updated, "<figcaption>Sales in 2023</figcaption>")
+	assert.Contains(t, updated, "<p>Images:</p>\n<p>1. https://cdn.example.com/chart.jpg (Chart of monthly sales)</p>\n<p>2. https://cdn.example.com/photo.png</p>")
+
+	// Posts without images are left as they are
+	updated, err = AccessibleImagesHTML("<p>Text only</p>")
+	require.NoError(t, err)
+	assert.Equal(t, "<p>Text only</p>", updated)
+}
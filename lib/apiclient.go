@@ -0,0 +1,158 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SubstackAPIURL is the base URL of the API of substack.com itself, used for profiles and notes
+const SubstackAPIURL = "https://substack.com/api/v1"
+
+// Errors matched by APIError with errors.Is
+var (
+	ErrAPIUnauthorized = errors.New("not authorized, the content may require a subscriber cookie")
+	ErrAPINotFound     = errors.New("not found")
+	ErrAPIRateLimited  = errors.New("rate limited")
+)
+
+// APIError is returned when the Substack API answers with an error status
+type APIError struct {
+	URL        string
+	StatusCode int
+	Err        error // the error of the Fetcher
+}
+
+// Error returns the error message for the APIError.
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request %s failed with status %d", e.URL, e.StatusCode)
+}
+
+// Unwrap returns the error of the Fetcher
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the ErrAPI errors corresponding to the status code
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrAPIUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrAPINotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrAPIRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// APIClient calls the JSON API of a publication or of substack.com. Requests go through
+// the Fetcher, so they share its rate limit, retries and authentication cookie.
+type APIClient struct {
+	fetcher *Fetcher
+	BaseURL string // e.g. https://example.substack.com/api/v1
+}
+
+// NewAPIClient creates a client of the API at baseURL
+func NewAPIClient(fetcher *Fetcher, baseURL string) *APIClient {
+	if fetcher == nil {
+		fetcher = NewFetcher()
+	}
+	return &APIClient{fetcher: fetcher, BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// NewPublicationAPIClient creates a client of the API of the publication at pubURL
+func NewPublicationAPIClient(fetcher *Fetcher, pubURL string) (*APIClient, error) {
+	u, err := url.Parse(pubURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid publication URL: %s", pubURL)
+	}
+	u.Path, err = url.JoinPath(u.Path, "api/v1")
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = ""
+	return NewAPIClient(fetcher, u.String()), nil
+}
+
+// URL returns the URL of an endpoint, e.g. "archive", with the given query
+func (c *APIClient) URL(endpoint string, query url.Values) string {
+	u := c.BaseURL + "/" + strings.TrimPrefix(endpoint, "/")
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// Get calls an endpoint and decodes its JSON response into v
+func (c *APIClient) Get(ctx context.Context, endpoint string, query url.Values, v interface{}) error {
+	body, err := c.Open(ctx, endpoint, query)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", c.URL(endpoint, query), err)
+	}
+	return nil
+}
+
+// Open calls an endpoint and returns its response body, for responses that aren't JSON
+func (c *APIClient) Open(ctx context.Context, endpoint string, query url.Values) (io.ReadCloser, error) {
+	reqURL := c.URL(endpoint, query)
+	body, err := c.fetcher.FetchURL(ctx, reqURL)
+	if err != nil {
+		var fetchErr *FetchError
+		if errors.As(err, &fetchErr) {
+			return nil, &APIError{URL: reqURL, StatusCode: fetchErr.StatusCode, Err: err}
+		}
+		return nil, err
+	}
+	return body, nil
+}
+
+// PaginateOffset calls fetch with the offset of each page of limit items, starting at 0,
+// until it returns fewer than limit items
+func PaginateOffset(ctx context.Context, limit int, fetch func(offset int) (int, error)) error {
+	for offset := 0; ; offset += limit {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := fetch(offset)
+		if err != nil {
+			return err
+		}
+		if n < limit {
+			return nil
+		}
+	}
+}
+
+// PaginateCursor calls fetch with the cursor of each page, starting with an empty cursor,
+// until it returns an empty next cursor or maxPages pages were fetched (0 for no limit)
+func PaginateCursor(ctx context.Context, maxPages int, fetch func(page int, cursor string) (string, error)) error {
+	cursor := ""
+	for page := 1; maxPages <= 0 || page <= maxPages; page++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		next, err := fetch(page, cursor)
+		if err != nil {
+			return err
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test calling the API of a publication
+func TestAPIClient(t *testing.T) {
+	var cookies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("substack.sid"); err == nil {
+			cookies = append(cookies, c.Value)
+		}
+		switch r.URL.Path {
+		case "/api/v1/archive":
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			var page []Post
+			for i := offset; i < 120 && i < offset+50; i++ {
+				page = append(page, Post{Id: i, Slug: "post-" + strconv.Itoa(i), PostDate: "2023-01-01T00:00:00Z"})
+			}
+			json.NewEncoder(w).Encode(page)
+		case "/api/v1/private":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(
+		WithCookie(&http.Cookie{Name: "substack.sid", Value: "secret"}),
+		WithBackOffConfig(backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 0)),
+	)
+	api, err := NewPublicationAPIClient(fetcher, server.URL+"/?utm_source=x")
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/api/v1", api.BaseURL)
+	assert.Equal(t, server.URL+"/api/v1/archive?limit=2", api.URL("/archive", url.Values{"limit": {"2"}}))
+
+	var page []Post
+	require.NoError(t, api.Get(context.Background(), "archive", nil, &page))
+	assert.Len(t, page, 50)
+	assert.Equal(t, []string{"secret"}, cookies)
+
+	err = api.Get(context.Background(), "private", nil, &page)
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+	assert.ErrorIs(t, err, ErrAPIUnauthorized)
+	assert.False(t, errors.Is(err, ErrAPINotFound))
+
+	err = api.Get(context.Background(), "missing", nil, &page)
+	assert.ErrorIs(t, err, ErrAPINotFound)
+
+	_, err = NewPublicationAPIClient(fetcher, "not a url")
+	assert.Error(t, err)
+
+	t.Run("archive", func(t *testing.T) {
+		posts, err := NewExtractor(fetcher).GetArchivePosts(context.Background(), server.URL, nil)
+		require.NoError(t, err)
+		assert.Len(t, posts, 120)
+	})
+}
+
+// Test the pagination helpers
+func TestPaginate(t *testing.T) {
+	var offsets []int
+	err := PaginateOffset(context.Background(), 10, func(offset int) (int, error) {
+		offsets = append(offsets, offset)
+		if offset == 20 {
+			return 3, nil
+		}
+		return 10, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 10, 20}, offsets)
+
+	var cursors []string
+	err = PaginateCursor(context.Background(), 0, func(page int, cursor string) (string, error) {
+		cursors = append(cursors, cursor)
+		if page == 3 {
+			return "", nil
+		}
+		return "c" + strconv.Itoa(page), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "c1", "c2"}, cursors)
+
+	// maxPages limits the pages fetched
+	pages := 0
+	err = PaginateCursor(context.Background(), 2, func(page int, cursor string) (string, error) {
+		pages++
+		return "next", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, pages)
+
+	err = PaginateOffset(context.Background(), 10, func(offset int) (int, error) {
+		return 0, errors.New("boom")
+	})
+	assert.EqualError(t, err, "boom")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = PaginateCursor(ctx, 0, func(page int, cursor string) (string, error) {
+		return "next", nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// Test fetching the activity of a user through the API client
+func TestNotesClientFetchAllUserActivity(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v1/reader/feed/profile/42", r.URL.Path)
+		resp := NotesResponse{Items: []ActivityItem{{Type: "comment", Comment: Comment{ID: 1}}}, NextCursor: "page2"}
+		if r.URL.Query().Get("cursor") == "page2" {
+			resp = NotesResponse{Items: []ActivityItem{{Type: "comment", Comment: Comment{ID: 2}}}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewNotesClient(NewFetcher())
+	client.api.BaseURL = server.URL + "/api/v1"
+	items, err := client.FetchAllUserActivity(context.Background(), "42", 10, false)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, 2, items[1].Comment.ID)
+}
+
+// Test fetching the feeds of liked notes and saved posts
+func TestNotesClientFetchFeed(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		resp := NotesResponse{Items: []ActivityItem{{Type: "comment", Comment: Comment{ID: 1}}}}
+		if r.URL.Path == "/api/v1/reader/saved" {
+			resp = NotesResponse{Items: []ActivityItem{{Type: "post", Post: map[string]interface{}{
+				"id": 12.0, "title": "Saved <post>", "subtitle": "Worth it", "canonical_url": "https://example.substack.com/p/saved",
+				"post_date": "2024-01-02T03:04:05Z", "reaction_count": 9.0,
+				"publishedBylines": []interface{}{map[string]interface{}{"name": "Jane", "handle": "jane"}},
+			}}}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewNotesClient(NewFetcher())
+	client.api.BaseURL = server.URL + "/api/v1"
+
+	_, err := client.FetchFeed(context.Background(), NotesFeedLikes, "42", 1, false)
+	require.NoError(t, err)
+	items, err := client.FetchFeed(context.Background(), NotesFeedSaves, "", 1, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/api/v1/reader/feed/profile/42/likes", "/api/v1/reader/saved"}, paths)
+
+	_, err = client.FetchFeed(context.Background(), "bookmarks", "42", 1, false)
+	assert.Error(t, err)
+
+	require.Len(t, items, 1)
+	note := client.ConvertPostToNote(items[0])
+	require.NotNil(t, note)
+	assert.Equal(t, "12", note.ID)
+	assert.Equal(t, "saved_post", note.Type)
+	assert.Equal(t, "https://example.substack.com/p/saved", note.URL)
+	assert.Equal(t, "Jane", note.AuthorName)
+	assert.Equal(t, 9, note.ReactionCount)
+	assert.Equal(t, `<p><a href="https://example.substack.com/p/saved">Saved &lt;post&gt;</a></p><p>Worth it</p>`, note.Body)
+	assert.Nil(t, client.ConvertPostToNote(ActivityItem{Type: "comment"}))
+}
@@ -0,0 +1,468 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RunStatus is the state of a download run triggered through the API
+type RunStatus string
+
+const (
+	RunQueued    RunStatus = "queued"
+	RunRunning   RunStatus = "running"
+	RunCompleted RunStatus = "completed"
+	RunFailed    RunStatus = "failed"
+	RunCancelled RunStatus = "cancelled"
+)
+
+// RunRequest is the body accepted by the API to start a download run
+type RunRequest struct {
+	URL            string   `json:"url"`
+	Format         string   `json:"format,omitempty"`
+	Output         string   `json:"output,omitempty"`
+	AddSourceURL   bool     `json:"add_source_url,omitempty"`
+	DownloadImages bool     `json:"download_images,omitempty"`
+	ImageQuality   string   `json:"image_quality,omitempty"`
+	DownloadFiles  bool     `json:"download_files,omitempty"`
+	FileExtensions []string `json:"file_extensions,omitempty"`
+	CreateArchive  bool     `json:"create_archive,omitempty"`
+	Before         string   `json:"before,omitempty"`
+	After          string   `json:"after,omitempty"`
+}
+
+// Run is a download run triggered through the API
+type Run struct {
+	ID         string           `json:"id"`
+	Request    RunRequest       `json:"request"`
+	Status     RunStatus        `json:"status"`
+	CreatedAt  time.Time        `json:"created_at"`
+	StartedAt  *time.Time       `json:"started_at,omitempty"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+	Processed  int              `json:"processed"`
+	Summary    *DownloadSummary `json:"summary,omitempty"`
+	PostErrors []string         `json:"post_errors,omitempty"`
+	Error      string           `json:"error,omitempty"`
+
+	cancel context.CancelFunc
+}
+
+// finished reports whether the run has reached a final state
+func (r *Run) finished() bool {
+	return r.Status == RunCompleted || r.Status == RunFailed || r.Status == RunCancelled
+}
+
+const (
+	// maxFinishedRuns is the number of finished runs kept by the API server, the oldest ones
+	// being forgotten first
+	maxFinishedRuns = 100
+	// defaultRunsLimit is the number of runs listed at once unless a limit is given
+	defaultRunsLimit = 20
+)
+
+// APIServer exposes a JSON API to trigger downloads, follow their progress and list
+// the downloaded posts. Runs are executed one at a time, in the order they were created.
+type APIServer struct {
+	dir     string
+	fetcher *Fetcher
+	mux     *http.ServeMux
+
+	mu          sync.Mutex
+	runs        map[string]*Run
+	nextID      int
+	slot        chan struct{}
+	maxFinished int // finished runs kept, see maxFinishedRuns
+}
+
+// NewAPIServer creates an API server writing downloads under the given directory.
+// If the Fetcher is nil, a default Fetcher will be used.
+func NewAPIServer(dir string, f *Fetcher) *APIServer {
+	if f == nil {
+		f = NewFetcher()
+	}
+
+	s := &APIServer{
+		dir:     dir,
+		fetcher: f,
+		mux:     http.NewServeMux(),
+		runs:    make(map[string]*Run),
+		slot:    make(chan struct{}, 1),
+
+		maxFinished: maxFinishedRuns,
+	}
+
+	s.mux.HandleFunc("/api/health", s.handleHealth)
+	s.mux.HandleFunc("/api/runs", s.handleRuns)
+	s.mux.HandleFunc("/api/runs/", s.handleRun)
+	s.mux.HandleFunc("/api/posts", s.handlePosts)
+
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *APIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// StartRun validates the request and queues a new download run
+func (s *APIServer) StartRun(req RunRequest) (Run, error) {
+	if err := validateRunURL(req.URL); err != nil {
+		return Run{}, err
+	}
+	if req.Format == "" {
+		req.Format = "html"
+	}
+	if _, err := ParseFormats(req.Format); err != nil {
+		return Run{}, err
+	}
+	if req.ImageQuality != "" {
+		if _, err := ParseImageQuality(req.ImageQuality); err != nil {
+			return Run{}, err
+		}
+	}
+	outputDir, err := s.outputDir(req.Output)
+	if err != nil {
+		return Run{}, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.mu.Lock()
+	s.nextID++
+	run := &Run{
+		ID:        strconv.Itoa(s.nextID),
+		Request:   req,
+		Status:    RunQueued,
+		CreatedAt: time.Now(),
+		cancel:    cancel,
+	}
+	s.runs[run.ID] = run
+	snapshot := *run
+	s.mu.Unlock()
+
+	go s.execute(ctx, run, outputDir)
+
+	return snapshot, nil
+}
+
+// Run returns a snapshot of the run with the given ID
+func (s *APIServer) Run(id string) (Run, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run, ok := s.runs[id]
+	if !ok {
+		return Run{}, false
+	}
+	return *run, true
+}
+
+// Runs returns a snapshot of the runs kept, newest first
+func (s *APIServer) Runs() []Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs := make([]Run, 0, len(s.runs))
+	for _, run := range s.runs {
+		runs = append(runs, *run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		a, _ := strconv.Atoi(runs[i].ID)
+		b, _ := strconv.Atoi(runs[j].ID)
+		return a > b
+	})
+	return runs
+}
+
+// CancelRun cancels a queued or running run
+func (s *APIServer) CancelRun(id string) (Run, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run, ok := s.runs[id]
+	if !ok {
+		return Run{}, false
+	}
+	if !run.finished() {
+		run.cancel()
+	}
+	return *run, true
+}
+
+// Wait blocks until the run with the given ID is finished or the context is done
+func (s *APIServer) Wait(ctx context.Context, id string) (Run, error) {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		run, ok := s.Run(id)
+		if !ok {
+			return Run{}, fmt.Errorf("run not found: %s", id)
+		}
+		if run.finished() {
+			return run, nil
+		}
+		select {
+		case <-ctx.Done():
+			return run, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// execute waits for its turn and then downloads the posts of the run
+func (s *APIServer) execute(ctx context.Context, run *Run, outputDir string) {
+	defer run.cancel()
+
+	select {
+	case s.slot <- struct{}{}:
+		defer func() { <-s.slot }()
+	case <-ctx.Done():
+		s.finishRun(run, nil, ctx.Err())
+		return
+	}
+
+	s.mu.Lock()
+	started := time.Now()
+	run.StartedAt = &started
+	run.Status = RunRunning
+	req := run.Request
+	s.mu.Unlock()
+
+	opts := DownloadOptions{
+		OutputDir:      outputDir,
+		Format:         req.Format,
+		AddSourceURL:   req.AddSourceURL,
+		DownloadImages: req.DownloadImages,
+		ImageQuality:   ImageQuality(req.ImageQuality),
+		ImagesDir:      "images",
+		DownloadFiles:  req.DownloadFiles,
+		FileExtensions: req.FileExtensions,
+		FilesDir:       "files",
+		CreateArchive:  req.CreateArchive,
+		SkipExisting:   true,
+		DateFilter:     NewDateFilter(req.Before, req.After),
+	}
+	if opts.ImageQuality == "" {
+		opts.ImageQuality = ImageQualityHigh
+	}
+	lock, err := LockDir(outputDir)
+	if err != nil {
+		s.finishRun(run, nil, err)
+		return
+	}
+	defer lock.Unlock()
+
+	opts.OnProgress = func(event ProgressEvent) {
+		if event.Event != ProgressPostFinished && event.Event != ProgressPostFailed {
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		run.Processed++
+		if event.Event == ProgressPostFailed {
+			run.PostErrors = append(run.PostErrors, fmt.Sprintf("%s: %s", event.URL, event.Error))
+		}
+	}
+
+	summary, err := StartJob(ctx, s.fetcher, req.URL, opts).Result()
+	s.finishRun(run, summary, err)
+}
+
+// finishRun records the final state of a run
+func (s *APIServer) finishRun(run *Run, summary *DownloadSummary, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	run.Summary = summary
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		run.Status = RunCancelled
+	case err != nil:
+		run.Status = RunFailed
+		run.Error = err.Error()
+	default:
+		run.Status = RunCompleted
+	}
+	s.pruneRuns()
+}
+
+// pruneRuns forgets the oldest finished runs beyond the number kept, so that a long-running
+// server doesn't accumulate them. Runs still queued or running are always kept.
+// The caller must hold s.mu.
+func (s *APIServer) pruneRuns() {
+	var finished []*Run
+	for _, run := range s.runs {
+		if run.finished() {
+			finished = append(finished, run)
+		}
+	}
+	if len(finished) <= s.maxFinished {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		a, _ := strconv.Atoi(finished[i].ID)
+		b, _ := strconv.Atoi(finished[j].ID)
+		return a < b
+	})
+	for _, run := range finished[:len(finished)-s.maxFinished] {
+		delete(s.runs, run.ID)
+	}
+}
+
+// outputDir resolves the output directory of a run, which must stay inside the server directory
+func (s *APIServer) outputDir(output string) (string, error) {
+	if output == "" {
+		return s.dir, nil
+	}
+	cleaned := filepath.Clean(filepath.FromSlash(output))
+	if filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid output directory: %s", output)
+	}
+	return filepath.Join(s.dir, cleaned), nil
+}
+
+// handleHealth reports that the server is up
+func (s *APIServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleRuns lists the runs (GET) or starts a new one (POST)
+func (s *APIServer) handleRuns(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		offset, limit, err := parsePage(r.URL.Query(), defaultRunsLimit)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		runs := s.Runs()
+		if offset > len(runs) {
+			offset = len(runs)
+		}
+		runs = runs[offset:]
+		if limit < len(runs) {
+			runs = runs[:limit]
+		}
+		writeJSON(w, http.StatusOK, runs)
+	case http.MethodPost:
+		var req RunRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+		run, err := s.StartRun(req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		w.Header().Set("Location", "/api/runs/"+run.ID)
+		writeJSON(w, http.StatusAccepted, run)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// handleRun returns the status of a run (GET) or cancels it (DELETE)
+func (s *APIServer) handleRun(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/runs/")
+
+	var run Run
+	var ok bool
+	switch r.Method {
+	case http.MethodGet:
+		run, ok = s.Run(id)
+	case http.MethodDelete:
+		run, ok = s.CancelRun(id)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run not found: %s", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+// handlePosts lists the posts recorded in the manifest of an output directory
+func (s *APIServer) handlePosts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	dir, err := s.outputDir(r.URL.Query().Get("output"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, manifest.Posts)
+}
+
+// parsePage returns the offset and limit of the page of a list selected by the "offset" and
+// "limit" query parameters, the limit defaulting to defaultLimit
+func parsePage(query url.Values, defaultLimit int) (int, int, error) {
+	offset, limit := 0, defaultLimit
+	if value := query.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid offset: %s", value)
+		}
+		offset = n
+	}
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("invalid limit: %s", value)
+		}
+		limit = n
+	}
+	return offset, limit, nil
+}
+
+// validateRunURL checks that the URL of a run is an absolute http(s) URL
+func validateRunURL(rawURL string) error {
+	if rawURL == "" {
+		return errors.New("url is required")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url: %s", rawURL)
+	}
+	return nil
+}
+
+// writeJSON writes the value as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error as a JSON response with the given status code
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
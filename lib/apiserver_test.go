@@ -0,0 +1,177 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// apiRequest sends a request to the API server and decodes the JSON response
+func apiRequest(t *testing.T, s *APIServer, method, path, body string, out interface{}) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	if out != nil {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), out))
+	}
+	return rec.Code
+}
+
+// Test the REST API
+func TestAPIServer(t *testing.T) {
+	substack := createPublicationTestServer(2)
+	defer substack.Close()
+
+	tempDir, err := os.MkdirTemp("", "apiserver-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	s := NewAPIServer(tempDir, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	t.Run("health", func(t *testing.T) {
+		var body map[string]string
+		assert.Equal(t, http.StatusOK, apiRequest(t, s, http.MethodGet, "/api/health", "", &body))
+		assert.Equal(t, "ok", body["status"])
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		var body map[string]string
+		assert.Equal(t, http.StatusBadRequest, apiRequest(t, s, http.MethodPost, "/api/runs", "{", &body))
+		assert.Contains(t, body["error"], "invalid request body")
+
+		assert.Equal(t, http.StatusBadRequest, apiRequest(t, s, http.MethodPost, "/api/runs", `{"url": "not-a-url"}`, &body))
+		assert.Equal(t, http.StatusBadRequest, apiRequest(t, s, http.MethodPost, "/api/runs", `{"url": "https://example.substack.com", "format": "pdf"}`, &body))
+		assert.Equal(t, http.StatusBadRequest, apiRequest(t, s, http.MethodPost, "/api/runs", `{"url": "https://example.substack.com", "output": "../outside"}`, &body))
+		assert.Equal(t, http.StatusMethodNotAllowed, apiRequest(t, s, http.MethodPut, "/api/runs", "", &body))
+		assert.Equal(t, http.StatusNotFound, apiRequest(t, s, http.MethodGet, "/api/runs/999", "", &body))
+	})
+
+	t.Run("download a publication", func(t *testing.T) {
+		var run Run
+		code := apiRequest(t, s, http.MethodPost, "/api/runs", `{"url": "`+substack.URL+`", "format": "md"}`, &run)
+		require.Equal(t, http.StatusAccepted, code)
+		assert.NotEmpty(t, run.ID)
+		assert.Equal(t, "md", run.Request.Format)
+
+		finished, err := s.Wait(ctx, run.ID)
+		require.NoError(t, err)
+		assert.Equal(t, RunCompleted, finished.Status)
+		require.NotNil(t, finished.Summary)
+		assert.Equal(t, 2, finished.Summary.Downloaded)
+		assert.Equal(t, 2, finished.Processed)
+
+		var status Run
+		assert.Equal(t, http.StatusOK, apiRequest(t, s, http.MethodGet, "/api/runs/"+run.ID, "", &status))
+		assert.Equal(t, RunCompleted, status.Status)
+		assert.NotNil(t, status.FinishedAt)
+
+		var posts []ManifestEntry
+		assert.Equal(t, http.StatusOK, apiRequest(t, s, http.MethodGet, "/api/posts", "", &posts))
+		require.Len(t, posts, 2)
+		assert.Equal(t, "post-2", posts[0].Slug)
+	})
+
+	t.Run("download a single post into a subdirectory", func(t *testing.T) {
+		var run Run
+		code := apiRequest(t, s, http.MethodPost, "/api/runs", `{"url": "`+substack.URL+`/p/post-1", "output": "single"}`, &run)
+		require.Equal(t, http.StatusAccepted, code)
+
+		finished, err := s.Wait(ctx, run.ID)
+		require.NoError(t, err)
+		assert.Equal(t, RunCompleted, finished.Status)
+
+		var posts []ManifestEntry
+		assert.Equal(t, http.StatusOK, apiRequest(t, s, http.MethodGet, "/api/posts?output=single", "", &posts))
+		require.Len(t, posts, 1)
+		assert.Equal(t, "post-1", posts[0].Slug)
+	})
+
+	t.Run("failed run", func(t *testing.T) {
+		run, err := s.StartRun(RunRequest{URL: substack.URL + "/p/missing"})
+		require.NoError(t, err)
+
+		finished, err := s.Wait(ctx, run.ID)
+		require.NoError(t, err)
+		assert.Equal(t, RunFailed, finished.Status)
+		assert.NotEmpty(t, finished.Error)
+	})
+
+	t.Run("cancel a queued run", func(t *testing.T) {
+		// Hold the run slot so the new run stays queued
+		s.slot <- struct{}{}
+		run, err := s.StartRun(RunRequest{URL: substack.URL})
+		require.NoError(t, err)
+
+		var cancelled Run
+		assert.Equal(t, http.StatusOK, apiRequest(t, s, http.MethodDelete, "/api/runs/"+run.ID, "", &cancelled))
+		finished, err := s.Wait(ctx, run.ID)
+		<-s.slot
+		require.NoError(t, err)
+		assert.Equal(t, RunCancelled, finished.Status)
+	})
+
+	t.Run("list runs", func(t *testing.T) {
+		var runs []Run
+		assert.Equal(t, http.StatusOK, apiRequest(t, s, http.MethodGet, "/api/runs", "", &runs))
+		require.Len(t, runs, 4)
+		assert.Equal(t, "4", runs[0].ID) // newest first
+
+		assert.Equal(t, http.StatusOK, apiRequest(t, s, http.MethodGet, "/api/runs?offset=1&limit=2", "", &runs))
+		require.Len(t, runs, 2)
+		assert.Equal(t, "3", runs[0].ID)
+		assert.Equal(t, "2", runs[1].ID)
+
+		assert.Equal(t, http.StatusOK, apiRequest(t, s, http.MethodGet, "/api/runs?offset=10", "", &runs))
+		assert.Empty(t, runs)
+
+		var body map[string]string
+		assert.Equal(t, http.StatusBadRequest, apiRequest(t, s, http.MethodGet, "/api/runs?limit=0", "", &body))
+		assert.Equal(t, http.StatusBadRequest, apiRequest(t, s, http.MethodGet, "/api/runs?offset=-1", "", &body))
+	})
+}
+
+// Test that the API server forgets its oldest finished runs
+func TestAPIServerPruneRuns(t *testing.T) {
+	substack := createPublicationTestServer(1)
+	defer substack.Close()
+
+	s := NewAPIServer(t.TempDir(), nil)
+	s.maxFinished = 2
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Hold the run slot so that a run stays queued while the others finish
+	s.slot <- struct{}{}
+	queued, err := s.StartRun(RunRequest{URL: substack.URL})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		run, err := s.StartRun(RunRequest{URL: substack.URL})
+		require.NoError(t, err)
+		_, ok := s.CancelRun(run.ID)
+		require.True(t, ok)
+		_, err = s.Wait(ctx, run.ID)
+		require.NoError(t, err)
+	}
+
+	runs := s.Runs()
+	require.Len(t, runs, 3)
+	assert.Equal(t, []string{"4", "3", queued.ID}, []string{runs[0].ID, runs[1].ID, runs[2].ID})
+	_, ok := s.Run("2")
+	assert.False(t, ok, "the oldest finished run is forgotten")
+
+	<-s.slot
+	_, err = s.Wait(ctx, queued.ID)
+	require.NoError(t, err)
+}
@@ -0,0 +1,129 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ArchiveFormats are the formats the archive page can be generated in, in order of preference
+// for the file an entry links to
+var ArchiveFormats = []string{"html", "md", "txt"}
+
+// ArchivePageFormat returns the format of the archive page of a run writing posts in formats:
+// the first of them the page can be generated in, or html if there is none, e.g. for json only
+func ArchivePageFormat(formats []string) string {
+	for _, format := range formats {
+		if containsString(ArchiveFormats, format) {
+			return format
+		}
+	}
+	return "html"
+}
+
+// Sidecar kinds of the files written next to a post. The comments written in a readable
+// format, see WritePostComments, are of kind comments-{format}, e.g. comments-md.
+const (
+	SidecarComments = "comments"
+	SidecarRaw      = "raw"
+	SidecarRawHTML  = "raw-html"
+)
+
+// commentsFileFormats are the formats the comments of a post can be written in besides JSON
+var commentsFileFormats = []string{"html", "md", "txt"}
+
+// sidecarKinds are the kinds of the files written next to a post, in the order they are listed
+var sidecarKinds = []string{SidecarComments, SidecarComments + "-html", SidecarComments + "-md", SidecarComments + "-txt", SidecarRaw, SidecarRawHTML}
+
+// postSidecars returns the files written next to the post at postPath, by kind
+func postSidecars(postPath string) map[string]string {
+	paths := map[string]string{
+		SidecarComments: PostCommentsPath(postPath),
+		SidecarRaw:      RawPostPath(postPath),
+		SidecarRawHTML:  RawHTMLPath(postPath),
+	}
+	for _, format := range commentsFileFormats {
+		paths[SidecarComments+"-"+format] = PostCommentsFilePath(postPath, format)
+	}
+	sidecars := make(map[string]string)
+	for kind, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			sidecars[kind] = path
+		}
+	}
+	return sidecars
+}
+
+// PrimaryPath returns the file the entry is linked to from an archive page in format: the post
+// in that format if it was written in it, else in the first of the archive formats, else in
+// any other format
+func (e ArchiveEntry) PrimaryPath(format string) string {
+	if path, ok := e.Files[format]; ok {
+		return path
+	}
+	for _, f := range ArchiveFormats {
+		if path, ok := e.Files[f]; ok {
+			return path
+		}
+	}
+	if others := e.otherFormats(""); len(others) > 0 {
+		return e.Files[others[0]]
+	}
+	return e.FilePath
+}
+
+// otherFormats returns the formats of the entry, but the one of the file at primary, in the
+// order of the archive formats then alphabetically
+func (e ArchiveEntry) otherFormats(primary string) []string {
+	var formats []string
+	for format, path := range e.Files {
+		if path != primary {
+			formats = append(formats, format)
+		}
+	}
+	rank := func(format string) int {
+		for i, f := range ArchiveFormats {
+			if f == format {
+				return i
+			}
+		}
+		return len(ArchiveFormats)
+	}
+	sort.Slice(formats, func(i, j int) bool {
+		if rank(formats[i]) != rank(formats[j]) {
+			return rank(formats[i]) < rank(formats[j])
+		}
+		return formats[i] < formats[j]
+	})
+	return formats
+}
+
+// ArchiveLink is a file of an entry listed under it, besides the file it is linked to
+type ArchiveLink struct {
+	Label string // format or sidecar kind, e.g. "md" or "comments"
+	Path  string // path relative to the archive page, with forward slashes
+}
+
+// otherFiles returns the files of the entry other than its primary file on an archive page
+// in format in pageDir: the post in its other formats, then its sidecars
+func (e ArchiveEntry) otherFiles(pageDir, format string) []ArchiveLink {
+	var links []ArchiveLink
+	for _, f := range e.otherFormats(e.PrimaryPath(format)) {
+		links = append(links, ArchiveLink{Label: f, Path: relativeTo(pageDir, e.Files[f])})
+	}
+	for _, kind := range sidecarKinds {
+		if path, ok := e.Sidecars[kind]; ok {
+			links = append(links, ArchiveLink{Label: kind, Path: relativeTo(pageDir, path)})
+		}
+	}
+	return links
+}
+
+// relativeTo returns path relative to dir with forward slashes, or path itself if it can't be
+func relativeTo(dir, path string) string {
+	relPath, err := filepath.Rel(dir, path)
+	if err != nil {
+		relPath = path
+	}
+	return filepath.ToSlash(relPath)
+}
@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchivePageFormat(t *testing.T) {
+	assert.Equal(t, "md", ArchivePageFormat([]string{"md", "html"}))
+	assert.Equal(t, "txt", ArchivePageFormat([]string{"json", "txt"}))
+	assert.Equal(t, "html", ArchivePageFormat([]string{"json"}))
+	assert.Equal(t, "html", ArchivePageFormat(nil))
+}
+
+func TestArchiveEntryPrimaryPath(t *testing.T) {
+	entry := ArchiveEntry{FilePath: "/out/post.txt", Files: map[string]string{
+		"txt":  "/out/post.txt",
+		"md":   "/out/post.md",
+		"json": "/out/post.json",
+	}}
+	assert.Equal(t, "/out/post.txt", entry.PrimaryPath("txt"))
+	assert.Equal(t, "/out/post.md", entry.PrimaryPath("html"), "the preferred format written is linked")
+	assert.Equal(t, []string{"txt", "json"}, entry.otherFormats("/out/post.md"))
+
+	entry.Files = map[string]string{"jsonl": "/out/post.jsonl", "json": "/out/post.json"}
+	assert.Equal(t, "/out/post.json", entry.PrimaryPath("html"))
+
+	entry.Files = nil
+	assert.Equal(t, "/out/post.txt", entry.PrimaryPath("html"))
+}
+
+func TestArchiveAllFiles(t *testing.T) {
+	dir := t.TempDir()
+	mdPath := filepath.Join(dir, "20240101_120000_post.md")
+	txtPath := filepath.Join(dir, "20240101_120000_post.txt")
+	require.NoError(t, SavePostComments(mdPath, []PostComment{}))
+	require.NoError(t, WritePostComments(mdPath, Post{Title: "A Post"}, []PostComment{}, "txt"))
+
+	archive := NewArchive()
+	archive.Add(ArchiveEntry{
+		Post:         Post{Title: "A Post", PostDate: "2024-01-01T12:00:00Z"},
+		FilePath:     txtPath,
+		DownloadTime: time.Now(),
+		Files:        map[string]string{"txt": txtPath, "md": mdPath},
+		Sidecars:     postSidecars(mdPath),
+	})
+	assert.Equal(t, map[string]string{
+		SidecarComments:          PostCommentsPath(mdPath),
+		SidecarComments + "-txt": PostCommentsFilePath(mdPath, "txt"),
+	}, archive.Entries[0].Sidecars)
+
+	require.NoError(t, archive.GenerateHTML(dir))
+	data, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	require.NoError(t, err)
+	page := string(data)
+	assert.Contains(t, page, `<a href="20240101_120000_post.md">A Post</a>`)
+	assert.Contains(t, page, `Also: <a href="20240101_120000_post.txt">txt</a> · <a href="20240101_120000_post.comments.json">comments</a> · <a href="20240101_120000_post.comments.txt">comments-txt</a>`)
+
+	require.NoError(t, archive.GenerateText(dir))
+	data, err = os.ReadFile(filepath.Join(dir, "index.txt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "File: 20240101_120000_post.txt\n")
+	assert.Contains(t, string(data), "Also (md): 20240101_120000_post.md\n")
+
+	require.NoError(t, archive.GenerateMarkdown(dir))
+	data, err = os.ReadFile(filepath.Join(dir, "index.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "## [A Post](20240101_120000_post.md)")
+	assert.Contains(t, string(data), "**Also:** [txt](<20240101_120000_post.txt>) · [comments](<20240101_120000_post.comments.json>) · [comments-txt](<20240101_120000_post.comments.txt>)")
+}
@@ -0,0 +1,169 @@
+package lib
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Directories of the archive pages listing the posts of a tag or a section
+const (
+	ArchiveTagsDir     = "tags"
+	ArchiveSectionsDir = "sections"
+)
+
+// nonSlugChars matches the characters replaced when deriving a page name from a tag name
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// archiveGroup is a tag, a section or a series of the archive, with its posts newest first,
+// or in reading order for a series
+type archiveGroup struct {
+	Name    string
+	Slug    string
+	Entries []ArchiveEntry
+}
+
+// groupSlug returns the name of the page of a tag or section: its slug, or its name when
+// the post doesn't have it, reduced to lowercase letters, digits and dashes
+func groupSlug(slug, name string) string {
+	if slug == "" {
+		slug = name
+	}
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(slug), "-"), "-")
+}
+
+// tagGroups returns the tags of the archive posts, sorted by name
+func (a *Archive) tagGroups() []*archiveGroup {
+	return a.groups(func(post Post) [][2]string {
+		var keys [][2]string
+		for _, tag := range post.Tags {
+			if tag.Name != "" {
+				keys = append(keys, [2]string{tag.Name, groupSlug(tag.Slug, tag.Name)})
+			}
+		}
+		return keys
+	})
+}
+
+// sectionGroups returns the sections of the archive posts, sorted by name
+func (a *Archive) sectionGroups() []*archiveGroup {
+	return a.groups(func(post Post) [][2]string {
+		if post.SectionName == "" {
+			return nil
+		}
+		return [][2]string{{post.SectionName, groupSlug(post.SectionSlug, post.SectionName)}}
+	})
+}
+
+// groups collects the archive entries by the name and slug pairs keysOf returns for their post
+func (a *Archive) groups(keysOf func(Post) [][2]string) []*archiveGroup {
+	bySlug := make(map[string]*archiveGroup)
+	var groups []*archiveGroup
+	for _, entry := range a.Entries {
+		for _, key := range keysOf(entry.Post) {
+			if key[1] == "" {
+				continue
+			}
+			group, ok := bySlug[key[1]]
+			if !ok {
+				group = &archiveGroup{Name: key[0], Slug: key[1]}
+				bySlug[key[1]] = group
+				groups = append(groups, group)
+			}
+			group.Entries = append(group.Entries, entry)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return strings.ToLower(groups[i].Name) < strings.ToLower(groups[j].Name)
+	})
+	return groups
+}
+
+// groupPagePath returns the path of the page of a tag or section, relative to the archive page
+func groupPagePath(dir string, group *archiveGroup) string {
+	return dir + "/" + group.Slug + ".html"
+}
+
+// taxonomyNavHTML renders the tag cloud and the lists of sections and series of the archive
+// page, the tags sized by their number of posts
+func (a *Archive) taxonomyNavHTML() string {
+	var nav string
+
+	if sections := a.sectionGroups(); len(sections) > 0 {
+		nav += "\t<div class=\"sections\">Sections: "
+		for _, section := range sections {
+			nav += fmt.Sprintf(`<a href="%s">%s</a>`, groupPagePath(ArchiveSectionsDir, section), html.EscapeString(section.Name))
+		}
+		nav += "</div>\n"
+	}
+
+	if series := a.seriesGroups(); len(series) > 0 {
+		nav += "\t<div class=\"series\">Series: "
+		for _, group := range series {
+			nav += fmt.Sprintf(`<a href="%s" title="%d posts">%s</a>`, groupPagePath(ArchiveSeriesDir, group), len(group.Entries), html.EscapeString(group.Name))
+		}
+		nav += "</div>\n"
+	}
+
+	if tags := a.tagGroups(); len(tags) > 0 {
+		max := 0
+		for _, tag := range tags {
+			if len(tag.Entries) > max {
+				max = len(tag.Entries)
+			}
+		}
+		nav += "\t<div class=\"tags\">"
+		for _, tag := range tags {
+			size := 12 + scaleBar(len(tag.Entries), max, 12)
+			nav += fmt.Sprintf(`<a href="%s" style="font-size: %dpx" title="%d posts">%s</a>`,
+				groupPagePath(ArchiveTagsDir, tag), size, len(tag.Entries), html.EscapeString(tag.Name))
+		}
+		nav += "</div>\n"
+	}
+
+	return nav
+}
+
+// generateTaxonomyPages writes a page for each tag, section and series of the archive in
+// outputDir, listing their posts like the archive page does, series in reading order
+func (a *Archive) generateTaxonomyPages(outputDir string) error {
+	pages := []struct {
+		dir    string
+		title  string
+		groups []*archiveGroup
+	}{
+		{ArchiveTagsDir, "Posts tagged %s", a.tagGroups()},
+		{ArchiveSectionsDir, "%s", a.sectionGroups()},
+		{ArchiveSeriesDir, "%s", a.seriesGroups()},
+	}
+
+	lang := a.language()
+	for _, p := range pages {
+		if len(p.groups) == 0 {
+			continue
+		}
+		dir := filepath.Join(outputDir, p.dir)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		for _, group := range p.groups {
+			title := html.EscapeString(fmt.Sprintf(p.title, group.Name))
+			page := archiveHTMLHead(title, lang)
+			page += "\t<h1>" + title + "</h1>\n"
+			page += fmt.Sprintf("\t<p><a href=\"../index.html\">All posts</a> | %d posts</p>\n", len(group.Entries))
+			for _, entry := range group.Entries {
+				page += entry.cardHTML(dir)
+			}
+			page += "</body>\n</html>"
+
+			if err := os.WriteFile(filepath.Join(dir, group.Slug+".html"), []byte(page), 0644); err != nil {
+				return fmt.Errorf("error writing page of %s: %w", group.Name, err)
+			}
+		}
+	}
+	return nil
+}
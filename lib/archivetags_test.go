@@ -0,0 +1,64 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveTaxonomyPages(t *testing.T) {
+	dir := t.TempDir()
+	downloadTime := time.Date(2023, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	archive := NewArchive()
+	archive.AddEntry(Post{
+		Title:       "First Post",
+		PostDate:    "2023-01-01T10:00:00Z",
+		Tags:        []PostTag{{Name: "Go", Slug: "go"}, {Name: "Tips & Tricks"}},
+		SectionName: "Essays",
+		SectionSlug: "essays",
+	}, filepath.Join(dir, "post1.html"), downloadTime)
+	archive.AddEntry(Post{
+		Title:    "Second Post",
+		PostDate: "2023-01-02T10:00:00Z",
+		Tags:     []PostTag{{Name: "Go", Slug: "go"}},
+	}, filepath.Join(dir, "post2.html"), downloadTime)
+	archive.AddEntry(Post{Title: "Untagged Post", PostDate: "2023-01-03T10:00:00Z"}, filepath.Join(dir, "post3.html"), downloadTime)
+
+	require.NoError(t, archive.GenerateHTML(dir))
+
+	index, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	require.NoError(t, err)
+	// The tag cloud sizes the tags by their number of posts
+	assert.Contains(t, string(index), `<a href="tags/go.html" style="font-size: 24px" title="2 posts">Go</a>`)
+	assert.Contains(t, string(index), `<a href="tags/tips-tricks.html" style="font-size: 18px" title="1 posts">Tips &amp; Tricks</a>`)
+	assert.Contains(t, string(index), `Sections: <a href="sections/essays.html">Essays</a>`)
+
+	page, err := os.ReadFile(filepath.Join(dir, "tags", "go.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(page), "<h1>Posts tagged Go</h1>")
+	assert.Contains(t, string(page), `<a href="../index.html">All posts</a> | 2 posts`)
+	assert.Contains(t, string(page), `<a href="../post2.html">Second Post</a>`)
+	assert.Contains(t, string(page), `<a href="../post1.html">First Post</a>`)
+	assert.NotContains(t, string(page), "Untagged Post")
+
+	page, err = os.ReadFile(filepath.Join(dir, "sections", "essays.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(page), "<h1>Essays</h1>")
+	assert.Contains(t, string(page), "First Post")
+	assert.NotContains(t, string(page), "Second Post")
+
+	// Without tags nor sections, the archive is a single page
+	plainDir := t.TempDir()
+	plain := NewArchive()
+	plain.AddEntry(Post{Title: "Post", PostDate: "2023-01-01T10:00:00Z"}, filepath.Join(plainDir, "post.html"), downloadTime)
+	require.NoError(t, plain.GenerateHTML(plainDir))
+	index, err = os.ReadFile(filepath.Join(plainDir, "index.html"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(index), `class="tags"`)
+	assert.NoDirExists(t, filepath.Join(plainDir, ArchiveTagsDir))
+}
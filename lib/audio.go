@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// PostAudioItem is an audio version of a post, such as its narration
+type PostAudioItem struct {
+	Type     string `json:"type"` // "voiceover" for a narration recorded by the author, "tts" for a generated one
+	Status   string `json:"status,omitempty"`
+	AudioURL string `json:"audio_url"`
+}
+
+// NarrationURL returns the URL of the narration of the post ("listen to this post"),
+// preferring the one recorded by the author, or "" if the post has none
+func (p *Post) NarrationURL() string {
+	narration := ""
+	for _, item := range p.AudioItems {
+		if item.AudioURL == "" || (item.Status != "" && item.Status != "completed") {
+			continue
+		}
+		if item.Type == "voiceover" {
+			return item.AudioURL
+		}
+		if narration == "" {
+			narration = item.AudioURL
+		}
+	}
+	return narration
+}
+
+// DownloadNarration downloads the narration of a post into audioDir, a directory relative to
+// outputDir, as {slug}{ext}. It returns the path of the file relative to outputDir, or "" if
+// the post has no narration. An existing file is kept, and an interrupted download is resumed.
+func DownloadNarration(ctx context.Context, fetcher *Fetcher, post Post, outputDir, audioDir string) (string, error) {
+	audioURL := post.NarrationURL()
+	if audioURL == "" {
+		return "", nil
+	}
+	if fetcher == nil {
+		fetcher = NewFetcher()
+	}
+
+	ext := ".mp3"
+	if u, err := url.Parse(audioURL); err == nil && path.Ext(u.Path) != "" {
+		ext = path.Ext(u.Path)
+	}
+	relPath := path.Join(filepath.ToSlash(audioDir), post.Slug+ext)
+	localPath := filepath.Join(outputDir, filepath.FromSlash(relPath))
+	if _, err := os.Stat(localPath); err == nil {
+		return relPath, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return "", err
+	}
+
+	if _, err := DownloadToFile(ctx, fetcher, audioURL, localPath); err != nil {
+		return "", fmt.Errorf("failed to download narration: %w", err)
+	}
+	return relPath, nil
+}
+
+// NarrationHTML returns the player linking to the narration saved at src, shown at the top of a post
+func NarrationHTML(src string) string {
+	src = html.EscapeString(src)
+	return `<p class="narration"><audio controls src="` + src + `"></audio><br><a href="` + src + `">Listen to this post</a></p>` + "\n"
+}
@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test choosing the narration of a post
+func TestNarrationURL(t *testing.T) {
+	post := Post{}
+	assert.Empty(t, post.NarrationURL())
+
+	post.AudioItems = []PostAudioItem{
+		{Type: "tts", Status: "in_progress", AudioURL: "https://cdn.example.com/pending.mp3"},
+		{Type: "tts", Status: "completed", AudioURL: "https://cdn.example.com/tts.mp3"},
+	}
+	assert.Equal(t, "https://cdn.example.com/tts.mp3", post.NarrationURL())
+
+	post.AudioItems = append(post.AudioItems, PostAudioItem{Type: "voiceover", AudioURL: "https://cdn.example.com/author.m4a"})
+	assert.Equal(t, "https://cdn.example.com/author.m4a", post.NarrationURL())
+}
+
+// Test downloading the narration of a post
+func TestDownloadNarration(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("fake audio"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	ctx := context.Background()
+	post := Post{Slug: "my-post", AudioItems: []PostAudioItem{{Type: "tts", AudioURL: server.URL + "/narration.m4a?token=x"}}}
+
+	relPath, err := DownloadNarration(ctx, nil, post, dir, "audio")
+	require.NoError(t, err)
+	assert.Equal(t, "audio/my-post.m4a", relPath)
+	data, err := os.ReadFile(filepath.Join(dir, "audio", "my-post.m4a"))
+	require.NoError(t, err)
+	assert.Equal(t, "fake audio", string(data))
+
+	// Existing narrations are not downloaded again
+	_, err = DownloadNarration(ctx, nil, post, dir, "audio")
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests)
+
+	relPath, err = DownloadNarration(ctx, nil, Post{Slug: "text-only"}, dir, "audio")
+	require.NoError(t, err)
+	assert.Empty(t, relPath)
+
+	post = Post{Slug: "broken", AudioItems: []PostAudioItem{{AudioURL: server.URL + "/missing"}}}
+	_, err = DownloadNarration(ctx, nil, post, dir, "audio")
+	assert.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, "audio", "broken.mp3"))
+
+	assert.Equal(t, `<p class="narration"><audio controls src="audio/my-post.m4a"></audio><br><a href="audio/my-post.m4a">Listen to this post</a></p>`+"\n",
+		NarrationHTML("audio/my-post.m4a"))
+}
@@ -0,0 +1,69 @@
+package lib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// byteUnits are the multipliers of the units accepted by ParseByteSize, longest suffix first
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"TIB", 1 << 40},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"TB", 1 << 40},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// ParseByteSize parses a size such as "2GB", "500 MB" or "1048576" into bytes.
+// Units are binary, so 1KB is 1024 bytes.
+func ParseByteSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	size := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			size = unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q: expected a number of bytes such as 500MB or 2GB", s)
+	}
+	return int64(n * float64(size)), nil
+}
+
+// FormatByteSize formats a size in bytes for humans, e.g. 1.5 MB
+func FormatByteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// budgetExceeded returns why a run started at start, when the fetcher had read startBytes and
+// made startRequests, must stop because of the MaxDuration, MaxBytes or MaxRequests options,
+// or "" if it can go on
+func (d *Downloader) budgetExceeded(start time.Time, startBytes int64, startRequests int) string {
+	if d.opts.MaxDuration > 0 && time.Since(start) >= d.opts.MaxDuration {
+		return fmt.Sprintf("max duration of %s reached", d.opts.MaxDuration)
+	}
+	if d.opts.MaxBytes > 0 && d.fetcher.BytesRead()-startBytes >= d.opts.MaxBytes {
+		return fmt.Sprintf("max of %d bytes downloaded reached", d.opts.MaxBytes)
+	}
+	if d.opts.MaxRequests > 0 && d.fetcher.Stats().Requests-startRequests >= d.opts.MaxRequests {
+		return fmt.Sprintf("max of %d requests reached", d.opts.MaxRequests)
+	}
+	return ""
+}
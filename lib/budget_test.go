@@ -0,0 +1,135 @@
+package lib
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"1024", 1024},
+		{"500B", 500},
+		{"1KB", 1024},
+		{"1.5k", 1536},
+		{"500 MB", 500 << 20},
+		{"2GB", 2 << 30},
+		{"2GiB", 2 << 30},
+		{"1TB", 1 << 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			size, err := ParseByteSize(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, size)
+		})
+	}
+
+	for _, input := range []string{"", "GB", "two GB", "-1MB", "2XB"} {
+		_, err := ParseByteSize(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestFetcherBytesRead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 1000)))
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(WithRatePerSecond(100))
+	for i := 0; i < 2; i++ {
+		body, err := fetcher.FetchURL(context.Background(), server.URL)
+		require.NoError(t, err)
+		_, err = io.Copy(io.Discard, body)
+		require.NoError(t, err)
+		body.Close()
+	}
+	assert.Equal(t, int64(2000), fetcher.BytesRead())
+}
+
+func TestDownloaderBudgets(t *testing.T) {
+	// Every post page is 1000 bytes without a post, so that each post fails once read
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body>" + strings.Repeat("x", 1000-len("<html><body></body></html>")) + "</body></html>"))
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL + "/p/one", server.URL + "/p/two", server.URL + "/p/three", server.URL + "/p/four", server.URL + "/p/five"}
+
+	run := func(t *testing.T, opts DownloadOptions) (*DownloadSummary, []string) {
+		tempDir := t.TempDir()
+		opts.OutputDir = tempDir
+		opts.PostDelay = 100 * time.Millisecond
+		downloader := NewDownloader(NewFetcher(WithRatePerSecond(100)), opts)
+
+		var order []string
+		summary, err := downloader.DownloadPosts(context.Background(), urls, func(result PostResult) {
+			order = append(order, result.URL)
+		})
+		require.NoError(t, err)
+
+		// The manifest is still saved with the posts processed before stopping
+		manifest, err := LoadManifest(tempDir)
+		require.NoError(t, err)
+		assert.Len(t, manifest.Failures, len(order))
+		_, err = os.Stat(filepath.Join(tempDir, ManifestFile))
+		assert.NoError(t, err)
+		return summary, order
+	}
+
+	t.Run("max bytes", func(t *testing.T) {
+		opts := DefaultDownloadOptions()
+		opts.MaxBytes = 1500
+		summary, order := run(t, opts)
+		assert.Equal(t, urls[:2], order)
+		assert.Contains(t, summary.Stopped, "1500 bytes")
+	})
+
+	t.Run("max duration", func(t *testing.T) {
+		opts := DefaultDownloadOptions()
+		opts.MaxDuration = 150 * time.Millisecond
+		summary, order := run(t, opts)
+		assert.Equal(t, urls[:2], order)
+		assert.Contains(t, summary.Stopped, "max duration")
+	})
+
+	t.Run("max requests", func(t *testing.T) {
+		opts := DefaultDownloadOptions()
+		opts.MaxRequests = 3
+		summary, order := run(t, opts)
+		assert.Equal(t, urls[:3], order)
+		assert.Contains(t, summary.Stopped, "3 requests")
+	})
+
+	t.Run("no budget", func(t *testing.T) {
+		summary, order := run(t, DefaultDownloadOptions())
+		assert.Equal(t, urls, order)
+		assert.Empty(t, summary.Stopped)
+	})
+}
+
+func TestDownloaderLimit(t *testing.T) {
+	urls := []string{"https://example.com/p/one", "https://example.com/p/two", "https://example.com/p/three"}
+
+	opts := DefaultDownloadOptions()
+	assert.Equal(t, urls, NewDownloader(nil, opts).limit(urls))
+
+	opts.Limit = 2
+	assert.Equal(t, urls[:2], NewDownloader(nil, opts).limit(urls))
+	assert.Equal(t, urls[:1], NewDownloader(nil, opts).limit(urls[:1]))
+	assert.Empty(t, NewDownloader(nil, opts).limit(nil))
+}
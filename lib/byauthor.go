@@ -0,0 +1,69 @@
+package lib
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// unknownAuthor is the folder of the posts that credit no author, and their heading on the archive page
+const unknownAuthor = "Unknown author"
+
+// authorDirRegex matches the characters replaced in the folder names of authors
+var authorDirRegex = regexp.MustCompile(`[^\p{L}\p{N}._-]+`)
+
+// AuthorPostPath returns the path a post is written to when organized by author:
+// {outputDir}/{author}/{year}/{slug}.{format}, the author being the first one credited
+func AuthorPostPath(post Post, outputDir string, format string) string {
+	year := "undated"
+	if date, err := time.Parse(time.RFC3339, post.PostDate); err == nil {
+		year = date.Format("2006")
+	}
+	return filepath.Join(outputDir, authorDir(post), year, post.Slug+"."+format)
+}
+
+// PostAuthorName returns the name of the first author credited on a post
+func PostAuthorName(post Post) string {
+	for _, byline := range post.Bylines {
+		if byline.Name != "" {
+			return byline.Name
+		}
+		if byline.Handle != "" {
+			return byline.Handle
+		}
+	}
+	return unknownAuthor
+}
+
+// authorDir returns the folder of the posts of the first author credited on a post: their
+// handle, or their name made safe for file names
+func authorDir(post Post) string {
+	for _, byline := range post.Bylines {
+		name := byline.Handle
+		if name == "" {
+			name = byline.Name
+		}
+		if dir := strings.Trim(authorDirRegex.ReplaceAllString(name, "-"), "-."); dir != "" {
+			return dir
+		}
+	}
+	return "unknown-author"
+}
+
+// FilterExistingAuthorPosts filters out the posts already written to a folder of an author.
+// The author of a post isn't known before it is downloaded, so any author and year match.
+func FilterExistingAuthorPosts(urls []string, outputDir string, format string) ([]string, error) {
+	var filtered []string
+	for _, url := range urls {
+		pattern := filepath.Join(outputDir, "*", "*", SlugFromURL(url)+"."+format)
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return urls, err
+		}
+		if len(matches) == 0 {
+			filtered = append(filtered, url)
+		}
+	}
+	return filtered, nil
+}
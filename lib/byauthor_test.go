@@ -0,0 +1,87 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the paths of posts organized by author
+func TestAuthorPostPath(t *testing.T) {
+	post := Post{Slug: "my-post", PostDate: "2023-05-01T10:00:00Z",
+		Bylines: []PostByline{{Name: "Jane Doe", Handle: "janedoe"}, {Name: "John Roe", Handle: "john"}}}
+	assert.Equal(t, filepath.Join("out", "janedoe", "2023", "my-post.html"), AuthorPostPath(post, "out", "html"))
+	assert.Equal(t, "Jane Doe", PostAuthorName(post))
+
+	post.Bylines = []PostByline{{Name: "Jane / Doe: Jr."}}
+	assert.Equal(t, filepath.Join("out", "Jane-Doe-Jr", "2023", "my-post.md"), AuthorPostPath(post, "out", "md"))
+
+	post.Bylines = nil
+	post.PostDate = ""
+	assert.Equal(t, filepath.Join("out", "unknown-author", "undated", "my-post.md"), AuthorPostPath(post, "out", "md"))
+	assert.Equal(t, unknownAuthor, PostAuthorName(post))
+}
+
+// Test finding the posts already written to the folder of an author
+func TestFilterExistingAuthorPosts(t *testing.T) {
+	tempDir := t.TempDir()
+	existing := AuthorPostPath(Post{Slug: "existing", PostDate: "2023-05-01T10:00:00Z",
+		Bylines: []PostByline{{Handle: "jane"}}}, tempDir, "html")
+	require.NoError(t, os.MkdirAll(filepath.Dir(existing), 0755))
+	require.NoError(t, os.WriteFile(existing, []byte("x"), 0644))
+
+	urls := []string{"https://example.com/p/existing", "https://example.com/p/missing"}
+	filtered, err := FilterExistingAuthorPosts(urls, tempDir, "html")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://example.com/p/missing"}, filtered)
+
+	filtered, err = FilterExistingAuthorPosts(urls, tempDir, "md")
+	require.NoError(t, err)
+	assert.Equal(t, urls, filtered)
+}
+
+// Test grouping the archive page by author
+func TestArchiveByAuthor(t *testing.T) {
+	tempDir := t.TempDir()
+	archive := NewArchive()
+	archive.ByAuthor = true
+
+	posts := []Post{
+		{Title: "Jane Old", Slug: "jane-old", PostDate: "2023-01-01T10:00:00Z", Bylines: []PostByline{{Name: "Jane", Handle: "jane"}}},
+		{Title: "Bob Post", Slug: "bob-post", PostDate: "2023-02-01T10:00:00Z", Bylines: []PostByline{{Name: "Bob", Handle: "bob"}}},
+		{Title: "Jane New", Slug: "jane-new", PostDate: "2023-03-01T10:00:00Z", Bylines: []PostByline{{Name: "Jane", Handle: "jane"}}},
+	}
+	for _, post := range posts {
+		archive.AddEntry(post, AuthorPostPath(post, tempDir, "md"), time.Now())
+	}
+
+	require.NoError(t, archive.Generate(context.Background(), tempDir, "md"))
+	data, err := os.ReadFile(filepath.Join(tempDir, "index.md"))
+	require.NoError(t, err)
+	content := string(data)
+
+	order := []string{"## Bob\n", "### [Bob Post](bob/2023/bob-post.md)", "## Jane\n", "### [Jane New]", "### [Jane Old]"}
+	last := -1
+	for _, s := range order {
+		i := strings.Index(content, s)
+		require.Greater(t, i, last, s)
+		last = i
+	}
+	assert.Equal(t, 1, strings.Count(content, "## Jane\n"))
+
+	require.NoError(t, archive.Generate(context.Background(), tempDir, "html"))
+	data, err = os.ReadFile(filepath.Join(tempDir, "index.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `<h2 class="author">Bob</h2>`)
+
+	require.NoError(t, archive.Generate(context.Background(), tempDir, "txt"))
+	data, err = os.ReadFile(filepath.Join(tempDir, "index.txt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "Jane\n====\n\n")
+}
@@ -0,0 +1,119 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"html"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// canonicalSkipped are the elements left out of the canonical text
+var canonicalSkipped = map[string]bool{
+	"#comment": true, "head": true, "script": true, "style": true, "noscript": true, "template": true,
+	"img": true, "picture": true, "svg": true, "iframe": true, "button": true, "form": true,
+}
+
+// canonicalBlocks are the elements starting a new paragraph of the canonical text
+var canonicalBlocks = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "aside": true, "header": true, "footer": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "blockquote": true, "pre": true,
+	"ul": true, "ol": true, "li": true, "table": true, "tr": true, "td": true, "th": true, "figure": true,
+	"figcaption": true, "hr": true, "br": true, "dl": true, "dt": true, "dd": true,
+}
+
+// canonicalInvisible are characters that don't show in the text but change with the editor
+var canonicalInvisible = strings.NewReplacer("\u00a0", " ", "\u200b", "", "\u200c", "", "\u200d", "", "\ufeff", "", "\u00ad", "")
+
+// CanonicalText returns the text of an HTML fragment in a form meant to be compared: one
+// paragraph per block, separated by a blank line, with whitespace collapsed and markup dropped.
+// Links keep their text only, and attributes, images and scripts are ignored, so that the
+// canonical text of a post only changes when its text does.
+func CanonicalText(htmlContent string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	if err != nil {
+		return canonicalPlainText(htmlContent)
+	}
+	var paragraphs []string
+	var current strings.Builder
+	flush := func() {
+		if para := normalizeWhitespace(canonicalInvisible.Replace(current.String())); para != "" {
+			paragraphs = append(paragraphs, para)
+		}
+		current.Reset()
+	}
+	var walk func(*goquery.Selection)
+	walk = func(sel *goquery.Selection) {
+		sel.Contents().Each(func(_ int, node *goquery.Selection) {
+			name := goquery.NodeName(node)
+			switch {
+			case name == "#text":
+				current.WriteString(node.Text())
+			case canonicalSkipped[name]:
+			case canonicalBlocks[name]:
+				flush()
+				walk(node)
+				flush()
+			default:
+				// Inline elements such as links or emphasis
+				walk(node)
+			}
+		})
+	}
+	walk(doc.Selection)
+	flush()
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// canonicalPlainText returns plain text in the canonical form of CanonicalText
+func canonicalPlainText(text string) string {
+	var paragraphs []string
+	for _, para := range splitParagraphs(text) {
+		if para = normalizeWhitespace(canonicalInvisible.Replace(para)); para != "" {
+			paragraphs = append(paragraphs, para)
+		}
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// CanonicalText returns the canonical text of the title and body of the post, see CanonicalText
+func (p *Post) CanonicalText() string {
+	return CanonicalText("<h1>" + html.EscapeString(p.Title) + "</h1>\n" + p.BodyHTML)
+}
+
+// TextHash returns the SHA-256 of the canonical text of the post, recorded in the manifest to
+// tell edits of the text of a post from changes of its markup. It is empty without a body.
+func (p *Post) TextHash() string {
+	if p.BodyHTML == "" {
+		return ""
+	}
+	return textHash(p.CanonicalText())
+}
+
+// textHash returns the hex SHA-256 of a canonical text
+func textHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// CanonicalText returns the canonical text of the downloaded post, whatever its format, leaving
+// out the related posts and source URL added when it was written
+func (lp *LocalPost) CanonicalText() string {
+	var text string
+	switch lp.Format {
+	case "html":
+		text = CanonicalText(relatedBlockRegex.ReplaceAllString(lp.Content, ""))
+	case "md":
+		text = CanonicalText(MarkdownToHTML(lp.Content))
+	default:
+		text = canonicalPlainText(lp.Content)
+	}
+	var paragraphs []string
+	for _, para := range strings.Split(text, "\n\n") {
+		if para != "" && !strings.HasPrefix(para, "original content: ") {
+			paragraphs = append(paragraphs, para)
+		}
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
@@ -0,0 +1,55 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalText(t *testing.T) {
+	text := CanonicalText(`<div class="body markup"><p data-attrs="{}">Hello&nbsp;<a href="https://example.com/?utm_source=a">big
+	world</a>!</p><img src="https://cdn.example.com/1.png"><ul><li>one</li><li>two<br>lines</li></ul>` +
+		"<p>\u200b</p><script>var x = 1;</script><p>  Last  </p></div>")
+	assert.Equal(t, "Hello big world!\n\none\n\ntwo\n\nlines\n\nLast", text)
+
+	// Markup and attribute churn doesn't change the text
+	assert.Equal(t, text, CanonicalText(`<p class="other">Hello <b><a href="https://example.com/">big world</a></b>!</p>`+
+		`<picture><img src="https://cdn.example.com/2.webp"></picture><ol><li>one</li><li>two<br/>lines</li></ol><p>Last</p>`))
+	assert.NotEqual(t, text, CanonicalText(`<p>Hello big world?</p><ul><li>one</li><li>two<br>lines</li></ul><p>Last</p>`))
+
+	post := Post{Title: "Title", BodyHTML: `<p class="a">Body</p>`}
+	assert.Equal(t, "Title\n\nBody", post.CanonicalText())
+	edited := Post{Title: "Title", BodyHTML: `<p class="b"><a href="https://example.com">Body</a></p>`}
+	assert.Equal(t, post.TextHash(), edited.TextHash())
+	assert.Len(t, post.TextHash(), 64)
+	assert.Empty(t, (&Post{Title: "No body"}).TextHash())
+}
+
+// Test that the formats of a downloaded post have the same canonical text
+func TestLocalPostCanonicalText(t *testing.T) {
+	post := Post{Title: "My Post", CanonicalUrl: "https://example.substack.com/p/my-post",
+		BodyHTML: `<p>First <a href="https://example.com">paragraph</a>.</p><p>Second<em> one</em></p>`}
+	dir := t.TempDir()
+
+	var texts []string
+	for _, format := range []string{"html", "md", "txt"} {
+		path := filepath.Join(dir, "post."+format)
+		require.NoError(t, post.WriteToFile(path, format, true))
+		if format == "html" {
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+			require.NoError(t, err)
+			f.WriteString(RelatedPostsHTML([]string{"Other"}, []string{"other.html"}))
+			f.Close()
+		}
+		local, err := LoadLocalPost(path)
+		require.NoError(t, err)
+		texts = append(texts, local.CanonicalText())
+	}
+	assert.Equal(t, "My Post\n\nFirst paragraph.\n\nSecond one", texts[0])
+	assert.Equal(t, texts[0], texts[1])
+	// Plain text posts show the URLs of their links
+	assert.Equal(t, "My Post\n\nFirst https://example.com.\n\nSecond one", texts[2])
+}
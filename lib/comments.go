@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// UserProfile is the public profile of a Substack user
+type UserProfile struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Handle string `json:"handle"`
+}
+
+// FetchSelf returns the profile of the logged in user, whose cookie the fetcher sends
+func (nc *NotesClient) FetchSelf(ctx context.Context) (*UserProfile, error) {
+	var profile UserProfile
+	if err := nc.api.Get(ctx, "user/profile/self", nil, &profile); err != nil {
+		if errors.Is(err, ErrAPIUnauthorized) {
+			return nil, fmt.Errorf("not logged in, check the cookie: %w", err)
+		}
+		return nil, err
+	}
+	if profile.ID == 0 {
+		return nil, errors.New("no user in the profile of the logged in user")
+	}
+	return &profile, nil
+}
+
+// PublicationComments is the comments written on the posts of one publication
+type PublicationComments struct {
+	Dir      string // name of the folder of the publication, from its subdomain or name
+	Name     string
+	Comments []*Note
+}
+
+// unsafeDirChars matches the characters not kept in the folder names of publications
+var unsafeDirChars = regexp.MustCompile(`[^\w\-.]+`)
+
+// publicationDir returns the folder name of the publication of an activity item
+func publicationDir(publication map[string]interface{}) string {
+	for _, key := range []string{"subdomain", "name"} {
+		if value, ok := publication[key].(string); ok {
+			if dir := strings.Trim(unsafeDirChars.ReplaceAllString(value, "-"), "-."); dir != "" {
+				return dir
+			}
+		}
+	}
+	if id, ok := publication["id"].(float64); ok {
+		return "publication-" + strconv.FormatInt(int64(id), 10)
+	}
+	return "other"
+}
+
+// GroupCommentsByPublication returns the comments on posts among activity items, leaving out
+// notes, grouped by the publication of the post and sorted by folder name.
+// The comments of each publication are in chronological order.
+func (nc *NotesClient) GroupCommentsByPublication(items []ActivityItem) []PublicationComments {
+	groups := make(map[string]*PublicationComments)
+	for _, item := range items {
+		if item.Type != "comment" || item.Comment.ID == 0 || !nc.IsLikelyRegularComment(item.Comment, item) {
+			continue
+		}
+		comment := nc.ConvertComment(item.Comment, item)
+		if comment == nil {
+			continue
+		}
+		dir := publicationDir(item.Publication)
+		group, ok := groups[dir]
+		if !ok {
+			name, _ := item.Publication["name"].(string)
+			if name == "" {
+				name = dir
+			}
+			group = &PublicationComments{Dir: dir, Name: name}
+			groups[dir] = group
+		}
+		group.Comments = append(group.Comments, comment)
+	}
+
+	result := make([]PublicationComments, 0, len(groups))
+	for _, group := range groups {
+		SortNotes(group.Comments, "date")
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Dir < result[j].Dir })
+	return result
+}
+
+// SaveComments saves the comments of each publication in its own folder of outputDir,
+// one file per comment or, if monthly, one file per month. It returns the number of files written.
+func (nc *NotesClient) SaveComments(groups []PublicationComments, outputDir, format string, monthly bool) (int, error) {
+	files := 0
+	for _, group := range groups {
+		dir := filepath.Join(outputDir, group.Dir)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return files, err
+		}
+		if monthly {
+			paths, err := nc.SaveMonthlyDigests(group.Comments, dir, format)
+			files += len(paths)
+			if err != nil {
+				return files, err
+			}
+			continue
+		}
+		for _, comment := range group.Comments {
+			if err := nc.SaveNote(comment, dir, format); err != nil {
+				return files, fmt.Errorf("saving comment %s: %w", comment.ID, err)
+			}
+			files++
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,76 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test fetching the logged in user
+func TestFetchSelf(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("substack.sid"); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(UserProfile{ID: 42, Name: "Jane", Handle: "jane"})
+	}))
+	defer server.Close()
+
+	client := NewNotesClient(NewFetcher(WithCookie(&http.Cookie{Name: "substack.sid", Value: "secret"})))
+	client.api.BaseURL = server.URL + "/api/v1"
+	self, err := client.FetchSelf(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &UserProfile{ID: 42, Name: "Jane", Handle: "jane"}, self)
+
+	anonymous := NewNotesClient(NewFetcher())
+	anonymous.api.BaseURL = server.URL + "/api/v1"
+	_, err = anonymous.FetchSelf(context.Background())
+	assert.ErrorIs(t, err, ErrAPIUnauthorized)
+}
+
+// Test grouping and saving comments by publication
+func TestGroupCommentsByPublication(t *testing.T) {
+	items := []ActivityItem{
+		{Type: "comment", Comment: Comment{ID: 2, Body: "Later comment", Date: "2024-02-01T00:00:00Z"},
+			Publication: map[string]interface{}{"subdomain": "alpha", "name": "Alpha Letter"}},
+		{Type: "comment", Comment: Comment{ID: 1, Body: "Ok!", Date: "2024-01-01T00:00:00Z"},
+			Publication: map[string]interface{}{"subdomain": "alpha", "name": "Alpha Letter"}},
+		{Type: "comment", Comment: Comment{ID: 3, Body: "On another publication", Date: "2024-01-15T00:00:00Z"},
+			Publication: map[string]interface{}{"name": "Beta / Gamma"}},
+		{Type: "comment", Comment: Comment{ID: 4, Body: "A note, not a comment"}, Context: Context{Type: "note"}},
+		{Type: "comment", Comment: Comment{ID: 5, Body: "No publication", Date: "2024-01-20T00:00:00Z"}},
+		{Type: "post"},
+	}
+
+	client := NewNotesClient(NewFetcher())
+	groups := client.GroupCommentsByPublication(items)
+	require.Len(t, groups, 3)
+
+	assert.Equal(t, "Beta-Gamma", groups[0].Dir)
+	assert.Equal(t, "alpha", groups[1].Dir)
+	assert.Equal(t, "Alpha Letter", groups[1].Name)
+	require.Len(t, groups[1].Comments, 2)
+	assert.Equal(t, "1", groups[1].Comments[0].ID, "short comments are kept, in chronological order")
+	assert.Equal(t, "comment", groups[1].Comments[0].Type)
+	assert.Equal(t, "other", groups[2].Dir)
+
+	dir := t.TempDir()
+	files, err := client.SaveComments(groups, dir, "md", false)
+	require.NoError(t, err)
+	assert.Equal(t, 4, files)
+	saved, err := os.ReadDir(filepath.Join(dir, "alpha"))
+	require.NoError(t, err)
+	assert.Len(t, saved, 2)
+
+	files, err = client.SaveComments(groups, t.TempDir(), "md", true)
+	require.NoError(t, err)
+	assert.Equal(t, 4, files, "alpha has comments in two months")
+}
@@ -0,0 +1,97 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Config is the content of the sbstck-dl configuration file
+type Config struct {
+	Transport TransportConfig `json:"transport"`
+	// IgnoreSelectors are CSS selectors of elements removed from the body of the posts
+	// downloaded, besides those of the --ignore-selector flags
+	IgnoreSelectors []string `json:"ignore_selectors,omitempty"`
+}
+
+// TransportConfig tunes the HTTP connections of the Fetcher.
+// Zero values keep the defaults.
+type TransportConfig struct {
+	MaxIdleConnsPerHost int      `json:"max_idle_conns_per_host,omitempty"`
+	KeepAlive           Duration `json:"keep_alive,omitempty"` // Negative to disable keep-alives
+	DNSCacheTTL         Duration `json:"dns_cache_ttl,omitempty"`
+	Resolver            string   `json:"resolver,omitempty"` // DNS server as "host:port"
+	DisableHTTP2        bool     `json:"disable_http2,omitempty"`
+	Brotli              bool     `json:"brotli,omitempty"`
+}
+
+// Duration is a time.Duration written as a string such as "30s" in the configuration file
+type Duration time.Duration
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON reads a duration string such as "1m30s"
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid duration %s: expected a string such as \"30s\"", data)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// DefaultConfigPath returns the path of the configuration file read when none is given,
+// sbstck-dl/config.json in the user configuration directory
+func DefaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "sbstck-dl", "config.json")
+}
+
+// LoadConfig reads a configuration file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// FetcherOptions returns the Fetcher options of the transport settings
+func (c TransportConfig) FetcherOptions() []FetcherOption {
+	var opts []FetcherOption
+	if c.MaxIdleConnsPerHost > 0 {
+		opts = append(opts, WithMaxIdleConnsPerHost(c.MaxIdleConnsPerHost))
+	}
+	if c.KeepAlive != 0 {
+		opts = append(opts, WithKeepAlive(time.Duration(c.KeepAlive)))
+	}
+	if c.DNSCacheTTL > 0 {
+		opts = append(opts, WithDNSCache(time.Duration(c.DNSCacheTTL)))
+	}
+	if c.Resolver != "" {
+		opts = append(opts, WithResolver(c.Resolver))
+	}
+	if c.DisableHTTP2 {
+		opts = append(opts, WithHTTP2(false))
+	}
+	if c.Brotli {
+		opts = append(opts, WithBrotli(true))
+	}
+	return opts
+}
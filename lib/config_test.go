@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test reading the configuration file
+func TestLoadConfig(t *testing.T) {
+	dir, err := os.MkdirTemp("", "config-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+  "transport": {
+    "max_idle_conns_per_host": 32,
+    "keep_alive": "1m",
+    "dns_cache_ttl": "5m",
+    "resolver": "1.1.1.1:53",
+    "disable_http2": true,
+    "brotli": true
+  }
+}`), 0644))
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, TransportConfig{
+		MaxIdleConnsPerHost: 32,
+		KeepAlive:           Duration(time.Minute),
+		DNSCacheTTL:         Duration(5 * time.Minute),
+		Resolver:            "1.1.1.1:53",
+		DisableHTTP2:        true,
+		Brotli:              true,
+	}, config.Transport)
+
+	var options FetcherOptions
+	for _, opt := range config.Transport.FetcherOptions() {
+		opt(&options)
+	}
+	assert.Equal(t, 32, options.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Minute, options.KeepAlive)
+	assert.Equal(t, 5*time.Minute, options.DNSCacheTTL)
+	assert.Equal(t, "1.1.1.1:53", options.Resolver)
+	assert.True(t, options.DisableHTTP2)
+	assert.True(t, options.Brotli)
+	assert.Empty(t, TransportConfig{}.FetcherOptions())
+
+	data, err := json.Marshal(config.Transport.KeepAlive)
+	require.NoError(t, err)
+	assert.Equal(t, `"1m0s"`, string(data))
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := LoadConfig(filepath.Join(dir, "missing.json"))
+		assert.True(t, os.IsNotExist(err))
+
+		require.NoError(t, os.WriteFile(path, []byte(`{"transport": {"keep_alive": 30}}`), 0644))
+		_, err = LoadConfig(path)
+		assert.ErrorContains(t, err, "invalid duration")
+
+		require.NoError(t, os.WriteFile(path, []byte(`{"transport": {"dns_cache_ttl": "soon"}}`), 0644))
+		_, err = LoadConfig(path)
+		assert.Error(t, err)
+	})
+}
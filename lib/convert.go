@@ -0,0 +1,108 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConvertFormats lists the formats downloaded posts can be converted to
+var ConvertFormats = []string{"html", "md", "txt", "epub"}
+
+// sourceFormatPreference is the order in which source files are preferred when a post
+// was downloaded in several formats: HTML keeps the most information.
+var sourceFormatPreference = []string{"html", "md", "txt"}
+
+// sourceFormatRank returns the rank of format in sourceFormatPreference, lower being preferred
+func sourceFormatRank(format string) int {
+	for i, f := range sourceFormatPreference {
+		if f == format {
+			return i
+		}
+	}
+	return len(sourceFormatPreference)
+}
+
+// PreferredLocalPosts keeps a single file per post, choosing the source format given
+// (if the post was downloaded in it), or else the richest format available. The posts found
+// by ScanLocalPosts are read again from their file in the given format when they have one.
+func PreferredLocalPosts(posts []LocalPost, preferred string) ([]LocalPost, error) {
+	rank := func(format string) int {
+		if format == preferred {
+			return -1
+		}
+		return sourceFormatRank(format)
+	}
+
+	best := make(map[string]int)
+	var order []string
+	for i, post := range posts {
+		key := filepath.Dir(post.Path) + "\x00" + post.Slug
+		j, ok := best[key]
+		if !ok {
+			order = append(order, key)
+			best[key] = i
+			continue
+		}
+		if rank(post.Format) < rank(posts[j].Format) {
+			best[key] = i
+		}
+	}
+
+	selected := make([]LocalPost, 0, len(order))
+	for _, key := range order {
+		post := posts[best[key]]
+		if _, ok := post.Files[preferred]; ok && preferred != "" {
+			var err error
+			if post, err = post.InFormat(preferred); err != nil {
+				return nil, err
+			}
+		}
+		selected = append(selected, post)
+	}
+	return selected, nil
+}
+
+// ConvertedPath returns the path of a post converted to the given format in outputDir,
+// keeping the original file name.
+func ConvertedPath(post LocalPost, outputDir string, format string) string {
+	base := strings.TrimSuffix(filepath.Base(post.Path), filepath.Ext(post.Path))
+	return filepath.Join(outputDir, base+"."+format)
+}
+
+// ConvertLocalPost renders a downloaded post in another format and writes it to outputPath.
+// Nothing is fetched from the network: local images are embedded in EPUB files, remote ones are left as links.
+func ConvertLocalPost(post LocalPost, format string, outputPath string) error {
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+
+	var content string
+	switch format {
+	case "html":
+		content = post.HTML()
+	case "md":
+		var err error
+		content, err = post.Markdown()
+		if err != nil {
+			return fmt.Errorf("failed to convert %s to markdown: %w", post.Path, err)
+		}
+	case "txt":
+		content = post.PlainText()
+	case "epub":
+		book := NewEPUB(post.Title)
+		book.Description = post.Subtitle
+		if !post.Date.IsZero() {
+			book.Date = post.Date
+		}
+		if err := book.AddChapter(post.Title, post.HTML(), filepath.Dir(post.Path)); err != nil {
+			return err
+		}
+		return book.WriteFile(outputPath)
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+
+	return os.WriteFile(outputPath, []byte(content), 0644)
+}
@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test choosing one source file per post
+func TestPreferredLocalPosts(t *testing.T) {
+	posts := []LocalPost{
+		{Slug: "a", Format: "txt"},
+		{Slug: "a", Format: "html"},
+		{Slug: "a", Format: "md"},
+		{Slug: "b", Format: "md"},
+	}
+
+	selected, err := PreferredLocalPosts(posts, "")
+	require.NoError(t, err)
+	require.Len(t, selected, 2)
+	assert.Equal(t, "html", selected[0].Format)
+	assert.Equal(t, "b", selected[1].Slug)
+
+	selected, err = PreferredLocalPosts(posts, "txt")
+	require.NoError(t, err)
+	assert.Equal(t, "txt", selected[0].Format)
+	assert.Equal(t, "md", selected[1].Format)
+
+	// A post found by ScanLocalPosts is read from its file in the given format
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "20230101_100000_c.html"), []byte("<h1>C</h1>"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "20230101_100000_c.md"), []byte("# C"), 0644))
+	scanned, err := ScanLocalPosts(dir)
+	require.NoError(t, err)
+	selected, err = PreferredLocalPosts(scanned, "md")
+	require.NoError(t, err)
+	require.Len(t, selected, 1)
+	assert.Equal(t, "md", selected[0].Format)
+	assert.Equal(t, "# C", selected[0].Content)
+	assert.Equal(t, filepath.Join(dir, "20230101_100000_c.md"), selected[0].Path)
+}
+
+// Test converting downloaded posts between formats
+func TestConvertLocalPost(t *testing.T) {
+	tempDir := createLocalArchive(t)
+	defer os.RemoveAll(tempDir)
+
+	mdPost, err := LoadLocalPost(filepath.Join(tempDir, "20230101_100000_first-post.md"))
+	require.NoError(t, err)
+	txtPost, err := LoadLocalPost(filepath.Join(tempDir, "20230215_120000_second-post.txt"))
+	require.NoError(t, err)
+
+	t.Run("md to html", func(t *testing.T) {
+		path := ConvertedPath(mdPost, tempDir, "html")
+		assert.Equal(t, filepath.Join(tempDir, "20230101_100000_first-post.html"), path)
+		require.NoError(t, ConvertLocalPost(mdPost, "html", path))
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "<h1>First Post</h1>\n<p>The quick brown fox jumps over the lazy dog.</p>", string(content))
+
+		// The converted file is picked up as a post
+		converted, err := LoadLocalPost(path)
+		require.NoError(t, err)
+		assert.Equal(t, "first-post", converted.Slug)
+	})
+
+	t.Run("txt to html", func(t *testing.T) {
+		html := txtPost.HTML()
+		assert.True(t, strings.HasPrefix(html, "<h1>Second Post</h1>"))
+		assert.Contains(t, html, "<p>A post about climate policy and energy.</p>")
+	})
+
+	t.Run("txt to md", func(t *testing.T) {
+		path := filepath.Join(tempDir, "out", "second.md")
+		require.NoError(t, ConvertLocalPost(txtPost, "md", path))
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, txtPost.Content, string(content))
+	})
+
+	t.Run("md to epub", func(t *testing.T) {
+		path := ConvertedPath(mdPost, tempDir, "epub")
+		require.NoError(t, ConvertLocalPost(mdPost, "epub", path))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		names, contents := readZipEntries(t, data)
+		assert.Equal(t, "mimetype", names[0])
+		assert.Contains(t, contents["OEBPS/content.opf"], "<dc:title>First Post</dc:title>")
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		assert.Error(t, ConvertLocalPost(mdPost, "pdf", filepath.Join(tempDir, "x.pdf")))
+	})
+}
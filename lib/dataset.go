@@ -0,0 +1,135 @@
+package lib
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DatasetFormats are the supported formats of research datasets, chosen by file extension
+var DatasetFormats = []string{"jsonl", "csv"}
+
+// DatasetRecord is the record of one post in a research dataset. The schema is documented in the README
+// and fields are only ever added, so that existing pipelines keep working.
+type DatasetRecord struct {
+	ID         int      `json:"id"`   // Substack post ID, 0 if unknown
+	Slug       string   `json:"slug"` // unique within the publication
+	URL        string   `json:"url"`  // canonical URL of the post
+	Title      string   `json:"title"`
+	Subtitle   string   `json:"subtitle"`
+	Date       string   `json:"date"`     // publication date, RFC 3339
+	Audience   string   `json:"audience"` // "everyone", "only_paid"...
+	Tags       []string `json:"tags"`
+	WordCount  int      `json:"word_count"`  // as reported by Substack, or counted in Text
+	Reactions  int      `json:"reactions"`   // likes when the post was downloaded
+	Comments   int      `json:"comments"`    // comments when the post was downloaded
+	Restacks   int      `json:"restacks"`    // restacks when the post was downloaded
+	Text       string   `json:"text"`        // full plain text of the post
+	SourceFile string   `json:"source_file"` // downloaded file the text comes from
+}
+
+// datasetColumns are the CSV columns, in the order of DatasetRecord
+var datasetColumns = []string{"id", "slug", "url", "title", "subtitle", "date", "audience", "tags", "word_count", "reactions", "comments", "restacks", "text", "source_file"}
+
+// BuildDataset creates one record per downloaded post, in the order of posts, with the metadata
+// of the manifest. Posts downloaded in several formats are only included once.
+func BuildDataset(posts []LocalPost, manifest *Manifest) []DatasetRecord {
+	var records []DatasetRecord
+	seen := make(map[string]bool)
+	for _, post := range posts {
+		if seen[post.Slug] {
+			continue
+		}
+		seen[post.Slug] = true
+
+		text := strings.TrimSpace(post.PlainText())
+		record := DatasetRecord{
+			Slug:       post.Slug,
+			URL:        post.URL,
+			Title:      post.Title,
+			Subtitle:   post.Subtitle,
+			Tags:       post.Tags,
+			WordCount:  len(strings.Fields(text)),
+			Text:       text,
+			SourceFile: manifest.RelPath(post.Path),
+		}
+		if !post.Date.IsZero() {
+			record.Date = post.Date.Format(time.RFC3339)
+		}
+		if entry, ok := manifest.Entry(post.Slug); ok {
+			record.ID = entry.Id
+			record.Audience = entry.Audience
+			record.Reactions = entry.Reactions
+			record.Comments = entry.Comments
+			record.Restacks = entry.Restacks
+			if entry.WordCount > 0 {
+				record.WordCount = entry.WordCount
+			}
+		}
+		if record.Tags == nil {
+			record.Tags = []string{}
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// WriteDataset writes the records in the given format
+func WriteDataset(w io.Writer, records []DatasetRecord, format string) error {
+	switch format {
+	case "jsonl":
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write(datasetColumns); err != nil {
+			return err
+		}
+		for _, r := range records {
+			row := []string{
+				strconv.Itoa(r.ID), r.Slug, r.URL, r.Title, r.Subtitle, r.Date, r.Audience,
+				strings.Join(r.Tags, ";"), strconv.Itoa(r.WordCount), strconv.Itoa(r.Reactions),
+				strconv.Itoa(r.Comments), strconv.Itoa(r.Restacks), r.Text, r.SourceFile,
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("unknown dataset format: %s", format)
+	}
+}
+
+// ExportDataset writes the records of the posts to path, in the format of its extension
+func ExportDataset(posts []LocalPost, manifest *Manifest, path string) (int, error) {
+	format := strings.TrimPrefix(filepath.Ext(path), ".")
+	if !containsString(DatasetFormats, format) {
+		return 0, fmt.Errorf("unknown dataset format %q, use a .jsonl or .csv file", format)
+	}
+
+	records := BuildDataset(posts, manifest)
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("error creating dataset: %w", err)
+	}
+	defer file.Close()
+
+	if err := WriteDataset(file, records, format); err != nil {
+		return 0, fmt.Errorf("error writing dataset: %w", err)
+	}
+	return len(records), file.Close()
+}
@@ -0,0 +1,95 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test building a research dataset from downloaded posts
+func TestBuildDataset(t *testing.T) {
+	tempDir := createLocalArchive(t)
+	defer os.RemoveAll(tempDir)
+
+	// The same post downloaded in another format is only included once
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "20230215_120000_second-post.md"), []byte("# Second Post\n\nA post."), 0644))
+
+	manifest, err := LoadManifest(tempDir)
+	require.NoError(t, err)
+	post := createSamplePost()
+	post.Id = 42
+	post.Slug = "second-post"
+	post.Title = "Second Post"
+	post.CanonicalUrl = "https://example.substack.com/p/second-post"
+	post.PostDate = "2023-02-15T12:00:00Z"
+	post.Audience = "everyone"
+	post.ReactionCount = 12
+	post.CommentCount = 3
+	post.Restacks = 1
+	manifest.AddEntry(NewManifestEntry(post, map[string]string{"txt": "20230215_120000_second-post.txt"}, time.Now()))
+	require.NoError(t, manifest.Save())
+
+	posts, err := ScanLocalPosts(tempDir)
+	require.NoError(t, err)
+	records := BuildDataset(posts, manifest)
+	require.Len(t, records, 4)
+
+	var second DatasetRecord
+	for _, record := range records {
+		if record.Slug == "second-post" {
+			second = record
+		}
+	}
+	assert.Equal(t, 42, second.ID)
+	assert.Equal(t, "https://example.substack.com/p/second-post", second.URL)
+	assert.Equal(t, "2023-02-15T12:00:00Z", second.Date)
+	assert.Equal(t, "everyone", second.Audience)
+	assert.Equal(t, 12, second.Reactions)
+	assert.Equal(t, 3, second.Comments)
+	assert.Equal(t, 1, second.Restacks)
+	assert.Equal(t, []string{}, second.Tags)
+	assert.Contains(t, []string{"20230215_120000_second-post.txt", "20230215_120000_second-post.md"}, second.SourceFile)
+
+	t.Run("jsonl", func(t *testing.T) {
+		path := filepath.Join(tempDir, "dataset.jsonl")
+		n, err := ExportDataset(posts, manifest, path)
+		require.NoError(t, err)
+		assert.Equal(t, 4, n)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		require.Len(t, lines, 4)
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+		for _, column := range datasetColumns {
+			assert.Contains(t, record, column)
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteDataset(&buf, []DatasetRecord{{
+			Slug: "a", Tags: []string{"x", "y"}, WordCount: 2, Text: "Hello, \"world\"\nagain",
+		}}, "csv"))
+		rows, err := csv.NewReader(&buf).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, rows, 2)
+		assert.Equal(t, datasetColumns, rows[0])
+		assert.Equal(t, "x;y", rows[1][7])
+		assert.Equal(t, "Hello, \"world\"\nagain", rows[1][12])
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := ExportDataset(posts, manifest, filepath.Join(tempDir, "dataset.parquet"))
+		assert.ErrorContains(t, err, "unknown dataset format")
+	})
+}
@@ -0,0 +1,69 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// isGone reports whether err means that the page of a post doesn't exist anymore
+func isGone(err error) bool {
+	var fetchErr *FetchError
+	return errors.As(err, &fetchErr) && (fetchErr.StatusCode == http.StatusNotFound || fetchErr.StatusCode == http.StatusGone)
+}
+
+// DetectDeletedPosts compares the posts recorded in the manifest of the output directory with
+// the posts listed by the last call to ListPostURLs. A recorded post missing from the listing
+// is flagged as deleted if its page doesn't exist anymore; a deleted post listed again is
+// unflagged. Local copies are never removed. Nothing is done when the listing was filtered,
+// as posts left out by the filters aren't deleted. It returns the posts newly flagged as deleted.
+func (d *Downloader) DetectDeletedPosts(ctx context.Context) ([]ManifestEntry, error) {
+	if d.listed == nil {
+		return nil, nil
+	}
+	manifest, err := LoadManifest(d.opts.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := make(map[string]bool, len(d.listed))
+	for _, url := range d.listed {
+		listed[SlugFromURL(url)] = true
+	}
+
+	changed := false
+	var deleted []ManifestEntry
+	now := time.Now()
+	for _, entry := range manifest.Entries() {
+		if listed[entry.Slug] {
+			changed = manifest.MarkDeleted(entry.Slug, time.Time{}) || changed
+			continue
+		}
+		if entry.Deleted() || entry.URL == "" {
+			continue
+		}
+
+		// The sitemap may lag behind, only a missing page is proof of deletion
+		body, err := d.fetcher.FetchURL(ctx, entry.URL)
+		if err == nil {
+			body.Close()
+			continue
+		}
+		if ctx.Err() != nil {
+			return deleted, ctx.Err()
+		}
+		if isGone(err) && manifest.MarkDeleted(entry.Slug, now) {
+			changed = true
+			entry.DeletedAt = now.Format(time.RFC3339)
+			deleted = append(deleted, entry)
+		}
+	}
+
+	if changed {
+		if err := manifest.Save(); err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
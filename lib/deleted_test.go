@@ -0,0 +1,132 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test flagging the downloaded posts that were deleted or unpublished
+func TestDetectDeletedPosts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/p/online", "/p/unlisted":
+			w.Write([]byte("<html></html>"))
+		case "/p/broken":
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tempDir := t.TempDir()
+	manifest, err := LoadManifest(tempDir)
+	require.NoError(t, err)
+	for _, slug := range []string{"online", "restored", "gone", "unlisted", "broken"} {
+		path := filepath.Join(tempDir, "20230101_100000_"+slug+".html")
+		require.NoError(t, os.WriteFile(path, []byte("<h1>"+slug+"</h1>"), 0644))
+		manifest.AddEntry(ManifestEntry{Slug: slug, Title: slug, URL: server.URL + "/p/" + slug, Files: map[string]string{"html": manifest.RelPath(path)}})
+	}
+	manifest.MarkDeleted("restored", time.Now())
+	require.NoError(t, manifest.Save())
+
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = tempDir
+	fetcher := NewFetcher(WithBackOffConfig(backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 0)))
+	downloader := NewDownloader(fetcher, opts)
+	ctx := context.Background()
+
+	t.Run("filtered listing", func(t *testing.T) {
+		deleted, err := downloader.DetectDeletedPosts(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, deleted)
+	})
+
+	downloader.listed = []string{server.URL + "/p/online", server.URL + "/p/restored"}
+	deleted, err := downloader.DetectDeletedPosts(ctx)
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, "gone", deleted[0].Slug)
+	assert.True(t, deleted[0].Deleted())
+
+	manifest, err = LoadManifest(tempDir)
+	require.NoError(t, err)
+	for slug, expected := range map[string]bool{"online": false, "restored": false, "gone": true, "unlisted": false, "broken": false} {
+		entry, ok := manifest.Entry(slug)
+		require.True(t, ok)
+		assert.Equal(t, expected, entry.Deleted(), slug)
+	}
+	assert.FileExists(t, filepath.Join(tempDir, "20230101_100000_gone.html"))
+
+	t.Run("already flagged", func(t *testing.T) {
+		deleted, err := downloader.DetectDeletedPosts(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, deleted)
+	})
+
+	t.Run("downloaded again", func(t *testing.T) {
+		opts := opts
+		opts.SkipExisting = false
+		opts.CreateArchive = true
+		summary, err := NewDownloader(fetcher, opts).DownloadPosts(ctx, []string{server.URL + "/p/vanished", server.URL + "/p/gone"}, nil)
+		require.NoError(t, err)
+		// Only the posts downloaded before are deleted, the others failed
+		assert.Equal(t, 1, summary.Failed)
+		assert.Equal(t, 0, summary.Deleted)
+
+		archive, err := os.ReadFile(filepath.Join(tempDir, "index.html"))
+		require.NoError(t, err)
+		assert.Contains(t, string(archive), `<div class="post deleted">`)
+		assert.Contains(t, string(archive), "20230101_100000_gone.html")
+	})
+
+	t.Run("deleted while downloading", func(t *testing.T) {
+		manifest, err := LoadManifest(tempDir)
+		require.NoError(t, err)
+		manifest.AddEntry(ManifestEntry{Slug: "removed", URL: server.URL + "/p/removed"})
+		require.NoError(t, manifest.Save())
+
+		summary, err := NewDownloader(fetcher, opts).DownloadPosts(ctx, []string{server.URL + "/p/removed"}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 0, summary.Failed)
+		assert.Equal(t, 1, summary.Deleted)
+
+		manifest, err = LoadManifest(tempDir)
+		require.NoError(t, err)
+		entry, _ := manifest.Entry("removed")
+		assert.True(t, entry.Deleted())
+		for _, failure := range manifest.Failures {
+			assert.NotEqual(t, "removed", failure.Slug)
+		}
+	})
+}
+
+func TestArchiveDeletedEntries(t *testing.T) {
+	tempDir := t.TempDir()
+	archive := NewArchive()
+	archive.AddEntry(Post{Title: "Online", PostDate: "2023-01-02T10:00:00Z"}, filepath.Join(tempDir, "online.md"), time.Now())
+	archive.AddDeletedEntry(Post{Title: "Gone", PostDate: "2023-01-01T10:00:00Z"}, filepath.Join(tempDir, "gone.md"), time.Now())
+	require.Len(t, archive.Entries, 2)
+	assert.False(t, archive.Entries[0].Deleted)
+	assert.True(t, archive.Entries[1].Deleted)
+
+	require.NoError(t, archive.GenerateMarkdown(tempDir))
+	content, err := os.ReadFile(filepath.Join(tempDir, "index.md"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(content), "**Deleted from Substack**"))
+
+	require.NoError(t, archive.GenerateText(tempDir))
+	content, err = os.ReadFile(filepath.Join(tempDir, "index.txt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "Status: deleted from Substack")
+}
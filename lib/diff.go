@@ -0,0 +1,261 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DiffStatus is the outcome of comparing a downloaded post with the live site
+type DiffStatus string
+
+const (
+	DiffUnchanged DiffStatus = "unchanged"
+	DiffChanged   DiffStatus = "changed"
+	DiffRemoved   DiffStatus = "removed"
+	DiffError     DiffStatus = "error"
+)
+
+// diffContext is the number of unchanged paragraphs shown around each change
+const diffContext = 2
+
+// PostDiff reports the differences between a downloaded post and its live version
+type PostDiff struct {
+	Slug    string     `json:"slug"`
+	URL     string     `json:"url"`
+	Title   string     `json:"title"`
+	Path    string     `json:"path"`
+	Status  DiffStatus `json:"status"`
+	Added   int        `json:"added_paragraphs"`
+	Removed int        `json:"removed_paragraphs"`
+	Diff    string     `json:"-"`
+	Err     error      `json:"-"`
+}
+
+// DiffLocalPosts fetches the live version of downloaded posts and compares their text.
+// Posts without a URL are reported as errors. onResult, if not nil, is called as each
+// post is compared; the results are returned in the order of the posts.
+func DiffLocalPosts(ctx context.Context, e *Extractor, posts []LocalPost, onResult func(PostDiff)) ([]PostDiff, error) {
+	results := make([]PostDiff, len(posts))
+	byURL := make(map[string][]int)
+	var urls []string
+	for i, post := range posts {
+		if post.URL == "" {
+			results[i] = PostDiff{Slug: post.Slug, Title: post.Title, Path: post.Path, Status: DiffError, Err: fmt.Errorf("unknown URL for post %s", post.Slug)}
+			if onResult != nil {
+				onResult(results[i])
+			}
+			continue
+		}
+		if _, ok := byURL[post.URL]; !ok {
+			urls = append(urls, post.URL)
+		}
+		byURL[post.URL] = append(byURL[post.URL], i)
+	}
+
+	for result := range e.ExtractAllPosts(ctx, urls) {
+		for _, i := range byURL[result.URL] {
+			if result.Err != nil {
+				results[i] = diffFetchError(posts[i], result.Err)
+			} else {
+				results[i] = ComparePostContent(posts[i], result.Post)
+			}
+			if onResult != nil {
+				onResult(results[i])
+			}
+		}
+	}
+
+	return results, ctx.Err()
+}
+
+// diffFetchError reports a post that couldn't be fetched; posts that are gone from the site are removed
+func diffFetchError(post LocalPost, err error) PostDiff {
+	diff := PostDiff{Slug: post.Slug, URL: post.URL, Title: post.Title, Path: post.Path, Status: DiffError, Err: err}
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) && (fetchErr.StatusCode == http.StatusNotFound || fetchErr.StatusCode == http.StatusGone) {
+		diff.Status = DiffRemoved
+		diff.Err = nil
+	}
+	return diff
+}
+
+// ComparePostContent compares the text of a downloaded post with the live post.
+// A post whose canonical text has the hash recorded in the manifest is unchanged, whatever
+// was done to its file since. Otherwise the live post is rendered in the format of the
+// downloaded file, and their canonical texts are compared so markup differences don't show
+// up as edits.
+func ComparePostContent(local LocalPost, live Post) PostDiff {
+	diff := PostDiff{Slug: local.Slug, URL: local.URL, Title: local.Title, Path: local.Path, Status: DiffUnchanged}
+	if diff.URL == "" {
+		diff.URL = live.CanonicalUrl
+	}
+	if local.TextHash != "" && local.TextHash == live.TextHash() {
+		return diff
+	}
+
+	content, err := live.contentForFormat(local.Format, true)
+	if err != nil {
+		diff.Status = DiffError
+		diff.Err = err
+		return diff
+	}
+	liveCopy := LocalPost{Format: local.Format, Content: content}
+
+	before := canonicalParagraphs(local.CanonicalText())
+	after := canonicalParagraphs(liveCopy.CanonicalText())
+	ops := diffParagraphs(before, after)
+	for _, op := range ops {
+		switch op.Kind {
+		case '-':
+			diff.Removed++
+		case '+':
+			diff.Added++
+		}
+	}
+
+	if diff.Added > 0 || diff.Removed > 0 {
+		diff.Status = DiffChanged
+		diff.Diff = formatUnifiedDiff(ops, "local/"+local.Slug, "live/"+local.Slug)
+	}
+	return diff
+}
+
+// canonicalParagraphs splits a canonical text into its paragraphs
+func canonicalParagraphs(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n\n")
+}
+
+// diffOp is a paragraph of a diff: ' ' unchanged, '-' removed, '+' added
+type diffOp struct {
+	Kind byte
+	Text string
+}
+
+// diffParagraphs computes the shortest edit turning a into b, from their longest common subsequence
+func diffParagraphs(a, b []string) []diffOp {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// formatUnifiedDiff writes a diff in the unified format, with one paragraph per line
+func formatUnifiedDiff(ops []diffOp, fromName, toName string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+
+	for start := 0; start < len(ops); {
+		// Find the next change and the extent of its hunk
+		first := start
+		for first < len(ops) && ops[first].Kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		hunkStart := max(first-diffContext, start)
+		end := first
+		for unchanged := 0; end < len(ops) && unchanged <= 2*diffContext; end++ {
+			if ops[end].Kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		// Trim the trailing context to diffContext paragraphs
+		hunkEnd := end
+		for hunkEnd > first && ops[hunkEnd-1].Kind == ' ' {
+			hunkEnd--
+		}
+		hunkEnd = min(hunkEnd+diffContext, len(ops))
+
+		// Line numbers of the hunk in both versions
+		fromLine, toLine := 1, 1
+		for _, op := range ops[:hunkStart] {
+			if op.Kind != '+' {
+				fromLine++
+			}
+			if op.Kind != '-' {
+				toLine++
+			}
+		}
+		fromCount, toCount := 0, 0
+		for _, op := range ops[hunkStart:hunkEnd] {
+			if op.Kind != '+' {
+				fromCount++
+			}
+			if op.Kind != '-' {
+				toCount++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(fromLine, fromCount), hunkRange(toLine, toCount))
+		for _, op := range ops[hunkStart:hunkEnd] {
+			sb.WriteByte(op.Kind)
+			sb.WriteString(op.Text)
+			sb.WriteByte('\n')
+		}
+		start = hunkEnd
+	}
+	return sb.String()
+}
+
+// hunkRange formats the range of a hunk header; empty ranges start at the line before
+func hunkRange(line, count int) string {
+	if count == 0 {
+		line--
+	}
+	if count == 1 {
+		return fmt.Sprint(line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+// max returns the larger of two integers
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,127 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test computing paragraph diffs
+func TestDiffParagraphs(t *testing.T) {
+	a := []string{"one", "two", "three", "four", "five", "six", "seven", "eight", "nine"}
+	b := []string{"one", "two", "3", "four", "five", "six", "seven", "eight", "nine", "ten"}
+
+	ops := diffParagraphs(a, b)
+	var removed, added []string
+	for _, op := range ops {
+		switch op.Kind {
+		case '-':
+			removed = append(removed, op.Text)
+		case '+':
+			added = append(added, op.Text)
+		}
+	}
+	assert.Equal(t, []string{"three"}, removed)
+	assert.Equal(t, []string{"3", "ten"}, added)
+
+	assert.Equal(t, `--- local/post
++++ live/post
+@@ -1,5 +1,5 @@
+ one
+ two
+-three
++3
+ four
+ five
+@@ -8,2 +8,3 @@
+ eight
+ nine
++ten
+`, formatUnifiedDiff(ops, "local/post", "live/post"))
+
+	// Nearby changes share a hunk
+	ops = diffParagraphs([]string{"a", "b", "c", "d"}, []string{"a", "x", "c", "y"})
+	assert.Equal(t, "--- a\n+++ b\n@@ -1,4 +1,4 @@\n a\n-b\n+x\n c\n-d\n+y\n", formatUnifiedDiff(ops, "a", "b"))
+
+	// Content removed entirely
+	ops = diffParagraphs([]string{"a"}, nil)
+	assert.Equal(t, "--- a\n+++ b\n@@ -1 +0,0 @@\n-a\n", formatUnifiedDiff(ops, "a", "b"))
+
+	assert.Empty(t, diffParagraphs(nil, nil))
+}
+
+// Test comparing a downloaded post with its live version
+func TestComparePostContent(t *testing.T) {
+	local := LocalPost{
+		Slug:    "my-post",
+		Format:  "md",
+		URL:     "https://example.substack.com/p/my-post",
+		Content: "# My Post\n\nFirst paragraph.\n\nSecond   paragraph.\n\noriginal content: https://example.substack.com/p/my-post",
+	}
+
+	live := Post{Title: "My Post", BodyHTML: "<p>First paragraph.</p><p>Second paragraph.</p>"}
+	diff := ComparePostContent(local, live)
+	assert.Equal(t, DiffUnchanged, diff.Status)
+	assert.Empty(t, diff.Diff)
+
+	live.BodyHTML = "<p>First paragraph, edited.</p><p>Second paragraph.</p><p>Third paragraph.</p>"
+	diff = ComparePostContent(local, live)
+	assert.Equal(t, DiffChanged, diff.Status)
+	assert.Equal(t, 2, diff.Added)
+	assert.Equal(t, 1, diff.Removed)
+	assert.Contains(t, diff.Diff, "-First paragraph.\n+First paragraph, edited.\n")
+
+	// Links changing their URL only aren't edits
+	local.Content = "# My Post\n\nFirst [paragraph](https://example.com/?utm_source=a)."
+	live.BodyHTML = `<p class="edited">First <a href="https://example.com/">paragraph</a>.</p>`
+	assert.Equal(t, DiffUnchanged, ComparePostContent(local, live).Status)
+
+	// A post with the text hash recorded when it was downloaded is unchanged, even if its file
+	// was transformed since
+	local.Content = "# Transformed"
+	local.TextHash = live.TextHash()
+	assert.Equal(t, DiffUnchanged, ComparePostContent(local, live).Status)
+	local.TextHash = "other"
+	assert.Equal(t, DiffChanged, ComparePostContent(local, live).Status)
+
+	local.TextHash = ""
+	local.Format = "doc"
+	assert.Equal(t, DiffError, ComparePostContent(local, live).Status)
+}
+
+// Test reporting removed posts and posts without URL
+func TestDiffLocalPosts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/p/forbidden" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	posts := []LocalPost{
+		{Slug: "gone", URL: server.URL + "/p/gone", Format: "txt"},
+		{Slug: "no-url", Format: "txt"},
+		{Slug: "forbidden", URL: server.URL + "/p/forbidden", Format: "txt"},
+	}
+
+	var called int
+	results, err := DiffLocalPosts(context.Background(), NewExtractor(NewFetcher()), posts, func(PostDiff) { called++ })
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, 3, called)
+
+	assert.Equal(t, "gone", results[0].Slug)
+	assert.Equal(t, DiffRemoved, results[0].Status)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, DiffError, results[1].Status)
+	assert.Equal(t, fmt.Sprintf("unknown URL for post %s", "no-url"), results[1].Err.Error())
+	assert.Equal(t, DiffError, results[2].Status)
+	assert.Error(t, results[2].Err)
+}
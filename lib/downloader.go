@@ -0,0 +1,1189 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DownloadOptions configures how posts are downloaded and written to disk
+type DownloadOptions struct {
+	OutputDir         string
+	Format            string // output format, or comma-separated formats written from a single fetch, e.g. "html,md"
+	AddSourceURL      bool
+	EmailLayout       bool // lay posts out as in the emails sent to subscribers, see EmailLayoutHTML
+	AccessibleText    bool // announce the images of txt output by their alt text and list them at the end
+	DownloadImages    bool
+	ImageQuality      ImageQuality
+	ImageSizes        []int // also download the images at these widths, listed in their srcset
+	StripImageMeta    bool  // remove the EXIF and other metadata of the downloaded images
+	OptimizeImages    bool  // losslessly recompress the downloaded PNG images
+	ImagesDir         string
+	DownloadFiles     bool
+	FileExtensions    []string
+	ExcludeExtensions []string // extensions of the attachments never downloaded
+	FileMaxSize       int64    // attachments larger than this many bytes are not downloaded, 0 for no limit
+	MaxFilesPerPost   int      // at most this many attachments are downloaded per post, 0 for no limit
+	FilesDir          string
+	ImageErrors       ImageErrors // what happens to a post whose media fail, ImageErrorsWarn if empty
+	MediaTemplate     string      // naming template of the downloaded images and files, DefaultMediaTemplate if empty
+	OriginalFilenames bool        // name attachments after the filename they were uploaded with
+	CreateArchive     bool
+	ArchiveHeatmap    bool         // show a calendar of the posting days on the HTML archive page
+	ReadingOrder      ReadingOrder // order of the posts on the archive page, newest first if empty
+	RelatedPosts      int          // list up to this many related posts at the end of each HTML post, 0 for none
+	Comments          bool         // also save the comments of each post in a .comments.json file next to it
+	CommentsFormat    string       // with Comments, also write them as a threaded .comments.{format} file, see ParseCommentsFormat
+	KeepRaw           bool         // also save the data embedded in the page of each post in a .raw.json file next to it
+	RawHTML           bool         // also save the body HTML of each post as extracted in a .raw.html file next to it
+	Mirror            bool         // write posts to {host}/p/{slug}/index.{format} with relative links between them
+	ByAuthor          bool         // write posts to {author}/{year}/{slug}.{format}, grouped by author on the archive page
+	KeepVersions      bool         // keep the previous content of a post written again as {name}.v{n}.{format}
+	DownloadAudio     bool         // download the narration of posts into AudioDir and link it at their top
+	AudioDir          string
+	SkipExisting      bool
+	UpdateChanged     bool // with SkipExisting, also download again the posts edited since they were downloaded
+	Resume            bool // download the posts left pending by the last run, if any, instead of listing the publication again
+	DateFilter        DateFilterFunc
+	Sections          []string          // only download posts of these sections (slug or name)
+	Authors           []string          // only download posts credited to these authors (handle or name)
+	Series            []string          // only download posts of these series (name or slug), detected from the titles
+	PostDelay         time.Duration     // if set, posts are fetched one at a time with this pause between them
+	ImageWorkers      int               // number of images of a post downloaded at once, 1 if 0
+	FileWorkers       int               // number of attachments of a post downloaded at once, 1 if 0
+	MaxDuration       time.Duration     // stop the run cleanly once it has lasted this long, 0 for no limit
+	MaxBytes          int64             // stop the run cleanly once this many bytes have been downloaded, 0 for no limit
+	MaxRequests       int               // stop the run cleanly once this many requests have been made, 0 for no limit
+	Limit             int               // download at most this many posts of a publication per run, 0 for no limit
+	MaxFailures       int               // abort the run once this many posts failed, 0 to always go on
+	PostProcessors    []PostProcessor   // run after each post is written
+	Transformers      []PostTransformer // change the content of each post before it is written
+	OnImage           ImageProgressFunc // called as each image of a post completes
+	OnProgress        ProgressFunc      // called with the progress events of the run, see JSONProgress
+	Cache             *PostCache        // if set, posts are stored in it and read from it while unchanged
+}
+
+// DefaultDownloadOptions returns the options used by the download command when no flags are given
+func DefaultDownloadOptions() DownloadOptions {
+	return DownloadOptions{
+		OutputDir:    ".",
+		Format:       "html",
+		ImageQuality: ImageQualityHigh,
+		ImagesDir:    "images",
+		FilesDir:     "files",
+		AudioDir:     "audio",
+		SkipExisting: true,
+	}
+}
+
+// DownloadFormats are the formats posts can be written in. In the json format, each post is
+// written as a JSON document holding the extracted post and its Markdown, see PostDocument,
+// and in the jsonl format these documents are appended to a single file, see JSONLFile.
+var DownloadFormats = []string{"html", "md", "txt", "json", "jsonl"}
+
+// ParseFormats parses a comma-separated list of output formats, e.g. "html,md"
+func ParseFormats(s string) ([]string, error) {
+	formats := splitFormats(s)
+	for _, format := range formats {
+		if !containsString(DownloadFormats, format) {
+			return nil, fmt.Errorf("invalid format: %s (valid: %s)", format, strings.Join(DownloadFormats, ", "))
+		}
+	}
+	return formats, nil
+}
+
+// splitFormats splits a comma-separated list of formats, without duplicates. The list is
+// never empty, html being the default format.
+func splitFormats(s string) []string {
+	var formats []string
+	for _, format := range strings.Split(s, ",") {
+		format = strings.ToLower(strings.TrimSpace(format))
+		if format != "" && !containsString(formats, format) {
+			formats = append(formats, format)
+		}
+	}
+	if len(formats) == 0 {
+		return []string{"html"}
+	}
+	return formats
+}
+
+// Formats returns the output formats of the options. The first one is the format of the
+// archive page and of the path reported for each post.
+func (o DownloadOptions) Formats() []string {
+	return splitFormats(o.Format)
+}
+
+// ManifestOptions returns the options recorded in the manifest with the posts that fail to download
+func (o DownloadOptions) ManifestOptions() ManifestOptions {
+	return ManifestOptions{
+		Format:            o.Format,
+		AddSourceURL:      o.AddSourceURL,
+		EmailLayout:       o.EmailLayout,
+		AccessibleText:    o.AccessibleText,
+		DownloadImages:    o.DownloadImages,
+		ImageQuality:      o.ImageQuality,
+		ImageSizes:        o.ImageSizes,
+		StripImageMeta:    o.StripImageMeta,
+		OptimizeImages:    o.OptimizeImages,
+		ImagesDir:         o.ImagesDir,
+		DownloadFiles:     o.DownloadFiles,
+		FileExtensions:    o.FileExtensions,
+		ExcludeExtensions: o.ExcludeExtensions,
+		FileMaxSize:       o.FileMaxSize,
+		MaxFilesPerPost:   o.MaxFilesPerPost,
+		FilesDir:          o.FilesDir,
+		ImageErrors:       o.ImageErrors,
+		MediaTemplate:     o.MediaTemplate,
+		OriginalFilenames: o.OriginalFilenames,
+		CreateArchive:     o.CreateArchive,
+		ArchiveHeatmap:    o.ArchiveHeatmap,
+		ReadingOrder:      o.ReadingOrder,
+		RelatedPosts:      o.RelatedPosts,
+		Comments:          o.Comments,
+		CommentsFormat:    o.CommentsFormat,
+		KeepRaw:           o.KeepRaw,
+		RawHTML:           o.RawHTML,
+		Mirror:            o.Mirror,
+		ByAuthor:          o.ByAuthor,
+		KeepVersions:      o.KeepVersions,
+		DownloadAudio:     o.DownloadAudio,
+		AudioDir:          o.AudioDir,
+		ExecAfter:         o.ExecAfter(),
+		Transform:         o.TransformCommands(),
+		IgnoreSelectors:   o.IgnoreSelectors(),
+		PaywallMarker:     o.MarksPaywall(),
+		Redact:            o.Redacts(),
+	}
+}
+
+// MediaNaming returns the naming of the images and files downloaded with the options
+func (o DownloadOptions) MediaNaming() (MediaNaming, error) {
+	naming := MediaNaming{OriginalNames: o.OriginalFilenames}
+	if o.MediaTemplate != "" {
+		tmpl, err := ParseMediaTemplate(o.MediaTemplate)
+		if err != nil {
+			return naming, err
+		}
+		naming.Template = tmpl
+	}
+	return naming, nil
+}
+
+// ImageProcessing returns the processing of the images downloaded with the options
+func (o DownloadOptions) ImageProcessing() ImageProcessing {
+	return ImageProcessing{StripMetadata: o.StripImageMeta, Optimize: o.OptimizeImages}
+}
+
+// AttachmentLimits returns the limits of the attachments downloaded with the options
+func (o DownloadOptions) AttachmentLimits() AttachmentLimits {
+	return AttachmentLimits{ExcludeExtensions: o.ExcludeExtensions, MaxSize: o.FileMaxSize, MaxPerPost: o.MaxFilesPerPost}
+}
+
+// MediaWorkers returns the number of images and attachments of a post downloaded at once with the options
+func (o DownloadOptions) MediaWorkers() MediaWorkers {
+	return MediaWorkers{Images: o.ImageWorkers, Files: o.FileWorkers}
+}
+
+// Redacts reports whether the options include a Redactor
+func (o DownloadOptions) Redacts() bool {
+	for _, t := range o.Transformers {
+		if _, ok := t.(Redactor); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MarksPaywall reports whether the options include a PaywallMarker
+func (o DownloadOptions) MarksPaywall() bool {
+	for _, t := range o.Transformers {
+		if _, ok := t.(PaywallMarker); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// IgnoreSelectors returns the selectors of the SelectorRemovers of the options
+func (o DownloadOptions) IgnoreSelectors() []string {
+	var selectors []string
+	for _, t := range o.Transformers {
+		if remover, ok := t.(*SelectorRemover); ok {
+			selectors = append(selectors, remover.Selectors...)
+		}
+	}
+	return selectors
+}
+
+// TransformCommands returns the commands of the ExecTransformers of the options
+func (o DownloadOptions) TransformCommands() []string {
+	var commands []string
+	for _, t := range o.Transformers {
+		if exec, ok := t.(*ExecTransformer); ok {
+			commands = append(commands, exec.Command)
+		}
+	}
+	return commands
+}
+
+// ExecAfter returns the commands of the ExecPostProcessors of the options
+func (o DownloadOptions) ExecAfter() []string {
+	var commands []string
+	for _, p := range o.PostProcessors {
+		if exec, ok := p.(*ExecPostProcessor); ok {
+			commands = append(commands, exec.Command)
+		}
+	}
+	return commands
+}
+
+// DownloadOptions returns the options to retry a failed post in outputDir the way it was first downloaded.
+// Existing files are overwritten.
+func (o ManifestOptions) DownloadOptions(outputDir string) DownloadOptions {
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = outputDir
+	opts.Format = o.Format
+	opts.AddSourceURL = o.AddSourceURL
+	opts.EmailLayout = o.EmailLayout
+	opts.AccessibleText = o.AccessibleText
+	opts.DownloadImages = o.DownloadImages
+	if o.ImageQuality != "" {
+		opts.ImageQuality = o.ImageQuality
+	}
+	opts.ImageSizes = o.ImageSizes
+	opts.StripImageMeta = o.StripImageMeta
+	opts.OptimizeImages = o.OptimizeImages
+	if o.ImagesDir != "" {
+		opts.ImagesDir = o.ImagesDir
+	}
+	opts.DownloadFiles = o.DownloadFiles
+	opts.FileExtensions = o.FileExtensions
+	opts.ExcludeExtensions = o.ExcludeExtensions
+	opts.FileMaxSize = o.FileMaxSize
+	opts.MaxFilesPerPost = o.MaxFilesPerPost
+	if o.FilesDir != "" {
+		opts.FilesDir = o.FilesDir
+	}
+	opts.ImageErrors = o.ImageErrors
+	opts.MediaTemplate = o.MediaTemplate
+	opts.OriginalFilenames = o.OriginalFilenames
+	opts.CreateArchive = o.CreateArchive
+	opts.ArchiveHeatmap = o.ArchiveHeatmap
+	opts.ReadingOrder = o.ReadingOrder
+	opts.RelatedPosts = o.RelatedPosts
+	opts.Comments = o.Comments
+	opts.CommentsFormat = o.CommentsFormat
+	opts.KeepRaw = o.KeepRaw
+	opts.RawHTML = o.RawHTML
+	opts.Mirror = o.Mirror
+	opts.ByAuthor = o.ByAuthor
+	opts.KeepVersions = o.KeepVersions
+	opts.DownloadAudio = o.DownloadAudio
+	if o.AudioDir != "" {
+		opts.AudioDir = o.AudioDir
+	}
+	for _, command := range o.ExecAfter {
+		opts.PostProcessors = append(opts.PostProcessors, NewExecPostProcessor(command))
+	}
+	if len(o.IgnoreSelectors) > 0 {
+		opts.Transformers = append(opts.Transformers, &SelectorRemover{Selectors: o.IgnoreSelectors})
+	}
+	if o.PaywallMarker {
+		opts.Transformers = append(opts.Transformers, PaywallMarker{})
+	}
+	for _, command := range o.Transform {
+		opts.Transformers = append(opts.Transformers, NewExecTransformer(command))
+	}
+	if o.Redact {
+		opts.Transformers = append(opts.Transformers, Redactor{})
+	}
+	opts.SkipExisting = false
+	return opts
+}
+
+// PostResult is the outcome of downloading and writing a single post
+type PostResult struct {
+	URL    string
+	Post   Post
+	Path   string            // path of the post in the first format
+	Files  map[string]string // paths of the post by format
+	Images *ImageDownloadResult
+	Err    error
+
+	// PreviousSlug is the slug a renamed post was downloaded under, its files being kept
+	PreviousSlug string
+}
+
+// DownloadSummary aggregates the results of a download run
+type DownloadSummary struct {
+	Found        int           `json:"found"`
+	Skipped      int           `json:"skipped"`
+	Downloaded   int           `json:"downloaded"`
+	Failed       int           `json:"failed"`
+	ImagesOK     int           `json:"images_ok"`
+	ImagesFailed int           `json:"images_failed"`
+	ImageBytes   int64         `json:"image_bytes"`
+	Duration     time.Duration `json:"duration_ns"`
+	Stopped      string        `json:"stopped,omitempty"` // why the run stopped early, if a budget was exceeded
+	Incomplete   int           `json:"incomplete"`        // posts written with far fewer words than Substack reports
+	Deleted      int           `json:"deleted"`           // downloaded posts found deleted or unpublished
+	Renamed      int           `json:"renamed"`           // downloaded posts found under a new slug, not downloaded again
+}
+
+// ErrTooManyFailures is returned by DownloadPosts when it aborts after MaxFailures failed posts
+var ErrTooManyFailures = errors.New("too many failed posts")
+
+// Downloader downloads posts and writes them to disk along with the manifest and archive page
+type Downloader struct {
+	fetcher   *Fetcher
+	extractor *Extractor
+	opts      DownloadOptions
+	lastMods  map[string]time.Time // last modification of the posts listed by ListPostURLs
+	listed    []string             // all the posts listed by ListPostURLs, nil if filtered
+}
+
+// NewDownloader creates a new Downloader with the provided Fetcher and options.
+// If the Fetcher is nil, a default Fetcher will be used.
+func NewDownloader(f *Fetcher, opts DownloadOptions) *Downloader {
+	if f == nil {
+		f = NewFetcher()
+	}
+	if opts.OutputDir == "" {
+		opts.OutputDir = "."
+	}
+	if opts.Format == "" {
+		opts.Format = "html"
+	}
+	return &Downloader{
+		fetcher:   f,
+		extractor: NewExtractor(f),
+		opts:      opts,
+		lastMods:  make(map[string]time.Time),
+	}
+}
+
+// Options returns the options of the Downloader
+func (d *Downloader) Options() DownloadOptions {
+	return d.opts
+}
+
+// ListPostURLs returns all the post URLs of a publication matching the filters,
+// and the subset still to be downloaded (all of them unless SkipExisting is set),
+// cut to the first Limit posts. With UpdateChanged, the posts listed with a last
+// modification after the one recorded in the manifest are downloaded again. With Resume,
+// the posts left pending by an interrupted run are returned instead, when there are any.
+// Section, author and series filters rely on the archive API, as the sitemap doesn't have this metadata.
+func (d *Downloader) ListPostURLs(ctx context.Context, pubURL string) ([]string, []string, error) {
+	if d.opts.Resume {
+		manifest, err := LoadManifest(d.opts.OutputDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		if pending := manifest.PendingURLs(); len(pending) > 0 {
+			// the publication isn't listed, so deleted posts can't be told apart
+			d.listed = nil
+			return pending, d.limit(pending), nil
+		}
+	}
+
+	var urls []string
+	filtered := len(d.opts.Sections) > 0 || len(d.opts.Authors) > 0 || len(d.opts.Series) > 0
+	if filtered {
+		posts, err := d.extractor.GetArchivePosts(ctx, pubURL, d.opts.DateFilter)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(d.opts.Series) > 0 {
+			posts = FilterSeries(posts, d.opts.Series)
+		}
+		for _, post := range posts {
+			if MatchesPostFilters(post, d.opts.Sections, d.opts.Authors) {
+				urls = append(urls, post.CanonicalUrl)
+				d.lastMods[post.CanonicalUrl] = postLastMod(post)
+			}
+		}
+	} else {
+		entries, err := d.extractor.GetSitemapPosts(ctx, pubURL, d.opts.DateFilter)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, entry := range entries {
+			urls = append(urls, entry.URL)
+			if !entry.LastMod.IsZero() {
+				d.lastMods[entry.URL] = entry.LastMod
+			}
+		}
+	}
+
+	d.listed = nil
+	if len(urls) > 0 && !filtered && d.opts.DateFilter == nil {
+		d.listed = urls
+	}
+
+	if !d.opts.SkipExisting {
+		return urls, d.limit(urls), nil
+	}
+
+	// A post is pending while one of its formats is missing. The manifest knows the files of
+	// renamed posts, named after their previous slug.
+	manifest, err := LoadManifest(d.opts.OutputDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	missing := make(map[string]bool)
+	for _, format := range d.opts.Formats() {
+		var formatPending []string
+		var err error
+		switch {
+		case d.opts.Mirror:
+			formatPending = FilterExistingMirrorPosts(urls, d.opts.OutputDir, format)
+		case d.opts.ByAuthor:
+			formatPending, err = FilterExistingAuthorPosts(urls, d.opts.OutputDir, format)
+		default:
+			formatPending, err = FilterExistingPosts(urls, d.opts.OutputDir, format)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to find the downloaded posts: %w", err)
+		}
+		for _, url := range formatPending {
+			if !manifest.hasFile(SlugFromURL(url), format) {
+				missing[url] = true
+			}
+		}
+	}
+	if d.opts.UpdateChanged {
+		for _, url := range urls {
+			if !missing[url] && d.changedSinceDownload(manifest, url) {
+				missing[url] = true
+			}
+		}
+	}
+	var pending []string
+	for _, url := range urls {
+		if missing[url] {
+			pending = append(pending, url)
+		}
+	}
+	return urls, d.limit(pending), nil
+}
+
+// changedSinceDownload reports whether the post at url was edited after the version recorded
+// in the manifest, according to the last modification listed by ListPostURLs
+func (d *Downloader) changedSinceDownload(manifest *Manifest, url string) bool {
+	lastMod, ok := d.lastMods[url]
+	if !ok {
+		return false
+	}
+	entry, ok := manifest.Entry(SlugFromURL(url))
+	if !ok {
+		return false
+	}
+	recorded := postLastMod(entry.Post())
+	return !recorded.IsZero() && lastMod.After(recorded)
+}
+
+// limit returns the first Limit posts to download, the others being left for the next runs
+func (d *Downloader) limit(pending []string) []string {
+	if d.opts.Limit > 0 && len(pending) > d.opts.Limit {
+		return pending[:d.opts.Limit]
+	}
+	return pending
+}
+
+// DownloadPublication downloads every post of a publication not downloaded yet.
+// onResult, if not nil, is called after each post is processed.
+func (d *Downloader) DownloadPublication(ctx context.Context, pubURL string, onResult func(PostResult)) (*DownloadSummary, error) {
+	start := time.Now()
+
+	all, pending, err := d.ListPostURLs(ctx, pubURL)
+	if err != nil {
+		return &DownloadSummary{}, err
+	}
+	deleted, err := d.DetectDeletedPosts(ctx)
+	if err != nil {
+		return &DownloadSummary{}, err
+	}
+	if d.opts.CreateArchive && len(pending) > 0 {
+		// The logo only decorates the archive page, which is still generated without it
+		DownloadPublicationLogo(ctx, d.fetcher, pubURL, d.opts.OutputDir)
+	}
+
+	summary, err := d.DownloadPosts(ctx, pending, onResult)
+	summary.Deleted += len(deleted)
+	summary.Found = len(all)
+	summary.Skipped = len(all) - len(pending)
+	summary.Duration = time.Since(start)
+	return summary, err
+}
+
+// DownloadPosts downloads and writes the posts at the given URLs, then updates the manifest
+// and, if enabled, the archive page. onResult, if not nil, is called after each post is processed.
+func (d *Downloader) DownloadPosts(ctx context.Context, urls []string, onResult func(PostResult)) (*DownloadSummary, error) {
+	d.progress(ProgressEvent{Event: ProgressRunStarted, Total: len(urls)})
+	summary, err := d.downloadPosts(ctx, urls, onResult)
+	finished := ProgressEvent{Event: ProgressRunFinished, Total: len(urls), Summary: summary}
+	if err != nil {
+		finished.Error = err.Error()
+	}
+	d.progress(finished)
+	return summary, err
+}
+
+// downloadPosts implements DownloadPosts, without reporting the start and end of the run
+func (d *Downloader) downloadPosts(ctx context.Context, urls []string, onResult func(PostResult)) (*DownloadSummary, error) {
+	start := time.Now()
+	summary := &DownloadSummary{Found: len(urls)}
+
+	if len(urls) == 0 {
+		return summary, nil
+	}
+
+	manifest, err := LoadManifest(d.opts.OutputDir)
+	if err != nil {
+		return summary, err
+	}
+	// The posts of the run are recorded before any is downloaded, so that a run killed
+	// before saving the manifest can still be resumed
+	manifest.SetPending(urls)
+	if err := manifest.Save(); err != nil {
+		return summary, fmt.Errorf("error saving manifest: %w", err)
+	}
+
+	var archive *Archive
+	if d.opts.CreateArchive {
+		archive = d.newArchive()
+	}
+
+	// runCtx stops the extraction of the remaining posts when a budget is exceeded,
+	// while the post being written goes on with ctx
+	var runCtx context.Context
+	var stop context.CancelFunc
+	if d.opts.MaxDuration > 0 {
+		runCtx, stop = context.WithTimeout(ctx, d.opts.MaxDuration)
+	} else {
+		runCtx, stop = context.WithCancel(ctx)
+	}
+	defer stop()
+	startBytes := d.fetcher.BytesRead()
+	startRequests := d.fetcher.Stats().Requests
+	var abortErr error
+	done := 0
+
+	for result := range d.extract(d.progressContext(runCtx), urls) {
+		if ctx.Err() != nil {
+			break
+		}
+		if runCtx.Err() != nil && result.Err != nil {
+			// The extraction was cut short by the budget, the post is left for the next run
+			break
+		}
+
+		var postResult PostResult
+		if result.Err != nil {
+			postResult = PostResult{URL: result.URL, Err: result.Err}
+		} else {
+			postResult = d.writeExtracted(ctx, manifest, result.Post)
+			postResult.URL = result.URL
+		}
+		if ctx.Err() != nil && postResult.Err != nil {
+			// The post was interrupted, it is left for the next run
+			break
+		}
+
+		d.record(summary, manifest, archive, postResult)
+		manifest.RemovePending(result.URL)
+		done++
+		d.postProgress(postResult, done, len(urls))
+		if onResult != nil {
+			onResult(postResult)
+		}
+
+		if d.opts.MaxFailures > 0 && summary.Failed >= d.opts.MaxFailures {
+			abortErr = fmt.Errorf("%w: aborting after %d failed posts, the last one being %s: %v", ErrTooManyFailures, summary.Failed, postResult.URL, postResult.Err)
+			stop()
+			break
+		}
+		if summary.Stopped = d.budgetExceeded(start, startBytes, startRequests); summary.Stopped != "" {
+			stop()
+			break
+		}
+	}
+	if summary.Stopped == "" && ctx.Err() == nil && runCtx.Err() != nil {
+		summary.Stopped = d.budgetExceeded(start, startBytes, startRequests)
+	}
+
+	err = d.finish(ctx, manifest, archive)
+	summary.Duration = time.Since(start)
+	if ctx.Err() != nil {
+		return summary, ctx.Err()
+	}
+	if abortErr != nil {
+		return summary, errors.Join(abortErr, err)
+	}
+	return summary, err
+}
+
+// extract extracts the posts at the given URLs. With a cache, the posts that haven't changed
+// since they were cached, according to ListPostURLs, are read from it first.
+func (d *Downloader) extract(ctx context.Context, urls []string) <-chan ExtractResult {
+	var cached []ExtractResult
+	fetch := urls
+	if d.opts.Cache != nil {
+		fetch = nil
+		for _, url := range urls {
+			if lastMod, ok := d.lastMods[url]; ok {
+				if post, ok := d.opts.Cache.Get(url, lastMod); ok {
+					cached = append(cached, ExtractResult{URL: url, Post: post})
+					continue
+				}
+			}
+			fetch = append(fetch, url)
+		}
+	}
+
+	var results <-chan ExtractResult
+	if d.opts.PostDelay > 0 {
+		results = d.extractPaced(ctx, fetch)
+	} else {
+		results = d.extractor.ExtractAllPosts(ctx, fetch)
+	}
+	if len(cached) == 0 {
+		return results
+	}
+
+	resultCh := make(chan ExtractResult)
+	go func() {
+		defer close(resultCh)
+		for _, result := range cached {
+			postStarted(ctx, result.URL)
+			select {
+			case resultCh <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for result := range results {
+			select {
+			case resultCh <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return resultCh
+}
+
+// extractPaced extracts the posts one at a time, pausing PostDelay between them.
+// The next post is only fetched once the previous one has been received.
+func (d *Downloader) extractPaced(ctx context.Context, urls []string) <-chan ExtractResult {
+	resultCh := make(chan ExtractResult)
+	go func() {
+		defer close(resultCh)
+		for i, url := range urls {
+			if i > 0 && sleepContext(ctx, d.opts.PostDelay) != nil {
+				return
+			}
+			post, err := d.extractor.ExtractPost(ctx, url)
+			select {
+			case resultCh <- ExtractResult{URL: url, Post: post, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return resultCh
+}
+
+// DownloadPost downloads and writes a single post, then updates the manifest and,
+// if enabled, the archive page.
+func (d *Downloader) DownloadPost(ctx context.Context, postURL string) (PostResult, error) {
+	manifest, err := LoadManifest(d.opts.OutputDir)
+	if err != nil {
+		return PostResult{URL: postURL, Err: err}, err
+	}
+
+	var archive *Archive
+	if d.opts.CreateArchive {
+		archive = d.newArchive()
+	}
+
+	result := PostResult{URL: postURL}
+	var post Post
+	if d.fetcher.Offline {
+		post, err = d.extractCached(postURL)
+	} else {
+		post, err = d.extractor.ExtractPost(d.progressContext(ctx), postURL)
+	}
+	if err != nil {
+		result.Err = err
+	} else {
+		result = d.writeExtracted(ctx, manifest, post)
+		result.URL = postURL
+	}
+
+	d.record(&DownloadSummary{}, manifest, archive, result)
+	d.postProgress(result, 1, 1)
+	if err := d.finish(ctx, manifest, archive); err != nil {
+		return result, err
+	}
+	return result, result.Err
+}
+
+// writeExtracted writes an extracted post with WritePost, unless the post was downloaded
+// before under another slug and all its files are still there: they are kept as they are,
+// links to them and the images they reference remaining valid, and the post is recorded
+// under its new slug.
+func (d *Downloader) writeExtracted(ctx context.Context, manifest *Manifest, post Post) PostResult {
+	entry, ok := manifest.EntryByID(post.Id)
+	if !ok || entry.Slug == post.Slug || !d.opts.SkipExisting {
+		return d.WritePost(ctx, post)
+	}
+
+	formats := d.opts.Formats()
+	files := make(map[string]string)
+	for _, format := range formats {
+		if manifest.hasFile(entry.Slug, format) {
+			files[format] = manifest.ResolvePath(entry.Files[format])
+		}
+	}
+	if len(files) < len(formats) {
+		return d.WritePost(ctx, post)
+	}
+	return PostResult{URL: post.CanonicalUrl, Post: post, Path: files[formats[0]], Files: files, PreviousSlug: entry.Slug}
+}
+
+// WritePost writes an already extracted post to disk according to the options, in each of
+// its formats, transforming it first and downloading its images and file attachments if enabled.
+// The media are downloaded once, whatever the number of formats.
+func (d *Downloader) WritePost(ctx context.Context, post Post) PostResult {
+	formats := d.opts.Formats()
+	path := d.postPath(post, formats[0])
+	result := PostResult{URL: post.CanonicalUrl, Post: post, Path: path, Files: make(map[string]string)}
+	// The raw data and HTML are saved as extracted, whatever the transformers do to the post
+	raw := post
+
+	if len(d.opts.Transformers) > 0 {
+		transformed, err := TransformPost(ctx, d.opts.Transformers, post)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		post = transformed
+		result.Post = post
+	}
+
+	// A narration that fails to download is reported once the post is written without it
+	var audioErr error
+	if d.opts.DownloadAudio {
+		var audioPath string
+		audioPath, audioErr = DownloadNarration(ctx, d.fetcher, post, filepath.Dir(path), d.opts.AudioDir)
+		if audioPath != "" {
+			post.BodyHTML = NarrationHTML(audioPath) + post.BodyHTML
+		}
+	}
+	if d.opts.EmailLayout {
+		post.BodyHTML = EmailLayoutHTML(post)
+	}
+
+	if d.opts.DownloadImages || d.opts.DownloadFiles {
+		if d.opts.MediaTemplate != "" || d.opts.OriginalFilenames {
+			naming, err := d.opts.MediaNaming()
+			if err != nil {
+				result.Err = err
+				return result
+			}
+			ctx = WithMediaNaming(ctx, naming)
+		}
+		if len(formats) > 1 {
+			ctx = withMediaCache(ctx)
+		}
+		if d.opts.ImageErrors != "" {
+			ctx = withImageErrors(ctx, d.opts.ImageErrors)
+		}
+		if len(d.opts.ImageSizes) > 0 {
+			ctx = withImageSizes(ctx, d.opts.ImageSizes)
+		}
+		if processing := d.opts.ImageProcessing(); processing.Enabled() {
+			ctx = withImageProcessing(ctx, processing)
+		}
+		if limits := d.opts.AttachmentLimits(); !limits.IsZero() {
+			ctx = withAttachmentLimits(ctx, limits)
+		}
+		if workers := d.opts.MediaWorkers(); workers != (MediaWorkers{}) {
+			ctx = withMediaWorkers(ctx, workers)
+		}
+	}
+
+	for i, format := range formats {
+		formatCtx := ctx
+		if onImage := d.onImage(); i == 0 && onImage != nil {
+			// The images of the other formats come from the cache, they are only reported once
+			formatCtx = WithImageProgress(ctx, onImage)
+		}
+		formatPath := d.postPath(post, format)
+		images, err := d.writeFormat(formatCtx, post, format, formatPath)
+		if i == 0 {
+			result.Images = images
+		}
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		result.Files[format] = formatPath
+	}
+
+	if audioErr != nil {
+		result.Err = fmt.Errorf("error downloading the narration of %s: %w", post.Slug, audioErr)
+		return result
+	}
+
+	// The files written next to the post are named after it
+	path = d.sidecarPath(post)
+	if d.opts.Comments {
+		if err := d.writeComments(ctx, post, path); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	if d.opts.KeepRaw {
+		if err := SaveRawPost(path, raw); err != nil {
+			result.Err = fmt.Errorf("error writing raw data of %s: %w", post.Slug, err)
+			return result
+		}
+	}
+	if d.opts.RawHTML {
+		if err := SaveRawHTML(path, raw); err != nil {
+			result.Err = fmt.Errorf("error writing raw HTML of %s: %w", post.Slug, err)
+			return result
+		}
+	}
+	if d.opts.Cache != nil {
+		// The cache only saves requests, the post is written without it
+		d.opts.Cache.Put(raw)
+	}
+
+	if len(d.opts.PostProcessors) > 0 {
+		for _, format := range formats {
+			meta := NewPostMetadata(post, result.Files[format], format, time.Now())
+			if result.Err = RunPostProcessors(ctx, d.opts.PostProcessors, result.Files[format], meta); result.Err != nil {
+				break
+			}
+		}
+	}
+	return result
+}
+
+// writeFormat writes a post to path in one format, with its media if enabled
+func (d *Downloader) writeFormat(ctx context.Context, post Post, format string, path string) (*ImageDownloadResult, error) {
+	if format == "html" {
+		post.BodyHTML += PostNavigationHTML(post)
+	}
+	if d.opts.Mirror {
+		post.BodyHTML = MirrorLinks(post.BodyHTML, post.CanonicalUrl, format)
+	}
+	if d.opts.AccessibleText && format == "txt" {
+		body, err := AccessibleImagesHTML(post.BodyHTML)
+		if err != nil {
+			return nil, err
+		}
+		post.BodyHTML = body
+	}
+
+	// The previous content of the post, kept as a version if it changes. The jsonl file is
+	// appended to, the previous lines being kept.
+	var previous []byte
+	if d.opts.KeepVersions && format != "jsonl" {
+		previous, _ = os.ReadFile(path)
+	}
+
+	var images *ImageDownloadResult
+	var err error
+	if d.opts.DownloadImages || d.opts.DownloadFiles {
+		images, err = post.WriteToFileWithImages(ctx, path, format, d.opts.AddSourceURL,
+			d.opts.DownloadImages, d.opts.ImageQuality, d.opts.ImagesDir,
+			d.opts.DownloadFiles, d.opts.FileExtensions, d.opts.FilesDir, d.fetcher)
+	} else {
+		err = post.WriteToFile(path, format, d.opts.AddSourceURL)
+	}
+	if err != nil {
+		return images, fmt.Errorf("error writing file %s: %w", path, err)
+	}
+
+	if previous != nil {
+		if _, err := SavePreviousVersion(path, previous); err != nil {
+			return images, fmt.Errorf("error keeping the previous version of %s: %w", path, err)
+		}
+	}
+	return images, nil
+}
+
+// writeComments saves the comments of a post next to the file written at path, and writes
+// them in CommentsFormat if set
+func (d *Downloader) writeComments(ctx context.Context, post Post, path string) error {
+	comments, err := d.extractor.GetPostComments(ctx, post)
+	if err != nil {
+		return fmt.Errorf("error downloading comments of %s: %w", post.Slug, err)
+	}
+	if err := SavePostComments(path, comments); err != nil {
+		return fmt.Errorf("error writing comments of %s: %w", post.Slug, err)
+	}
+	if d.opts.CommentsFormat != "" {
+		if err := WritePostComments(path, post, comments, d.opts.CommentsFormat); err != nil {
+			return fmt.Errorf("error writing comments of %s: %w", post.Slug, err)
+		}
+	}
+	return nil
+}
+
+// record accounts for a processed post in the summary, manifest and archive.
+// Failures are recorded in the manifest so they can be retried.
+func (d *Downloader) record(summary *DownloadSummary, manifest *Manifest, archive *Archive, result PostResult) {
+	now := time.Now()
+	var postProcessErr *PostProcessError
+	var transformErr *TransformError
+	if result.Err != nil && result.Path == "" && isGone(result.Err) {
+		// A downloaded post that doesn't exist anymore keeps its local copy
+		slug := SlugFromURL(result.URL)
+		if _, ok := manifest.Entry(slug); ok {
+			if manifest.MarkDeleted(slug, now) {
+				summary.Deleted++
+			}
+			manifest.RemoveFailure(result.URL)
+			return
+		}
+	}
+	if result.Err != nil {
+		summary.Failed++
+		stage := FailureWrite
+		if result.Path == "" {
+			stage = FailureDownload
+		} else if errors.Is(result.Err, ErrMediaFailed) {
+			stage = FailureImages
+			if result.Images != nil {
+				summary.ImagesOK += result.Images.Success
+				summary.ImagesFailed += result.Images.Failed
+			}
+		} else if errors.As(result.Err, &transformErr) {
+			stage = FailureTransform
+		} else if errors.As(result.Err, &postProcessErr) {
+			stage = FailurePostProcess
+		}
+		failure := d.failure(result, stage, result.Err.Error(), now)
+		manifest.AddFailure(failure)
+		d.logFailure(failure, result.Err)
+		// A post that failed to be post-processed is written, so it is still recorded
+		if stage != FailurePostProcess {
+			return
+		}
+	} else {
+		if result.PreviousSlug != "" {
+			summary.Renamed++
+		} else {
+			summary.Downloaded++
+		}
+		if result.Images != nil {
+			summary.ImagesOK += result.Images.Success
+			summary.ImagesFailed += result.Images.Failed
+			summary.ImageBytes += result.Images.Bytes
+		}
+		if result.Images != nil && result.Images.Failed > 0 && d.opts.ImageErrors != ImageErrorsSkip {
+			failure := d.failure(result, FailureImages, fmt.Sprintf("%d images or attachments failed to download", result.Images.Failed), now)
+			manifest.AddFailure(failure)
+			d.logFailure(failure, nil)
+		} else {
+			manifest.RemoveFailure(result.URL)
+		}
+	}
+
+	files := make(map[string]string)
+	for format, path := range result.Files {
+		files[format] = manifest.RelPath(path)
+	}
+	if len(files) == 0 {
+		files[d.opts.Formats()[0]] = manifest.RelPath(result.Path)
+	}
+	entry := NewManifestEntry(result.Post, files, now)
+	if result.Post.WordCount > 0 {
+		entry.Extracted = result.Post.ExtractedWordCount()
+		entry.Incomplete = result.Post.Incomplete()
+		if entry.Incomplete {
+			summary.Incomplete++
+		}
+	}
+	manifest.AddEntry(entry)
+	if archive != nil {
+		var attachments []FileInfo
+		if result.Images != nil {
+			attachments = result.Images.Files
+		}
+		paths := make(map[string]string)
+		for format, path := range files {
+			paths[format] = manifest.ResolvePath(path)
+		}
+		archive.Add(ArchiveEntry{
+			Post:         result.Post,
+			FilePath:     result.Path,
+			DownloadTime: now,
+			Attachments:  attachments,
+			Files:        paths,
+			Sidecars:     postSidecars(d.sidecarPath(result.Post)),
+		})
+	}
+}
+
+// failure describes a failed post for the manifest
+func (d *Downloader) failure(result PostResult, stage string, message string, at time.Time) ManifestFailure {
+	slug := result.Post.Slug
+	if slug == "" {
+		slug = SlugFromURL(result.URL)
+	}
+	return ManifestFailure{
+		URL:      result.URL,
+		Slug:     slug,
+		Stage:    stage,
+		Error:    message,
+		Options:  d.opts.ManifestOptions(),
+		FailedAt: at,
+	}
+}
+
+// logFailure appends a failure to the failure log of the output directory.
+// The manifest remains the reference for retries, so the log is written on a best-effort basis.
+func (d *Downloader) logFailure(failure ManifestFailure, err error) {
+	entry := NewFailureLogEntry(failure, err, d.fetcher.FailedAttempts(failure.URL), d.opts.OutputDir)
+	AppendFailureLog(d.opts.OutputDir, entry)
+}
+
+// newArchive returns an empty archive page laid out according to the options
+func (d *Downloader) newArchive() *Archive {
+	archive := NewArchive()
+	archive.Heatmap = d.opts.ArchiveHeatmap
+	archive.Order = d.opts.ReadingOrder
+	archive.ByAuthor = d.opts.ByAuthor
+	return archive
+}
+
+// finish saves the manifest, links the downloaded posts to each other and generates the archive page.
+// The manifest is saved even if ctx is done, the links and the archive page being left for the next run.
+func (d *Downloader) finish(ctx context.Context, manifest *Manifest, archive *Archive) error {
+	if err := manifest.Save(); err != nil {
+		return fmt.Errorf("error saving manifest: %w", err)
+	}
+
+	formats := d.opts.Formats()
+	for _, format := range formats {
+		if _, err := RewriteInternalLinks(ctx, manifest, format); err != nil {
+			return fmt.Errorf("error rewriting links between posts: %w", err)
+		}
+	}
+	if d.opts.RelatedPosts > 0 && containsString(formats, "html") {
+		if _, err := WriteRelatedPosts(ctx, manifest, d.opts.RelatedPosts); err != nil {
+			return fmt.Errorf("error writing related posts: %w", err)
+		}
+	}
+
+	// The archive page is in the first format it can be generated in, linking the posts in it
+	// when they were written in it
+	if archive != nil {
+		for _, entry := range manifest.Entries() {
+			if !entry.Deleted() || len(entry.Files) == 0 {
+				continue
+			}
+			paths := make(map[string]string)
+			for format, path := range entry.Files {
+				paths[format] = manifest.ResolvePath(path)
+			}
+			deleted := ArchiveEntry{Post: entry.Post(), DownloadTime: entry.DownloadedAt, Deleted: true, Files: paths}
+			deleted.FilePath = deleted.PrimaryPath(formats[0])
+			deleted.Sidecars = postSidecars(deleted.FilePath)
+			archive.Add(deleted)
+		}
+	}
+	if archive != nil && len(archive.Entries) > 0 {
+		archive.Logo = FindPublicationLogo(d.opts.OutputDir)
+		if err := archive.Generate(ctx, d.opts.OutputDir, ArchivePageFormat(formats)); err != nil {
+			return fmt.Errorf("error generating archive page: %w", err)
+		}
+	}
+	return nil
+}
+
+// PostPath returns the path a post is written to according to the options, in the first format
+func (d *Downloader) PostPath(post Post) string {
+	return d.postPath(post, d.opts.Formats()[0])
+}
+
+// postPath returns the path a post is written to in format
+func (d *Downloader) postPath(post Post, format string) string {
+	if format == "jsonl" {
+		return JSONLPath(d.opts.OutputDir)
+	}
+	if d.opts.Mirror {
+		return MirrorPostPath(post.CanonicalUrl, d.opts.OutputDir, format)
+	}
+	if d.opts.ByAuthor {
+		return AuthorPostPath(post, d.opts.OutputDir, format)
+	}
+	return PostFilePath(post, d.opts.OutputDir, format)
+}
+
+// sidecarPath returns the path the files written next to a post, e.g. its comments, are named
+// after: the post in its first format, or as named in the json format when it is only appended
+// to the jsonl file
+func (d *Downloader) sidecarPath(post Post) string {
+	for _, format := range d.opts.Formats() {
+		if format != "jsonl" {
+			return d.postPath(post, format)
+		}
+	}
+	return d.postPath(post, "json")
+}
+
+// PostFilePath returns the path a post is written to: {outputDir}/{YYYYMMDD_HHMMSS}_{slug}.{format}
+func PostFilePath(post Post, outputDir string, format string) string {
+	return fmt.Sprintf("%s/%s_%s.%s", outputDir, formatPostDateTime(post.PostDate), post.Slug, format)
+}
+
+// formatPostDateTime formats an RFC3339 post date as YYYYMMDD_HHMMSS for file names.
+// An empty string is returned if the date can't be parsed.
+func formatPostDateTime(datetime string) string {
+	parsedTime, err := time.Parse(time.RFC3339, datetime)
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%d%02d%02d_%02d%02d%02d",
+		parsedTime.Year(), parsedTime.Month(), parsedTime.Day(),
+		parsedTime.Hour(), parsedTime.Minute(), parsedTime.Second())
+}
+
+// SlugFromURL extracts the slug from a Substack post URL
+// e.g. https://example.substack.com/p/this-is-the-post-title -> this-is-the-post-title
+func SlugFromURL(url string) string {
+	split := strings.Split(url, "/")
+	return split[len(split)-1]
+}
+
+// FilterExistingPosts filters out posts that already exist in the output directory.
+// It looks for files whose name ends with the post slug.
+func FilterExistingPosts(urls []string, outputDir string, format string) ([]string, error) {
+	var filtered []string
+	for _, url := range urls {
+		slug := SlugFromURL(url)
+		path := fmt.Sprintf("%s/%s_%s.%s", outputDir, "*", slug, format)
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return urls, err
+		}
+		if len(matches) == 0 {
+			filtered = append(filtered, url)
+		}
+	}
+	return filtered, nil
+}
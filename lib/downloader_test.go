@@ -0,0 +1,610 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createPublicationTestServer creates a Substack-like server whose sitemap links to its own posts
+func createPublicationTestServer(count int) *httptest.Server {
+	posts := make(map[string]Post)
+	var server *httptest.Server
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sitemap.xml" {
+			sitemapXML := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+`
+			for i := 1; i <= count; i++ {
+				sitemapXML += fmt.Sprintf("  <url><loc>%s/p/post-%d</loc><lastmod>2023-01-%02d</lastmod></url>\n", server.URL, i, i)
+			}
+			sitemapXML += `</urlset>`
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(sitemapXML))
+			return
+		}
+
+		if post, ok := posts[r.URL.Path]; ok {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(createMockSubstackHTML(post)))
+			return
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	for i := 1; i <= count; i++ {
+		post := createSamplePost()
+		post.Id = i
+		post.Title = fmt.Sprintf("Post %d", i)
+		post.Slug = fmt.Sprintf("post-%d", i)
+		post.PostDate = fmt.Sprintf("2023-01-%02dT10:00:00Z", i)
+		post.CanonicalUrl = fmt.Sprintf("%s/p/post-%d", server.URL, i)
+		posts[fmt.Sprintf("/p/post-%d", i)] = post
+	}
+
+	return server
+}
+
+// Test the helpers shared with the download command
+func TestDownloaderHelpers(t *testing.T) {
+	t.Run("PostFilePath", func(t *testing.T) {
+		post := Post{Slug: "my-post", PostDate: "2023-01-02T03:04:05Z"}
+		assert.Equal(t, "out/20230102_030405_my-post.md", PostFilePath(post, "out", "md"))
+
+		assert.Equal(t, "out/20230102_030405_my-post.txt", PostFilePath(post, "out", "txt"))
+		assert.Equal(t, "/20230102_030405_my-post.html", PostFilePath(post, "", "html"))
+
+		post.PostDate = "invalid"
+		assert.Equal(t, "out/_my-post.md", PostFilePath(post, "out", "md"))
+	})
+
+	t.Run("formatPostDateTime", func(t *testing.T) {
+		assert.Equal(t, "20230101_103000", formatPostDateTime("2023-01-01T10:30:00.000Z"))
+		assert.Equal(t, "20230101_103000", formatPostDateTime("2023-01-01T10:30:00Z"))
+		assert.Equal(t, "20231231_235959", formatPostDateTime("2023-12-31T23:59:59.999Z"))
+		// Dates that are not RFC3339 are left out of the file names
+		assert.Equal(t, "", formatPostDateTime("2023-01-01"))
+		assert.Equal(t, "", formatPostDateTime(""))
+	})
+
+	t.Run("SlugFromURL", func(t *testing.T) {
+		assert.Equal(t, "my-post", SlugFromURL("https://example.substack.com/p/my-post"))
+		assert.Equal(t, "this-is-a-very-long-post-title", SlugFromURL("https://example.substack.com/p/this-is-a-very-long-post-title"))
+		assert.Equal(t, "", SlugFromURL("https://example.substack.com/p/my-post/"))
+		// The last segment of the URL is returned as is
+		assert.Equal(t, "my-post?utm_source=newsletter", SlugFromURL("https://example.substack.com/p/my-post?utm_source=newsletter"))
+		assert.Equal(t, "my-post#comments", SlugFromURL("https://example.substack.com/p/my-post#comments"))
+		assert.Equal(t, "my-post", SlugFromURL("https://example.substack.com/my-post"))
+		assert.Equal(t, "", SlugFromURL(""))
+	})
+
+	t.Run("PostPath", func(t *testing.T) {
+		post := Post{Slug: "my-post", PostDate: "2023-01-02T03:04:05Z", CanonicalUrl: "https://example.com/p/my-post",
+			Bylines: []PostByline{{Name: "Jane Doe", Handle: "janedoe"}}}
+
+		d := NewDownloader(nil, DownloadOptions{OutputDir: "out"})
+		assert.Equal(t, "out/20230102_030405_my-post.html", d.PostPath(post))
+
+		d = NewDownloader(nil, DownloadOptions{OutputDir: "out", Format: "md,html"})
+		assert.Equal(t, "out/20230102_030405_my-post.md", d.PostPath(post))
+		assert.Equal(t, "out/20230102_030405_my-post.html", d.postPath(post, "html"))
+		assert.Equal(t, JSONLPath("out"), d.postPath(post, "jsonl"))
+
+		d = NewDownloader(nil, DownloadOptions{OutputDir: "out", Mirror: true})
+		assert.Equal(t, MirrorPostPath(post.CanonicalUrl, "out", "html"), d.PostPath(post))
+
+		d = NewDownloader(nil, DownloadOptions{OutputDir: "out", ByAuthor: true})
+		assert.Equal(t, AuthorPostPath(post, "out", "html"), d.PostPath(post))
+	})
+
+	t.Run("FilterExistingPosts", func(t *testing.T) {
+		tempDir, err := os.MkdirTemp("", "downloader-test-*")
+		require.NoError(t, err)
+		defer os.RemoveAll(tempDir)
+
+		require.NoError(t, os.WriteFile(filepath.Join(tempDir, "20230101_100000_existing.html"), []byte("x"), 0644))
+
+		urls := []string{
+			"https://example.substack.com/p/existing",
+			"https://example.substack.com/p/missing",
+		}
+		filtered, err := FilterExistingPosts(urls, tempDir, "html")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"https://example.substack.com/p/missing"}, filtered)
+
+		// Other formats are not considered downloaded
+		filtered, err = FilterExistingPosts(urls, tempDir, "md")
+		require.NoError(t, err)
+		assert.Equal(t, urls, filtered)
+	})
+}
+
+// Test downloading a whole publication
+func TestDownloaderDownloadPublication(t *testing.T) {
+	server := createPublicationTestServer(3)
+	defer server.Close()
+
+	tempDir, err := os.MkdirTemp("", "downloader-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = tempDir
+	opts.Format = "md"
+	opts.CreateArchive = true
+	downloader := NewDownloader(nil, opts)
+	ctx := context.Background()
+
+	var results []PostResult
+	summary, err := downloader.DownloadPublication(ctx, server.URL, func(result PostResult) {
+		results = append(results, result)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, summary.Found)
+	assert.Equal(t, 3, summary.Downloaded)
+	assert.Equal(t, 0, summary.Failed)
+	assert.Len(t, results, 3)
+
+	assert.FileExists(t, filepath.Join(tempDir, "20230101_100000_post-1.md"))
+	assert.FileExists(t, filepath.Join(tempDir, "index.md"))
+
+	manifest, err := LoadManifest(tempDir)
+	require.NoError(t, err)
+	require.Len(t, manifest.Posts, 3)
+	entry, ok := manifest.Entry("post-2")
+	require.True(t, ok)
+	assert.Equal(t, "20230102_100000_post-2.md", entry.Files["md"])
+
+	t.Run("existing posts are skipped", func(t *testing.T) {
+		summary, err := downloader.DownloadPublication(ctx, server.URL, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 3, summary.Found)
+		assert.Equal(t, 3, summary.Skipped)
+		assert.Equal(t, 0, summary.Downloaded)
+	})
+
+	t.Run("changed posts are downloaded again", func(t *testing.T) {
+		// The sitemap lists post-2 as modified after the version of the manifest
+		manifest, err := LoadManifest(tempDir)
+		require.NoError(t, err)
+		entry, ok := manifest.Entry("post-2")
+		require.True(t, ok)
+		entry.PostDate = "2022-12-01T10:00:00Z"
+		manifest.AddEntry(entry)
+		require.NoError(t, manifest.Save())
+
+		_, pending, err := NewDownloader(nil, opts).ListPostURLs(ctx, server.URL)
+		require.NoError(t, err)
+		assert.Empty(t, pending)
+
+		opts := opts
+		opts.UpdateChanged = true
+		_, pending, err = NewDownloader(nil, opts).ListPostURLs(ctx, server.URL)
+		require.NoError(t, err)
+		assert.Equal(t, []string{server.URL + "/p/post-2"}, pending)
+	})
+
+	t.Run("date filter", func(t *testing.T) {
+		opts := opts
+		opts.OutputDir = filepath.Join(tempDir, "filtered")
+		opts.DateFilter = NewDateFilter("", "2023-01-02")
+		all, pending, err := NewDownloader(nil, opts).ListPostURLs(ctx, server.URL)
+		require.NoError(t, err)
+		assert.Len(t, all, 1)
+		assert.Equal(t, all, pending)
+	})
+}
+
+// Test writing posts in several formats from a single fetch
+func TestDownloaderFormats(t *testing.T) {
+	server := createPublicationTestServer(2)
+	defer server.Close()
+
+	var mu sync.Mutex
+	fetches := make(map[string]int)
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/p/") {
+			mu.Lock()
+			fetches[r.URL.Path]++
+			mu.Unlock()
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	tempDir := t.TempDir()
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = tempDir
+	opts.Format = "html, md"
+	opts.CreateArchive = true
+	ctx := context.Background()
+
+	summary, err := NewDownloader(nil, opts).DownloadPublication(ctx, server.URL, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, summary.Downloaded)
+	assert.Equal(t, map[string]int{"/p/post-1": 1, "/p/post-2": 1}, fetches)
+
+	for _, name := range []string{"20230101_100000_post-1.html", "20230101_100000_post-1.md", "20230102_100000_post-2.md"} {
+		assert.FileExists(t, filepath.Join(tempDir, name))
+	}
+	// The archive page is in the first format
+	assert.FileExists(t, filepath.Join(tempDir, "index.html"))
+	assert.NoFileExists(t, filepath.Join(tempDir, "index.md"))
+
+	manifest, err := LoadManifest(tempDir)
+	require.NoError(t, err)
+	entry, ok := manifest.Entry("post-1")
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"html": "20230101_100000_post-1.html", "md": "20230101_100000_post-1.md"}, entry.Files)
+
+	t.Run("posts missing a format are pending", func(t *testing.T) {
+		opts := opts
+		opts.Format = "md,html"
+		_, pending, err := NewDownloader(nil, opts).ListPostURLs(ctx, server.URL)
+		require.NoError(t, err)
+		assert.Empty(t, pending)
+
+		opts.Format = "html,txt"
+		_, pending, err = NewDownloader(nil, opts).ListPostURLs(ctx, server.URL)
+		require.NoError(t, err)
+		assert.Len(t, pending, 2)
+	})
+}
+
+// Test writing posts as JSON documents, one file per post and appended to a single file
+func TestDownloaderJSONFormats(t *testing.T) {
+	server := createPublicationTestServer(2)
+	defer server.Close()
+
+	tempDir := t.TempDir()
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = tempDir
+	opts.Format = "json,jsonl"
+	opts.CreateArchive = true
+	ctx := context.Background()
+
+	summary, err := NewDownloader(nil, opts).DownloadPublication(ctx, server.URL, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, summary.Downloaded)
+
+	data, err := os.ReadFile(filepath.Join(tempDir, "20230101_100000_post-1.json"))
+	require.NoError(t, err)
+	var doc PostDocument
+	require.NoError(t, json.Unmarshal(data, &doc))
+	assert.Equal(t, "Post 1", doc.Title)
+	assert.Equal(t, "post-1", doc.Slug)
+	assert.Equal(t, server.URL+"/p/post-1", doc.CanonicalUrl)
+	assert.NotEmpty(t, doc.BodyHTML)
+	assert.NotEmpty(t, doc.Markdown)
+	assert.NotContains(t, doc.Markdown, "<p>")
+
+	// The posts of the run are appended to one file, a line per post
+	data, err = os.ReadFile(filepath.Join(tempDir, JSONLFile))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 2)
+	var slugs []string
+	for _, line := range lines {
+		var doc PostDocument
+		require.NoError(t, json.Unmarshal([]byte(line), &doc))
+		assert.NotEmpty(t, doc.Markdown)
+		slugs = append(slugs, doc.Slug)
+	}
+	assert.ElementsMatch(t, []string{"post-1", "post-2"}, slugs)
+
+	// The archive page, in html as json can't be browsed, links the JSON documents
+	assert.FileExists(t, filepath.Join(tempDir, "index.html"))
+	manifest, err := LoadManifest(tempDir)
+	require.NoError(t, err)
+	entry, ok := manifest.Entry("post-2")
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"json": "20230102_100000_post-2.json", "jsonl": JSONLFile}, entry.Files)
+
+	// Posts already appended aren't appended again
+	summary, err = NewDownloader(nil, opts).DownloadPublication(ctx, server.URL, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, summary.Downloaded)
+	data, err = os.ReadFile(filepath.Join(tempDir, JSONLFile))
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "\n"))
+
+	// Posts downloaded again replace their line
+	opts.SkipExisting = false
+	summary, err = NewDownloader(nil, opts).DownloadPublication(ctx, server.URL, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, summary.Downloaded)
+	data, err = os.ReadFile(filepath.Join(tempDir, JSONLFile))
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "\n"))
+	opts.SkipExisting = true
+
+	t.Run("sidecars of jsonl only", func(t *testing.T) {
+		opts := opts
+		opts.OutputDir = filepath.Join(tempDir, "jsonl")
+		opts.Format = "jsonl"
+		opts.RawHTML = true
+		downloader := NewDownloader(nil, opts)
+		summary, err := downloader.DownloadPublication(ctx, server.URL, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 2, summary.Downloaded)
+		// The files written next to the posts are named after them, not after the shared file
+		assert.FileExists(t, filepath.Join(opts.OutputDir, "20230101_100000_post-1.raw.html"))
+		assert.NoFileExists(t, filepath.Join(opts.OutputDir, "20230101_100000_post-1.json"))
+	})
+}
+
+func TestParseFormats(t *testing.T) {
+	formats, err := ParseFormats("html,MD, html")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"html", "md"}, formats)
+
+	formats, err = ParseFormats("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"html"}, formats)
+
+	formats, err = ParseFormats("json, jsonl")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"json", "jsonl"}, formats)
+
+	_, err = ParseFormats("html,pdf")
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{"txt"}, DownloadOptions{Format: "txt"}.Formats())
+}
+
+// Test downloading a single post
+func TestDownloaderDownloadPost(t *testing.T) {
+	server := createPublicationTestServer(1)
+	defer server.Close()
+
+	tempDir, err := os.MkdirTemp("", "downloader-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = tempDir
+	downloader := NewDownloader(nil, opts)
+
+	result, err := downloader.DownloadPost(context.Background(), server.URL+"/p/post-1")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(tempDir, "20230101_100000_post-1.html"), filepath.FromSlash(result.Path))
+	assert.FileExists(t, result.Path)
+
+	_, err = downloader.DownloadPost(context.Background(), server.URL+"/p/missing")
+	assert.Error(t, err)
+}
+
+// Test that a post downloaded before under another slug is not downloaded again
+func TestDownloaderRenamedPost(t *testing.T) {
+	tempDir := t.TempDir()
+	oldPath := filepath.Join(tempDir, "20230101_100000_old-slug.html")
+	require.NoError(t, os.WriteFile(oldPath, []byte("old"), 0644))
+
+	manifest, err := LoadManifest(tempDir)
+	require.NoError(t, err)
+	post := createSamplePost()
+	post.Id = 42
+	post.Slug = "old-slug"
+	manifest.AddEntry(NewManifestEntry(post, map[string]string{"html": manifest.RelPath(oldPath)}, time.Now()))
+
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = tempDir
+	downloader := NewDownloader(nil, opts)
+
+	post.Slug = "new-slug"
+	result := downloader.writeExtracted(context.Background(), manifest, post)
+	require.NoError(t, result.Err)
+	assert.Equal(t, "old-slug", result.PreviousSlug)
+	assert.Equal(t, oldPath, result.Path)
+	assert.NoFileExists(t, filepath.Join(tempDir, "20230101_100000_new-slug.html"))
+
+	summary := &DownloadSummary{}
+	downloader.record(summary, manifest, nil, result)
+	assert.Equal(t, 1, summary.Renamed)
+	assert.Equal(t, 0, summary.Downloaded)
+
+	entry, ok := manifest.Entry("new-slug")
+	require.True(t, ok)
+	assert.Equal(t, []string{"old-slug"}, entry.PreviousSlugs)
+	assert.Equal(t, "20230101_100000_old-slug.html", entry.Files["html"])
+	assert.True(t, manifest.hasFile("new-slug", "html"))
+}
+
+// Test that an interrupted run saves its manifest, the links and archive page being left for the next run
+func TestDownloaderFinishCancelled(t *testing.T) {
+	tempDir := t.TempDir()
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = tempDir
+	opts.CreateArchive = true
+	downloader := NewDownloader(nil, opts)
+
+	manifest, err := LoadManifest(tempDir)
+	require.NoError(t, err)
+	manifest.AddEntry(NewManifestEntry(Post{Id: 1, Slug: "a"}, map[string]string{"html": "a.html"}, time.Now()))
+	archive := NewArchive()
+	archive.AddEntry(Post{Slug: "a", Title: "A"}, filepath.Join(tempDir, "a.html"), time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = downloader.finish(ctx, manifest, archive)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.FileExists(t, manifest.Path())
+	assert.NoFileExists(t, filepath.Join(tempDir, "index.html"))
+
+	require.NoError(t, downloader.finish(context.Background(), manifest, archive))
+	assert.FileExists(t, filepath.Join(tempDir, "index.html"))
+}
+
+// Test that the posts to download aren't listed from a corrupt manifest
+func TestListPostURLsCorruptManifest(t *testing.T) {
+	server := createPublicationTestServer(2)
+	defer server.Close()
+
+	tempDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, ManifestFile), []byte("{not json"), 0644))
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = tempDir
+	downloader := NewDownloader(nil, opts)
+
+	_, _, err := downloader.ListPostURLs(context.Background(), server.URL)
+	assert.ErrorContains(t, err, "failed to decode manifest")
+	_, err = downloader.DownloadPublication(context.Background(), server.URL, nil)
+	assert.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(tempDir, "20230101_100000_post-1.html"), "nothing is downloaded")
+
+	// Without skipping the existing posts, the manifest isn't read to list them
+	opts.SkipExisting = false
+	all, pending, err := NewDownloader(nil, opts).ListPostURLs(context.Background(), server.URL)
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+	assert.Equal(t, all, pending)
+}
+
+// Test resuming a run interrupted after some of its posts
+func TestDownloaderResume(t *testing.T) {
+	server := createPublicationTestServer(5)
+	defer server.Close()
+
+	tempDir := t.TempDir()
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = tempDir
+	opts.Format = "md"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(map[string]bool)
+	_, err := NewDownloader(nil, opts).DownloadPublication(ctx, server.URL, func(result PostResult) {
+		require.NoError(t, result.Err)
+		done[result.URL] = true
+		if len(done) == 2 {
+			cancel()
+		}
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, done, 2)
+
+	// The posts not processed are left pending in the manifest
+	manifest, err := LoadManifest(tempDir)
+	require.NoError(t, err)
+	var remaining []string
+	for i := 1; i <= 5; i++ {
+		url := fmt.Sprintf("%s/p/post-%d", server.URL, i)
+		if !done[url] {
+			remaining = append(remaining, url)
+		}
+	}
+	assert.ElementsMatch(t, remaining, manifest.PendingURLs())
+	assert.Len(t, manifest.Posts, 2)
+
+	opts.Resume = true
+	var resumed []string
+	summary, err := NewDownloader(nil, opts).DownloadPublication(context.Background(), server.URL, func(result PostResult) {
+		require.NoError(t, result.Err)
+		resumed = append(resumed, result.URL)
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, remaining, resumed, "only the posts left pending are downloaded")
+	assert.Equal(t, 3, summary.Downloaded)
+
+	manifest, err = LoadManifest(tempDir)
+	require.NoError(t, err)
+	assert.Empty(t, manifest.PendingURLs())
+	assert.Len(t, manifest.Posts, 5)
+
+	// Without pending posts, resuming lists the publication, skipping the downloaded posts
+	summary, err = NewDownloader(nil, opts).DownloadPublication(context.Background(), server.URL, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 5, summary.Found)
+	assert.Equal(t, 5, summary.Skipped)
+}
+
+// Test that a post isn't written once the run is interrupted
+func TestWriteToFileWithImagesCancelled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "post.html")
+	post := Post{Title: "Title", Slug: "post", BodyHTML: "<p>Body</p>"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := post.WriteToFileWithImages(ctx, path, "html", false, false, ImageQualityHigh, "images", false, nil, "files", nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NoFileExists(t, path)
+}
+
+// Test that posts are fetched one at a time with the post delay between them
+func TestDownloaderPostDelay(t *testing.T) {
+	var mu sync.Mutex
+	var requests []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only the post pages are paced, not the requests made for a single post
+		if strings.HasPrefix(r.URL.Path, "/p/") {
+			mu.Lock()
+			requests = append(requests, time.Now())
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	tempDir, err := os.MkdirTemp("", "delay-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = tempDir
+	opts.PostDelay = 100 * time.Millisecond
+	downloader := NewDownloader(NewFetcher(WithRatePerSecond(100)), opts)
+
+	urls := []string{server.URL + "/p/one", server.URL + "/p/two", server.URL + "/p/three"}
+	var order []string
+	summary, err := downloader.DownloadPosts(context.Background(), urls, func(result PostResult) {
+		order = append(order, result.URL)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, summary.Failed)
+	assert.Equal(t, urls, order)
+
+	require.Len(t, requests, 3)
+	for i := 1; i < len(requests); i++ {
+		assert.GreaterOrEqual(t, requests[i].Sub(requests[i-1]), opts.PostDelay)
+	}
+}
+
+func TestDownloaderMaxFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	tempDir := t.TempDir()
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = tempDir
+	opts.MaxFailures = 2
+	downloader := NewDownloader(NewFetcher(WithRatePerSecond(100)), opts)
+
+	urls := []string{server.URL + "/p/one", server.URL + "/p/two", server.URL + "/p/three", server.URL + "/p/four"}
+	processed := 0
+	summary, err := downloader.DownloadPosts(context.Background(), urls, func(result PostResult) {
+		processed++
+	})
+	require.ErrorIs(t, err, ErrTooManyFailures)
+	assert.Equal(t, 2, processed)
+	assert.Equal(t, 2, summary.Failed)
+
+	// The failures are still recorded to be retried
+	manifest, err := LoadManifest(tempDir)
+	require.NoError(t, err)
+	assert.Len(t, manifest.Failures, 2)
+}
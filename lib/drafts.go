@@ -0,0 +1,153 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// DraftsDir is the directory of the output directory where drafts are backed up, apart from
+// the published posts. Scheduled posts go to its "scheduled" subdirectory.
+const DraftsDir = "drafts"
+
+// Kinds of unpublished posts fetched by FetchDrafts
+const (
+	DraftKindDraft     = "drafts"
+	DraftKindScheduled = "scheduled"
+)
+
+// draftsPageSize is the number of drafts fetched per request
+const draftsPageSize = 25
+
+// Draft is an unpublished post of a publication, as returned by the publisher API. Its body
+// is a ProseMirror document.
+type Draft struct {
+	ID        int         `json:"id"`
+	Slug      string      `json:"slug"`
+	Type      string      `json:"type"`
+	Title     string      `json:"draft_title"`
+	Subtitle  string      `json:"draft_subtitle"`
+	Body      interface{} `json:"draft_body"`
+	Audience  string      `json:"audience"`
+	PostDate  string      `json:"post_date"` // publication date of a scheduled post
+	UpdatedAt string      `json:"draft_updated_at"`
+	Scheduled bool        `json:"-"`
+
+	raw json.RawMessage
+}
+
+// draftsResponse is a page of the drafts or scheduled posts of a publication
+type draftsResponse struct {
+	Posts []json.RawMessage `json:"posts"`
+}
+
+// FetchDrafts fetches the drafts or the scheduled posts of a publication, depending on kind.
+// The publisher API requires the cookie of an owner or editor of the publication.
+func FetchDrafts(ctx context.Context, client *APIClient, kind string) ([]Draft, error) {
+	if kind != DraftKindDraft && kind != DraftKindScheduled {
+		return nil, fmt.Errorf("unknown kind of drafts: %s", kind)
+	}
+
+	var drafts []Draft
+	err := PaginateOffset(ctx, draftsPageSize, func(offset int) (int, error) {
+		query := url.Values{
+			"offset":          {strconv.Itoa(offset)},
+			"limit":           {strconv.Itoa(draftsPageSize)},
+			"order_by":        {"draft_updated_at"},
+			"order_direction": {"desc"},
+		}
+		var page draftsResponse
+		if err := client.Get(ctx, "post_management/"+kind, query, &page); err != nil {
+			return 0, err
+		}
+		for _, raw := range page.Posts {
+			var draft Draft
+			if err := json.Unmarshal(raw, &draft); err != nil {
+				return 0, fmt.Errorf("failed to decode draft: %w", err)
+			}
+			draft.Scheduled = kind == DraftKindScheduled
+			draft.raw = raw
+			drafts = append(drafts, draft)
+		}
+		return len(page.Posts), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", kind, err)
+	}
+	return drafts, nil
+}
+
+// ToPost returns the draft as a post, its body rendered to HTML
+func (d *Draft) ToPost() (Post, error) {
+	post := Post{
+		Id:       d.ID,
+		Type:     d.Type,
+		Slug:     d.Slug,
+		Title:    d.Title,
+		Subtitle: d.Subtitle,
+		Audience: d.Audience,
+		PostDate: d.PostDate,
+	}
+	if post.Title == "" {
+		post.Title = "Untitled"
+	}
+	if d.Body != nil && d.Body != "" {
+		body, err := RenderProseMirrorHTML(d.Body)
+		if err != nil {
+			return Post{}, fmt.Errorf("failed to render draft %d: %w", d.ID, err)
+		}
+		post.BodyHTML = body
+	}
+	return post, nil
+}
+
+// FileName returns the name of the files of the draft, without extension: the publication
+// date and slug of a scheduled post, the ID and title of a draft
+func (d *Draft) FileName() string {
+	slug := groupSlug(d.Slug, d.Title)
+	if slug == "" {
+		slug = "untitled"
+	}
+	if d.Scheduled {
+		if date, err := time.Parse(time.RFC3339, d.PostDate); err == nil {
+			return date.Format("20060102_150405") + "_" + slug
+		}
+	}
+	return fmt.Sprintf("%d_%s", d.ID, slug)
+}
+
+// SaveDrafts writes the drafts to the drafts directory of outputDir in the given format, next
+// to the JSON returned by the API, which keeps the editor document as is. It returns the
+// paths of the rendered drafts.
+func SaveDrafts(drafts []Draft, outputDir string, format string) ([]string, error) {
+	var paths []string
+	for _, draft := range drafts {
+		dir := filepath.Join(outputDir, DraftsDir)
+		if draft.Scheduled {
+			dir = filepath.Join(dir, DraftKindScheduled)
+		}
+		base := filepath.Join(dir, draft.FileName())
+
+		post, err := draft.ToPost()
+		if err != nil {
+			return paths, err
+		}
+		path := base + "." + format
+		if err := post.WriteToFile(path, format, false); err != nil {
+			return paths, fmt.Errorf("failed to write draft %d: %w", draft.ID, err)
+		}
+		paths = append(paths, path)
+
+		if len(draft.raw) > 0 {
+			if err := os.WriteFile(base+".json", draft.raw, 0644); err != nil {
+				return paths, fmt.Errorf("failed to write draft %d: %w", draft.ID, err)
+			}
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,107 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test backing up the drafts and scheduled posts of a publication
+func TestFetchAndSaveDrafts(t *testing.T) {
+	body := `{"type":"doc","content":[{"type":"paragraph","content":[{"type":"text","text":"Work in progress"}]}]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("substack.sid"); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		var posts []map[string]interface{}
+		switch r.URL.Path {
+		case "/api/v1/post_management/drafts":
+			for i := offset; i < 30 && i < offset+draftsPageSize; i++ {
+				posts = append(posts, map[string]interface{}{
+					"id": i + 1, "draft_title": fmt.Sprintf("Draft %d", i+1), "draft_body": body, "editor_state": "kept",
+				})
+			}
+		case "/api/v1/post_management/scheduled":
+			posts = append(posts, map[string]interface{}{
+				"id": 100, "slug": "coming-soon", "draft_title": "Coming Soon", "draft_body": body, "post_date": "2030-05-01T09:00:00Z",
+			})
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"posts": posts})
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(
+		WithCookie(&http.Cookie{Name: "substack.sid", Value: "secret"}),
+		WithBackOffConfig(backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 0)),
+	)
+	client, err := NewPublicationAPIClient(fetcher, server.URL)
+	require.NoError(t, err)
+
+	drafts, err := FetchDrafts(context.Background(), client, DraftKindDraft)
+	require.NoError(t, err)
+	require.Len(t, drafts, 30)
+	assert.Equal(t, "Draft 1", drafts[0].Title)
+	assert.False(t, drafts[0].Scheduled)
+
+	scheduled, err := FetchDrafts(context.Background(), client, DraftKindScheduled)
+	require.NoError(t, err)
+	require.Len(t, scheduled, 1)
+	assert.True(t, scheduled[0].Scheduled)
+
+	dir := t.TempDir()
+	paths, err := SaveDrafts(append(drafts[:1], scheduled...), dir, "html")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, DraftsDir, "1_draft-1.html"),
+		filepath.Join(dir, DraftsDir, DraftKindScheduled, "20300501_090000_coming-soon.html"),
+	}, paths)
+
+	content, err := os.ReadFile(paths[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "Draft 1")
+	assert.Contains(t, string(content), "Work in progress")
+
+	// The JSON of the API is kept as is
+	raw, err := os.ReadFile(filepath.Join(dir, DraftsDir, "1_draft-1.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), `"editor_state":"kept"`)
+
+	_, err = FetchDrafts(context.Background(), client, "published")
+	assert.Error(t, err)
+
+	// Without the cookie of an owner
+	anonymous, err := NewPublicationAPIClient(NewFetcher(WithBackOffConfig(backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 0))), server.URL)
+	require.NoError(t, err)
+	_, err = FetchDrafts(context.Background(), anonymous, DraftKindDraft)
+	assert.ErrorIs(t, err, ErrAPIUnauthorized)
+}
+
+func TestDraftFileName(t *testing.T) {
+	assert.Equal(t, "12_my-first-draft", (&Draft{ID: 12, Title: "My First Draft!"}).FileName())
+	assert.Equal(t, "12_untitled", (&Draft{ID: 12}).FileName())
+	assert.Equal(t, "12_slug", (&Draft{ID: 12, Slug: "slug", Title: "Title"}).FileName())
+	// Scheduled posts without a valid date are named like drafts
+	assert.Equal(t, "12_slug", (&Draft{ID: 12, Slug: "slug", Scheduled: true}).FileName())
+	assert.Equal(t, "20240102_030405_slug", (&Draft{ID: 12, Slug: "slug", Scheduled: true, PostDate: "2024-01-02T03:04:05Z"}).FileName())
+
+	post, err := (&Draft{ID: 3, Body: ""}).ToPost()
+	require.NoError(t, err)
+	assert.Equal(t, "Untitled", post.Title)
+	_, err = (&Draft{ID: 3, Body: "not json"}).ToPost()
+	assert.Error(t, err)
+}
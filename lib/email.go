@@ -0,0 +1,111 @@
+package lib
+
+import (
+	"html"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// PostPublication is the metadata of the publication of a post, from the page it was extracted from
+type PostPublication struct {
+	Name           string `json:"name"`
+	LogoURL        string `json:"logo_url"`
+	EmailBannerURL string `json:"email_banner_url"` // header image of the emails of the publication
+	AuthorName     string `json:"author_name"`
+	Copyright      string `json:"copyright"`
+}
+
+// EmailLayoutHTML returns the body of a post laid out as in the email sent to subscribers: the
+// header image of the publication, or its logo and name, the subtitle, the authors and the date
+// of the post above the body, and the footer of the publication below it. The title of the post
+// is left to the writer, as for any body.
+func EmailLayoutHTML(post Post) string {
+	var sb strings.Builder
+	sb.WriteString(emailHeaderHTML(post))
+	sb.WriteString(post.BodyHTML)
+	sb.WriteString(emailFooterHTML(post))
+	return sb.String()
+}
+
+// emailHeaderHTML returns the header of the email of a post
+func emailHeaderHTML(post Post) string {
+	pub := post.Publication
+	var sb strings.Builder
+	sb.WriteString(`<div class="email-header">`)
+	switch {
+	case pub.EmailBannerURL != "":
+		sb.WriteString(`<p class="email-banner"><img src="` + html.EscapeString(pub.EmailBannerURL) + `" alt="` + html.EscapeString(pub.Name) + `"></p>`)
+	case pub.Name != "":
+		sb.WriteString(`<p class="email-publication">`)
+		if pub.LogoURL != "" {
+			sb.WriteString(`<img src="` + html.EscapeString(pub.LogoURL) + `" alt="" width="40" height="40"> `)
+		}
+		sb.WriteString("<strong>" + html.EscapeString(pub.Name) + "</strong></p>")
+	}
+	if post.Subtitle != "" {
+		sb.WriteString(`<h3 class="email-subtitle">` + html.EscapeString(post.Subtitle) + "</h3>")
+	}
+	var byline []string
+	if authors := emailAuthors(post); authors != "" {
+		byline = append(byline, html.EscapeString(authors))
+	}
+	if t, err := time.Parse(time.RFC3339, post.PostDate); err == nil {
+		byline = append(byline, t.Format("Jan 2, 2006"))
+	}
+	if len(byline) > 0 {
+		sb.WriteString(`<p class="email-byline">` + strings.Join(byline, " · ") + "</p>")
+	}
+	sb.WriteString("</div>\n")
+	return sb.String()
+}
+
+// emailFooterHTML returns the footer of the email of a post
+func emailFooterHTML(post Post) string {
+	pub := post.Publication
+	var sb strings.Builder
+	sb.WriteString("\n" + `<div class="email-footer"><hr>`)
+	if post.CanonicalUrl != "" {
+		link := html.EscapeString(post.CanonicalUrl)
+		sb.WriteString(`<p><a href="` + link + `">View this post on the web</a></p>`)
+	}
+	owner := pub.Copyright
+	if owner == "" {
+		owner = pub.AuthorName
+	}
+	if owner != "" {
+		year := ""
+		if t, err := time.Parse(time.RFC3339, post.PostDate); err == nil {
+			year = t.Format("2006") + " "
+		}
+		sb.WriteString("<p>© " + year + html.EscapeString(owner) + "</p>")
+	}
+	name := pub.Name
+	if name == "" {
+		if u, err := url.Parse(post.CanonicalUrl); err == nil {
+			name = u.Host
+		}
+	}
+	if name != "" {
+		sb.WriteString("<p>You're receiving this email because you subscribed to " + html.EscapeString(name) + ".</p>")
+	}
+	sb.WriteString("</div>\n")
+	return sb.String()
+}
+
+// emailAuthors returns the names of the authors of a post, as in the byline of its email
+func emailAuthors(post Post) string {
+	var names []string
+	for _, byline := range post.Bylines {
+		if byline.Name != "" {
+			names = append(names, byline.Name)
+		}
+	}
+	switch len(names) {
+	case 0:
+		return post.Publication.AuthorName
+	case 1:
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
@@ -0,0 +1,64 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test laying a post out as in the email sent to subscribers
+func TestEmailLayoutHTML(t *testing.T) {
+	post := Post{
+		Title:        "Weekly notes",
+		Subtitle:     "What happened this week",
+		PostDate:     "2024-03-05T08:00:00Z",
+		CanonicalUrl: "https://example.substack.com/p/weekly-notes",
+		BodyHTML:     "<p>Hello</p>",
+		Bylines:      []PostByline{{Name: "Jane Doe"}, {Name: "John Roe"}},
+		Publication:  PostPublication{Name: "Example & Co", LogoURL: "https://substackcdn.com/logo.png", Copyright: "Jane Doe"},
+	}
+
+	content := EmailLayoutHTML(post)
+	assert.Contains(t, content, `<img src="https://substackcdn.com/logo.png" alt="" width="40" height="40"> <strong>Example &amp; Co</strong>`)
+	assert.Contains(t, content, `<h3 class="email-subtitle">What happened this week</h3>`)
+	assert.Contains(t, content, `<p class="email-byline">Jane Doe and John Roe · Mar 5, 2024</p>`)
+	assert.Contains(t, content, `<a href="https://example.substack.com/p/weekly-notes">View this post on the web</a>`)
+	assert.Contains(t, content, "<p>© 2024 Jane Doe</p>")
+	assert.Contains(t, content, "you subscribed to Example &amp; Co.")
+	assert.True(t, strings.Index(content, "email-byline") < strings.Index(content, "<p>Hello</p>"))
+	assert.True(t, strings.Index(content, "<p>Hello</p>") < strings.Index(content, "email-footer"))
+
+	// The header image replaces the logo and name
+	post.Publication.EmailBannerURL = "https://substackcdn.com/banner.png"
+	content = EmailLayoutHTML(post)
+	assert.Contains(t, content, `<p class="email-banner"><img src="https://substackcdn.com/banner.png" alt="Example &amp; Co"></p>`)
+	assert.NotContains(t, content, "email-publication")
+}
+
+// Test writing posts in the email layout, with the publication of their page
+func TestEmailLayoutDownload(t *testing.T) {
+	data := `{"post":{"id":1,"slug":"my-post","title":"My Post","post_date":"2024-01-01T12:00:00Z","body_html":"<p>Hello</p>"},"pub":{"name":"My Letter","author_name":"Jane Doe","language":"en"}}`
+	post, err := (&RawPost{str: data}).ToPost()
+	require.NoError(t, err)
+	assert.Equal(t, PostPublication{Name: "My Letter", AuthorName: "Jane Doe"}, post.Publication)
+
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = t.TempDir()
+	opts.EmailLayout = true
+	result := NewDownloader(nil, opts).WritePost(context.Background(), post)
+	require.NoError(t, result.Err)
+
+	content, err := os.ReadFile(result.Path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `<p class="email-byline">Jane Doe · Jan 1, 2024</p>`)
+	assert.Contains(t, string(content), "<p>© 2024 Jane Doe</p>")
+
+	manifestOpts := opts.ManifestOptions()
+	assert.True(t, manifestOpts.EmailLayout)
+	assert.True(t, manifestOpts.DownloadOptions(".").EmailLayout)
+	assert.Contains(t, ReproduceCommand("https://example.com/p/a", manifestOpts, "."), "--email-layout")
+}
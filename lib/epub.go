@@ -0,0 +1,402 @@
+package lib
+
+import (
+	"archive/zip"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// epubMediaTypes maps the image extensions that can be embedded in an EPUB to their media type
+var epubMediaTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".svg":  "image/svg+xml",
+}
+
+// EPUB is an EPUB 3 book made of HTML chapters
+type EPUB struct {
+	Title       string
+	Author      string
+	Language    string
+	Identifier  string
+	Description string
+	Date        time.Time
+
+	chapters  []epubChapter
+	resources []epubResource
+	embedded  map[string]string // source path -> resource href
+	cover     string            // href of the cover image, if any
+}
+
+// epubChapter is a chapter of the book, stored as an XHTML document
+type epubChapter struct {
+	ID    string
+	Href  string
+	Title string
+	Body  string
+}
+
+// epubResource is a file embedded in the book, such as an image
+type epubResource struct {
+	ID        string
+	Href      string
+	MediaType string
+	Data      []byte
+}
+
+// NewEPUB creates an empty book with the given title
+func NewEPUB(title string) *EPUB {
+	return &EPUB{
+		Title:      title,
+		Language:   "en",
+		Identifier: fmt.Sprintf("urn:sbstck-dl:%d", time.Now().UnixNano()),
+		Date:       time.Now(),
+		embedded:   make(map[string]string),
+	}
+}
+
+// AddChapter adds a chapter from an HTML fragment. Images referenced with a relative
+// path are read from baseDir and embedded in the book. Scripts and other interactive
+// elements are removed.
+func (e *EPUB) AddChapter(title string, htmlContent string, baseDir string) error {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	if err != nil {
+		return fmt.Errorf("failed to parse chapter %q: %w", title, err)
+	}
+
+	doc.Find("script, noscript, iframe, form, input, button, style, link, meta").Remove()
+
+	doc.Find("img").Each(func(i int, img *goquery.Selection) {
+		img.RemoveAttr("srcset")
+		img.RemoveAttr("sizes")
+		src, _ := img.Attr("src")
+		if href, ok := e.embedImage(src, baseDir); ok {
+			img.SetAttr("src", href)
+		}
+		if _, ok := img.Attr("alt"); !ok {
+			img.SetAttr("alt", "")
+		}
+	})
+	// Local pictures are embedded through their <img>, so drop the alternative sources
+	doc.Find("picture source").Remove()
+
+	body, err := doc.Find("body").Html()
+	if err != nil {
+		return fmt.Errorf("failed to render chapter %q: %w", title, err)
+	}
+
+	n := len(e.chapters) + 1
+	e.chapters = append(e.chapters, epubChapter{
+		ID:    fmt.Sprintf("chapter-%03d", n),
+		Href:  fmt.Sprintf("chapter-%03d.xhtml", n),
+		Title: title,
+		Body:  body,
+	})
+	return nil
+}
+
+// SetCoverImage uses the image file as the cover of the book
+func (e *EPUB) SetCoverImage(imagePath string) error {
+	href, ok := e.embedImage(filepath.Base(imagePath), filepath.Dir(imagePath))
+	if !ok {
+		return fmt.Errorf("unsupported cover image: %s", imagePath)
+	}
+	e.cover = href
+	return nil
+}
+
+// SetCoverData uses the image data as the cover of the book.
+// The extension (e.g. ".svg") gives the type of the image.
+func (e *EPUB) SetCoverData(ext string, data []byte) error {
+	href, ok := e.addResource(strings.ToLower(ext), data)
+	if !ok {
+		return fmt.Errorf("unsupported cover image type: %s", ext)
+	}
+	e.cover = href
+	return nil
+}
+
+// ChapterCount returns the number of chapters of the book
+func (e *EPUB) ChapterCount() int {
+	return len(e.chapters)
+}
+
+// embedImage adds a local image to the book and returns its href inside the book.
+// Remote images and missing files are not embedded.
+func (e *EPUB) embedImage(src string, baseDir string) (string, bool) {
+	if src == "" || strings.Contains(src, "://") || strings.HasPrefix(src, "data:") || strings.HasPrefix(src, "//") {
+		return "", false
+	}
+	if unescaped, err := url.PathUnescape(src); err == nil {
+		src = unescaped
+	}
+
+	filePath := filepath.Join(baseDir, filepath.FromSlash(src))
+	if href, ok := e.embedded[filePath]; ok {
+		return href, true
+	}
+
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if _, ok := epubMediaTypes[ext]; !ok {
+		return "", false
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", false
+	}
+
+	href, ok := e.addResource(ext, data)
+	if ok {
+		e.embedded[filePath] = href
+	}
+	return href, ok
+}
+
+// addResource adds an image to the book and returns its href inside the book
+func (e *EPUB) addResource(ext string, data []byte) (string, bool) {
+	mediaType, ok := epubMediaTypes[ext]
+	if !ok {
+		return "", false
+	}
+
+	n := len(e.resources) + 1
+	href := fmt.Sprintf("images/image-%03d%s", n, ext)
+	e.resources = append(e.resources, epubResource{
+		ID:        fmt.Sprintf("image-%03d", n),
+		Href:      href,
+		MediaType: mediaType,
+		Data:      data,
+	})
+	return href, true
+}
+
+// WriteFile writes the book to the given path
+func (e *EPUB) WriteFile(filePath string) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if err := e.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write writes the book as an EPUB archive
+func (e *EPUB) Write(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	// The mimetype must be the first entry and must not be compressed
+	mw, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mw, "application/epub+zip"); err != nil {
+		return err
+	}
+
+	data := epubTemplateData{EPUB: e, Chapters: e.chapters, Resources: e.resources, CoverHref: e.cover}
+	files := []epubTemplateFile{
+		{"META-INF/container.xml", epubContainerTemplate, nil},
+		{"OEBPS/content.opf", epubPackageTemplate, data},
+		{"OEBPS/nav.xhtml", epubNavTemplate, data},
+		{"OEBPS/toc.ncx", epubNCXTemplate, data},
+	}
+	if e.cover != "" {
+		files = append(files, epubTemplateFile{"OEBPS/cover.xhtml", epubCoverTemplate, data})
+	}
+	for _, chapter := range e.chapters {
+		files = append(files, epubTemplateFile{path.Join("OEBPS", chapter.Href), epubChapterTemplate, epubChapterData{data, chapter}})
+	}
+
+	for _, file := range files {
+		fw, err := zw.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if err := file.tmpl.Execute(fw, file.data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+
+	sw, err := zw.Create("OEBPS/style.css")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(sw, epubStyle); err != nil {
+		return err
+	}
+
+	for _, resource := range e.resources {
+		rw, err := zw.Create(path.Join("OEBPS", resource.Href))
+		if err != nil {
+			return err
+		}
+		if _, err := rw.Write(resource.Data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// epubTemplateFile is a file of the book rendered from a template
+type epubTemplateFile struct {
+	name string
+	tmpl *template.Template
+	data interface{}
+}
+
+// epubTemplateData is the data available to the book templates
+type epubTemplateData struct {
+	*EPUB
+	Chapters  []epubChapter
+	Resources []epubResource
+	CoverHref string
+}
+
+// epubChapterData is the data available to the chapter template
+type epubChapterData struct {
+	epubTemplateData
+	Chapter epubChapter
+}
+
+// epubFuncs escapes values for XML, as the EPUB templates use text/template
+var epubFuncs = template.FuncMap{
+	"xml": html.EscapeString,
+	"date": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02T15:04:05Z")
+	},
+	"inc": func(i int) int {
+		return i + 1
+	},
+}
+
+const epubStyle = `body { font-family: Georgia, serif; line-height: 1.5; margin: 0 5%; }
+h1 { font-size: 1.6em; margin-top: 1em; }
+img { max-width: 100%; height: auto; }
+figure { margin: 1em 0; text-align: center; }
+figcaption { font-size: 0.85em; color: #555; }
+blockquote { border-left: 3px solid #ccc; margin-left: 0; padding-left: 1em; color: #444; }
+pre { white-space: pre-wrap; font-size: 0.85em; }
+.cover { text-align: center; margin: 0; padding: 0; }
+.cover img { max-height: 100%; }
+`
+
+var epubContainerTemplate = template.Must(template.New("container").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`))
+
+var epubPackageTemplate = template.Must(template.New("package").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">{{xml .Identifier}}</dc:identifier>
+    <dc:title>{{xml .Title}}</dc:title>
+    <dc:language>{{xml .Language}}</dc:language>
+    {{if .Author}}<dc:creator>{{xml .Author}}</dc:creator>{{end}}
+    {{if .Description}}<dc:description>{{xml .Description}}</dc:description>{{end}}
+    <dc:date>{{date .Date}}</dc:date>
+    <meta property="dcterms:modified">{{date .Date}}</meta>
+    {{if .CoverHref}}<meta name="cover" content="cover-image"/>{{end}}
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="style" href="style.css" media-type="text/css"/>
+    {{if .CoverHref}}<item id="cover" href="cover.xhtml" media-type="application/xhtml+xml"/>{{end}}
+    {{range .Chapters}}<item id="{{.ID}}" href="{{.Href}}" media-type="application/xhtml+xml"/>
+    {{end}}{{range .Resources}}<item id="{{if eq .Href $.CoverHref}}cover-image{{else}}{{.ID}}{{end}}" href="{{.Href}}" media-type="{{.MediaType}}"{{if eq .Href $.CoverHref}} properties="cover-image"{{end}}/>
+    {{end}}
+  </manifest>
+  <spine toc="ncx">
+    {{if .CoverHref}}<itemref idref="cover" linear="no"/>{{end}}
+    {{range .Chapters}}<itemref idref="{{.ID}}"/>
+    {{end}}
+  </spine>
+</package>
+`))
+
+var epubNavTemplate = template.Must(template.New("nav").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="{{xml .Language}}" xml:lang="{{xml .Language}}">
+<head>
+  <meta charset="UTF-8"/>
+  <title>{{xml .Title}}</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <h1>Contents</h1>
+    <ol>
+      {{range .Chapters}}<li><a href="{{.Href}}">{{xml .Title}}</a></li>
+      {{end}}
+    </ol>
+  </nav>
+</body>
+</html>
+`))
+
+var epubNCXTemplate = template.Must(template.New("ncx").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head>
+    <meta name="dtb:uid" content="{{xml .Identifier}}"/>
+  </head>
+  <docTitle><text>{{xml .Title}}</text></docTitle>
+  <navMap>
+    {{range $i, $c := .Chapters}}<navPoint id="nav-{{$c.ID}}" playOrder="{{inc $i}}">
+      <navLabel><text>{{xml $c.Title}}</text></navLabel>
+      <content src="{{$c.Href}}"/>
+    </navPoint>
+    {{end}}
+  </navMap>
+</ncx>
+`))
+
+var epubCoverTemplate = template.Must(template.New("cover").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="{{xml .Language}}" xml:lang="{{xml .Language}}">
+<head>
+  <meta charset="UTF-8"/>
+  <title>{{xml .Title}}</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body class="cover" epub:type="cover">
+  <img src="{{.CoverHref}}" alt="{{xml .Title}}"/>
+</body>
+</html>
+`))
+
+var epubChapterTemplate = template.Must(template.New("chapter").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="{{xml .Language}}" xml:lang="{{xml .Language}}">
+<head>
+  <meta charset="UTF-8"/>
+  <title>{{xml .Chapter.Title}}</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+{{.Chapter.Body}}
+</body>
+</html>
+`))
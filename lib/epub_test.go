@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readZipEntries returns the content of every file of a zip archive, in order
+func readZipEntries(t *testing.T, data []byte) ([]string, map[string]string) {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	var names []string
+	contents := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		names = append(names, f.Name)
+		contents[f.Name] = string(b)
+	}
+	return names, contents
+}
+
+// Test writing an EPUB book
+func TestEPUB(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(tempDir, "images"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "images", "cat.jpg"), []byte("fake jpeg"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "cover.png"), []byte("fake png"), 0644))
+
+	book := NewEPUB("My <Newsletter>")
+	book.Author = "Jane & John"
+	require.NoError(t, book.AddChapter("First", `<h1>First</h1><p>Hello<br>world</p><img src="images/cat.jpg"><script>alert(1)</script>`, tempDir))
+	require.NoError(t, book.AddChapter("Second", `<p>Remote <img src="https://example.com/a.jpg" alt="remote"></p>`, tempDir))
+	require.NoError(t, book.SetCoverImage(filepath.Join(tempDir, "cover.png")))
+	assert.Equal(t, 2, book.ChapterCount())
+	assert.Error(t, book.SetCoverImage(filepath.Join(tempDir, "missing.png")))
+
+	var buf bytes.Buffer
+	require.NoError(t, book.Write(&buf))
+	names, contents := readZipEntries(t, buf.Bytes())
+
+	require.NotEmpty(t, names)
+	assert.Equal(t, "mimetype", names[0])
+	assert.Equal(t, "application/epub+zip", contents["mimetype"])
+	assert.Contains(t, contents["META-INF/container.xml"], "OEBPS/content.opf")
+
+	opf := contents["OEBPS/content.opf"]
+	assert.Contains(t, opf, "<dc:title>My &lt;Newsletter&gt;</dc:title>")
+	assert.Contains(t, opf, "<dc:creator>Jane &amp; John</dc:creator>")
+	assert.Contains(t, opf, `href="chapter-001.xhtml"`)
+	assert.Contains(t, opf, `href="chapter-002.xhtml"`)
+	assert.Contains(t, opf, `properties="cover-image"`)
+	assert.Contains(t, opf, `media-type="image/png"`)
+
+	assert.Contains(t, contents["OEBPS/nav.xhtml"], `<a href="chapter-002.xhtml">Second</a>`)
+	assert.Contains(t, contents["OEBPS/toc.ncx"], `playOrder="2"`)
+	assert.Contains(t, contents["OEBPS/cover.xhtml"], `<img src="images/image-002.png"`)
+	assert.Equal(t, "fake jpeg", contents["OEBPS/images/image-001.jpg"])
+	assert.Equal(t, "fake png", contents["OEBPS/images/image-002.png"])
+
+	chapter := contents["OEBPS/chapter-001.xhtml"]
+	assert.Contains(t, chapter, `<html xmlns="http://www.w3.org/1999/xhtml"`)
+	assert.Contains(t, chapter, "<br/>")
+	assert.Contains(t, chapter, `<img src="images/image-001.jpg" alt=""/>`)
+	assert.NotContains(t, chapter, "<script>")
+	assert.Contains(t, contents["OEBPS/chapter-002.xhtml"], `src="https://example.com/a.jpg"`)
+
+	t.Run("write file", func(t *testing.T) {
+		path := filepath.Join(tempDir, "out", "book.epub")
+		require.NoError(t, book.WriteFile(path))
+		assert.FileExists(t, path)
+	})
+}
@@ -0,0 +1,324 @@
+package lib
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExportFormats lists the formats of the books produced by ExportBook
+var ExportFormats = []string{"epub", "pdf", "md"}
+
+// ExportOptions configures the book produced by ExportBook
+type ExportOptions struct {
+	Format     string // "epub", "pdf" or "md"
+	Title      string
+	Subtitle   string // defaults to the date range of the posts
+	Author     string
+	CoverImage string       // path of an image for the cover; a cover is generated when empty
+	Logo       string       // path of the publication logo, drawn on the generated cover
+	NoComments bool         // leave out the appendix of the comments downloaded with the posts
+	Order      ReadingOrder // order of the chapters, oldest first unless ReadingOrderNewestFirst
+	KeepOrder  bool         // keep the chapters in the order of the posts given, ignoring Order
+}
+
+// SelectLocalPosts keeps the posts matching at least one of the glob patterns.
+// Patterns are matched against the post date (YYYY-MM-DD, e.g. "2023-*") and the slug.
+// All posts are kept when no pattern is given.
+func SelectLocalPosts(posts []LocalPost, patterns []string) ([]LocalPost, error) {
+	if len(patterns) == 0 {
+		return posts, nil
+	}
+
+	var selected []LocalPost
+	for _, post := range posts {
+		date := ""
+		if !post.Date.IsZero() {
+			date = post.Date.Format("2006-01-02")
+		}
+		for _, pattern := range patterns {
+			matchDate, err := path.Match(pattern, date)
+			if err != nil {
+				return nil, fmt.Errorf("invalid selection pattern %q: %w", pattern, err)
+			}
+			matchSlug, _ := path.Match(pattern, post.Slug)
+			if (matchDate && date != "") || matchSlug {
+				selected = append(selected, post)
+				break
+			}
+		}
+	}
+	return selected, nil
+}
+
+// LoadSlugList reads a list of posts from a file with one post slug or URL per line, in the
+// order of the book. Blank lines and lines starting with # are ignored.
+func LoadSlugList(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read slug list: %w", err)
+	}
+
+	var slugs []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.Contains(line, "/") {
+			if i := strings.IndexAny(line, "?#"); i >= 0 {
+				line = line[:i]
+			}
+			line = SlugFromURL(strings.TrimRight(line, "/"))
+		}
+		slugs = append(slugs, line)
+	}
+	if len(slugs) == 0 {
+		return nil, fmt.Errorf("no slugs in %s", path)
+	}
+	return slugs, nil
+}
+
+// SelectLocalPostsBySlug keeps the posts whose slug is listed, in the order of the list.
+// It fails if a listed post wasn't downloaded, so that a book never misses a part silently.
+func SelectLocalPostsBySlug(posts []LocalPost, slugs []string) ([]LocalPost, error) {
+	bySlug := make(map[string][]LocalPost)
+	for _, post := range posts {
+		bySlug[post.Slug] = append(bySlug[post.Slug], post)
+	}
+
+	var selected []LocalPost
+	var missing []string
+	seen := make(map[string]bool)
+	for _, slug := range slugs {
+		if seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		if _, ok := bySlug[slug]; !ok {
+			missing = append(missing, slug)
+			continue
+		}
+		selected = append(selected, bySlug[slug]...)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("posts not found: %s", strings.Join(missing, ", "))
+	}
+	return selected, nil
+}
+
+// ExportBook compiles posts into a single book written to outputPath, with a cover,
+// a table of contents and one chapter per post in the reading order, followed by an
+// appendix of the comments of the posts downloaded with --comments.
+// When a post was downloaded in several formats, the richest one is used.
+// It returns the number of posts exported.
+func ExportBook(posts []LocalPost, outputPath string, opts ExportOptions) (int, error) {
+	posts, err := PreferredLocalPosts(posts, "")
+	if err != nil {
+		return 0, err
+	}
+	if len(posts) == 0 {
+		return 0, fmt.Errorf("no posts to export")
+	}
+	// Oldest first unless asked otherwise, undated posts last
+	sort.SliceStable(posts, func(i, j int) bool {
+		if opts.KeepOrder {
+			return false
+		}
+		if posts[i].Date.IsZero() || posts[j].Date.IsZero() {
+			return !posts[i].Date.IsZero() && posts[j].Date.IsZero()
+		}
+		if opts.Order == ReadingOrderNewestFirst {
+			return posts[i].Date.After(posts[j].Date)
+		}
+		return posts[i].Date.Before(posts[j].Date)
+	})
+
+	if opts.Subtitle == "" {
+		opts.Subtitle = exportDateRange(posts)
+	}
+
+	switch opts.Format {
+	case "epub":
+		book := NewEPUB(opts.Title)
+		book.Author = opts.Author
+		book.Description = opts.Subtitle
+		if opts.CoverImage != "" {
+			if err := book.SetCoverImage(opts.CoverImage); err != nil {
+				return 0, err
+			}
+		} else if err := book.SetCoverData(".svg", []byte(generateCoverSVG(opts))); err != nil {
+			return 0, err
+		}
+		if err := addExportChapters(book.AddChapter, posts, opts); err != nil {
+			return 0, err
+		}
+		return len(posts), book.WriteFile(outputPath)
+
+	case "pdf":
+		book := NewPDF(opts.Title)
+		book.Subtitle = opts.Subtitle
+		book.Author = opts.Author
+		if opts.CoverImage != "" {
+			if err := book.SetCoverImage(opts.CoverImage); err != nil {
+				return 0, err
+			}
+		}
+		if err := addExportChapters(book.AddChapter, posts, opts); err != nil {
+			return 0, err
+		}
+		return len(posts), book.WriteFile(outputPath)
+
+	case "md":
+		book := NewMarkdownBook(opts.Title)
+		book.Subtitle = opts.Subtitle
+		book.Author = opts.Author
+		book.CoverImage = opts.CoverImage
+		if err := addExportChapters(book.AddChapter, posts, opts); err != nil {
+			return 0, err
+		}
+		return len(posts), book.WriteFile(outputPath)
+
+	default:
+		return 0, fmt.Errorf("unknown format: %s", opts.Format)
+	}
+}
+
+// addExportChapters adds a chapter per post, then a chapter per post with comments
+func addExportChapters(addChapter func(title, htmlContent, baseDir string) error, posts []LocalPost, opts ExportOptions) error {
+	for _, post := range posts {
+		if err := addChapter(post.Title, exportChapterHTML(post), filepath.Dir(post.Path)); err != nil {
+			return err
+		}
+	}
+	if opts.NoComments {
+		return nil
+	}
+	for _, post := range posts {
+		comments, err := LoadPostComments(post.Path)
+		if err != nil {
+			return err
+		}
+		if len(comments) == 0 {
+			continue
+		}
+		title := "Comments: " + post.Title
+		content := "<h1>" + html.EscapeString(title) + "</h1>" +
+			fmt.Sprintf(`<p class="post-date"><em>%d comments</em></p>`, CountPostComments(comments)) +
+			RenderPostCommentsHTML(comments)
+		if err := addChapter(title, content, filepath.Dir(post.Path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportChapterHTML returns the HTML of a post with its date shown below the title
+func exportChapterHTML(post LocalPost) string {
+	content := post.HTML()
+	if post.Date.IsZero() {
+		return content
+	}
+
+	date := `<p class="post-date"><em>` + post.Date.Format("January 2, 2006") + `</em></p>`
+	if i := strings.Index(strings.ToLower(content), "</h1>"); i >= 0 {
+		return content[:i+len("</h1>")] + date + content[i+len("</h1>"):]
+	}
+	return "<h1>" + html.EscapeString(post.Title) + "</h1>" + date + content
+}
+
+// exportDateRange describes the period covered by posts, e.g. "January 2023 – December 2023"
+func exportDateRange(posts []LocalPost) string {
+	var first, last time.Time
+	for _, post := range posts {
+		if post.Date.IsZero() {
+			continue
+		}
+		if first.IsZero() || post.Date.Before(first) {
+			first = post.Date
+		}
+		if post.Date.After(last) {
+			last = post.Date
+		}
+	}
+	if first.IsZero() {
+		return ""
+	}
+	from, to := first.Format("January 2006"), last.Format("January 2006")
+	if from == to {
+		return from
+	}
+	return from + " – " + to
+}
+
+// generateCoverSVG draws a plain cover with the logo of the publication, if any, and the title,
+// subtitle and author of the book
+func generateCoverSVG(opts ExportOptions) string {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	sb.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="600" height="900" viewBox="0 0 600 900">` + "\n")
+	sb.WriteString(`<rect width="600" height="900" fill="#1f2933"/>` + "\n")
+	sb.WriteString(`<rect x="40" y="40" width="520" height="820" fill="none" stroke="#f5f7fa" stroke-width="2"/>` + "\n")
+	if logo := imageDataURI(opts.Logo); logo != "" {
+		fmt.Fprintf(&sb, `<image x="240" y="110" width="120" height="120" xlink:href="%s"/>`+"\n", logo)
+	}
+
+	y := 300
+	for _, line := range wrapWords(opts.Title, 20) {
+		fmt.Fprintf(&sb, `<text x="300" y="%d" text-anchor="middle" font-family="Georgia, serif" font-size="44" fill="#f5f7fa">%s</text>`+"\n", y, html.EscapeString(line))
+		y += 56
+	}
+	y += 20
+	for _, line := range wrapWords(opts.Subtitle, 36) {
+		fmt.Fprintf(&sb, `<text x="300" y="%d" text-anchor="middle" font-family="Georgia, serif" font-size="24" fill="#cbd2d9">%s</text>`+"\n", y, html.EscapeString(line))
+		y += 32
+	}
+	if opts.Author != "" {
+		fmt.Fprintf(&sb, `<text x="300" y="800" text-anchor="middle" font-family="Georgia, serif" font-size="26" fill="#f5f7fa">%s</text>`+"\n", html.EscapeString(opts.Author))
+	}
+	sb.WriteString("</svg>\n")
+	return sb.String()
+}
+
+// imageDataURI returns the image at path as a data URI, or "" if it can't be read or
+// isn't of a type that can be embedded in an EPUB
+func imageDataURI(path string) string {
+	if path == "" {
+		return ""
+	}
+	mediaType, ok := epubMediaTypes[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// wrapWords splits text into lines of at most width characters, breaking between words
+func wrapWords(text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && len([]rune(line))+1+len([]rune(word)) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
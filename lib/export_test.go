@@ -0,0 +1,191 @@
+package lib
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test selecting posts by date or slug
+func TestSelectLocalPosts(t *testing.T) {
+	tempDir := createLocalArchive(t)
+	defer os.RemoveAll(tempDir)
+
+	posts, err := ScanLocalPosts(tempDir)
+	require.NoError(t, err)
+
+	slugs := func(posts []LocalPost) []string {
+		var s []string
+		for _, post := range posts {
+			s = append(s, post.Slug)
+		}
+		return s
+	}
+
+	selected, err := SelectLocalPosts(posts, nil)
+	require.NoError(t, err)
+	assert.Len(t, selected, 4)
+
+	selected, err = SelectLocalPosts(posts, []string{"2023-0[12]-*"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"second-post", "first-post"}, slugs(selected))
+
+	selected, err = SelectLocalPosts(posts, []string{"2022-*", "undated-*"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"undated-post"}, slugs(selected))
+
+	// Undated posts don't match date patterns
+	selected, err = SelectLocalPosts(posts, []string{"*"})
+	require.NoError(t, err)
+	assert.Len(t, selected, 4)
+
+	_, err = SelectLocalPosts(posts, []string{"2023-["})
+	assert.Error(t, err)
+}
+
+// Test selecting posts from a list of slugs
+func TestSelectLocalPostsBySlug(t *testing.T) {
+	tempDir := createLocalArchive(t)
+	defer os.RemoveAll(tempDir)
+
+	posts, err := ScanLocalPosts(tempDir)
+	require.NoError(t, err)
+
+	listPath := filepath.Join(tempDir, "course.txt")
+	list := "# Part one\nthird-post\n\nhttps://example.substack.com/p/first-post?utm_source=x\n  second-post  \nthird-post\n"
+	require.NoError(t, os.WriteFile(listPath, []byte(list), 0644))
+
+	slugs, err := LoadSlugList(listPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"third-post", "first-post", "second-post", "third-post"}, slugs)
+
+	// The order of the list is kept, each post once
+	selected, err := SelectLocalPostsBySlug(posts, slugs)
+	require.NoError(t, err)
+	require.Len(t, selected, 3)
+	assert.Equal(t, "third-post", selected[0].Slug)
+	assert.Equal(t, "first-post", selected[1].Slug)
+	assert.Equal(t, "second-post", selected[2].Slug)
+
+	_, err = SelectLocalPostsBySlug(posts, []string{"first-post", "missing-post"})
+	assert.ErrorContains(t, err, "missing-post")
+
+	require.NoError(t, os.WriteFile(listPath, []byte("# nothing yet\n"), 0644))
+	_, err = LoadSlugList(listPath)
+	assert.Error(t, err)
+	_, err = LoadSlugList(filepath.Join(tempDir, "missing.txt"))
+	assert.Error(t, err)
+}
+
+// Test compiling posts into a book
+func TestExportBook(t *testing.T) {
+	tempDir := createLocalArchive(t)
+	defer os.RemoveAll(tempDir)
+
+	posts, err := ScanLocalPosts(tempDir)
+	require.NoError(t, err)
+
+	assert.Equal(t, "January 2023 – March 2023", exportDateRange([]LocalPost{posts[2], posts[1], posts[0]}))
+	assert.Equal(t, "March 2023", exportDateRange(posts[:1]))
+
+	chapter := exportChapterHTML(posts[2])
+	assert.Equal(t, `<h1>First Post</h1><p class="post-date"><em>January 1, 2023</em></p>`+"\n<p>The quick brown fox jumps over the lazy dog.</p>", chapter)
+
+	t.Run("epub", func(t *testing.T) {
+		path := filepath.Join(tempDir, "book.epub")
+		chapters, err := ExportBook(posts, path, ExportOptions{Format: "epub", Title: "My Newsletter", Author: "Jane Doe"})
+		require.NoError(t, err)
+		assert.Equal(t, 4, chapters)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		_, contents := readZipEntries(t, data)
+		opf := contents["OEBPS/content.opf"]
+		assert.Contains(t, opf, "<dc:title>My Newsletter</dc:title>")
+		assert.Contains(t, opf, "Jane Doe")
+		assert.Contains(t, opf, "image/svg+xml")
+
+		// Chronological order, undated posts last
+		nav := contents["OEBPS/nav.xhtml"]
+		first := bytes.Index([]byte(nav), []byte("First Post"))
+		third := bytes.Index([]byte(nav), []byte("Third Post"))
+		undated := bytes.Index([]byte(nav), []byte("Undated Post"))
+		assert.True(t, first >= 0 && first < third && third < undated)
+	})
+
+	t.Run("pdf", func(t *testing.T) {
+		path := filepath.Join(tempDir, "book.pdf")
+		chapters, err := ExportBook(posts[:2], path, ExportOptions{Format: "pdf", Title: "My Newsletter"})
+		require.NoError(t, err)
+		assert.Equal(t, 2, chapters)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(data, []byte("%PDF-")))
+		assert.Contains(t, string(data), pdfTextString("Second Post"))
+	})
+
+	t.Run("md", func(t *testing.T) {
+		selected, err := SelectLocalPostsBySlug(posts, []string{"third-post", "first-post"})
+		require.NoError(t, err)
+
+		path := filepath.Join(tempDir, "book.md")
+		chapters, err := ExportBook(selected, path, ExportOptions{Format: "md", Title: "My Course", KeepOrder: true, NoComments: true})
+		require.NoError(t, err)
+		assert.Equal(t, 2, chapters)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		book := string(data)
+		assert.True(t, strings.HasPrefix(book, "# My Course\n"))
+		// The order of the selection is kept
+		assert.Contains(t, book, "1. Third Post\n2. First Post\n")
+		assert.Less(t, strings.Index(book, "Climate change"), strings.Index(book, "The quick brown fox"))
+	})
+
+	t.Run("comments", func(t *testing.T) {
+		require.NoError(t, SavePostComments(posts[2].Path, testPostComments()))
+		defer os.Remove(PostCommentsPath(posts[2].Path))
+
+		path := filepath.Join(tempDir, "comments.epub")
+		chapters, err := ExportBook(posts, path, ExportOptions{Format: "epub", Title: "My Newsletter"})
+		require.NoError(t, err)
+		assert.Equal(t, 4, chapters)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		_, contents := readZipEntries(t, data)
+		// The appendix follows the posts
+		nav := contents["OEBPS/nav.xhtml"]
+		undated := bytes.Index([]byte(nav), []byte("Undated Post"))
+		appendix := bytes.Index([]byte(nav), []byte("Comments: First Post"))
+		assert.True(t, undated >= 0 && appendix > undated)
+		assert.Contains(t, contents["OEBPS/chapter-005.xhtml"], "in reply to Alice")
+
+		path = filepath.Join(tempDir, "no-comments.epub")
+		_, err = ExportBook(posts, path, ExportOptions{Format: "epub", Title: "My Newsletter", NoComments: true})
+		require.NoError(t, err)
+		data, err = os.ReadFile(path)
+		require.NoError(t, err)
+		_, contents = readZipEntries(t, data)
+		assert.NotContains(t, contents["OEBPS/nav.xhtml"], "Comments: First Post")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := ExportBook(nil, filepath.Join(tempDir, "empty.epub"), ExportOptions{Format: "epub"})
+		assert.Error(t, err)
+		_, err = ExportBook(posts, filepath.Join(tempDir, "book.doc"), ExportOptions{Format: "doc"})
+		assert.Error(t, err)
+	})
+
+	t.Run("cover", func(t *testing.T) {
+		svg := generateCoverSVG(ExportOptions{Title: "A Rather Long Newsletter Title", Subtitle: "2023", Author: "Tom & Jerry"})
+		assert.Contains(t, svg, ">A Rather Long<")
+		assert.Contains(t, svg, "Tom &amp; Jerry")
+	})
+}
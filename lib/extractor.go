@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
+	"io"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
@@ -30,30 +33,104 @@ func (r *RawPost) ToPost() (Post, error) {
 	if err != nil {
 		return Post{}, err
 	}
+	if wrapper.Post.Language == "" {
+		wrapper.Post.Language = wrapper.Pub.Language
+	}
+	wrapper.Post.Publication = wrapper.Pub.PostPublication
 	return wrapper.Post, nil
 }
 
 // Post represents a structured Substack post with various fields.
 type Post struct {
-	Id               int    `json:"id"`
-	PublicationId    int    `json:"publication_id"`
-	Type             string `json:"type"`
-	Slug             string `json:"slug"`
-	PostDate         string `json:"post_date"`
-	CanonicalUrl     string `json:"canonical_url"`
-	PreviousPostSlug string `json:"previous_post_slug"`
-	NextPostSlug     string `json:"next_post_slug"`
-	CoverImage       string `json:"cover_image"`
-	Description      string `json:"description"`
-	Subtitle         string `json:"subtitle,omitempty"`
-	WordCount        int    `json:"wordcount"`
-	Title            string `json:"title"`
-	BodyHTML         string `json:"body_html"`
+	Id               int             `json:"id"`
+	PublicationId    int             `json:"publication_id"`
+	Type             string          `json:"type"`
+	Slug             string          `json:"slug"`
+	PostDate         string          `json:"post_date"`
+	UpdatedAt        string          `json:"updated_at,omitempty"` // when the post was last edited
+	CanonicalUrl     string          `json:"canonical_url"`
+	PreviousPostSlug string          `json:"previous_post_slug"`
+	NextPostSlug     string          `json:"next_post_slug"`
+	CoverImage       string          `json:"cover_image"`
+	Description      string          `json:"description"`
+	Subtitle         string          `json:"subtitle,omitempty"`
+	WordCount        int             `json:"wordcount"`
+	Title            string          `json:"title"`
+	BodyHTML         string          `json:"body_html"`
+	Audience         string          `json:"audience,omitempty"`
+	Tags             []PostTag       `json:"postTags,omitempty"`
+	SectionId        int             `json:"section_id,omitempty"`
+	SectionName      string          `json:"section_name,omitempty"`
+	SectionSlug      string          `json:"section_slug,omitempty"`
+	Bylines          []PostByline    `json:"publishedBylines,omitempty"`
+	ReactionCount    int             `json:"reaction_count,omitempty"`
+	CommentCount     int             `json:"comment_count,omitempty"`
+	Restacks         int             `json:"restacks,omitempty"`
+	AudioItems       []PostAudioItem `json:"audio_items,omitempty"`
+	Language         string          `json:"language,omitempty"` // language of the publication, e.g. "en" or "he"
+	Publication      PostPublication `json:"-"`                  // publication of the post, from the page it was extracted from
+
+	raw string // data embedded in the page the post was extracted from, saved by SaveRawPost
+}
+
+// PostTag represents a tag attached to a Substack post
+type PostTag struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// PostByline represents an author credited on a Substack post
+type PostByline struct {
+	Id     int    `json:"id"`
+	Name   string `json:"name"`
+	Handle string `json:"handle"`
+}
+
+// TagNames returns the names of the post's tags
+func (p *Post) TagNames() []string {
+	var names []string
+	for _, tag := range p.Tags {
+		if tag.Name != "" {
+			names = append(names, tag.Name)
+		}
+	}
+	return names
 }
 
 // Static converter instance to avoid recreating it for each conversion
 var mdConverter = md.NewConverter("", true, nil)
 
+// mdLocalImagesConverter converts posts whose images were downloaded. Their figures, and the
+// images given a size, are kept as HTML so that the alt text, size and caption survive in Markdown.
+var mdLocalImagesConverter = md.NewConverter("", true, nil).AddRules(md.Rule{
+	Filter:      []string{"figure", "img"},
+	Replacement: keepImageHTML,
+})
+
+// blankLinesRegex matches the blank lines that would end an HTML block in Markdown
+var blankLinesRegex = regexp.MustCompile(`\n\s*\n`)
+
+// keepImageHTML renders figures, and images with a width or height outside of them, as HTML
+func keepImageHTML(content string, selec *goquery.Selection, opt *md.Options) *string {
+	if goquery.NodeName(selec) == "img" {
+		_, hasWidth := selec.Attr("width")
+		_, hasHeight := selec.Attr("height")
+		if !hasWidth && !hasHeight || selec.Closest("figure").Length() > 0 {
+			return nil
+		}
+	}
+	html, err := goquery.OuterHtml(selec)
+	if err != nil {
+		return nil
+	}
+	html = blankLinesRegex.ReplaceAllString(strings.TrimSpace(html), "\n")
+	if goquery.NodeName(selec) == "img" {
+		return md.String(html)
+	}
+	return md.String("\n\n" + html + "\n\n")
+}
+
 // ToMD converts the Post's HTML body to Markdown format.
 func (p *Post) ToMD(withTitle bool) (string, error) {
 	if withTitle {
@@ -101,12 +178,15 @@ func (p *Post) contentForFormat(format string, withTitle bool) (string, error) {
 		return p.ToMD(withTitle)
 	case "txt":
 		return p.ToText(withTitle), nil
+	case "json", "jsonl":
+		return p.jsonContent(format)
 	default:
 		return "", fmt.Errorf("unknown format: %s", format)
 	}
 }
 
-// WriteToFile writes the Post's content to a file in the specified format (html, md, or txt).
+// WriteToFile writes the Post's content to a file in the specified format (html, md, txt or json),
+// or appends it to the file in the jsonl format.
 func (p *Post) WriteToFile(path string, format string, addSourceURL bool) error {
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return err
@@ -116,8 +196,12 @@ func (p *Post) WriteToFile(path string, format string, addSourceURL bool) error
 	if err != nil {
 		return err
 	}
+	if format == "html" {
+		content = p.withLanguage(content)
+	}
 
-	if addSourceURL && p.CanonicalUrl != "" {
+	// JSON documents have the URL of the post already
+	if addSourceURL && p.CanonicalUrl != "" && !isJSONFormat(format) {
 		sourceLine := fmt.Sprintf("\n\noriginal content: %s", p.CanonicalUrl) // Add separation
 
 		// Adjust formatting slightly for HTML
@@ -127,7 +211,7 @@ func (p *Post) WriteToFile(path string, format string, addSourceURL bool) error
 		content += sourceLine
 	}
 
-	return os.WriteFile(path, []byte(content), 0644)
+	return writePostContent(path, format, content)
 }
 
 // WriteToFileWithImages writes the Post's content to a file with optional image downloading
@@ -147,14 +231,14 @@ func (p *Post) WriteToFileWithImages(ctx context.Context, path string, format st
 	var imageResult *ImageDownloadResult
 
 	// Download images if requested and format supports it
-	if downloadImages && (format == "html" || format == "md") {
+	if downloadImages && (format == "html" || format == "md" || isJSONFormat(format)) {
 		outputDir := filepath.Dir(path)
 		imageDownloader := NewImageDownloader(fetcher, outputDir, imagesDir, imageQuality)
 		
 		// Only process HTML content for image downloading
 		htmlContent := content
-		if format == "md" {
-			// For markdown, we need to work with the original HTML
+		if format != "html" {
+			// For markdown and JSON, we need to work with the original HTML
 			htmlContent = p.BodyHTML
 		}
 		
@@ -174,11 +258,18 @@ func (p *Post) WriteToFileWithImages(ctx context.Context, path string, format st
 			}
 		} else if format == "md" {
 			// Convert updated HTML to markdown
-			updatedContent, err := mdConverter.ConvertString(imageResult.UpdatedHTML)
+			updatedContent, err := mdLocalImagesConverter.ConvertString(imageResult.UpdatedHTML)
 			if err != nil {
 				return nil, fmt.Errorf("failed to convert updated HTML to markdown: %w", err)
 			}
 			content = fmt.Sprintf("# %s\n\n%s", p.Title, updatedContent)
+		} else {
+			// The document holds the updated body, and its Markdown
+			updated := *p
+			updated.BodyHTML = imageResult.UpdatedHTML
+			if content, err = updated.jsonContent(format); err != nil {
+				return nil, err
+			}
 		}
 	} else if downloadImages && format == "txt" {
 		// For text format, we can't embed images, but we can still download them
@@ -193,7 +284,9 @@ func (p *Post) WriteToFileWithImages(ctx context.Context, path string, format st
 	}
 
 	// Download files if requested and format supports it
-	if downloadFiles && (format == "html" || format == "md") {
+	filesFailed := 0
+	var files []FileInfo
+	if downloadFiles && (format == "html" || format == "md" || isJSONFormat(format)) {
 		outputDir := filepath.Dir(path)
 		fileDownloader := NewFileDownloader(fetcher, outputDir, filesDir, fileExtensions)
 		
@@ -201,8 +294,8 @@ func (p *Post) WriteToFileWithImages(ctx context.Context, path string, format st
 		htmlContent := content
 		if imageResult != nil && imageResult.UpdatedHTML != "" {
 			htmlContent = imageResult.UpdatedHTML
-		} else if format == "md" {
-			// For markdown, we need to work with the original HTML
+		} else if format != "html" {
+			// For markdown and JSON, we need to work with the original HTML
 			htmlContent = p.BodyHTML
 		}
 		
@@ -210,6 +303,8 @@ func (p *Post) WriteToFileWithImages(ctx context.Context, path string, format st
 		if err != nil {
 			return nil, fmt.Errorf("failed to download files: %w", err)
 		}
+		filesFailed = fileResult.Failed
+		files = fileResult.Files
 
 		// Update content based on format if files were processed
 		if fileResult.Success > 0 || fileResult.Failed > 0 {
@@ -221,17 +316,31 @@ func (p *Post) WriteToFileWithImages(ctx context.Context, path string, format st
 				}
 			} else if format == "md" {
 				// Convert updated HTML to markdown
-				updatedContent, err := mdConverter.ConvertString(fileResult.UpdatedHTML)
+				converter := mdConverter
+				if imageResult != nil {
+					converter = mdLocalImagesConverter
+				}
+				updatedContent, err := converter.ConvertString(fileResult.UpdatedHTML)
 				if err != nil {
 					return nil, fmt.Errorf("failed to convert updated HTML to markdown: %w", err)
 				}
 				content = fmt.Sprintf("# %s\n\n%s", p.Title, updatedContent)
+			} else {
+				updated := *p
+				updated.BodyHTML = fileResult.UpdatedHTML
+				if content, err = updated.jsonContent(format); err != nil {
+					return nil, err
+				}
 			}
 		}
 	}
 
+	if format == "html" {
+		content = p.withLanguage(content)
+	}
+
 	// Add source URL if requested
-	if addSourceURL && p.CanonicalUrl != "" {
+	if addSourceURL && p.CanonicalUrl != "" && !isJSONFormat(format) {
 		sourceLine := fmt.Sprintf("\n\noriginal content: %s", p.CanonicalUrl)
 
 		// Adjust formatting slightly for HTML
@@ -241,8 +350,22 @@ func (p *Post) WriteToFileWithImages(ctx context.Context, path string, format st
 		content += sourceLine
 	}
 
+	// An interrupted post isn't written, its media being incomplete
+	if err := ctx.Err(); err != nil {
+		return imageResult, err
+	}
+
+	// Neither is a post whose media failed, if the policy says so
+	failed := filesFailed
+	if imageResult != nil {
+		failed += imageResult.Failed
+	}
+	if failed > 0 && imageErrorsFromContext(ctx) == ImageErrorsFail {
+		return imageResult, fmt.Errorf("%w: %d of post %s", ErrMediaFailed, failed, p.Slug)
+	}
+
 	// Write the file
-	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+	if err := writePostContent(path, format, content); err != nil {
 		return imageResult, err
 	}
 
@@ -255,6 +378,7 @@ func (p *Post) WriteToFileWithImages(ctx context.Context, path string, format st
 			Failed:      0,
 		}
 	}
+	imageResult.Files = files
 
 	return imageResult, nil
 }
@@ -262,6 +386,10 @@ func (p *Post) WriteToFileWithImages(ctx context.Context, path string, format st
 // PostWrapper wraps a Post object for JSON unmarshaling.
 type PostWrapper struct {
 	Post Post `json:"post"`
+	Pub  struct {
+		PostPublication
+		Language string `json:"language"`
+	} `json:"pub"`
 }
 
 // Extractor is a utility for extracting Substack posts from URLs.
@@ -274,11 +402,24 @@ type ArchiveEntry struct {
 	Post         Post
 	FilePath     string
 	DownloadTime time.Time
+	Deleted      bool       // the post was deleted or unpublished since it was downloaded
+	Attachments  []FileInfo // attachments downloaded with the post, listed under it
+
+	// Files are the paths of the post by format, FilePath being used when there are none
+	Files map[string]string
+	// Sidecars are the files written next to the post by kind, e.g. its comments
+	Sidecars map[string]string
 }
 
 // Archive represents a collection of posts for the archive page
 type Archive struct {
 	Entries []ArchiveEntry
+	Logo    string       // path of the publication logo shown in the header, if any
+	Heatmap bool         // show a calendar of the posting days on the HTML page
+	Order   ReadingOrder // newest first unless ReadingOrderOldestFirst
+	Lang    string       // language of the pages, guessed from the posts when empty
+	// ByAuthor groups the posts by their first author, under a heading for each
+	ByAuthor bool
 }
 
 // NewExtractor creates a new Extractor with the provided Fetcher.
@@ -290,41 +431,38 @@ func NewExtractor(f *Fetcher) *Extractor {
 	return &Extractor{fetcher: f}
 }
 
-// extractJSONString finds and extracts the JSON data from script content.
-// This optimized version reduces string operations.
+// extractJSONString finds and extracts the JSON data assigned to window._preloads in the scripts of the page.
+// Long posts may split or duplicate the preloads script, so all scripts are scanned and the value
+// holding the post is preferred.
 func extractJSONString(doc *goquery.Document) (string, error) {
-	var jsonString string
-	var found bool
+	var values []string
+	var parseErr error
 
-	doc.Find("script").EachWithBreak(func(i int, s *goquery.Selection) bool {
+	doc.Find("script").Each(func(i int, s *goquery.Selection) {
 		content := s.Text()
-		if strings.Contains(content, "window._preloads") && strings.Contains(content, "JSON.parse(") {
-			start := strings.Index(content, "JSON.parse(\"")
-			if start == -1 {
-				return true
-			}
-			start += len("JSON.parse(\"")
-
-			end := strings.LastIndex(content, "\")")
-			if end == -1 || start >= end {
-				return true
-			}
-
-			jsonString = content[start:end]
-			found = true
-			return false
+		if !strings.Contains(content, preloadsVariable) {
+			return
+		}
+		found, err := preloadsValues(content)
+		values = append(values, found...)
+		if len(found) == 0 {
+			parseErr = err
 		}
-		return true
 	})
 
-	if !found {
+	if len(values) == 0 {
+		if parseErr != nil {
+			return "", fmt.Errorf("failed to extract JSON string: %w", parseErr)
+		}
 		return "", errors.New("failed to extract JSON string")
 	}
 
-	return jsonString, nil
+	return selectPreloads(values), nil
 }
 
 func (e *Extractor) ExtractPost(ctx context.Context, pageUrl string) (Post, error) {
+	postStarted(ctx, pageUrl)
+
 	// fetch page HTML content
 	body, err := e.fetcher.FetchURL(ctx, pageUrl)
 	if err != nil {
@@ -332,28 +470,34 @@ func (e *Extractor) ExtractPost(ctx context.Context, pageUrl string) (Post, erro
 	}
 	defer body.Close()
 
-	doc, err := goquery.NewDocumentFromReader(body)
+	return ExtractPostFromReader(body)
+}
+
+// ExtractPostFromReader extracts a post from the HTML of a Substack post page, e.g. a page
+// saved by a crawler, without fetching anything.
+func ExtractPostFromReader(r io.Reader) (Post, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
 	if err != nil {
 		return Post{}, fmt.Errorf("failed to parse HTML: %w", err)
 	}
 
+	return ExtractPostFromDocument(doc)
+}
+
+// ExtractPostFromDocument extracts a post from a parsed Substack post page, without fetching anything.
+func ExtractPostFromDocument(doc *goquery.Document) (Post, error) {
 	jsonString, err := extractJSONString(doc)
 	if err != nil {
 		return Post{}, fmt.Errorf("failed to extract post data: %w", err)
 	}
 
-	// Unescape the JSON string directly
-	var rawJSON RawPost
-	err = json.Unmarshal([]byte("\""+jsonString+"\""), &rawJSON.str)
-	if err != nil {
-		return Post{}, fmt.Errorf("failed to unescape JSON: %w", err)
-	}
-
 	// Convert to a Go object
+	rawJSON := RawPost{str: jsonString}
 	p, err := rawJSON.ToPost()
 	if err != nil {
 		return Post{}, fmt.Errorf("failed to parse post data: %w", err)
 	}
+	p.raw = jsonString
 
 	// Extract additional metadata from HTML
 	// Extract subtitle from .subtitle element
@@ -373,7 +517,72 @@ func (e *Extractor) ExtractPost(ctx context.Context, pageUrl string) (Post, erro
 
 type DateFilterFunc func(string) bool
 
+// NewDateFilter returns a DateFilterFunc keeping posts published after the after date
+// and before the before date (format: YYYY-MM-DD). Empty dates are ignored; nil is
+// returned if both are empty.
+func NewDateFilter(before string, after string) DateFilterFunc {
+	if before != "" && after != "" {
+		return func(date string) bool {
+			return date > after && date < before
+		}
+	} else if before != "" {
+		return func(date string) bool {
+			return date < before
+		}
+	} else if after != "" {
+		return func(date string) bool {
+			return date > after
+		}
+	}
+	return nil
+}
+
 func (e *Extractor) GetAllPostsURLs(ctx context.Context, pubUrl string, f DateFilterFunc) ([]string, error) {
+	entries, err := e.GetSitemapPosts(ctx, pubUrl, f)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]string, len(entries))
+	for i, entry := range entries {
+		urls[i] = entry.URL
+	}
+	return urls, nil
+}
+
+// SitemapEntry is a post listed in the sitemap of a publication
+type SitemapEntry struct {
+	URL     string
+	Slug    string
+	LastMod time.Time // last modification of the post, zero if the sitemap doesn't have it
+}
+
+// sitemapDateLayouts are the W3C datetime formats used for lastmod in sitemaps
+var sitemapDateLayouts = []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02"}
+
+// GetSitemapPosts lists the posts of a publication from its sitemap, along with their
+// last modification date. The date filter is applied to the last modification date (YYYY-MM-DD).
+func (e *Extractor) GetSitemapPosts(ctx context.Context, pubUrl string, f DateFilterFunc) ([]SitemapEntry, error) {
+	entries, err := e.FetchSitemap(ctx, pubUrl)
+	if err != nil || f == nil {
+		return entries, err
+	}
+
+	filtered := entries[:0]
+	for _, entry := range entries {
+		date := ""
+		if !entry.LastMod.IsZero() {
+			date = entry.LastMod.UTC().Format("2006-01-02")
+		}
+		if f(date) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered, nil
+}
+
+// FetchSitemap lists all the posts of a publication from its sitemap, in the order of the sitemap
+func (e *Extractor) FetchSitemap(ctx context.Context, pubUrl string) ([]SitemapEntry, error) {
 	u, err := url.Parse(pubUrl)
 	if err != nil {
 		return nil, err
@@ -397,40 +606,138 @@ func (e *Extractor) GetAllPostsURLs(ctx context.Context, pubUrl string, f DateFi
 		return nil, err
 	}
 
-	// Pre-allocate a reasonable size for URLs
+	// Pre-allocate a reasonable size for entries
 	// This avoids multiple slice reallocations as we append
-	urls := make([]string, 0, 100)
+	entries := make([]SitemapEntry, 0, 100)
 
 	doc.Find("url").EachWithBreak(func(i int, s *goquery.Selection) bool {
 		// Check if the context has been cancelled
-		select {
-		case <-ctx.Done():
+		if ctx.Err() != nil {
 			return false
-		default:
 		}
 
-		urlSel := s.Find("loc")
-		url := urlSel.Text()
+		url := strings.TrimSpace(s.Find("loc").Text())
 		if !strings.Contains(url, "/p/") {
 			return true
 		}
 
-		// Only find lastmod if we have a filter
-		if f != nil {
-			lastmod := s.Find("lastmod").Text()
-			if !f(lastmod) {
-				return true
+		entries = append(entries, SitemapEntry{
+			URL:     url,
+			Slug:    SlugFromURL(url),
+			LastMod: parseSitemapDate(strings.TrimSpace(s.Find("lastmod").Text())),
+		})
+		return true
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// parseSitemapDate parses the lastmod date of a sitemap entry, returning the zero time if it is missing or invalid
+func parseSitemapDate(lastmod string) time.Time {
+	for _, layout := range sitemapDateLayouts {
+		if t, err := time.Parse(layout, lastmod); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// archivePageSize is the number of posts requested per page of the archive API
+const archivePageSize = 50
+
+// GetArchivePosts lists the posts of a publication with their metadata (but without body)
+// using the archive API, newest first. The date filter is applied to the post date (YYYY-MM-DD).
+func (e *Extractor) GetArchivePosts(ctx context.Context, pubUrl string, f DateFilterFunc) ([]Post, error) {
+	api, err := NewPublicationAPIClient(e.fetcher, pubUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	posts := make([]Post, 0, 100)
+	err = PaginateOffset(ctx, archivePageSize, func(offset int) (int, error) {
+		query := url.Values{}
+		query.Set("sort", "new")
+		query.Set("offset", fmt.Sprint(offset))
+		query.Set("limit", fmt.Sprint(archivePageSize))
+
+		var page []Post
+		if err := api.Get(ctx, "archive", query, &page); err != nil {
+			return 0, err
+		}
+
+		for _, post := range page {
+			if f != nil && !f(dateOnly(post.PostDate)) {
+				continue
 			}
+			posts = append(posts, post)
 		}
+		return len(page), nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		urls = append(urls, url)
-		return true
+	return posts, nil
+}
+
+// GetPostMetadata returns the metadata of the post at postURL (title, date, audience, word count,
+// type...) from the archive API of its publication, without fetching and converting its body.
+// The archive is read newest first until the post is found.
+func (e *Extractor) GetPostMetadata(ctx context.Context, postURL string) (Post, error) {
+	u, err := url.Parse(postURL)
+	if err != nil {
+		return Post{}, err
+	}
+	slug := SlugFromURL(strings.TrimSuffix(u.Path, "/"))
+	if u.Host == "" || slug == "" {
+		return Post{}, fmt.Errorf("invalid post URL: %s", postURL)
+	}
+	api, err := NewPublicationAPIClient(e.fetcher, u.Scheme+"://"+u.Host)
+	if err != nil {
+		return Post{}, err
+	}
+
+	var found *Post
+	err = PaginateOffset(ctx, archivePageSize, func(offset int) (int, error) {
+		query := url.Values{}
+		query.Set("sort", "new")
+		query.Set("offset", fmt.Sprint(offset))
+		query.Set("limit", fmt.Sprint(archivePageSize))
+
+		var page []Post
+		if err := api.Get(ctx, "archive", query, &page); err != nil {
+			return 0, err
+		}
+		for i := range page {
+			if page[i].Slug == slug {
+				found = &page[i]
+				return 0, nil
+			}
+		}
+		return len(page), nil
 	})
+	if err != nil {
+		return Post{}, err
+	}
+	if found == nil {
+		return Post{}, fmt.Errorf("post %s not found in the archive of %s", slug, u.Host)
+	}
+	return *found, nil
+}
 
-	return urls, nil
+// dateOnly returns the YYYY-MM-DD part of an RFC3339 date
+func dateOnly(datetime string) string {
+	if len(datetime) > 10 {
+		return datetime[:10]
+	}
+	return datetime
 }
 
 type ExtractResult struct {
+	URL  string
 	Post Post
 	Err  error
 }
@@ -474,7 +781,7 @@ func (e *Extractor) ExtractAllPosts(ctx context.Context, urls []string) <-chan E
 						return
 					default:
 						post, err := e.ExtractPost(ctx, url)
-						resultCh <- ExtractResult{Post: post, Err: err}
+						resultCh <- ExtractResult{URL: url, Post: post, Err: err}
 					}
 				}
 			}()
@@ -494,21 +801,60 @@ func NewArchive() *Archive {
 	}
 }
 
-// AddEntry adds a new entry to the archive, sorted by publication date (newest first)
+// AddEntry adds a new entry to the archive, sorted by publication date in the reading order
 func (a *Archive) AddEntry(post Post, filePath string, downloadTime time.Time) {
-	entry := ArchiveEntry{
+	a.AddEntryWithAttachments(post, filePath, downloadTime, nil)
+}
+
+// AddEntryWithAttachments adds a new entry to the archive as AddEntry, listing the attachments
+// downloaded with the post. Attachments that failed to download are left out.
+func (a *Archive) AddEntryWithAttachments(post Post, filePath string, downloadTime time.Time, attachments []FileInfo) {
+	a.Add(ArchiveEntry{
 		Post:         post,
 		FilePath:     filePath,
 		DownloadTime: downloadTime,
+		Attachments:  attachments,
+	})
+}
+
+// Add adds an entry with all the files of its post to the archive, sorted as with AddEntry.
+// Attachments that failed to download are left out.
+func (a *Archive) Add(entry ArchiveEntry) {
+	var attachments []FileInfo
+	for _, file := range entry.Attachments {
+		if file.Success {
+			attachments = append(attachments, file)
+		}
 	}
+	entry.Attachments = attachments
 	
 	a.Entries = append(a.Entries, entry)
 	a.sortEntries()
 }
 
-// sortEntries sorts archive entries by publication date (newest first)
+// AddDeletedEntry adds a post deleted or unpublished since it was downloaded to the archive,
+// flagged as such
+func (a *Archive) AddDeletedEntry(post Post, filePath string, downloadTime time.Time) {
+	a.Entries = append(a.Entries, ArchiveEntry{
+		Post:         post,
+		FilePath:     filePath,
+		DownloadTime: downloadTime,
+		Deleted:      true,
+	})
+	a.sortEntries()
+}
+
+// sortEntries sorts archive entries by publication date, newest first unless the order is oldest first
 func (a *Archive) sortEntries() {
 	sort.Slice(a.Entries, func(i, j int) bool {
+		if a.ByAuthor {
+			authorI := strings.ToLower(PostAuthorName(a.Entries[i].Post))
+			authorJ := strings.ToLower(PostAuthorName(a.Entries[j].Post))
+			if authorI != authorJ {
+				return authorI < authorJ
+			}
+		}
+
 		// Parse post dates and compare (newest first)
 		dateI, errI := time.Parse(time.RFC3339, a.Entries[i].Post.PostDate)
 		dateJ, errJ := time.Parse(time.RFC3339, a.Entries[j].Post.PostDate)
@@ -518,20 +864,88 @@ func (a *Archive) sortEntries() {
 			return a.Entries[i].Post.Title < a.Entries[j].Post.Title
 		}
 		
+		if a.Order == ReadingOrderOldestFirst {
+			return dateI.Before(dateJ)
+		}
 		return dateI.After(dateJ) // newest first
 	})
 }
 
-// GenerateHTML creates an HTML archive page
+// Generate creates the archive page in the given format (html, md or txt), unless ctx is done
+func (a *Archive) Generate(ctx context.Context, outputDir string, format string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	a.sortEntries()
+	switch format {
+	case "html":
+		return a.GenerateHTML(outputDir)
+	case "md":
+		return a.GenerateMarkdown(outputDir)
+	case "txt":
+		return a.GenerateText(outputDir)
+	default:
+		return fmt.Errorf("unknown format for archive: %s", format)
+	}
+}
+
+// GenerateHTML creates an HTML archive page, and the pages of its tags and sections
 func (a *Archive) GenerateHTML(outputDir string) error {
 	archivePath := filepath.Join(outputDir, "index.html")
 	
-	html := `<!DOCTYPE html>
-<html lang="en">
+	html := archiveHTMLHead("Substack Archive", a.language())
+	html += "\t<h1>" + a.logoHTML(outputDir) + "Substack Archive</h1>\n"
+	html += a.taxonomyNavHTML()
+	if a.Heatmap {
+		html += a.heatmapHTML()
+	}
+
+	for i, entry := range a.Entries {
+		html += a.authorHeading(i, "html")
+		html += entry.cardHTML(outputDir)
+	}
+	
+	html += `</body>
+</html>`
+	
+	if err := os.WriteFile(archivePath, []byte(html), 0644); err != nil {
+		return err
+	}
+	return a.generateTaxonomyPages(outputDir)
+}
+
+// authorHeading returns the heading of the author of entry i in format if the archive is grouped
+// by author and the entry is the first of its author, "" otherwise
+func (a *Archive) authorHeading(i int, format string) string {
+	if !a.ByAuthor {
+		return ""
+	}
+	name := PostAuthorName(a.Entries[i].Post)
+	if i > 0 && strings.EqualFold(PostAuthorName(a.Entries[i-1].Post), name) {
+		return ""
+	}
+	switch format {
+	case "html":
+		return "\t<h2 class=\"author\">" + html.EscapeString(name) + "</h2>\n"
+	case "md":
+		return "## " + name + "\n\n"
+	default:
+		return name + "\n" + strings.Repeat("=", len([]rune(name))) + "\n\n"
+	}
+}
+
+// archiveHTMLHead returns the beginning of an HTML archive page in lang, up to the opening body tag
+func archiveHTMLHead(title, lang string) string {
+	attributes := languageAttributes(lang)
+	if attributes == "" {
+		attributes = ` lang="en"`
+	}
+	return `<!DOCTYPE html>
+<html` + attributes + `>
 <head>
 	<meta charset="UTF-8">
 	<meta name="viewport" content="width=device-width, initial-scale=1.0">
-	<title>Substack Archive</title>
+	<title>` + title + `</title>
 	<style>
 		body { font-family: Arial, sans-serif; max-width: 800px; margin: 0 auto; padding: 20px; }
 		h1 { color: #333; }
@@ -542,56 +956,132 @@ func (a *Archive) GenerateHTML(outputDir string) error {
 		.meta { color: #666; font-size: 14px; margin-bottom: 10px; }
 		.subtitle { color: #777; font-style: italic; margin-bottom: 10px; }
 		.cover-image { max-width: 200px; float: right; margin-left: 15px; }
+		[dir="rtl"] .cover-image { float: left; margin-left: 0; margin-right: 15px; }
+		.logo { height: 48px; width: 48px; border-radius: 8px; vertical-align: middle; margin-inline-end: 12px; }
+		.tags, .sections, .series { margin-bottom: 20px; line-height: 1.8; }
+		.tags a, .sections a, .series a { color: #ff6719; text-decoration: none; margin-inline-end: 10px; }
+		.tags a:hover, .sections a:hover, .series a:hover { text-decoration: underline; }
+		.heatmap { margin-bottom: 30px; font-size: 13px; color: #666; }
+		.heatmap .days { display: grid; grid-template-rows: repeat(7, 10px); grid-auto-flow: column; grid-auto-columns: 10px; gap: 3px; margin: 4px 0 12px; }
+		.heatmap .day { border-radius: 2px; background: #ebedf0; }
+		.heatmap .l1 { background: #ffd2b8; }
+		.heatmap .l2 { background: #ffa56e; }
+		.heatmap .l3 { background: #ff6719; }
+		.heatmap .l4 { background: #c94f12; }
+		.post.deleted { border-style: dashed; }
+		.deleted-label { color: #b00020; font-weight: bold; }
+		h2.author { color: #333; border-bottom: 1px solid #eee; padding-bottom: 6px; }
+		.attachments { margin: 10px 0 0; padding-inline-start: 20px; font-size: 14px; }
+		.attachments a { color: #ff6719; }
+		.files { font-size: 14px; color: #666; }
+		.files a { color: #ff6719; }
 	</style>
 </head>
 <body>
-	<h1>Substack Archive</h1>
 `
+}
 
-	for _, entry := range a.Entries {
-		// Make file path relative from archive directory
-		relPath, _ := filepath.Rel(outputDir, entry.FilePath)
-		
-		// Format publication date
-		pubDate := entry.Post.PostDate
-		if parsedDate, err := time.Parse(time.RFC3339, entry.Post.PostDate); err == nil {
-			pubDate = parsedDate.Format("January 2, 2006")
-		}
-		
-		// Format download date
-		downloadDate := entry.DownloadTime.Format("January 2, 2006 15:04")
-		
-		html += `	<div class="post">
+// cardHTML renders the entry as a post card of the HTML archive page in pageDir
+func (e ArchiveEntry) cardHTML(pageDir string) string {
+	// Make file path relative from archive directory
+	relPath := relativeTo(pageDir, e.PrimaryPath("html"))
+	
+	// Format publication date
+	pubDate := e.Post.PostDate
+	if parsedDate, err := time.Parse(time.RFC3339, e.Post.PostDate); err == nil {
+		pubDate = parsedDate.Format("January 2, 2006")
+	}
+	
+	// Format download date
+	downloadDate := e.DownloadTime.Format("January 2, 2006 15:04")
+	
+	html := `	<div class="post">
 `
-		
-		// Add cover image if available
-		if entry.Post.CoverImage != "" {
-			html += fmt.Sprintf(`		<img src="%s" alt="Cover" class="cover-image">
-`, entry.Post.CoverImage)
-		}
-		
-		html += fmt.Sprintf(`		<h2><a href="%s">%s</a></h2>
+	if e.Deleted {
+		html = `	<div class="post deleted">
+`
+	}
+	
+	// Add cover image if available
+	if e.Post.CoverImage != "" {
+		html += fmt.Sprintf(`		<img src="%s" alt="Cover" class="cover-image">
+`, e.Post.CoverImage)
+	}
+	
+	html += fmt.Sprintf(`		<h2><a href="%s">%s</a></h2>
 		<div class="meta">Published: %s | Downloaded: %s</div>
-`, relPath, entry.Post.Title, pubDate, downloadDate)
-		
-		// Add subtitle/description
-		description := entry.Post.Subtitle
-		if description == "" {
-			description = entry.Post.Description
-		}
-		if description != "" {
-			html += fmt.Sprintf(`		<div class="subtitle">%s</div>
-`, description)
-		}
-		
-		html += `	</div>
+`, relPath, e.Post.Title, pubDate, downloadDate)
+	if e.Deleted {
+		html += `		<div class="deleted-label">Deleted from Substack</div>
 `
 	}
 	
-	html += `</body>
-</html>`
+	// Add subtitle/description
+	description := e.Post.Subtitle
+	if description == "" {
+		description = e.Post.Description
+	}
+	if description != "" {
+		html += fmt.Sprintf(`		<div class="subtitle">%s</div>
+`, description)
+	}
+
+	html += e.otherFilesHTML(pageDir)
+	html += e.attachmentsHTML(pageDir)
 	
-	return os.WriteFile(archivePath, []byte(html), 0644)
+	return html + `	</div>
+`
+}
+
+// otherFilesHTML renders the links to the other formats and the sidecars of the entry for the
+// HTML page in pageDir
+func (e ArchiveEntry) otherFilesHTML(pageDir string) string {
+	links := e.otherFiles(pageDir, "html")
+	if len(links) == 0 {
+		return ""
+	}
+	var anchors []string
+	for _, link := range links {
+		anchors = append(anchors, fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(link.Path), link.Label))
+	}
+	return `		<div class="files">Also: ` + strings.Join(anchors, " · ") + `</div>
+`
+}
+
+// attachmentsHTML renders the list of the attachments of the entry for the HTML page in pageDir
+func (e ArchiveEntry) attachmentsHTML(pageDir string) string {
+	if len(e.Attachments) == 0 {
+		return ""
+	}
+	list := `		<ul class="attachments">
+`
+	for _, file := range e.Attachments {
+		list += fmt.Sprintf(`			<li><a href="%s">%s</a> (%s)</li>
+`, html.EscapeString(e.attachmentPath(pageDir, file)), html.EscapeString(file.Filename), FormatByteSize(file.Size))
+	}
+	return list + `		</ul>
+`
+}
+
+// attachmentPath returns the path of an attachment of the entry relative to pageDir, with forward slashes
+func (e ArchiveEntry) attachmentPath(pageDir string, file FileInfo) string {
+	relPath, err := filepath.Rel(pageDir, file.LocalPath)
+	if err != nil {
+		relPath = file.LocalPath
+	}
+	return filepath.ToSlash(relPath)
+}
+
+// logoHTML returns the image of the publication logo for the header of the HTML page in outputDir
+func (a *Archive) logoHTML(outputDir string) string {
+	if a.Logo == "" {
+		return ""
+	}
+	relPath, err := filepath.Rel(outputDir, a.Logo)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf(`<img src="%s" alt="" class="logo">`, html.EscapeString(filepath.ToSlash(relPath)))
 }
 
 // GenerateMarkdown creates a Markdown archive page
@@ -599,10 +1089,23 @@ func (a *Archive) GenerateMarkdown(outputDir string) error {
 	archivePath := filepath.Join(outputDir, "index.md")
 	
 	content := "# Substack Archive\n\n"
+	if a.Logo != "" {
+		if relPath, err := filepath.Rel(outputDir, a.Logo); err == nil {
+			content = fmt.Sprintf("# ![Logo](%s) Substack Archive\n\n", filepath.ToSlash(relPath))
+		}
+	}
 	
-	for _, entry := range a.Entries {
+	// Posts are one level below the headings of their authors
+	level := "##"
+	if a.ByAuthor {
+		level = "###"
+	}
+
+	for i, entry := range a.Entries {
+		content += a.authorHeading(i, "md")
+
 		// Make file path relative from archive directory
-		relPath, _ := filepath.Rel(outputDir, entry.FilePath)
+		relPath := relativeTo(outputDir, entry.PrimaryPath("md"))
 		
 		// Format publication date
 		pubDate := entry.Post.PostDate
@@ -613,8 +1116,11 @@ func (a *Archive) GenerateMarkdown(outputDir string) error {
 		// Format download date
 		downloadDate := entry.DownloadTime.Format("January 2, 2006 15:04")
 		
-		content += fmt.Sprintf("## [%s](%s)\n\n", entry.Post.Title, relPath)
+		content += fmt.Sprintf("%s [%s](%s)\n\n", level, entry.Post.Title, relPath)
 		content += fmt.Sprintf("**Published:** %s | **Downloaded:** %s\n\n", pubDate, downloadDate)
+		if entry.Deleted {
+			content += "**Deleted from Substack**\n\n"
+		}
 		
 		// Add cover image if available
 		if entry.Post.CoverImage != "" {
@@ -629,6 +1135,22 @@ func (a *Archive) GenerateMarkdown(outputDir string) error {
 		if description != "" {
 			content += fmt.Sprintf("*%s*\n\n", description)
 		}
+
+		if links := entry.otherFiles(outputDir, "md"); len(links) > 0 {
+			var also []string
+			for _, link := range links {
+				also = append(also, fmt.Sprintf("[%s](<%s>)", link.Label, link.Path))
+			}
+			content += "**Also:** " + strings.Join(also, " · ") + "\n\n"
+		}
+
+		if len(entry.Attachments) > 0 {
+			content += "**Attachments:**\n\n"
+			for _, file := range entry.Attachments {
+				content += fmt.Sprintf("- [%s](<%s>) (%s)\n", file.Filename, entry.attachmentPath(outputDir, file), FormatByteSize(file.Size))
+			}
+			content += "\n"
+		}
 		
 		content += "---\n\n"
 	}
@@ -642,9 +1164,11 @@ func (a *Archive) GenerateText(outputDir string) error {
 	
 	content := "SUBSTACK ARCHIVE\n================\n\n"
 	
-	for _, entry := range a.Entries {
+	for i, entry := range a.Entries {
+		content += a.authorHeading(i, "txt")
+
 		// Make file path relative from archive directory
-		relPath, _ := filepath.Rel(outputDir, entry.FilePath)
+		relPath := filepath.FromSlash(relativeTo(outputDir, entry.PrimaryPath("txt")))
 		
 		// Format publication date
 		pubDate := entry.Post.PostDate
@@ -659,6 +1183,9 @@ func (a *Archive) GenerateText(outputDir string) error {
 		content += fmt.Sprintf("File: %s\n", relPath)
 		content += fmt.Sprintf("Published: %s\n", pubDate)
 		content += fmt.Sprintf("Downloaded: %s\n", downloadDate)
+		if entry.Deleted {
+			content += "Status: deleted from Substack\n"
+		}
 		
 		// Add subtitle/description
 		description := entry.Post.Subtitle
@@ -668,6 +1195,12 @@ func (a *Archive) GenerateText(outputDir string) error {
 		if description != "" {
 			content += fmt.Sprintf("Description: %s\n", description)
 		}
+		for _, link := range entry.otherFiles(outputDir, "txt") {
+			content += fmt.Sprintf("Also (%s): %s\n", link.Label, link.Path)
+		}
+		for _, file := range entry.Attachments {
+			content += fmt.Sprintf("Attachment: %s (%s)\n", entry.attachmentPath(outputDir, file), FormatByteSize(file.Size))
+		}
 		
 		content += "\n" + strings.Repeat("-", 50) + "\n\n"
 	}
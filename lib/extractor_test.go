@@ -299,13 +299,15 @@ func TestExtractJSONString(t *testing.T) {
 		jsonString, err := extractJSONString(doc)
 		require.NoError(t, err)
 
-		// Create a wrapper and marshal to get expected JSON
+		// Create a wrapper and marshal to get expected JSON. The string passed to JSON.parse
+		// is unescaped, including the \u003c escapes of json.Marshal.
 		wrapper := PostWrapper{Post: post}
-		expectedJSONBytes, _ := json.Marshal(wrapper)
+		var expectedJSON strings.Builder
+		encoder := json.NewEncoder(&expectedJSON)
+		encoder.SetEscapeHTML(false)
+		require.NoError(t, encoder.Encode(wrapper))
 
-		// The expected JSON needs to have escaped quotes to match the actual output
-		expectedJSON := strings.ReplaceAll(string(expectedJSONBytes), `"`, `\"`)
-		assert.Equal(t, expectedJSON, jsonString)
+		assert.Equal(t, strings.TrimSuffix(expectedJSON.String(), "\n"), jsonString)
 	})
 
 	t.Run("invalidHTML", func(t *testing.T) {
@@ -319,6 +321,22 @@ func TestExtractJSONString(t *testing.T) {
 		assert.Contains(t, err.Error(), "failed to extract JSON string")
 	})
 
+	t.Run("severalScripts", func(t *testing.T) {
+		// The post is in the second preloads script of the page
+		html := `<html><body>
+		<script>window._preloads = {"base_url": "https://example.com"}</script>
+		<script>window._preloads = JSON.parse("{\"post\": {\"id\": 7, \"slug\": \"long-post\"}}")</script>
+		</body></html>`
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+		require.NoError(t, err)
+
+		jsonString, err := extractJSONString(doc)
+		require.NoError(t, err)
+		post, err := (&RawPost{str: jsonString}).ToPost()
+		require.NoError(t, err)
+		assert.Equal(t, "long-post", post.Slug)
+	})
+
 	t.Run("malformedScript", func(t *testing.T) {
 		// Test HTML with malformed script
 		malformedHTML := `
@@ -336,6 +354,28 @@ func TestExtractJSONString(t *testing.T) {
 	})
 }
 
+// Test extracting posts from saved pages without fetching them
+func TestExtractPostFromReader(t *testing.T) {
+	post := createSamplePost()
+	post.Subtitle = ""
+	html := strings.Replace(createMockSubstackHTML(post), "<body>", `<body><div class="subtitle">Saved subtitle</div>`, 1)
+
+	extracted, err := ExtractPostFromReader(strings.NewReader(html))
+	require.NoError(t, err)
+	assert.Equal(t, post.Title, extracted.Title)
+	assert.Equal(t, post.BodyHTML, extracted.BodyHTML)
+	assert.Equal(t, "Saved subtitle", extracted.Subtitle)
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	require.NoError(t, err)
+	fromDoc, err := ExtractPostFromDocument(doc)
+	require.NoError(t, err)
+	assert.Equal(t, extracted, fromDoc)
+
+	_, err = ExtractPostFromReader(strings.NewReader(`<html><body><p>Not a post</p></body></html>`))
+	assert.ErrorContains(t, err, "failed to extract post data")
+}
+
 // Create a real test server that serves mock Substack pages
 func createSubstackTestServer() (*httptest.Server, map[string]Post) {
 	posts := make(map[string]Post)
@@ -511,6 +551,28 @@ func TestExtractorGetAllPostsURLs(t *testing.T) {
 	})
 }
 
+// Test listing the structured entries of a sitemap
+func TestExtractorFetchSitemap(t *testing.T) {
+	server, posts := createSubstackTestServer()
+	defer server.Close()
+
+	entries, err := NewExtractor(nil).FetchSitemap(context.Background(), server.URL)
+	require.NoError(t, err)
+	require.Len(t, entries, len(posts))
+	assert.Equal(t, "https://example.substack.com/p/"+entries[0].Slug, entries[0].URL)
+	assert.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), entries[0].LastMod)
+	assert.Equal(t, time.Date(2023, 1, 5, 0, 0, 0, 0, time.UTC), entries[4].LastMod)
+}
+
+// Test parsing the lastmod dates of sitemaps
+func TestParseSitemapDate(t *testing.T) {
+	assert.Equal(t, time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), parseSitemapDate("2023-01-02"))
+	assert.Equal(t, time.Date(2023, 1, 2, 10, 30, 0, 0, time.UTC), parseSitemapDate("2023-01-02T10:30Z"))
+	assert.True(t, parseSitemapDate("2023-01-02T10:30:00.123+02:00").Equal(time.Date(2023, 1, 2, 8, 30, 0, 123000000, time.UTC)))
+	assert.True(t, parseSitemapDate("").IsZero())
+	assert.True(t, parseSitemapDate("yesterday").IsZero())
+}
+
 // Test Extractor.ExtractAllPosts
 func TestExtractorExtractAllPosts(t *testing.T) {
 	// Create test server
@@ -1427,3 +1489,76 @@ func BenchmarkExtractor(b *testing.B) {
 		}
 	})
 }
+
+// Test reading the metadata of a post from the archive API
+func TestExtractorGetPostMetadata(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/archive" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		atomic.AddInt32(&requests, 1)
+		var page []Post
+		if r.URL.Query().Get("offset") == "0" {
+			for i := 0; i < archivePageSize; i++ {
+				page = append(page, Post{Id: i, Slug: fmt.Sprintf("post-%d", i), Title: fmt.Sprintf("Post %d", i)})
+			}
+		} else {
+			page = append(page, Post{Id: 100, Slug: "oldest", Title: "Oldest", Audience: "only_paid", WordCount: 1200, Type: "podcast"})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+
+	extractor := NewExtractor(nil)
+	ctx := context.Background()
+
+	post, err := extractor.GetPostMetadata(ctx, server.URL+"/p/post-3")
+	require.NoError(t, err)
+	assert.Equal(t, "Post 3", post.Title)
+	assert.Empty(t, post.BodyHTML)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests), "the archive is read until the post is found")
+
+	post, err = extractor.GetPostMetadata(ctx, server.URL+"/p/oldest/")
+	require.NoError(t, err)
+	assert.Equal(t, "only_paid", post.Audience)
+	assert.Equal(t, 1200, post.WordCount)
+	assert.Equal(t, "podcast", post.Type)
+
+	_, err = extractor.GetPostMetadata(ctx, server.URL+"/p/missing")
+	assert.ErrorContains(t, err, "not found")
+	_, err = extractor.GetPostMetadata(ctx, "not a url")
+	assert.Error(t, err)
+}
+
+func TestArchiveAttachments(t *testing.T) {
+	dir := t.TempDir()
+	post := createSamplePost()
+	post.Title = "Quarterly Report"
+	attachments := []FileInfo{
+		{Filename: "report.pdf", LocalPath: filepath.Join(dir, "files", "report", "report.pdf"), Size: 1536, Success: true},
+		{Filename: "missing.xlsx", OriginalURL: "https://example.com/missing.xlsx", Success: false},
+	}
+
+	archive := NewArchive()
+	archive.AddEntryWithAttachments(post, filepath.Join(dir, "report.html"), time.Now(), attachments)
+	require.Len(t, archive.Entries[0].Attachments, 1)
+
+	require.NoError(t, archive.GenerateHTML(dir))
+	content, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `<li><a href="files/report/report.pdf">report.pdf</a> (1.5 KB)</li>`)
+	assert.NotContains(t, string(content), "missing.xlsx")
+
+	require.NoError(t, archive.GenerateMarkdown(dir))
+	content, err = os.ReadFile(filepath.Join(dir, "index.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "**Attachments:**\n\n- [report.pdf](<files/report/report.pdf>) (1.5 KB)\n")
+
+	require.NoError(t, archive.GenerateText(dir))
+	content, err = os.ReadFile(filepath.Join(dir, "index.txt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "Attachment: files/report/report.pdf (1.5 KB)\n")
+}
@@ -0,0 +1,259 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FailureLogName is the name of the log of failed posts written in the output directory
+const FailureLogName = "failures.log"
+
+// Classes of errors recorded in the failure log
+const (
+	ErrorClassNotFound    = "not_found"    // the post doesn't exist (anymore)
+	ErrorClassForbidden   = "forbidden"    // the post requires to be logged in or subscribed
+	ErrorClassRateLimited = "rate_limited" // Substack kept answering "too many requests"
+	ErrorClassServer      = "server_error" // Substack answered with a 5xx status
+	ErrorClassHTTP        = "http_error"   // any other HTTP status
+	ErrorClassTimeout     = "timeout"
+	ErrorClassNetwork     = "network"
+	ErrorClassRobots      = "robots"     // disallowed by robots.txt
+	ErrorClassExtraction  = "extraction" // the page was fetched but the post couldn't be read from it
+	ErrorClassWrite       = "write"
+	ErrorClassImages      = "images"
+	ErrorClassPostProcess = "post_process"
+	ErrorClassTransform   = "transform"
+)
+
+// FailureLogEntry is a line of the failure log, in JSON
+type FailureLogEntry struct {
+	Time     time.Time `json:"time"`
+	URL      string    `json:"url"`
+	Slug     string    `json:"slug"`
+	Stage    string    `json:"stage"`
+	Class    string    `json:"class"`
+	Attempts int       `json:"attempts,omitempty"` // requests made for the post page
+	Error    string    `json:"error"`
+	Command  string    `json:"command"` // downloads the post again with the same options
+}
+
+// NewFailureLogEntry describes a failed post for the failure log
+func NewFailureLogEntry(failure ManifestFailure, err error, attempts int, outputDir string) FailureLogEntry {
+	class := ClassifyError(err)
+	switch failure.Stage {
+	case FailureWrite:
+		class = ErrorClassWrite
+	case FailureImages:
+		class = ErrorClassImages
+	case FailurePostProcess:
+		class = ErrorClassPostProcess
+	case FailureTransform:
+		class = ErrorClassTransform
+	}
+	return FailureLogEntry{
+		Time:     failure.FailedAt,
+		URL:      failure.URL,
+		Slug:     failure.Slug,
+		Stage:    failure.Stage,
+		Class:    class,
+		Attempts: attempts,
+		Error:    failure.Error,
+		Command:  ReproduceCommand(failure.URL, failure.Options, outputDir),
+	}
+}
+
+// ClassifyError returns the class of an error returned when fetching a post
+func ClassifyError(err error) string {
+	var fetchErr *FetchError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrDisallowedByRobots):
+		return ErrorClassRobots
+	case errors.As(err, &fetchErr):
+		switch {
+		case fetchErr.TooManyRequests:
+			return ErrorClassRateLimited
+		case fetchErr.StatusCode == 404 || fetchErr.StatusCode == 410:
+			return ErrorClassNotFound
+		case fetchErr.StatusCode == 401 || fetchErr.StatusCode == 403:
+			return ErrorClassForbidden
+		case fetchErr.StatusCode >= 500:
+			return ErrorClassServer
+		}
+		return ErrorClassHTTP
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorClassTimeout
+	case errors.As(err, &netErr):
+		return ErrorClassNetwork
+	}
+	if strings.Contains(err.Error(), "max retry count reached") {
+		return ErrorClassRateLimited
+	}
+	return ErrorClassExtraction
+}
+
+// ReproduceCommand returns the command line downloading a single post to outputDir with the given options
+func ReproduceCommand(url string, opts ManifestOptions, outputDir string) string {
+	args := []string{"sbstck-dl", "download", "--url", url, "--output", outputDir}
+	if opts.Format != "" {
+		args = append(args, "--format", opts.Format)
+	}
+	if opts.AddSourceURL {
+		args = append(args, "--add-source-url")
+	}
+	if opts.EmailLayout {
+		args = append(args, "--email-layout")
+	}
+	if opts.AccessibleText && containsString(splitFormats(opts.Format), "txt") {
+		args = append(args, "--accessible-text")
+	}
+	if opts.DownloadImages {
+		args = append(args, "--download-images")
+		if opts.ImageQuality != "" && opts.ImageQuality != ImageQualityHigh {
+			args = append(args, "--image-quality", string(opts.ImageQuality))
+		}
+		if len(opts.ImageSizes) > 0 {
+			sizes := make([]string, len(opts.ImageSizes))
+			for i, size := range opts.ImageSizes {
+				sizes[i] = strconv.Itoa(size)
+			}
+			args = append(args, "--image-sizes", strings.Join(sizes, ","))
+		}
+		if opts.StripImageMeta {
+			args = append(args, "--strip-image-metadata")
+		}
+		if opts.OptimizeImages {
+			args = append(args, "--optimize-images")
+		}
+		if opts.ImagesDir != "" && opts.ImagesDir != "images" {
+			args = append(args, "--images-dir", opts.ImagesDir)
+		}
+	}
+	if opts.DownloadFiles {
+		args = append(args, "--download-files")
+		if len(opts.FileExtensions) > 0 {
+			args = append(args, "--file-extensions", strings.Join(opts.FileExtensions, ","))
+		}
+		if len(opts.ExcludeExtensions) > 0 {
+			args = append(args, "--exclude-file-extensions", strings.Join(opts.ExcludeExtensions, ","))
+		}
+		if opts.FileMaxSize > 0 {
+			args = append(args, "--file-max-size", strconv.FormatInt(opts.FileMaxSize, 10))
+		}
+		if opts.MaxFilesPerPost > 0 {
+			args = append(args, "--max-files-per-post", strconv.Itoa(opts.MaxFilesPerPost))
+		}
+		if opts.FilesDir != "" && opts.FilesDir != "files" {
+			args = append(args, "--files-dir", opts.FilesDir)
+		}
+	}
+	if (opts.DownloadImages || opts.DownloadFiles) && opts.ImageErrors != "" && opts.ImageErrors != ImageErrorsWarn {
+		args = append(args, "--image-errors", string(opts.ImageErrors))
+	}
+	if (opts.DownloadImages || opts.DownloadFiles) && opts.MediaTemplate != "" {
+		args = append(args, "--media-template", opts.MediaTemplate)
+	}
+	if opts.DownloadFiles && opts.OriginalFilenames {
+		args = append(args, "--original-filenames")
+	}
+	if opts.CreateArchive {
+		args = append(args, "--create-archive")
+		if opts.ArchiveHeatmap {
+			args = append(args, "--archive-heatmap")
+		}
+		if opts.ReadingOrder == ReadingOrderOldestFirst {
+			args = append(args, "--reading-order", string(opts.ReadingOrder))
+		}
+	}
+	if opts.RelatedPosts > 0 {
+		args = append(args, "--related-posts", strconv.Itoa(opts.RelatedPosts))
+	}
+	if opts.Comments {
+		args = append(args, "--comments")
+		if opts.CommentsFormat != "" {
+			args = append(args, "--comments-format", opts.CommentsFormat)
+		}
+	}
+	if opts.KeepRaw {
+		args = append(args, "--keep-raw")
+	}
+	if opts.RawHTML {
+		args = append(args, "--raw-html")
+	}
+	if opts.Mirror {
+		args = append(args, "--mirror")
+	}
+	if opts.ByAuthor {
+		args = append(args, "--by-author")
+	}
+	if opts.KeepVersions {
+		args = append(args, "--keep-versions")
+	}
+	if opts.DownloadAudio {
+		args = append(args, "--download-audio")
+		if opts.AudioDir != "" && opts.AudioDir != "audio" {
+			args = append(args, "--audio-dir", opts.AudioDir)
+		}
+	}
+	for _, selector := range opts.IgnoreSelectors {
+		args = append(args, "--ignore-selector", selector)
+	}
+	if opts.PaywallMarker {
+		args = append(args, "--paywall-marker")
+	}
+	for _, command := range opts.Transform {
+		args = append(args, "--transform", command)
+	}
+	if opts.Redact {
+		args = append(args, "--redact")
+	}
+	for _, command := range opts.ExecAfter {
+		args = append(args, "--exec-after", command)
+	}
+
+	for i, arg := range args {
+		args[i] = shellQuote(arg)
+	}
+	return strings.Join(args, " ")
+}
+
+// shellQuote quotes s for POSIX shells if it contains special characters
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=,@%+") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// AppendFailureLog appends entries to the failure log of dir, one JSON object per line
+func AppendFailureLog(dir string, entries ...FailureLogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating directory %s: %w", dir, err)
+	}
+	file, err := os.OpenFile(filepath.Join(dir, FailureLogName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening failure log: %w", err)
+	}
+	defer file.Close()
+
+	enc := json.NewEncoder(file)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return fmt.Errorf("error writing failure log: %w", err)
+		}
+	}
+	return file.Close()
+}
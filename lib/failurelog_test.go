@@ -0,0 +1,126 @@
+package lib
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test classifying the errors of failed posts
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err   error
+		class string
+	}{
+		{nil, ""},
+		{&FetchError{StatusCode: 404}, ErrorClassNotFound},
+		{fmt.Errorf("failed to fetch page: %w", &FetchError{StatusCode: 403}), ErrorClassForbidden},
+		{&FetchError{StatusCode: 429, TooManyRequests: true}, ErrorClassRateLimited},
+		{&FetchError{StatusCode: 503}, ErrorClassServer},
+		{&FetchError{StatusCode: 418}, ErrorClassHTTP},
+		{fmt.Errorf("%w: https://example.com/p/post", ErrDisallowedByRobots), ErrorClassRobots},
+		{context.DeadlineExceeded, ErrorClassTimeout},
+		{errors.New("max retry count reached for URL: https://example.com"), ErrorClassRateLimited},
+		{errors.New("failed to extract post data: no script found"), ErrorClassExtraction},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.class, ClassifyError(tt.err), "%v", tt.err)
+	}
+}
+
+// Test the command line given to download a failed post again
+func TestReproduceCommand(t *testing.T) {
+	url := "https://example.substack.com/p/post"
+	assert.Equal(t, "sbstck-dl download --url https://example.substack.com/p/post --output ./out --format md",
+		ReproduceCommand(url, ManifestOptions{Format: "md"}, "./out"))
+
+	opts := ManifestOptions{
+		Format:         "html",
+		AddSourceURL:   true,
+		DownloadImages: true,
+		ImageQuality:   ImageQualityLow,
+		ImagesDir:      "images",
+		DownloadFiles:  true,
+		FileExtensions: []string{"pdf", "epub"},
+		FilesDir:       "attachments",
+		CreateArchive:  true,
+	}
+	assert.Equal(t, "sbstck-dl download --url https://example.substack.com/p/post --output 'My Archive' --format html"+
+		" --add-source-url --download-images --image-quality low --download-files --file-extensions pdf,epub"+
+		" --files-dir attachments --create-archive", ReproduceCommand(url, opts, "My Archive"))
+
+	opts.ImageErrors = ImageErrorsFail
+	assert.Contains(t, ReproduceCommand(url, opts, "My Archive"), " --image-errors fail ")
+	opts.ImageSizes = []int{424, 848}
+	assert.Contains(t, ReproduceCommand(url, opts, "My Archive"), " --image-quality low --image-sizes 424,848 ")
+	opts.RelatedPosts = 3
+	assert.Contains(t, ReproduceCommand(url, opts, "My Archive"), " --create-archive --related-posts 3")
+
+	assert.Equal(t, `'it'\''s'`, shellQuote("it's"))
+	assert.Equal(t, "''", shellQuote(""))
+}
+
+// Test that failed posts are appended to the failure log
+func TestDownloaderFailureLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/p/busy" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	tempDir, err := os.MkdirTemp("", "failurelog-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = tempDir
+	opts.Format = "md"
+	fetcher := NewFetcher(WithBackOffConfig(backoff.WithMaxRetries(backoff.NewConstantBackOff(time.Millisecond), 2)))
+	downloader := NewDownloader(fetcher, opts)
+
+	urls := []string{server.URL + "/p/missing", server.URL + "/p/busy"}
+	_, err = downloader.DownloadPosts(context.Background(), urls, nil)
+	require.NoError(t, err)
+
+	file, err := os.Open(filepath.Join(tempDir, FailureLogName))
+	require.NoError(t, err)
+	defer file.Close()
+
+	entries := make(map[string]FailureLogEntry)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry FailureLogEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries[entry.Slug] = entry
+	}
+	require.Len(t, entries, 2)
+
+	missing := entries["missing"]
+	assert.Equal(t, server.URL+"/p/missing", missing.URL)
+	assert.Equal(t, FailureDownload, missing.Stage)
+	assert.Equal(t, ErrorClassNotFound, missing.Class)
+	assert.Equal(t, 1, missing.Attempts)
+	assert.Contains(t, missing.Error, "404")
+	assert.Equal(t, fmt.Sprintf("sbstck-dl download --url %s/p/missing --output %s --format md", server.URL, tempDir), missing.Command)
+	assert.False(t, missing.Time.IsZero())
+
+	busy := entries["busy"]
+	assert.Equal(t, ErrorClassRateLimited, busy.Class)
+	assert.Equal(t, 3, busy.Attempts)
+	assert.Equal(t, 3, fetcher.FailedAttempts(server.URL+"/p/busy"))
+}
@@ -0,0 +1,286 @@
+package lib
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// FeedOptions describes a feed built by ExportFeed or ExportJSONFeed
+type FeedOptions struct {
+	Title       string
+	Link        string // home page of the publication; derived from the post URLs when empty
+	Description string
+	BaseURL     string // URL the downloaded files are served from, to link the local images
+}
+
+// JSONFeedVersion is the version of the JSON Feed specification of the feeds built by BuildJSONFeed
+const JSONFeedVersion = "https://jsonfeed.org/version/1.1"
+
+// JSONFeed is a JSON Feed 1.1 document
+type JSONFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Items       []JSONFeedItem `json:"items"`
+}
+
+// JSONFeedItem is a post of a JSON Feed
+type JSONFeedItem struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url,omitempty"`
+	Title         string   `json:"title"`
+	Summary       string   `json:"summary,omitempty"`
+	ContentHTML   string   `json:"content_html"`
+	DatePublished string   `json:"date_published,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// RSSFeed is an RSS 2.0 feed, with the full content of the posts in content:encoded
+type RSSFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Content string     `xml:"xmlns:content,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Generator     string    `xml:"generator"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link,omitempty"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate,omitempty"`
+	Description string   `xml:"description,omitempty"`
+	Categories  []string `xml:"category"`
+	Content     rssCDATA `xml:"content:encoded"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssCDATA struct {
+	Value string `xml:",cdata"`
+}
+
+// feedEntry is a post of a feed, with the HTML of its item
+type feedEntry struct {
+	Post    LocalPost
+	Content string
+}
+
+// feedEntries returns the posts of a feed, in the order of posts, and the home page of the
+// publication. Posts downloaded in several formats are only included once, from their
+// richest format.
+func feedEntries(posts []LocalPost, manifest *Manifest, opts FeedOptions) ([]feedEntry, string, error) {
+	var base *url.URL
+	if opts.BaseURL != "" {
+		var err error
+		if base, err = url.Parse(strings.TrimRight(opts.BaseURL, "/") + "/"); err != nil {
+			return nil, "", fmt.Errorf("invalid base URL %q: %w", opts.BaseURL, err)
+		}
+	}
+
+	posts, err := PreferredLocalPosts(posts, "html")
+	if err != nil {
+		return nil, "", err
+	}
+	link := opts.Link
+	var entries []feedEntry
+	for _, post := range posts {
+		content, err := feedItemHTML(post, manifest, base)
+		if err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, feedEntry{Post: post, Content: content})
+
+		if link == "" && post.URL != "" {
+			if u, err := url.Parse(post.URL); err == nil && u.Host != "" {
+				link = u.Scheme + "://" + u.Host
+			}
+		}
+	}
+	return entries, link, nil
+}
+
+// BuildFeed creates an RSS 2.0 feed with one item per post holding the full HTML of the post
+func BuildFeed(posts []LocalPost, manifest *Manifest, opts FeedOptions) (*RSSFeed, error) {
+	entries, link, err := feedEntries(posts, manifest, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	channel := rssChannel{
+		Title:         opts.Title,
+		Link:          link,
+		Description:   opts.Description,
+		Generator:     "sbstck-dl",
+		LastBuildDate: time.Now().UTC().Format(time.RFC1123Z),
+	}
+	if channel.Description == "" {
+		channel.Description = channel.Title
+	}
+	for _, entry := range entries {
+		post := entry.Post
+		item := rssItem{
+			Title:       post.Title,
+			Link:        post.URL,
+			GUID:        rssGUID{IsPermaLink: post.URL != "", Value: post.URL},
+			Description: post.Subtitle,
+			Categories:  post.Tags,
+			Content:     rssCDATA{Value: entry.Content},
+		}
+		if item.GUID.Value == "" {
+			item.GUID.Value = post.Slug
+		}
+		if !post.Date.IsZero() {
+			item.PubDate = post.Date.UTC().Format(time.RFC1123Z)
+		}
+		channel.Items = append(channel.Items, item)
+	}
+
+	return &RSSFeed{
+		Version: "2.0",
+		Content: "http://purl.org/rss/1.0/modules/content/",
+		Channel: channel,
+	}, nil
+}
+
+// feedItemHTML returns the HTML body of a post for a feed item: the title, given by the item,
+// is left out, and local images are linked from base when given
+func feedItemHTML(post LocalPost, manifest *Manifest, base *url.URL) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(post.HTML()))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse post %s: %w", post.Slug, err)
+	}
+	doc.Find("h1").First().Remove()
+
+	if base != nil {
+		dir := manifest.RelPath(post.Path)
+		dir = dir[:strings.LastIndex(dir, "/")+1]
+		doc.Find("img, a").Each(func(i int, s *goquery.Selection) {
+			attr := "src"
+			if goquery.NodeName(s) == "a" {
+				attr = "href"
+			}
+			if ref, ok := s.Attr(attr); ok && isLocalReference(ref) {
+				if u, err := base.Parse(dir + ref); err == nil {
+					s.SetAttr(attr, u.String())
+				}
+			}
+		})
+	}
+
+	body, err := doc.Find("body").Html()
+	if err != nil {
+		return "", fmt.Errorf("failed to render post %s: %w", post.Slug, err)
+	}
+	return strings.TrimSpace(body), nil
+}
+
+// BuildJSONFeed creates a JSON Feed 1.1 with one item per post holding the full HTML of the post
+func BuildJSONFeed(posts []LocalPost, manifest *Manifest, opts FeedOptions) (*JSONFeed, error) {
+	entries, link, err := feedEntries(posts, manifest, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &JSONFeed{
+		Version:     JSONFeedVersion,
+		Title:       opts.Title,
+		HomePageURL: link,
+		Description: opts.Description,
+		Items:       []JSONFeedItem{},
+	}
+	for _, entry := range entries {
+		post := entry.Post
+		item := JSONFeedItem{
+			ID:          post.URL,
+			URL:         post.URL,
+			Title:       post.Title,
+			Summary:     post.Subtitle,
+			ContentHTML: entry.Content,
+			Tags:        post.Tags,
+		}
+		if item.ID == "" {
+			item.ID = post.Slug
+		}
+		if !post.Date.IsZero() {
+			item.DatePublished = post.Date.UTC().Format(time.RFC3339)
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed, nil
+}
+
+// WriteFeed writes the feed as XML
+func WriteFeed(w io.Writer, feed *RSSFeed) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(feed); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// ExportFeed writes an RSS 2.0 feed with the full content of the posts to path, e.g. to import
+// the archive into another blogging platform. It returns the number of posts in the feed.
+func ExportFeed(posts []LocalPost, manifest *Manifest, path string, opts FeedOptions) (int, error) {
+	feed, err := BuildFeed(posts, manifest, opts)
+	if err != nil {
+		return 0, err
+	}
+	return len(feed.Channel.Items), writeFeedFile(path, func(w io.Writer) error {
+		return WriteFeed(w, feed)
+	})
+}
+
+// ExportJSONFeed writes a JSON Feed 1.1 with the full content of the posts to path. It returns
+// the number of posts in the feed.
+func ExportJSONFeed(posts []LocalPost, manifest *Manifest, path string, opts FeedOptions) (int, error) {
+	feed, err := BuildJSONFeed(posts, manifest, opts)
+	if err != nil {
+		return 0, err
+	}
+	return len(feed.Items), writeFeedFile(path, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(feed)
+	})
+}
+
+// writeFeedFile creates the file of a feed and writes it with write
+func writeFeedFile(path string, write func(w io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating feed: %w", err)
+	}
+	defer file.Close()
+
+	if err := write(file); err != nil {
+		return fmt.Errorf("error writing feed: %w", err)
+	}
+	return file.Close()
+}
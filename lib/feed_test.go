@@ -0,0 +1,162 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test exporting posts as a full content RSS feed
+func TestExportFeed(t *testing.T) {
+	tempDir := createLocalArchive(t)
+	defer os.RemoveAll(tempDir)
+
+	manifest, err := LoadManifest(tempDir)
+	require.NoError(t, err)
+	manifest.AddEntry(ManifestEntry{
+		Slug:     "third-post",
+		Title:    "Third Post",
+		Subtitle: "On climate",
+		URL:      "https://example.substack.com/p/third-post",
+		PostDate: "2023-03-10T08:00:00Z",
+		Tags:     []string{"climate"},
+		Files:    map[string]string{"md": "20230310_080000_third-post.md"},
+	})
+	require.NoError(t, manifest.Save())
+
+	posts, err := ScanLocalPosts(tempDir)
+	require.NoError(t, err)
+
+	path := filepath.Join(tempDir, "feed.xml")
+	items, err := ExportFeed(posts, manifest, path, FeedOptions{Title: "My Newsletter"})
+	require.NoError(t, err)
+	assert.Equal(t, 4, items)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, []byte(xml.Header)))
+	assert.Contains(t, string(data), `xmlns:content="http://purl.org/rss/1.0/modules/content/"`)
+
+	var feed RSSFeed
+	require.NoError(t, xml.Unmarshal(data, &feed))
+	assert.Equal(t, "2.0", feed.Version)
+	assert.Equal(t, "My Newsletter", feed.Channel.Title)
+	assert.Equal(t, "https://example.substack.com", feed.Channel.Link)
+	require.Len(t, feed.Channel.Items, 4)
+
+	item := feed.Channel.Items[0]
+	assert.Equal(t, "Third Post", item.Title)
+	assert.Equal(t, "https://example.substack.com/p/third-post", item.Link)
+	assert.Equal(t, "https://example.substack.com/p/third-post", item.GUID.Value)
+	assert.True(t, item.GUID.IsPermaLink)
+	assert.Equal(t, "On climate", item.Description)
+	assert.Equal(t, []string{"climate"}, item.Categories)
+	pubDate, err := time.Parse(time.RFC1123Z, item.PubDate)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 3, 10, 8, 0, 0, 0, time.UTC), pubDate.UTC())
+
+	// Posts without a URL are identified by their slug
+	undated := feed.Channel.Items[3]
+	assert.Equal(t, "undated-post", undated.GUID.Value)
+	assert.False(t, undated.GUID.IsPermaLink)
+	assert.Empty(t, undated.PubDate)
+
+	_, err = BuildFeed(posts, manifest, FeedOptions{BaseURL: "://bad"})
+	assert.Error(t, err)
+}
+
+// Test exporting posts as a JSON Feed
+func TestExportJSONFeed(t *testing.T) {
+	tempDir := createLocalArchive(t)
+	defer os.RemoveAll(tempDir)
+
+	manifest, err := LoadManifest(tempDir)
+	require.NoError(t, err)
+	manifest.AddEntry(ManifestEntry{
+		Slug:     "first-post",
+		Title:    "First Post",
+		Subtitle: "The beginning",
+		URL:      "https://example.substack.com/p/first-post",
+		PostDate: "2023-01-01T10:00:00Z",
+		Tags:     []string{"news"},
+		Files:    map[string]string{"md": "20230101_100000_first-post.md"},
+	})
+	require.NoError(t, manifest.Save())
+
+	posts, err := ScanLocalPosts(tempDir)
+	require.NoError(t, err)
+
+	path := filepath.Join(tempDir, "feed.json")
+	items, err := ExportJSONFeed(posts, manifest, path, FeedOptions{Title: "My Newsletter"})
+	require.NoError(t, err)
+	assert.Equal(t, 4, items)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var feed JSONFeed
+	require.NoError(t, json.Unmarshal(data, &feed))
+	assert.Equal(t, JSONFeedVersion, feed.Version)
+	assert.Equal(t, "My Newsletter", feed.Title)
+	assert.Equal(t, "https://example.substack.com", feed.HomePageURL)
+	require.Len(t, feed.Items, 4)
+
+	var first JSONFeedItem
+	for _, item := range feed.Items {
+		if item.Title == "First Post" {
+			first = item
+		}
+	}
+	assert.Equal(t, "https://example.substack.com/p/first-post", first.ID)
+	assert.Equal(t, "https://example.substack.com/p/first-post", first.URL)
+	assert.Equal(t, "The beginning", first.Summary)
+	assert.Equal(t, "2023-01-01T10:00:00Z", first.DatePublished)
+	assert.Equal(t, []string{"news"}, first.Tags)
+
+	assert.Equal(t, "undated-post", feed.Items[3].ID)
+	assert.Empty(t, feed.Items[3].DatePublished)
+
+	// An empty feed still has its items array
+	empty, err := BuildJSONFeed(nil, manifest, FeedOptions{Title: "Empty"})
+	require.NoError(t, err)
+	data, err = json.Marshal(empty)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"items":[]`)
+}
+
+// Test the content of a feed item
+func TestFeedItemHTML(t *testing.T) {
+	dir := t.TempDir()
+	manifest, err := LoadManifest(dir)
+	require.NoError(t, err)
+
+	post := LocalPost{
+		Path:    filepath.Join(dir, "20230101_100000_first-post.html"),
+		Slug:    "first-post",
+		Format:  "html",
+		Content: `<h1>First Post</h1><p>Text</p><img src="images/first.png"><a href="files/report.pdf">report</a><img src="https://example.com/remote.png">`,
+	}
+
+	empty, err := BuildFeed(nil, manifest, FeedOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, empty.Channel.Items)
+
+	content, err := feedItemHTML(post, manifest, nil)
+	require.NoError(t, err)
+	assert.False(t, strings.Contains(content, "<h1>"))
+	assert.Contains(t, content, `src="images/first.png"`)
+
+	feed, err := BuildFeed([]LocalPost{post}, manifest, FeedOptions{Title: "T", BaseURL: "https://example.com/archive/"})
+	require.NoError(t, err)
+	content = feed.Channel.Items[0].Content.Value
+	assert.Contains(t, content, `src="https://example.com/archive/images/first.png"`)
+	assert.Contains(t, content, `href="https://example.com/archive/files/report.pdf"`)
+	assert.Contains(t, content, `src="https://example.com/remote.png"`)
+}
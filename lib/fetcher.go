@@ -1,12 +1,19 @@
 package lib
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
@@ -23,17 +30,33 @@ const DefaultBurst = 5
 // defaultRetryAfter specifies the default value for Retry-After header in case of too many requests.
 const defaultRetryAfter = 60
 
-// defaultMaxRetryCount defines the default maximum number of retries for a failed URL fetch.
-const defaultMaxRetryCount = 10
+// DefaultMaxRetries defines the default maximum number of retries for a failed URL fetch.
+const DefaultMaxRetries = 10
 
-// defaultMaxElapsedTime specifies the default maximum elapsed time for the exponential backoff.
-const defaultMaxElapsedTime = 10 * time.Minute
+// DefaultInitialBackoff defines the default wait before the first retry, growing for the next ones.
+const DefaultInitialBackoff = 500 * time.Millisecond
+
+// DefaultRetryStatuses are the status codes of the transient errors retried with backoff by default.
+// Other errors, such as 404 or 500, are permanent and fail at once.
+var DefaultRetryStatuses = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// DefaultMaxElapsedTime specifies the default maximum elapsed time for the exponential backoff.
+const DefaultMaxElapsedTime = 10 * time.Minute
 
 // defaultMaxInterval defines the default maximum interval for the exponential backoff.
 const defaultMaxInterval = 2 * time.Minute
 
-// defaultClientTimeout defines the default timeout for HTTP requests.
-const defaultClientTimeout = 30 * time.Second
+// DefaultTimeout defines the default timeout of a single HTTP request attempt.
+const DefaultTimeout = 30 * time.Second
+
+// DefaultURLTimeout defines the default time budget to fetch a URL, retries included.
+const DefaultURLTimeout = DefaultMaxElapsedTime
 
 // userAgent specifies the User-Agent header value used in HTTP requests.
 const userAgent = "sbstck-dl/0.1"
@@ -45,6 +68,37 @@ type Fetcher struct {
 	BackoffCfg  backoff.BackOff
 	Cookie      *http.Cookie
 	MaxWorkers  int
+	URLTimeout  time.Duration // Total time budget of FetchURL, 0 for no budget
+	Jitter      time.Duration // Maximum random delay added before each request
+	// RespectRobots makes FetchURL obey the robots.txt of each host, including its Crawl-delay
+	RespectRobots bool
+	// Offline makes every request fail with ErrOffline
+	Offline bool
+	// WARC records the HTTP exchanges of FetchURL if set
+	WARC *WARCWriter
+	// RetryBudget limits the retries of FetchURL if set, possibly shared with other Fetchers
+	RetryBudget *RetryBudget
+	// RetryStatuses are the status codes retried with backoff, other errors failing at once
+	RetryStatuses []int
+	// MaxRetries is the maximum number of retries of a URL
+	MaxRetries int
+	// OnEvent is called, possibly concurrently, when a request waits for the rate limiter or before
+	// a retry, and when the protocol used with a host is first known
+	OnEvent func(FetchEvent)
+
+	robotsMu sync.Mutex
+	robots   map[string]*RobotsRules // Rules of each scheme://host
+
+	attemptsMu sync.Mutex
+	attempts   map[string]int // Requests made for the URLs that failed
+
+	bytesRead atomic.Int64 // Bytes read from the bodies of the responses
+
+	statsMu sync.Mutex
+	stats   FetchStats
+
+	protocolsMu sync.Mutex
+	protocols   map[string]string // Protocol negotiated with each host
 }
 
 // FetcherOptions holds configurable options for Fetcher.
@@ -55,7 +109,23 @@ type FetcherOptions struct {
 	BackOffConfig backoff.BackOff
 	Cookie        *http.Cookie
 	Timeout       time.Duration
+	URLTimeout    time.Duration
+	Jitter        time.Duration
 	MaxWorkers    int
+	RespectRobots bool
+	Offline       bool
+	RateLimiter   *rate.Limiter // shared limiter, instead of one created from RatePerSecond and Burst
+	RetryBudget   *RetryBudget
+	RetryStatuses []int
+	MaxRetries    int
+
+	// Connection tuning, see transport.go
+	MaxIdleConnsPerHost int
+	KeepAlive           time.Duration
+	DNSCacheTTL         time.Duration
+	Resolver            string
+	DisableHTTP2        bool
+	Brotli              bool
 }
 
 // FetcherOption defines a function that applies a specific option to FetcherOptions.
@@ -89,6 +159,13 @@ func WithBackOffConfig(b backoff.BackOff) FetcherOption {
 	}
 }
 
+// WithMaxRetries sets the maximum number of retries of a URL, 0 for none.
+func WithMaxRetries(retries int) FetcherOption {
+	return func(o *FetcherOptions) {
+		o.MaxRetries = retries
+	}
+}
+
 // WithCookie sets the cookie for the Fetcher.
 func WithCookie(cookie *http.Cookie) FetcherOption {
 	return func(o *FetcherOptions) {
@@ -98,13 +175,69 @@ func WithCookie(cookie *http.Cookie) FetcherOption {
 	}
 }
 
-// WithTimeout sets the HTTP client timeout.
+// WithTimeout sets the timeout of a single HTTP request attempt, body included.
 func WithTimeout(timeout time.Duration) FetcherOption {
 	return func(o *FetcherOptions) {
 		o.Timeout = timeout
 	}
 }
 
+// WithURLTimeout sets the total time budget to fetch a URL, including the retries and the
+// waits between them. No attempt is started once the budget is spent. 0 disables the budget.
+func WithURLTimeout(timeout time.Duration) FetcherOption {
+	return func(o *FetcherOptions) {
+		o.URLTimeout = timeout
+	}
+}
+
+// WithRespectRobots makes the Fetcher obey robots.txt. Disallowed URLs fail with
+// ErrDisallowedByRobots and the rate is lowered to the Crawl-delay of the hosts.
+func WithRespectRobots(respect bool) FetcherOption {
+	return func(o *FetcherOptions) {
+		o.RespectRobots = respect
+	}
+}
+
+// WithJitter adds a random delay of up to max before each request, on top of the rate limiter,
+// so that requests are spread out instead of coming in bursts.
+func WithJitter(max time.Duration) FetcherOption {
+	return func(o *FetcherOptions) {
+		o.Jitter = max
+	}
+}
+
+// WithRateLimiter makes the Fetcher use an existing rate limiter, e.g. one shared with other Fetchers.
+// RatePerSecond and Burst are then ignored.
+func WithRateLimiter(limiter *rate.Limiter) FetcherOption {
+	return func(o *FetcherOptions) {
+		o.RateLimiter = limiter
+	}
+}
+
+// WithRetryBudget limits the retries of the Fetcher to the budget, which can be shared with other Fetchers.
+func WithRetryBudget(budget *RetryBudget) FetcherOption {
+	return func(o *FetcherOptions) {
+		o.RetryBudget = budget
+	}
+}
+
+// WithRetryStatuses sets the status codes retried with backoff, instead of DefaultRetryStatuses.
+// Without codes, no error is retried.
+func WithRetryStatuses(codes ...int) FetcherOption {
+	return func(o *FetcherOptions) {
+		o.RetryStatuses = codes
+	}
+}
+
+// WithSharedLimits makes the Fetcher share the rate limiter and retry budget of another Fetcher,
+// e.g. to use different proxies or cookies without exceeding the rate limit of a single process.
+func WithSharedLimits(other *Fetcher) FetcherOption {
+	return func(o *FetcherOptions) {
+		o.RateLimiter = other.RateLimiter
+		o.RetryBudget = other.RetryBudget
+	}
+}
+
 // WithMaxWorkers sets the maximum number of concurrent workers.
 func WithMaxWorkers(workers int) FetcherOption {
 	return func(o *FetcherOptions) {
@@ -112,6 +245,42 @@ func WithMaxWorkers(workers int) FetcherOption {
 	}
 }
 
+// ErrRetryBudgetExhausted is returned instead of retrying once the retry budget is spent
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// RetryBudget is a number of retries shared by all the requests of one or more Fetchers,
+// so that a struggling server doesn't make a run retry endlessly. It is safe for concurrent use.
+type RetryBudget struct {
+	mu        sync.Mutex
+	remaining int
+}
+
+// NewRetryBudget creates a budget of n retries
+func NewRetryBudget(n int) *RetryBudget {
+	return &RetryBudget{remaining: n}
+}
+
+// Take uses one retry of the budget, reporting false if none is left. A nil budget is unlimited.
+func (b *RetryBudget) Take() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.remaining <= 0 {
+		return false
+	}
+	b.remaining--
+	return true
+}
+
+// Remaining returns the number of retries left
+func (b *RetryBudget) Remaining() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.remaining
+}
+
 // FetchResult represents the result of a URL fetch operation.
 type FetchResult struct {
 	Url   string
@@ -139,9 +308,12 @@ func NewFetcher(opts ...FetcherOption) *Fetcher {
 	options := FetcherOptions{
 		RatePerSecond: DefaultRatePerSecond,
 		Burst:         DefaultBurst,
-		BackOffConfig: makeDefaultBackoff(),
-		Timeout:       defaultClientTimeout,
+		BackOffConfig: NewBackOff(DefaultInitialBackoff, DefaultMaxElapsedTime),
+		Timeout:       DefaultTimeout,
+		URLTimeout:    DefaultURLTimeout,
 		MaxWorkers:    10, // Default to 10 workers
+		RetryStatuses: DefaultRetryStatuses,
+		MaxRetries:    DefaultMaxRetries,
 	}
 
 	for _, opt := range opts {
@@ -155,22 +327,38 @@ func NewFetcher(opts ...FetcherOption) *Fetcher {
 
 	// Set sensible defaults for transport
 	transport.MaxIdleConns = 100
-	transport.MaxIdleConnsPerHost = options.MaxWorkers
 	transport.MaxConnsPerHost = options.MaxWorkers
 	transport.IdleConnTimeout = 90 * time.Second
 	transport.TLSHandshakeTimeout = 10 * time.Second
+	configureTransport(transport, options)
 
 	client := &http.Client{
 		Transport: transport,
 		Timeout:   options.Timeout,
 	}
+	if options.Brotli {
+		client.Transport = &brotliTransport{base: transport}
+	}
+
+	limiter := options.RateLimiter
+	if limiter == nil {
+		limiter = rate.NewLimiter(rate.Limit(options.RatePerSecond), options.Burst)
+	}
 
 	return &Fetcher{
 		Client:      client,
-		RateLimiter: rate.NewLimiter(rate.Limit(options.RatePerSecond), options.Burst),
+		RateLimiter: limiter,
 		BackoffCfg:  options.BackOffConfig,
 		Cookie:      options.Cookie,
 		MaxWorkers:  options.MaxWorkers,
+		URLTimeout:  options.URLTimeout,
+		Jitter:      options.Jitter,
+
+		RespectRobots: options.RespectRobots,
+		Offline:       options.Offline,
+		RetryBudget:   options.RetryBudget,
+		RetryStatuses: options.RetryStatuses,
+		MaxRetries:    options.MaxRetries,
 	}
 }
 
@@ -219,50 +407,216 @@ func (f *Fetcher) FetchURLs(ctx context.Context, urls []string) <-chan FetchResu
 }
 
 // FetchURL fetches the specified URL with retries and rate limiting.
+// The retries stop when the URL timeout of the fetcher is reached.
 func (f *Fetcher) FetchURL(ctx context.Context, url string) (io.ReadCloser, error) {
-	var body io.ReadCloser
+	res, err := f.fetchResponse(ctx, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// FetchRange fetches the bytes of url from offset on, with the retries and rate limiting of
+// FetchURL, to resume an interrupted download. ifRange is the ETag or Last-Modified date of the
+// bytes already downloaded: if the resource changed since, or the server doesn't support
+// ranges, the whole resource is sent with status 200 instead of 206 Partial Content.
+func (f *Fetcher) FetchRange(ctx context.Context, url string, offset int64, ifRange string) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	if ifRange != "" {
+		header.Set("If-Range", ifRange)
+	}
+	return f.fetchResponse(ctx, url, header)
+}
+
+// fetchResponse makes a GET request for url with the given headers, with retries and rate limiting
+func (f *Fetcher) fetchResponse(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	var res *http.Response
 	var err error
 	var retryCounter int
+	var attempts int
+
+	if f.Offline {
+		return nil, offlineError(url)
+	}
+
+	// The budget only bounds the waits and the start of the attempts: the request itself
+	// uses ctx, so that the returned body can still be read once the budget is spent
+	budgetCtx := ctx
+	if f.URLTimeout > 0 {
+		var cancel context.CancelFunc
+		budgetCtx, cancel = context.WithTimeout(ctx, f.URLTimeout)
+		defer cancel()
+	}
+
+	if f.RespectRobots {
+		if err := f.checkRobots(budgetCtx, url); err != nil {
+			return nil, err
+		}
+	}
 
 	operation := func() error {
-		if retryCounter >= defaultMaxRetryCount {
-			return backoff.Permanent(fmt.Errorf("max retry count reached for URL: %s", url))
+		if attempts > 0 && !f.RetryBudget.Take() {
+			return backoff.Permanent(fmt.Errorf("%w: %w", ErrRetryBudgetExhausted, err))
 		}
 
-		err = f.RateLimiter.Wait(ctx) // Use rate limiter
+		waitStart := time.Now()
+		err = f.RateLimiter.Wait(budgetCtx) // Use rate limiter
 		if err != nil {
 			return backoff.Permanent(err) // Context cancellation or rate limiter error
 		}
+		if err = sleepContext(budgetCtx, randomDuration(f.Jitter)); err != nil {
+			return backoff.Permanent(err)
+		}
+		f.recordWait(FetchEvent{Kind: FetchEventRateLimit, URL: url, Wait: time.Since(waitStart), Attempt: attempts})
 
-		body, err = f.fetch(ctx, url)
+		attempts++
+		requestStart := time.Now()
+		res, err = f.do(ctx, url, header)
+		f.recordRequest(time.Since(requestStart), err)
 		if err != nil {
-			// If it's a fetch error that should be retried
-			if fetchErr, ok := err.(*FetchError); ok && fetchErr.TooManyRequests {
+			// Transient errors are retried within the budget, permanent ones fail at once
+			if f.transient(ctx, err) {
+				if retryCounter >= f.MaxRetries {
+					return backoff.Permanent(fmt.Errorf("max retry count reached for URL: %s: %w", url, err))
+				}
 				retryCounter++
 				return err
 			}
-			// For other errors, don't retry
 			return backoff.Permanent(err)
 		}
 		return nil
 	}
 
 	// Use backoff with notification for logging
+	var lastErr error
 	err = backoff.RetryNotify(
 		operation,
-		f.BackoffCfg,
+		backoff.WithContext(f.BackoffCfg, budgetCtx),
 		func(err error, d time.Duration) {
-			// This could be connected to a logger
-			_ = err // Avoid unused variable error
+			lastErr = err
+			f.recordWait(FetchEvent{Kind: FetchEventRetry, URL: url, Wait: d, Attempt: attempts, Err: err})
 		},
 	)
 
-	return body, err
+	if err != nil && ctx.Err() == nil && budgetCtx.Err() != nil {
+		if lastErr == nil {
+			lastErr = budgetCtx.Err()
+		}
+		res, err = nil, fmt.Errorf("giving up on %s after %s: %w", url, f.URLTimeout, lastErr)
+	}
+	f.recordAttempts(url, attempts, err)
+	return res, err
 }
 
-// fetch performs the actual HTTP GET request.
-func (f *Fetcher) fetch(ctx context.Context, url string) (io.ReadCloser, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+// transient reports whether the error of an attempt is worth retrying: a response whose status
+// code is retried, or a request that timed out or whose connection was cut. Nothing is retried
+// once ctx, the context of the whole run, is done.
+func (f *Fetcher) transient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		for _, code := range f.RetryStatuses {
+			if fetchErr.StatusCode == code {
+				return true
+			}
+		}
+		return false
+	}
+
+	// The deadline of the attempt, e.g. the timeout of the client, not of the run
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	// The connection was closed or reset before the response was complete
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) {
+		return true
+	}
+	// Other network errors, e.g. a refused connection, but for hosts that don't exist
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// recordAttempts remembers how many requests were made for a URL that failed to be fetched
+func (f *Fetcher) recordAttempts(url string, attempts int, err error) {
+	f.attemptsMu.Lock()
+	defer f.attemptsMu.Unlock()
+	if err == nil {
+		delete(f.attempts, url)
+		return
+	}
+	if f.attempts == nil {
+		f.attempts = make(map[string]int)
+	}
+	f.attempts[url] = attempts
+}
+
+// FailedAttempts returns the number of requests made the last time fetching url failed,
+// or 0 if it didn't fail
+func (f *Fetcher) FailedAttempts(url string) int {
+	f.attemptsMu.Lock()
+	defer f.attemptsMu.Unlock()
+	return f.attempts[url]
+}
+
+// FetchHeader makes a single HEAD request for the URL, without retries, and returns the
+// response headers. It is meant to learn about a resource before downloading it.
+func (f *Fetcher) FetchHeader(ctx context.Context, url string) (http.Header, error) {
+	if f.Offline {
+		return nil, offlineError(url)
+	}
+	if f.RespectRobots {
+		if err := f.checkRobots(ctx, url); err != nil {
+			return nil, err
+		}
+	}
+	waitStart := time.Now()
+	if err := f.RateLimiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	f.recordWait(FetchEvent{Kind: FetchEventRateLimit, URL: url, Wait: time.Since(waitStart)})
+
+	req, err := f.newRequest(ctx, http.MethodHead, url)
+	if err != nil {
+		return nil, err
+	}
+	requestStart := time.Now()
+	res, err := f.Client.Do(req)
+	f.recordRequest(time.Since(requestStart), err)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	f.recordProtocol(url, res)
+
+	if f.WARC != nil {
+		if err := f.recordExchange(req, res); err != nil {
+			return nil, err
+		}
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, &FetchError{
+			TooManyRequests: res.StatusCode == http.StatusTooManyRequests,
+			StatusCode:      res.StatusCode,
+		}
+	}
+	return res.Header, nil
+}
+
+// newRequest creates a request with the user agent and cookie of the fetcher
+func (f *Fetcher) newRequest(ctx context.Context, method, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -273,14 +627,45 @@ func (f *Fetcher) fetch(ctx context.Context, url string) (io.ReadCloser, error)
 	if f.Cookie != nil {
 		req.AddCookie(f.Cookie)
 	}
+	return req, nil
+}
+
+// fetch performs the actual HTTP GET request.
+func (f *Fetcher) fetch(ctx context.Context, url string) (io.ReadCloser, error) {
+	res, err := f.do(ctx, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// do performs a single HTTP GET request with the given headers. Responses other than 200, or
+// 206 for range requests, are returned as a FetchError.
+func (f *Fetcher) do(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	req, err := f.newRequest(ctx, http.MethodGet, url)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
 
 	res, err := f.Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	f.recordProtocol(url, res)
+
+	if f.WARC != nil {
+		if err := f.recordExchange(req, res); err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+	}
 
 	// Handle non-success status codes
-	if res.StatusCode != http.StatusOK {
+	partial := res.StatusCode == http.StatusPartialContent && header.Get("Range") != ""
+	if res.StatusCode != http.StatusOK && !partial {
 		// Always close the body for non-200 responses
 		defer res.Body.Close()
 
@@ -303,19 +688,73 @@ func (f *Fetcher) fetch(ctx context.Context, url string) (io.ReadCloser, error)
 		}
 	}
 
-	return res.Body, nil
+	res.Body = &countingBody{ReadCloser: res.Body, count: &f.bytesRead}
+	return res, nil
 }
 
-// makeDefaultBackoff creates the default exponential backoff configuration.
-func makeDefaultBackoff() backoff.BackOff {
+// BytesRead returns the number of bytes read so far from the responses of the fetcher
+func (f *Fetcher) BytesRead() int64 {
+	return f.bytesRead.Load()
+}
+
+// countingBody adds the bytes read from a response body to count
+type countingBody struct {
+	io.ReadCloser
+	count *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.count.Add(int64(n))
+	return n, err
+}
+
+// recordExchange reads the body of res to record it in the WARC file, replacing it by the read copy
+func (f *Fetcher) recordExchange(req *http.Request, res *http.Response) error {
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	return f.WARC.WriteExchange(req, res, body)
+}
+
+// NewBackOff creates the exponential backoff of the Fetchers, waiting initial before the first
+// retry and giving up once maxElapsed is spent (0 for never).
+func NewBackOff(initial, maxElapsed time.Duration) backoff.BackOff {
 	backOffCfg := backoff.NewExponentialBackOff()
-	backOffCfg.MaxElapsedTime = defaultMaxElapsedTime
+	backOffCfg.InitialInterval = initial
+	backOffCfg.MaxElapsedTime = maxElapsed
 	backOffCfg.MaxInterval = defaultMaxInterval
 	backOffCfg.Multiplier = 1.5 // Reduced from 2.0 for more gradual backoff
 
 	return backOffCfg
 }
 
+// sleepContext sleeps for d, returning early with an error if ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// randomDuration returns a random duration in [0, max)
+func randomDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
 // min returns the smaller of two integers.
 func min(a, b int) int {
 	if a < b {
@@ -2,14 +2,18 @@ package lib
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
@@ -503,6 +507,122 @@ func TestFetchURLs(t *testing.T) {
 	})
 }
 
+// TestFetchURLTimeouts tests the per-attempt timeout and the per-URL budget separately
+func TestFetchURLTimeouts(t *testing.T) {
+	t.Run("DefaultTimeouts", func(t *testing.T) {
+		f := NewFetcher()
+		assert.Equal(t, DefaultTimeout, f.Client.Timeout)
+		assert.Equal(t, DefaultURLTimeout, f.URLTimeout)
+	})
+
+	t.Run("URLBudgetStopsRetries", func(t *testing.T) {
+		var attempts int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&attempts, 1)
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		f := NewFetcher(
+			WithBackOffConfig(backoff.NewConstantBackOff(100*time.Millisecond)),
+			WithURLTimeout(350*time.Millisecond),
+		)
+
+		start := time.Now()
+		body, err := f.FetchURL(context.Background(), server.URL)
+		assert.Nil(t, body)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "giving up on")
+		var fetchErr *FetchError
+		assert.ErrorAs(t, err, &fetchErr)
+		assert.Less(t, time.Since(start), 2*time.Second)
+		assert.GreaterOrEqual(t, atomic.LoadInt32(&attempts), int32(2))
+	})
+
+	t.Run("AttemptTimeoutWithinBudget", func(t *testing.T) {
+		var attempts int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&attempts, 1)
+			time.Sleep(300 * time.Millisecond)
+			w.Write([]byte("slow"))
+		}))
+		defer server.Close()
+
+		// An attempt longer than the attempt timeout fails, and is retried as a transient error
+		f := NewFetcher(WithTimeout(100*time.Millisecond), WithURLTimeout(time.Minute),
+			WithBackOffConfig(&backoff.ZeroBackOff{}), WithMaxRetries(2))
+		_, err := f.FetchURL(context.Background(), server.URL)
+		assert.Error(t, err)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+
+		// The body can still be read when the budget is spent during the attempt
+		f = NewFetcher(WithTimeout(time.Second), WithURLTimeout(100*time.Millisecond))
+		body, err := f.FetchURL(context.Background(), server.URL)
+		require.NoError(t, err)
+		data, err := io.ReadAll(body)
+		body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, "slow", string(data))
+	})
+}
+
+// TestFetchURLJitter tests the random delay added before requests
+func TestFetchURLJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		d := randomDuration(10 * time.Millisecond)
+		assert.GreaterOrEqual(t, d, time.Duration(0))
+		assert.Less(t, d, 10*time.Millisecond)
+	}
+	assert.Equal(t, time.Duration(0), randomDuration(0))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	f := NewFetcher(WithJitter(time.Hour))
+	assert.Equal(t, time.Hour, f.Jitter)
+
+	// The jitter is cut short by the context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := f.FetchURL(ctx, server.URL)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// TestSharedLimits tests Fetchers sharing a rate limiter and a retry budget
+func TestSharedLimits(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	budget := NewRetryBudget(2)
+	first := NewFetcher(WithRetryBudget(budget), WithBackOffConfig(&backoff.ZeroBackOff{}))
+	second := NewFetcher(WithSharedLimits(first), WithBackOffConfig(&backoff.ZeroBackOff{}))
+	assert.Same(t, first.RateLimiter, second.RateLimiter)
+	assert.Same(t, budget, second.RetryBudget)
+
+	// The first Fetcher spends both retries, so the second one doesn't retry at all
+	_, err := first.FetchURL(context.Background(), server.URL)
+	assert.ErrorIs(t, err, ErrRetryBudgetExhausted)
+	assert.Equal(t, ErrorClassRateLimited, ClassifyError(err))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	_, err = second.FetchURL(context.Background(), server.URL)
+	assert.ErrorIs(t, err, ErrRetryBudgetExhausted)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&requests))
+	assert.Equal(t, 0, budget.Remaining())
+
+	limiter := rate.NewLimiter(rate.Limit(1), 1)
+	assert.Same(t, limiter, NewFetcher(WithRateLimiter(limiter), WithRatePerSecond(100)).RateLimiter)
+
+	// A nil budget is unlimited
+	var unlimited *RetryBudget
+	assert.True(t, unlimited.Take())
+}
+
 // TestFetchErrors tests the FetchError type
 func TestFetchErrors(t *testing.T) {
 	t.Run("TooManyRequestsError", func(t *testing.T) {
@@ -658,3 +778,127 @@ func BenchmarkFetcher(b *testing.B) {
 		}
 	})
 }
+
+// TestFetchURLRetryStatuses tests that transient errors are retried and permanent ones fail at once
+func TestFetchURLRetryStatuses(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&attempts, 1)
+		switch {
+		case r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case n < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	f := NewFetcher(WithBackOffConfig(&backoff.ZeroBackOff{}), WithRatePerSecond(100))
+	assert.Equal(t, DefaultRetryStatuses, f.RetryStatuses)
+	body, err := f.FetchURL(context.Background(), server.URL+"/unavailable")
+	require.NoError(t, err)
+	body.Close()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+
+	atomic.StoreInt32(&attempts, 0)
+	_, err = f.FetchURL(context.Background(), server.URL+"/missing")
+	var fetchErr *FetchError
+	require.ErrorAs(t, err, &fetchErr)
+	assert.Equal(t, http.StatusNotFound, fetchErr.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+
+	// Without retry statuses, even a 503 fails at once
+	atomic.StoreInt32(&attempts, 0)
+	f = NewFetcher(WithBackOffConfig(&backoff.ZeroBackOff{}), WithRatePerSecond(100), WithRetryStatuses())
+	_, err = f.FetchURL(context.Background(), server.URL+"/unavailable")
+	require.ErrorAs(t, err, &fetchErr)
+	assert.Equal(t, http.StatusServiceUnavailable, fetchErr.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+// TestFetchURLTransientErrors tests that the network errors of an attempt are retried, but not
+// once the run is over
+func TestFetchURLTransientErrors(t *testing.T) {
+	var attempts int32
+	var cancelRun context.CancelFunc
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&attempts, 1)
+		if r.URL.Path == "/cancelled" {
+			cancelRun()
+		}
+		if r.URL.Path == "/cancelled" || n < 3 {
+			// The connection is cut before any response
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	f := NewFetcher(WithBackOffConfig(&backoff.ZeroBackOff{}), WithRatePerSecond(100))
+	body, err := f.FetchURL(context.Background(), server.URL+"/dropped")
+	require.NoError(t, err)
+	body.Close()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+
+	atomic.StoreInt32(&attempts, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelRun = cancel
+	_, err = f.FetchURL(ctx, server.URL+"/cancelled")
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+
+	running := context.Background()
+	for _, tc := range []struct {
+		err       error
+		transient bool
+	}{
+		{&FetchError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&FetchError{StatusCode: http.StatusNotFound}, false},
+		{&FetchError{StatusCode: http.StatusInternalServerError}, false},
+		{fmt.Errorf("attempt: %w", context.DeadlineExceeded), true},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: io.ErrUnexpectedEOF}, true},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: io.EOF}, true},
+		{&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "missing.example", IsNotFound: true}}, false},
+		{errors.New("certificate signed by unknown authority"), false},
+	} {
+		assert.Equal(t, tc.transient, f.transient(running, tc.err), "%v", tc.err)
+	}
+	// Nothing is retried once the run is over
+	assert.False(t, f.transient(ctx, &FetchError{StatusCode: http.StatusServiceUnavailable}))
+}
+
+// TestFetchURLMaxRetries tests the limit on the retries of a URL and the backoff of the Fetchers
+func TestFetchURLMaxRetries(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	assert.Equal(t, DefaultMaxRetries, NewFetcher().MaxRetries)
+
+	f := NewFetcher(WithBackOffConfig(&backoff.ZeroBackOff{}), WithRatePerSecond(100), WithMaxRetries(2))
+	_, err := f.FetchURL(context.Background(), server.URL)
+	assert.Contains(t, err.Error(), "max retry count")
+	var fetchErr *FetchError
+	require.ErrorAs(t, err, &fetchErr)
+	assert.Equal(t, http.StatusServiceUnavailable, fetchErr.StatusCode)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+
+	atomic.StoreInt32(&attempts, 0)
+	f = NewFetcher(WithBackOffConfig(&backoff.ZeroBackOff{}), WithRatePerSecond(100), WithMaxRetries(0))
+	_, err = f.FetchURL(context.Background(), server.URL)
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+
+	b := NewBackOff(time.Second, time.Hour).(*backoff.ExponentialBackOff)
+	assert.Equal(t, time.Second, b.InitialInterval)
+	assert.Equal(t, time.Hour, b.MaxElapsedTime)
+}
@@ -0,0 +1,106 @@
+package lib
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// FetchEventKind is the reason a Fetcher waits before a request, or what it learned from a response
+type FetchEventKind string
+
+const (
+	FetchEventRateLimit FetchEventKind = "rate_limit" // waiting for the rate limiter, or the jitter
+	FetchEventRetry     FetchEventKind = "retry"      // backing off before retrying a failed request
+	FetchEventProtocol  FetchEventKind = "protocol"   // first response of a host, or with another protocol
+)
+
+// FetchEvent is reported to the OnEvent function of a Fetcher each time it waits before a request,
+// and when it learns the protocol used with a host
+type FetchEvent struct {
+	Kind    FetchEventKind
+	URL     string
+	Wait    time.Duration
+	Attempt int    // requests already made for the URL
+	Err     error  // why the request is retried, for FetchEventRetry
+	Proto   string // protocol of the response, such as "HTTP/2.0", for FetchEventProtocol
+}
+
+// FetchStats are the cumulative figures of a Fetcher, telling apart the time spent on the
+// network, waiting for the rate limiter, and backing off after server errors
+type FetchStats struct {
+	Requests       int
+	FailedRequests int           // requests that failed or got another status than 200
+	RequestTime    time.Duration // time waiting for the responses, their bodies excluded
+	RateLimitWait  time.Duration // time waiting for the rate limiter and the jitter
+	Retries        int
+	RetryWait      time.Duration // time backing off before the retries
+}
+
+// String summarizes the stats on one line
+func (s FetchStats) String() string {
+	return fmt.Sprintf("%d requests (%d failed) waiting %s for responses, %s rate limited, %d retries after backing off for %s",
+		s.Requests, s.FailedRequests, s.RequestTime.Round(time.Millisecond), s.RateLimitWait.Round(time.Millisecond),
+		s.Retries, s.RetryWait.Round(time.Millisecond))
+}
+
+// Stats returns the cumulative stats of the fetcher
+func (f *Fetcher) Stats() FetchStats {
+	f.statsMu.Lock()
+	defer f.statsMu.Unlock()
+	return f.stats
+}
+
+// recordRequest adds a request that took d to the stats
+func (f *Fetcher) recordRequest(d time.Duration, err error) {
+	f.statsMu.Lock()
+	defer f.statsMu.Unlock()
+	f.stats.Requests++
+	f.stats.RequestTime += d
+	if err != nil {
+		f.stats.FailedRequests++
+	}
+}
+
+// recordWait adds the wait of event to the stats, and reports it to OnEvent.
+// Waits under a millisecond, when the rate limiter lets the request through, are ignored.
+func (f *Fetcher) recordWait(event FetchEvent) {
+	if event.Kind == FetchEventRateLimit && event.Wait < time.Millisecond {
+		return
+	}
+
+	f.statsMu.Lock()
+	switch event.Kind {
+	case FetchEventRateLimit:
+		f.stats.RateLimitWait += event.Wait
+	case FetchEventRetry:
+		f.stats.Retries++
+		f.stats.RetryWait += event.Wait
+	}
+	f.statsMu.Unlock()
+
+	if f.OnEvent != nil {
+		f.OnEvent(event)
+	}
+}
+
+// recordProtocol reports to OnEvent the protocol of res when it is the first response of its
+// host, or when the protocol changed, e.g. after a proxy downgraded the connection
+func (f *Fetcher) recordProtocol(url string, res *http.Response) {
+	if f.OnEvent == nil || res.Request == nil {
+		return
+	}
+	host := res.Request.URL.Host
+
+	f.protocolsMu.Lock()
+	if f.protocols == nil {
+		f.protocols = make(map[string]string)
+	}
+	changed := f.protocols[host] != res.Proto
+	f.protocols[host] = res.Proto
+	f.protocolsMu.Unlock()
+
+	if changed {
+		f.OnEvent(FetchEvent{Kind: FetchEventProtocol, URL: url, Proto: res.Proto})
+	}
+}
@@ -0,0 +1,104 @@
+package lib
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetcherEvents(t *testing.T) {
+	// The first request is rate limited by the server, the next ones succeed
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	f := NewFetcher(WithRatePerSecond(5), WithBurst(1), WithBackOffConfig(backoff.NewConstantBackOff(10*time.Millisecond)))
+	var mu sync.Mutex
+	var events []FetchEvent
+	f.OnEvent = func(event FetchEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+
+	for i := 0; i < 2; i++ {
+		body, err := f.FetchURL(context.Background(), server.URL)
+		require.NoError(t, err)
+		io.Copy(io.Discard, body)
+		body.Close()
+	}
+
+	var retries, waits int
+	for _, event := range events {
+		assert.Equal(t, server.URL, event.URL)
+		switch event.Kind {
+		case FetchEventRetry:
+			retries++
+			assert.Equal(t, 10*time.Millisecond, event.Wait)
+			assert.Equal(t, 1, event.Attempt)
+			var fetchErr *FetchError
+			if assert.ErrorAs(t, event.Err, &fetchErr) {
+				assert.True(t, fetchErr.TooManyRequests)
+			}
+		case FetchEventRateLimit:
+			waits++
+			assert.Greater(t, event.Wait, time.Duration(0))
+		}
+	}
+	assert.Equal(t, 1, retries)
+	// At 5 requests per second, the requests after the first one wait for the limiter
+	assert.Equal(t, 2, waits)
+
+	stats := f.Stats()
+	assert.Equal(t, 3, stats.Requests)
+	assert.Equal(t, 1, stats.FailedRequests)
+	assert.Equal(t, 1, stats.Retries)
+	assert.Equal(t, 10*time.Millisecond, stats.RetryWait)
+	assert.GreaterOrEqual(t, stats.RateLimitWait, 300*time.Millisecond)
+	assert.Greater(t, stats.RequestTime, time.Duration(0))
+	assert.Contains(t, stats.String(), "3 requests (1 failed)")
+}
+
+// Test that the protocol of a host is reported once, when it is first known
+func TestFetcherProtocolEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	f := NewFetcher(WithRatePerSecond(100), WithHTTP2(false))
+	var events []FetchEvent
+	f.OnEvent = func(event FetchEvent) {
+		if event.Kind == FetchEventProtocol {
+			events = append(events, event)
+		}
+	}
+
+	for _, path := range []string{"/a", "/b"} {
+		body, err := f.FetchURL(context.Background(), server.URL+path)
+		require.NoError(t, err)
+		io.Copy(io.Discard, body)
+		body.Close()
+	}
+	_, err := f.FetchHeader(context.Background(), server.URL+"/c")
+	require.NoError(t, err)
+
+	require.Len(t, events, 1)
+	assert.Equal(t, server.URL+"/a", events[0].URL)
+	assert.Equal(t, "HTTP/1.1", events[0].Proto)
+}
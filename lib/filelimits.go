@@ -0,0 +1,29 @@
+package lib
+
+import "context"
+
+// AttachmentLimits keeps a post linking huge or unwanted files from blowing up a download.
+// The attachments they leave out keep their remote URL and are not reported as failed.
+type AttachmentLimits struct {
+	ExcludeExtensions []string // extensions of the attachments never downloaded, e.g. "mp4"
+	MaxSize           int64    // attachments larger than this many bytes are not downloaded, 0 for no limit
+	MaxPerPost        int      // at most this many attachments are downloaded per post, 0 for no limit
+}
+
+// IsZero reports whether no limit is set
+func (l AttachmentLimits) IsZero() bool {
+	return len(l.ExcludeExtensions) == 0 && l.MaxSize == 0 && l.MaxPerPost == 0
+}
+
+type attachmentLimitsKey struct{}
+
+// withAttachmentLimits returns a context downloading attachments within the given limits
+func withAttachmentLimits(ctx context.Context, limits AttachmentLimits) context.Context {
+	return context.WithValue(ctx, attachmentLimitsKey{}, limits)
+}
+
+// attachmentLimitsFromContext returns the limits of the attachments downloaded with ctx, if any
+func attachmentLimitsFromContext(ctx context.Context) AttachmentLimits {
+	limits, _ := ctx.Value(attachmentLimitsKey{}).(AttachmentLimits)
+	return limits
+}
@@ -2,8 +2,9 @@ package lib
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
+	"mime"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -29,7 +30,10 @@ type FileDownloader struct {
 	fetcher        *Fetcher
 	outputDir      string
 	filesDir       string
-	fileExtensions []string // allowed file extensions, empty means all
+	fileExtensions []string         // allowed file extensions, empty means all
+	Naming         MediaNaming      // paths of the files, overriding the one of the context if it has a template
+	Limits         AttachmentLimits // limits of the downloads, overriding the ones of the context if any is set
+	Workers        int              // number of files downloaded at once, overriding the one of the context if set
 }
 
 // NewFileDownloader creates a new FileDownloader instance
@@ -45,6 +49,30 @@ func NewFileDownloader(fetcher *Fetcher, outputDir, filesDir string, extensions
 	}
 }
 
+// fileEmbedSelector matches the links to file attachments: the download button of Substack
+// file embeds, and links marked as downloads
+const fileEmbedSelector = ".file-embed-button.wide, a[download]"
+
+// attachmentExtensions maps the content types of common attachments to their extension,
+// as the ones known by the mime package depend on the system
+var attachmentExtensions = map[string]string{
+	"application/pdf":                ".pdf",
+	"application/epub+zip":           ".epub",
+	"application/x-mobipocket-ebook": ".mobi",
+	"application/zip":                ".zip",
+	"application/msword":             ".doc",
+	"application/vnd.ms-excel":       ".xls",
+	"application/vnd.ms-powerpoint":  ".ppt",
+	"text/csv":                       ".csv",
+	"text/plain":                     ".txt",
+	"audio/mpeg":                     ".mp3",
+	"video/mp4":                      ".mp4",
+
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   ".docx",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         ".xlsx",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": ".pptx",
+}
+
 // FileDownloadResult contains the results of downloading file attachments for a post
 type FileDownloadResult struct {
 	Files       []FileInfo
@@ -84,23 +112,81 @@ func (fd *FileDownloader) DownloadFiles(ctx context.Context, htmlContent string,
 		}, nil
 	}
 
-	// Create files directory
+	naming := fd.Naming
+	if naming.Template == nil {
+		naming = mediaNamingFromContext(ctx)
+	}
+
+	// Create files directory, the directories of templated paths being created for each file
 	filesPath := filepath.Join(fd.outputDir, fd.filesDir, postSlug)
-	if err := os.MkdirAll(filesPath, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create files directory: %w", err)
+	if naming.Template == nil {
+		if err := os.MkdirAll(filesPath, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create files directory: %w", err)
+		}
+	}
+
+	limits := fd.limits(ctx)
+
+	// Select the files to download, in order
+	type selectedFile struct {
+		element  FileElement
+		index    int
+		filename string
+	}
+	var selected []selectedFile
+
+	for i, element := range fileElements {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// Attachments served without an extension are only filtered once their type is known
+		var filename string
+		if naming.OriginalNames {
+			filename = fd.originalFilename(ctx, element.DownloadURL, fd.urlFilename(element.DownloadURL))
+		} else {
+			filename = fd.resolveFilename(ctx, element.DownloadURL, fd.urlFilename(element.DownloadURL))
+		}
+		if !fd.isAllowedExtension(filename) || isExcludedExtension(filename, limits.ExcludeExtensions) {
+			continue
+		}
+		if limits.MaxPerPost > 0 && len(selected) >= limits.MaxPerPost {
+			break
+		}
+		selected = append(selected, selectedFile{element: element, index: i + 1, filename: filename})
+	}
+
+	workers := fd.Workers
+	if workers == 0 {
+		workers = mediaWorkersFromContext(ctx).Files
 	}
 
-	// Download files and build URL mapping
+	// Download the files
+	downloaded := make([]FileInfo, len(selected))
+	forEachConcurrently(ctx, len(selected), workers, func(i int) {
+		file := selected[i]
+		if naming.Template == nil {
+			downloaded[i] = fd.downloadFile(ctx, file.element.DownloadURL, filesPath, file.filename)
+		} else {
+			downloaded[i] = fd.downloadNamedFile(ctx, file.element.DownloadURL, file.filename, postSlug, file.index, naming)
+		}
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Build URL mapping
 	var files []FileInfo
 	urlToLocalPath := make(map[string]string)
 
-	for _, element := range fileElements {
-		// Download the file
-		fileInfo := fd.downloadSingleFile(ctx, element.DownloadURL, filesPath)
+	for i, fileInfo := range downloaded {
+		if errors.Is(fileInfo.Error, ErrFileTooLarge) {
+			continue
+		}
 		files = append(files, fileInfo)
 
 		if fileInfo.Success {
-			urlToLocalPath[element.DownloadURL] = fileInfo.LocalPath
+			urlToLocalPath[selected[i].element.DownloadURL] = fileInfo.LocalPath
 		}
 	}
 
@@ -129,10 +215,11 @@ func (fd *FileDownloader) DownloadFiles(ctx context.Context, htmlContent string,
 // extractFileElements finds all file attachment elements in the HTML using the CSS selector
 func (fd *FileDownloader) extractFileElements(doc *goquery.Document) ([]FileElement, error) {
 	var elements []FileElement
+	seen := make(map[string]bool)
 
-	doc.Find(".file-embed-button.wide").Each(func(i int, s *goquery.Selection) {
+	doc.Find(fileEmbedSelector).Each(func(i int, s *goquery.Selection) {
 		href, exists := s.Attr("href")
-		if !exists || href == "" {
+		if !exists || href == "" || seen[href] {
 			return
 		}
 
@@ -154,11 +241,13 @@ func (fd *FileDownloader) extractFileElements(doc *goquery.Document) ([]FileElem
 			filename = fmt.Sprintf("attachment_%d", i+1)
 		}
 
-		// Check file extension filter if specified
-		if len(fd.fileExtensions) > 0 && !fd.isAllowedExtension(filename) {
+		// Check file extension filter if specified. Files without an extension in their URL
+		// are checked when downloading, once their type is known.
+		if filepath.Ext(filename) != "" && !fd.isAllowedExtension(filename) {
 			return
 		}
 
+		seen[href] = true
 		elements = append(elements, FileElement{
 			DownloadURL: href,
 			Filename:    filename,
@@ -176,24 +265,92 @@ func (fd *FileDownloader) extractFilenameFromURL(downloadURL string) string {
 	}
 
 	// Try to get filename from path using URL-safe path handling
+	var filename string
 	path := parsed.Path
 	if path != "" && path != "/" {
 		// Use strings.LastIndex to find the last segment in a cross-platform way
 		// This avoids issues with filepath.Base on different operating systems
 		lastSlash := strings.LastIndex(path, "/")
 		if lastSlash >= 0 && lastSlash < len(path)-1 {
-			filename := path[lastSlash+1:]
-			if filename != "" && filename != "." {
-				return filename
+			if segment := path[lastSlash+1:]; segment != "." {
+				filename = segment
 			}
 		}
 	}
 
-	// Try to get filename from query parameters (common in some download links)
-	if filename := parsed.Query().Get("filename"); filename != "" {
+	// Try to get filename from query parameters (common in some download links),
+	// which is more telling than a last path segment without extension
+	if queryFilename := parsed.Query().Get("filename"); queryFilename != "" && filepath.Ext(filename) == "" {
+		return queryFilename
+	}
+
+	return filename
+}
+
+// urlFilename returns the filename of a URL, or a generated one if it has none
+func (fd *FileDownloader) urlFilename(downloadURL string) string {
+	if filename := fd.extractFilenameFromURL(downloadURL); filename != "" {
+		return filename
+	}
+	return fd.generateSafeFilename(downloadURL)
+}
+
+// resolveFilename returns filename if it has an extension. Otherwise, the attachment is
+// requested with HEAD to use the filename of its Content-Disposition header, or to add the
+// extension of its Content-Type. filename is returned as is if that fails.
+func (fd *FileDownloader) resolveFilename(ctx context.Context, downloadURL, filename string) string {
+	if filepath.Ext(filename) != "" {
+		return filename
+	}
+	header, err := fd.fetcher.FetchHeader(ctx, downloadURL)
+	if err != nil {
 		return filename
 	}
+	if name := filenameFromContentDisposition(header.Get("Content-Disposition")); name != "" {
+		return name
+	}
+	return filename + extensionForContentType(header.Get("Content-Type"))
+}
+
+// originalFilename returns the filename an attachment was uploaded with, as given by the
+// Content-Disposition header of a HEAD request, falling back to resolveFilename
+func (fd *FileDownloader) originalFilename(ctx context.Context, downloadURL, filename string) string {
+	if header, err := fd.fetcher.FetchHeader(ctx, downloadURL); err == nil {
+		if name := filenameFromContentDisposition(header.Get("Content-Disposition")); name != "" {
+			return name
+		}
+	}
+	return fd.resolveFilename(ctx, downloadURL, filename)
+}
+
+// filenameFromContentDisposition returns the filename of a Content-Disposition header, if any
+func filenameFromContentDisposition(header string) string {
+	if header == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		return ""
+	}
+	// filename* is decoded by mime.ParseMediaType into filename. Only the base name is kept,
+	// so that a malicious header can't write outside of the files directory.
+	name := params["filename"]
+	return name[strings.LastIndexAny(name, "/\\")+1:]
+}
 
+// extensionForContentType returns the extension, with its dot, of the files of a content type,
+// or "" if it is unknown or too generic to tell
+func extensionForContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "application/octet-stream" {
+		return ""
+	}
+	if ext, ok := attachmentExtensions[mediaType]; ok {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
 	return ""
 }
 
@@ -217,65 +374,74 @@ func (fd *FileDownloader) isAllowedExtension(filename string) bool {
 	return false
 }
 
+// isExcludedExtension reports whether the extension of filename is one of excluded
+func isExcludedExtension(filename string, excluded []string) bool {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	for _, e := range excluded {
+		if ext != "" && strings.TrimPrefix(strings.ToLower(e), ".") == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// limits returns the limits of the attachments downloaded with ctx
+func (fd *FileDownloader) limits(ctx context.Context) AttachmentLimits {
+	if !fd.Limits.IsZero() {
+		return fd.Limits
+	}
+	return attachmentLimitsFromContext(ctx)
+}
+
 // downloadSingleFile downloads a single file and returns FileInfo
 func (fd *FileDownloader) downloadSingleFile(ctx context.Context, downloadURL, filesPath string) FileInfo {
-	// Extract filename
-	filename := fd.extractFilenameFromURL(downloadURL)
-	if filename == "" {
-		// Generate a safe filename based on URL
-		filename = fd.generateSafeFilename(downloadURL)
-	}
+	filename := fd.resolveFilename(ctx, downloadURL, fd.urlFilename(downloadURL))
+	return fd.downloadFile(ctx, downloadURL, filesPath, filename)
+}
 
+// downloadFile downloads a file to filename in filesPath and returns FileInfo
+func (fd *FileDownloader) downloadFile(ctx context.Context, downloadURL, filesPath, filename string) FileInfo {
 	// Ensure filename is safe for filesystem
 	filename = fd.sanitizeFilename(filename)
 
-	localPath := filepath.Join(filesPath, filename)
-
-	// Check if file already exists
-	if _, err := os.Stat(localPath); err == nil {
-		return FileInfo{
-			OriginalURL: downloadURL,
-			LocalPath:   localPath,
-			Filename:    filename,
-			Size:        0,
-			Success:     true,
-			Error:       nil,
-		}
-	}
+	return fd.downloadFileTo(ctx, downloadURL, filepath.Join(filesPath, filename))
+}
 
-	// Download the file
-	resp, err := fd.fetcher.FetchURL(ctx, downloadURL)
+// downloadNamedFile downloads the index-th file of a post, named filename, to the path given by naming
+func (fd *FileDownloader) downloadNamedFile(ctx context.Context, downloadURL, filename, postSlug string, index int, naming MediaNaming) FileInfo {
+	filename = fd.sanitizeFilename(filename)
+	relPath, err := naming.Path(newMediaName(postSlug, index, downloadURL, filename))
 	if err != nil {
-		return FileInfo{
-			OriginalURL: downloadURL,
-			LocalPath:   localPath,
-			Filename:    filename,
-			Size:        0,
-			Success:     false,
-			Error:       err,
-		}
+		return FileInfo{OriginalURL: downloadURL, Filename: filename, Error: err}
+	}
+	localPath := filepath.Join(fd.outputDir, fd.filesDir, relPath)
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return FileInfo{OriginalURL: downloadURL, Filename: filename, Error: fmt.Errorf("failed to create files directory: %w", err)}
 	}
-	defer resp.Close()
+	return fd.downloadFileTo(ctx, downloadURL, localPath)
+}
 
-	// Create the file
-	file, err := os.Create(localPath)
-	if err != nil {
+// downloadFileTo downloads a file to localPath and returns FileInfo. An existing file is kept,
+// as files only get their final name once completely downloaded.
+func (fd *FileDownloader) downloadFileTo(ctx context.Context, downloadURL, localPath string) FileInfo {
+	filename := filepath.Base(localPath)
+	defer mediaPathLocks.lock(localPath)()
+
+	// Check if file already exists
+	if info, err := os.Stat(localPath); err == nil {
 		return FileInfo{
 			OriginalURL: downloadURL,
 			LocalPath:   localPath,
 			Filename:    filename,
-			Size:        0,
-			Success:     false,
-			Error:       err,
+			Size:        info.Size(),
+			Success:     true,
+			Error:       nil,
 		}
 	}
-	defer file.Close()
 
-	// Copy file contents
-	size, err := io.Copy(file, resp)
+	// Download the file, resuming an interrupted download
+	size, err := downloadToFile(ctx, fd.fetcher, downloadURL, localPath, fd.limits(ctx).MaxSize)
 	if err != nil {
-		// Remove partially downloaded file
-		os.Remove(localPath)
 		return FileInfo{
 			OriginalURL: downloadURL,
 			LocalPath:   localPath,
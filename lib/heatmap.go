@@ -0,0 +1,66 @@
+package lib
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// heatmapLevels is the number of shades of the days with posts in the heatmap
+const heatmapLevels = 4
+
+// postsPerDay counts the archive posts by publication day, in UTC.
+// Posts without a valid date are left out.
+func (a *Archive) postsPerDay() map[string]int {
+	days := make(map[string]int)
+	for _, entry := range a.Entries {
+		date, err := time.Parse(time.RFC3339, entry.Post.PostDate)
+		if err != nil {
+			continue
+		}
+		days[date.UTC().Format("2006-01-02")]++
+	}
+	return days
+}
+
+// heatmapHTML renders the posting calendar of the archive, GitHub style: one grid per year,
+// newest first, with a column per week and a cell per day shaded by its number of posts
+func (a *Archive) heatmapHTML() string {
+	days := a.postsPerDay()
+	if len(days) == 0 {
+		return ""
+	}
+	first, last := 0, 0
+	for day := range days {
+		year, _ := strconv.Atoi(day[:4])
+		if first == 0 || year < first {
+			first = year
+		}
+		if year > last {
+			last = year
+		}
+	}
+
+	out := "\t<div class=\"heatmap\">\n"
+	for year := last; year >= first; year-- {
+		start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		total := 0
+		cells := ""
+		// Weeks start on Sunday, so the first column is padded up to January 1st
+		for i := 0; i < int(start.Weekday()); i++ {
+			cells += `<span class="pad"></span>`
+		}
+		for day := start; day.Year() == year; day = day.AddDate(0, 0, 1) {
+			key := day.Format("2006-01-02")
+			count := days[key]
+			total += count
+			level := count
+			if level > heatmapLevels {
+				level = heatmapLevels
+			}
+			cells += fmt.Sprintf(`<span class="day l%d" title="%s: %d posts"></span>`, level, key, count)
+		}
+		out += fmt.Sprintf("\t\t<div class=\"year\"><div class=\"year-title\">%d: %d posts</div><div class=\"days\">%s</div></div>\n", year, total, cells)
+	}
+	return out + "\t</div>\n"
+}
@@ -0,0 +1,48 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveHeatmap(t *testing.T) {
+	dir := t.TempDir()
+	downloadTime := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	archive := NewArchive()
+	archive.AddEntry(Post{Title: "One", PostDate: "2022-12-31T10:00:00Z"}, filepath.Join(dir, "one.html"), downloadTime)
+	archive.AddEntry(Post{Title: "Two", PostDate: "2024-01-03T08:00:00Z"}, filepath.Join(dir, "two.html"), downloadTime)
+	archive.AddEntry(Post{Title: "Three", PostDate: "2024-01-03T18:00:00Z"}, filepath.Join(dir, "three.html"), downloadTime)
+	archive.AddEntry(Post{Title: "Undated", PostDate: "unknown"}, filepath.Join(dir, "undated.html"), downloadTime)
+
+	heatmap := archive.heatmapHTML()
+	assert.Contains(t, heatmap, `<span class="day l2" title="2024-01-03: 2 posts"></span>`)
+	assert.Contains(t, heatmap, `<span class="day l1" title="2022-12-31: 1 posts"></span>`)
+	assert.Contains(t, heatmap, `<span class="day l0" title="2024-01-04: 0 posts"></span>`)
+	// Every year between the first and last post has its grid, newest first
+	assert.Contains(t, heatmap, "2023: 0 posts")
+	assert.Less(t, strings.Index(heatmap, "2024: 2 posts"), strings.Index(heatmap, "2022: 1 posts"))
+	// January 1st 2024 is a Monday, so the week column starts with a blank Sunday
+	assert.Contains(t, heatmap, `<div class="days"><span class="pad"></span><span class="day l0" title="2024-01-01: 0 posts">`)
+	assert.Equal(t, 366, strings.Count(heatmap[:strings.Index(heatmap, "2023: ")], `class="day `))
+
+	// The heatmap is only shown when enabled
+	require.NoError(t, archive.GenerateHTML(dir))
+	page, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(page), `<div class="heatmap">`)
+
+	archive.Heatmap = true
+	require.NoError(t, archive.GenerateHTML(dir))
+	page, err = os.ReadFile(filepath.Join(dir, "index.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(page), `<div class="heatmap">`)
+
+	assert.Empty(t, NewArchive().heatmapHTML())
+}
@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// SelectorRemover removes the elements matching CSS selectors from the body of posts, e.g.
+// the custom footers or sponsor blocks of a publication
+type SelectorRemover struct {
+	Selectors []string
+}
+
+// NewSelectorRemover creates a transformer removing the elements matching the selectors.
+// An error is returned for an invalid selector.
+func NewSelectorRemover(selectors []string) (*SelectorRemover, error) {
+	for _, selector := range selectors {
+		if _, err := cascadia.ParseGroup(selector); err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+		}
+	}
+	return &SelectorRemover{Selectors: selectors}, nil
+}
+
+// TransformPost removes the matching elements from the body of the post
+func (r *SelectorRemover) TransformPost(ctx context.Context, post Post) (Post, error) {
+	body, err := RemoveSelectors(post.BodyHTML, r.Selectors)
+	if err != nil {
+		return post, err
+	}
+	post.BodyHTML = body
+	return post, nil
+}
+
+// RemoveSelectors removes the elements matching the CSS selectors from HTML content.
+// The content is returned as is when nothing matches.
+func RemoveSelectors(content string, selectors []string) (string, error) {
+	if len(selectors) == 0 {
+		return content, nil
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse post body: %w", err)
+	}
+
+	removed := 0
+	for _, selector := range selectors {
+		matches := doc.Find("body").Find(selector)
+		removed += matches.Length()
+		matches.Remove()
+	}
+	if removed == 0 {
+		return content, nil
+	}
+
+	updated, err := doc.Find("body").Html()
+	if err != nil {
+		return "", fmt.Errorf("failed to render post body: %w", err)
+	}
+	return updated, nil
+}
@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test removing the elements matching CSS selectors from HTML
+func TestRemoveSelectors(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		selectors []string
+		expected  string
+	}{
+		{
+			name:      "class",
+			input:     `<p>Hello</p><div class="sponsor-block"><p>Buy this</p></div><p>World</p>`,
+			selectors: []string{".sponsor-block"},
+			expected:  `<p>Hello</p><p>World</p>`,
+		},
+		{
+			name:      "several selectors",
+			input:     `<p>Hello</p><div class="footer">Bye</div><aside>Ad</aside>`,
+			selectors: []string{"div.footer", "aside"},
+			expected:  `<p>Hello</p>`,
+		},
+		{
+			name:      "no match",
+			input:     `<p>Hello <b>World</b></p>`,
+			selectors: []string{".sponsor-block"},
+			expected:  `<p>Hello <b>World</b></p>`,
+		},
+		{
+			name:     "no selectors",
+			input:    `<p>Hello</p>`,
+			expected: `<p>Hello</p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := RemoveSelectors(tt.input, tt.selectors)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+// Test the selector remover transformer and recording its selectors for retries
+func TestSelectorRemover(t *testing.T) {
+	_, err := NewSelectorRemover([]string{"p", "div["})
+	assert.Error(t, err)
+
+	remover, err := NewSelectorRemover([]string{".custom-footer"})
+	require.NoError(t, err)
+	post := createSamplePost()
+	post.BodyHTML = `<p>Content</p><div class="custom-footer">Thanks for reading</div>`
+	transformed, err := remover.TransformPost(context.Background(), post)
+	require.NoError(t, err)
+	assert.Equal(t, `<p>Content</p>`, transformed.BodyHTML)
+	assert.Equal(t, post.Title, transformed.Title)
+
+	opts := DefaultDownloadOptions()
+	opts.Transformers = []PostTransformer{remover, NewExecTransformer("translate")}
+	manifestOpts := opts.ManifestOptions()
+	assert.Equal(t, []string{".custom-footer"}, manifestOpts.IgnoreSelectors)
+	assert.Equal(t, opts.Transformers, manifestOpts.DownloadOptions(".").Transformers)
+	assert.Contains(t, ReproduceCommand("https://example.com/p/a", manifestOpts, "."), "--ignore-selector")
+}
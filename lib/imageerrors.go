@@ -0,0 +1,46 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ImageErrors is what happens to a post when some of its images or attachments fail to download
+type ImageErrors string
+
+const (
+	// ImageErrorsSkip writes the post, the failed media keeping their remote URL, and reports nothing
+	ImageErrorsSkip ImageErrors = "skip"
+	// ImageErrorsWarn writes the post, the failed media keeping their remote URL, and records it as a failure to retry
+	ImageErrorsWarn ImageErrors = "warn"
+	// ImageErrorsFail doesn't write the post, which fails
+	ImageErrorsFail ImageErrors = "fail"
+)
+
+// ErrMediaFailed is returned for a post that isn't written because some of its media failed to download
+var ErrMediaFailed = errors.New("images or attachments failed to download")
+
+// ParseImageErrors validates an image error policy
+func ParseImageErrors(s string) (ImageErrors, error) {
+	switch p := ImageErrors(s); p {
+	case ImageErrorsSkip, ImageErrorsWarn, ImageErrorsFail:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid image error policy %q: use skip, warn or fail", s)
+}
+
+type imageErrorsKey struct{}
+
+// withImageErrors returns a context writing posts with the given image error policy
+func withImageErrors(ctx context.Context, policy ImageErrors) context.Context {
+	return context.WithValue(ctx, imageErrorsKey{}, policy)
+}
+
+// imageErrorsFromContext returns the image error policy of ctx, ImageErrorsWarn by default
+func imageErrorsFromContext(ctx context.Context) ImageErrors {
+	if policy, ok := ctx.Value(imageErrorsKey{}).(ImageErrors); ok && policy != "" {
+		return policy
+	}
+	return ImageErrorsWarn
+}
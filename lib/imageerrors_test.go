@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test validating the image error policies
+func TestParseImageErrors(t *testing.T) {
+	for _, s := range []string{"skip", "warn", "fail"} {
+		policy, err := ParseImageErrors(s)
+		require.NoError(t, err)
+		assert.Equal(t, ImageErrors(s), policy)
+	}
+	_, err := ParseImageErrors("ignore")
+	assert.Error(t, err)
+
+	assert.Equal(t, ImageErrorsWarn, imageErrorsFromContext(context.Background()))
+	assert.Equal(t, ImageErrorsFail, imageErrorsFromContext(withImageErrors(context.Background(), ImageErrorsFail)))
+}
+
+// Test recording posts whose images failed with each policy
+func TestDownloaderImageErrors(t *testing.T) {
+	post := createSamplePost()
+	record := func(policy ImageErrors, result PostResult) (*DownloadSummary, *Manifest) {
+		tempDir := t.TempDir()
+		manifest, err := LoadManifest(tempDir)
+		require.NoError(t, err)
+		opts := DefaultDownloadOptions()
+		opts.OutputDir = tempDir
+		opts.ImageErrors = policy
+		summary := &DownloadSummary{}
+		result.Path = filepath.Join(tempDir, post.Slug+".html")
+		NewDownloader(nil, opts).record(summary, manifest, nil, result)
+		return summary, manifest
+	}
+	written := PostResult{URL: post.CanonicalUrl, Post: post, Images: &ImageDownloadResult{Success: 1, Failed: 2}}
+
+	t.Run("warn", func(t *testing.T) {
+		summary, manifest := record(ImageErrorsWarn, written)
+		assert.Equal(t, 1, summary.Downloaded)
+		assert.Equal(t, 2, summary.ImagesFailed)
+		require.Len(t, manifest.Failures, 1)
+		assert.Equal(t, FailureImages, manifest.Failures[0].Stage)
+		_, ok := manifest.Entry(post.Slug)
+		assert.True(t, ok)
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		summary, manifest := record(ImageErrorsSkip, written)
+		assert.Equal(t, 1, summary.Downloaded)
+		assert.Empty(t, manifest.Failures)
+		_, ok := manifest.Entry(post.Slug)
+		assert.True(t, ok)
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		failed := written
+		failed.Err = fmt.Errorf("error writing file: %w: 2 of post %s", ErrMediaFailed, post.Slug)
+		summary, manifest := record(ImageErrorsFail, failed)
+		assert.Equal(t, 1, summary.Failed)
+		assert.Equal(t, 0, summary.Downloaded)
+		assert.Equal(t, 2, summary.ImagesFailed)
+		require.Len(t, manifest.Failures, 1)
+		assert.Equal(t, FailureImages, manifest.Failures[0].Stage)
+		assert.Equal(t, ImageErrorsFail, manifest.Failures[0].Options.ImageErrors)
+		_, ok := manifest.Entry(post.Slug)
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,221 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// ImageProcessing is the lossless processing of the images once downloaded
+type ImageProcessing struct {
+	StripMetadata bool // remove the EXIF, XMP and IPTC metadata and the comments of JPEG and PNG images
+	Optimize      bool // recompress PNG images at the best compression when it makes them smaller
+}
+
+// Enabled reports whether the images are processed at all
+func (p ImageProcessing) Enabled() bool {
+	return p.StripMetadata || p.Optimize
+}
+
+type imageProcessingKey struct{}
+
+// withImageProcessing returns a context processing the downloaded images
+func withImageProcessing(ctx context.Context, processing ImageProcessing) context.Context {
+	return context.WithValue(ctx, imageProcessingKey{}, processing)
+}
+
+// imageProcessingFromContext returns the processing of the images downloaded with ctx, if any
+func imageProcessingFromContext(ctx context.Context) ImageProcessing {
+	processing, _ := ctx.Value(imageProcessingKey{}).(ImageProcessing)
+	return processing
+}
+
+var (
+	jpegSignature = []byte{0xFF, 0xD8}
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// Process processes the image at path in place. Images that are neither JPEG nor PNG,
+// or that can't be parsed, are left as they are.
+func (p ImageProcessing) Process(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	processed := data
+	switch {
+	case bytes.HasPrefix(data, jpegSignature):
+		if p.StripMetadata {
+			processed = stripJPEGMetadata(data)
+		}
+	case bytes.HasPrefix(data, pngSignature):
+		if p.StripMetadata {
+			processed = stripPNGMetadata(data)
+		}
+		if p.Optimize {
+			processed = optimizePNG(processed)
+		}
+	}
+	if len(processed) == len(data) {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(processed); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// stripJPEGMetadata removes the XMP, IPTC and comment segments of a JPEG image, and its EXIF
+// segment unless the image is rotated by it. The image data is copied as is.
+func stripJPEGMetadata(data []byte) []byte {
+	out := append([]byte{}, jpegSignature...)
+	pos := len(jpegSignature)
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return data
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// Fill byte
+			pos++
+			continue
+		}
+		if marker == 0xDA {
+			// Start of scan, the rest of the file is the image data
+			return append(out, data[pos:]...)
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out = append(out, data[pos:pos+2]...)
+			pos += 2
+			continue
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) {
+			return data
+		}
+		segment := data[pos:end]
+		pos = end
+
+		switch marker {
+		case 0xE1: // EXIF or XMP
+			if exifOrientation(segment[4:]) > 1 {
+				out = append(out, segment...)
+			}
+		case 0xED, 0xFE: // IPTC, comment
+		default:
+			out = append(out, segment...)
+		}
+	}
+	return data
+}
+
+// exifOrientation returns the orientation tag of an EXIF segment, or 0 if it has none
+func exifOrientation(segment []byte) int {
+	if !bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+		return 0
+	}
+	tiff := segment[6:]
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 0 || ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// pngMetadataChunks are the chunks removed from PNG images stripped of their metadata
+var pngMetadataChunks = []string{"eXIf", "tEXt", "zTXt", "iTXt", "tIME"}
+
+// stripPNGMetadata removes the metadata chunks of a PNG image
+func stripPNGMetadata(data []byte) []byte {
+	out := append([]byte{}, pngSignature...)
+	chunks, ok := pngChunks(data)
+	if !ok {
+		return data
+	}
+	for _, chunk := range chunks {
+		if !containsString(pngMetadataChunks, string(chunk[4:8])) {
+			out = append(out, chunk...)
+		}
+	}
+	return out
+}
+
+// optimizePNG recompresses a PNG image at the best compression, or returns it as is if that
+// doesn't make it smaller. Images whose colors or animation would be lost are not recompressed.
+func optimizePNG(data []byte) []byte {
+	chunks, ok := pngChunks(data)
+	if !ok {
+		return data
+	}
+	for _, chunk := range chunks {
+		switch string(chunk[4:8]) {
+		case "iCCP", "gAMA", "cHRM", "acTL":
+			return data
+		}
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return data
+	}
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil || buf.Len() >= len(data) {
+		return data
+	}
+	return buf.Bytes()
+}
+
+// pngChunks splits a PNG image into its chunks, each with its length, type and CRC
+func pngChunks(data []byte) ([][]byte, bool) {
+	var chunks [][]byte
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+12 > len(data) {
+			return nil, false
+		}
+		end := pos + 12 + int(binary.BigEndian.Uint32(data[pos:]))
+		if end < pos || end > len(data) {
+			return nil, false
+		}
+		chunks = append(chunks, data[pos:end])
+		pos = end
+	}
+	return chunks, true
+}
@@ -0,0 +1,136 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testImage returns a gradient, which compresses differently at each level
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 64; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 4), 128, 255})
+		}
+	}
+	return img
+}
+
+// jpegSegment returns a JPEG segment with the given marker and payload
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// exifPayload returns the payload of an EXIF segment with the given orientation
+func exifPayload(orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry, 0x0112)
+	binary.BigEndian.PutUint16(entry[2:], 3)
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], orientation)
+	return append(append([]byte("Exif\x00\x00"), tiff...), append(entry, 0, 0, 0, 0)...)
+}
+
+// pngChunk returns a PNG chunk of the given type
+func pngChunk(typ string, data []byte) []byte {
+	chunk := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(append(chunk, typ...), data...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk[4:]))
+	return append(chunk, crc...)
+}
+
+// withPNGChunk inserts a chunk right after the header of a PNG image
+func withPNGChunk(data []byte, chunk []byte) []byte {
+	headerEnd := len(pngSignature) + 25
+	return append(append(append([]byte{}, data[:headerEnd]...), chunk...), data[headerEnd:]...)
+}
+
+func TestImageProcessingJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, testImage(), nil))
+	encoded := buf.Bytes()
+
+	withMetadata := func(orientation uint16) []byte {
+		data := append([]byte{}, jpegSignature...)
+		data = append(data, jpegSegment(0xE1, exifPayload(orientation))...)
+		data = append(data, jpegSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>"))...)
+		data = append(data, jpegSegment(0xFE, []byte("a comment"))...)
+		return append(data, encoded[len(jpegSignature):]...)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "image.jpg")
+	processing := ImageProcessing{StripMetadata: true}
+
+	require.NoError(t, os.WriteFile(path, withMetadata(1), 0644))
+	require.NoError(t, processing.Process(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, encoded, data)
+
+	// The EXIF segment of a rotated image is kept
+	require.NoError(t, os.WriteFile(path, withMetadata(6), 0644))
+	require.NoError(t, processing.Process(path))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, bytes.Contains(data, []byte("Exif\x00\x00")))
+	assert.False(t, bytes.Contains(data, []byte("a comment")))
+	assert.False(t, bytes.Contains(data, []byte("xmpmeta")))
+	_, err = jpeg.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+}
+
+func TestImageProcessingPNG(t *testing.T) {
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	require.NoError(t, encoder.Encode(&buf, testImage()))
+	encoded := buf.Bytes()
+	withText := withPNGChunk(encoded, pngChunk("tEXt", []byte("Author\x00Someone")))
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "image.png")
+
+	require.NoError(t, os.WriteFile(path, withText, 0644))
+	require.NoError(t, ImageProcessing{StripMetadata: true}.Process(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, encoded, data)
+
+	require.NoError(t, ImageProcessing{Optimize: true}.Process(path))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Less(t, len(data), len(encoded))
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, testImage().At(10, 20), img.At(10, 20))
+
+	// Images with a color profile are not recompressed, which would lose it
+	withGamma := withPNGChunk(encoded, pngChunk("gAMA", []byte{0, 0, 0xB1, 0x8F}))
+	require.NoError(t, os.WriteFile(path, withGamma, 0644))
+	require.NoError(t, ImageProcessing{Optimize: true}.Process(path))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, withGamma, data)
+
+	// Other formats are left as they are
+	require.NoError(t, os.WriteFile(path, []byte("GIF89a"), 0644))
+	require.NoError(t, ImageProcessing{StripMetadata: true, Optimize: true}.Process(path))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("GIF89a"), data)
+}
@@ -4,13 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/PuerkitoBio/goquery"
 )
@@ -22,8 +23,98 @@ const (
 	ImageQualityHigh   ImageQuality = "high"   // 1456w
 	ImageQualityMedium ImageQuality = "medium" // 848w
 	ImageQualityLow    ImageQuality = "low"    // 424w
+
+	// ImageQualityOriginal downloads the uploaded images, bypassing the resizing of Substack's CDN
+	ImageQualityOriginal ImageQuality = "original"
 )
 
+// substackCDNImageRegex matches the URLs of images transformed by Substack's CDN,
+// capturing the prefix, the comma-separated transformations and the escaped source URL
+var substackCDNImageRegex = regexp.MustCompile(`^(https?://substackcdn\.com/image/fetch/)([^/]*)/(https?(?::|%3A).+)$`)
+
+// substackCDNWidthRegex matches the width transformation of Substack's CDN URLs
+var substackCDNWidthRegex = regexp.MustCompile(`(^|,)w_\d+`)
+
+// ParseImageQuality validates an image quality: a preset, "original", or a width in pixels
+// such as "1200"
+func ParseImageQuality(s string) (ImageQuality, error) {
+	switch q := ImageQuality(s); q {
+	case ImageQualityHigh, ImageQualityMedium, ImageQualityLow, ImageQualityOriginal:
+		return q, nil
+	}
+	if width, err := strconv.Atoi(s); err == nil && width > 0 {
+		return ImageQuality(s), nil
+	}
+	return "", fmt.Errorf("invalid image quality %q: use high, medium, low, original or a width in pixels", s)
+}
+
+// ExplicitWidth returns the width in pixels requested by the quality, or 0 for presets
+func (q ImageQuality) ExplicitWidth() int {
+	width, err := strconv.Atoi(string(q))
+	if err != nil || width <= 0 {
+		return 0
+	}
+	return width
+}
+
+// ParseImageSizes parses a comma-separated list of image widths in pixels, e.g. "424,848",
+// returned in increasing order without duplicates
+func ParseImageSizes(s string) ([]int, error) {
+	var sizes []int
+	seen := make(map[int]bool)
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		width, err := strconv.Atoi(field)
+		if err != nil || width <= 0 {
+			return nil, fmt.Errorf("invalid image size %q: use widths in pixels, e.g. 424,848", field)
+		}
+		if !seen[width] {
+			seen[width] = true
+			sizes = append(sizes, width)
+		}
+	}
+	sort.Ints(sizes)
+	return sizes, nil
+}
+
+// resizeImageURL returns the Substack CDN URL of an image at the given width. Images that are
+// not served by the CDN are wrapped in a CDN URL, which fetches and resizes them.
+func resizeImageURL(imageURL string, width int) string {
+	w := "w_" + strconv.Itoa(width)
+	if m := substackCDNImageRegex.FindStringSubmatch(imageURL); m != nil {
+		transforms := m[2]
+		if substackCDNWidthRegex.MatchString(transforms) {
+			transforms = substackCDNWidthRegex.ReplaceAllString(transforms, "${1}"+w)
+		} else if transforms == "" {
+			transforms = w
+		} else {
+			transforms = w + "," + transforms
+		}
+		return m[1] + transforms + "/" + m[3]
+	}
+	if !strings.Contains(imageURL, "substack-post-media.s3.amazonaws.com") && !strings.Contains(imageURL, "bucketeer-") {
+		return imageURL
+	}
+	return "https://substackcdn.com/image/fetch/" + w + ",c_limit,f_auto,q_auto:good,fl_progressive:steep/" + url.QueryEscape(imageURL)
+}
+
+// originalImageURL returns the URL of the image a Substack CDN URL transforms,
+// or imageURL itself if it is not a CDN URL
+func originalImageURL(imageURL string) string {
+	m := substackCDNImageRegex.FindStringSubmatch(imageURL)
+	if m == nil {
+		return imageURL
+	}
+	source, err := url.QueryUnescape(m[3])
+	if err != nil {
+		return imageURL
+	}
+	return source
+}
+
 // ImageInfo contains information about a downloaded image
 type ImageInfo struct {
 	OriginalURL string
@@ -31,16 +122,94 @@ type ImageInfo struct {
 	Width       int
 	Height      int
 	Format      string
+	Bytes       int64 // size of the downloaded file
 	Success     bool
 	Error       error
 }
 
+// ImageProgressFunc is called as each image of a post completes, successfully or not.
+// It may be called concurrently for different posts.
+type ImageProgressFunc func(postSlug string, image ImageInfo)
+
+type imageProgressKey struct{}
+
+// WithImageProgress returns a context reporting the images downloaded with it to fn,
+// for ImageDownloaders created deeper in the call stack
+func WithImageProgress(ctx context.Context, fn ImageProgressFunc) context.Context {
+	return context.WithValue(ctx, imageProgressKey{}, fn)
+}
+
+// imageProgressFromContext returns the ImageProgressFunc of the context, if any
+func imageProgressFromContext(ctx context.Context) ImageProgressFunc {
+	fn, _ := ctx.Value(imageProgressKey{}).(ImageProgressFunc)
+	return fn
+}
+
+type mediaCacheKey struct{}
+
+// mediaCache remembers the images downloaded with a context by local path, so that a post
+// written in several formats links the same images without downloading them again
+type mediaCache struct {
+	mu     sync.Mutex
+	images map[string]ImageInfo
+}
+
+// withMediaCache returns a context sharing the images downloaded with it
+func withMediaCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, mediaCacheKey{}, &mediaCache{images: make(map[string]ImageInfo)})
+}
+
+// mediaCacheFromContext returns the mediaCache of the context, nil if none
+func mediaCacheFromContext(ctx context.Context) *mediaCache {
+	cache, _ := ctx.Value(mediaCacheKey{}).(*mediaCache)
+	return cache
+}
+
+// lookup returns the image already downloaded from imageURL to localPath
+func (c *mediaCache) lookup(imageURL, localPath string) (ImageInfo, bool) {
+	if c == nil {
+		return ImageInfo{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info, ok := c.images[localPath]
+	return info, ok && info.OriginalURL == imageURL
+}
+
+// store records a downloaded image
+func (c *mediaCache) store(info ImageInfo) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.images[info.LocalPath] = info
+}
+
+type imageSizesKey struct{}
+
+// withImageSizes returns a context also downloading the images at the given widths
+func withImageSizes(ctx context.Context, sizes []int) context.Context {
+	return context.WithValue(ctx, imageSizesKey{}, sizes)
+}
+
+// imageSizesFromContext returns the widths the images are also downloaded at, if any
+func imageSizesFromContext(ctx context.Context) []int {
+	sizes, _ := ctx.Value(imageSizesKey{}).([]int)
+	return sizes
+}
+
 // ImageDownloader handles downloading and processing images from Substack posts
 type ImageDownloader struct {
 	fetcher      *Fetcher
 	outputDir    string
 	imagesDir    string
 	imageQuality ImageQuality
+	OnImage      ImageProgressFunc // called as each image completes, overriding the one of the context
+	Naming       MediaNaming       // paths of the images, overriding the one of the context if it has a template
+	Sizes        []int             // widths the images are also downloaded at for their srcset, overriding the ones of the context
+	Processing   ImageProcessing   // processing of the downloaded images, overriding the one of the context if enabled
+	Workers      int               // number of images downloaded at once, overriding the one of the context if set
 }
 
 // NewImageDownloader creates a new ImageDownloader instance
@@ -62,6 +231,8 @@ type ImageDownloadResult struct {
 	UpdatedHTML string
 	Success     int
 	Failed      int
+	Bytes       int64      // total size of the downloaded images
+	Files       []FileInfo // attachments downloaded with the images, if enabled
 }
 
 // ImageElement represents an image element with all its URLs
@@ -95,38 +266,105 @@ func (id *ImageDownloader) DownloadImages(ctx context.Context, htmlContent strin
 		}, nil
 	}
 
-	// Create images directory
+	naming := id.Naming
+	if naming.Template == nil {
+		naming = mediaNamingFromContext(ctx)
+	}
+
+	// Create images directory, the directories of templated paths being created for each image
 	imagesPath := filepath.Join(id.outputDir, id.imagesDir, postSlug)
-	if err := os.MkdirAll(imagesPath, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create images directory: %w", err)
+	if naming.Template == nil {
+		if err := os.MkdirAll(imagesPath, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create images directory: %w", err)
+		}
+	}
+
+	onImage := id.OnImage
+	if onImage == nil {
+		onImage = imageProgressFromContext(ctx)
+	}
+
+	sizes := id.Sizes
+	if sizes == nil {
+		sizes = imageSizesFromContext(ctx)
+	}
+
+	workers := id.Workers
+	if workers == 0 {
+		workers = mediaWorkersFromContext(ctx).Images
+	}
+
+	// Download the images, each with its sized copies, reporting them as they complete
+	downloaded := make([][]ImageInfo, len(imageElements))
+	var progressMu sync.Mutex
+	report := func(info ImageInfo) {
+		if onImage != nil {
+			progressMu.Lock()
+			defer progressMu.Unlock()
+			onImage(postSlug, info)
+		}
+	}
+	forEachConcurrently(ctx, len(imageElements), workers, func(i int) {
+		element := imageElements[i]
+
+		// Download the best quality URL
+		var imageInfo ImageInfo
+		if naming.Template == nil {
+			imageInfo = id.downloadSingleImage(ctx, element.BestURL, imagesPath)
+		} else {
+			imageInfo = id.downloadNamedImage(ctx, element.BestURL, postSlug, i+1, naming)
+		}
+		downloaded[i] = []ImageInfo{imageInfo}
+		report(imageInfo)
+
+		if imageInfo.Success {
+			for _, sized := range id.downloadSizes(ctx, element.BestURL, imageInfo, sizes) {
+				downloaded[i] = append(downloaded[i], sized)
+				report(sized)
+			}
+		}
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	// Download images and build URL mapping
+	// Build URL mapping, in the order of the images
 	var images []ImageInfo
 	urlToLocalPath := make(map[string]string)
+	srcsets := make(map[string][]ImageInfo) // local path of an image to its sized copies
 
-	for _, element := range imageElements {
-		// Download the best quality URL
-		imageInfo := id.downloadSingleImage(ctx, element.BestURL, imagesPath)
-		images = append(images, imageInfo)
+	for i, element := range imageElements {
+		imageInfo := downloaded[i][0]
+		images = append(images, downloaded[i]...)
 
 		if imageInfo.Success {
 			// Map ALL URLs for this image element to the same local path
 			for _, url := range element.AllURLs {
 				urlToLocalPath[url] = imageInfo.LocalPath
 			}
+
+			for _, sized := range downloaded[i][1:] {
+				if sized.Success {
+					srcsets[imageInfo.LocalPath] = append(srcsets[imageInfo.LocalPath], sized)
+				}
+			}
 		}
 	}
 
 	// Update HTML content with local paths
 	updatedHTML := id.updateHTMLWithLocalPaths(htmlContent, urlToLocalPath)
+	if len(srcsets) > 0 {
+		updatedHTML = id.updateHTMLWithSrcsets(updatedHTML, images, srcsets)
+	}
 
 	// Count success/failure
 	success := 0
 	failed := 0
+	var bytes int64
 	for _, img := range images {
 		if img.Success {
 			success++
+			bytes += img.Bytes
 		} else {
 			failed++
 		}
@@ -137,6 +375,7 @@ func (id *ImageDownloader) DownloadImages(ctx context.Context, htmlContent strin
 		UpdatedHTML: updatedHTML,
 		Success:     success,
 		Failed:      failed,
+		Bytes:       bytes,
 	}, nil
 }
 
@@ -287,8 +526,24 @@ func (id *ImageDownloader) getImageElementInfo(imgElement *goquery.Selection) Im
 	}
 }
 
-// getBestImageURL extracts the best quality image URL from an img element
+// getBestImageURL extracts the best quality image URL from an img element.
+// An explicit width or the original quality rewrite the URL found for Substack's CDN.
 func (id *ImageDownloader) getBestImageURL(imgElement *goquery.Selection) string {
+	bestURL := id.getPresetImageURL(imgElement)
+	if bestURL == "" {
+		return ""
+	}
+	if id.imageQuality == ImageQualityOriginal {
+		return originalImageURL(bestURL)
+	}
+	if width := id.imageQuality.ExplicitWidth(); width > 0 {
+		return resizeImageURL(bestURL, width)
+	}
+	return bestURL
+}
+
+// getPresetImageURL extracts the image URL of an img element closest to the quality preset
+func (id *ImageDownloader) getPresetImageURL(imgElement *goquery.Selection) string {
 	// First try to get URL from data-attrs JSON
 	dataAttrs, exists := imgElement.Attr("data-attrs")
 	if exists {
@@ -330,6 +585,9 @@ func (id *ImageDownloader) getTargetWidth() int {
 	case ImageQualityLow:
 		return 424
 	default:
+		if width := id.imageQuality.ExplicitWidth(); width > 0 {
+			return width
+		}
 		return 1456
 	}
 }
@@ -421,41 +679,162 @@ func (id *ImageDownloader) downloadSingleImage(ctx context.Context, imageURL, im
 		return imageInfo
 	}
 
-	localPath := filepath.Join(imagesPath, filename)
-	imageInfo.LocalPath = localPath
+	return id.downloadImageTo(ctx, imageURL, filepath.Join(imagesPath, filename))
+}
 
-	// Download the image
-	body, err := id.fetcher.FetchURL(ctx, imageURL)
+// downloadNamedImage downloads the index-th image of a post to the path given by naming
+func (id *ImageDownloader) downloadNamedImage(ctx context.Context, imageURL, postSlug string, index int, naming MediaNaming) ImageInfo {
+	imageInfo := ImageInfo{OriginalURL: imageURL}
+
+	filename, err := id.generateSafeFilename(imageURL)
 	if err != nil {
-		imageInfo.Error = fmt.Errorf("failed to fetch image: %w", err)
+		imageInfo.Error = fmt.Errorf("failed to generate filename: %w", err)
 		return imageInfo
 	}
-	defer body.Close()
-
-	// Create the local file
-	file, err := os.Create(localPath)
+	relPath, err := naming.Path(newMediaName(postSlug, index, imageURL, filename))
 	if err != nil {
-		imageInfo.Error = fmt.Errorf("failed to create local file: %w", err)
+		imageInfo.Error = err
 		return imageInfo
 	}
-	defer file.Close()
+	localPath := filepath.Join(id.outputDir, id.imagesDir, relPath)
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		imageInfo.Error = fmt.Errorf("failed to create images directory: %w", err)
+		return imageInfo
+	}
+	return id.downloadImageTo(ctx, imageURL, localPath)
+}
+
+// downloadImageTo downloads an image to localPath and returns its info
+func (id *ImageDownloader) downloadImageTo(ctx context.Context, imageURL, localPath string) ImageInfo {
+	imageInfo := ImageInfo{
+		OriginalURL: imageURL,
+		LocalPath:   localPath,
+		Success:     false,
+	}
+
+	defer mediaPathLocks.lock(localPath)()
+
+	cache := mediaCacheFromContext(ctx)
+	if info, ok := cache.lookup(imageURL, localPath); ok {
+		return info
+	}
 
-	// Copy image data
-	_, err = io.Copy(file, body)
+	// Download the image, resuming an interrupted download
+	var err error
+	imageInfo.Bytes, err = DownloadToFile(ctx, id.fetcher, imageURL, localPath)
 	if err != nil {
-		imageInfo.Error = fmt.Errorf("failed to write image data: %w", err)
-		os.Remove(localPath) // Clean up failed file
+		imageInfo.Error = fmt.Errorf("failed to fetch image: %w", err)
 		return imageInfo
 	}
 
+	processing := id.Processing
+	if !processing.Enabled() {
+		processing = imageProcessingFromContext(ctx)
+	}
+	if processing.Enabled() {
+		// The image is kept as downloaded if it can't be processed
+		processing.Process(localPath)
+	}
+
 	// Extract image metadata
-	imageInfo.Format = id.getImageFormat(filename)
+	imageInfo.Format = id.getImageFormat(localPath)
 	imageInfo.Width, imageInfo.Height = id.extractDimensionsFromURL(imageURL)
 
 	imageInfo.Success = true
+	cache.store(imageInfo)
 	return imageInfo
 }
 
+// downloadSizes downloads the copies of an image at the given widths next to it, named
+// {name}-{width}w{ext}. Widths the image can't be resized to or that are not smaller than it are skipped.
+func (id *ImageDownloader) downloadSizes(ctx context.Context, imageURL string, image ImageInfo, sizes []int) []ImageInfo {
+	var sized []ImageInfo
+	width := id.srcsetWidth(image)
+	ext := filepath.Ext(image.LocalPath)
+	for _, size := range sizes {
+		if width > 0 && size >= width {
+			continue
+		}
+		sizedURL := resizeImageURL(imageURL, size)
+		if sizedURL == imageURL {
+			continue
+		}
+		localPath := strings.TrimSuffix(image.LocalPath, ext) + "-" + strconv.Itoa(size) + "w" + ext
+		info := id.downloadImageTo(ctx, sizedURL, localPath)
+		info.Width = size
+		sized = append(sized, info)
+	}
+	return sized
+}
+
+// srcsetWidth returns the width of a downloaded image in a srcset, or 0 if it is unknown
+func (id *ImageDownloader) srcsetWidth(image ImageInfo) int {
+	if width := id.imageQuality.ExplicitWidth(); width > 0 {
+		return width
+	}
+	if m := substackCDNImageRegex.FindStringSubmatch(image.OriginalURL); m != nil {
+		if w := substackCDNWidthRegex.FindString(m[2]); w != "" {
+			width, _ := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(w, ","), "w_"))
+			return width
+		}
+	}
+	return image.Width
+}
+
+// updateHTMLWithSrcsets sets the srcset of the local images that have sized copies, keeping
+// the sizes attribute of the elements
+func (id *ImageDownloader) updateHTMLWithSrcsets(htmlContent string, images []ImageInfo, srcsets map[string][]ImageInfo) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	if err != nil {
+		return htmlContent
+	}
+
+	relSrcsets := make(map[string]string)
+	for _, image := range images {
+		sized, ok := srcsets[image.LocalPath]
+		if !ok {
+			continue
+		}
+		var entries []string
+		for _, s := range sized {
+			entries = append(entries, id.relativePath(s.LocalPath)+" "+strconv.Itoa(s.Width)+"w")
+		}
+		if width := id.srcsetWidth(image); width > 0 {
+			entries = append(entries, id.relativePath(image.LocalPath)+" "+strconv.Itoa(width)+"w")
+		}
+		relSrcsets[id.relativePath(image.LocalPath)] = strings.Join(entries, ", ")
+	}
+
+	doc.Find("img").Each(func(i int, s *goquery.Selection) {
+		if srcset, found := relSrcsets[s.AttrOr("src", "")]; found {
+			s.SetAttr("srcset", srcset)
+		}
+	})
+	// The sources of picture elements, rewritten to the local image by updateHTMLWithLocalPaths
+	doc.Find("source").Each(func(i int, s *goquery.Selection) {
+		if fields := strings.Fields(s.AttrOr("srcset", "")); len(fields) > 0 {
+			if srcset, found := relSrcsets[strings.TrimSuffix(fields[0], ",")]; found {
+				s.SetAttr("srcset", srcset)
+			}
+		}
+	})
+
+	html, err := doc.Html()
+	if err != nil {
+		return htmlContent
+	}
+	return html
+}
+
+// relativePath returns the path of a downloaded file relative to the output directory, with forward slashes
+func (id *ImageDownloader) relativePath(localPath string) string {
+	relPath, err := filepath.Rel(id.outputDir, localPath)
+	if err != nil {
+		relPath = localPath
+	}
+	return strings.ReplaceAll(relPath, "\\", "/")
+}
+
 // generateSafeFilename generates a safe filename from an image URL
 func (id *ImageDownloader) generateSafeFilename(imageURL string) (string, error) {
 	parsedURL, err := url.Parse(imageURL)
@@ -129,6 +129,7 @@ func TestGetTargetWidth(t *testing.T) {
 		{ImageQualityMedium, 848},
 		{ImageQualityLow, 424},
 		{ImageQuality("invalid"), 1456}, // should default to high
+		{ImageQuality("1200"), 1200},
 	}
 	
 	for _, test := range tests {
@@ -140,6 +141,50 @@ func TestGetTargetWidth(t *testing.T) {
 	}
 }
 
+// TestParseImageQuality tests validating image qualities
+func TestParseImageQuality(t *testing.T) {
+	for _, valid := range []string{"high", "medium", "low", "original", "1200"} {
+		q, err := ParseImageQuality(valid)
+		require.NoError(t, err, valid)
+		assert.Equal(t, ImageQuality(valid), q)
+	}
+	for _, invalid := range []string{"", "best", "0", "-100", "1200px"} {
+		_, err := ParseImageQuality(invalid)
+		assert.Error(t, err, invalid)
+	}
+	assert.Equal(t, 1200, ImageQuality("1200").ExplicitWidth())
+	assert.Equal(t, 0, ImageQualityHigh.ExplicitWidth())
+}
+
+// TestResizeImageURL tests rewriting image URLs for explicit widths and originals
+func TestResizeImageURL(t *testing.T) {
+	source := "https://substack-post-media.s3.amazonaws.com/public/images/abc_1024x768.png"
+	escaped := url.QueryEscape(source)
+	cdn := "https://substackcdn.com/image/fetch/w_1456,c_limit,f_auto/" + escaped
+
+	assert.Equal(t, "https://substackcdn.com/image/fetch/w_600,c_limit,f_auto/"+escaped, resizeImageURL(cdn, 600))
+	assert.Equal(t, "https://substackcdn.com/image/fetch/w_600,f_auto/"+escaped,
+		resizeImageURL("https://substackcdn.com/image/fetch/f_auto/"+escaped, 600))
+	assert.Equal(t, "https://substackcdn.com/image/fetch/w_600,c_limit,f_auto,q_auto:good,fl_progressive:steep/"+escaped,
+		resizeImageURL(source, 600))
+	assert.Equal(t, "https://example.com/image.png", resizeImageURL("https://example.com/image.png", 600))
+
+	assert.Equal(t, source, originalImageURL(cdn))
+	assert.Equal(t, source, originalImageURL(source))
+
+	t.Run("getBestImageURL", func(t *testing.T) {
+		html := `<img src="` + cdn + `" srcset="` + strings.Replace(cdn, "w_1456", "w_424", 1) + ` 424w, ` + cdn + ` 1456w">`
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+		require.NoError(t, err)
+		img := doc.Find("img")
+
+		original := NewImageDownloader(nil, "/tmp", "images", ImageQualityOriginal)
+		assert.Equal(t, source, original.getBestImageURL(img))
+		sized := NewImageDownloader(nil, "/tmp", "images", ImageQuality("1000"))
+		assert.Equal(t, resizeImageURL(cdn, 1000), sized.getBestImageURL(img))
+	})
+}
+
 // TestExtractURLFromSrcset tests srcset URL extraction
 func TestExtractURLFromSrcset(t *testing.T) {
 	downloader := NewImageDownloader(nil, "/tmp", "images", ImageQualityHigh)
@@ -374,6 +419,45 @@ func TestDownloadImages(t *testing.T) {
 	})
 }
 
+// TestDownloadImagesProgress tests reporting each image as it completes
+func TestDownloadImagesProgress(t *testing.T) {
+	server := createTestImageServer()
+	defer server.Close()
+
+	htmlContent := `<img src="` + server.URL + `/success.png"><img src="` + server.URL + `/not-found.png">`
+	var reported []ImageInfo
+	collect := func(postSlug string, image ImageInfo) {
+		assert.Equal(t, "progress-post", postSlug)
+		reported = append(reported, image)
+	}
+
+	t.Run("Callback", func(t *testing.T) {
+		reported = nil
+		downloader := NewImageDownloader(nil, t.TempDir(), "images", ImageQualityHigh)
+		downloader.OnImage = collect
+
+		result, err := downloader.DownloadImages(context.Background(), htmlContent, "progress-post")
+		require.NoError(t, err)
+		require.Len(t, reported, 2)
+		assert.Equal(t, result.Images, reported)
+		assert.True(t, reported[0].Success)
+		assert.Equal(t, int64(len(testImageData)), reported[0].Bytes)
+		assert.False(t, reported[1].Success)
+		assert.Error(t, reported[1].Error)
+		assert.Equal(t, int64(len(testImageData)), result.Bytes)
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		reported = nil
+		downloader := NewImageDownloader(nil, t.TempDir(), "images", ImageQualityHigh)
+		ctx := WithImageProgress(context.Background(), collect)
+
+		_, err := downloader.DownloadImages(ctx, htmlContent, "progress-post")
+		require.NoError(t, err)
+		assert.Len(t, reported, 2)
+	})
+}
+
 // TestDownloadSingleImage tests individual image downloading
 func TestDownloadSingleImage(t *testing.T) {
 	// Create test server
@@ -405,6 +489,7 @@ func TestDownloadSingleImage(t *testing.T) {
 		data, err := os.ReadFile(imageInfo.LocalPath)
 		assert.NoError(t, err)
 		assert.Equal(t, testImageData, data)
+		assert.Equal(t, int64(len(testImageData)), imageInfo.Bytes)
 	})
 	
 	t.Run("NotFound", func(t *testing.T) {
@@ -1206,4 +1291,135 @@ func TestComplexSubstackImageStructureRegression(t *testing.T) {
 	
 	// Verify at least one image was successfully downloaded
 	assert.Greater(t, result.Success, 0, "Should have successful downloads")
-}
\ No newline at end of file
+}
+
+// Test that an image downloaded with a media cache isn't downloaded again
+func TestImageMediaCache(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	}))
+	defer server.Close()
+
+	tempDir := t.TempDir()
+	downloader := NewImageDownloader(nil, tempDir, "images", ImageQualityHigh)
+	localPath := filepath.Join(tempDir, "image.png")
+	ctx := withMediaCache(context.Background())
+
+	first := downloader.downloadImageTo(ctx, server.URL+"/image.png", localPath)
+	require.True(t, first.Success)
+	second := downloader.downloadImageTo(ctx, server.URL+"/image.png", localPath)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, requests)
+
+	// Without the cache, or from another URL, the image is downloaded
+	downloader.downloadImageTo(context.Background(), server.URL+"/image.png", localPath)
+	downloader.downloadImageTo(ctx, server.URL+"/other.png", localPath)
+	assert.Equal(t, 3, requests)
+}
+
+// Test that the alt text, size and caption of images are kept when they are downloaded
+func TestLocalImagesKeepMarkup(t *testing.T) {
+	server := createTestImageServer()
+	defer server.Close()
+
+	post := Post{Title: "Figures", Slug: "figures", BodyHTML: fmt.Sprintf(`<p>Intro</p>
+<figure>
+  <img src="%s/cat.png" alt="A cat" title="Cat" width="640" height="480">
+
+  <figcaption>A cat on a mat</figcaption>
+</figure>
+<p>A sized <img src="%s/icon.png" alt="icon" width="16"> and a plain <img src="%s/plain.png" alt="plain"> image.</p>`,
+		server.URL, server.URL, server.URL)}
+	tempDir := t.TempDir()
+
+	path := filepath.Join(tempDir, "figures.html")
+	_, err := post.WriteToFileWithImages(context.Background(), path, "html", false, true, ImageQualityHigh, "images", false, nil, "files", nil)
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	content := string(data)
+	assert.Contains(t, content, `<img src="images/figures/cat.png" alt="A cat" title="Cat" width="640" height="480"/>`)
+	assert.Contains(t, content, `<figcaption>A cat on a mat</figcaption>`)
+
+	path = filepath.Join(tempDir, "figures.md")
+	_, err = post.WriteToFileWithImages(context.Background(), path, "md", false, true, ImageQualityHigh, "images", false, nil, "files", nil)
+	require.NoError(t, err)
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	content = string(data)
+	assert.Contains(t, content, "\n\n<figure>\n")
+	assert.Contains(t, content, `<img src="images/figures/cat.png" alt="A cat" title="Cat" width="640" height="480"/>`)
+	assert.Contains(t, content, "<figcaption>A cat on a mat</figcaption>\n</figure>\n\n")
+	assert.Contains(t, content, `A sized <img src="images/figures/icon.png" alt="icon" width="16"/> and a plain ![plain](images/figures/plain.png) image.`)
+	assert.NotContains(t, content, server.URL)
+}
+
+func TestParseImageSizes(t *testing.T) {
+	sizes, err := ParseImageSizes("848, 424,848")
+	require.NoError(t, err)
+	assert.Equal(t, []int{424, 848}, sizes)
+
+	sizes, err = ParseImageSizes("")
+	require.NoError(t, err)
+	assert.Empty(t, sizes)
+
+	for _, invalid := range []string{"0", "-424", "424px", "small"} {
+		_, err := ParseImageSizes(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+// hostTransport sends all requests to the host of a test server
+type hostTransport struct {
+	host string
+}
+
+func (t hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = "http"
+	req.URL.Host = t.host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// Test that the sized copies of images are downloaded and listed in their srcset
+func TestDownloadImageSizes(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(testImageData)
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	fetcher := NewFetcher(WithRatePerSecond(100))
+	fetcher.Client.Transport = hostTransport{host: serverURL.Host}
+	tempDir := t.TempDir()
+	downloader := NewImageDownloader(fetcher, tempDir, "images", ImageQualityHigh)
+	downloader.Sizes = []int{424, 848, 2000}
+
+	source := url.QueryEscape("https://substack-post-media.s3.amazonaws.com/public/images/abc_2000x1000.png")
+	html := `<picture><source type="image/webp" srcset="https://substackcdn.com/image/fetch/w_424,c_limit,f_webp/` + source + ` 424w, https://substackcdn.com/image/fetch/w_1456,c_limit,f_webp/` + source + ` 1456w" sizes="100vw">` +
+		`<img src="https://substackcdn.com/image/fetch/w_1456,c_limit,f_auto/` + source + `" sizes="100vw" alt="Chart"></picture>` +
+		`<img src="https://example.com/other.png" alt="Other">`
+
+	result, err := downloader.DownloadImages(context.Background(), html, "post")
+	require.NoError(t, err)
+	assert.Equal(t, 4, result.Success)
+	assert.Equal(t, 0, result.Failed)
+
+	srcset := "images/post/abc_2000x1000-424w.png 424w, images/post/abc_2000x1000-848w.png 848w, images/post/abc_2000x1000.png 1456w"
+	assert.Contains(t, result.UpdatedHTML, `<source type="image/webp" srcset="`+srcset+`" sizes="100vw"/>`)
+	assert.Contains(t, result.UpdatedHTML, `<img src="images/post/abc_2000x1000.png" sizes="100vw" alt="Chart" srcset="`+srcset+`"/>`)
+	assert.Contains(t, result.UpdatedHTML, `<img src="images/post/other.png" alt="Other"/>`)
+	for _, name := range []string{"abc_2000x1000-424w.png", "abc_2000x1000-848w.png"} {
+		_, err := os.Stat(filepath.Join(tempDir, "images", "post", name))
+		assert.NoError(t, err, name)
+	}
+	assert.Contains(t, paths, "/image/fetch/w_424,c_limit,f_auto/https://substack-post-media.s3.amazonaws.com/public/images/abc_2000x1000.png")
+	assert.Len(t, paths, 4)
+}
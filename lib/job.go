@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Job is a download running in the background, started with StartJob. It lets programs
+// embedding the library, such as GUIs, follow and cancel downloads without the command line.
+type Job struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu       sync.Mutex
+	progress JobProgress
+	summary  *DownloadSummary
+	err      error
+}
+
+// JobProgress is a snapshot of the progress of a Job
+type JobProgress struct {
+	Status  RunStatus `json:"status"`
+	Done    int       `json:"done"`  // posts processed so far
+	Total   int       `json:"total"` // posts to download, known once they are listed
+	Failed  int       `json:"failed"`
+	Images  int       `json:"images"`
+	Bytes   int64     `json:"bytes"`             // bytes downloaded so far
+	Current string    `json:"current,omitempty"` // URL of the post fetched last
+	Started time.Time `json:"started"`
+}
+
+// StartJob starts downloading in the background every post of the publication at url not
+// downloaded yet, or a single post if url is the URL of a post. The OnProgress function of
+// the options is still called. If the Fetcher is nil, a default Fetcher will be used.
+func StartJob(ctx context.Context, f *Fetcher, url string, opts DownloadOptions) *Job {
+	ctx, cancel := context.WithCancel(ctx)
+	job := &Job{
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		progress: JobProgress{Status: RunRunning, Started: time.Now()},
+	}
+
+	onProgress := opts.OnProgress
+	opts.OnProgress = func(event ProgressEvent) {
+		job.update(event)
+		if onProgress != nil {
+			onProgress(event)
+		}
+	}
+	go job.run(ctx, NewDownloader(f, opts), url)
+
+	return job
+}
+
+// run downloads url and records the outcome of the job
+func (j *Job) run(ctx context.Context, d *Downloader, url string) {
+	defer close(j.done)
+	defer j.cancel()
+
+	var summary *DownloadSummary
+	var err error
+	if strings.Contains(url, "/p/") {
+		j.mu.Lock()
+		j.progress.Total = 1
+		j.mu.Unlock()
+		summary, err = d.downloadPostSummary(ctx, url)
+	} else {
+		summary, err = d.DownloadPublication(ctx, url, nil)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.summary, j.err = summary, err
+	switch {
+	case errors.Is(err, context.Canceled):
+		j.progress.Status = RunCancelled
+	case err != nil:
+		j.progress.Status = RunFailed
+	default:
+		j.progress.Status = RunCompleted
+	}
+}
+
+// update adds a progress event of the run to the snapshot
+func (j *Job) update(event ProgressEvent) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.progress.Bytes = event.Bytes
+	switch event.Event {
+	case ProgressRunStarted:
+		j.progress.Total = event.Total
+	case ProgressPostStarted:
+		j.progress.Current = event.URL
+	case ProgressImage:
+		j.progress.Images++
+	case ProgressPostFinished:
+		j.progress.Done++
+	case ProgressPostFailed:
+		j.progress.Done++
+		j.progress.Failed++
+	}
+}
+
+// Progress returns a snapshot of the progress of the job
+func (j *Job) Progress() JobProgress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.progress
+}
+
+// Cancel stops the job. The post being written is finished and the manifest saved, then
+// Result returns context.Canceled.
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+// Done returns a channel closed once the job is over
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Result waits for the job to be over and returns the summary of the run and its error
+func (j *Job) Result() (*DownloadSummary, error) {
+	<-j.done
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.summary, j.err
+}
+
+// downloadPostSummary downloads a single post with DownloadPost, summarizing it as a run
+func (d *Downloader) downloadPostSummary(ctx context.Context, postURL string) (*DownloadSummary, error) {
+	start := time.Now()
+	summary := &DownloadSummary{Found: 1}
+	result, err := d.DownloadPost(ctx, postURL)
+	if result.Err != nil {
+		summary.Failed = 1
+	} else {
+		summary.Downloaded = 1
+		if result.Images != nil {
+			summary.ImagesOK = result.Images.Success
+			summary.ImagesFailed = result.Images.Failed
+			summary.ImageBytes = result.Images.Bytes
+		}
+	}
+	summary.Duration = time.Since(start)
+	return summary, err
+}
@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test following a job to its end
+func TestJob(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	var events atomic.Int32
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = t.TempDir()
+	opts.OnProgress = func(event ProgressEvent) { events.Add(1) }
+
+	job := StartJob(context.Background(), NewFetcher(WithRatePerSecond(100)), server.URL+"/p/missing", opts)
+	summary, err := job.Result()
+	assert.Error(t, err)
+	require.NotNil(t, summary)
+	assert.Equal(t, 1, summary.Failed)
+
+	select {
+	case <-job.Done():
+	default:
+		t.Fatal("the job should be done once its result is returned")
+	}
+
+	progress := job.Progress()
+	assert.Equal(t, RunFailed, progress.Status)
+	assert.Equal(t, 1, progress.Total)
+	assert.Equal(t, 1, progress.Done)
+	assert.Equal(t, 1, progress.Failed)
+	assert.Equal(t, server.URL+"/p/missing", progress.Current)
+	assert.False(t, progress.Started.IsZero())
+	assert.Equal(t, int32(2), events.Load()) // post started and failed
+}
+
+// Test cancelling a job
+func TestJobCancel(t *testing.T) {
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = t.TempDir()
+	job := StartJob(context.Background(), NewFetcher(WithRatePerSecond(100)), server.URL+"/p/slow", opts)
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the post wasn't fetched")
+	}
+	assert.Equal(t, RunRunning, job.Progress().Status)
+	job.Cancel()
+
+	_, err := job.Result()
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, RunCancelled, job.Progress().Status)
+}
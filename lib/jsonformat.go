@@ -0,0 +1,219 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// JSONLFile is the file of the output directory the posts written in the jsonl format are
+// appended to, one line per post
+const JSONLFile = "posts.jsonl"
+
+// jsonlMu serializes the writes to JSON Lines files, shared by the posts of a run
+var jsonlMu sync.Mutex
+
+// jsonlIndexes holds the posts of the JSON Lines files written by the process, guarded by jsonlMu
+var jsonlIndexes = make(map[string]*jsonlIndex)
+
+// jsonlIndex is the canonical URLs of the posts of a JSON Lines file, as of the size and
+// modification time the file had when it was last written, so that new posts are appended
+// without reading the file again
+type jsonlIndex struct {
+	size    int64
+	modTime time.Time
+	urls    map[string]bool
+}
+
+// PostDocument is a post as written in the json and jsonl formats: the post as extracted,
+// with its body converted to Markdown and the publication it was extracted from
+type PostDocument struct {
+	Post
+	Publication *PostPublication `json:"publication,omitempty"`
+	Markdown    string           `json:"markdown"`
+}
+
+// NewPostDocument returns the document of a post written in the json and jsonl formats
+func NewPostDocument(post Post) (PostDocument, error) {
+	markdown, err := post.ToMD(false)
+	if err != nil {
+		return PostDocument{}, err
+	}
+	doc := PostDocument{Post: post, Markdown: markdown}
+	if post.Publication != (PostPublication{}) {
+		pub := post.Publication
+		doc.Publication = &pub
+	}
+	return doc, nil
+}
+
+// isJSONFormat tells whether posts are written in format as JSON documents
+func isJSONFormat(format string) bool {
+	return format == "json" || format == "jsonl"
+}
+
+// jsonContent returns the post as a JSON document: indented for the json format, and on a
+// single line ending with a newline for the jsonl format
+func (p *Post) jsonContent(format string) (string, error) {
+	doc, err := NewPostDocument(*p)
+	if err != nil {
+		return "", err
+	}
+	if format == "jsonl" {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// writePostContent writes the content of a post in format to path. In the jsonl format, the
+// content is appended to the file, shared by all the posts, unless the file has a line for
+// the post already: this line is replaced, so that a post downloaded again isn't duplicated.
+func writePostContent(path string, format string, content string) error {
+	if format != "jsonl" {
+		return os.WriteFile(path, []byte(content), 0644)
+	}
+	jsonlMu.Lock()
+	defer jsonlMu.Unlock()
+
+	index, err := loadJSONLIndex(path)
+	if err != nil {
+		return err
+	}
+	url := jsonlPostURL([]byte(content))
+	if url != "" && index.urls[url] {
+		err = replaceJSONLine(path, url, content)
+	} else {
+		err = appendJSONLine(path, content)
+	}
+	if err != nil {
+		// The file is read again by the next write
+		delete(jsonlIndexes, path)
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		delete(jsonlIndexes, path)
+		return err
+	}
+	index.size, index.modTime = info.Size(), info.ModTime()
+	if url != "" {
+		index.urls[url] = true
+	}
+	return nil
+}
+
+// loadJSONLIndex returns the index of the posts of the JSON Lines file at path, reading the
+// file unless it is unchanged since the process last wrote it
+func loadJSONLIndex(path string) (*jsonlIndex, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		index := &jsonlIndex{urls: make(map[string]bool)}
+		jsonlIndexes[path] = index
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if index, ok := jsonlIndexes[path]; ok && index.size == info.Size() && index.modTime.Equal(info.ModTime()) {
+		return index, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	index := &jsonlIndex{size: info.Size(), modTime: info.ModTime(), urls: make(map[string]bool)}
+	// Lines are read whole, posts being longer than the buffer of a bufio.Scanner
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if url := jsonlPostURL(line); url != "" {
+			index.urls[url] = true
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	jsonlIndexes[path] = index
+	return index, nil
+}
+
+// jsonlPostURL returns the canonical URL of the post of a line of a JSON Lines file, or an
+// empty string if the line isn't a post
+func jsonlPostURL(line []byte) string {
+	var doc struct {
+		CanonicalUrl string `json:"canonical_url"`
+	}
+	if err := json.Unmarshal(line, &doc); err != nil {
+		return ""
+	}
+	return doc.CanonicalUrl
+}
+
+// appendJSONLine appends content, a line, to the JSON Lines file at path
+func appendJSONLine(path string, content string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// replaceJSONLine rewrites the JSON Lines file at path with content in place of the line of
+// the post at url, dropping any other line of the post
+func replaceJSONLine(path string, url string, content string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	replaced := false
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if jsonlPostURL(line) != url {
+			out.Write(line)
+			continue
+		}
+		if !replaced {
+			out.WriteString(content)
+			replaced = true
+		}
+	}
+
+	// Write to a temporary file first so an interrupted run never leaves a truncated file
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, out.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// JSONLPath returns the JSON Lines file of the posts of outputDir
+func JSONLPath(outputDir string) string {
+	return filepath.Join(outputDir, JSONLFile)
+}
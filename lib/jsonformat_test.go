@@ -0,0 +1,68 @@
+package lib
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test writing a post as a JSON document
+func TestPostJSONFormats(t *testing.T) {
+	post := createSamplePost()
+	post.Publication = PostPublication{Name: "Example"}
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "post.json")
+	require.NoError(t, post.WriteToFile(path, "json", true))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(data, &doc))
+	assert.Equal(t, post.Title, doc["title"])
+	assert.Equal(t, post.BodyHTML, doc["body_html"])
+	assert.Equal(t, map[string]any{"name": "Example", "logo_url": "", "email_banner_url": "", "author_name": "", "copyright": ""}, doc["publication"])
+	markdown, err := post.ToMD(false)
+	require.NoError(t, err)
+	assert.Equal(t, markdown, doc["markdown"])
+	assert.NotContains(t, string(data), "original content:", "the URL of the post is in the document")
+
+	// The jsonl file gets a line per post
+	path = JSONLPath(dir)
+	require.NoError(t, post.WriteToFile(path, "jsonl", false))
+	other := createSamplePost()
+	other.Slug = "other-post"
+	other.CanonicalUrl = "https://example.substack.com/p/other-post"
+	require.NoError(t, other.WriteToFile(path, "jsonl", false))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 2)
+
+	// A post written again replaces its line
+	post.Publication = PostPublication{}
+	require.NoError(t, post.WriteToFile(path, "jsonl", false))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 2)
+	var first PostDocument
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	assert.Equal(t, post.Slug, first.Slug)
+	assert.Nil(t, first.Publication)
+
+	// Also when the file was changed by another process
+	require.NoError(t, os.WriteFile(path, []byte(lines[1]+"\n"+lines[0]+"\n"+lines[0]+"\n"), 0644))
+	require.NoError(t, post.WriteToFile(path, "jsonl", false))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 2)
+	var last PostDocument
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &last))
+	assert.Equal(t, post.Slug, last.Slug)
+}
@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// rtlLanguages are the languages written from right to left, by ISO 639-1 code
+var rtlLanguages = map[string]bool{
+	"ar": true, // Arabic
+	"dv": true, // Dhivehi
+	"fa": true, // Persian
+	"he": true, // Hebrew
+	"iw": true, // Hebrew, former code
+	"ku": true, // Kurdish (Sorani)
+	"ps": true, // Pashto
+	"sd": true, // Sindhi
+	"ug": true, // Uyghur
+	"ur": true, // Urdu
+	"yi": true, // Yiddish
+}
+
+// LanguageDirection returns the direction of the text of a language tag such as "he" or
+// "ar-EG": "rtl" or "ltr", or "" if the language is unknown
+func LanguageDirection(lang string) string {
+	if lang == "" {
+		return ""
+	}
+	primary := strings.ToLower(strings.SplitN(strings.ReplaceAll(lang, "_", "-"), "-", 2)[0])
+	if rtlLanguages[primary] {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// DetectScriptLanguage guesses the language of a text written mostly in Hebrew or Arabic
+// script, the scripts that need a direction to render correctly. It returns "" for other texts.
+func DetectScriptLanguage(text string) string {
+	var letters, hebrew, arabic int
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Hebrew, r):
+			hebrew++
+		case unicode.Is(unicode.Arabic, r):
+			arabic++
+		}
+	}
+	switch {
+	case letters == 0:
+		return ""
+	case hebrew*2 > letters:
+		return "he"
+	case arabic*2 > letters:
+		return "ar"
+	}
+	return ""
+}
+
+// LanguageCode returns the language of the post: the one of its publication, or one guessed
+// from its title and body, or "" if it is unknown
+func (p *Post) LanguageCode() string {
+	if p.Language != "" {
+		return p.Language
+	}
+	return DetectScriptLanguage(p.Title + " " + p.ToText(false))
+}
+
+// withLanguage wraps the HTML content of the post in an element setting its language and
+// direction, for right-to-left languages to render correctly. The content is returned as is
+// when the language is unknown.
+func (p *Post) withLanguage(content string) string {
+	attributes := languageAttributes(p.LanguageCode())
+	if attributes == "" {
+		return content
+	}
+	return "<div" + attributes + ">\n" + content + "\n</div>"
+}
+
+// languageAttributes returns the lang and dir attributes of an HTML element holding text in
+// lang, with a leading space, or "" if the language is unknown
+func languageAttributes(lang string) string {
+	if lang == "" {
+		return ""
+	}
+	return ` lang="` + html.EscapeString(lang) + `" dir="` + LanguageDirection(lang) + `"`
+}
+
+// language returns the language of the archive pages: Lang, or the most common language of
+// the posts
+func (a *Archive) language() string {
+	if a.Lang != "" {
+		return a.Lang
+	}
+	counts := make(map[string]int)
+	best := ""
+	for _, entry := range a.Entries {
+		lang := entry.Post.LanguageCode()
+		if lang == "" {
+			continue
+		}
+		counts[lang]++
+		if counts[lang] > counts[best] {
+			best = lang
+		}
+	}
+	return best
+}
@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLanguageDirection(t *testing.T) {
+	assert.Equal(t, "rtl", LanguageDirection("he"))
+	assert.Equal(t, "rtl", LanguageDirection("ar-EG"))
+	assert.Equal(t, "rtl", LanguageDirection("fa_IR"))
+	assert.Equal(t, "ltr", LanguageDirection("en"))
+	assert.Equal(t, "", LanguageDirection(""))
+}
+
+func TestDetectScriptLanguage(t *testing.T) {
+	assert.Equal(t, "he", DetectScriptLanguage("שלום עולם, this is mostly Hebrew: ברוכים הבאים לניוזלטר שלנו"))
+	assert.Equal(t, "ar", DetectScriptLanguage("مرحبا بكم في النشرة الإخبارية"))
+	assert.Equal(t, "", DetectScriptLanguage("Hello world"))
+	assert.Equal(t, "", DetectScriptLanguage("123 !"))
+}
+
+func TestPostLanguage(t *testing.T) {
+	// The language of the publication comes with the post
+	raw := RawPost{str: `{"post": {"title": "Title", "body_html": "<p>Body</p>"}, "pub": {"language": "he"}}`}
+	post, err := raw.ToPost()
+	require.NoError(t, err)
+	assert.Equal(t, "he", post.Language)
+	assert.Equal(t, "<div lang=\"he\" dir=\"rtl\">\n<h1>Title</h1>\n\n<p>Body</p>\n</div>", post.withLanguage(post.ToHTML(true)))
+
+	// Or is guessed from the script of the post
+	post = Post{Title: "כותרת", BodyHTML: "שלום עולם"}
+	assert.Equal(t, "he", post.LanguageCode())
+	path := filepath.Join(t.TempDir(), "post.html")
+	require.NoError(t, post.WriteToFile(path, "html", false))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "<div lang=\"he\" dir=\"rtl\">\n<h1>כותרת</h1>\n\nשלום עולם\n</div>", string(content))
+
+	// The title isn't added again when the images are downloaded
+	_, err = post.WriteToFileWithImages(context.Background(), path, "html", false, true, ImageQualityHigh, "images", false, nil, "files", nil)
+	require.NoError(t, err)
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(content), "<h1>"))
+
+	// Posts in an unknown language are left as they are
+	post = Post{Title: "Title", BodyHTML: "<p>Body</p>"}
+	assert.Equal(t, "<p>Body</p>", post.withLanguage("<p>Body</p>"))
+}
+
+func TestArchiveLanguage(t *testing.T) {
+	dir := t.TempDir()
+	archive := NewArchive()
+	archive.AddEntry(Post{Title: "First", PostDate: "2023-01-01T10:00:00Z", Language: "ar", Tags: []PostTag{{Name: "News", Slug: "news"}}}, filepath.Join(dir, "first.html"), time.Now())
+	archive.AddEntry(Post{Title: "Second", PostDate: "2023-01-02T10:00:00Z", Language: "ar"}, filepath.Join(dir, "second.html"), time.Now())
+	require.NoError(t, archive.GenerateHTML(dir))
+
+	page, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(page), `<html lang="ar" dir="rtl">`)
+	page, err = os.ReadFile(filepath.Join(dir, "tags", "news.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(page), `<html lang="ar" dir="rtl">`)
+
+	// Without a language, the page stays in English
+	archive = NewArchive()
+	archive.AddEntry(Post{Title: "Post", PostDate: "2023-01-01T10:00:00Z"}, filepath.Join(dir, "post.html"), time.Now())
+	require.NoError(t, archive.GenerateHTML(dir))
+	page, err = os.ReadFile(filepath.Join(dir, "index.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(page), `<html lang="en">`)
+}
@@ -0,0 +1,116 @@
+package lib
+
+import (
+	"context"
+	"html"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// internalLinkRegex matches the links to posts in HTML attributes and Markdown, capturing the
+// opening of the link, the host, the slug and the fragment, e.g. href="https://example.com/p/slug#note"
+var internalLinkRegex = regexp.MustCompile(`(href="|\]\()(?:https?://([^/"\s)]+))?/p/([\w-]+)/?(?:\?[^"#\s)]*)?(#[^"\s)]*)?`)
+
+// RewriteInternalLinks rewrites the links between the posts recorded in the manifest, in the
+// given format, into relative links to their local files, so that reading offline doesn't go
+// back to the site. Links to posts that weren't downloaded are kept.
+// It returns the number of files changed. Text files have no links and are left as they are.
+func RewriteInternalLinks(ctx context.Context, manifest *Manifest, format string) (int, error) {
+	if format != "html" && format != "md" {
+		return 0, nil
+	}
+
+	manifest.mu.Lock()
+	entries := append([]ManifestEntry(nil), manifest.Posts...)
+	manifest.mu.Unlock()
+
+	// The local file of each post, by host and slug
+	targets := make(map[string]string)
+	hosts := make(map[string]string)
+	for _, entry := range entries {
+		file, ok := entry.Files[format]
+		if !ok {
+			continue
+		}
+		host := ""
+		if u, err := url.Parse(entry.URL); err == nil {
+			host = strings.ToLower(u.Host)
+		}
+		hosts[entry.Slug] = host
+		// Links to the previous slugs of a renamed post are redirected by Substack
+		for _, slug := range append(entry.PreviousSlugs, entry.Slug) {
+			targets[host+"/"+slug] = manifest.ResolvePath(file)
+		}
+	}
+
+	changed := 0
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return changed, err
+		}
+		file, ok := entry.Files[format]
+		if !ok {
+			continue
+		}
+		path := manifest.ResolvePath(file)
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return changed, err
+		}
+
+		content := internalLinkRegex.ReplaceAllStringFunc(string(data), func(link string) string {
+			match := internalLinkRegex.FindStringSubmatch(link)
+			host := strings.ToLower(match[2])
+			if host == "" {
+				// Links without host point to the publication of the post
+				host = hosts[entry.Slug]
+			}
+			target, ok := targets[host+"/"+match[3]]
+			if !ok {
+				return link
+			}
+			rel, err := filepath.Rel(filepath.Dir(path), target)
+			if err != nil {
+				return link
+			}
+			return match[1] + filepath.ToSlash(rel) + match[4]
+		})
+		if content == string(data) {
+			continue
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// PostNavigationHTML returns links to the previous and next posts of the publication, pointing at
+// their URL on the site until RewriteInternalLinks or MirrorLinks wires them to the local files.
+// An empty string is returned if the post has neither.
+func PostNavigationHTML(post Post) string {
+	u, err := url.Parse(post.CanonicalUrl)
+	if err != nil || u.Host == "" || (post.PreviousPostSlug == "" && post.NextPostSlug == "") {
+		return ""
+	}
+	link := func(slug string) string {
+		target := url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/p/" + slug}
+		return html.EscapeString(target.String())
+	}
+
+	var links []string
+	if post.PreviousPostSlug != "" {
+		links = append(links, `<a rel="prev" href="`+link(post.PreviousPostSlug)+`">&larr; Previous post</a>`)
+	}
+	if post.NextPostSlug != "" {
+		links = append(links, `<a rel="next" href="`+link(post.NextPostSlug)+`">Next post &rarr;</a>`)
+	}
+	return "\n<nav class=\"post-navigation\">" + strings.Join(links, " | ") + "</nav>\n"
+}
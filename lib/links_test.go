@@ -0,0 +1,123 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test rewriting the links between downloaded posts to their local files
+func TestRewriteInternalLinks(t *testing.T) {
+	dir := t.TempDir()
+	manifest, err := LoadManifest(dir)
+	require.NoError(t, err)
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+	first := write("20230101_100000_first.html", `<p><a href="https://example.com/p/second?utm_source=x#part">next</a> `+
+		`<a href="/p/third">third</a> <a href="https://example.com/p/missing">missing</a> `+
+		`<a href="https://other.com/p/second">other</a></p>`)
+	write("20230102_100000_second.md", "See [the first post](https://Example.com/p/first/).")
+	write("20230102_100000_second.html", `<a href="https://example.com/p/first">first</a>`)
+	write("2023/20230103_100000_third.html", `<a href="https://example.com/p/first">first</a>`)
+
+	now := time.Now()
+	manifest.AddEntry(NewManifestEntry(Post{Id: 1, Slug: "first", CanonicalUrl: "https://example.com/p/first"},
+		map[string]string{"html": "20230101_100000_first.html"}, now))
+	manifest.AddEntry(NewManifestEntry(Post{Id: 2, Slug: "second", CanonicalUrl: "https://example.com/p/second"},
+		map[string]string{"html": "20230102_100000_second.html", "md": "20230102_100000_second.md"}, now))
+	manifest.AddEntry(NewManifestEntry(Post{Id: 3, Slug: "third", CanonicalUrl: "https://example.com/p/third"},
+		map[string]string{"html": "2023/20230103_100000_third.html"}, now))
+
+	changed, err := RewriteInternalLinks(context.Background(), manifest, "html")
+	require.NoError(t, err)
+	assert.Equal(t, 3, changed)
+
+	data, err := os.ReadFile(first)
+	require.NoError(t, err)
+	assert.Equal(t, `<p><a href="20230102_100000_second.html#part">next</a> `+
+		`<a href="2023/20230103_100000_third.html">third</a> <a href="https://example.com/p/missing">missing</a> `+
+		`<a href="https://other.com/p/second">other</a></p>`, string(data))
+
+	data, err = os.ReadFile(filepath.Join(dir, "2023", "20230103_100000_third.html"))
+	require.NoError(t, err)
+	assert.Equal(t, `<a href="../20230101_100000_first.html">first</a>`, string(data))
+
+	// Only the posts downloaded in the format are linked
+	changed, err = RewriteInternalLinks(context.Background(), manifest, "md")
+	require.NoError(t, err)
+	assert.Equal(t, 0, changed)
+
+	manifest.AddEntry(NewManifestEntry(Post{Id: 1, Slug: "first", CanonicalUrl: "https://example.com/p/first"},
+		map[string]string{"md": "20230101_100000_first.md"}, now))
+	write("20230101_100000_first.md", "# First")
+	changed, err = RewriteInternalLinks(context.Background(), manifest, "md")
+	require.NoError(t, err)
+	assert.Equal(t, 1, changed)
+	data, err = os.ReadFile(filepath.Join(dir, "20230102_100000_second.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "See [the first post](20230101_100000_first.md).", string(data))
+
+	// Running again changes nothing
+	changed, err = RewriteInternalLinks(context.Background(), manifest, "html")
+	require.NoError(t, err)
+	assert.Equal(t, 0, changed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = RewriteInternalLinks(ctx, manifest, "html")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// Links to the previous slug of a renamed post point to its file
+func TestRewriteInternalLinksRenamed(t *testing.T) {
+	dir := t.TempDir()
+	manifest, err := LoadManifest(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "old.html"), []byte("old"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.html"),
+		[]byte(`<a href="https://example.com/p/old">old</a> <a href="https://example.com/p/new">new</a>`), 0644))
+
+	now := time.Now()
+	manifest.AddEntry(NewManifestEntry(Post{Id: 1, Slug: "old", CanonicalUrl: "https://example.com/p/old"},
+		map[string]string{"html": "old.html"}, now))
+	manifest.AddEntry(NewManifestEntry(Post{Id: 1, Slug: "new", CanonicalUrl: "https://example.com/p/new"},
+		map[string]string{"html": "old.html"}, now))
+	manifest.AddEntry(NewManifestEntry(Post{Id: 2, Slug: "other", CanonicalUrl: "https://example.com/p/other"},
+		map[string]string{"html": "other.html"}, now))
+
+	changed, err := RewriteInternalLinks(context.Background(), manifest, "html")
+	require.NoError(t, err)
+	assert.Equal(t, 1, changed)
+
+	data, err := os.ReadFile(filepath.Join(dir, "other.html"))
+	require.NoError(t, err)
+	assert.Equal(t, `<a href="old.html">old</a> <a href="old.html">new</a>`, string(data))
+}
+
+// Test the links to the previous and next posts
+func TestPostNavigationHTML(t *testing.T) {
+	post := Post{CanonicalUrl: "https://example.com/p/current", PreviousPostSlug: "before", NextPostSlug: "after"}
+	nav := PostNavigationHTML(post)
+	assert.Equal(t, "\n"+`<nav class="post-navigation"><a rel="prev" href="https://example.com/p/before">&larr; Previous post</a> | `+
+		`<a rel="next" href="https://example.com/p/after">Next post &rarr;</a></nav>`+"\n", nav)
+
+	// Wired to the local files of the posts, or their mirror path
+	assert.Contains(t, MirrorLinks(nav, post.CanonicalUrl, "html"), `href="../before/index.html"`)
+
+	post.NextPostSlug = ""
+	assert.NotContains(t, PostNavigationHTML(post), "Next post")
+	post.PreviousPostSlug = ""
+	assert.Empty(t, PostNavigationHTML(post))
+	assert.Empty(t, PostNavigationHTML(Post{PreviousPostSlug: "before"}))
+}
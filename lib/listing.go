@@ -0,0 +1,218 @@
+package lib
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ListingFormats lists the output formats of WritePostListings
+var ListingFormats = []string{"table", "json", "csv"}
+
+// PostListing is a post of a publication as shown by the list command.
+// Only the URL is known for posts listed from the sitemap.
+type PostListing struct {
+	URL       string `json:"url"`
+	Title     string `json:"title,omitempty"`
+	Date      string `json:"date,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Audience  string `json:"audience,omitempty"`
+	Paid      bool   `json:"paid,omitempty"`
+	WordCount int    `json:"wordcount,omitempty"`
+	Status    string `json:"status,omitempty"` // "missing" or "outdated" when listing undownloaded posts
+}
+
+// NewPostListing creates the listing of a post returned by the archive API
+func NewPostListing(post Post) PostListing {
+	return PostListing{
+		URL:       post.CanonicalUrl,
+		Title:     post.Title,
+		Date:      dateOnly(post.PostDate),
+		Type:      post.Type,
+		Audience:  post.Audience,
+		Paid:      IsPaidAudience(post.Audience),
+		WordCount: post.WordCount,
+	}
+}
+
+// Statuses of the posts listed by MissingPosts
+const (
+	ListingMissing  = "missing"
+	ListingOutdated = "outdated"
+)
+
+// MissingPosts returns the posts of a sitemap that weren't downloaded in dir yet, or that
+// were modified after they were downloaded (according to the manifest).
+func MissingPosts(entries []SitemapEntry, dir string) ([]PostListing, error) {
+	// Download time of each post found locally, zero when unknown
+	downloaded := make(map[string]time.Time)
+	if _, err := os.Stat(dir); err == nil {
+		manifest, err := LoadManifest(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range manifest.Posts {
+			for _, path := range entry.Files {
+				if _, err := os.Stat(manifest.ResolvePath(path)); err == nil {
+					downloaded[entry.Slug] = entry.DownloadedAt
+					break
+				}
+			}
+		}
+
+		posts, err := ScanLocalPosts(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, post := range posts {
+			if _, ok := downloaded[post.Slug]; !ok {
+				downloaded[post.Slug] = time.Time{}
+			}
+		}
+	}
+
+	var missing []PostListing
+	for _, entry := range entries {
+		at, ok := downloaded[SlugFromURL(entry.URL)]
+		switch {
+		case !ok:
+			missing = append(missing, PostListing{URL: entry.URL, Status: ListingMissing})
+		case !at.IsZero() && !entry.LastMod.IsZero() && entry.LastMod.UTC().Format("2006-01-02") > at.UTC().Format("2006-01-02"):
+			missing = append(missing, PostListing{URL: entry.URL, Status: ListingOutdated})
+		}
+	}
+	return missing, nil
+}
+
+// AddListingDetails fills in the metadata of listings from the posts returned by the archive API,
+// matching them by slug. The URL and status of the listings are kept.
+func AddListingDetails(listings []PostListing, posts []Post) []PostListing {
+	bySlug := make(map[string]Post, len(posts))
+	for _, post := range posts {
+		bySlug[post.Slug] = post
+	}
+
+	detailed := make([]PostListing, len(listings))
+	for i, l := range listings {
+		detailed[i] = l
+		if post, ok := bySlug[SlugFromURL(l.URL)]; ok {
+			detailed[i] = NewPostListing(post)
+			detailed[i].URL = l.URL
+			detailed[i].Status = l.Status
+		}
+	}
+	return detailed
+}
+
+// IsPaidAudience reports whether posts with the given audience are reserved to paying subscribers
+func IsPaidAudience(audience string) bool {
+	return audience == "only_paid" || audience == "founding"
+}
+
+// listingColumn is a column of the table and CSV outputs of post listings
+type listingColumn struct {
+	Name  string
+	Value func(PostListing) string
+}
+
+// listingColumns returns the columns written for post listings
+func listingColumns(details bool, status bool, csv bool) []listingColumn {
+	var columns []listingColumn
+	if status {
+		columns = append(columns, listingColumn{"status", func(l PostListing) string { return l.Status }})
+	}
+	if details {
+		columns = append(columns,
+			listingColumn{"date", func(l PostListing) string { return l.Date }},
+			listingColumn{"type", func(l PostListing) string { return l.Type }})
+		if csv {
+			columns = append(columns,
+				listingColumn{"paid", func(l PostListing) string { return strconv.FormatBool(l.Paid) }},
+				listingColumn{"audience", func(l PostListing) string { return l.Audience }},
+				listingColumn{"wordcount", func(l PostListing) string { return strconv.Itoa(l.WordCount) }})
+		} else {
+			columns = append(columns,
+				listingColumn{"paid", func(l PostListing) string { return yesNo(l.Paid) }},
+				listingColumn{"words", func(l PostListing) string { return strconv.Itoa(l.WordCount) }})
+		}
+		columns = append(columns, listingColumn{"title", func(l PostListing) string { return l.Title }})
+	}
+	return append(columns, listingColumn{"url", func(l PostListing) string { return l.URL }})
+}
+
+// WritePostListings writes posts as a table, a JSON array or CSV. Without details,
+// only the URLs (and status, if any) are written, and the table is a bare list of URLs.
+func WritePostListings(w io.Writer, listings []PostListing, format string, details bool) error {
+	status := false
+	for _, l := range listings {
+		status = status || l.Status != ""
+	}
+
+	switch format {
+	case "table":
+		if !details && !status {
+			for _, l := range listings {
+				if _, err := fmt.Fprintln(w, l.URL); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		columns := listingColumns(details, status, false)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		row := make([]string, len(columns))
+		for i, c := range columns {
+			row[i] = strings.ToUpper(c.Name)
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+		for _, l := range listings {
+			for i, c := range columns {
+				row[i] = c.Value(l)
+			}
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+
+	case "json":
+		if listings == nil {
+			listings = []PostListing{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(listings)
+
+	case "csv":
+		columns := listingColumns(details, status, true)
+		cw := csv.NewWriter(w)
+		row := make([]string, len(columns))
+		for i, c := range columns {
+			row[i] = c.Name
+		}
+		cw.Write(row)
+		for _, l := range listings {
+			for i, c := range columns {
+				row[i] = c.Value(l)
+			}
+			cw.Write(row)
+		}
+		cw.Flush()
+		return cw.Error()
+
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+// yesNo formats a boolean for tables
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,141 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test writing post listings in the supported formats
+func TestWritePostListings(t *testing.T) {
+	post := createSamplePost()
+	post.PostDate = "2023-01-01T10:00:00.000Z"
+	post.Type = "newsletter"
+	post.Audience = "only_paid"
+	post.Title = "Hello, World"
+	listing := NewPostListing(post)
+
+	assert.Equal(t, PostListing{
+		URL:       "https://example.substack.com/p/test-post",
+		Title:     "Hello, World",
+		Date:      "2023-01-01",
+		Type:      "newsletter",
+		Audience:  "only_paid",
+		Paid:      true,
+		WordCount: 100,
+	}, listing)
+	assert.True(t, IsPaidAudience("founding"))
+	assert.False(t, IsPaidAudience("everyone"))
+
+	listings := []PostListing{listing, {URL: "https://example.substack.com/p/free", Date: "2022-12-01", Type: "podcast", Audience: "everyone"}}
+
+	t.Run("table", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WritePostListings(&buf, listings, "table", false))
+		assert.Equal(t, "https://example.substack.com/p/test-post\nhttps://example.substack.com/p/free\n", buf.String())
+
+		buf.Reset()
+		require.NoError(t, WritePostListings(&buf, listings, "table", true))
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 3)
+		assert.True(t, strings.HasPrefix(lines[0], "DATE"))
+		assert.Contains(t, lines[1], "2023-01-01  newsletter  yes")
+		assert.Contains(t, lines[2], "podcast     no")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WritePostListings(&buf, listings, "json", true))
+		var decoded []PostListing
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+		assert.Equal(t, listings, decoded)
+
+		buf.Reset()
+		require.NoError(t, WritePostListings(&buf, []PostListing{{URL: "https://example.substack.com/p/a"}}, "json", false))
+		assert.JSONEq(t, `[{"url": "https://example.substack.com/p/a"}]`, buf.String())
+
+		buf.Reset()
+		require.NoError(t, WritePostListings(&buf, nil, "json", false))
+		assert.JSONEq(t, `[]`, buf.String())
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WritePostListings(&buf, listings, "csv", true))
+		assert.Equal(t, "date,type,paid,audience,wordcount,title,url\n"+
+			"2023-01-01,newsletter,true,only_paid,100,\"Hello, World\",https://example.substack.com/p/test-post\n"+
+			"2022-12-01,podcast,false,everyone,0,,https://example.substack.com/p/free\n", buf.String())
+
+		buf.Reset()
+		require.NoError(t, WritePostListings(&buf, listings[:1], "csv", false))
+		assert.Equal(t, "url\nhttps://example.substack.com/p/test-post\n", buf.String())
+	})
+
+	assert.Error(t, WritePostListings(&bytes.Buffer{}, listings, "xml", false))
+}
+
+// Test finding the posts not downloaded yet
+func TestMissingPosts(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "missing-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// A post recorded in the manifest, one downloaded before the manifest existed,
+	// and one whose file was deleted
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "20230101_100000_recorded.md"), []byte("# Recorded"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "20230102_100000_unrecorded.md"), []byte("# Unrecorded"), 0644))
+	manifest, err := LoadManifest(tempDir)
+	require.NoError(t, err)
+	downloadedAt := time.Date(2023, 2, 1, 12, 0, 0, 0, time.UTC)
+	manifest.AddEntry(ManifestEntry{Slug: "recorded", Files: map[string]string{"md": "20230101_100000_recorded.md"}, DownloadedAt: downloadedAt})
+	manifest.AddEntry(ManifestEntry{Slug: "deleted", Files: map[string]string{"md": "20230103_100000_deleted.md"}, DownloadedAt: downloadedAt})
+	require.NoError(t, manifest.Save())
+
+	base := "https://example.substack.com/p/"
+	entries := []SitemapEntry{
+		{URL: base + "recorded", LastMod: time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{URL: base + "unrecorded", LastMod: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{URL: base + "deleted", LastMod: time.Date(2023, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{URL: base + "new", LastMod: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	missing, err := MissingPosts(entries, tempDir)
+	require.NoError(t, err)
+	assert.Equal(t, []PostListing{
+		{URL: base + "deleted", Status: ListingMissing},
+		{URL: base + "new", Status: ListingMissing},
+	}, missing)
+
+	// Posts modified after they were downloaded are outdated
+	entries[0].LastMod = time.Date(2023, 2, 2, 8, 0, 0, 0, time.UTC)
+	missing, err = MissingPosts(entries, tempDir)
+	require.NoError(t, err)
+	require.Len(t, missing, 3)
+	assert.Equal(t, PostListing{URL: base + "recorded", Status: ListingOutdated}, missing[0])
+
+	// Everything is missing from a directory that doesn't exist
+	missing, err = MissingPosts(entries, filepath.Join(tempDir, "missing"))
+	require.NoError(t, err)
+	assert.Len(t, missing, 4)
+
+	t.Run("details", func(t *testing.T) {
+		post := createSamplePost()
+		post.Slug = "new"
+		post.Title = "New Post"
+		detailed := AddListingDetails(missing[3:], []Post{post})
+		assert.Equal(t, "New Post", detailed[0].Title)
+		assert.Equal(t, base+"new", detailed[0].URL)
+		assert.Equal(t, ListingMissing, detailed[0].Status)
+
+		var buf bytes.Buffer
+		require.NoError(t, WritePostListings(&buf, missing[:1], "table", false))
+		assert.Equal(t, "STATUS   URL\nmissing  "+base+"recorded\n", buf.String())
+	})
+}
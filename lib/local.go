@@ -0,0 +1,353 @@
+package lib
+
+import (
+	"fmt"
+	"html"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/k3a/html2text"
+)
+
+// localPostPattern matches the file names produced by the download command:
+// YYYYMMDD_HHMMSS_slug.format (the date prefix is empty when the post date is unknown).
+// Slugs have no dots, which leaves out the previous versions of posts, e.g. slug.v2.md.
+var localPostPattern = regexp.MustCompile(`^(\d{8}_\d{6})?_([^.]+)\.(html|md|txt)$`)
+
+// localPostFormats are the formats of the post files read by ScanLocalPosts
+var localPostFormats = []string{"html", "md", "txt"}
+
+// paragraphSeparator matches the blank lines separating paragraphs of plain text
+var paragraphSeparator = regexp.MustCompile(`\n\s*\n`)
+
+// LocalPost represents a post that has already been downloaded to disk
+type LocalPost struct {
+	Path     string
+	Slug     string
+	Format   string
+	Date     time.Time
+	Title    string
+	Subtitle string
+	URL      string
+	Tags     []string
+	Content  string
+	TextHash string            // hash of the canonical text of the post when it was downloaded, from the manifest
+	Files    map[string]string // files of the post by format, Path being the one in Format
+}
+
+// localMediaDirs are the directories the download command writes the media of posts to by
+// default, skipped by ScanLocalPosts
+var localMediaDirs = []string{"images", "files", "audio"}
+
+// scannedManifest is a manifest found by ScanLocalPosts, indexed once for the lookups of all
+// the files of its directory
+type scannedManifest struct {
+	dir    string
+	bySlug map[string]ManifestEntry
+	byPath map[string]scannedFile // by resolved path of the files of the posts
+}
+
+// scannedFile is a file of a post recorded in a manifest
+type scannedFile struct {
+	entry  ManifestEntry
+	format string
+}
+
+// scannedPostFile is a file of a post found by ScanLocalPosts, before the files of each post
+// are grouped
+type scannedPostFile struct {
+	path     string
+	slug     string
+	format   string
+	entry    ManifestEntry
+	recorded bool // entry is the manifest entry of the post
+}
+
+// newScannedManifest indexes the entries of manifest by slug and by file
+func newScannedManifest(manifest *Manifest) *scannedManifest {
+	m := &scannedManifest{dir: manifest.Dir(), bySlug: make(map[string]ManifestEntry), byPath: make(map[string]scannedFile)}
+	for _, entry := range manifest.Entries() {
+		m.bySlug[entry.Slug] = entry
+		for format, file := range entry.Files {
+			m.byPath[manifest.ResolvePath(file)] = scannedFile{entry: entry, format: format}
+		}
+	}
+	return m
+}
+
+// ScanLocalPosts finds all downloaded posts in the given directory and its subdirectories,
+// e.g. the folders of the publications of a list or the layouts of --mirror and --by-author.
+// Metadata recorded in the manifest of the directory of a post, or of the nearest parent
+// directory having one, is used when available, and finds the posts not named after their
+// date and slug. A post downloaded in several formats is returned once, read from its file
+// in the richest format (HTML, then Markdown, then text), its other files being listed in
+// Files. Posts are returned sorted by date (newest first).
+func ScanLocalPosts(dir string) ([]LocalPost, error) {
+	manifests := make(map[string]*scannedManifest)
+	// the files of each post, by manifest entry or else by directory and slug
+	files := make(map[string][]scannedPostFile)
+	var keys []string
+	add := func(key string, file scannedPostFile) {
+		if _, ok := files[key]; !ok {
+			keys = append(keys, key)
+		}
+		files[key] = append(files[key], file)
+	}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to read directory: %w", err)
+		}
+		if entry.IsDir() {
+			if path != dir && (strings.HasPrefix(entry.Name(), ".") || containsString(localMediaDirs, entry.Name())) {
+				return filepath.SkipDir
+			}
+			manifest, ok := manifests[filepath.Dir(path)]
+			if _, err := os.Stat(filepath.Join(path, ManifestFile)); err == nil || !ok {
+				loaded, err := LoadManifest(path)
+				if err != nil {
+					return err
+				}
+				manifest = newScannedManifest(loaded)
+			}
+			manifests[path] = manifest
+			return nil
+		}
+
+		manifest := manifests[filepath.Dir(path)]
+		if match := localPostPattern.FindStringSubmatch(entry.Name()); match != nil {
+			file := scannedPostFile{path: path, slug: match[2], format: match[3]}
+			if file.entry, file.recorded = manifest.bySlug[file.slug]; file.recorded {
+				add(manifest.dir+"\x00"+file.slug, file)
+			} else {
+				add(filepath.Dir(path)+"\x00"+file.slug, file)
+			}
+			return nil
+		}
+		if recorded, ok := manifest.byPath[path]; ok && containsString(localPostFormats, recorded.format) {
+			add(manifest.dir+"\x00"+recorded.entry.Slug, scannedPostFile{
+				path: path, slug: recorded.entry.Slug, format: recorded.format, entry: recorded.entry, recorded: true,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	posts := make([]LocalPost, 0, len(keys))
+	for _, key := range keys {
+		postFiles := files[key]
+		best := postFiles[0]
+		paths := make(map[string]string, len(postFiles))
+		for _, file := range postFiles {
+			paths[file.format] = file.path
+			if sourceFormatRank(file.format) < sourceFormatRank(best.format) {
+				best = file
+			}
+		}
+
+		post, err := LoadLocalPost(best.path)
+		if err != nil {
+			return nil, err
+		}
+		post.Slug = best.slug
+		post.Format = best.format
+		if best.recorded {
+			post.applyManifestEntry(best.entry)
+		}
+		post.Files = paths
+		posts = append(posts, post)
+	}
+
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].Date.After(posts[j].Date)
+	})
+
+	return posts, nil
+}
+
+// InFormat returns the post read from its file in format, with the same metadata
+func (lp LocalPost) InFormat(format string) (LocalPost, error) {
+	if format == lp.Format {
+		return lp, nil
+	}
+	path, ok := lp.Files[format]
+	if !ok {
+		return LocalPost{}, fmt.Errorf("post %s wasn't downloaded in %s", lp.Slug, format)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return LocalPost{}, fmt.Errorf("failed to read post file: %w", err)
+	}
+	post := lp
+	post.Path = path
+	post.Format = format
+	post.Content = string(content)
+	return post, nil
+}
+
+// LocalManifestEntries returns the manifest entries of a download directory. Posts
+// downloaded before the manifest existed are included with the metadata found in their files.
+func LocalManifestEntries(dir string) ([]ManifestEntry, error) {
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, err := ScanLocalPosts(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := append([]ManifestEntry(nil), manifest.Posts...)
+	for _, post := range posts {
+		if _, ok := manifest.Entry(post.Slug); ok {
+			continue
+		}
+		entry := ManifestEntry{
+			Slug:      post.Slug,
+			Title:     post.Title,
+			WordCount: len(strings.Fields(post.PlainText())),
+			Files:     make(map[string]string),
+		}
+		for format, path := range post.Files {
+			entry.Files[format] = manifest.RelPath(path)
+		}
+		if !post.Date.IsZero() {
+			entry.PostDate = post.Date.Format(time.RFC3339)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// LoadLocalPost reads a single downloaded post file and extracts its metadata
+func LoadLocalPost(path string) (LocalPost, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return LocalPost{}, fmt.Errorf("failed to read post file: %w", err)
+	}
+
+	post := LocalPost{
+		Path:    path,
+		Content: string(content),
+	}
+
+	if match := localPostPattern.FindStringSubmatch(filepath.Base(path)); match != nil {
+		if match[1] != "" {
+			if date, err := time.Parse("20060102_150405", match[1]); err == nil {
+				post.Date = date
+			}
+		}
+		post.Slug = match[2]
+		post.Format = match[3]
+	} else {
+		post.Format = strings.TrimPrefix(filepath.Ext(path), ".")
+		post.Slug = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	post.Title = post.extractTitle()
+	if post.Title == "" {
+		post.Title = post.Slug
+	}
+
+	return post, nil
+}
+
+// applyManifestEntry fills in the metadata recorded in the manifest
+func (lp *LocalPost) applyManifestEntry(entry ManifestEntry) {
+	if entry.Title != "" {
+		lp.Title = entry.Title
+	}
+	if date, err := time.Parse(time.RFC3339, entry.PostDate); err == nil {
+		lp.Date = date
+	}
+	lp.Subtitle = entry.Subtitle
+	lp.URL = entry.URL
+	lp.Tags = entry.Tags
+	lp.TextHash = entry.TextHash
+}
+
+// extractTitle finds the title written at the top of the post file
+func (lp *LocalPost) extractTitle() string {
+	switch lp.Format {
+	case "html":
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(lp.Content))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(doc.Find("h1").First().Text())
+	case "md":
+		for _, line := range strings.Split(lp.Content, "\n") {
+			if strings.HasPrefix(line, "# ") {
+				return strings.TrimSpace(strings.TrimPrefix(line, "# "))
+			}
+		}
+	case "txt":
+		for _, line := range strings.Split(lp.Content, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				return line
+			}
+		}
+	}
+	return ""
+}
+
+// PlainText returns the post content with markup removed
+func (lp *LocalPost) PlainText() string {
+	switch lp.Format {
+	case "html":
+		return html2text.HTML2Text(lp.Content)
+	case "md":
+		return html2text.HTML2Text(MarkdownToHTML(lp.Content))
+	}
+	return lp.Content
+}
+
+// HTML returns the post content as HTML
+func (lp *LocalPost) HTML() string {
+	switch lp.Format {
+	case "html":
+		return lp.Content
+	case "md":
+		return MarkdownToHTML(lp.Content)
+	}
+
+	var b strings.Builder
+	for i, para := range splitParagraphs(lp.Content) {
+		text := strings.ReplaceAll(html.EscapeString(para), "\n", "<br/>")
+		if i == 0 && para == lp.Title {
+			b.WriteString("<h1>" + text + "</h1>\n")
+		} else {
+			b.WriteString("<p>" + text + "</p>\n")
+		}
+	}
+	return b.String()
+}
+
+// Markdown returns the post content as Markdown
+func (lp *LocalPost) Markdown() (string, error) {
+	if lp.Format == "html" {
+		return mdConverter.ConvertString(lp.Content)
+	}
+	return lp.Content, nil
+}
+
+// splitParagraphs splits plain text on blank lines
+func splitParagraphs(text string) []string {
+	var paragraphs []string
+	for _, para := range paragraphSeparator.Split(strings.ReplaceAll(text, "\r\n", "\n"), -1) {
+		if para = strings.TrimSpace(para); para != "" {
+			paragraphs = append(paragraphs, para)
+		}
+	}
+	return paragraphs
+}
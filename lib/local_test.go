@@ -0,0 +1,165 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function to write a set of downloaded post files
+func createLocalArchive(t *testing.T) string {
+	tempDir, err := os.MkdirTemp("", "local-archive-test-*")
+	require.NoError(t, err)
+
+	files := map[string]string{
+		"20230101_100000_first-post.md":   "# First Post\n\nThe quick brown fox jumps over the lazy dog.",
+		"20230215_120000_second-post.txt": "Second Post\n\nA post about climate policy and energy.",
+		"20230310_080000_third-post.md":   "# Third Post\n\nClimate change is discussed here in depth. Climate again.",
+		"_undated-post.md":                "# Undated Post\n\nNo date in the file name.",
+		"index.md":                        "# Substack Archive",
+		"notes.txt":                       "not a post",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(tempDir, "images"), 0755))
+
+	return tempDir
+}
+
+// Test scanning a directory of downloaded posts
+func TestScanLocalPosts(t *testing.T) {
+	tempDir := createLocalArchive(t)
+	defer os.RemoveAll(tempDir)
+
+	posts, err := ScanLocalPosts(tempDir)
+	require.NoError(t, err)
+	require.Len(t, posts, 4)
+
+	// Newest first, undated posts last
+	assert.Equal(t, "third-post", posts[0].Slug)
+	assert.Equal(t, "second-post", posts[1].Slug)
+	assert.Equal(t, "first-post", posts[2].Slug)
+	assert.Equal(t, "undated-post", posts[3].Slug)
+
+	assert.Equal(t, "Third Post", posts[0].Title)
+	assert.Equal(t, "md", posts[0].Format)
+	assert.Equal(t, time.Date(2023, 3, 10, 8, 0, 0, 0, time.UTC), posts[0].Date)
+	assert.Equal(t, "Second Post", posts[1].Title)
+	assert.Equal(t, "txt", posts[1].Format)
+	assert.True(t, posts[3].Date.IsZero())
+
+	t.Run("subdirectories", func(t *testing.T) {
+		dir := t.TempDir()
+		write := func(name string, content string) {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		}
+		write("20230101_100000_top.md", "# Top")
+		write("alpha/20230201_100000_nested.md", "# Nested")
+		write("alpha/2023/20230301_100000_deeper.md", "# Deeper")
+		write("example.com/p/mirrored/index.html", "<h1>Mirrored</h1>")
+		write("example.com/p/mirrored/images/photo.html", "<h1>Not a post</h1>")
+		write(".cache/20230401_100000_hidden.md", "# Hidden")
+		write("alpha/files/20230401_100000_attachment.txt", "Not a post")
+
+		// The layouts not named after the date and slug of the posts are found through the manifest
+		manifest, err := LoadManifest(dir)
+		require.NoError(t, err)
+		manifest.AddEntry(NewManifestEntry(Post{Id: 1, Slug: "mirrored", Title: "Mirrored post", PostDate: "2023-05-01T10:00:00Z"},
+			map[string]string{"html": "example.com/p/mirrored/index.html"}, time.Now()))
+		require.NoError(t, manifest.Save())
+		// The folder of a publication has its own manifest
+		nested, err := LoadManifest(filepath.Join(dir, "alpha"))
+		require.NoError(t, err)
+		nested.AddEntry(NewManifestEntry(Post{Id: 2, Slug: "deeper", Title: "Deeper post", PostDate: "2023-03-01T10:00:00Z"},
+			map[string]string{"md": "2023/20230301_100000_deeper.md"}, time.Now()))
+		require.NoError(t, nested.Save())
+
+		posts, err := ScanLocalPosts(dir)
+		require.NoError(t, err)
+		require.Len(t, posts, 4)
+		assert.Equal(t, "mirrored", posts[0].Slug)
+		assert.Equal(t, "Mirrored post", posts[0].Title)
+		assert.Equal(t, "html", posts[0].Format)
+		assert.Equal(t, filepath.Join(dir, "example.com", "p", "mirrored", "index.html"), posts[0].Path)
+		assert.Equal(t, "deeper", posts[1].Slug)
+		assert.Equal(t, "Deeper post", posts[1].Title)
+		assert.Equal(t, "nested", posts[2].Slug)
+		assert.Equal(t, "top", posts[3].Slug)
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		_, err := ScanLocalPosts(filepath.Join(tempDir, "does-not-exist"))
+		assert.Error(t, err)
+	})
+}
+
+// Test that the posts downloaded in several formats are found once
+func TestScanLocalPostsSeveralFormats(t *testing.T) {
+	server := createPublicationTestServer(3)
+	defer server.Close()
+
+	dir := t.TempDir()
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = dir
+	opts.Format = "md,html"
+	_, err := NewDownloader(nil, opts).DownloadPublication(context.Background(), server.URL, nil)
+	require.NoError(t, err)
+
+	posts, err := ScanLocalPosts(dir)
+	require.NoError(t, err)
+	require.Len(t, posts, 3)
+	post := posts[2]
+	assert.Equal(t, "post-1", post.Slug)
+	assert.Equal(t, "html", post.Format, "the richest format is read")
+	assert.Equal(t, filepath.Join(dir, "20230101_100000_post-1.html"), post.Path)
+	assert.Equal(t, map[string]string{
+		"html": filepath.Join(dir, "20230101_100000_post-1.html"),
+		"md":   filepath.Join(dir, "20230101_100000_post-1.md"),
+	}, post.Files)
+
+	md, err := post.InFormat("md")
+	require.NoError(t, err)
+	assert.Equal(t, "md", md.Format)
+	assert.Contains(t, md.Content, "# Post 1")
+	assert.Equal(t, post.Title, md.Title)
+	_, err = post.InFormat("txt")
+	assert.Error(t, err)
+
+	// Each post is indexed once
+	idx, err := NewSearchIndex(posts)
+	require.NoError(t, err)
+	defer idx.Close()
+	n, err := idx.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+}
+
+// Test loading a single post file
+func TestLoadLocalPost(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "local-post-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	t.Run("falls back to slug when there is no title", func(t *testing.T) {
+		path := filepath.Join(tempDir, "20230101_100000_no-title.md")
+		require.NoError(t, os.WriteFile(path, []byte("Just some text"), 0644))
+
+		post, err := LoadLocalPost(path)
+		require.NoError(t, err)
+		assert.Equal(t, "no-title", post.Title)
+		assert.Equal(t, "Just some text", post.PlainText())
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := LoadLocalPost(filepath.Join(tempDir, "missing.md"))
+		assert.Error(t, err)
+	})
+}
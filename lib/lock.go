@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LockFile is the name of the lock file created in an output directory while a run writes to it
+const LockFile = ".sbstck-dl.lock"
+
+// ErrLocked is returned by LockDir when another run is writing to the directory
+var ErrLocked = errors.New("output directory is used by another run")
+
+// DirLock prevents two runs from writing to the same output directory at the same time,
+// which would corrupt the manifest and the archive page
+type DirLock struct {
+	path string
+}
+
+// lockOwner is the content of a lock file, identifying the run holding it
+type lockOwner struct {
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// LockDir locks dir for the current run, creating it if needed. A lock left behind by a run
+// of this host that no longer exists, e.g. killed by the system, is taken over.
+func LockDir(dir string) (*DirLock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	owner := lockOwner{PID: os.Getpid(), Host: host, StartedAt: time.Now()}
+	data, err := json.Marshal(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, LockFile)
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.Write(data)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write lock file: %w", err)
+			}
+			return &DirLock{path: path}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock file: %w", err)
+		}
+
+		var holder lockOwner
+		content, readErr := os.ReadFile(path)
+		if readErr == nil {
+			readErr = json.Unmarshal(content, &holder)
+		}
+		if readErr != nil || holder.Host != host || processAlive(holder.PID) {
+			return nil, lockedError(path, holder)
+		}
+		// The run holding the lock is gone
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, lockedError(path, holder)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrLocked, path)
+}
+
+// lockedError explains which run holds the lock and how to release it
+func lockedError(path string, holder lockOwner) error {
+	if holder.PID == 0 {
+		return fmt.Errorf("%w (lock file %s); delete it if no other run is in progress", ErrLocked, path)
+	}
+	return fmt.Errorf("%w: process %d on %s started at %s (lock file %s); delete it if that run is no longer in progress",
+		ErrLocked, holder.PID, holder.Host, holder.StartedAt.Local().Format("2006-01-02 15:04:05"), path)
+}
+
+// Unlock releases the lock
+func (l *DirLock) Unlock() error {
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
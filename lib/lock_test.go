@@ -0,0 +1,64 @@
+package lib
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+
+	lock, err := LockDir(dir)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dir, LockFile))
+
+	// A second run can't write to the directory while the first one holds the lock
+	_, err = LockDir(dir)
+	require.ErrorIs(t, err, ErrLocked)
+	assert.Contains(t, err.Error(), "delete it if that run is no longer in progress")
+
+	require.NoError(t, lock.Unlock())
+	assert.NoFileExists(t, filepath.Join(dir, LockFile))
+
+	lock, err = LockDir(dir)
+	require.NoError(t, err)
+	require.NoError(t, lock.Unlock())
+}
+
+func TestLockDirStale(t *testing.T) {
+	dir := t.TempDir()
+	host, _ := os.Hostname()
+	writeLock := func(owner lockOwner) {
+		data, err := json.Marshal(owner)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, LockFile), data, 0644))
+	}
+
+	// The lock of a process of this host that no longer exists is taken over
+	writeLock(lockOwner{PID: 1 << 30, Host: host, StartedAt: time.Now()})
+	lock, err := LockDir(dir)
+	require.NoError(t, err)
+	require.NoError(t, lock.Unlock())
+
+	// The lock of another host can't be checked, so it is kept
+	writeLock(lockOwner{PID: 1 << 30, Host: host + "-other", StartedAt: time.Now()})
+	_, err = LockDir(dir)
+	require.ErrorIs(t, err, ErrLocked)
+
+	// So is an unreadable lock
+	require.NoError(t, os.WriteFile(filepath.Join(dir, LockFile), []byte("garbage"), 0644))
+	_, err = LockDir(dir)
+	require.ErrorIs(t, err, ErrLocked)
+}
+
+func TestProcessAlive(t *testing.T) {
+	assert.True(t, processAlive(os.Getpid()))
+	assert.False(t, processAlive(1<<30))
+	assert.False(t, processAlive(0))
+}
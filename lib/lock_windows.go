@@ -0,0 +1,39 @@
+//go:build windows
+
+package lib
+
+import (
+	"errors"
+	"syscall"
+)
+
+const (
+	// processQueryLimitedInformation is the access right needed to read the exit code of a
+	// process, granted for the processes of other users too
+	processQueryLimitedInformation = 0x1000
+	// stillActive is the exit code of a process that hasn't exited
+	stillActive = 259
+	// errorInvalidParameter is returned when opening a process that doesn't exist
+	errorInvalidParameter syscall.Errno = 87
+)
+
+// processAlive reports whether a process of this host exists. Processes that can't be
+// checked are assumed to be alive. Signals can't be sent on Windows, so the process is
+// opened to read its exit code, a process having exited staying openable while handles to
+// it remain.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return !errors.Is(err, errorInvalidParameter)
+	}
+	defer syscall.CloseHandle(h)
+
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
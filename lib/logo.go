@@ -0,0 +1,106 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// LogoName is the name, without extension, of the publication logo saved in a download directory
+const LogoName = "logo"
+
+// logoSelectors are the links to the icons of a page, the largest ones first
+var logoSelectors = []string{
+	`link[rel="apple-touch-icon"]`,
+	`link[rel="icon"]`,
+	`link[rel="shortcut icon"]`,
+}
+
+// FindLogoURL returns the URL of the logo of the publication page at pageURL: its touch icon,
+// which Substack sets to the publication logo, or its favicon
+func FindLogoURL(doc *goquery.Document, pageURL string) string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+	for _, selector := range logoSelectors {
+		href, ok := doc.Find(selector).First().Attr("href")
+		if !ok || strings.TrimSpace(href) == "" {
+			continue
+		}
+		if ref, err := url.Parse(strings.TrimSpace(href)); err == nil {
+			return base.ResolveReference(ref).String()
+		}
+	}
+	return base.ResolveReference(&url.URL{Path: "/favicon.ico"}).String()
+}
+
+// DownloadPublicationLogo saves the logo of the publication at pubURL in outputDir as
+// logo{ext} and returns its path. An existing logo is kept.
+func DownloadPublicationLogo(ctx context.Context, fetcher *Fetcher, pubURL, outputDir string) (string, error) {
+	if existing := FindPublicationLogo(outputDir); existing != "" {
+		return existing, nil
+	}
+	if fetcher == nil {
+		fetcher = NewFetcher()
+	}
+
+	page, err := fetcher.FetchURL(ctx, pubURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch publication page: %w", err)
+	}
+	doc, err := goquery.NewDocumentFromReader(page)
+	page.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to parse publication page: %w", err)
+	}
+	logoURL := FindLogoURL(doc, pubURL)
+	if logoURL == "" {
+		return "", fmt.Errorf("no logo found for %s", pubURL)
+	}
+
+	ext := ".png"
+	if u, err := url.Parse(logoURL); err == nil && path.Ext(u.Path) != "" {
+		ext = strings.ToLower(path.Ext(u.Path))
+	}
+	body, err := fetcher.FetchURL(ctx, logoURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download logo: %w", err)
+	}
+	defer body.Close()
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", err
+	}
+	logoPath := filepath.Join(outputDir, LogoName+ext)
+	file, err := os.Create(logoPath)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		os.Remove(logoPath)
+		return "", fmt.Errorf("failed to download logo: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(logoPath)
+		return "", err
+	}
+	return logoPath, nil
+}
+
+// FindPublicationLogo returns the path of the publication logo saved in dir, or "" if there is none
+func FindPublicationLogo(dir string) string {
+	matches, _ := filepath.Glob(filepath.Join(escapeGlob(dir), LogoName+".*"))
+	if len(matches) == 0 {
+		return ""
+	}
+	return matches[0]
+}
@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test finding the logo of a publication page
+func TestFindLogoURL(t *testing.T) {
+	parse := func(page string) *goquery.Document {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+		require.NoError(t, err)
+		return doc
+	}
+
+	doc := parse(`<html><head>
+		<link rel="icon" href="https://cdn.example.com/favicon.png">
+		<link rel="apple-touch-icon" sizes="180x180" href="/img/logo.png">
+	</head></html>`)
+	assert.Equal(t, "https://example.substack.com/img/logo.png", FindLogoURL(doc, "https://example.substack.com/"))
+
+	doc = parse(`<html><head><link rel="icon" href="https://cdn.example.com/favicon.png"></head></html>`)
+	assert.Equal(t, "https://cdn.example.com/favicon.png", FindLogoURL(doc, "https://example.substack.com/"))
+
+	doc = parse(`<html><head></head></html>`)
+	assert.Equal(t, "https://example.substack.com/favicon.ico", FindLogoURL(doc, "https://example.substack.com/"))
+}
+
+// Test downloading the logo of a publication and showing it in the archive page
+func TestDownloadPublicationLogo(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><head><link rel="apple-touch-icon" href="/img/logo.png"></head></html>`))
+		case "/img/logo.png":
+			w.Write([]byte("fake png"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	ctx := context.Background()
+	assert.Empty(t, FindPublicationLogo(dir))
+
+	logoPath, err := DownloadPublicationLogo(ctx, nil, server.URL+"/", dir)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "logo.png"), logoPath)
+	data, err := os.ReadFile(logoPath)
+	require.NoError(t, err)
+	assert.Equal(t, "fake png", string(data))
+	assert.Equal(t, logoPath, FindPublicationLogo(dir))
+
+	// An existing logo is not downloaded again
+	_, err = DownloadPublicationLogo(ctx, nil, server.URL+"/", dir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests)
+
+	archive := NewArchive()
+	archive.AddEntry(Post{Title: "Post", PostDate: "2023-01-01T10:00:00Z"}, filepath.Join(dir, "post.html"), time.Now())
+	archive.Logo = logoPath
+	require.NoError(t, archive.GenerateHTML(dir))
+	page, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(page), `<h1><img src="logo.png" alt="" class="logo">Substack Archive</h1>`)
+
+	require.NoError(t, archive.GenerateMarkdown(dir))
+	page, err = os.ReadFile(filepath.Join(dir, "index.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(page), "# ![Logo](logo.png) Substack Archive")
+
+	// The logo is drawn on the generated cover of books
+	svg := generateCoverSVG(ExportOptions{Title: "Title", Logo: logoPath})
+	assert.Contains(t, svg, `xlink:href="data:image/png;base64,`)
+	assert.NotContains(t, generateCoverSVG(ExportOptions{Title: "Title"}), "<image")
+}
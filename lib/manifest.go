@@ -0,0 +1,409 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ManifestFile is the name of the manifest written in the output directory of a download
+const ManifestFile = "manifest.json"
+
+// manifestVersion is the current version of the manifest format
+const manifestVersion = 1
+
+// Manifest records the posts downloaded into an output directory along with their metadata
+type Manifest struct {
+	Version   int               `json:"version"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Posts     []ManifestEntry   `json:"posts"`
+	Failures  []ManifestFailure `json:"failures,omitempty"`
+	// Pending are the posts of the last run not processed yet, left by an interrupted or
+	// stopped run for the next one to resume with
+	Pending []string `json:"pending,omitempty"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// ManifestEntry holds the metadata of a single downloaded post
+type ManifestEntry struct {
+	Id           int               `json:"id"`
+	Slug         string            `json:"slug"`
+	Title        string            `json:"title"`
+	Subtitle     string            `json:"subtitle,omitempty"`
+	URL          string            `json:"url"`
+	PostDate     string            `json:"post_date"`
+	UpdatedAt    string            `json:"updated_at,omitempty"`
+	Audience     string            `json:"audience,omitempty"`
+	WordCount    int               `json:"wordcount,omitempty"`
+	Extracted    int               `json:"extracted_words,omitempty"` // words of the written body, when checked against WordCount
+	Incomplete   bool              `json:"incomplete,omitempty"`      // far fewer words were written than WordCount, see Post.Incomplete
+	Tags         []string          `json:"tags,omitempty"`
+	Reactions    int               `json:"reactions,omitempty"`
+	Comments     int               `json:"comments,omitempty"`
+	Restacks     int               `json:"restacks,omitempty"`
+	Files        map[string]string `json:"files"`
+	DownloadedAt time.Time         `json:"downloaded_at"`
+	TextHash     string            `json:"text_hash,omitempty"`  // SHA-256 of the canonical text of the post, see Post.TextHash
+	DeletedAt    string            `json:"deleted_at,omitempty"` // when the post was found deleted or unpublished (RFC3339)
+	// PreviousSlugs are the slugs of the post before it was renamed, oldest first. Its files
+	// keep the name they were downloaded with.
+	PreviousSlugs []string `json:"previous_slugs,omitempty"`
+}
+
+// Deleted reports whether the post was deleted or unpublished since it was downloaded
+func (e ManifestEntry) Deleted() bool {
+	return e.DeletedAt != ""
+}
+
+// Post returns the metadata of the entry as a post without body
+func (e ManifestEntry) Post() Post {
+	return Post{
+		Id:           e.Id,
+		Slug:         e.Slug,
+		Title:        e.Title,
+		Subtitle:     e.Subtitle,
+		CanonicalUrl: e.URL,
+		PostDate:     e.PostDate,
+		UpdatedAt:    e.UpdatedAt,
+		Audience:     e.Audience,
+		WordCount:    e.WordCount,
+	}
+}
+
+// Stages at which a post download can fail
+const (
+	FailureDownload    = "download"     // the post couldn't be fetched
+	FailureWrite       = "write"        // the post couldn't be written to disk
+	FailureImages      = "images"       // the post was written but some images or attachments are missing
+	FailurePostProcess = "post-process" // the post was written but a post-processor failed
+	FailureTransform   = "transform"    // the content of the post couldn't be transformed, so it wasn't written
+)
+
+// ManifestFailure records a post that failed to download, with the options of the run,
+// so it can be retried later without downloading everything again
+type ManifestFailure struct {
+	URL      string          `json:"url"`
+	Slug     string          `json:"slug"`
+	Stage    string          `json:"stage"`
+	Error    string          `json:"error"`
+	Options  ManifestOptions `json:"options"`
+	FailedAt time.Time       `json:"failed_at"`
+}
+
+// ManifestOptions are the download options recorded with a failed post
+type ManifestOptions struct {
+	Format            string       `json:"format"`
+	AddSourceURL      bool         `json:"add_source_url,omitempty"`
+	EmailLayout       bool         `json:"email_layout,omitempty"`
+	AccessibleText    bool         `json:"accessible_text,omitempty"`
+	DownloadImages    bool         `json:"download_images,omitempty"`
+	ImageQuality      ImageQuality `json:"image_quality,omitempty"`
+	ImageSizes        []int        `json:"image_sizes,omitempty"`
+	StripImageMeta    bool         `json:"strip_image_metadata,omitempty"`
+	OptimizeImages    bool         `json:"optimize_images,omitempty"`
+	ImagesDir         string       `json:"images_dir,omitempty"`
+	DownloadFiles     bool         `json:"download_files,omitempty"`
+	FileExtensions    []string     `json:"file_extensions,omitempty"`
+	ExcludeExtensions []string     `json:"exclude_file_extensions,omitempty"`
+	FileMaxSize       int64        `json:"file_max_size,omitempty"`
+	MaxFilesPerPost   int          `json:"max_files_per_post,omitempty"`
+	FilesDir          string       `json:"files_dir,omitempty"`
+	ImageErrors       ImageErrors  `json:"image_errors,omitempty"`
+	MediaTemplate     string       `json:"media_template,omitempty"`
+	OriginalFilenames bool         `json:"original_filenames,omitempty"`
+	CreateArchive     bool         `json:"create_archive,omitempty"`
+	ArchiveHeatmap    bool         `json:"archive_heatmap,omitempty"`
+	ReadingOrder      ReadingOrder `json:"reading_order,omitempty"`
+	RelatedPosts      int          `json:"related_posts,omitempty"`
+	Comments          bool         `json:"comments,omitempty"`
+	CommentsFormat    string       `json:"comments_format,omitempty"`
+	KeepRaw           bool         `json:"keep_raw,omitempty"`
+	RawHTML           bool         `json:"raw_html,omitempty"`
+	Mirror            bool         `json:"mirror,omitempty"`
+	ByAuthor          bool         `json:"by_author,omitempty"`
+	KeepVersions      bool         `json:"keep_versions,omitempty"`
+	DownloadAudio     bool         `json:"download_audio,omitempty"`
+	AudioDir          string       `json:"audio_dir,omitempty"`
+	ExecAfter         []string     `json:"exec_after,omitempty"`       // commands of the post-processors
+	IgnoreSelectors   []string     `json:"ignore_selectors,omitempty"` // CSS selectors of the elements removed from the body
+	Transform         []string     `json:"transform,omitempty"`        // commands of the transformers
+	Redact            bool         `json:"redact,omitempty"`
+	PaywallMarker     bool         `json:"paywall_marker,omitempty"`
+}
+
+// NewManifestEntry creates a manifest entry for a post written to the given files.
+// Files maps an output format to the path of the written file.
+func NewManifestEntry(post Post, files map[string]string, downloadedAt time.Time) ManifestEntry {
+	subtitle := post.Subtitle
+	if subtitle == "" {
+		subtitle = post.Description
+	}
+	return ManifestEntry{
+		Id:           post.Id,
+		Slug:         post.Slug,
+		Title:        post.Title,
+		Subtitle:     subtitle,
+		URL:          post.CanonicalUrl,
+		PostDate:     post.PostDate,
+		UpdatedAt:    post.UpdatedAt,
+		Audience:     post.Audience,
+		WordCount:    post.WordCount,
+		Tags:         post.TagNames(),
+		Reactions:    post.ReactionCount,
+		Comments:     post.CommentCount,
+		Restacks:     post.Restacks,
+		Files:        files,
+		DownloadedAt: downloadedAt,
+		TextHash:     post.TextHash(),
+	}
+}
+
+// LoadManifest reads the manifest of the given directory.
+// An empty manifest is returned if the directory doesn't have one yet.
+func LoadManifest(dir string) (*Manifest, error) {
+	m := &Manifest{
+		Version: manifestVersion,
+		Posts:   make([]ManifestEntry, 0),
+		path:    filepath.Join(dir, ManifestFile),
+	}
+
+	data, err := os.ReadFile(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if m.Posts == nil {
+		m.Posts = make([]ManifestEntry, 0)
+	}
+
+	return m, nil
+}
+
+// Path returns the location of the manifest file
+func (m *Manifest) Path() string {
+	return m.path
+}
+
+// Dir returns the directory the manifest belongs to
+func (m *Manifest) Dir() string {
+	return filepath.Dir(m.path)
+}
+
+// ResolvePath turns a file path stored in an entry into a path usable from the working directory
+func (m *Manifest) ResolvePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(m.Dir(), path)
+}
+
+// RelPath turns a path into one relative to the manifest directory, for storing in an entry
+func (m *Manifest) RelPath(path string) string {
+	if rel, err := filepath.Rel(m.Dir(), path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// AddEntry adds an entry to the manifest, replacing any existing entry for the same post
+func (m *Manifest) AddEntry(entry ManifestEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, existing := range m.Posts {
+		if (entry.Id != 0 && existing.Id == entry.Id) || existing.Slug == entry.Slug {
+			entry.PreviousSlugs = slugHistory(existing, entry.Slug)
+			// Keep files written in other formats by previous runs
+			for format, path := range existing.Files {
+				if _, ok := entry.Files[format]; !ok {
+					if entry.Files == nil {
+						entry.Files = make(map[string]string)
+					}
+					entry.Files[format] = path
+				}
+			}
+			m.Posts[i] = entry
+			return
+		}
+	}
+	m.Posts = append(m.Posts, entry)
+}
+
+// slugHistory returns the previous slugs of a post now named slug, given its existing entry
+func slugHistory(existing ManifestEntry, slug string) []string {
+	var history []string
+	for _, previous := range append(existing.PreviousSlugs, existing.Slug) {
+		if previous != slug && !containsString(history, previous) {
+			history = append(history, previous)
+		}
+	}
+	return history
+}
+
+// EntryByID returns the entry of the post with the given ID
+func (m *Manifest) EntryByID(id int) (ManifestEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, entry := range m.Posts {
+		if id != 0 && entry.Id == id {
+			return entry, true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+// hasFile reports whether the post with the given slug has a file in format on disk
+func (m *Manifest) hasFile(slug string, format string) bool {
+	entry, ok := m.Entry(slug)
+	if !ok {
+		return false
+	}
+	file, ok := entry.Files[format]
+	if !ok {
+		return false
+	}
+	_, err := os.Stat(m.ResolvePath(file))
+	return err == nil
+}
+
+// Entry returns the entry of the post with the given slug
+func (m *Manifest) Entry(slug string) (ManifestEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, entry := range m.Posts {
+		if entry.Slug == slug {
+			return entry, true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+// Entries returns a copy of the entries of the manifest
+func (m *Manifest) Entries() []ManifestEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]ManifestEntry(nil), m.Posts...)
+}
+
+// MarkDeleted flags the post with the given slug as deleted at the given time, or unflags it
+// if the time is zero. It reports whether the entry changed.
+func (m *Manifest) MarkDeleted(slug string, at time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deletedAt := ""
+	if !at.IsZero() {
+		deletedAt = at.Format(time.RFC3339)
+	}
+	for i, entry := range m.Posts {
+		if entry.Slug != slug {
+			continue
+		}
+		if entry.Deleted() == (deletedAt != "") {
+			return false
+		}
+		m.Posts[i].DeletedAt = deletedAt
+		return true
+	}
+	return false
+}
+
+// AddFailure records a failed post, replacing any previous failure of the same post
+func (m *Manifest) AddFailure(failure ManifestFailure) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, existing := range m.Failures {
+		if existing.URL == failure.URL {
+			m.Failures[i] = failure
+			return
+		}
+	}
+	m.Failures = append(m.Failures, failure)
+}
+
+// RemoveFailure forgets the failure of a post once it has been downloaded
+func (m *Manifest) RemoveFailure(url string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, existing := range m.Failures {
+		if existing.URL == url {
+			m.Failures = append(m.Failures[:i], m.Failures[i+1:]...)
+			return
+		}
+	}
+}
+
+// SetPending records the posts a run is about to download
+func (m *Manifest) SetPending(urls []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Pending = append([]string(nil), urls...)
+}
+
+// RemovePending forgets a pending post once it has been processed, downloaded or failed
+func (m *Manifest) RemovePending(url string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, pending := range m.Pending {
+		if pending == url {
+			m.Pending = append(m.Pending[:i], m.Pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// PendingURLs returns the posts left to download by the last run
+func (m *Manifest) PendingURLs() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.Pending...)
+}
+
+// Save writes the manifest to disk, sorted by publication date (newest first)
+func (m *Manifest) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sort.SliceStable(m.Posts, func(i, j int) bool {
+		return m.Posts[i].PostDate > m.Posts[j].PostDate
+	})
+	m.Version = manifestVersion
+	m.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted run never leaves a truncated manifest
+	tmpPath := m.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, m.path)
+}
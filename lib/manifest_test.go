@@ -0,0 +1,126 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test manifest loading, updating and saving
+func TestManifest(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "manifest-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	t.Run("missing manifest is empty", func(t *testing.T) {
+		m, err := LoadManifest(tempDir)
+		require.NoError(t, err)
+		assert.Empty(t, m.Posts)
+		assert.Equal(t, filepath.Join(tempDir, ManifestFile), m.Path())
+	})
+
+	t.Run("add, save and reload", func(t *testing.T) {
+		m, err := LoadManifest(tempDir)
+		require.NoError(t, err)
+
+		post := createSamplePost()
+		post.PostDate = "2023-01-01T10:00:00Z"
+		post.Tags = []PostTag{{Id: "1", Name: "Politics", Slug: "politics"}}
+		path := filepath.Join(tempDir, "20230101_100000_test-post.html")
+		m.AddEntry(NewManifestEntry(post, map[string]string{"html": m.RelPath(path)}, time.Now()))
+
+		newer := createSamplePost()
+		newer.Id = 999
+		newer.Slug = "newer-post"
+		newer.PostDate = "2023-02-01T10:00:00Z"
+		m.AddEntry(NewManifestEntry(newer, map[string]string{"html": "newer.html"}, time.Now()))
+
+		require.NoError(t, m.Save())
+		assert.FileExists(t, m.Path())
+
+		loaded, err := LoadManifest(tempDir)
+		require.NoError(t, err)
+		require.Len(t, loaded.Posts, 2)
+		assert.Equal(t, "newer-post", loaded.Posts[0].Slug) // newest first
+
+		entry, ok := loaded.Entry("test-post")
+		require.True(t, ok)
+		assert.Equal(t, "Test Post", entry.Title)
+		assert.Equal(t, []string{"Politics"}, entry.Tags)
+		assert.Equal(t, "20230101_100000_test-post.html", entry.Files["html"])
+		assert.Equal(t, path, loaded.ResolvePath(entry.Files["html"]))
+	})
+
+	t.Run("re-adding a post keeps files of other formats", func(t *testing.T) {
+		m, err := LoadManifest(tempDir)
+		require.NoError(t, err)
+
+		post := createSamplePost()
+		m.AddEntry(NewManifestEntry(post, map[string]string{"md": "test-post.md"}, time.Now()))
+
+		entry, ok := m.Entry("test-post")
+		require.True(t, ok)
+		assert.Len(t, m.Posts, 2)
+		assert.Equal(t, "test-post.md", entry.Files["md"])
+		assert.Equal(t, "20230101_100000_test-post.html", entry.Files["html"])
+	})
+
+	t.Run("renamed post keeps its slug history", func(t *testing.T) {
+		m, err := LoadManifest(t.TempDir())
+		require.NoError(t, err)
+
+		post := Post{Id: 7, Slug: "first-name"}
+		m.AddEntry(NewManifestEntry(post, map[string]string{"html": "first-name.html"}, time.Now()))
+		post.Slug = "second-name"
+		m.AddEntry(NewManifestEntry(post, map[string]string{"html": "first-name.html"}, time.Now()))
+		post.Slug = "first-name"
+		m.AddEntry(NewManifestEntry(post, map[string]string{"html": "first-name.html"}, time.Now()))
+		post.Slug = "third-name"
+		m.AddEntry(NewManifestEntry(post, map[string]string{"html": "first-name.html"}, time.Now()))
+
+		require.Len(t, m.Posts, 1)
+		entry, ok := m.EntryByID(7)
+		require.True(t, ok)
+		assert.Equal(t, "third-name", entry.Slug)
+		assert.Equal(t, []string{"second-name", "first-name"}, entry.PreviousSlugs)
+
+		_, ok = m.EntryByID(8)
+		assert.False(t, ok)
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		m, err := LoadManifest(tempDir)
+		require.NoError(t, err)
+
+		opts := ManifestOptions{Format: "md", DownloadImages: true, ImageQuality: ImageQualityLow}
+		m.AddFailure(ManifestFailure{URL: "https://example.substack.com/p/a", Slug: "a", Stage: FailureDownload, Options: opts})
+		m.AddFailure(ManifestFailure{URL: "https://example.substack.com/p/b", Slug: "b", Stage: FailureDownload, Options: opts})
+		m.AddFailure(ManifestFailure{URL: "https://example.substack.com/p/a", Slug: "a", Stage: FailureImages, Options: opts})
+		require.Len(t, m.Failures, 2)
+		assert.Equal(t, FailureImages, m.Failures[0].Stage)
+		require.NoError(t, m.Save())
+
+		loaded, err := LoadManifest(tempDir)
+		require.NoError(t, err)
+		require.Len(t, loaded.Failures, 2)
+		assert.Equal(t, opts, loaded.Failures[1].Options)
+
+		loaded.RemoveFailure("https://example.substack.com/p/a")
+		loaded.RemoveFailure("https://example.substack.com/p/unknown")
+		require.Len(t, loaded.Failures, 1)
+		assert.Equal(t, "b", loaded.Failures[0].Slug)
+	})
+
+	t.Run("corrupt manifest", func(t *testing.T) {
+		corruptDir := filepath.Join(tempDir, "corrupt")
+		require.NoError(t, os.MkdirAll(corruptDir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(corruptDir, ManifestFile), []byte("{not json"), 0644))
+
+		_, err := LoadManifest(corruptDir)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,200 @@
+package lib
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	mdHeadingPattern     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdRulePattern        = regexp.MustCompile(`^\s*([-*_])(\s*([-*_])){2,}\s*$`)
+	mdUnorderedPattern   = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	mdOrderedPattern     = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	mdImagePattern       = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)(?:\s+"([^"]*)")?\)`)
+	mdLinkPattern        = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)(?:\s+"([^"]*)")?\)`)
+	mdBoldPattern        = regexp.MustCompile(`(\*\*|__)(\S(?:.*?\S)?)(\*\*|__)`)
+	mdItalicPattern      = regexp.MustCompile(`(^|[^\w*])[*_](\S(?:.*?\S)?)[*_]($|[^\w*])`)
+	mdStrikePattern      = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	mdCodeSpanPattern    = regexp.MustCompile("`([^`]+)`")
+	mdEscapePattern      = regexp.MustCompile(`\\([\\` + "`" + `*_{}\[\]()#+\-.!<>|~])`)
+	mdPlaceholderPattern = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// MarkdownToHTML renders the Markdown produced by the download command back to HTML.
+// It supports the common subset of Markdown: headings, paragraphs, emphasis, links, images,
+// inline code, code blocks, blockquotes, lists and horizontal rules.
+func MarkdownToHTML(src string) string {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	var out strings.Builder
+	renderMarkdownBlocks(&out, lines)
+	return strings.TrimSpace(out.String())
+}
+
+// renderMarkdownBlocks renders a sequence of lines as block elements
+func renderMarkdownBlocks(out *strings.Builder, lines []string) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			i++
+
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence := trimmed[:3]
+			var code []string
+			i++
+			for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+				code = append(code, lines[i])
+				i++
+			}
+			i++ // closing fence
+			out.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+
+		case mdHeadingPattern.MatchString(trimmed):
+			m := mdHeadingPattern.FindStringSubmatch(trimmed)
+			level := string(rune('0' + len(m[1])))
+			out.WriteString("<h" + level + ">" + renderMarkdownInline(m[2]) + "</h" + level + ">\n")
+			i++
+
+		case mdRulePattern.MatchString(trimmed):
+			out.WriteString("<hr/>\n")
+			i++
+
+		case strings.HasPrefix(trimmed, ">"):
+			var quote []string
+			for i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">") {
+				q := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quote = append(quote, strings.TrimPrefix(q, " "))
+				i++
+			}
+			out.WriteString("<blockquote>\n")
+			renderMarkdownBlocks(out, quote)
+			out.WriteString("</blockquote>\n")
+
+		case mdUnorderedPattern.MatchString(line) && !mdRulePattern.MatchString(line):
+			i = renderMarkdownList(out, lines, i, "ul", mdUnorderedPattern)
+
+		case mdOrderedPattern.MatchString(line):
+			i = renderMarkdownList(out, lines, i, "ol", mdOrderedPattern)
+
+		default:
+			var para []string
+			for i < len(lines) && isMarkdownParagraphLine(lines[i]) {
+				para = append(para, lines[i])
+				i++
+			}
+			out.WriteString("<p>" + renderMarkdownParagraph(para) + "</p>\n")
+		}
+	}
+}
+
+// renderMarkdownList renders consecutive list items starting at line i and returns the next line
+func renderMarkdownList(out *strings.Builder, lines []string, i int, tag string, pattern *regexp.Regexp) int {
+	out.WriteString("<" + tag + ">\n")
+	for i < len(lines) {
+		m := pattern.FindStringSubmatch(lines[i])
+		if m == nil {
+			break
+		}
+		item := []string{m[1]}
+		i++
+		// Indented continuation lines belong to the item
+		for i < len(lines) && strings.TrimSpace(lines[i]) != "" &&
+			(strings.HasPrefix(lines[i], " ") || strings.HasPrefix(lines[i], "\t")) &&
+			!pattern.MatchString(lines[i]) {
+			item = append(item, strings.TrimSpace(lines[i]))
+			i++
+		}
+		out.WriteString("<li>" + renderMarkdownParagraph(item) + "</li>\n")
+
+		// Allow a single blank line between items of the same list
+		if i+1 < len(lines) && strings.TrimSpace(lines[i]) == "" && pattern.MatchString(lines[i+1]) {
+			i++
+		}
+	}
+	out.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// isMarkdownParagraphLine reports whether a line continues a paragraph
+func isMarkdownParagraphLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" {
+		return false
+	}
+	return !mdHeadingPattern.MatchString(trimmed) &&
+		!mdRulePattern.MatchString(trimmed) &&
+		!strings.HasPrefix(trimmed, ">") &&
+		!strings.HasPrefix(trimmed, "```") &&
+		!strings.HasPrefix(trimmed, "~~~") &&
+		!mdUnorderedPattern.MatchString(line) &&
+		!mdOrderedPattern.MatchString(line)
+}
+
+// renderMarkdownParagraph joins the lines of a paragraph, turning hard breaks
+// (two trailing spaces or a trailing backslash) into <br/>
+func renderMarkdownParagraph(lines []string) string {
+	parts := make([]string, len(lines))
+	for i, line := range lines {
+		hardBreak := strings.HasSuffix(line, "  ") || strings.HasSuffix(line, "\\")
+		line = strings.TrimSpace(strings.TrimSuffix(strings.TrimRight(line, " "), "\\"))
+		parts[i] = renderMarkdownInline(line)
+		if hardBreak && i < len(lines)-1 {
+			parts[i] += "<br/>"
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// renderMarkdownInline renders the inline elements of a line of text
+func renderMarkdownInline(text string) string {
+	if text == "" {
+		return ""
+	}
+
+	// Rendered fragments are replaced by placeholders so later steps don't touch them
+	var fragments []string
+	hold := func(fragment string) string {
+		fragments = append(fragments, fragment)
+		return "\x00" + strconv.Itoa(len(fragments)-1) + "\x00"
+	}
+
+	text = mdCodeSpanPattern.ReplaceAllStringFunc(text, func(s string) string {
+		return hold("<code>" + html.EscapeString(mdCodeSpanPattern.FindStringSubmatch(s)[1]) + "</code>")
+	})
+	text = mdEscapePattern.ReplaceAllStringFunc(text, func(s string) string {
+		return hold(html.EscapeString(s[1:]))
+	})
+	text = mdImagePattern.ReplaceAllStringFunc(text, func(s string) string {
+		m := mdImagePattern.FindStringSubmatch(s)
+		img := `<img src="` + html.EscapeString(m[2]) + `" alt="` + html.EscapeString(m[1]) + `"`
+		if m[3] != "" {
+			img += ` title="` + html.EscapeString(m[3]) + `"`
+		}
+		return hold(img + "/>")
+	})
+
+	text = mdLinkPattern.ReplaceAllStringFunc(text, func(s string) string {
+		m := mdLinkPattern.FindStringSubmatch(s)
+		link := `<a href="` + html.EscapeString(m[2]) + `"`
+		if m[3] != "" {
+			link += ` title="` + html.EscapeString(m[3]) + `"`
+		}
+		// The link text keeps going through the inline rendering
+		return hold(link+">") + m[1] + hold("</a>")
+	})
+
+	text = html.EscapeString(text)
+
+	text = mdBoldPattern.ReplaceAllString(text, "<strong>$2</strong>")
+	text = mdStrikePattern.ReplaceAllString(text, "<del>$1</del>")
+	text = mdItalicPattern.ReplaceAllString(text, "$1<em>$2</em>$3")
+
+	return mdPlaceholderPattern.ReplaceAllStringFunc(text, func(s string) string {
+		n, _ := strconv.Atoi(mdPlaceholderPattern.FindStringSubmatch(s)[1])
+		return fragments[n]
+	})
+}
@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test MarkdownToHTML
+func TestMarkdownToHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "heading and paragraph",
+			input:    "# Title\n\nFirst line\nsecond line",
+			expected: "<h1>Title</h1>\n<p>First line\nsecond line</p>",
+		},
+		{
+			name:     "emphasis",
+			input:    "Some **bold**, *italic*, _also italic_ and ~~struck~~ text",
+			expected: "<p>Some <strong>bold</strong>, <em>italic</em>, <em>also italic</em> and <del>struck</del> text</p>",
+		},
+		{
+			name:     "links and images",
+			input:    `See [the post](https://example.com/p/a?x=1&y=2 "Title") ![A cat](images/cat.jpg)`,
+			expected: `<p>See <a href="https://example.com/p/a?x=1&amp;y=2" title="Title">the post</a> <img src="images/cat.jpg" alt="A cat"/></p>`,
+		},
+		{
+			name:     "linked image",
+			input:    "[![alt](images/a.png)](https://example.com)",
+			expected: `<p><a href="https://example.com"><img src="images/a.png" alt="alt"/></a></p>`,
+		},
+		{
+			name:     "html is escaped",
+			input:    "1 < 2 & <script>",
+			expected: "<p>1 &lt; 2 &amp; &lt;script&gt;</p>",
+		},
+		{
+			name:     "escaped characters and inline code",
+			input:    "Not \\*emphasis\\* and `a *b* <c>`",
+			expected: "<p>Not *emphasis* and <code>a *b* &lt;c&gt;</code></p>",
+		},
+		{
+			name:     "code block",
+			input:    "```go\nfunc main() {\n\tfmt.Println(\"<hi>\")\n}\n```",
+			expected: "<pre><code>func main() {\n\tfmt.Println(&#34;&lt;hi&gt;&#34;)\n}</code></pre>",
+		},
+		{
+			name:     "blockquote",
+			input:    "> quoted **text**\n> more",
+			expected: "<blockquote>\n<p>quoted <strong>text</strong>\nmore</p>\n</blockquote>",
+		},
+		{
+			name:     "lists",
+			input:    "- one\n- two\n\n1. first\n2. second",
+			expected: "<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n<ol>\n<li>first</li>\n<li>second</li>\n</ol>",
+		},
+		{
+			name:     "horizontal rule",
+			input:    "above\n\n* * *\n\nbelow",
+			expected: "<p>above</p>\n<hr/>\n<p>below</p>",
+		},
+		{
+			name:     "hard line break",
+			input:    "line one  \nline two",
+			expected: "<p>line one<br/>\nline two</p>",
+		},
+		{
+			name:     "many inline elements",
+			input:    "`a` `b` `c` `d` `e` `f` `g` `h` `i` `j` `k` `l`",
+			expected: "<p><code>a</code> <code>b</code> <code>c</code> <code>d</code> <code>e</code> <code>f</code> <code>g</code> <code>h</code> <code>i</code> <code>j</code> <code>k</code> <code>l</code></p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, MarkdownToHTML(tt.input))
+		})
+	}
+}
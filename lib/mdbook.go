@@ -0,0 +1,128 @@
+package lib
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// MarkdownBook is a single Markdown document made of chapters, with a title page and a table
+// of contents, as a plain text alternative to EPUB and PDF books
+type MarkdownBook struct {
+	Title      string
+	Subtitle   string
+	Author     string
+	CoverImage string // path of the cover image, if any
+	chapters   []markdownChapter
+}
+
+type markdownChapter struct {
+	Title string
+	HTML  string // with the local images referenced by their absolute path
+}
+
+// NewMarkdownBook creates an empty book with the given title
+func NewMarkdownBook(title string) *MarkdownBook {
+	return &MarkdownBook{Title: title}
+}
+
+// AddChapter adds a chapter from an HTML fragment. Images referenced with a relative path
+// are read from baseDir; they are linked from the book rather than embedded in it.
+func (b *MarkdownBook) AddChapter(title string, htmlContent string, baseDir string) error {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	if err != nil {
+		return fmt.Errorf("failed to parse chapter %q: %w", title, err)
+	}
+
+	doc.Find("script, noscript, iframe, form, input, button, style, link, meta").Remove()
+	doc.Find("img").Each(func(i int, img *goquery.Selection) {
+		img.RemoveAttr("srcset")
+		if src, ok := img.Attr("src"); ok && isLocalReference(src) {
+			if abs, err := filepath.Abs(filepath.Join(baseDir, filepath.FromSlash(src))); err == nil {
+				img.SetAttr("src", abs)
+			}
+		}
+	})
+
+	body, err := doc.Find("body").Html()
+	if err != nil {
+		return fmt.Errorf("failed to render chapter %q: %w", title, err)
+	}
+	b.chapters = append(b.chapters, markdownChapter{Title: title, HTML: body})
+	return nil
+}
+
+// ChapterCount returns the number of chapters of the book
+func (b *MarkdownBook) ChapterCount() int {
+	return len(b.chapters)
+}
+
+// WriteFile writes the book to filePath, the local images being linked relatively to it
+func (b *MarkdownBook) WriteFile(filePath string) error {
+	dir, err := filepath.Abs(filepath.Dir(filePath))
+	if err != nil {
+		return err
+	}
+	relative := func(path string) string {
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			return filepath.ToSlash(rel)
+		}
+		return filepath.ToSlash(path)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# " + b.Title + "\n\n")
+	if b.Subtitle != "" {
+		sb.WriteString("*" + b.Subtitle + "*\n\n")
+	}
+	if b.Author != "" {
+		sb.WriteString(b.Author + "\n\n")
+	}
+	if b.CoverImage != "" {
+		if abs, err := filepath.Abs(b.CoverImage); err == nil {
+			sb.WriteString("![Cover](" + relative(abs) + ")\n\n")
+		}
+	}
+
+	sb.WriteString("## Contents\n\n")
+	for i, chapter := range b.chapters {
+		sb.WriteString(fmt.Sprintf("%d. %s\n", i+1, chapter.Title))
+	}
+
+	for _, chapter := range b.chapters {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(chapter.HTML))
+		if err != nil {
+			return fmt.Errorf("failed to parse chapter %q: %w", chapter.Title, err)
+		}
+		doc.Find("img").Each(func(i int, img *goquery.Selection) {
+			if src, ok := img.Attr("src"); ok && filepath.IsAbs(src) {
+				img.SetAttr("src", relative(src))
+			}
+		})
+		body, err := doc.Find("body").Html()
+		if err != nil {
+			return fmt.Errorf("failed to render chapter %q: %w", chapter.Title, err)
+		}
+		content, err := mdConverter.ConvertString(body)
+		if err != nil {
+			return fmt.Errorf("failed to convert chapter %q: %w", chapter.Title, err)
+		}
+		sb.WriteString("\n---\n\n" + strings.TrimSpace(content) + "\n")
+	}
+
+	return os.WriteFile(filePath, []byte(sb.String()), 0644)
+}
+
+// isLocalReference reports whether src refers to a file relative to the page, rather than a
+// URL or an inline image
+func isLocalReference(src string) bool {
+	if src == "" || strings.HasPrefix(src, "/") || strings.HasPrefix(src, "#") {
+		return false
+	}
+	u, err := url.Parse(src)
+	return err == nil && u.Scheme == ""
+}
@@ -0,0 +1,44 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test writing a Markdown book linking the local images of its chapters
+func TestMarkdownBook(t *testing.T) {
+	dir := t.TempDir()
+	postsDir := filepath.Join(dir, "posts")
+	require.NoError(t, os.MkdirAll(filepath.Join(postsDir, "images"), 0755))
+
+	book := NewMarkdownBook("My Book")
+	book.Author = "Jane Doe"
+	require.NoError(t, book.AddChapter("One", `<h1>One</h1><p>Text</p><img src="images/one.png" alt="one"><img src="https://example.com/two.png">`, postsDir))
+	require.NoError(t, book.AddChapter("Two", `<h1>Two</h1><script>alert(1)</script>`, postsDir))
+	assert.Equal(t, 2, book.ChapterCount())
+
+	path := filepath.Join(dir, "books", "book.md")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, book.WriteFile(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	content := string(data)
+	assert.Contains(t, content, "# My Book\n\nJane Doe\n\n## Contents\n\n1. One\n2. Two\n")
+	assert.Contains(t, content, "../posts/images/one.png")
+	assert.Contains(t, content, "https://example.com/two.png")
+	assert.NotContains(t, content, "alert(1)")
+}
+
+func TestIsLocalReference(t *testing.T) {
+	assert.True(t, isLocalReference("images/one.png"))
+	assert.True(t, isLocalReference("../images/one.png"))
+	assert.False(t, isLocalReference("https://example.com/one.png"))
+	assert.False(t, isLocalReference("data:image/png;base64,AAAA"))
+	assert.False(t, isLocalReference("/images/one.png"))
+	assert.False(t, isLocalReference(""))
+}
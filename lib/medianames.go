@@ -0,0 +1,106 @@
+package lib
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// DefaultMediaTemplate is the naming template giving the default path of the images and files
+// of a post, relative to the images or files directory
+const DefaultMediaTemplate = "{{.PostSlug}}/{{.Basename}}"
+
+// unsafeFilenameChars matches the characters that can't be used in filenames on every system
+var unsafeFilenameChars = regexp.MustCompile(`[<>:"/\\|?*]`)
+
+// MediaName is what the path of a downloaded image or file is made of in a naming template
+type MediaName struct {
+	PostSlug string // slug of the post the media belongs to
+	Index    int    // position of the media among the images, or the files, of the post, from 1
+	Basename string // filename of the media, e.g. photo.jpg
+	Name     string // Basename without its extension, e.g. photo
+	Ext      string // extension of Basename with its dot, e.g. .jpg
+	Hash     string // short hash of the URL of the media
+}
+
+// MediaNaming decides the paths the images and files of posts are written to
+type MediaNaming struct {
+	Template *template.Template // path of each media, DefaultMediaTemplate if nil
+	// OriginalNames names attachments after the filename they were uploaded with, as sent by
+	// the server, rather than after their URL
+	OriginalNames bool
+}
+
+// ParseMediaTemplate parses a naming template such as {{.PostSlug}}/{{.Index}}-{{.Basename}},
+// whose fields are the ones of MediaName
+func ParseMediaTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("media").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid media naming template: %w", err)
+	}
+	// Report unknown fields now rather than at the first media
+	sample := newMediaName("post", 1, "https://example.com/image.jpg", "image.jpg")
+	if err := tmpl.Execute(io.Discard, sample); err != nil {
+		return nil, fmt.Errorf("invalid media naming template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// newMediaName returns the MediaName of the index-th media of a post, downloaded from mediaURL as basename
+func newMediaName(postSlug string, index int, mediaURL, basename string) MediaName {
+	ext := filepath.Ext(basename)
+	sum := sha1.Sum([]byte(mediaURL))
+	return MediaName{
+		PostSlug: postSlug,
+		Index:    index,
+		Basename: basename,
+		Name:     strings.TrimSuffix(basename, ext),
+		Ext:      ext,
+		Hash:     hex.EncodeToString(sum[:])[:8],
+	}
+}
+
+// Path returns the path of a media relative to the images or files directory. Each segment of
+// a templated path is made safe for the filesystem, and ".." segments are dropped so that the
+// media stays in the directory.
+func (n MediaNaming) Path(name MediaName) (string, error) {
+	if n.Template == nil {
+		return filepath.Join(name.PostSlug, name.Basename), nil
+	}
+
+	var sb strings.Builder
+	if err := n.Template.Execute(&sb, name); err != nil {
+		return "", fmt.Errorf("failed to name media: %w", err)
+	}
+	var segments []string
+	for _, segment := range strings.FieldsFunc(sb.String(), func(r rune) bool { return r == '/' || r == '\\' }) {
+		segment = strings.TrimSpace(unsafeFilenameChars.ReplaceAllString(segment, "_"))
+		if segment == "" || segment == "." || segment == ".." {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	if len(segments) == 0 {
+		return "", fmt.Errorf("media naming template gives an empty path for %s", name.Basename)
+	}
+	return filepath.Join(segments...), nil
+}
+
+type mediaNamingKey struct{}
+
+// WithMediaNaming returns a context naming the media downloaded with it by naming,
+// for ImageDownloaders and FileDownloaders created deeper in the call stack
+func WithMediaNaming(ctx context.Context, naming MediaNaming) context.Context {
+	return context.WithValue(ctx, mediaNamingKey{}, naming)
+}
+
+func mediaNamingFromContext(ctx context.Context) MediaNaming {
+	naming, _ := ctx.Value(mediaNamingKey{}).(MediaNaming)
+	return naming
+}
@@ -0,0 +1,116 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMediaTemplate(t *testing.T) {
+	_, err := ParseMediaTemplate("{{.PostSlug}}/{{.Index}}-{{.Basename}}")
+	assert.NoError(t, err)
+	_, err = ParseMediaTemplate(`{{printf "%03d" .Index}}{{.Ext}}`)
+	assert.NoError(t, err)
+
+	_, err = ParseMediaTemplate("{{.PostSlug")
+	assert.Error(t, err)
+	_, err = ParseMediaTemplate("{{.Unknown}}")
+	assert.Error(t, err)
+}
+
+func TestMediaNamingPath(t *testing.T) {
+	name := newMediaName("my-post", 3, "https://example.com/a/photo.jpg", "photo.jpg")
+	assert.Equal(t, "photo", name.Name)
+	assert.Equal(t, ".jpg", name.Ext)
+	assert.Len(t, name.Hash, 8)
+
+	t.Run("default", func(t *testing.T) {
+		path, err := MediaNaming{}.Path(name)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join("my-post", "photo.jpg"), path)
+	})
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{"{{.PostSlug}}/{{.Index}}-{{.Basename}}", filepath.Join("my-post", "3-photo.jpg")},
+		{`{{.PostSlug}}-{{printf "%02d" .Index}}{{.Ext}}`, "my-post-03.jpg"},
+		{"{{.Hash}}{{.Ext}}", name.Hash + ".jpg"},
+		{"../../{{.Basename}}", "photo.jpg"},
+		{"{{.PostSlug}}//./{{.Name}}?{{.Ext}}", filepath.Join("my-post", "photo_.jpg")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			tmpl, err := ParseMediaTemplate(tt.template)
+			require.NoError(t, err)
+			path, err := MediaNaming{Template: tmpl}.Path(name)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, path)
+		})
+	}
+
+	t.Run("empty path", func(t *testing.T) {
+		tmpl, err := ParseMediaTemplate("../")
+		require.NoError(t, err)
+		_, err = MediaNaming{Template: tmpl}.Path(name)
+		assert.Error(t, err)
+	})
+}
+
+func TestNamedMediaDownloads(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/files/download" {
+			w.Header().Set("Content-Disposition", `attachment; filename="Annual Report.pdf"`)
+		}
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	tmpl, err := ParseMediaTemplate("{{.PostSlug}}/{{.Index}}-{{.Basename}}")
+	require.NoError(t, err)
+	naming := MediaNaming{Template: tmpl}
+	ctx := context.Background()
+
+	t.Run("image", func(t *testing.T) {
+		tempDir := t.TempDir()
+		downloader := NewImageDownloader(NewFetcher(WithRatePerSecond(100)), tempDir, "images", ImageQualityHigh)
+
+		info := downloader.downloadNamedImage(ctx, server.URL+"/img/photo.png", "my-post", 2, naming)
+		require.NoError(t, info.Error)
+		assert.True(t, info.Success)
+		assert.Equal(t, filepath.Join(tempDir, "images", "my-post", "2-photo.png"), info.LocalPath)
+		assert.FileExists(t, info.LocalPath)
+	})
+
+	t.Run("file", func(t *testing.T) {
+		tempDir := t.TempDir()
+		downloader := NewFileDownloader(NewFetcher(WithRatePerSecond(100)), tempDir, "files", nil)
+
+		info := downloader.downloadNamedFile(ctx, server.URL+"/files/report.pdf", "report.pdf", "my-post", 1, naming)
+		require.NoError(t, info.Error)
+		assert.Equal(t, filepath.Join(tempDir, "files", "my-post", "1-report.pdf"), info.LocalPath)
+		assert.Equal(t, "1-report.pdf", info.Filename)
+		data, err := os.ReadFile(info.LocalPath)
+		require.NoError(t, err)
+		assert.Equal(t, "content", string(data))
+	})
+
+	t.Run("original filenames", func(t *testing.T) {
+		downloader := NewFileDownloader(NewFetcher(WithRatePerSecond(100)), t.TempDir(), "files", nil)
+
+		// The name sent by the server wins over the one of the URL, even with an extension
+		downloadURL := server.URL + "/files/download?filename=file.pdf"
+		assert.Equal(t, "Annual Report.pdf", downloader.originalFilename(ctx, downloadURL, "file.pdf"))
+		assert.Equal(t, "file.pdf", downloader.resolveFilename(ctx, downloadURL, "file.pdf"))
+
+		// Without a name from the server, the one of the URL is kept
+		assert.Equal(t, "other.pdf", downloader.originalFilename(ctx, server.URL+"/files/other.pdf", "other.pdf"))
+	})
+}
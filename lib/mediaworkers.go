@@ -0,0 +1,95 @@
+package lib
+
+import (
+	"context"
+	"sync"
+)
+
+// MediaWorkers is the number of images and of attachments of a post downloaded at once.
+// Values below 1 download them one at a time. Requests still follow the rate of the Fetcher.
+type MediaWorkers struct {
+	Images int
+	Files  int
+}
+
+type mediaWorkersKey struct{}
+
+// withMediaWorkers returns a context downloading the media of posts with the given workers
+func withMediaWorkers(ctx context.Context, workers MediaWorkers) context.Context {
+	return context.WithValue(ctx, mediaWorkersKey{}, workers)
+}
+
+// mediaWorkersFromContext returns the workers downloading the media with ctx, if any
+func mediaWorkersFromContext(ctx context.Context) MediaWorkers {
+	workers, _ := ctx.Value(mediaWorkersKey{}).(MediaWorkers)
+	return workers
+}
+
+// forEachConcurrently calls fn for each index below n on up to workers goroutines, and
+// returns once all calls are done. No call is started once ctx is done.
+func forEachConcurrently(ctx context.Context, n, workers int, fn func(i int)) {
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n && ctx.Err() == nil; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// mediaPathLocks serializes the downloads to the same local path, e.g. two images of a post
+// with the same file name, so that they don't write the same file at once
+var mediaPathLocks = &pathLocks{locks: make(map[string]*pathLock)}
+
+// pathLocks are mutexes by path, dropped once no one holds or waits for them
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+type pathLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks path and returns the function unlocking it
+func (l *pathLocks) lock(path string) func() {
+	l.mu.Lock()
+	lock, ok := l.locks[path]
+	if !ok {
+		lock = &pathLock{}
+		l.locks[path] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, path)
+		}
+		l.mu.Unlock()
+	}
+}
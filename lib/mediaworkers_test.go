@@ -0,0 +1,130 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForEachConcurrently(t *testing.T) {
+	var running, maxRunning int32
+	var calls [10]int32
+	forEachConcurrently(context.Background(), 10, 3, func(i int) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&calls[i], 1)
+		atomic.AddInt32(&running, -1)
+	})
+	for i := range calls {
+		assert.Equal(t, int32(1), calls[i])
+	}
+	assert.Equal(t, int32(3), maxRunning)
+
+	// No call is started once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	started := 0
+	forEachConcurrently(ctx, 10, 1, func(i int) {
+		started++
+		cancel()
+	})
+	assert.Equal(t, 1, started)
+}
+
+func TestPathLocks(t *testing.T) {
+	locks := &pathLocks{locks: make(map[string]*pathLock)}
+	unlock := locks.lock("a")
+
+	locked := make(chan struct{})
+	go func() {
+		defer locks.lock("a")()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("the path was locked twice")
+	case <-time.After(20 * time.Millisecond):
+	}
+	locks.lock("b")()
+
+	unlock()
+	<-locked
+	// The locks are dropped once released
+	assert.Eventually(t, func() bool {
+		locks.mu.Lock()
+		defer locks.mu.Unlock()
+		return len(locks.locks) == 0
+	}, time.Second, time.Millisecond)
+}
+
+// createConcurrencyServer returns a server answering after a pause, recording the highest
+// number of requests it served at once
+func createConcurrencyServer(maxInFlight *int32) *httptest.Server {
+	var inFlight int32
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		mu.Lock()
+		if n > *maxInFlight {
+			*maxInFlight = n
+		}
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(testImageData)
+	}))
+}
+
+func TestDownloadMediaWorkers(t *testing.T) {
+	var maxInFlight int32
+	server := createConcurrencyServer(&maxInFlight)
+	defer server.Close()
+
+	var content string
+	for i := 1; i <= 4; i++ {
+		content += fmt.Sprintf(`<img src="%s/image%d.png">`, server.URL, i)
+		content += fmt.Sprintf(`<a class="file-embed-button wide" href="%s/file%d.pdf">File</a>`, server.URL, i)
+	}
+	fetcher := NewFetcher(WithRatePerSecond(100))
+	ctx := withMediaWorkers(context.Background(), MediaWorkers{Images: 4, Files: 1})
+
+	images, err := NewImageDownloader(fetcher, t.TempDir(), "images", ImageQualityHigh).DownloadImages(ctx, content, "post")
+	require.NoError(t, err)
+	assert.Equal(t, 4, images.Success)
+	assert.Greater(t, maxInFlight, int32(1))
+	// The images are reported in the order of the post
+	for i, image := range images.Images {
+		assert.Equal(t, fmt.Sprintf("%s/image%d.png", server.URL, i+1), image.OriginalURL)
+	}
+
+	maxInFlight = 0
+	files, err := NewFileDownloader(fetcher, t.TempDir(), "files", nil).DownloadFiles(ctx, content, "post")
+	require.NoError(t, err)
+	assert.Equal(t, 4, files.Success)
+	assert.Equal(t, int32(1), maxInFlight)
+
+	maxInFlight = 0
+	downloader := NewFileDownloader(fetcher, t.TempDir(), "files", nil)
+	downloader.Workers = 4
+	files, err = downloader.DownloadFiles(ctx, content, "post")
+	require.NoError(t, err)
+	assert.Equal(t, 4, files.Success)
+	assert.Greater(t, maxInFlight, int32(1))
+	for i, file := range files.Files {
+		assert.Equal(t, fmt.Sprintf("file%d.pdf", i+1), file.Filename)
+	}
+}
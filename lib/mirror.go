@@ -0,0 +1,54 @@
+package lib
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// MirrorPostPath returns the path a post is written to in mirror mode, replicating
+// the URL of the post: {outputDir}/{host}/p/{slug}/index.{format}
+func MirrorPostPath(postURL string, outputDir string, format string) string {
+	host := "unknown"
+	slug := SlugFromURL(postURL)
+	if u, err := url.Parse(postURL); err == nil {
+		if u.Hostname() != "" {
+			host = strings.ToLower(u.Hostname())
+		}
+		slug = SlugFromURL(strings.TrimSuffix(u.Path, "/"))
+	}
+	return filepath.Join(outputDir, host, "p", slug, "index."+format)
+}
+
+// FilterExistingMirrorPosts filters out the posts already written to their mirror path
+func FilterExistingMirrorPosts(urls []string, outputDir string, format string) []string {
+	var filtered []string
+	for _, u := range urls {
+		if _, err := os.Stat(MirrorPostPath(u, outputDir, format)); err != nil {
+			filtered = append(filtered, u)
+		}
+	}
+	return filtered
+}
+
+// mirrorLinkRegex matches the href attributes linking to a post, capturing the host, the slug
+// and the fragment of the link
+var mirrorLinkRegex = regexp.MustCompile(`href="(?:https?://([^/"]+))?/p/([\w-]+)/?(?:\?[^"#]*)?(#[^"]*)?"`)
+
+// MirrorLinks rewrites the links of HTML content to the posts of the publication at postURL
+// into relative links between mirror paths, e.g. href="../other-post/index.html"
+func MirrorLinks(content string, postURL string, format string) string {
+	u, err := url.Parse(postURL)
+	if err != nil || u.Host == "" {
+		return content
+	}
+	return mirrorLinkRegex.ReplaceAllStringFunc(content, func(link string) string {
+		match := mirrorLinkRegex.FindStringSubmatch(link)
+		if match[1] != "" && !strings.EqualFold(match[1], u.Host) {
+			return link
+		}
+		return `href="../` + match[2] + "/index." + format + match[3] + `"`
+	})
+}
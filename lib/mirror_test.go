@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the mirror paths of posts
+func TestMirrorPostPath(t *testing.T) {
+	assert.Equal(t, filepath.Join("out", "example.substack.com", "p", "my-post", "index.html"),
+		MirrorPostPath("https://Example.substack.com/p/my-post", "out", "html"))
+	assert.Equal(t, filepath.Join("out", "example.com", "p", "my-post", "index.md"),
+		MirrorPostPath("https://example.com/p/my-post/?utm_source=x", "out", "md"))
+
+	tempDir := t.TempDir()
+	existing := MirrorPostPath("https://example.com/p/existing", tempDir, "html")
+	require.NoError(t, os.MkdirAll(filepath.Dir(existing), 0755))
+	require.NoError(t, os.WriteFile(existing, []byte("x"), 0644))
+
+	urls := []string{"https://example.com/p/existing", "https://example.com/p/missing"}
+	assert.Equal(t, []string{"https://example.com/p/missing"}, FilterExistingMirrorPosts(urls, tempDir, "html"))
+	assert.Equal(t, urls, FilterExistingMirrorPosts(urls, tempDir, "md"))
+}
+
+// Test rewriting the links between posts
+func TestMirrorLinks(t *testing.T) {
+	content := `<a href="https://example.com/p/other-post">a</a>` +
+		`<a href="/p/second?utm_source=x#section">b</a>` +
+		`<a href="https://other.substack.com/p/elsewhere">c</a>` +
+		`<a href="https://example.com/about">d</a>`
+
+	assert.Equal(t, `<a href="../other-post/index.html">a</a>`+
+		`<a href="../second/index.html#section">b</a>`+
+		`<a href="https://other.substack.com/p/elsewhere">c</a>`+
+		`<a href="https://example.com/about">d</a>`,
+		MirrorLinks(content, "https://example.com/p/my-post", "html"))
+
+	assert.Equal(t, `<a href="../other-post/index.md">a</a>`,
+		MirrorLinks(`<a href="https://EXAMPLE.com/p/other-post/">a</a>`, "https://example.com/p/my-post", "md"))
+	assert.Equal(t, content, MirrorLinks(content, "", "html"))
+}
+
+// Test downloading a publication as a mirror
+func TestDownloaderMirror(t *testing.T) {
+	server := createPublicationTestServer(2)
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = t.TempDir()
+	opts.Mirror = true
+	downloader := NewDownloader(nil, opts)
+
+	summary, err := downloader.DownloadPublication(context.Background(), server.URL, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, summary.Downloaded)
+	assert.FileExists(t, filepath.Join(opts.OutputDir, serverURL.Hostname(), "p", "post-1", "index.html"))
+
+	manifest, err := LoadManifest(opts.OutputDir)
+	require.NoError(t, err)
+	entry, ok := manifest.Entry("post-2")
+	require.True(t, ok)
+	assert.Equal(t, serverURL.Hostname()+"/p/post-2/index.html", entry.Files["html"])
+
+	summary, err = downloader.DownloadPublication(context.Background(), server.URL, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, summary.Skipped)
+}
@@ -1,28 +1,30 @@
 package lib
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
+	"html"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/JohannesKaufmann/html-to-markdown"
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/k3a/html2text"
 )
 
 // NotesClient handles downloading Substack Notes via API
 type NotesClient struct {
-	fetcher *Fetcher
+	api *APIClient
 }
 
 // NewNotesClient creates a new notes client
 func NewNotesClient(fetcher *Fetcher) *NotesClient {
 	return &NotesClient{
-		fetcher: fetcher,
+		api: NewAPIClient(fetcher, SubstackAPIURL),
 	}
 }
 
@@ -31,6 +33,7 @@ type Note struct {
 	ID             string                 `json:"id"`
 	Body           string                 `json:"body"`
 	BodyJSON       interface{}            `json:"body_json,omitempty"`
+	BodyHTML       string                 `json:"body_html,omitempty"` // rendered from BodyJSON
 	Title          string                 `json:"title"`
 	Context        string                 `json:"context"`
 	CreatedAt      string                 `json:"created_at"`
@@ -87,57 +90,64 @@ type NotesOptions struct {
 	Verbose    bool
 }
 
+// Feeds of the reader API that NotesClient can fetch
+const (
+	NotesFeedActivity = "activity" // the notes and comments written by a user
+	NotesFeedLikes    = "likes"    // the notes and comments liked by a user
+	NotesFeedSaves    = "saves"    // the posts saved by the logged in user, whatever the user ID
+)
+
+// NotesFeeds are the feeds that can be fetched with FetchFeed
+var NotesFeeds = []string{NotesFeedActivity, NotesFeedLikes, NotesFeedSaves}
+
+// notesFeedEndpoint returns the API endpoint of a feed of a user
+func notesFeedEndpoint(feed, userID string) (string, error) {
+	switch feed {
+	case NotesFeedActivity:
+		return "reader/feed/profile/" + url.PathEscape(userID), nil
+	case NotesFeedLikes:
+		return "reader/feed/profile/" + url.PathEscape(userID) + "/likes", nil
+	case NotesFeedSaves:
+		return "reader/saved", nil
+	default:
+		return "", fmt.Errorf("invalid feed %q, expected one of %s", feed, strings.Join(NotesFeeds, ", "))
+	}
+}
+
 // FetchAllUserActivity fetches all activity items for a user across multiple pages
-func (nc *NotesClient) FetchAllUserActivity(userID string, maxPages int, verbose bool) ([]ActivityItem, error) {
-	baseURL := fmt.Sprintf("https://substack.com/api/v1/reader/feed/profile/%s", userID)
-	headers := map[string]string{
-		"User-Agent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36",
-		"Accept":     "application/json",
+func (nc *NotesClient) FetchAllUserActivity(ctx context.Context, userID string, maxPages int, verbose bool) ([]ActivityItem, error) {
+	return nc.FetchFeed(ctx, NotesFeedActivity, userID, maxPages, verbose)
+}
+
+// FetchFeed fetches all items of a feed of a user (see NotesFeeds) across multiple pages.
+// The saves feed requires the cookie of the user.
+func (nc *NotesClient) FetchFeed(ctx context.Context, feed, userID string, maxPages int, verbose bool) ([]ActivityItem, error) {
+	endpoint, err := notesFeedEndpoint(feed, userID)
+	if err != nil {
+		return nil, err
 	}
 
 	var allItems []ActivityItem
-	cursor := ""
-	page := 1
-
-	for page <= maxPages {
-		reqURL := baseURL
+	err = PaginateCursor(ctx, maxPages, func(page int, cursor string) (string, error) {
+		query := url.Values{}
 		if cursor != "" {
-			reqURL += "?cursor=" + url.QueryEscape(cursor)
+			query.Set("cursor", cursor)
 		}
 
 		if verbose {
-			fmt.Printf("Fetching page %d: %s\n", page, reqURL)
-		}
-
-		req, err := http.NewRequest("GET", reqURL, nil)
-		if err != nil {
-			return nil, fmt.Errorf("creating request: %w", err)
-		}
-
-		for key, value := range headers {
-			req.Header.Set(key, value)
-		}
-
-		resp, err := nc.fetcher.client.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("fetching page %d: %w", page, err)
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("API request failed with status %d", resp.StatusCode)
+			fmt.Printf("Fetching page %d: %s\n", page, nc.api.URL(endpoint, query))
 		}
 
 		var notesResp NotesResponse
-		if err := json.NewDecoder(resp.Body).Decode(&notesResp); err != nil {
-			return nil, fmt.Errorf("decoding response: %w", err)
+		if err := nc.api.Get(ctx, endpoint, query, &notesResp); err != nil {
+			return "", fmt.Errorf("fetching page %d: %w", page, err)
 		}
 
 		if len(notesResp.Items) == 0 {
 			if verbose {
 				fmt.Printf("  No items found on page %d\n", page)
 			}
-			break
+			return "", nil
 		}
 
 		allItems = append(allItems, notesResp.Items...)
@@ -145,20 +155,59 @@ func (nc *NotesClient) FetchAllUserActivity(userID string, maxPages int, verbose
 			fmt.Printf("  Found %d items on page %d (total: %d)\n", len(notesResp.Items), page, len(allItems))
 		}
 
-		cursor = notesResp.NextCursor
-		if cursor == "" {
-			if verbose {
-				fmt.Printf("  No more pages after page %d\n", page)
-			}
-			break
+		if notesResp.NextCursor == "" && verbose {
+			fmt.Printf("  No more pages after page %d\n", page)
 		}
-
-		page++
+		return notesResp.NextCursor, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return allItems, nil
 }
 
+// NoteSortOrders are the orders notes can be sorted in with SortNotes
+var NoteSortOrders = []string{"date", "reactions"}
+
+// SortNotes sorts notes chronologically ("date"), or from the most to the least reactions
+// ("reactions"), the most restacked and then the most recent first in case of a tie
+func SortNotes(notes []*Note, order string) error {
+	byDate := func(i, j int) bool {
+		ti, _ := notes[i].Time()
+		tj, _ := notes[j].Time()
+		return ti.Before(tj)
+	}
+	switch order {
+	case "date":
+		sort.SliceStable(notes, byDate)
+	case "reactions":
+		sort.SliceStable(notes, func(i, j int) bool {
+			if notes[i].ReactionCount != notes[j].ReactionCount {
+				return notes[i].ReactionCount > notes[j].ReactionCount
+			}
+			if notes[i].Restacks != notes[j].Restacks {
+				return notes[i].Restacks > notes[j].Restacks
+			}
+			return byDate(j, i)
+		})
+	default:
+		return fmt.Errorf("invalid sort order %q, expected one of %s", order, strings.Join(NoteSortOrders, ", "))
+	}
+	return nil
+}
+
+// FilterNotesByReactions returns the notes with at least minReactions reactions
+func FilterNotesByReactions(notes []*Note, minReactions int) []*Note {
+	var filtered []*Note
+	for _, note := range notes {
+		if note.ReactionCount >= minReactions {
+			filtered = append(filtered, note)
+		}
+	}
+	return filtered
+}
+
 // IsLikelyRegularComment detects if this is a regular comment vs a note using context.type
 func (nc *NotesClient) IsLikelyRegularComment(comment Comment, item ActivityItem) bool {
 	// The definitive way: check context.type
@@ -168,10 +217,33 @@ func (nc *NotesClient) IsLikelyRegularComment(comment Comment, item ActivityItem
 	return true // This is a regular comment
 }
 
-// ConvertCommentToNote converts a comment object to our note format
+// ConvertCommentToNote converts a comment object to our note format.
+// The rich content of body_json is preferred to body, which is sometimes empty or lossy.
 func (nc *NotesClient) ConvertCommentToNote(comment Comment, item ActivityItem) *Note {
+	return convertComment(comment, item, 10, "comment_note")
+}
+
+// ConvertComment converts a comment on a post to our note format, keeping even the
+// shortest comments, as when archiving one's own words
+func (nc *NotesClient) ConvertComment(comment Comment, item ActivityItem) *Note {
+	return convertComment(comment, item, 1, "comment")
+}
+
+// convertComment converts a comment to a note of type noteType, or returns nil if its text
+// is shorter than minLength and it has no image
+func convertComment(comment Comment, item ActivityItem, minLength int, noteType string) *Note {
 	body := comment.Body
-	if body == "" || len(strings.TrimSpace(body)) < 10 {
+	var bodyHTML string
+	if comment.BodyJSON != nil {
+		if rendered, err := RenderProseMirrorHTML(comment.BodyJSON); err == nil {
+			bodyHTML = rendered
+		}
+	}
+	text := body
+	if bodyHTML != "" {
+		text = html2text.HTML2Text(bodyHTML)
+	}
+	if len(strings.TrimSpace(text)) < minLength && !strings.Contains(bodyHTML, "<img") {
 		return nil
 	}
 
@@ -187,45 +259,86 @@ func (nc *NotesClient) ConvertCommentToNote(comment Comment, item ActivityItem)
 		ID:            fmt.Sprintf("%d", comment.ID),
 		Body:          body,
 		BodyJSON:      comment.BodyJSON,
+		BodyHTML:      bodyHTML,
 		Title:         "", // Comments don't have titles
 		Context:       postContext,
 		CreatedAt:     comment.Date,
 		AuthorName:    comment.Name,
 		AuthorHandle:  comment.Handle,
 		URL:           fmt.Sprintf("https://substack.com/profile/%d/comment/%d", comment.UserID, comment.ID),
-		Type:          "comment_note",
+		Type:          noteType,
 		Publication:   item.Publication,
 		ReactionCount: comment.ReactionCount,
 		Restacks:      comment.Restacks,
 	}
 }
 
-// SaveNote saves a note to file in the specified format
-func (nc *NotesClient) SaveNote(note *Note, outputDir, format string) error {
-	// Create filename
-	var createdAt time.Time
-	if note.CreatedAt != "" {
-		// Parse the date string
-		dateStr := strings.ReplaceAll(strings.ReplaceAll(note.CreatedAt, "T", " "), "Z", "")
-		if parsed, err := time.Parse("2006-01-02 15:04:05", dateStr); err == nil {
-			createdAt = parsed
-		} else {
-			createdAt = time.Now()
-		}
-	} else {
-		createdAt = time.Now()
+// ContentHTML returns the content of the note as HTML: the one rendered from body_json,
+// or the body otherwise
+func (n *Note) ContentHTML() string {
+	if n.BodyHTML != "" {
+		return n.BodyHTML
 	}
+	return n.Body
+}
 
-	timestamp := createdAt.Format("20060102_150405")
-	
-	// Clean ID for filename
-	re := regexp.MustCompile(`[^\w\-_]`)
-	cleanID := re.ReplaceAllString(note.ID, "")
-	if len(cleanID) > 20 {
-		cleanID = cleanID[:20]
+// Time returns the creation time of the note, and false if it is unknown
+func (n *Note) Time() (time.Time, bool) {
+	if n.CreatedAt == "" {
+		return time.Time{}, false
 	}
-	
-	filename := fmt.Sprintf("%s_%s.%s", timestamp, cleanID, format)
+	if parsed, err := time.Parse(time.RFC3339, n.CreatedAt); err == nil {
+		return parsed.UTC(), true
+	}
+	dateStr := strings.ReplaceAll(strings.ReplaceAll(n.CreatedAt, "T", " "), "Z", "")
+	if parsed, err := time.Parse("2006-01-02 15:04:05", dateStr); err == nil {
+		return parsed, true
+	}
+	return time.Time{}, false
+}
+
+// ConvertPostToNote converts a post of a feed, such as a saved post, to our note format,
+// its content being a link to the post with its subtitle
+func (nc *NotesClient) ConvertPostToNote(item ActivityItem) *Note {
+	if item.Post == nil {
+		return nil
+	}
+	title, _ := item.Post["title"].(string)
+	postURL, _ := item.Post["canonical_url"].(string)
+	if title == "" || postURL == "" {
+		return nil
+	}
+	body := fmt.Sprintf(`<p><a href="%s">%s</a></p>`, html.EscapeString(postURL), html.EscapeString(title))
+	if subtitle, _ := item.Post["subtitle"].(string); subtitle != "" {
+		body += "<p>" + html.EscapeString(subtitle) + "</p>"
+	}
+
+	note := &Note{
+		Body:        body,
+		Title:       title,
+		URL:         postURL,
+		Type:        "saved_post",
+		Publication: item.Publication,
+	}
+	if id, ok := item.Post["id"].(float64); ok {
+		note.ID = fmt.Sprintf("%d", int64(id))
+	}
+	note.CreatedAt, _ = item.Post["post_date"].(string)
+	if reactions, ok := item.Post["reaction_count"].(float64); ok {
+		note.ReactionCount = int(reactions)
+	}
+	if bylines, ok := item.Post["publishedBylines"].([]interface{}); ok && len(bylines) > 0 {
+		if byline, ok := bylines[0].(map[string]interface{}); ok {
+			note.AuthorName, _ = byline["name"].(string)
+			note.AuthorHandle, _ = byline["handle"].(string)
+		}
+	}
+	return note
+}
+
+// SaveNote saves a note to file in the specified format
+func (nc *NotesClient) SaveNote(note *Note, outputDir, format string) error {
+	filename := fmt.Sprintf("%s.%s", noteName(note), format)
 	filepath := filepath.Join(outputDir, filename)
 
 	var content string
@@ -233,15 +346,13 @@ func (nc *NotesClient) SaveNote(note *Note, outputDir, format string) error {
 	case "html":
 		content = nc.formatNoteHTML(note)
 	case "md":
-		h := html2text.NewConverter()
-		h.Opt.PrettyTables = true
-		mdContent := h.Convert(note.Body)
+		mdContent, err := md.NewConverter("", true, nil).ConvertString(note.ContentHTML())
+		if err != nil {
+			return err
+		}
 		content = nc.formatNoteMarkdown(note, mdContent)
 	case "txt":
-		h := html2text.NewConverter()
-		h.Opt.PrettyTables = true
-		h.Opt.LinkStyle = "none"
-		textContent := h.Convert(note.Body)
+		textContent := html2text.HTML2Text(note.ContentHTML())
 		content = nc.formatNoteText(note, textContent)
 	default:
 		return fmt.Errorf("unsupported format: %s", format)
@@ -250,6 +361,24 @@ func (nc *NotesClient) SaveNote(note *Note, outputDir, format string) error {
 	return os.WriteFile(filepath, []byte(content), 0644)
 }
 
+// noteName returns the name of the files of a note, without extension: {YYYYMMDD_HHMMSS}_{id}
+func noteName(note *Note) string {
+	createdAt, ok := note.Time()
+	if !ok {
+		createdAt = time.Now()
+	}
+
+	timestamp := createdAt.Format("20060102_150405")
+	
+	// Clean ID for filename
+	re := regexp.MustCompile(`[^\w\-_]`)
+	cleanID := re.ReplaceAllString(note.ID, "")
+	if len(cleanID) > 20 {
+		cleanID = cleanID[:20]
+	}
+	return timestamp + "_" + cleanID
+}
+
 // formatNoteHTML formats a note as HTML
 func (nc *NotesClient) formatNoteHTML(note *Note) string {
 	contextHTML := ""
@@ -286,7 +415,7 @@ func (nc *NotesClient) formatNoteHTML(note *Note) string {
         <div class="url"><a href="%s">Original Comment</a></div>
     </div>
 </body>
-</html>`, note.AuthorName, note.AuthorName, note.AuthorHandle, note.CreatedAt, contextHTML, pubHTML, note.Body, note.ReactionCount, note.Restacks, note.URL)
+</html>`, note.AuthorName, note.AuthorName, note.AuthorHandle, note.CreatedAt, contextHTML, pubHTML, note.ContentHTML(), note.ReactionCount, note.Restacks, note.URL)
 }
 
 // formatNoteMarkdown formats a note as Markdown
@@ -0,0 +1,153 @@
+package lib
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/k3a/html2text"
+)
+
+// undatedDigest is the name of the digest of the notes without a known date
+const undatedDigest = "undated"
+
+// NotesDigest is the notes of a user of one month, saved together in one file
+type NotesDigest struct {
+	Month string // YYYY-MM, or "undated"
+	Notes []*Note
+}
+
+// GroupNotesByMonth groups notes by the month they were created, in chronological order.
+// The notes of a month keep their order, see SortNotes.
+func GroupNotesByMonth(notes []*Note) []NotesDigest {
+	var digests []NotesDigest
+	index := make(map[string]int)
+	for _, note := range notes {
+		month := undatedDigest
+		if t, ok := note.Time(); ok {
+			month = t.Format("2006-01")
+		}
+		i, ok := index[month]
+		if !ok {
+			i = len(digests)
+			index[month] = i
+			digests = append(digests, NotesDigest{Month: month})
+		}
+		digests[i].Notes = append(digests[i].Notes, note)
+	}
+	// Months are formatted so that they sort chronologically, the undated notes going last
+	sort.Slice(digests, func(i, j int) bool {
+		if digests[j].Month == undatedDigest {
+			return digests[i].Month != undatedDigest
+		}
+		return digests[i].Month != undatedDigest && digests[i].Month < digests[j].Month
+	})
+	return digests
+}
+
+// SaveMonthlyDigests saves the notes into one file per month, named YYYY-MM.{format},
+// in the order of notes, and returns the paths of the files written
+func (nc *NotesClient) SaveMonthlyDigests(notes []*Note, outputDir, format string) ([]string, error) {
+	var paths []string
+	for _, digest := range GroupNotesByMonth(notes) {
+		content, err := digest.Format(format)
+		if err != nil {
+			return paths, err
+		}
+		path := filepath.Join(outputDir, digest.Month+"."+format)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// Title returns the title of the digest, e.g. "Notes by Jane (@jane), January 2024",
+// without author if the notes have several
+func (d NotesDigest) Title() string {
+	period := "undated"
+	if len(d.Notes) > 0 && d.Month != undatedDigest {
+		t, _ := d.Notes[0].Time()
+		period = t.Format("January 2006")
+	}
+	// Digests of liked or saved notes have several authors
+	for _, note := range d.Notes {
+		if note.AuthorName == "" || note.AuthorName != d.Notes[0].AuthorName {
+			return "Notes, " + period
+		}
+	}
+	if len(d.Notes) == 0 {
+		return "Notes, " + period
+	}
+	author := d.Notes[0].AuthorName
+	if d.Notes[0].AuthorHandle != "" {
+		author += " (@" + d.Notes[0].AuthorHandle + ")"
+	}
+	return fmt.Sprintf("Notes by %s, %s", author, period)
+}
+
+// Format renders the digest in a format: html, md or txt
+func (d NotesDigest) Format(format string) (string, error) {
+	var sb strings.Builder
+	switch format {
+	case "html":
+		fmt.Fprintf(&sb, "<!DOCTYPE html>\n<html>\n<head>\n    <meta charset=\"UTF-8\">\n    <title>%s</title>\n</head>\n<body>\n<h1>%s</h1>\n",
+			html.EscapeString(d.Title()), html.EscapeString(d.Title()))
+		for i, note := range d.Notes {
+			if i > 0 {
+				sb.WriteString("<hr>\n")
+			}
+			fmt.Fprintf(&sb, "<article class=\"note\" id=\"note-%s\">\n<h2>%s</h2>\n", html.EscapeString(note.ID), html.EscapeString(noteHeading(note)))
+			if note.Context != "" {
+				fmt.Fprintf(&sb, "<div class=\"context\">%s</div>\n", html.EscapeString(note.Context))
+			}
+			fmt.Fprintf(&sb, "<div class=\"content\">%s</div>\n", note.ContentHTML())
+			fmt.Fprintf(&sb, "<div class=\"stats\">Reactions: %d | Restacks: %d | <a href=\"%s\">Permalink</a></div>\n</article>\n",
+				note.ReactionCount, note.Restacks, html.EscapeString(note.URL))
+		}
+		sb.WriteString("</body>\n</html>\n")
+	case "md":
+		fmt.Fprintf(&sb, "# %s\n", d.Title())
+		converter := md.NewConverter("", true, nil)
+		for i, note := range d.Notes {
+			if i > 0 {
+				sb.WriteString("\n---\n")
+			}
+			content, err := converter.ConvertString(note.ContentHTML())
+			if err != nil {
+				return "", fmt.Errorf("converting note %s: %w", note.ID, err)
+			}
+			fmt.Fprintf(&sb, "\n## %s\n\n", noteHeading(note))
+			if note.Context != "" {
+				fmt.Fprintf(&sb, "*%s*\n\n", note.Context)
+			}
+			fmt.Fprintf(&sb, "%s\n\n[Permalink](%s) · %d reactions, %d restacks\n", content, note.URL, note.ReactionCount, note.Restacks)
+		}
+	case "txt":
+		sb.WriteString(d.Title() + "\n")
+		for _, note := range d.Notes {
+			sb.WriteString("\n" + strings.Repeat("=", 60) + "\n")
+			fmt.Fprintf(&sb, "%s\n", noteHeading(note))
+			if note.Context != "" {
+				fmt.Fprintf(&sb, "%s\n", note.Context)
+			}
+			fmt.Fprintf(&sb, "\n%s\n\n%s\n%d reactions, %d restacks\n", strings.TrimSpace(html2text.HTML2Text(note.ContentHTML())), note.URL, note.ReactionCount, note.Restacks)
+		}
+	default:
+		return "", fmt.Errorf("unsupported format: %s", format)
+	}
+	return sb.String(), nil
+}
+
+// noteHeading returns the date of a note as the heading of its section in a digest
+func noteHeading(note *Note) string {
+	if t, ok := note.Time(); ok {
+		return t.Format("Monday, January 2, 2006 15:04")
+	}
+	return "Note " + note.ID
+}
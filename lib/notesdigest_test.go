@@ -0,0 +1,103 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testDigestNotes() []*Note {
+	note := func(id, createdAt, body string) *Note {
+		return &Note{ID: id, CreatedAt: createdAt, Body: body, AuthorName: "Jane", AuthorHandle: "jane",
+			URL: "https://substack.com/profile/1/comment/" + id, ReactionCount: 3}
+	}
+	return []*Note{
+		note("3", "2024-02-01T08:00:00.000Z", "<p>February note</p>"),
+		note("4", "", "<p>Undated note</p>"),
+		note("2", "2024-01-20T10:00:00Z", "<p>Second January note</p>"),
+		note("1", "2024-01-05 09:30:00", "<p>First January note</p>"),
+	}
+}
+
+// Test grouping notes by month
+func TestGroupNotesByMonth(t *testing.T) {
+	notes := testDigestNotes()
+	require.NoError(t, SortNotes(notes, "date"))
+	digests := GroupNotesByMonth(notes)
+	require.Len(t, digests, 3)
+
+	assert.Equal(t, "2024-01", digests[0].Month)
+	require.Len(t, digests[0].Notes, 2)
+	assert.Equal(t, "1", digests[0].Notes[0].ID)
+	assert.Equal(t, "2", digests[0].Notes[1].ID)
+	assert.Equal(t, "Notes by Jane (@jane), January 2024", digests[0].Title())
+
+	assert.Equal(t, "2024-02", digests[1].Month)
+	assert.Equal(t, "undated", digests[2].Month)
+	assert.Equal(t, "Notes by Jane (@jane), undated", digests[2].Title())
+}
+
+// Test saving notes into monthly digests
+func TestSaveMonthlyDigests(t *testing.T) {
+	client := NewNotesClient(NewFetcher())
+
+	for _, format := range []string{"html", "md", "txt"} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			notes := testDigestNotes()
+			require.NoError(t, SortNotes(notes, "date"))
+			paths, err := client.SaveMonthlyDigests(notes, dir, format)
+			require.NoError(t, err)
+			assert.Equal(t, []string{
+				filepath.Join(dir, "2024-01."+format),
+				filepath.Join(dir, "2024-02."+format),
+				filepath.Join(dir, "undated."+format),
+			}, paths)
+
+			data, err := os.ReadFile(paths[0])
+			require.NoError(t, err)
+			content := string(data)
+			first := strings.Index(content, "First January note")
+			second := strings.Index(content, "Second January note")
+			assert.True(t, first >= 0 && second > first, "notes are in chronological order")
+			assert.Contains(t, content, "https://substack.com/profile/1/comment/1")
+			assert.Contains(t, content, "https://substack.com/profile/1/comment/2")
+			assert.NotContains(t, content, "February note")
+		})
+	}
+
+	_, err := client.SaveMonthlyDigests(testDigestNotes(), t.TempDir(), "pdf")
+	assert.Error(t, err)
+}
+
+// Test sorting and filtering notes by engagement
+func TestSortAndFilterNotes(t *testing.T) {
+	notes := []*Note{
+		{ID: "a", CreatedAt: "2024-01-01T00:00:00Z", ReactionCount: 5},
+		{ID: "b", CreatedAt: "2024-03-01T00:00:00Z", ReactionCount: 20, Restacks: 1},
+		{ID: "c", CreatedAt: "2024-02-01T00:00:00Z", ReactionCount: 20, Restacks: 1},
+		{ID: "d", CreatedAt: "2024-04-01T00:00:00Z", ReactionCount: 20, Restacks: 4},
+		{ID: "e", CreatedAt: "2024-05-01T00:00:00Z", ReactionCount: 0},
+	}
+	ids := func(notes []*Note) string {
+		var s []string
+		for _, n := range notes {
+			s = append(s, n.ID)
+		}
+		return strings.Join(s, "")
+	}
+
+	require.NoError(t, SortNotes(notes, "reactions"))
+	assert.Equal(t, "dbcae", ids(notes))
+	require.NoError(t, SortNotes(notes, "date"))
+	assert.Equal(t, "acbde", ids(notes))
+	assert.Error(t, SortNotes(notes, "restacks"))
+
+	assert.Equal(t, "cbd", ids(FilterNotesByReactions(notes, 10)))
+	assert.Len(t, FilterNotesByReactions(notes, 0), 5)
+	assert.Empty(t, FilterNotesByReactions(notes, 100))
+}
@@ -0,0 +1,62 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// NotesMediaOptions configures the download of the images and attachments of notes,
+// as for the posts of the download command
+type NotesMediaOptions struct {
+	DownloadImages bool
+	ImageQuality   ImageQuality
+	ImagesDir      string
+	DownloadFiles  bool
+	FileExtensions []string
+	FilesDir       string
+}
+
+// DownloadNoteMedia downloads the images and attachments of a note into the images and files
+// directories of outputDir, named after the note, and points its HTML at them. Media that fail
+// to download keep their remote URL. The attachments are returned with the images.
+func (nc *NotesClient) DownloadNoteMedia(ctx context.Context, note *Note, outputDir string, opts NotesMediaOptions) (*ImageDownloadResult, error) {
+	name := noteName(note)
+	content := note.ContentHTML()
+	result := &ImageDownloadResult{}
+
+	if opts.DownloadImages {
+		images, err := NewImageDownloader(nc.api.fetcher, outputDir, opts.ImagesDir, opts.ImageQuality).DownloadImages(ctx, content, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download images of note %s: %w", note.ID, err)
+		}
+		result = images
+		content = images.UpdatedHTML
+	}
+	if opts.DownloadFiles {
+		files, err := NewFileDownloader(nc.api.fetcher, outputDir, opts.FilesDir, opts.FileExtensions).DownloadFiles(ctx, content, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download files of note %s: %w", note.ID, err)
+		}
+		result.Files = files.Files
+		content = files.UpdatedHTML
+	}
+
+	// The downloaders render a whole document when they rewrite the HTML, while the note is
+	// written inside its template
+	if content != note.ContentHTML() {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		if content, err = doc.Find("body").Html(); err != nil {
+			return nil, err
+		}
+	}
+
+	result.UpdatedHTML = content
+	note.BodyHTML = content
+	return result, nil
+}
@@ -0,0 +1,49 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadNoteMedia(t *testing.T) {
+	server := createTestImageServer()
+	defer server.Close()
+
+	note := &Note{
+		ID:        "12345",
+		CreatedAt: "2024-03-01T10:00:00Z",
+		BodyHTML: `<p>Look</p><img src="` + server.URL + `/chart.png" alt="Chart">` +
+			`<a class="file-embed-button wide" href="` + server.URL + `/data.csv">Data</a>`,
+	}
+	dir := t.TempDir()
+	client := NewNotesClient(NewFetcher(WithRatePerSecond(100)))
+
+	result, err := client.DownloadNoteMedia(context.Background(), note, dir, NotesMediaOptions{
+		DownloadImages: true,
+		ImageQuality:   ImageQualityHigh,
+		ImagesDir:      "images",
+		DownloadFiles:  true,
+		FilesDir:       "files",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Success)
+	require.Len(t, result.Files, 1)
+	assert.True(t, result.Files[0].Success)
+
+	assert.Contains(t, note.BodyHTML, `<img src="images/20240301_100000_12345/chart.png" alt="Chart"/>`)
+	assert.Contains(t, note.BodyHTML, `href="files/20240301_100000_12345/data.csv"`)
+	assert.False(t, strings.Contains(note.BodyHTML, "<body>"), "the note keeps its fragment")
+	assert.FileExists(t, filepath.Join(dir, "images", "20240301_100000_12345", "chart.png"))
+
+	// The saved note references the local copies
+	require.NoError(t, client.SaveNote(note, dir, "md"))
+	data, err := os.ReadFile(filepath.Join(dir, "20240301_100000_12345.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "![Chart](images/20240301_100000_12345/chart.png)")
+}
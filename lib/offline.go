@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrOffline is returned for the requests of a Fetcher in offline mode
+var ErrOffline = errors.New("network access is disabled in offline mode")
+
+// WithOffline makes every request of the Fetcher fail with ErrOffline, so that nothing is
+// fetched behind the back of a command meant to work from local data only.
+func WithOffline(enabled bool) FetcherOption {
+	return func(o *FetcherOptions) {
+		o.Offline = enabled
+	}
+}
+
+// offlineError returns the error of a request for url in offline mode
+func offlineError(url string) error {
+	return fmt.Errorf("%w: can't fetch %s", ErrOffline, url)
+}
+
+// extractCached returns the post at postURL from the cache of the options, for offline mode.
+// The latest cached version is returned, as there is no way to know whether it changed since.
+func (d *Downloader) extractCached(postURL string) (Post, error) {
+	if d.opts.Cache == nil {
+		return Post{}, fmt.Errorf("%w: %s can only be written from the cache of posts", ErrOffline, postURL)
+	}
+	post, ok := d.opts.Cache.Get(postURL, time.Time{})
+	if !ok {
+		return Post{}, fmt.Errorf("%w: %s isn't in the cache of posts %s", ErrOffline, postURL, d.opts.Cache.Dir)
+	}
+	return post, nil
+}
+
+// Regenerate rebuilds the archive page, the links between posts and the related posts of the
+// posts recorded in the manifest of the output directory, without fetching anything. Posts
+// whose files are all gone are left out of the archive page.
+// It returns the number of posts on the archive page.
+func (d *Downloader) Regenerate(ctx context.Context) (int, error) {
+	manifest, err := LoadManifest(d.opts.OutputDir)
+	if err != nil {
+		return 0, err
+	}
+	entries := manifest.Entries()
+	if len(entries) == 0 {
+		return 0, fmt.Errorf("no downloaded posts recorded in %s", manifest.Path())
+	}
+
+	var archive *Archive
+	if d.opts.CreateArchive {
+		archive = d.newArchive()
+		formats := d.opts.Formats()
+		for _, entry := range entries {
+			if entry.Deleted() {
+				// Added by finish
+				continue
+			}
+			paths := make(map[string]string)
+			for format, path := range entry.Files {
+				if _, err := os.Stat(manifest.ResolvePath(path)); err == nil {
+					paths[format] = manifest.ResolvePath(path)
+				}
+			}
+			if len(paths) == 0 {
+				continue
+			}
+			archiveEntry := ArchiveEntry{Post: entry.Post(), DownloadTime: entry.DownloadedAt, Files: paths}
+			archiveEntry.FilePath = archiveEntry.PrimaryPath(formats[0])
+			archiveEntry.Sidecars = postSidecars(archiveEntry.FilePath)
+			archive.Add(archiveEntry)
+		}
+	}
+
+	if err := d.finish(ctx, manifest, archive); err != nil {
+		return 0, err
+	}
+	if archive == nil {
+		return 0, nil
+	}
+	return len(archive.Entries), nil
+}
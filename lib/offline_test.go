@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetcherOffline(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	f := NewFetcher(WithOffline(true), WithRespectRobots(true))
+	_, err := f.FetchURL(context.Background(), server.URL)
+	assert.ErrorIs(t, err, ErrOffline)
+	assert.Contains(t, err.Error(), server.URL)
+	_, err = f.FetchHeader(context.Background(), server.URL)
+	assert.ErrorIs(t, err, ErrOffline)
+	assert.Equal(t, int32(0), requests.Load())
+}
+
+func TestDownloaderOffline(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewPostCache(t.TempDir())
+	require.NoError(t, err)
+	postURL := "https://example.substack.com/p/cached"
+	require.NoError(t, cache.Put(rawTestPost(t, postURL, 1, "2023-01-02T10:00:00Z")))
+
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = dir
+	opts.CreateArchive = true
+	opts.Cache = cache
+	downloader := NewDownloader(NewFetcher(WithOffline(true)), opts)
+
+	// A cached post is written from the cache, the others fail
+	result, err := downloader.DownloadPost(context.Background(), postURL)
+	require.NoError(t, err)
+	assert.FileExists(t, result.Path)
+	_, err = downloader.DownloadPost(context.Background(), "https://example.substack.com/p/missing")
+	assert.ErrorIs(t, err, ErrOffline)
+
+	// The archive page lists the recorded posts whose files are still there
+	manifest, err := LoadManifest(dir)
+	require.NoError(t, err)
+	gone := filepath.Join(dir, "20230103_100000_gone.html")
+	manifest.AddEntry(NewManifestEntry(Post{Id: 2, Slug: "gone", Title: "Gone", PostDate: "2023-01-03T10:00:00Z"},
+		map[string]string{"html": filepath.Base(gone)}, time.Now()))
+	require.NoError(t, manifest.Save())
+	require.NoError(t, os.Remove(filepath.Join(dir, "index.html")))
+
+	n, err := downloader.Regenerate(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	index, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(index), "Post 1")
+	assert.NotContains(t, string(index), "Gone")
+
+	_, err = NewDownloader(NewFetcher(WithOffline(true)), DownloadOptions{OutputDir: t.TempDir()}).Regenerate(context.Background())
+	assert.ErrorContains(t, err, "no downloaded posts")
+}
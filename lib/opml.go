@@ -0,0 +1,115 @@
+package lib
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// OPMLFeed is a Substack publication found in an OPML file
+type OPMLFeed struct {
+	Title          string
+	FeedURL        string
+	PublicationURL string
+	Folder         string // name of the folder the publication is downloaded to
+}
+
+// opmlDocument is the structure of an OPML file, as exported by RSS readers
+type opmlDocument struct {
+	Outlines []opmlOutline `xml:"body>outline"`
+}
+
+// opmlOutline is an outline element; feeds may be nested in categories
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr"`
+	XMLURL   string        `xml:"xmlUrl,attr"`
+	HTMLURL  string        `xml:"htmlUrl,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// LoadOPML reads the Substack feeds of an OPML file
+func LoadOPML(path string) ([]OPMLFeed, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	return ParseOPML(f)
+}
+
+// ParseOPML returns the Substack publications of an OPML document, and the URLs of the
+// other feeds it contains. Feeds are recognized as Substack feeds when they are hosted on
+// substack.com or served at /feed, as custom domain publications are.
+func ParseOPML(r io.Reader) ([]OPMLFeed, []string, error) {
+	var doc opmlDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse OPML: %w", err)
+	}
+
+	var feeds []OPMLFeed
+	var skipped []string
+	seen := make(map[string]bool)
+
+	var walk func(outlines []opmlOutline)
+	walk = func(outlines []opmlOutline) {
+		for _, o := range outlines {
+			walk(o.Outlines)
+			if o.XMLURL == "" {
+				continue
+			}
+
+			feed, ok := substackFeed(o)
+			if !ok {
+				skipped = append(skipped, o.XMLURL)
+				continue
+			}
+			if seen[feed.PublicationURL] {
+				continue
+			}
+			seen[feed.PublicationURL] = true
+			feeds = append(feeds, feed)
+		}
+	}
+	walk(doc.Outlines)
+
+	return feeds, skipped, nil
+}
+
+// substackFeed converts an outline to a Substack publication, if its feed is a Substack feed
+func substackFeed(o opmlOutline) (OPMLFeed, bool) {
+	u, err := url.Parse(strings.TrimSpace(o.XMLURL))
+	if err != nil || u.Host == "" {
+		return OPMLFeed{}, false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	onSubstack := strings.HasSuffix(host, ".substack.com")
+	if !onSubstack && strings.TrimSuffix(u.Path, "/") != "/feed" {
+		return OPMLFeed{}, false
+	}
+
+	folder := strings.TrimPrefix(host, "www.")
+	if onSubstack {
+		folder = strings.TrimSuffix(host, ".substack.com")
+	}
+
+	title := o.Title
+	if title == "" {
+		title = o.Text
+	}
+
+	scheme := u.Scheme
+	if scheme != "http" {
+		scheme = "https"
+	}
+	return OPMLFeed{
+		Title:          title,
+		FeedURL:        u.String(),
+		PublicationURL: scheme + "://" + u.Host,
+		Folder:         folder,
+	}, true
+}
@@ -0,0 +1,57 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testOPML = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+  <head><title>Subscriptions</title></head>
+  <body>
+    <outline text="Newsletters" title="Newsletters">
+      <outline type="rss" text="Example" title="Example Newsletter" xmlUrl="https://example.substack.com/feed" htmlUrl="https://example.substack.com"/>
+      <outline type="rss" text="Custom Domain" xmlUrl="https://www.custom.com/feed/"/>
+    </outline>
+    <outline type="rss" text="Duplicate" xmlUrl="https://example.substack.com/feed?sectionid=1"/>
+    <outline type="rss" text="Blog" xmlUrl="https://blog.example.org/rss.xml"/>
+    <outline type="rss" text="Broken" xmlUrl="not a url"/>
+  </body>
+</opml>`
+
+// Test reading Substack feeds from an OPML file
+func TestParseOPML(t *testing.T) {
+	feeds, skipped, err := ParseOPML(strings.NewReader(testOPML))
+	require.NoError(t, err)
+
+	assert.Equal(t, []OPMLFeed{
+		{Title: "Example Newsletter", FeedURL: "https://example.substack.com/feed", PublicationURL: "https://example.substack.com", Folder: "example"},
+		{Title: "Custom Domain", FeedURL: "https://www.custom.com/feed/", PublicationURL: "https://www.custom.com", Folder: "custom.com"},
+	}, feeds)
+	assert.Equal(t, []string{"https://blog.example.org/rss.xml", "not a url"}, skipped)
+
+	_, _, err = ParseOPML(strings.NewReader("<opml><body>"))
+	assert.Error(t, err)
+}
+
+// Test loading an OPML file from disk
+func TestLoadOPML(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "opml-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "subscriptions.opml")
+	require.NoError(t, os.WriteFile(path, []byte(testOPML), 0644))
+
+	feeds, _, err := LoadOPML(path)
+	require.NoError(t, err)
+	assert.Len(t, feeds, 2)
+
+	_, _, err = LoadOPML(filepath.Join(tempDir, "missing.opml"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,98 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// OwnerDir is the directory of the output directory where the data only available to the
+// owner of a publication is backed up
+const OwnerDir = "owner"
+
+// Files of the owner backup
+const (
+	SubscribersFile = "subscribers.csv"
+	SettingsFile    = "publication.json"
+)
+
+// Endpoints of the publisher API
+const (
+	subscribersExportEndpoint = "subscriber/export"
+	publicationEndpoint       = "publication"
+)
+
+// OwnerBackup is the result of BackupOwnerData
+type OwnerBackup struct {
+	SubscribersPath string
+	Subscribers     int // rows of the subscriber list, without the header
+	SettingsPath    string
+}
+
+// BackupOwnerData downloads the subscriber list of a publication, as the CSV of its dashboard,
+// and its settings to the owner directory of outputDir. The publisher API requires the cookie
+// of an owner of the publication. As the subscriber list holds personal data, the files are
+// only readable by the current user.
+func BackupOwnerData(ctx context.Context, client *APIClient, outputDir string) (*OwnerBackup, error) {
+	dir := filepath.Join(outputDir, OwnerDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	backup := &OwnerBackup{
+		SubscribersPath: filepath.Join(dir, SubscribersFile),
+		SettingsPath:    filepath.Join(dir, SettingsFile),
+	}
+
+	subscribers, err := fetchAll(ctx, client, subscribersExportEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the subscribers: %w", err)
+	}
+	if trimmed := bytes.TrimSpace(subscribers); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '<') {
+		return nil, fmt.Errorf("failed to fetch the subscribers: the response is not a CSV file")
+	}
+	if err := os.WriteFile(backup.SubscribersPath, subscribers, 0600); err != nil {
+		return nil, err
+	}
+	backup.Subscribers = countCSVRows(subscribers)
+
+	settings, err := fetchAll(ctx, client, publicationEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the publication settings: %w", err)
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, settings, "", "  "); err != nil {
+		return nil, fmt.Errorf("failed to decode the publication settings: %w", err)
+	}
+	indented.WriteString("\n")
+	if err := os.WriteFile(backup.SettingsPath, indented.Bytes(), 0600); err != nil {
+		return nil, err
+	}
+
+	return backup, nil
+}
+
+// fetchAll returns the whole response of an endpoint
+func fetchAll(ctx context.Context, client *APIClient, endpoint string) ([]byte, error) {
+	body, err := client.Open(ctx, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// countCSVRows counts the records of a CSV file after its header
+func countCSVRows(data []byte) int {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil || len(records) == 0 {
+		return 0
+	}
+	return len(records) - 1
+}
@@ -0,0 +1,69 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test backing up the subscribers and settings of a publication
+func TestBackupOwnerData(t *testing.T) {
+	subscribers := "email,name,created_at\nalice@example.com,Alice,2023-01-01\n\"bob@example.com\",\"Bob, Jr.\",2023-02-01\n"
+	settingsStatus := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/subscriber/export":
+			w.Header().Set("Content-Type", "text/csv")
+			w.Write([]byte(subscribers))
+		case "/api/v1/publication":
+			w.WriteHeader(settingsStatus)
+			w.Write([]byte(`{"id":1,"name":"Example","language":"en"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(WithBackOffConfig(backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 0)))
+	client, err := NewPublicationAPIClient(fetcher, server.URL)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	backup, err := BackupOwnerData(context.Background(), client, dir)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, OwnerDir, SubscribersFile), backup.SubscribersPath)
+	assert.Equal(t, 2, backup.Subscribers)
+
+	data, err := os.ReadFile(backup.SubscribersPath)
+	require.NoError(t, err)
+	assert.Equal(t, subscribers, string(data))
+	info, err := os.Stat(backup.SubscribersPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	data, err = os.ReadFile(backup.SettingsPath)
+	require.NoError(t, err)
+	assert.Equal(t, "{\n  \"id\": 1,\n  \"name\": \"Example\",\n  \"language\": \"en\"\n}\n", string(data))
+
+	settingsStatus = http.StatusForbidden
+	_, err = BackupOwnerData(context.Background(), client, dir)
+	assert.ErrorIs(t, err, ErrAPIUnauthorized)
+
+	// An error page instead of the CSV
+	subscribers = `{"error":"Not authorized"}`
+	_, err = BackupOwnerData(context.Background(), client, t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestCountCSVRows(t *testing.T) {
+	assert.Equal(t, 0, countCSVRows(nil))
+	assert.Equal(t, 0, countCSVRows([]byte("email\n")))
+	assert.Equal(t, 1, countCSVRows([]byte("email,note\na@example.com,\"two\nlines\"")))
+}
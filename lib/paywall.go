@@ -0,0 +1,67 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Markers of the paywall boundary written by PaywallMarker. The comment is kept in HTML
+// output, and the paragraph in every format.
+const (
+	PaywallComment = "<!-- sbstck-dl:paywall -->"
+	PaywallNotice  = "Paywall: the rest of this post is for paid subscribers"
+	// PaywallTruncatedNotice replaces PaywallNotice when the paid part wasn't downloaded
+	PaywallTruncatedNotice = "Paywall: the rest of this post is for paid subscribers and wasn't downloaded"
+)
+
+// paywallJumpSelector matches the element Substack puts in the body of a post where its
+// free preview ends
+const paywallJumpSelector = "div.paywall-jump"
+
+// PaywallMarker marks where the paywall of a post falls, for posts with a free preview and
+// a paid continuation. The element Substack leaves at the boundary is replaced by a marker,
+// and a paid post cut by the paywall, see Post.Incomplete, ends with one.
+type PaywallMarker struct{}
+
+// TransformPost marks the paywall boundary in the body of the post
+func (PaywallMarker) TransformPost(ctx context.Context, post Post) (Post, error) {
+	body, err := MarkPaywall(post.BodyHTML, post.Audience == "only_paid" && post.Incomplete())
+	if err != nil {
+		return post, err
+	}
+	post.BodyHTML = body
+	return post, nil
+}
+
+// MarkPaywall replaces the paywall boundary of HTML content by a marker. If there is none and
+// truncated is set, the marker is added at the end of the content, which was cut by the
+// paywall. The content is returned as is when it has no boundary and isn't truncated.
+func MarkPaywall(content string, truncated bool) (string, error) {
+	if strings.Contains(content, "paywall-jump") {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+		if err != nil {
+			return "", fmt.Errorf("failed to parse post body: %w", err)
+		}
+		if jumps := doc.Find(paywallJumpSelector); jumps.Length() > 0 {
+			jumps.First().ReplaceWithHtml(paywallMarkerHTML(PaywallNotice))
+			jumps.Slice(1, jumps.Length()).Remove()
+			updated, err := doc.Find("body").Html()
+			if err != nil {
+				return "", fmt.Errorf("failed to render post body: %w", err)
+			}
+			return updated, nil
+		}
+	}
+	if truncated {
+		return content + paywallMarkerHTML(PaywallTruncatedNotice), nil
+	}
+	return content, nil
+}
+
+// paywallMarkerHTML returns the HTML of a paywall marker with the given notice
+func paywallMarkerHTML(notice string) string {
+	return PaywallComment + `<div class="paywall-marker"><hr/><p><em>` + notice + `</em></p><hr/></div>`
+}
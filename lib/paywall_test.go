@@ -0,0 +1,57 @@
+package lib
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test marking the paywall boundary of HTML content
+func TestMarkPaywall(t *testing.T) {
+	t.Run("boundary", func(t *testing.T) {
+		content := `<p>Free</p><div class="paywall-jump" data-component-name="PaywallToDOM"></div><p>Paid</p>`
+		marked, err := MarkPaywall(content, false)
+		require.NoError(t, err)
+		assert.Equal(t, `<p>Free</p>`+PaywallComment+`<div class="paywall-marker"><hr/><p><em>`+PaywallNotice+`</em></p><hr/></div><p>Paid</p>`, marked)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		marked, err := MarkPaywall(`<p>Free</p>`, true)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(marked, `<p>Free</p>`+PaywallComment))
+		assert.Contains(t, marked, PaywallTruncatedNotice)
+	})
+
+	t.Run("free post", func(t *testing.T) {
+		content := `<p>The paywall-jump class is explained here</p>`
+		marked, err := MarkPaywall(content, false)
+		require.NoError(t, err)
+		assert.Equal(t, content, marked)
+	})
+}
+
+// Test the paywall marker transformer and recording it for retries
+func TestPaywallMarker(t *testing.T) {
+	post := createSamplePost()
+	post.Audience = "only_paid"
+	post.WordCount = 1000
+	post.BodyHTML = `<p>Only a few words before the paywall</p>`
+
+	marked, err := PaywallMarker{}.TransformPost(context.Background(), post)
+	require.NoError(t, err)
+	assert.Contains(t, marked.BodyHTML, PaywallTruncatedNotice)
+
+	md, err := marked.ToMD(false)
+	require.NoError(t, err)
+	assert.Contains(t, md, PaywallTruncatedNotice)
+
+	opts := DefaultDownloadOptions()
+	opts.Transformers = []PostTransformer{PaywallMarker{}, Redactor{}}
+	manifestOpts := opts.ManifestOptions()
+	assert.True(t, manifestOpts.PaywallMarker)
+	assert.Equal(t, opts.Transformers, manifestOpts.DownloadOptions(".").Transformers)
+	assert.Contains(t, ReproduceCommand("https://example.com/p/a", manifestOpts, "."), "--paywall-marker")
+}
@@ -0,0 +1,752 @@
+package lib
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register the GIF decoder for embedded images
+	"image/jpeg"
+	_ "image/png" // register the PNG decoder for embedded images
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// PDF page geometry (A5 portrait, in points)
+const (
+	pdfPageWidth    = 420.0
+	pdfPageHeight   = 595.0
+	pdfMarginX      = 45.0
+	pdfMarginTop    = 55.0
+	pdfMarginBottom = 55.0
+	pdfTextWidth    = pdfPageWidth - 2*pdfMarginX
+)
+
+// pdfFont is one of the standard PDF fonts used by the writer
+type pdfFont int
+
+const (
+	pdfRegular pdfFont = iota
+	pdfBold
+	pdfItalic
+	pdfMono
+)
+
+// pdfFontNames are the base fonts of the standard PDF fonts, which don't need embedding
+var pdfFontNames = []string{"Helvetica", "Helvetica-Bold", "Helvetica-Oblique", "Courier"}
+
+// Glyph widths of the printable ASCII characters (32-126) in thousandths of an em
+var (
+	helveticaWidths = []int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = []int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
+
+// cp1252Specials maps the characters of the 0x80-0x9F range of WinAnsiEncoding
+var cp1252Specials = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88,
+	'‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E, '‘': 0x91, '’': 0x92, '“': 0x93,
+	'”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9A, '›': 0x9B,
+	'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// pdfBlockKind is the type of a block of content laid out in the PDF
+type pdfBlockKind int
+
+const (
+	pdfParagraph pdfBlockKind = iota
+	pdfHeading
+	pdfQuote
+	pdfListItem
+	pdfCode
+	pdfCaption
+	pdfImageBlock
+)
+
+// pdfBlock is a block of content of a chapter
+type pdfBlock struct {
+	Kind  pdfBlockKind
+	Level int
+	Text  string
+	Image string // path of a local image file
+}
+
+// pdfChapter is a chapter of the book
+type pdfChapter struct {
+	Title  string
+	Blocks []pdfBlock
+}
+
+// pdfImage is an image XObject
+type pdfImage struct {
+	Name       string
+	Width      int
+	Height     int
+	ColorSpace string
+	Filter     string
+	Data       []byte
+}
+
+// PDF is a simple PDF book made of chapters, with a cover, a table of contents and bookmarks.
+// It uses the standard PDF fonts, which only cover Western European characters.
+type PDF struct {
+	Title    string
+	Subtitle string
+	Author   string
+	Date     time.Time
+
+	chapters   []pdfChapter
+	coverImage string
+}
+
+// NewPDF creates an empty book with the given title
+func NewPDF(title string) *PDF {
+	return &PDF{Title: title, Date: time.Now()}
+}
+
+// AddChapter adds a chapter from an HTML fragment. Images referenced with a relative
+// path are read from baseDir; remote images are left out.
+func (p *PDF) AddChapter(title string, htmlContent string, baseDir string) error {
+	blocks, err := htmlToPDFBlocks(htmlContent, baseDir)
+	if err != nil {
+		return fmt.Errorf("failed to parse chapter %q: %w", title, err)
+	}
+	p.chapters = append(p.chapters, pdfChapter{Title: title, Blocks: blocks})
+	return nil
+}
+
+// SetCoverImage shows the image on the cover page
+func (p *PDF) SetCoverImage(imagePath string) error {
+	if _, err := loadPDFImage(imagePath); err != nil {
+		return fmt.Errorf("unsupported cover image: %w", err)
+	}
+	p.coverImage = imagePath
+	return nil
+}
+
+// ChapterCount returns the number of chapters of the book
+func (p *PDF) ChapterCount() int {
+	return len(p.chapters)
+}
+
+// htmlToPDFBlocks extracts the blocks of text and images of an HTML fragment, in document order
+func htmlToPDFBlocks(htmlContent string, baseDir string) ([]pdfBlock, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	if err != nil {
+		return nil, err
+	}
+	doc.Find("script, style, noscript").Remove()
+
+	var blocks []pdfBlock
+	doc.Find("h1, h2, h3, h4, h5, h6, p, li, pre, blockquote, img, figcaption").Each(func(i int, s *goquery.Selection) {
+		name := goquery.NodeName(s)
+		block := pdfBlock{Kind: pdfParagraph}
+
+		switch name {
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			block.Kind = pdfHeading
+			block.Level = int(name[1] - '0')
+		case "p":
+			if s.Closest("li").Length() > 0 {
+				block.Kind = pdfListItem
+			} else if s.Closest("blockquote").Length() > 0 {
+				block.Kind = pdfQuote
+			}
+		case "li":
+			if s.ChildrenFiltered("p").Length() > 0 {
+				return // rendered through its paragraphs
+			}
+			block.Kind = pdfListItem
+			// Nested lists are rendered as their own items
+			clone := s.Clone()
+			clone.Find("ul, ol").Remove()
+			block.Text = normalizeWhitespace(clone.Text())
+		case "blockquote":
+			if s.Find("p").Length() > 0 {
+				return
+			}
+			block.Kind = pdfQuote
+		case "pre":
+			block.Kind = pdfCode
+			block.Text = strings.Trim(s.Text(), "\n")
+		case "figcaption":
+			block.Kind = pdfCaption
+		case "img":
+			src, _ := s.Attr("src")
+			if src == "" || strings.Contains(src, "://") || strings.HasPrefix(src, "data:") || strings.HasPrefix(src, "//") {
+				return
+			}
+			blocks = append(blocks, pdfBlock{Kind: pdfImageBlock, Image: filepath.Join(baseDir, filepath.FromSlash(src))})
+			return
+		}
+
+		if block.Text == "" && block.Kind != pdfCode {
+			block.Text = normalizeWhitespace(s.Text())
+		}
+		if block.Text != "" {
+			blocks = append(blocks, block)
+		}
+	})
+
+	return blocks, nil
+}
+
+// WriteFile writes the book to the given path
+func (p *PDF) WriteFile(filePath string) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if err := p.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write lays out the book and writes it as a PDF document
+func (p *PDF) Write(w io.Writer) error {
+	l := &pdfLayout{images: make(map[string]*pdfImage)}
+
+	// Cover
+	l.newPage()
+	p.layoutCover(l)
+
+	// Reserve the table of contents pages, filled in once the chapter pages are known
+	tocStart := len(l.pages)
+	for i := 0; i < pdfTOCPageCount(len(p.chapters)); i++ {
+		l.newPage()
+	}
+
+	chapterPages := make([]int, len(p.chapters))
+	for i, chapter := range p.chapters {
+		l.newPage()
+		chapterPages[i] = len(l.pages) - 1
+		for _, block := range chapter.Blocks {
+			l.layoutBlock(block)
+		}
+	}
+
+	p.layoutTOC(l, tocStart, chapterPages)
+
+	// Page numbers, except on the cover
+	for i := 1; i < len(l.pages); i++ {
+		l.current = i
+		label := fmt.Sprint(i + 1)
+		l.text(pdfRegular, 9, (pdfPageWidth-pdfStringWidth(label, pdfRegular, 9))/2, 30, label)
+	}
+
+	return p.writeDocument(w, l, chapterPages)
+}
+
+// layoutCover draws the cover page
+func (p *PDF) layoutCover(l *pdfLayout) {
+	y := pdfPageHeight - 90.0
+	if p.coverImage != "" {
+		if img, err := l.image(p.coverImage); err == nil {
+			width, height := fitImage(img, pdfTextWidth, 260)
+			y -= height
+			l.drawImage(img, (pdfPageWidth-width)/2, y, width, height)
+			y -= 40
+		}
+	}
+
+	for _, line := range wrapPDFText(p.Title, pdfBold, 24, pdfTextWidth) {
+		y -= 30
+		l.text(pdfBold, 24, (pdfPageWidth-pdfStringWidth(line, pdfBold, 24))/2, y, line)
+	}
+	y -= 10
+	for _, text := range []string{p.Subtitle, p.Author} {
+		if text == "" {
+			continue
+		}
+		for _, line := range wrapPDFText(text, pdfRegular, 13, pdfTextWidth) {
+			y -= 20
+			l.text(pdfRegular, 13, (pdfPageWidth-pdfStringWidth(line, pdfRegular, 13))/2, y, line)
+		}
+	}
+}
+
+// Layout of the table of contents: the first page loses a few lines to the heading
+const (
+	pdfTOCLeading          = 16.0
+	pdfTOCEntriesPerPage   = 30 // (pdfPageHeight - pdfMarginTop - pdfMarginBottom) / pdfTOCLeading
+	pdfTOCEntriesFirstPage = pdfTOCEntriesPerPage - 2
+)
+
+// pdfTOCPageCount returns the number of pages needed by the table of contents
+func pdfTOCPageCount(chapters int) int {
+	if chapters == 0 {
+		return 0
+	}
+	if chapters <= pdfTOCEntriesFirstPage {
+		return 1
+	}
+	rest := chapters - pdfTOCEntriesFirstPage
+	return 1 + (rest+pdfTOCEntriesPerPage-1)/pdfTOCEntriesPerPage
+}
+
+// layoutTOC draws the table of contents on the reserved pages
+func (p *PDF) layoutTOC(l *pdfLayout, start int, chapterPages []int) {
+	if len(p.chapters) == 0 {
+		return
+	}
+
+	l.current = start
+	y := pdfPageHeight - pdfMarginTop - 18
+	l.text(pdfBold, 18, pdfMarginX, y, "Contents")
+	y -= 2 * pdfTOCLeading
+
+	for i, chapter := range p.chapters {
+		if y < pdfMarginBottom {
+			l.current++
+			y = pdfPageHeight - pdfMarginTop - pdfTOCLeading
+		}
+		number := fmt.Sprint(chapterPages[i] + 1)
+		numberWidth := pdfStringWidth(number, pdfRegular, 10)
+		title := truncatePDFText(chapter.Title, pdfRegular, 10, pdfTextWidth-numberWidth-15)
+		l.text(pdfRegular, 10, pdfMarginX, y, title)
+		l.text(pdfRegular, 10, pdfPageWidth-pdfMarginX-numberWidth, y, number)
+		y -= pdfTOCLeading
+	}
+	l.current = len(l.pages) - 1
+}
+
+// pdfLayout places text and images on pages
+type pdfLayout struct {
+	pages   []*bytes.Buffer
+	current int
+	y       float64
+	images  map[string]*pdfImage
+	order   []*pdfImage
+}
+
+// newPage starts a new page
+func (l *pdfLayout) newPage() {
+	l.pages = append(l.pages, &bytes.Buffer{})
+	l.current = len(l.pages) - 1
+	l.y = pdfPageHeight - pdfMarginTop
+}
+
+// ensure starts a new page if there is not enough vertical space left
+func (l *pdfLayout) ensure(height float64) {
+	if l.y-height < pdfMarginBottom && l.y < pdfPageHeight-pdfMarginTop {
+		l.newPage()
+	}
+}
+
+// text draws a line of text with its baseline at (x, y)
+func (l *pdfLayout) text(font pdfFont, size, x, y float64, s string) {
+	fmt.Fprintf(l.pages[l.current], "BT /F%d %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font+1, size, x, y, pdfEscape(pdfEncode(s)))
+}
+
+// image loads an image, registering it once for the whole document
+func (l *pdfLayout) image(path string) (*pdfImage, error) {
+	if img, ok := l.images[path]; ok {
+		return img, nil
+	}
+	img, err := loadPDFImage(path)
+	if err != nil {
+		return nil, err
+	}
+	img.Name = fmt.Sprintf("Im%d", len(l.order)+1)
+	l.images[path] = img
+	l.order = append(l.order, img)
+	return img, nil
+}
+
+// drawImage draws an image with its lower left corner at (x, y)
+func (l *pdfLayout) drawImage(img *pdfImage, x, y, width, height float64) {
+	fmt.Fprintf(l.pages[l.current], "q %.2f 0 0 %.2f %.2f %.2f cm /%s Do Q\n", width, height, x, y, img.Name)
+}
+
+// layoutBlock places a block of content at the current position
+func (l *pdfLayout) layoutBlock(block pdfBlock) {
+	font, size, indent, spaceBefore, spaceAfter := pdfRegular, 10.5, 0.0, 0.0, 7.0
+	prefix := ""
+	switch block.Kind {
+	case pdfHeading:
+		font, spaceBefore, spaceAfter = pdfBold, 8, 6
+		size = math.Max(16-2*float64(block.Level-1), 11)
+	case pdfQuote:
+		font, indent = pdfItalic, 15
+	case pdfListItem:
+		indent, spaceAfter, prefix = 12, 4, "•"
+	case pdfCode:
+		font, size = pdfMono, 8.5
+	case pdfCaption:
+		font, size = pdfItalic, 9
+	case pdfImageBlock:
+		img, err := l.image(block.Image)
+		if err != nil {
+			return
+		}
+		width, height := fitImage(img, pdfTextWidth, pdfPageHeight-pdfMarginTop-pdfMarginBottom)
+		l.ensure(height)
+		l.y -= height
+		l.drawImage(img, pdfMarginX+(pdfTextWidth-width)/2, l.y, width, height)
+		l.y -= 6
+		return
+	}
+
+	leading := size * 1.35
+	var lines []string
+	if block.Kind == pdfCode {
+		for _, line := range strings.Split(block.Text, "\n") {
+			lines = append(lines, wrapPDFText(strings.ReplaceAll(line, "\t", "    "), font, size, pdfTextWidth-indent)...)
+		}
+	} else {
+		lines = wrapPDFText(block.Text, font, size, pdfTextWidth-indent)
+	}
+
+	l.y -= spaceBefore
+	// Keep headings with the first lines of the following text
+	if block.Kind == pdfHeading {
+		l.ensure(leading * float64(len(lines)+2))
+	}
+	for i, line := range lines {
+		l.ensure(leading)
+		l.y -= leading
+		if i == 0 && prefix != "" {
+			l.text(pdfRegular, size, pdfMarginX+indent-10, l.y, prefix)
+		}
+		if block.Kind == pdfCaption {
+			fmt.Fprint(l.pages[l.current], "0.4 g\n")
+		}
+		l.text(font, size, pdfMarginX+indent, l.y, line)
+		if block.Kind == pdfCaption {
+			fmt.Fprint(l.pages[l.current], "0 g\n")
+		}
+	}
+	l.y -= spaceAfter
+}
+
+// fitImage scales an image (96 dpi) to fit in the given box, never enlarging it
+func fitImage(img *pdfImage, maxWidth, maxHeight float64) (float64, float64) {
+	width, height := float64(img.Width)*0.75, float64(img.Height)*0.75
+	scale := math.Min(1, math.Min(maxWidth/width, maxHeight/height))
+	return width * scale, height * scale
+}
+
+// loadPDFImage reads an image file for embedding. JPEG files are embedded as they are,
+// other formats are decoded and stored as compressed RGB.
+func loadPDFImage(path string) (*pdfImage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width == 0 || config.Height == 0 {
+		return nil, fmt.Errorf("empty image: %s", path)
+	}
+
+	if format == "jpeg" && (config.ColorModel == color.YCbCrModel || config.ColorModel == color.GrayModel) {
+		colorSpace := "DeviceRGB"
+		if config.ColorModel == color.GrayModel {
+			colorSpace = "DeviceGray"
+		}
+		return &pdfImage{Width: config.Width, Height: config.Height, ColorSpace: colorSpace, Filter: "DCTDecode", Data: data}, nil
+	}
+
+	var img image.Image
+	if format == "jpeg" {
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	} else {
+		img, _, err = image.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Flatten transparency onto a white background
+	bounds := img.Bounds()
+	raw := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			raw = append(raw, byte((r+0xffff-a)>>8), byte((g+0xffff-a)>>8), byte((b+0xffff-a)>>8))
+		}
+	}
+
+	compressed, err := deflate(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &pdfImage{Width: bounds.Dx(), Height: bounds.Dy(), ColorSpace: "DeviceRGB", Filter: "FlateDecode", Data: compressed}, nil
+}
+
+// writeDocument writes the PDF objects of the laid out book
+func (p *PDF) writeDocument(w io.Writer, l *pdfLayout, chapterPages []int) error {
+	const (
+		catalogObj   = 1
+		pagesObj     = 2
+		resourcesObj = 3
+		fontsObj     = 4 // one object per font
+		infoObj      = fontsObj + 4
+		outlinesObj  = infoObj + 1
+	)
+	itemsObj := outlinesObj + 1
+	imagesObj := itemsObj + len(p.chapters)
+	pageObj := imagesObj + len(l.order)
+	objectCount := pageObj + 2*len(l.pages)
+
+	pw := &pdfWriter{offsets: make([]int, objectCount)}
+	pw.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	catalog := fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R", pagesObj)
+	if len(p.chapters) > 0 {
+		catalog += fmt.Sprintf(" /Outlines %d 0 R /PageMode /UseOutlines", outlinesObj)
+	}
+	pw.object(catalogObj, catalog+" >>")
+
+	var kids []string
+	for i := range l.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageObj+2*i))
+	}
+	pw.object(pagesObj, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(l.pages)))
+
+	var fonts, xobjects []string
+	for i := range pdfFontNames {
+		fonts = append(fonts, fmt.Sprintf("/F%d %d 0 R", i+1, fontsObj+i))
+	}
+	for i, img := range l.order {
+		xobjects = append(xobjects, fmt.Sprintf("/%s %d 0 R", img.Name, imagesObj+i))
+	}
+	pw.object(resourcesObj, fmt.Sprintf("<< /Font << %s >> /XObject << %s >> >>", strings.Join(fonts, " "), strings.Join(xobjects, " ")))
+
+	for i, name := range pdfFontNames {
+		pw.object(fontsObj+i, fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+	}
+
+	info := fmt.Sprintf("<< /Title %s /Producer %s /CreationDate (D:%s)", pdfTextString(p.Title), pdfTextString("sbstck-dl"), p.Date.UTC().Format("20060102150405Z"))
+	if p.Author != "" {
+		info += " /Author " + pdfTextString(p.Author)
+	}
+	pw.object(infoObj, info+" >>")
+
+	// Bookmarks, one per chapter
+	if len(p.chapters) > 0 {
+		pw.object(outlinesObj, fmt.Sprintf("<< /Type /Outlines /First %d 0 R /Last %d 0 R /Count %d >>", itemsObj, itemsObj+len(p.chapters)-1, len(p.chapters)))
+	} else {
+		pw.object(outlinesObj, "<< /Type /Outlines /Count 0 >>")
+	}
+	for i, chapter := range p.chapters {
+		item := fmt.Sprintf("<< /Title %s /Parent %d 0 R /Dest [%d 0 R /XYZ 0 %.0f 0]", pdfTextString(chapter.Title), outlinesObj, pageObj+2*chapterPages[i], pdfPageHeight)
+		if i > 0 {
+			item += fmt.Sprintf(" /Prev %d 0 R", itemsObj+i-1)
+		}
+		if i < len(p.chapters)-1 {
+			item += fmt.Sprintf(" /Next %d 0 R", itemsObj+i+1)
+		}
+		pw.object(itemsObj+i, item+" >>")
+	}
+
+	for i, img := range l.order {
+		dict := fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /%s /BitsPerComponent 8 /Filter /%s /Length %d >>",
+			img.Width, img.Height, img.ColorSpace, img.Filter, len(img.Data))
+		pw.stream(imagesObj+i, dict, img.Data)
+	}
+
+	for i, page := range l.pages {
+		pw.object(pageObj+2*i, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.0f %.0f] /Resources %d 0 R /Contents %d 0 R >>",
+			pagesObj, pdfPageWidth, pdfPageHeight, resourcesObj, pageObj+2*i+1))
+		content, err := deflate(page.Bytes())
+		if err != nil {
+			return err
+		}
+		pw.stream(pageObj+2*i+1, fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>", len(content)), content)
+	}
+
+	xref := pw.buf.Len()
+	fmt.Fprintf(&pw.buf, "xref\n0 %d\n0000000000 65535 f \n", objectCount)
+	for _, offset := range pw.offsets[1:] {
+		fmt.Fprintf(&pw.buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pw.buf, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", objectCount, catalogObj, infoObj, xref)
+
+	_, err := w.Write(pw.buf.Bytes())
+	return err
+}
+
+// pdfWriter accumulates PDF objects and remembers their offsets for the cross-reference table
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets []int
+}
+
+// object writes an indirect object
+func (pw *pdfWriter) object(n int, body string) {
+	pw.offsets[n] = pw.buf.Len()
+	fmt.Fprintf(&pw.buf, "%d 0 obj\n%s\nendobj\n", n, body)
+}
+
+// stream writes an indirect stream object
+func (pw *pdfWriter) stream(n int, dict string, data []byte) {
+	pw.offsets[n] = pw.buf.Len()
+	fmt.Fprintf(&pw.buf, "%d 0 obj\n%s\nstream\n", n, dict)
+	pw.buf.Write(data)
+	pw.buf.WriteString("\nendstream\nendobj\n")
+}
+
+// deflate compresses data with zlib, as expected by the FlateDecode filter
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pdfEncode converts text to WinAnsiEncoding, replacing unsupported characters with '?'
+func pdfEncode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			out = append(out, ' ')
+		case r < 0x80 || (r >= 0xA0 && r <= 0xFF):
+			out = append(out, byte(r))
+		default:
+			if b, ok := cp1252Specials[r]; ok {
+				out = append(out, b)
+			} else {
+				out = append(out, '?')
+			}
+		}
+	}
+	return out
+}
+
+// pdfEscape escapes encoded text for a PDF literal string
+func pdfEscape(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		switch {
+		case c == '\\' || c == '(' || c == ')':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < 0x20 || c >= 0x80:
+			fmt.Fprintf(&sb, "\\%03o", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// pdfTextString encodes text as a UTF-16 hex string, for metadata and bookmarks
+func pdfTextString(s string) string {
+	var sb strings.Builder
+	sb.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&sb, "%04X", u)
+	}
+	sb.WriteString(">")
+	return sb.String()
+}
+
+// pdfGlyphWidth returns the width of an encoded character in thousandths of an em
+func pdfGlyphWidth(c byte, font pdfFont) int {
+	switch font {
+	case pdfMono:
+		return 600
+	case pdfBold:
+		if c >= 32 && c <= 126 {
+			return helveticaBoldWidths[c-32]
+		}
+		return 611
+	default:
+		if c >= 32 && c <= 126 {
+			return helveticaWidths[c-32]
+		}
+		return 556
+	}
+}
+
+// pdfStringWidth returns the width of a text in points
+func pdfStringWidth(s string, font pdfFont, size float64) float64 {
+	total := 0
+	for _, c := range pdfEncode(s) {
+		total += pdfGlyphWidth(c, font)
+	}
+	return float64(total) * size / 1000
+}
+
+// wrapPDFText splits text into lines fitting in the given width.
+// Words longer than a line are split.
+func wrapPDFText(text string, font pdfFont, size, width float64) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if pdfStringWidth(candidate, font, size) <= width {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		// Split words that don't fit on a line of their own
+		for pdfStringWidth(word, font, size) > width {
+			runes := []rune(word)
+			n := len(runes) - 1
+			for n > 1 && pdfStringWidth(string(runes[:n]), font, size) > width {
+				n--
+			}
+			lines = append(lines, string(runes[:n]))
+			word = string(runes[n:])
+		}
+		line = word
+	}
+	if line != "" || len(lines) == 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// truncatePDFText shortens text with an ellipsis so it fits in the given width
+func truncatePDFText(text string, font pdfFont, size, width float64) string {
+	if pdfStringWidth(text, font, size) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && pdfStringWidth(string(runes)+"…", font, size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return strings.TrimSpace(string(runes)) + "…"
+}
@@ -0,0 +1,144 @@
+package lib
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the PDF text helpers
+func TestPDFText(t *testing.T) {
+	t.Run("encoding", func(t *testing.T) {
+		assert.Equal(t, []byte("caf\xe9 \x93quoted\x94 \x80 ?"), pdfEncode("café “quoted” € 漢"))
+		assert.Equal(t, `a\(b\)\\ \351`, pdfEscape([]byte("a(b)\\ \xe9")))
+		assert.Equal(t, "<FEFF00480069>", pdfTextString("Hi"))
+	})
+
+	t.Run("widths", func(t *testing.T) {
+		assert.InDelta(t, 22.2, pdfStringWidth("i", pdfRegular, 100), 0.001)
+		assert.InDelta(t, 60.0, pdfStringWidth("i", pdfMono, 100), 0.001)
+		assert.Greater(t, pdfStringWidth("Hello", pdfBold, 10), pdfStringWidth("Hello", pdfRegular, 10))
+	})
+
+	t.Run("wrapping", func(t *testing.T) {
+		lines := wrapPDFText("the quick brown fox jumps over the lazy dog", pdfRegular, 10, 80)
+		require.Greater(t, len(lines), 1)
+		for _, line := range lines {
+			assert.LessOrEqual(t, pdfStringWidth(line, pdfRegular, 10), 80.0)
+		}
+
+		// Long words are split
+		lines = wrapPDFText("supercalifragilisticexpialidocious", pdfRegular, 10, 50)
+		assert.Greater(t, len(lines), 1)
+		assert.Equal(t, []string{""}, wrapPDFText("", pdfRegular, 10, 50))
+
+		truncated := truncatePDFText("a very long chapter title that does not fit", pdfRegular, 10, 100)
+		assert.LessOrEqual(t, pdfStringWidth(truncated, pdfRegular, 10), 100.0)
+		assert.Contains(t, truncated, "…")
+	})
+
+	t.Run("table of contents pages", func(t *testing.T) {
+		assert.Equal(t, 0, pdfTOCPageCount(0))
+		assert.Equal(t, 1, pdfTOCPageCount(pdfTOCEntriesFirstPage))
+		assert.Equal(t, 2, pdfTOCPageCount(pdfTOCEntriesFirstPage+1))
+		assert.Equal(t, 3, pdfTOCPageCount(pdfTOCEntriesFirstPage+pdfTOCEntriesPerPage+1))
+	})
+}
+
+// Test writing a PDF book
+func TestPDF(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pdf-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	imagePath := filepath.Join(tempDir, "image.png")
+	require.NoError(t, os.WriteFile(imagePath, buf.Bytes(), 0644))
+
+	book := NewPDF("My Book")
+	book.Author = "Jane Doe"
+	require.NoError(t, book.SetCoverImage(imagePath))
+	assert.Error(t, book.SetCoverImage(filepath.Join(tempDir, "missing.png")))
+
+	// Blocks are set directly so the layout doesn't depend on HTML parsing
+	long := ""
+	for i := 0; i < 400; i++ {
+		long += "word "
+	}
+	book.chapters = []pdfChapter{
+		{Title: "First", Blocks: []pdfBlock{
+			{Kind: pdfHeading, Level: 1, Text: "First"},
+			{Kind: pdfParagraph, Text: long},
+			{Kind: pdfImageBlock, Image: imagePath},
+			{Kind: pdfImageBlock, Image: filepath.Join(tempDir, "missing.png")},
+		}},
+		{Title: "Second (café)", Blocks: []pdfBlock{
+			{Kind: pdfListItem, Text: "item"},
+			{Kind: pdfCode, Text: "func main() {\n\treturn\n}"},
+		}},
+	}
+	assert.Equal(t, 2, book.ChapterCount())
+
+	path := filepath.Join(tempDir, "out", "book.pdf")
+	require.NoError(t, book.WriteFile(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	content := string(data)
+
+	assert.True(t, bytes.HasPrefix(data, []byte("%PDF-1.4")))
+	assert.True(t, bytes.HasSuffix(data, []byte("%%EOF\n")))
+	assert.Contains(t, content, "/BaseFont /Helvetica ")
+	assert.Contains(t, content, pdfTextString("My Book"))
+	assert.Contains(t, content, pdfTextString("Jane Doe"))
+	assert.Contains(t, content, pdfTextString("Second (café)"))
+	assert.Contains(t, content, "/Subtype /Image /Width 4 /Height 3")
+	// The image is embedded once even though it's used twice
+	assert.Equal(t, 1, bytes.Count(data, []byte("/Subtype /Image")))
+
+	// Cover, contents, a chapter spanning two pages and a one page chapter
+	assert.Contains(t, content, "/Count 5 >>")
+	assert.Equal(t, 5, bytes.Count(data, []byte("/Type /Page ")))
+	assert.Contains(t, content, "/Type /Outlines")
+
+	// The cross-reference table points at the objects
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(content)
+	require.NotNil(t, m)
+	xref, err := strconv.Atoi(m[1])
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data[xref:], []byte("xref\n")))
+	for _, entry := range regexp.MustCompile(`(\d{10}) 00000 n`).FindAllStringSubmatch(content, -1) {
+		offset, _ := strconv.Atoi(entry[1])
+		assert.Regexp(t, `^\d+ 0 obj`, content[offset:offset+12])
+	}
+}
+
+// Test extracting blocks from HTML
+func TestHTMLToPDFBlocks(t *testing.T) {
+	blocks, err := htmlToPDFBlocks(`<h2>Title</h2><p>Some   <b>bold</b>
+text</p><ul><li>One</li><li><p>Two</p></li></ul><blockquote><p>Quoted</p></blockquote>
+<pre>line 1
+line 2</pre><img src="https://example.com/a.png"><img src="images/b.png"><script>x()</script>`, "/base")
+	require.NoError(t, err)
+
+	assert.Equal(t, []pdfBlock{
+		{Kind: pdfHeading, Level: 2, Text: "Title"},
+		{Kind: pdfParagraph, Text: "Some bold text"},
+		{Kind: pdfListItem, Text: "One"},
+		{Kind: pdfListItem, Text: "Two"},
+		{Kind: pdfQuote, Text: "Quoted"},
+		{Kind: pdfCode, Text: "line 1\nline 2"},
+		{Kind: pdfImageBlock, Image: filepath.Join("/base", "images", "b.png")},
+	}, blocks)
+}
@@ -0,0 +1,111 @@
+package lib
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// postCacheEntryPattern matches the files of a PostCache: {slug}_{id}_{lastmod}.json
+var postCacheEntryPattern = regexp.MustCompile(`^(.+)_(\d+)_(\d{8}T\d{6}Z)\.json$`)
+
+// postCacheTimeLayout is the layout of the last modification in the names of cache files
+const postCacheTimeLayout = "20060102T150405Z"
+
+// PostCache keeps the raw data of downloaded posts (see SaveRawPost) outside the output
+// directory, one file per publication host, post ID and last modification, so that a post
+// that hasn't changed is written again without fetching it, even if its output is deleted.
+type PostCache struct {
+	Dir string
+}
+
+// NewPostCache creates a cache in dir, the sbstck-dl/posts directory of the user cache
+// directory if empty
+func NewPostCache(dir string) (*PostCache, error) {
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("no cache directory: %w", err)
+		}
+		dir = filepath.Join(cacheDir, "sbstck-dl", "posts")
+	}
+	return &PostCache{Dir: dir}, nil
+}
+
+// Put stores the raw data of a post extracted from a page. Posts without raw data are ignored.
+func (c *PostCache) Put(post Post) error {
+	if post.raw == "" {
+		return nil
+	}
+	dir, err := c.hostDir(post.CanonicalUrl)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s_%d_%s.json", post.Slug, post.Id, postLastMod(post).UTC().Format(postCacheTimeLayout))
+	return os.WriteFile(filepath.Join(dir, name), []byte(post.raw), 0600)
+}
+
+// Get returns the latest cached version of the post at postURL. When lastMod, the last
+// modification known from the sitemap, is after the cached version, the post changed since
+// it was cached and isn't returned.
+func (c *PostCache) Get(postURL string, lastMod time.Time) (Post, bool) {
+	dir, err := c.hostDir(postURL)
+	if err != nil {
+		return Post{}, false
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return Post{}, false
+	}
+
+	slug := SlugFromURL(postURL)
+	var latest string
+	var latestMod time.Time
+	for _, entry := range entries {
+		match := postCacheEntryPattern.FindStringSubmatch(entry.Name())
+		if match == nil || match[1] != slug {
+			continue
+		}
+		mod, err := time.Parse(postCacheTimeLayout, match[3])
+		if err != nil {
+			continue
+		}
+		if latest == "" || mod.After(latestMod) {
+			latest, latestMod = entry.Name(), mod
+		}
+	}
+	if latest == "" || lastMod.After(latestMod) {
+		return Post{}, false
+	}
+
+	post, err := LoadRawPost(filepath.Join(dir, latest))
+	if err != nil {
+		return Post{}, false
+	}
+	return post, true
+}
+
+// hostDir returns the directory of the posts of the publication of postURL
+func (c *PostCache) hostDir(postURL string) (string, error) {
+	u, err := url.Parse(postURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid post URL: %s", postURL)
+	}
+	return filepath.Join(c.Dir, u.Host), nil
+}
+
+// postLastMod returns when a post was last edited, or published if it never was
+func postLastMod(post Post) time.Time {
+	for _, date := range []string{post.UpdatedAt, post.PostDate} {
+		if t, err := time.Parse(time.RFC3339, date); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,104 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rawTestPost returns a post as extracted from a page, with its raw data
+func rawTestPost(t *testing.T, postURL string, id int, updatedAt string) Post {
+	data := fmt.Sprintf(`{"post":{"id":%d,"slug":%q,"title":"Post %d","canonical_url":%q,"post_date":"2023-01-01T10:00:00Z","updated_at":%q,"body_html":"<p>Version of %s</p>"}}`,
+		id, SlugFromURL(postURL), id, postURL, updatedAt, updatedAt)
+	post, err := (&RawPost{str: data}).ToPost()
+	require.NoError(t, err)
+	post.raw = data
+	return post
+}
+
+func TestPostCache(t *testing.T) {
+	cache, err := NewPostCache(t.TempDir())
+	require.NoError(t, err)
+	postURL := "https://example.substack.com/p/my-post"
+
+	_, ok := cache.Get(postURL, time.Time{})
+	assert.False(t, ok)
+
+	require.NoError(t, cache.Put(rawTestPost(t, postURL, 1, "2023-01-02T10:00:00Z")))
+	require.NoError(t, cache.Put(rawTestPost(t, postURL, 1, "2023-01-05T10:00:00Z")))
+	assert.FileExists(t, filepath.Join(cache.Dir, "example.substack.com", "my-post_1_20230105T100000Z.json"))
+
+	t.Run("latest version", func(t *testing.T) {
+		post, ok := cache.Get(postURL, time.Time{})
+		require.True(t, ok)
+		assert.Equal(t, "<p>Version of 2023-01-05T10:00:00Z</p>", post.BodyHTML)
+
+		post, ok = cache.Get(postURL, time.Date(2023, 1, 5, 0, 0, 0, 0, time.UTC))
+		require.True(t, ok)
+		assert.Equal(t, 1, post.Id)
+	})
+
+	t.Run("changed since", func(t *testing.T) {
+		_, ok := cache.Get(postURL, time.Date(2023, 1, 6, 0, 0, 0, 0, time.UTC))
+		assert.False(t, ok)
+	})
+
+	t.Run("other posts", func(t *testing.T) {
+		_, ok := cache.Get("https://example.substack.com/p/my", time.Time{})
+		assert.False(t, ok)
+		_, ok = cache.Get("https://other.substack.com/p/my-post", time.Time{})
+		assert.False(t, ok)
+	})
+
+	t.Run("posts without raw data", func(t *testing.T) {
+		require.NoError(t, cache.Put(Post{Slug: "built", CanonicalUrl: "https://example.substack.com/p/built"}))
+		_, ok := cache.Get("https://example.substack.com/p/built", time.Time{})
+		assert.False(t, ok)
+	})
+}
+
+// Test rebuilding a deleted output directory from the cache
+func TestDownloaderPostCache(t *testing.T) {
+	server := createPublicationTestServer(2)
+	defer server.Close()
+
+	var mu sync.Mutex
+	fetched := 0
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/p/") {
+			mu.Lock()
+			fetched++
+			mu.Unlock()
+			http.Error(w, "offline", http.StatusInternalServerError)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	cache, err := NewPostCache(t.TempDir())
+	require.NoError(t, err)
+	// The sitemap says post-2 changed on 2023-01-02, after the cached version
+	require.NoError(t, cache.Put(rawTestPost(t, server.URL+"/p/post-1", 1, "2023-01-01T10:00:00Z")))
+	require.NoError(t, cache.Put(rawTestPost(t, server.URL+"/p/post-2", 2, "2023-01-01T10:00:00Z")))
+
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = t.TempDir()
+	opts.Cache = cache
+	fetcher := NewFetcher(WithBackOffConfig(backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 0)))
+	summary, err := NewDownloader(fetcher, opts).DownloadPublication(context.Background(), server.URL, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, summary.Downloaded)
+	assert.Equal(t, 1, summary.Failed)
+	assert.Equal(t, 1, fetched)
+	assert.FileExists(t, filepath.Join(opts.OutputDir, "20230101_100000_post-1.html"))
+}
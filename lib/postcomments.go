@@ -0,0 +1,181 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PostComment is a comment of the discussion of a post, with its replies
+type PostComment struct {
+	ID       int           `json:"id"`
+	Name     string        `json:"name"`
+	Handle   string        `json:"handle,omitempty"`
+	Body     string        `json:"body"`
+	Date     string        `json:"date"`
+	Deleted  bool          `json:"deleted,omitempty"`
+	Children []PostComment `json:"children,omitempty"`
+}
+
+// GetPostComments fetches the whole discussion of a post, oldest comments first, with the
+// replies of each comment in its Children
+func (e *Extractor) GetPostComments(ctx context.Context, post Post) ([]PostComment, error) {
+	if post.Id == 0 {
+		return nil, errors.New("post has no id")
+	}
+	u, err := url.Parse(post.CanonicalUrl)
+	if err != nil {
+		return nil, err
+	}
+	api, err := NewPublicationAPIClient(e.fetcher, u.Scheme+"://"+u.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("all_comments", "true")
+	query.Set("sort", "oldest_first")
+	var response struct {
+		Comments []PostComment `json:"comments"`
+	}
+	if err := api.Get(ctx, fmt.Sprintf("post/%d/comments", post.Id), query, &response); err != nil {
+		return nil, err
+	}
+	return response.Comments, nil
+}
+
+// ExtractComments fetches the whole discussion of the post at postURL, as GetPostComments.
+// The id of the post is read from the archive of its publication, see GetPostMetadata.
+func (e *Extractor) ExtractComments(ctx context.Context, postURL string) ([]PostComment, error) {
+	post, err := e.GetPostMetadata(ctx, postURL)
+	if err != nil {
+		return nil, err
+	}
+	// the comments are asked to the host the post was given on, which may differ from the
+	// canonical one of the publication
+	post.CanonicalUrl = postURL
+	return e.GetPostComments(ctx, post)
+}
+
+// PostCommentsPath returns the path of the file of the comments of the post saved at postPath,
+// e.g. 20240101_120000_slug.comments.json next to 20240101_120000_slug.html
+func PostCommentsPath(postPath string) string {
+	return strings.TrimSuffix(postPath, filepath.Ext(postPath)) + ".comments.json"
+}
+
+// PostCommentsFilePath returns the path of the comments of the post saved at postPath written
+// in format, e.g. 20240101_120000_slug.comments.md next to 20240101_120000_slug.html
+func PostCommentsFilePath(postPath string, format string) string {
+	return strings.TrimSuffix(postPath, filepath.Ext(postPath)) + ".comments." + format
+}
+
+// ParseCommentsFormat validates the format the comments of posts are also written in,
+// besides JSON. "json" and "" write them in JSON only, and are returned as "".
+func ParseCommentsFormat(s string) (string, error) {
+	switch s {
+	case "", "json":
+		return "", nil
+	}
+	if containsString(commentsFileFormats, s) {
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid comments format %q: use json, html, md or txt", s)
+}
+
+// WritePostComments writes the discussion of post, saved at postPath, next to it in format
+// ("html", "md" or "txt"), each reply quoted inside the comment it answers
+func WritePostComments(postPath string, post Post, comments []PostComment, format string) error {
+	body := fmt.Sprintf(`<p class="post-date"><em>%d comments</em></p>`, CountPostComments(comments)) +
+		RenderPostCommentsHTML(comments)
+	thread := Post{
+		Title:        "Comments: " + post.Title,
+		BodyHTML:     body,
+		CanonicalUrl: post.CanonicalUrl,
+		Language:     post.Language,
+	}
+	return thread.WriteToFile(PostCommentsFilePath(postPath, format), format, false)
+}
+
+// SavePostComments saves the comments of the post saved at postPath next to it
+func SavePostComments(postPath string, comments []PostComment) error {
+	data, err := json.MarshalIndent(comments, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(PostCommentsPath(postPath), data, 0644)
+}
+
+// LoadPostComments reads the comments saved next to the post at postPath.
+// No comments and no error are returned when they were not downloaded.
+func LoadPostComments(postPath string) ([]PostComment, error) {
+	data, err := os.ReadFile(PostCommentsPath(postPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var comments []PostComment
+	if err := json.Unmarshal(data, &comments); err != nil {
+		return nil, fmt.Errorf("failed to decode comments of %s: %w", postPath, err)
+	}
+	return comments, nil
+}
+
+// CountPostComments returns the number of comments of a discussion, replies included
+func CountPostComments(comments []PostComment) int {
+	n := len(comments)
+	for _, comment := range comments {
+		n += CountPostComments(comment.Children)
+	}
+	return n
+}
+
+// RenderPostCommentsHTML renders a discussion as HTML, each reply quoted inside the comment it answers
+func RenderPostCommentsHTML(comments []PostComment) string {
+	var sb strings.Builder
+	renderPostComments(&sb, comments, "")
+	return sb.String()
+}
+
+// renderPostComments renders comments answering the comment of parent, "" for top level comments
+func renderPostComments(sb *strings.Builder, comments []PostComment, parent string) {
+	for _, comment := range comments {
+		name := comment.Name
+		if name == "" {
+			name = "Anonymous"
+		}
+		if parent != "" {
+			sb.WriteString("<blockquote>")
+		}
+		sb.WriteString(`<div class="comment">`)
+		header := "<strong>" + html.EscapeString(name) + "</strong>"
+		if parent != "" {
+			header += " in reply to " + html.EscapeString(parent)
+		}
+		if t, err := time.Parse(time.RFC3339, comment.Date); err == nil {
+			header += " · " + t.Format("January 2, 2006")
+		}
+		sb.WriteString(`<p class="comment-author">` + header + "</p>")
+		if comment.Deleted || strings.TrimSpace(comment.Body) == "" {
+			sb.WriteString("<p><em>Comment deleted</em></p>")
+		} else {
+			for _, paragraph := range strings.Split(strings.TrimSpace(comment.Body), "\n\n") {
+				paragraph = html.EscapeString(strings.TrimSpace(paragraph))
+				sb.WriteString("<p>" + strings.ReplaceAll(paragraph, "\n", "<br>") + "</p>")
+			}
+		}
+		renderPostComments(sb, comment.Children, name)
+		sb.WriteString("</div>")
+		if parent != "" {
+			sb.WriteString("</blockquote>")
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPostComments() []PostComment {
+	return []PostComment{
+		{ID: 1, Name: "Alice", Body: "Great post!\n\nSecond paragraph", Date: "2023-01-02T10:00:00Z", Children: []PostComment{
+			{ID: 2, Name: "Jane Doe", Body: "Thanks <3", Date: "2023-01-02T11:00:00Z", Children: []PostComment{
+				{ID: 3, Name: "Alice", Body: "You're welcome", Date: "2023-01-03T09:00:00Z"},
+			}},
+		}},
+		{ID: 4, Name: "Bob", Deleted: true},
+	}
+}
+
+// Test saving and loading the comments of a post
+func TestSaveAndLoadPostComments(t *testing.T) {
+	dir := t.TempDir()
+	postPath := filepath.Join(dir, "20230101_120000_first-post.html")
+	assert.Equal(t, filepath.Join(dir, "20230101_120000_first-post.comments.json"), PostCommentsPath(postPath))
+
+	comments, err := LoadPostComments(postPath)
+	require.NoError(t, err)
+	assert.Nil(t, comments)
+
+	require.NoError(t, SavePostComments(postPath, testPostComments()))
+	comments, err = LoadPostComments(postPath)
+	require.NoError(t, err)
+	assert.Equal(t, testPostComments(), comments)
+	assert.Equal(t, 4, CountPostComments(comments))
+
+	require.NoError(t, os.WriteFile(PostCommentsPath(postPath), []byte("{"), 0644))
+	_, err = LoadPostComments(postPath)
+	assert.Error(t, err)
+}
+
+// Test fetching the discussion of a post from its URL
+func TestExtractComments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/archive":
+			json.NewEncoder(w).Encode([]Post{{Id: 42, Slug: "first-post", CanonicalUrl: "https://example.com/p/first-post"}})
+		case "/api/v1/post/42/comments":
+			assert.Equal(t, "oldest_first", r.URL.Query().Get("sort"))
+			json.NewEncoder(w).Encode(map[string][]PostComment{"comments": testPostComments()})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	extractor := NewExtractor(nil)
+	comments, err := extractor.ExtractComments(context.Background(), server.URL+"/p/first-post")
+	require.NoError(t, err)
+	assert.Equal(t, testPostComments(), comments)
+
+	_, err = extractor.ExtractComments(context.Background(), server.URL+"/p/missing")
+	assert.Error(t, err)
+}
+
+// Test rendering a threaded discussion
+func TestRenderPostCommentsHTML(t *testing.T) {
+	content := RenderPostCommentsHTML(testPostComments())
+
+	assert.Contains(t, content, `<p class="comment-author"><strong>Alice</strong> · January 2, 2023</p><p>Great post!</p><p>Second paragraph</p>`)
+	assert.Contains(t, content, "<blockquote><div class=\"comment\"><p class=\"comment-author\"><strong>Jane Doe</strong> in reply to Alice · January 2, 2023</p><p>Thanks &lt;3</p>")
+	assert.Contains(t, content, "<strong>Alice</strong> in reply to Jane Doe")
+	assert.Contains(t, content, "<strong>Bob</strong></p><p><em>Comment deleted</em></p>")
+
+	// The reply to a reply is nested inside it
+	reply := strings.Index(content, "in reply to Alice")
+	nested := strings.Index(content, "in reply to Jane Doe")
+	assert.True(t, reply >= 0 && nested > reply)
+	assert.Equal(t, 2, strings.Count(content, "</blockquote>"))
+}
+
+// Test writing the discussion of a post in a readable format
+func TestWritePostComments(t *testing.T) {
+	for _, s := range []string{"", "json"} {
+		format, err := ParseCommentsFormat(s)
+		require.NoError(t, err)
+		assert.Empty(t, format)
+	}
+	_, err := ParseCommentsFormat("pdf")
+	assert.Error(t, err)
+
+	dir := t.TempDir()
+	postPath := filepath.Join(dir, "20230101_120000_first-post.html")
+	post := Post{Title: "First post", CanonicalUrl: "https://example.substack.com/p/first-post"}
+
+	require.NoError(t, WritePostComments(postPath, post, testPostComments(), "html"))
+	content, err := os.ReadFile(filepath.Join(dir, "20230101_120000_first-post.comments.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "<h1>Comments: First post</h1>")
+	assert.Contains(t, string(content), "<em>4 comments</em>")
+	assert.Contains(t, string(content), "in reply to Alice")
+
+	require.NoError(t, WritePostComments(postPath, post, testPostComments(), "md"))
+	content, err = os.ReadFile(PostCommentsFilePath(postPath, "md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "# Comments: First post")
+	assert.Contains(t, string(content), "> **Jane Doe** in reply to Alice")
+}
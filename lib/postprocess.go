@@ -0,0 +1,105 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// PostProcessor is run after each post is written, e.g. to convert, upload or announce it
+type PostProcessor interface {
+	ProcessPost(ctx context.Context, path string, meta PostMetadata) error
+}
+
+// PostMetadata describes a written post for post-processors
+type PostMetadata struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	ManifestEntry
+}
+
+// NewPostMetadata describes a post written to path in the given format
+func NewPostMetadata(post Post, path string, format string, downloadedAt time.Time) PostMetadata {
+	return PostMetadata{
+		Path:          path,
+		Format:        format,
+		ManifestEntry: NewManifestEntry(post, map[string]string{format: path}, downloadedAt),
+	}
+}
+
+// PostProcessError is returned when a post was written but one of the post-processors failed
+type PostProcessError struct {
+	Path string
+	Err  error
+}
+
+// Error returns the error message for the PostProcessError.
+func (e *PostProcessError) Error() string {
+	return fmt.Sprintf("error post-processing %s: %s", e.Path, e.Err)
+}
+
+// Unwrap returns the error of the post-processor
+func (e *PostProcessError) Unwrap() error {
+	return e.Err
+}
+
+// RunPostProcessors runs the post-processors in turn on a written post, stopping at the first error
+func RunPostProcessors(ctx context.Context, processors []PostProcessor, path string, meta PostMetadata) error {
+	for _, p := range processors {
+		if err := p.ProcessPost(ctx, path, meta); err != nil {
+			return &PostProcessError{Path: path, Err: err}
+		}
+	}
+	return nil
+}
+
+// ExecPostProcessor runs a shell command for each post. {} in the command is replaced by the
+// quoted path of the post, also available as $SBSTCK_DL_PATH, and the metadata of the post
+// is written to the standard input of the command as JSON.
+type ExecPostProcessor struct {
+	Command string
+	Stdout  io.Writer // defaults to os.Stdout
+	Stderr  io.Writer // defaults to os.Stderr
+}
+
+// NewExecPostProcessor creates a post-processor running command through the shell
+func NewExecPostProcessor(command string) *ExecPostProcessor {
+	return &ExecPostProcessor{Command: command}
+}
+
+// ProcessPost runs the command for a post
+func (p *ExecPostProcessor) ProcessPost(ctx context.Context, path string, meta PostMetadata) error {
+	stdin, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", strings.ReplaceAll(p.Command, "{}", `"`+path+`"`))
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", strings.ReplaceAll(p.Command, "{}", shellQuote(path)))
+	}
+	cmd.Env = append(os.Environ(), "SBSTCK_DL_PATH="+path)
+	cmd.Stdin = bytes.NewReader(append(stdin, '\n'))
+	cmd.Stdout = p.Stdout
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	cmd.Stderr = p.Stderr
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("command %q failed: %w", p.Command, err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingProcessor records the posts it processes, failing if err is set
+type recordingProcessor struct {
+	paths []string
+	metas []PostMetadata
+	err   error
+}
+
+func (p *recordingProcessor) ProcessPost(ctx context.Context, path string, meta PostMetadata) error {
+	p.paths = append(p.paths, path)
+	p.metas = append(p.metas, meta)
+	return p.err
+}
+
+// Test running post-processors after posts are written
+func TestDownloaderPostProcessors(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "postprocess-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	post := createSamplePost()
+	post.PostDate = "2023-01-01T10:00:00Z"
+
+	processor := &recordingProcessor{}
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = tempDir
+	opts.Format = "md"
+	opts.PostProcessors = []PostProcessor{processor}
+	downloader := NewDownloader(nil, opts)
+
+	result := downloader.WritePost(context.Background(), post)
+	require.NoError(t, result.Err)
+	require.Len(t, processor.paths, 1)
+	assert.Equal(t, result.Path, processor.paths[0])
+	assert.FileExists(t, processor.paths[0])
+	assert.Equal(t, "md", processor.metas[0].Format)
+	assert.Equal(t, post.Title, processor.metas[0].Title)
+
+	t.Run("failure", func(t *testing.T) {
+		processor.err = errors.New("upload failed")
+		result := downloader.WritePost(context.Background(), post)
+		var postProcessErr *PostProcessError
+		require.True(t, errors.As(result.Err, &postProcessErr))
+		assert.Equal(t, result.Path, postProcessErr.Path)
+		assert.Contains(t, result.Err.Error(), "upload failed")
+
+		// The written post is recorded, along with the failure
+		manifest, err := LoadManifest(tempDir)
+		require.NoError(t, err)
+		summary := &DownloadSummary{}
+		downloader.record(summary, manifest, nil, result)
+		assert.Equal(t, 1, summary.Failed)
+		_, ok := manifest.Entry(post.Slug)
+		assert.True(t, ok)
+		require.Len(t, manifest.Failures, 1)
+		assert.Equal(t, FailurePostProcess, manifest.Failures[0].Stage)
+	})
+}
+
+// Test running a shell command on written posts
+func TestExecPostProcessor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	tempDir, err := os.MkdirTemp("", "exec-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "my post.md")
+	require.NoError(t, os.WriteFile(path, []byte("# Post"), 0644))
+	meta := NewPostMetadata(createSamplePost(), path, "md", time.Now())
+
+	var stdout bytes.Buffer
+	p := NewExecPostProcessor(`wc -c < {} && cat && echo "$SBSTCK_DL_PATH"`)
+	p.Stdout = &stdout
+	require.NoError(t, p.ProcessPost(context.Background(), path, meta))
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "6", strings.TrimSpace(lines[0]))
+	var decoded PostMetadata
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &decoded))
+	assert.Equal(t, path, decoded.Path)
+	assert.Equal(t, "test-post", decoded.Slug)
+	assert.Equal(t, path, lines[2])
+
+	p = NewExecPostProcessor("exit 3")
+	p.Stderr = &bytes.Buffer{}
+	err = p.ProcessPost(context.Background(), path, meta)
+	assert.ErrorContains(t, err, `"exit 3" failed`)
+
+	opts := DefaultDownloadOptions()
+	opts.PostProcessors = []PostProcessor{NewExecPostProcessor("pandoc {} -o {}.pdf"), &recordingProcessor{}}
+	assert.Equal(t, []string{"pandoc {} -o {}.pdf"}, opts.ManifestOptions().ExecAfter)
+	assert.Len(t, opts.ManifestOptions().DownloadOptions(".").PostProcessors, 1)
+}
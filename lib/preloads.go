@@ -0,0 +1,266 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// preloadsVariable is the JavaScript variable holding the data of Substack pages
+const preloadsVariable = "window._preloads"
+
+// parsePreloads returns the JSON assigned to window._preloads in a script. Substack writes it
+// as JSON.parse("…"), JSON.parse('…'), JSON.parse of concatenated strings, or as an object literal.
+// When it is assigned several times, the value holding a post is preferred.
+func parsePreloads(script string) (string, error) {
+	values, err := preloadsValues(script)
+	if len(values) == 0 {
+		return "", err
+	}
+	return selectPreloads(values), nil
+}
+
+// preloadsValues returns the valid JSON values assigned to window._preloads in a script, in order.
+// When there is none, the error of the last assignment is returned.
+func preloadsValues(script string) ([]string, error) {
+	var values []string
+	err := errors.New("no assignment to " + preloadsVariable)
+	for offset := 0; ; {
+		i := strings.Index(script[offset:], preloadsVariable)
+		if i == -1 {
+			if len(values) > 0 {
+				return values, nil
+			}
+			return nil, err
+		}
+		offset += i + len(preloadsVariable)
+
+		rest := strings.TrimLeft(script[offset:], " \t\r\n")
+		if !strings.HasPrefix(rest, "=") || strings.HasPrefix(rest, "==") {
+			continue // not an assignment, e.g. if (window._preloads)
+		}
+		rest = strings.TrimLeft(rest[1:], " \t\r\n")
+
+		var data string
+		var parseErr error
+		switch {
+		case strings.HasPrefix(rest, "JSON.parse("):
+			data, parseErr = parseJSStringArgument(rest[len("JSON.parse("):])
+		case strings.HasPrefix(rest, "{"):
+			data, parseErr = readJSObject(rest)
+		default:
+			parseErr = fmt.Errorf("unsupported value of %s", preloadsVariable)
+		}
+		if parseErr == nil && !json.Valid([]byte(data)) {
+			parseErr = fmt.Errorf("%s is not valid JSON", preloadsVariable)
+		}
+		if parseErr != nil {
+			err = parseErr
+			continue
+		}
+		values = append(values, data)
+	}
+}
+
+// selectPreloads returns the first of the values of window._preloads holding a post, as long
+// posts may have several preloads scripts, or the first value if none does
+func selectPreloads(values []string) string {
+	for _, value := range values {
+		if hasPreloadsPost(value) {
+			return value
+		}
+	}
+	return values[0]
+}
+
+// hasPreloadsPost reports whether the JSON of window._preloads has a "post" object
+func hasPreloadsPost(data string) bool {
+	var preloads map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(data), &preloads); err != nil {
+		return false
+	}
+	post := preloads["post"]
+	return len(post) > 0 && post[0] == '{'
+}
+
+// parseJSStringArgument reads the string argument of a function call, made of one or more
+// string literals joined with +, up to the closing parenthesis
+func parseJSStringArgument(s string) (string, error) {
+	var result strings.Builder
+	i := 0
+	for {
+		i = skipJSSpace(s, i)
+		if i >= len(s) || (s[i] != '"' && s[i] != '\'') {
+			return "", errors.New("expected a string literal")
+		}
+		str, end, err := readJSString(s, i)
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(str)
+
+		i = skipJSSpace(s, end)
+		if i >= len(s) {
+			return "", errors.New("unterminated function call")
+		}
+		switch s[i] {
+		case '+':
+			i++
+		case ')':
+			return result.String(), nil
+		default:
+			return "", fmt.Errorf("unexpected %q after string literal", s[i])
+		}
+	}
+}
+
+// skipJSSpace returns the index of the first non-space character of s from i
+func skipJSSpace(s string, i int) int {
+	for i < len(s) && strings.ContainsRune(" \t\r\n", rune(s[i])) {
+		i++
+	}
+	return i
+}
+
+// readJSString decodes the string literal starting with the quote at s[start], returning
+// the index following the closing quote. Escaped surrogate pairs are combined.
+func readJSString(s string, start int) (string, int, error) {
+	quote := s[start]
+	stops := string(quote) + "\\\n"
+	var sb strings.Builder
+
+	for i := start + 1; i < len(s); {
+		// Copy the characters up to the next quote or escape at once, preloads being up to several megabytes
+		n := strings.IndexAny(s[i:], stops)
+		if n == -1 {
+			break
+		}
+		sb.WriteString(s[i : i+n])
+		i += n
+
+		switch s[i] {
+		case quote:
+			return sb.String(), i + 1, nil
+		case '\n':
+			return "", 0, errors.New("unterminated string literal")
+		}
+
+		// Escape sequence
+		i++
+		if i >= len(s) {
+			break
+		}
+		switch e := s[i]; e {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'v':
+			sb.WriteByte('\v')
+		case '0':
+			sb.WriteByte(0)
+		case '\n':
+			// line continuation
+		case '\r':
+			if i+1 < len(s) && s[i+1] == '\n' {
+				i++
+			}
+		case 'x':
+			if i+2 >= len(s) {
+				return "", 0, errors.New("invalid escape sequence \\x")
+			}
+			code, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid escape sequence \\x%s", s[i+1:i+3])
+			}
+			sb.WriteRune(rune(code))
+			i += 3
+			continue
+		case 'u':
+			r, size, err := readJSUnicodeEscape(s[i-1:])
+			if err != nil {
+				return "", 0, err
+			}
+			// A high surrogate followed by the escape of a low surrogate is a single character
+			if utf16.IsSurrogate(r) {
+				if low, lowSize, err := readJSUnicodeEscape(s[i-1+size:]); err == nil {
+					if combined := utf16.DecodeRune(r, low); combined != utf8.RuneError {
+						r = combined
+						size += lowSize
+					}
+				}
+			}
+			sb.WriteRune(r) // lone surrogates are written as U+FFFD
+			i += size - 1
+			continue
+		default:
+			r, size := utf8.DecodeRuneInString(s[i:])
+			sb.WriteRune(r)
+			i += size
+			continue
+		}
+		i++
+	}
+	return "", 0, errors.New("unterminated string literal")
+}
+
+// readJSUnicodeEscape decodes the \uXXXX or \u{X...} escape sequence at the start of s,
+// returning the code point and the length of the sequence
+func readJSUnicodeEscape(s string) (rune, int, error) {
+	if !strings.HasPrefix(s, "\\u") {
+		return 0, 0, errors.New("expected \\u escape sequence")
+	}
+	if strings.HasPrefix(s, "\\u{") {
+		end := strings.IndexByte(s, '}')
+		if end == -1 {
+			return 0, 0, errors.New("invalid escape sequence \\u{")
+		}
+		code, err := strconv.ParseUint(s[3:end], 16, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid escape sequence %s", s[:end+1])
+		}
+		return rune(code), end + 1, nil
+	}
+	if len(s) < 6 {
+		return 0, 0, errors.New("invalid escape sequence \\u")
+	}
+	code, err := strconv.ParseUint(s[2:6], 16, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid escape sequence %s", s[:6])
+	}
+	return rune(code), 6, nil
+}
+
+// readJSObject returns the object literal starting at s[0], up to its matching brace
+func readJSObject(s string) (string, error) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\'', '`':
+			// skip strings, whose braces don't count
+			for i++; i < len(s) && s[i] != c; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return s[:i+1], nil
+			}
+		}
+	}
+	return "", errors.New("unterminated object literal")
+}
@@ -0,0 +1,113 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test parsing the variants of window._preloads found on Substack pages
+func TestParsePreloads(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "preloads", "*.html"))
+	require.NoError(t, err)
+	require.NotEmpty(t, fixtures)
+
+	for _, fixture := range fixtures {
+		t.Run(filepath.Base(fixture), func(t *testing.T) {
+			page, err := os.ReadFile(fixture)
+			require.NoError(t, err)
+
+			data, err := parsePreloads(string(page))
+			require.NoError(t, err)
+			post, err := (&RawPost{str: data}).ToPost()
+			require.NoError(t, err)
+			assert.Equal(t, 1, post.Id)
+			assert.Equal(t, "fixture-post", post.Slug)
+			assert.Equal(t, `Café "quoted" & 'apostrophes'`, post.Title)
+			assert.True(t, strings.HasPrefix(post.BodyHTML, "<p>Hello"))
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		for _, script := range []string{
+			`console.log("no preloads")`,
+			`if (window._preloads) {}`,
+			`window._preloads = JSON.parse("{\"unterminated`,
+			`window._preloads = JSON.parse("{" + )`,
+			`window._preloads = JSON.parse("{malformed json}")`,
+			`window._preloads = {"post": {"id": 1}`,
+			`window._preloads = loadPreloads()`,
+		} {
+			_, err := parsePreloads(script)
+			assert.Error(t, err, script)
+		}
+	})
+}
+
+// Test choosing the preloads holding the post when they are assigned several times
+func TestParsePreloadsSeveralValues(t *testing.T) {
+	script := `window._preloads = {"base_url": "https://example.com"};
+window._preloads = JSON.parse("{\"post\": {\"id\": 2, \"slug\": \"second\"}}");
+window._preloads = {"post": {"id": 3}}`
+	values, err := preloadsValues(script)
+	require.NoError(t, err)
+	assert.Len(t, values, 3)
+
+	data, err := parsePreloads(script)
+	require.NoError(t, err)
+	post, err := (&RawPost{str: data}).ToPost()
+	require.NoError(t, err)
+	assert.Equal(t, "second", post.Slug)
+
+	// Without post, the first value is kept
+	data, err = parsePreloads(`window._preloads = {"post": null}; window._preloads = {"a": 1}`)
+	require.NoError(t, err)
+	assert.Equal(t, `{"post": null}`, data)
+
+	// Invalid assignments are skipped
+	data, err = parsePreloads(`window._preloads = JSON.parse("{broken"); window._preloads = {"post": {"id": 1}}`)
+	require.NoError(t, err)
+	assert.Equal(t, `{"post": {"id": 1}}`, data)
+}
+
+// Test decoding preloads of several megabytes
+func TestParsePreloadsLarge(t *testing.T) {
+	body := strings.Repeat(`<p>Caf\u00e9 \\\"quoted\\\" text<\/p>`, 100000)
+	script := `window._preloads = JSON.parse("{\"post\": {\"id\": 1, \"body_html\": \"` + body + `\"}}")`
+	require.Greater(t, len(script), 3000000)
+
+	data, err := parsePreloads(script)
+	require.NoError(t, err)
+	post, err := (&RawPost{str: data}).ToPost()
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat(`<p>Café "quoted" text</p>`, 100000), post.BodyHTML)
+}
+
+// Test decoding JavaScript string literals
+func TestReadJSString(t *testing.T) {
+	tests := map[string]string{
+		`"plain"`:                  "plain",
+		`'single \'quoted\''`:      "single 'quoted'",
+		`"tab\tnew\nline"`:         "tab\tnew\nline",
+		`"\x41B\u{43}"`:            "ABC",
+		`"\uD83D\uDE00 emoji"`:     "😀 emoji",
+		`"\/slash \\ back"`:        "/slash \\ back",
+		`"line \` + "\n" + `cont"`: "line cont",
+		`"lone \uD83D surrogate"`:  "lone \uFFFD surrogate",
+	}
+	for literal, expected := range tests {
+		decoded, end, err := readJSString(literal+" + rest", 0)
+		require.NoError(t, err, literal)
+		assert.Equal(t, expected, decoded, literal)
+		assert.Equal(t, len(literal), end, literal)
+	}
+
+	for _, literal := range []string{`"unterminated`, `"bad \xZZ"`, `"bad \u12"`, "\"new\nline\""} {
+		_, _, err := readJSString(literal, 0)
+		assert.Error(t, err, literal)
+	}
+}
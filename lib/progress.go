@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// ProgressEventKind is what happened in a download run
+type ProgressEventKind string
+
+const (
+	ProgressRunStarted   ProgressEventKind = "run_started"   // Total posts are about to be downloaded
+	ProgressPostStarted  ProgressEventKind = "post_started"  // the post at URL is being fetched
+	ProgressImage        ProgressEventKind = "image"         // an image of the post Slug was downloaded to Path, or failed
+	ProgressPostFinished ProgressEventKind = "post_finished" // the post at URL was written to Path
+	ProgressPostFailed   ProgressEventKind = "post_failed"   // the post at URL failed with Error
+	ProgressRunFinished  ProgressEventKind = "run_finished"  // the run is over, with its Summary
+)
+
+// ProgressEvent is a step of a download run, reported to the OnProgress function of the options
+type ProgressEvent struct {
+	Time    time.Time         `json:"time"`
+	Event   ProgressEventKind `json:"event"`
+	URL     string            `json:"url,omitempty"`
+	Slug    string            `json:"slug,omitempty"` // slug of the post of an image
+	Path    string            `json:"path,omitempty"`
+	Done    int               `json:"done,omitempty"`  // posts processed so far
+	Total   int               `json:"total,omitempty"` // posts of the run
+	Size    int64             `json:"size,omitempty"`  // size of an image
+	Bytes   int64             `json:"bytes"`           // bytes downloaded by the fetcher so far
+	Error   string            `json:"error,omitempty"`
+	Summary *DownloadSummary  `json:"summary,omitempty"`
+}
+
+// ProgressFunc is called with the progress events of a download run, possibly concurrently
+type ProgressFunc func(event ProgressEvent)
+
+// JSONProgress returns a ProgressFunc writing each event to w as a line of JSON.
+// Write errors are ignored, progress reporting never stops a run.
+func JSONProgress(w io.Writer) ProgressFunc {
+	var mu sync.Mutex
+	encoder := json.NewEncoder(w)
+	return func(event ProgressEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		encoder.Encode(event)
+	}
+}
+
+type postStartKey struct{}
+
+// withPostStart returns a context reporting to fn the URL of each post about to be fetched with it
+func withPostStart(ctx context.Context, fn func(url string)) context.Context {
+	return context.WithValue(ctx, postStartKey{}, fn)
+}
+
+// postStarted reports that the post at url is about to be fetched with ctx
+func postStarted(ctx context.Context, url string) {
+	if fn, ok := ctx.Value(postStartKey{}).(func(string)); ok {
+		fn(url)
+	}
+}
+
+// progress reports an event to OnProgress, if set
+func (d *Downloader) progress(event ProgressEvent) {
+	if d.opts.OnProgress == nil {
+		return
+	}
+	event.Time = time.Now().UTC()
+	event.Bytes = d.fetcher.BytesRead()
+	d.opts.OnProgress(event)
+}
+
+// progressContext returns a context reporting the posts fetched with it to OnProgress
+func (d *Downloader) progressContext(ctx context.Context) context.Context {
+	if d.opts.OnProgress == nil {
+		return ctx
+	}
+	return withPostStart(ctx, func(url string) {
+		d.progress(ProgressEvent{Event: ProgressPostStarted, URL: url})
+	})
+}
+
+// postProgress reports the outcome of a post, the done-th of total
+func (d *Downloader) postProgress(result PostResult, done, total int) {
+	event := ProgressEvent{Event: ProgressPostFinished, URL: result.URL, Path: result.Path, Done: done, Total: total}
+	if result.Err != nil {
+		event.Event = ProgressPostFailed
+		event.Error = result.Err.Error()
+	}
+	d.progress(event)
+}
+
+// onImage returns the function reporting the images of posts to OnImage and OnProgress, if any
+func (d *Downloader) onImage() ImageProgressFunc {
+	if d.opts.OnProgress == nil {
+		return d.opts.OnImage
+	}
+	return func(postSlug string, image ImageInfo) {
+		if d.opts.OnImage != nil {
+			d.opts.OnImage(postSlug, image)
+		}
+		event := ProgressEvent{Event: ProgressImage, URL: image.OriginalURL, Slug: postSlug, Path: image.LocalPath, Size: image.Bytes}
+		if image.Error != nil {
+			event.Error = image.Error.Error()
+		}
+		d.progress(event)
+	}
+}
@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the progress events of a run whose posts fail
+func TestDownloaderProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var events []ProgressEvent
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = t.TempDir()
+	opts.PostDelay = 50 * time.Millisecond // fetch the posts one after the other
+	opts.OnProgress = func(event ProgressEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+	downloader := NewDownloader(NewFetcher(WithRatePerSecond(100)), opts)
+
+	urls := []string{server.URL + "/p/one", server.URL + "/p/two"}
+	summary, err := downloader.DownloadPosts(context.Background(), urls, nil)
+	require.NoError(t, err)
+	require.Len(t, events, 6)
+
+	var kinds []ProgressEventKind
+	for _, event := range events {
+		kinds = append(kinds, event.Event)
+		assert.False(t, event.Time.IsZero())
+	}
+	assert.Equal(t, []ProgressEventKind{ProgressRunStarted, ProgressPostStarted, ProgressPostFailed,
+		ProgressPostStarted, ProgressPostFailed, ProgressRunFinished}, kinds)
+	assert.Equal(t, 2, events[0].Total)
+	assert.Equal(t, urls[0], events[1].URL)
+	assert.Equal(t, urls[1], events[4].URL)
+	assert.Equal(t, 2, events[4].Done)
+	assert.NotEmpty(t, events[4].Error)
+	assert.Same(t, summary, events[5].Summary)
+	assert.Equal(t, 2, events[5].Summary.Failed)
+}
+
+// Test that images are reported to both OnImage and OnProgress
+func TestDownloaderImageProgress(t *testing.T) {
+	var images []string
+	var events []ProgressEvent
+	opts := DefaultDownloadOptions()
+	opts.OnImage = func(postSlug string, image ImageInfo) { images = append(images, postSlug) }
+	downloader := NewDownloader(nil, opts)
+	assert.NotNil(t, downloader.onImage())
+
+	downloader.opts.OnProgress = func(event ProgressEvent) { events = append(events, event) }
+	downloader.onImage()("my-post", ImageInfo{OriginalURL: "https://example.com/a.png", LocalPath: "images/a.png", Bytes: 42})
+	downloader.onImage()("my-post", ImageInfo{OriginalURL: "https://example.com/b.png", Error: errors.New("gone")})
+
+	assert.Equal(t, []string{"my-post", "my-post"}, images)
+	require.Len(t, events, 2)
+	assert.Equal(t, ProgressEvent{Time: events[0].Time, Event: ProgressImage, URL: "https://example.com/a.png",
+		Slug: "my-post", Path: "images/a.png", Size: 42}, events[0])
+	assert.Equal(t, "gone", events[1].Error)
+}
+
+// Test writing the events as JSON lines
+func TestJSONProgress(t *testing.T) {
+	var buf bytes.Buffer
+	progress := JSONProgress(&buf)
+	progress(ProgressEvent{Event: ProgressRunStarted, Total: 3})
+	progress(ProgressEvent{Event: ProgressPostFailed, URL: "https://example.com/p/one", Error: "boom", Bytes: 10})
+
+	scanner := bufio.NewScanner(&buf)
+	var lines []map[string]interface{}
+	for scanner.Scan() {
+		var line map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	require.Len(t, lines, 2)
+	assert.Equal(t, "run_started", lines[0]["event"])
+	assert.Equal(t, float64(3), lines[0]["total"])
+	assert.Equal(t, float64(0), lines[0]["bytes"])
+	assert.NotContains(t, lines[0], "url")
+	assert.Equal(t, "boom", lines[1]["error"])
+	assert.Equal(t, float64(10), lines[1]["bytes"])
+}
@@ -0,0 +1,172 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// ProseMirrorNode is a node of the ProseMirror documents in which Substack stores rich text,
+// such as the body_json of notes
+type ProseMirrorNode struct {
+	Type    string                 `json:"type"`
+	Attrs   map[string]interface{} `json:"attrs,omitempty"`
+	Content []ProseMirrorNode      `json:"content,omitempty"`
+	Text    string                 `json:"text,omitempty"`
+	Marks   []ProseMirrorMark      `json:"marks,omitempty"`
+}
+
+// ProseMirrorMark is a formatting of a text node, such as bold or a link
+type ProseMirrorMark struct {
+	Type  string                 `json:"type"`
+	Attrs map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// ParseProseMirror decodes a ProseMirror document, given as JSON or as the value decoded
+// from JSON into an interface{}
+func ParseProseMirror(doc interface{}) (*ProseMirrorNode, error) {
+	var data []byte
+	switch d := doc.(type) {
+	case nil:
+		return nil, fmt.Errorf("empty document")
+	case string:
+		data = []byte(d)
+	case []byte:
+		data = d
+	default:
+		var err error
+		if data, err = json.Marshal(d); err != nil {
+			return nil, err
+		}
+	}
+	var node ProseMirrorNode
+	if err := json.Unmarshal(data, &node); err != nil {
+		return nil, fmt.Errorf("invalid ProseMirror document: %w", err)
+	}
+	return &node, nil
+}
+
+// RenderProseMirrorHTML renders a ProseMirror document to HTML. Unknown nodes are rendered
+// as their content, so that no text is lost.
+func RenderProseMirrorHTML(doc interface{}) (string, error) {
+	node, err := ParseProseMirror(doc)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	renderProseMirrorNode(&sb, *node)
+	return sb.String(), nil
+}
+
+// renderProseMirrorNode writes the HTML of a node and its content
+func renderProseMirrorNode(sb *strings.Builder, node ProseMirrorNode) {
+	content := func() {
+		for _, child := range node.Content {
+			renderProseMirrorNode(sb, child)
+		}
+	}
+	wrap := func(tag string) {
+		sb.WriteString("<" + tag + ">")
+		content()
+		sb.WriteString("</" + tag + ">")
+	}
+
+	switch node.Type {
+	case "text":
+		renderProseMirrorText(sb, node)
+	case "paragraph":
+		wrap("p")
+	case "heading":
+		level := int(proseMirrorNumber(node.Attrs["level"]))
+		if level < 1 || level > 6 {
+			level = 2
+		}
+		wrap(fmt.Sprintf("h%d", level))
+	case "blockquote", "pullquote":
+		wrap("blockquote")
+	case "bullet_list", "bulletList":
+		wrap("ul")
+	case "ordered_list", "orderedList":
+		wrap("ol")
+	case "list_item", "listItem":
+		wrap("li")
+	case "code_block", "codeBlock":
+		sb.WriteString("<pre><code>")
+		content()
+		sb.WriteString("</code></pre>")
+	case "hard_break", "hardBreak":
+		sb.WriteString("<br>")
+	case "horizontal_rule", "horizontalRule":
+		sb.WriteString("<hr>")
+	case "image", "image2", "captionedImage":
+		if src := proseMirrorString(node.Attrs["src"]); src != "" {
+			alt := proseMirrorString(node.Attrs["alt"])
+			fmt.Fprintf(sb, `<img src="%s" alt="%s">`, html.EscapeString(src), html.EscapeString(alt))
+		}
+		content()
+	case "mention":
+		renderProseMirrorMention(sb, node)
+	default:
+		content()
+	}
+}
+
+// renderProseMirrorText writes a text node with its marks
+func renderProseMirrorText(sb *strings.Builder, node ProseMirrorNode) {
+	var closing []string
+	for _, mark := range node.Marks {
+		switch mark.Type {
+		case "bold", "strong":
+			sb.WriteString("<strong>")
+			closing = append(closing, "</strong>")
+		case "italic", "em":
+			sb.WriteString("<em>")
+			closing = append(closing, "</em>")
+		case "code":
+			sb.WriteString("<code>")
+			closing = append(closing, "</code>")
+		case "strikethrough", "strike":
+			sb.WriteString("<s>")
+			closing = append(closing, "</s>")
+		case "link":
+			if href := proseMirrorString(mark.Attrs["href"]); href != "" {
+				fmt.Fprintf(sb, `<a href="%s">`, html.EscapeString(href))
+				closing = append(closing, "</a>")
+			}
+		}
+	}
+	sb.WriteString(html.EscapeString(node.Text))
+	for i := len(closing) - 1; i >= 0; i-- {
+		sb.WriteString(closing[i])
+	}
+}
+
+// renderProseMirrorMention writes a mention of a user as a link to their profile
+func renderProseMirrorMention(sb *strings.Builder, node ProseMirrorNode) {
+	name := proseMirrorString(node.Attrs["name"])
+	if name == "" {
+		name = proseMirrorString(node.Attrs["label"])
+	}
+	if name == "" {
+		return
+	}
+	label := html.EscapeString("@" + strings.TrimPrefix(name, "@"))
+	if id := proseMirrorNumber(node.Attrs["id"]); id > 0 {
+		fmt.Fprintf(sb, `<a href="https://substack.com/profile/%d">%s</a>`, int64(id), label)
+		return
+	}
+	sb.WriteString(label)
+}
+
+// proseMirrorString returns an attribute as a string, or "" if it isn't one
+func proseMirrorString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// proseMirrorNumber returns an attribute as a number, or 0 if it isn't one
+func proseMirrorNumber(v interface{}) float64 {
+	f, _ := v.(float64)
+	return f
+}
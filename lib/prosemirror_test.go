@@ -0,0 +1,77 @@
+package lib
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBodyJSON = `{"type":"doc","attrs":{"schemaVersion":"v1"},"content":[
+	{"type":"paragraph","content":[
+		{"type":"text","text":"Hello "},
+		{"type":"mention","attrs":{"name":"Jane Doe","id":42}},
+		{"type":"text","text":", read "},
+		{"type":"text","marks":[{"type":"link","attrs":{"href":"https://example.com/?a=1&b=2"}},{"type":"bold"}],"text":"this <post>"}
+	]},
+	{"type":"bullet_list","content":[{"type":"list_item","content":[{"type":"paragraph","content":[{"type":"text","marks":[{"type":"italic"}],"text":"first"}]}]}]},
+	{"type":"paragraph","content":[{"type":"text","text":"line"},{"type":"hard_break"},{"type":"text","text":"break"}]},
+	{"type":"image2","attrs":{"src":"https://substackcdn.com/image.png","alt":"A chart"}},
+	{"type":"unknownWrapper","content":[{"type":"paragraph","content":[{"type":"text","text":"kept"}]}]}
+]}`
+
+// Test rendering ProseMirror documents to HTML
+func TestRenderProseMirrorHTML(t *testing.T) {
+	expected := `<p>Hello <a href="https://substack.com/profile/42">@Jane Doe</a>, read ` +
+		`<a href="https://example.com/?a=1&amp;b=2"><strong>this &lt;post&gt;</strong></a></p>` +
+		`<ul><li><p><em>first</em></p></li></ul>` +
+		`<p>line<br>break</p>` +
+		`<img src="https://substackcdn.com/image.png" alt="A chart">` +
+		`<p>kept</p>`
+
+	// The document can be given as JSON or as decoded JSON
+	var decoded interface{}
+	require.NoError(t, json.Unmarshal([]byte(testBodyJSON), &decoded))
+	for _, doc := range []interface{}{testBodyJSON, decoded} {
+		rendered, err := RenderProseMirrorHTML(doc)
+		require.NoError(t, err)
+		assert.Equal(t, expected, rendered)
+	}
+
+	_, err := RenderProseMirrorHTML(nil)
+	assert.Error(t, err)
+	_, err = RenderProseMirrorHTML("not json")
+	assert.Error(t, err)
+}
+
+// Test that notes are saved from their body_json when their body is empty
+func TestConvertCommentToNoteBodyJSON(t *testing.T) {
+	var bodyJSON interface{}
+	require.NoError(t, json.Unmarshal([]byte(testBodyJSON), &bodyJSON))
+
+	client := NewNotesClient(NewFetcher())
+	item := ActivityItem{Context: Context{Type: "note"}}
+	note := client.ConvertCommentToNote(Comment{ID: 7, UserID: 42, BodyJSON: bodyJSON}, item)
+	require.NotNil(t, note)
+	assert.Contains(t, note.BodyHTML, "<strong>this &lt;post&gt;</strong>")
+
+	// Notes with only an image are kept
+	imageOnly := map[string]interface{}{"type": "doc", "content": []interface{}{
+		map[string]interface{}{"type": "image2", "attrs": map[string]interface{}{"src": "https://substackcdn.com/a.png"}},
+	}}
+	assert.NotNil(t, client.ConvertCommentToNote(Comment{ID: 8, BodyJSON: imageOnly}, item))
+	assert.Nil(t, client.ConvertCommentToNote(Comment{ID: 9, Body: "short"}, item))
+
+	dir := t.TempDir()
+	require.NoError(t, client.SaveNote(note, dir, "html"))
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	content, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.True(t, strings.Contains(string(content), `<a href="https://substack.com/profile/42">@Jane Doe</a>`))
+}
@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// PublicationFeed returns the publication at pubURL as an OPMLFeed, for publications given by
+// URL rather than found in an OPML file. Its folder is named as for the feeds of OPML files.
+func PublicationFeed(pubURL string) (OPMLFeed, error) {
+	raw := strings.TrimSpace(pubURL)
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return OPMLFeed{}, fmt.Errorf("invalid publication URL: %s", pubURL)
+	}
+	if strings.Contains(u.Path, "/p/") {
+		return OPMLFeed{}, fmt.Errorf("%s is the URL of a post, not of a publication", pubURL)
+	}
+
+	feed, ok := substackFeed(opmlOutline{XMLURL: u.Scheme + "://" + u.Host + "/feed"})
+	if !ok {
+		return OPMLFeed{}, fmt.Errorf("invalid publication URL: %s", pubURL)
+	}
+	return feed, nil
+}
+
+// PublicationFeeds returns the publications at the given URLs in their order, each listed once
+func PublicationFeeds(pubURLs []string) ([]OPMLFeed, error) {
+	var feeds []OPMLFeed
+	seen := make(map[string]bool)
+	for _, pubURL := range pubURLs {
+		feed, err := PublicationFeed(pubURL)
+		if err != nil {
+			return nil, err
+		}
+		if seen[feed.PublicationURL] {
+			continue
+		}
+		seen[feed.PublicationURL] = true
+		feeds = append(feeds, feed)
+	}
+	return feeds, nil
+}
+
+// LoadURLList reads a list of publication URLs from a file with one URL per line.
+// Blank lines and lines starting with # are ignored.
+func LoadURLList(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read URL list: %w", err)
+	}
+
+	var urls []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no URLs in %s", path)
+	}
+	return urls, nil
+}
@@ -0,0 +1,47 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test naming the publications given by URL
+func TestPublicationFeeds(t *testing.T) {
+	feeds, err := PublicationFeeds([]string{
+		"https://example.substack.com/",
+		"www.custom.com",
+		"https://example.substack.com/archive",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []OPMLFeed{
+		{FeedURL: "https://example.substack.com/feed", PublicationURL: "https://example.substack.com", Folder: "example"},
+		{FeedURL: "https://www.custom.com/feed", PublicationURL: "https://www.custom.com", Folder: "custom.com"},
+	}, feeds)
+
+	_, err = PublicationFeeds([]string{"https://example.substack.com/p/a-post"})
+	assert.Error(t, err)
+	_, err = PublicationFeeds([]string{"https://"})
+	assert.Error(t, err)
+}
+
+// Test reading a list of publication URLs
+func TestLoadURLList(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "urls.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# Newsletters\nhttps://example.substack.com\n\n  https://www.custom.com  \n"), 0644))
+
+	urls, err := LoadURLList(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://example.substack.com", "https://www.custom.com"}, urls)
+
+	require.NoError(t, os.WriteFile(path, []byte("# empty\n"), 0644))
+	_, err = LoadURLList(path)
+	assert.Error(t, err)
+
+	_, err = LoadURLList(filepath.Join(dir, "missing.txt"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,52 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RawPostPath returns the path of the raw data of the post saved at postPath,
+// e.g. 20240101_120000_slug.raw.json next to 20240101_120000_slug.html
+func RawPostPath(postPath string) string {
+	return strings.TrimSuffix(postPath, filepath.Ext(postPath)) + ".raw.json"
+}
+
+// SaveRawPost saves the data Substack embeds in the page of a post (window._preloads), as it
+// was extracted, next to the post saved at postPath. Nothing is written for a post that wasn't
+// extracted from a page.
+func SaveRawPost(postPath string, post Post) error {
+	if post.raw == "" {
+		return nil
+	}
+	return os.WriteFile(RawPostPath(postPath), []byte(post.raw), 0644)
+}
+
+// RawHTMLPath returns the path of the body HTML of the post saved at postPath,
+// e.g. 20240101_120000_slug.raw.html next to 20240101_120000_slug.md
+func RawHTMLPath(postPath string) string {
+	return strings.TrimSuffix(postPath, filepath.Ext(postPath)) + ".raw.html"
+}
+
+// SaveRawHTML saves the body HTML of a post exactly as it was extracted, without title, conversion
+// or rewritten links and images, next to the post saved at postPath
+func SaveRawHTML(postPath string, post Post) error {
+	return os.WriteFile(RawHTMLPath(postPath), []byte(post.BodyHTML), 0644)
+}
+
+// LoadRawPost reads a post from the raw data saved by SaveRawPost, e.g. to write it again with
+// Downloader.WritePost and the converters of a newer version, without fetching it
+func LoadRawPost(path string) (Post, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Post{}, err
+	}
+	raw := RawPost{str: string(data)}
+	post, err := raw.ToPost()
+	if err != nil {
+		return Post{}, fmt.Errorf("failed to parse raw post %s: %w", path, err)
+	}
+	post.raw = raw.str
+	return post, nil
+}
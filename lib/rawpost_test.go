@@ -0,0 +1,95 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRawPostPath(t *testing.T) {
+	assert.Equal(t, "out/20240101_120000_slug.raw.json", RawPostPath("out/20240101_120000_slug.html"))
+	assert.Equal(t, "out/host/p/slug/index.raw.json", RawPostPath("out/host/p/slug/index.md"))
+}
+
+// Test saving the raw data of posts and writing them again from it
+func TestKeepRawPost(t *testing.T) {
+	data := `{"post":{"id":1,"slug":"my-post","title":"My Post","post_date":"2024-01-01T12:00:00Z","body_html":"<p>Hello</p>","extra_field":true},"pub":{"language":"fr"}}`
+	tempDir := t.TempDir()
+
+	t.Run("saved unmodified", func(t *testing.T) {
+		post, err := (&RawPost{str: data}).ToPost()
+		require.NoError(t, err)
+		post.raw = data
+
+		opts := DefaultDownloadOptions()
+		opts.OutputDir = tempDir
+		opts.KeepRaw = true
+		opts.Transformers = []PostTransformer{NewExecTransformer("sed s/Hello/Bonjour/")}
+		result := NewDownloader(nil, opts).WritePost(context.Background(), post)
+		require.NoError(t, result.Err)
+
+		saved, err := os.ReadFile(RawPostPath(result.Path))
+		require.NoError(t, err)
+		assert.Equal(t, data, string(saved))
+	})
+
+	t.Run("loaded", func(t *testing.T) {
+		post, err := LoadRawPost(filepath.Join(tempDir, "20240101_120000_my-post.raw.json"))
+		require.NoError(t, err)
+		assert.Equal(t, "my-post", post.Slug)
+		assert.Equal(t, "<p>Hello</p>", post.BodyHTML)
+		assert.Equal(t, "fr", post.Language)
+
+		// A loaded post is saved again as is
+		path := filepath.Join(tempDir, "copy.html")
+		require.NoError(t, SaveRawPost(path, post))
+		saved, err := os.ReadFile(RawPostPath(path))
+		require.NoError(t, err)
+		assert.Equal(t, data, string(saved))
+	})
+
+	t.Run("posts not extracted from a page", func(t *testing.T) {
+		path := filepath.Join(tempDir, "built.html")
+		require.NoError(t, SaveRawPost(path, Post{Slug: "built"}))
+		assert.NoFileExists(t, RawPostPath(path))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		path := filepath.Join(tempDir, "invalid.raw.json")
+		require.NoError(t, os.WriteFile(path, []byte("{"), 0644))
+		_, err := LoadRawPost(path)
+		assert.Error(t, err)
+
+		_, err = LoadRawPost(filepath.Join(tempDir, "missing.raw.json"))
+		assert.Error(t, err)
+	})
+}
+
+// Test saving the body HTML of posts as extracted
+func TestRawHTML(t *testing.T) {
+	assert.Equal(t, "out/20240101_120000_slug.raw.html", RawHTMLPath("out/20240101_120000_slug.md"))
+
+	post := createSamplePost()
+	post.BodyHTML = `<p>Hello <a href="https://example.substack.com/p/other?utm_source=x">other</a></p>`
+
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = t.TempDir()
+	opts.Format = "md"
+	opts.RawHTML = true
+	opts.Transformers = []PostTransformer{NewExecTransformer("sed s/Hello/Bonjour/")}
+	result := NewDownloader(nil, opts).WritePost(context.Background(), post)
+	require.NoError(t, result.Err)
+
+	saved, err := os.ReadFile(RawHTMLPath(result.Path))
+	require.NoError(t, err)
+	assert.Equal(t, post.BodyHTML, string(saved))
+
+	manifestOpts := opts.ManifestOptions()
+	assert.True(t, manifestOpts.RawHTML)
+	assert.True(t, manifestOpts.DownloadOptions(".").RawHTML)
+	assert.Contains(t, ReproduceCommand("https://example.com/p/a", manifestOpts, "."), "--raw-html")
+}
@@ -0,0 +1,20 @@
+package lib
+
+import "fmt"
+
+// ReadingOrder is the order in which posts are listed in archive pages and books
+type ReadingOrder string
+
+const (
+	ReadingOrderNewestFirst ReadingOrder = "newest-first"
+	ReadingOrderOldestFirst ReadingOrder = "oldest-first"
+)
+
+// ParseReadingOrder validates a reading order
+func ParseReadingOrder(s string) (ReadingOrder, error) {
+	switch o := ReadingOrder(s); o {
+	case ReadingOrderNewestFirst, ReadingOrderOldestFirst:
+		return o, nil
+	}
+	return "", fmt.Errorf("invalid reading order %q: use newest-first or oldest-first", s)
+}
@@ -0,0 +1,43 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReadingOrder(t *testing.T) {
+	order, err := ParseReadingOrder("oldest-first")
+	assert.NoError(t, err)
+	assert.Equal(t, ReadingOrderOldestFirst, order)
+
+	order, err = ParseReadingOrder("newest-first")
+	assert.NoError(t, err)
+	assert.Equal(t, ReadingOrderNewestFirst, order)
+
+	_, err = ParseReadingOrder("random")
+	assert.Error(t, err)
+}
+
+func TestArchiveReadingOrder(t *testing.T) {
+	archive := NewArchive()
+	archive.Order = ReadingOrderOldestFirst
+	archive.AddEntry(Post{Title: "Second", PostDate: "2023-01-02T10:00:00Z"}, "second.html", time.Now())
+	archive.AddEntry(Post{Title: "Third", PostDate: "2023-01-03T10:00:00Z"}, "third.html", time.Now())
+	archive.AddEntry(Post{Title: "First", PostDate: "2023-01-01T10:00:00Z"}, "first.html", time.Now())
+
+	var titles []string
+	for _, entry := range archive.Entries {
+		titles = append(titles, entry.Post.Title)
+	}
+	assert.Equal(t, []string{"First", "Second", "Third"}, titles)
+
+	// The range of a book doesn't depend on the order of its chapters
+	posts := []LocalPost{
+		{Date: time.Date(2023, 12, 5, 0, 0, 0, 0, time.UTC)},
+		{},
+		{Date: time.Date(2023, 1, 5, 0, 0, 0, 0, time.UTC)},
+	}
+	assert.Equal(t, "January 2023 – December 2023", exportDateRange(posts))
+}
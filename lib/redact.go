@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"context"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Replacements of the redacted information
+const (
+	RedactedEmail = "[email redacted]"
+	RedactedCount = "[redacted]"
+)
+
+var (
+	emailRegex = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+
+	// Numbers of subscribers or readers, such as "Join 12,345 other subscribers" or "10K+ readers"
+	subscriberCountRegex = regexp.MustCompile(`(?i)\b\d[\d,.\s]*(?:[km]\b)?\+?(\s+(?:other\s+|paid\s+|free\s+)*(?:subscribers|readers|members)\b)`)
+
+	urlRegex = regexp.MustCompile(`https?://[^\s"'<>]+`)
+)
+
+// referralParams are the query parameters identifying who shared a link
+var referralParams = []string{"r", "ref", "referrer", "referrer_token", "referral_code", "publication_id", "post_id", "triedRedirect"}
+
+// Redactor strips email addresses, subscriber counts and referral parameters from posts,
+// so that archives can be shared without personal information
+type Redactor struct{}
+
+// TransformPost redacts the body, subtitle and description of a post
+func (Redactor) TransformPost(ctx context.Context, post Post) (Post, error) {
+	post.BodyHTML = RedactHTML(post.BodyHTML)
+	post.Subtitle = RedactHTML(post.Subtitle)
+	post.Description = RedactHTML(post.Description)
+	return post, nil
+}
+
+// RedactHTML removes the email addresses, subscriber counts and referral link parameters of HTML content
+func RedactHTML(content string) string {
+	content = urlRegex.ReplaceAllStringFunc(content, removeReferralParams)
+	content = emailRegex.ReplaceAllString(content, RedactedEmail)
+	return subscriberCountRegex.ReplaceAllString(content, RedactedCount+"$1")
+}
+
+// removeReferralParams removes the referral and tracking parameters of a URL found in HTML,
+// where & may be escaped as &amp;
+func removeReferralParams(rawURL string) string {
+	unescaped := html.UnescapeString(rawURL)
+	u, err := url.Parse(unescaped)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+
+	query := u.Query()
+	changed := false
+	for key := range query {
+		if strings.HasPrefix(key, "utm_") || containsString(referralParams, key) {
+			query.Del(key)
+			changed = true
+		}
+	}
+	if !changed {
+		return rawURL
+	}
+
+	u.RawQuery = query.Encode()
+	cleaned := u.String()
+	if unescaped != rawURL {
+		cleaned = strings.ReplaceAll(cleaned, "&", "&amp;")
+	}
+	return cleaned
+}
@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test redacting personal information from HTML
+func TestRedactHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "email",
+			input:    `<p>Write to jane.doe+news@example.co.uk or <a href="mailto:tips@example.com">us</a></p>`,
+			expected: `<p>Write to [email redacted] or <a href="mailto:[email redacted]">us</a></p>`,
+		},
+		{
+			name:     "subscriber count",
+			input:    `<p>Join 12,345 other subscribers and 10K+ paid subscribers</p>`,
+			expected: `<p>Join [redacted] other subscribers and [redacted] paid subscribers</p>`,
+		},
+		{
+			name:     "referral link",
+			input:    `<a href="https://example.substack.com/p/post?r=abc12&amp;utm_campaign=post&amp;page=2">Read</a>`,
+			expected: `<a href="https://example.substack.com/p/post?page=2">Read</a>`,
+		},
+		{
+			name:     "referral link without other parameters",
+			input:    `<a href="https://example.substack.com/subscribe?utm_source=share&referrer_token=xyz">Subscribe</a>`,
+			expected: `<a href="https://example.substack.com/subscribe">Subscribe</a>`,
+		},
+		{
+			name:     "untouched",
+			input:    `<p>In 2023, 3 people read <a href="https://example.com/?page=2&amp;q=go">this</a></p>`,
+			expected: `<p>In 2023, 3 people read <a href="https://example.com/?page=2&amp;q=go">this</a></p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, RedactHTML(tt.input))
+		})
+	}
+}
+
+// Test redacting posts and recording the option for retries
+func TestRedactor(t *testing.T) {
+	post := createSamplePost()
+	post.Subtitle = "Read by 5,000 subscribers"
+	post.BodyHTML = `<p>Contact me at author@example.com</p>`
+
+	redacted, err := Redactor{}.TransformPost(context.Background(), post)
+	require.NoError(t, err)
+	assert.Equal(t, "Read by [redacted] subscribers", redacted.Subtitle)
+	assert.Equal(t, `<p>Contact me at [email redacted]</p>`, redacted.BodyHTML)
+	assert.Equal(t, post.Title, redacted.Title)
+
+	opts := DefaultDownloadOptions()
+	opts.Transformers = []PostTransformer{NewExecTransformer("translate"), Redactor{}}
+	manifestOpts := opts.ManifestOptions()
+	assert.True(t, manifestOpts.Redact)
+	assert.Equal(t, []PostTransformer{NewExecTransformer("translate"), Redactor{}}, manifestOpts.DownloadOptions(".").Transformers)
+	assert.Contains(t, ReproduceCommand("https://example.com/p/a", manifestOpts, "."), "--redact")
+}
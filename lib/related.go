@@ -0,0 +1,167 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Scores of what two related posts have in common
+const (
+	relatedTagScore  = 3 // for each shared tag
+	relatedTermScore = 1 // for each shared significant word of the titles
+	// relatedMinScore is the score of posts sharing a tag or two words of their titles
+	relatedMinScore = 2
+)
+
+// relatedStopWords are the words of titles too common to relate posts
+var relatedStopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "from": true, "that": true, "this": true,
+	"what": true, "why": true, "how": true, "who": true, "are": true, "was": true, "you": true,
+	"your": true, "our": true, "its": true, "not": true, "but": true, "about": true, "into": true,
+	"part": true, "one": true, "two": true, "new": true, "all": true, "can": true, "will": true,
+}
+
+// relatedBlockRegex matches the block of related posts added to an HTML post, to replace it
+var relatedBlockRegex = regexp.MustCompile(`(?s)\n?<aside class="related-posts">.*?</aside>\n?`)
+
+// relatedDoc is a post as compared to the others
+type relatedDoc struct {
+	date  string
+	tags  map[string]bool
+	terms map[string]bool
+}
+
+// newRelatedDoc returns a post with these title, tags and publication date, as compared to the others
+func newRelatedDoc(title string, tags []string, date string) relatedDoc {
+	doc := relatedDoc{date: date, tags: make(map[string]bool), terms: make(map[string]bool)}
+	for _, tag := range tags {
+		doc.tags[strings.ToLower(tag)] = true
+	}
+	for _, term := range tokenize(title) {
+		if len([]rune(term)) >= 3 && !relatedStopWords[term] {
+			doc.terms[term] = true
+		}
+	}
+	return doc
+}
+
+// relatedScore returns how much two posts have in common
+func relatedScore(a, b relatedDoc) int {
+	score := 0
+	for tag := range a.tags {
+		if b.tags[tag] {
+			score += relatedTagScore
+		}
+	}
+	for term := range a.terms {
+		if b.terms[term] {
+			score += relatedTermScore
+		}
+	}
+	return score
+}
+
+// findRelated returns, for each post, the indexes of up to limit other posts related to it,
+// most related first, then newest first
+func findRelated(docs []relatedDoc, limit int) [][]int {
+	related := make([][]int, len(docs))
+	for i := range docs {
+		scores := make(map[int]int)
+		var candidates []int
+		for j := range docs {
+			if i == j {
+				continue
+			}
+			if score := relatedScore(docs[i], docs[j]); score >= relatedMinScore {
+				scores[j] = score
+				candidates = append(candidates, j)
+			}
+		}
+		sort.SliceStable(candidates, func(a, b int) bool {
+			ca, cb := candidates[a], candidates[b]
+			if scores[ca] != scores[cb] {
+				return scores[ca] > scores[cb]
+			}
+			return docs[ca].date > docs[cb].date
+		})
+		if len(candidates) > limit {
+			candidates = candidates[:limit]
+		}
+		related[i] = candidates
+	}
+	return related
+}
+
+// RelatedPostsHTML returns the block listing related posts at the end of an HTML post, each
+// given as a title and a link
+func RelatedPostsHTML(titles []string, links []string) string {
+	if len(titles) == 0 {
+		return ""
+	}
+	block := "\n<aside class=\"related-posts\">\n<h3>Related posts</h3>\n<ul>\n"
+	for i, title := range titles {
+		block += fmt.Sprintf("<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(links[i]), html.EscapeString(title))
+	}
+	return block + "</ul>\n</aside>\n"
+}
+
+// WriteRelatedPosts adds a block of up to limit related posts to the end of the HTML file of
+// each post recorded in the manifest, linking their local files. Posts are related by their
+// shared tags and title words. The block written by a previous run is replaced.
+// It returns the number of files changed.
+func WriteRelatedPosts(ctx context.Context, manifest *Manifest, limit int) (int, error) {
+	manifest.mu.Lock()
+	var entries []ManifestEntry
+	for _, entry := range manifest.Posts {
+		if _, ok := entry.Files["html"]; ok {
+			entries = append(entries, entry)
+		}
+	}
+	manifest.mu.Unlock()
+
+	docs := make([]relatedDoc, len(entries))
+	for i, entry := range entries {
+		docs[i] = newRelatedDoc(entry.Title, entry.Tags, entry.PostDate)
+	}
+	related := findRelated(docs, limit)
+
+	changed := 0
+	for i, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return changed, err
+		}
+		path := manifest.ResolvePath(entry.Files["html"])
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return changed, err
+		}
+
+		var titles, links []string
+		for _, j := range related[i] {
+			rel, err := filepath.Rel(filepath.Dir(path), manifest.ResolvePath(entries[j].Files["html"]))
+			if err != nil {
+				continue
+			}
+			titles = append(titles, entries[j].Title)
+			links = append(links, filepath.ToSlash(rel))
+		}
+		content := relatedBlockRegex.ReplaceAllString(string(data), "") + RelatedPostsHTML(titles, links)
+		if content == string(data) {
+			continue
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
@@ -0,0 +1,77 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindRelated(t *testing.T) {
+	docs := []relatedDoc{
+		newRelatedDoc("The Future of Energy Policy", []string{"Climate"}, "2024-01-01T10:00:00Z"),
+		newRelatedDoc("Energy Policy After the Election", nil, "2024-02-01T10:00:00Z"),
+		newRelatedDoc("Heat Waves", []string{"climate"}, "2024-03-01T10:00:00Z"),
+		newRelatedDoc("The Art of the Possible", nil, "2024-04-01T10:00:00Z"),
+		newRelatedDoc("Why Energy Matters", nil, "2024-05-01T10:00:00Z"),
+	}
+
+	related := findRelated(docs, 5)
+	// A shared tag weighs more than two shared words, stop words and single words don't relate posts
+	assert.Equal(t, []int{2, 1}, related[0])
+	assert.Equal(t, []int{0}, related[1])
+	assert.Empty(t, related[3])
+	assert.Empty(t, related[4])
+
+	assert.Equal(t, []int{2}, findRelated(docs, 1)[0])
+}
+
+func TestWriteRelatedPosts(t *testing.T) {
+	dir := t.TempDir()
+	manifest, err := LoadManifest(dir)
+	require.NoError(t, err)
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+	first := write("20230101_100000_first.html", "<h1>Energy Policy</h1>")
+	write("2023/20230102_100000_second.html", "<h1>Energy Policy & Markets</h1>")
+	write("20230103_100000_third.md", "# Energy Policy Again")
+
+	now := time.Now()
+	manifest.AddEntry(NewManifestEntry(Post{Id: 1, Slug: "first", Title: "Energy Policy", PostDate: "2023-01-01T10:00:00Z"},
+		map[string]string{"html": "20230101_100000_first.html"}, now))
+	manifest.AddEntry(NewManifestEntry(Post{Id: 2, Slug: "second", Title: "Energy Policy & Markets", PostDate: "2023-01-02T10:00:00Z"},
+		map[string]string{"html": "2023/20230102_100000_second.html"}, now))
+	manifest.AddEntry(NewManifestEntry(Post{Id: 3, Slug: "third", Title: "Energy Policy Again", PostDate: "2023-01-03T10:00:00Z"},
+		map[string]string{"md": "20230103_100000_third.md"}, now))
+
+	changed, err := WriteRelatedPosts(context.Background(), manifest, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 2, changed)
+
+	data, err := os.ReadFile(first)
+	require.NoError(t, err)
+	assert.Equal(t, "<h1>Energy Policy</h1>\n<aside class=\"related-posts\">\n<h3>Related posts</h3>\n<ul>\n"+
+		"<li><a href=\"2023/20230102_100000_second.html\">Energy Policy &amp; Markets</a></li>\n</ul>\n</aside>\n", string(data))
+
+	data, err = os.ReadFile(filepath.Join(dir, "2023", "20230102_100000_second.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `<a href="../20230101_100000_first.html">Energy Policy</a>`)
+
+	// The block is replaced, not added again
+	changed, err = WriteRelatedPosts(context.Background(), manifest, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 0, changed)
+	data, err = os.ReadFile(first)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "related-posts"))
+}
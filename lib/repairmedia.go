@@ -0,0 +1,155 @@
+package lib
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// remoteImageRegex matches the URLs of the images hosted by Substack in downloaded posts
+var remoteImageRegex = regexp.MustCompile(`https?://(?:substackcdn\.com/image/fetch/|substack-post-media\.s3\.amazonaws\.com/|bucketeer-[a-z0-9-]+\.s3\.amazonaws\.com/)[^\s"'<>()\[\]]+`)
+
+// MediaRepair is the result of repairing the images of a downloaded post
+type MediaRepair struct {
+	Path   string
+	Images int // images downloaded and linked locally
+	Failed int // images that couldn't be downloaded, left remote
+	Bytes  int64
+}
+
+// remoteImageGroups returns the URLs of the Substack images in content, grouped by image, as
+// the srcset of an image lists it at several sizes
+func remoteImageGroups(content string) [][]string {
+	var groups [][]string
+	index := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, u := range remoteImageRegex.FindAllString(content, -1) {
+		u = strings.TrimRight(u, ",.;")
+		if seen[u] {
+			continue
+		}
+		seen[u] = true
+
+		key := extractImageID(u)
+		if key == "" {
+			key = u
+		}
+		if i, ok := index[key]; ok {
+			groups[i] = append(groups[i], u)
+			continue
+		}
+		index[key] = len(groups)
+		groups = append(groups, []string{u})
+	}
+	return groups
+}
+
+// RepairMedia finds the downloaded posts of dir and its subdirectories whose images are still
+// linked to Substack, e.g. downloaded without --download-images, and downloads the images to
+// the images directory next to each post, rewriting the post to link them locally. Images
+// that can't be downloaded are left remote. With dryRun, the images are counted as failed
+// and nothing is downloaded or written. It returns the posts with remote images.
+func (id *ImageDownloader) RepairMedia(ctx context.Context, dir string, dryRun bool) ([]MediaRepair, error) {
+	var repairs []MediaRepair
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && d.Name() == id.imagesDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		match := localPostPattern.FindStringSubmatch(d.Name())
+		if match == nil || match[3] == "txt" {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		repair, err := id.repairPost(ctx, path, match[2], dryRun)
+		if err != nil {
+			return err
+		}
+		if repair.Images+repair.Failed > 0 {
+			repairs = append(repairs, repair)
+		}
+		return nil
+	})
+	return repairs, err
+}
+
+// repairPost downloads the remote images of a post and links them locally
+func (id *ImageDownloader) repairPost(ctx context.Context, path, slug string, dryRun bool) (MediaRepair, error) {
+	repair := MediaRepair{Path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return repair, err
+	}
+	content := string(data)
+	groups := remoteImageGroups(content)
+	if len(groups) == 0 || dryRun {
+		repair.Failed = len(groups)
+		return repair, nil
+	}
+
+	postDir := filepath.Dir(path)
+	imagesPath := filepath.Join(postDir, id.imagesDir, slug)
+	if err := os.MkdirAll(imagesPath, 0755); err != nil {
+		return repair, err
+	}
+
+	onImage := id.OnImage
+	if onImage == nil {
+		onImage = imageProgressFromContext(ctx)
+	}
+
+	var pairs [][2]string
+	for _, urls := range groups {
+		info := id.downloadSingleImage(ctx, id.repairImageURL(urls[0]), imagesPath)
+		if onImage != nil {
+			onImage(slug, info)
+		}
+		if !info.Success {
+			repair.Failed++
+			continue
+		}
+		repair.Images++
+		repair.Bytes += info.Bytes
+
+		rel, err := filepath.Rel(postDir, info.LocalPath)
+		if err != nil {
+			rel = info.LocalPath
+		}
+		for _, u := range urls {
+			pairs = append(pairs, [2]string{u, filepath.ToSlash(rel)})
+		}
+	}
+	if len(pairs) == 0 {
+		return repair, nil
+	}
+
+	// Longer URLs first, so that a URL is never replaced inside a longer one
+	sort.SliceStable(pairs, func(i, j int) bool { return len(pairs[i][0]) > len(pairs[j][0]) })
+	var replacements []string
+	for _, pair := range pairs {
+		replacements = append(replacements, pair[0], pair[1])
+	}
+
+	updated := strings.NewReplacer(replacements...).Replace(content)
+	return repair, os.WriteFile(path, []byte(updated), 0644)
+}
+
+// repairImageURL returns the URL of an image at the quality of the downloader
+func (id *ImageDownloader) repairImageURL(imageURL string) string {
+	if id.imageQuality == ImageQualityOriginal {
+		return originalImageURL(imageURL)
+	}
+	return resizeImageURL(imageURL, id.getTargetWidth())
+}
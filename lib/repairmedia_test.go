@@ -0,0 +1,113 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	repairImageURL   = "http://substackcdn.com/image/fetch/w_424,c_limit,f_auto/https%3A%2F%2Fsubstack-post-media.s3.amazonaws.com%2Fpublic%2Fimages%2F0a1b2c3d-4e5f-6789-abcd-ef0123456789_800x600.png"
+	repairImageLarge = "http://substackcdn.com/image/fetch/w_848,c_limit,f_auto/https%3A%2F%2Fsubstack-post-media.s3.amazonaws.com%2Fpublic%2Fimages%2F0a1b2c3d-4e5f-6789-abcd-ef0123456789_800x600.png"
+	repairMissingURL = "http://substackcdn.com/image/fetch/w_424/https%3A%2F%2Fsubstack-post-media.s3.amazonaws.com%2Fpublic%2Fimages%2Fffffffff-4e5f-6789-abcd-ef0123456789_missing.png"
+)
+
+// Test downloading the images of posts downloaded without --download-images
+func TestRepairMedia(t *testing.T) {
+	var requested []string
+	// Substack's CDN, reached through the server acting as a proxy
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.String())
+		if strings.Contains(r.URL.String(), "missing") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(testImageData)
+	}))
+	defer server.Close()
+	proxyURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	fetcher := NewFetcher(WithProxyURL(proxyURL), WithBackOffConfig(backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 0)))
+
+	dir := t.TempDir()
+	htmlPost := `<h1>Post</h1><img src="` + repairImageURL + `" srcset="` + repairImageURL + ` 424w, ` + repairImageLarge + ` 848w"><img src="` + repairMissingURL + `">`
+	mdPost := "# Other\n\n![image](" + repairImageURL + ")\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "20230101_100000_post.html"), []byte(htmlPost), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "2023"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2023", "20230201_100000_other.md"), []byte(mdPost), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "20230301_100000_local.md"), []byte("# Local\n\n![image](images/local/a.png)\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "20230401_100000_text.txt"), []byte(repairImageURL), 0644))
+
+	downloader := NewImageDownloader(fetcher, dir, "images", ImageQualityHigh)
+
+	postPath := filepath.Join(dir, "20230101_100000_post.html")
+	repairOf := func(repairs []MediaRepair, path string) MediaRepair {
+		for _, repair := range repairs {
+			if repair.Path == path {
+				return repair
+			}
+		}
+		t.Fatalf("no repair of %s", path)
+		return MediaRepair{}
+	}
+
+	// Nothing is downloaded or written in a dry run
+	repairs, err := downloader.RepairMedia(context.Background(), dir, true)
+	require.NoError(t, err)
+	require.Len(t, repairs, 2)
+	assert.Equal(t, 2, repairOf(repairs, postPath).Failed)
+	assert.Empty(t, requested)
+
+	repairs, err = downloader.RepairMedia(context.Background(), dir, false)
+	require.NoError(t, err)
+	require.Len(t, repairs, 2)
+
+	// The sizes of an image are downloaded once, at the requested quality
+	post := repairOf(repairs, postPath)
+	assert.Equal(t, 1, post.Images)
+	assert.Equal(t, 1, post.Failed)
+	for _, u := range requested {
+		assert.Contains(t, u, "w_1456")
+	}
+
+	data, err := os.ReadFile(post.Path)
+	require.NoError(t, err)
+	content := string(data)
+	assert.NotContains(t, content, repairImageURL)
+	assert.NotContains(t, content, repairImageLarge)
+	assert.Contains(t, content, `src="images/post/`)
+	assert.Contains(t, content, repairMissingURL)
+
+	// Images are saved next to the posts of subdirectories
+	data, err = os.ReadFile(filepath.Join(dir, "2023", "20230201_100000_other.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "![image](images/other/")
+	entries, err := os.ReadDir(filepath.Join(dir, "2023", "images", "other"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// Text posts are left alone
+	data, err = os.ReadFile(filepath.Join(dir, "20230401_100000_text.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, repairImageURL, string(data))
+}
+
+func TestRemoteImageGroups(t *testing.T) {
+	content := `<img src="` + repairImageURL + `" srcset="` + repairImageURL + ` 424w, ` + repairImageLarge + ` 848w"> ` +
+		`see https://substack-post-media.s3.amazonaws.com/public/images/photo.jpg, and https://example.com/image.png`
+	groups := remoteImageGroups(content)
+	require.Len(t, groups, 2)
+	assert.Equal(t, []string{repairImageURL, repairImageLarge}, groups[0])
+	assert.Equal(t, []string{"https://substack-post-media.s3.amazonaws.com/public/images/photo.jpg"}, groups[1])
+	assert.Empty(t, remoteImageGroups("no images here"))
+}
@@ -0,0 +1,227 @@
+package lib
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PartialSuffix is added to the name of a media file while it is downloaded. An interrupted
+// download leaves it behind, with the validators of the resource in a PartialSuffix+".json"
+// file, so that the next run resumes it instead of starting over.
+const PartialSuffix = ".part"
+
+// partialDownload is what is known about the resource of an interrupted download
+type partialDownload struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Size         int64  `json:"size,omitempty"` // size of the whole resource, 0 if unknown
+	MD5          string `json:"md5,omitempty"`  // hash of the whole resource, when the ETag gives it
+}
+
+// md5ETagRegex matches the ETags that are the MD5 hash of the content, as those of S3
+var md5ETagRegex = regexp.MustCompile(`^"?([0-9a-f]{32})"?$`)
+
+// contentRangeRegex parses the Content-Range header of a 206 response
+var contentRangeRegex = regexp.MustCompile(`^bytes (\d+)-\d+/(\d+|\*)$`)
+
+// ErrDownloadMismatch is returned when a downloaded file doesn't match the size or hash
+// announced by the server
+var ErrDownloadMismatch = errors.New("downloaded file doesn't match the size or hash announced by the server")
+
+// ErrFileTooLarge is returned when a file is larger than the maximum size of a download
+var ErrFileTooLarge = errors.New("file larger than the maximum size")
+
+// DownloadToFile downloads url to localPath and returns the size of the file. The file only
+// appears at localPath once it is complete and its size, and its MD5 hash when the server
+// gives it as ETag, match; until then it is written to localPath+PartialSuffix. A download
+// interrupted by a previous run is resumed with a range request when the resource hasn't
+// changed, and a partial file that is already complete is verified without downloading it again.
+func DownloadToFile(ctx context.Context, fetcher *Fetcher, url, localPath string) (int64, error) {
+	return downloadToFile(ctx, fetcher, url, localPath, 0)
+}
+
+// downloadToFile implements DownloadToFile. If maxSize is not 0, a larger file fails with
+// ErrFileTooLarge, as soon as its announced size is known or once that many bytes are read,
+// and its partial file is removed.
+func downloadToFile(ctx context.Context, fetcher *Fetcher, url, localPath string, maxSize int64) (int64, error) {
+	partPath := localPath + PartialSuffix
+	metaPath := partPath + ".json"
+
+	var meta partialDownload
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		if data, err := os.ReadFile(metaPath); err == nil && json.Unmarshal(data, &meta) == nil && meta.URL == url {
+			offset = info.Size()
+		}
+	}
+	if offset == 0 {
+		meta = partialDownload{URL: url}
+	}
+
+	if offset > 0 && meta.Size > 0 && offset >= meta.Size {
+		// Interrupted after the last byte, e.g. while verifying
+		if err := verifyDownload(partPath, meta); err == nil {
+			return meta.Size, finishDownload(partPath, metaPath, localPath)
+		}
+		offset = 0
+		meta = partialDownload{URL: url}
+	}
+
+	var res *http.Response
+	var err error
+	if offset > 0 {
+		ifRange := meta.ETag
+		if ifRange == "" || strings.HasPrefix(ifRange, "W/") {
+			ifRange = meta.LastModified
+		}
+		res, err = fetcher.FetchRange(ctx, url, offset, ifRange)
+		var fetchErr *FetchError
+		if errors.As(err, &fetchErr) && fetchErr.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			offset = 0
+		}
+	}
+	if offset == 0 {
+		res, err = fetcher.fetchResponse(ctx, url, nil)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	flags := os.O_WRONLY | os.O_APPEND
+	if res.StatusCode == http.StatusPartialContent {
+		start, total, ok := parseContentRange(res.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return 0, fmt.Errorf("unexpected range %q for %s", res.Header.Get("Content-Range"), url)
+		}
+		if total > 0 {
+			meta.Size = total
+		}
+	} else {
+		// The whole resource is sent
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		offset = 0
+		meta = partialDownload{
+			URL:          url,
+			ETag:         res.Header.Get("ETag"),
+			LastModified: res.Header.Get("Last-Modified"),
+		}
+		if !res.Uncompressed {
+			if res.ContentLength > 0 {
+				meta.Size = res.ContentLength
+			}
+			if m := md5ETagRegex.FindStringSubmatch(meta.ETag); m != nil {
+				meta.MD5 = m[1]
+			}
+		}
+	}
+	if maxSize > 0 && meta.Size > maxSize {
+		os.Remove(partPath)
+		os.Remove(metaPath)
+		return 0, fmt.Errorf("%s: %w: %d bytes", url, ErrFileTooLarge, meta.Size)
+	}
+	if data, err := json.Marshal(meta); err == nil {
+		if err := os.WriteFile(metaPath, data, 0644); err != nil {
+			return 0, err
+		}
+	}
+
+	file, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return 0, err
+	}
+	var body io.Reader = res.Body
+	if maxSize > 0 {
+		body = io.LimitReader(res.Body, maxSize-offset+1)
+	}
+	written, copyErr := io.Copy(file, body)
+	if err := file.Close(); copyErr == nil {
+		copyErr = err
+	}
+	if maxSize > 0 && offset+written > maxSize {
+		os.Remove(partPath)
+		os.Remove(metaPath)
+		return 0, fmt.Errorf("%s: %w of %d bytes", url, ErrFileTooLarge, maxSize)
+	}
+	if copyErr != nil {
+		// The partial file is kept for the next attempt
+		return 0, fmt.Errorf("download of %s interrupted after %d bytes: %w", url, offset+written, copyErr)
+	}
+
+	if err := verifyDownload(partPath, meta); err != nil {
+		os.Remove(partPath)
+		os.Remove(metaPath)
+		return 0, fmt.Errorf("%s: %w", url, err)
+	}
+	return offset + written, finishDownload(partPath, metaPath, localPath)
+}
+
+// verifyDownload checks the size of a downloaded file, and its MD5 hash when known
+func verifyDownload(path string, meta partialDownload) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var h hash.Hash
+	if meta.MD5 != "" {
+		h = md5.New()
+	}
+	var size int64
+	if h != nil {
+		size, err = io.Copy(h, file)
+	} else {
+		var info os.FileInfo
+		if info, err = file.Stat(); err == nil {
+			size = info.Size()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if meta.Size > 0 && size != meta.Size {
+		return fmt.Errorf("%w: %d bytes instead of %d", ErrDownloadMismatch, size, meta.Size)
+	}
+	if h != nil && hex.EncodeToString(h.Sum(nil)) != meta.MD5 {
+		return fmt.Errorf("%w: MD5 differs from ETag %s", ErrDownloadMismatch, meta.ETag)
+	}
+	return nil
+}
+
+// finishDownload moves a complete partial file to its final path
+func finishDownload(partPath, metaPath, localPath string) error {
+	if err := os.Rename(partPath, localPath); err != nil {
+		return err
+	}
+	os.Remove(metaPath)
+	return nil
+}
+
+// parseContentRange returns the first byte and the total size of a Content-Range header,
+// the total being 0 when unknown
+func parseContentRange(header string) (int64, int64, bool) {
+	m := contentRangeRegex.FindStringSubmatch(header)
+	if m == nil {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	total, _ := strconv.ParseInt(m[2], 10, 64)
+	return start, total, true
+}
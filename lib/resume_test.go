@@ -0,0 +1,188 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test resuming interrupted media downloads
+func TestDownloadToFile(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	sum := md5.Sum(content)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	var ranges []string
+	interrupt := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if interrupt {
+			// Announce the whole file but send half of it
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusOK)
+			w.Write(content[:len(content)/2])
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		switch r.URL.Path {
+		case "/corrupted":
+			w.Header().Set("ETag", `"`+hex.EncodeToString(make([]byte, 16))+`"`)
+		default:
+			w.Header().Set("ETag", etag)
+		}
+		http.ServeContent(w, r, "file.mp3", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(WithBackOffConfig(backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 0)))
+	ctx := context.Background()
+
+	t.Run("complete", func(t *testing.T) {
+		ranges = nil
+		path := filepath.Join(t.TempDir(), "file.mp3")
+		size, err := DownloadToFile(ctx, fetcher, server.URL+"/file.mp3", path)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), size)
+		assertFileContent(t, path, content)
+		assert.NoFileExists(t, path+PartialSuffix)
+		assert.NoFileExists(t, path+PartialSuffix+".json")
+		assert.Equal(t, []string{""}, ranges)
+	})
+
+	t.Run("interrupted then resumed", func(t *testing.T) {
+		ranges = nil
+		path := filepath.Join(t.TempDir(), "file.mp3")
+		interrupt = true
+		_, err := DownloadToFile(ctx, fetcher, server.URL+"/file.mp3", path)
+		interrupt = false
+		require.Error(t, err)
+		assert.NoFileExists(t, path)
+		part, err := os.ReadFile(path + PartialSuffix)
+		require.NoError(t, err)
+		assert.Equal(t, content[:len(content)/2], part)
+
+		size, err := DownloadToFile(ctx, fetcher, server.URL+"/file.mp3", path)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), size)
+		assertFileContent(t, path, content)
+		assert.Equal(t, []string{"", "bytes=5000-"}, ranges)
+		assert.NoFileExists(t, path+PartialSuffix)
+	})
+
+	t.Run("changed resource", func(t *testing.T) {
+		ranges = nil
+		path := filepath.Join(t.TempDir(), "file.mp3")
+		writePartial(t, path, []byte("stale"), partialDownload{URL: server.URL + "/file.mp3", ETag: `"old"`})
+
+		_, err := DownloadToFile(ctx, fetcher, server.URL+"/file.mp3", path)
+		require.NoError(t, err)
+		// If-Range doesn't match, so the whole file is sent again
+		assertFileContent(t, path, content)
+		assert.Equal(t, []string{"bytes=5-"}, ranges)
+	})
+
+	t.Run("partial file of another URL", func(t *testing.T) {
+		ranges = nil
+		path := filepath.Join(t.TempDir(), "file.mp3")
+		writePartial(t, path, []byte("other"), partialDownload{URL: server.URL + "/other.mp3", ETag: etag})
+
+		_, err := DownloadToFile(ctx, fetcher, server.URL+"/file.mp3", path)
+		require.NoError(t, err)
+		assertFileContent(t, path, content)
+		assert.Equal(t, []string{""}, ranges)
+	})
+
+	t.Run("already complete", func(t *testing.T) {
+		ranges = nil
+		path := filepath.Join(t.TempDir(), "file.mp3")
+		writePartial(t, path, content, partialDownload{URL: server.URL + "/file.mp3", ETag: etag, Size: int64(len(content)), MD5: hex.EncodeToString(sum[:])})
+
+		size, err := DownloadToFile(ctx, fetcher, server.URL+"/file.mp3", path)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), size)
+		assertFileContent(t, path, content)
+		assert.Empty(t, ranges)
+	})
+
+	t.Run("hash mismatch", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "file.mp3")
+		_, err := DownloadToFile(ctx, fetcher, server.URL+"/corrupted", path)
+		assert.True(t, errors.Is(err, ErrDownloadMismatch))
+		assert.NoFileExists(t, path)
+		assert.NoFileExists(t, path+PartialSuffix)
+	})
+}
+
+// Test that downloads larger than their maximum size are abandoned
+func TestDownloadToFileMaxSize(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			// No Content-Length, the size is only known once read
+			w.(http.Flusher).Flush()
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(WithBackOffConfig(backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 0)))
+	ctx := context.Background()
+
+	for _, path := range []string{"/announced", "/chunked"} {
+		localPath := filepath.Join(t.TempDir(), "file.mp4")
+		_, err := downloadToFile(ctx, fetcher, server.URL+path, localPath, 5000)
+		assert.ErrorIs(t, err, ErrFileTooLarge, path)
+		for _, leftover := range []string{localPath, localPath + PartialSuffix, localPath + PartialSuffix + ".json"} {
+			assert.NoFileExists(t, leftover, path)
+		}
+	}
+
+	size, err := downloadToFile(ctx, fetcher, server.URL+"/chunked", filepath.Join(t.TempDir(), "file.mp4"), int64(len(content)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), size)
+}
+
+func TestParseContentRange(t *testing.T) {
+	start, total, ok := parseContentRange("bytes 100-199/1000")
+	assert.True(t, ok)
+	assert.Equal(t, int64(100), start)
+	assert.Equal(t, int64(1000), total)
+
+	start, total, ok = parseContentRange("bytes 0-99/*")
+	assert.True(t, ok)
+	assert.Equal(t, int64(0), start)
+	assert.Equal(t, int64(0), total)
+
+	_, _, ok = parseContentRange("items 0-1/2")
+	assert.False(t, ok)
+}
+
+// writePartial leaves the partial download of a previous run at path
+func writePartial(t *testing.T, path string, data []byte, meta partialDownload) {
+	require.NoError(t, os.WriteFile(path+PartialSuffix, data, 0644))
+	encoded, err := json.Marshal(meta)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path+PartialSuffix+".json", encoded, 0644))
+}
+
+func assertFileContent(t *testing.T, path string, expected []byte) {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(expected, data), "content of %s differs", path)
+}
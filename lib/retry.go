@@ -0,0 +1,55 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// RetryFailedPosts downloads again the posts recorded as failed in the manifest of dir,
+// each with the options of the run it failed in. Posts that succeed are removed from the
+// failures of the manifest, posts that fail again stay there.
+// onResult, if not nil, is called after each post is processed.
+func RetryFailedPosts(ctx context.Context, f *Fetcher, dir string, onResult func(PostResult)) (*DownloadSummary, error) {
+	start := time.Now()
+	summary := &DownloadSummary{}
+
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		return summary, err
+	}
+
+	// Posts that failed with the same options are retried together
+	groups := make(map[string][]string)
+	options := make(map[string]ManifestOptions)
+	var order []string
+	for _, failure := range manifest.Failures {
+		key, err := json.Marshal(failure.Options)
+		if err != nil {
+			return summary, err
+		}
+		if _, ok := groups[string(key)]; !ok {
+			order = append(order, string(key))
+			options[string(key)] = failure.Options
+		}
+		groups[string(key)] = append(groups[string(key)], failure.URL)
+	}
+
+	for _, key := range order {
+		downloader := NewDownloader(f, options[key].DownloadOptions(dir))
+		result, err := downloader.DownloadPosts(ctx, groups[key], onResult)
+		summary.Found += result.Found
+		summary.Downloaded += result.Downloaded
+		summary.Failed += result.Failed
+		summary.ImagesOK += result.ImagesOK
+		summary.ImagesFailed += result.ImagesFailed
+		summary.ImageBytes += result.ImageBytes
+		if err != nil {
+			summary.Duration = time.Since(start)
+			return summary, err
+		}
+	}
+
+	summary.Duration = time.Since(start)
+	return summary, nil
+}
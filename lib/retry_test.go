@@ -0,0 +1,102 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test converting the options recorded with failed posts
+func TestManifestOptions(t *testing.T) {
+	opts := DefaultDownloadOptions()
+	opts.Format = "md"
+	opts.DownloadImages = true
+	opts.ImageQuality = ImageQualityMedium
+	opts.FileExtensions = []string{"pdf"}
+
+	retry := opts.ManifestOptions().DownloadOptions("out")
+	assert.Equal(t, "out", retry.OutputDir)
+	assert.Equal(t, "md", retry.Format)
+	assert.True(t, retry.DownloadImages)
+	assert.Equal(t, ImageQualityMedium, retry.ImageQuality)
+	assert.Equal(t, []string{"pdf"}, retry.FileExtensions)
+	assert.Equal(t, "images", retry.ImagesDir)
+	assert.False(t, retry.SkipExisting)
+
+	// Options recorded without defaults get them back
+	retry = ManifestOptions{Format: "txt"}.DownloadOptions("out")
+	assert.Equal(t, ImageQualityHigh, retry.ImageQuality)
+	assert.Equal(t, "files", retry.FilesDir)
+}
+
+// Test retrying the posts that failed in a previous run
+func TestRetryFailedPosts(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+
+	post := createSamplePost()
+	post.Slug = "flaky"
+	post.PostDate = "2023-01-01T10:00:00Z"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/p/flaky" || failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(createMockSubstackHTML(post)))
+	}))
+	defer server.Close()
+
+	tempDir, err := os.MkdirTemp("", "retry-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = tempDir
+	opts.Format = "txt"
+	downloader := NewDownloader(nil, opts)
+	ctx := context.Background()
+
+	summary, err := downloader.DownloadPosts(ctx, []string{server.URL + "/p/flaky", server.URL + "/p/broken"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, summary.Failed)
+
+	manifest, err := LoadManifest(tempDir)
+	require.NoError(t, err)
+	require.Len(t, manifest.Failures, 2)
+	assert.Equal(t, FailureDownload, manifest.Failures[0].Stage)
+	assert.Equal(t, "txt", manifest.Failures[0].Options.Format)
+
+	failing.Store(false)
+	var results []PostResult
+	summary, err = RetryFailedPosts(ctx, nil, tempDir, func(result PostResult) {
+		results = append(results, result)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, summary.Found)
+	assert.Equal(t, 1, summary.Downloaded)
+	assert.Equal(t, 1, summary.Failed)
+	assert.Len(t, results, 2)
+
+	// The post is written with the original format and only the broken post is left to retry
+	assert.FileExists(t, filepath.Join(tempDir, "20230101_100000_flaky.txt"))
+	manifest, err = LoadManifest(tempDir)
+	require.NoError(t, err)
+	require.Len(t, manifest.Failures, 1)
+	assert.Equal(t, "broken", manifest.Failures[0].Slug)
+	_, ok := manifest.Entry("flaky")
+	assert.True(t, ok)
+
+	t.Run("nothing to retry", func(t *testing.T) {
+		summary, err := RetryFailedPosts(ctx, nil, filepath.Join(tempDir, "empty"), nil)
+		require.NoError(t, err)
+		assert.Equal(t, 0, summary.Found)
+	})
+}
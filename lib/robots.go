@@ -0,0 +1,191 @@
+package lib
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// robotsAgent is the product token matched against the User-agent lines of robots.txt
+const robotsAgent = "sbstck-dl"
+
+// maxRobotsSize is the maximum size of robots.txt read, as recommended by RFC 9309
+const maxRobotsSize = 500 * 1024
+
+// ErrDisallowedByRobots is returned when fetching a URL disallowed by the robots.txt of its host
+var ErrDisallowedByRobots = errors.New("disallowed by robots.txt")
+
+// RobotsRules are the rules of a robots.txt file that apply to sbstck-dl
+type RobotsRules struct {
+	rules      []robotsRule
+	CrawlDelay time.Duration // Minimum delay between requests, 0 when unspecified
+}
+
+// robotsRule is an Allow or Disallow line
+type robotsRule struct {
+	pattern string
+	re      *regexp.Regexp
+	allow   bool
+}
+
+// ParseRobots parses a robots.txt file, keeping the rules of the groups for sbstck-dl,
+// or of the "*" groups when no group names it.
+func ParseRobots(r io.Reader) *RobotsRules {
+	var own, others RobotsRules
+	hasOwn := false
+
+	// Agents of the current group, and whether its rules started
+	var agents []string
+	inRules := false
+
+	scanner := bufio.NewScanner(io.LimitReader(r, maxRobotsSize))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			if inRules {
+				agents = nil
+				inRules = false
+			}
+			agents = append(agents, strings.ToLower(value))
+			continue
+		}
+		inRules = true
+
+		var targets []*RobotsRules
+		for _, agent := range agents {
+			switch {
+			case agent == "*":
+				targets = append(targets, &others)
+			case strings.Contains(robotsAgent, agent) || strings.Contains(agent, robotsAgent):
+				targets = append(targets, &own)
+				hasOwn = true
+			}
+		}
+
+		for _, t := range targets {
+			switch key {
+			case "allow", "disallow":
+				if value != "" {
+					t.rules = append(t.rules, robotsRule{pattern: value, re: compileRobotsPattern(value), allow: key == "allow"})
+				}
+			case "crawl-delay":
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					t.CrawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+
+	if hasOwn {
+		return &own
+	}
+	return &others
+}
+
+// Allowed reports whether the path (with its query) may be fetched.
+// The most specific matching rule wins, and Allow wins ties.
+func (r *RobotsRules) Allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	allowed, length := true, -1
+	for _, rule := range r.rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		if n := len(rule.pattern); n > length || (n == length && rule.allow) {
+			allowed, length = rule.allow, n
+		}
+	}
+	return allowed
+}
+
+// compileRobotsPattern converts a robots.txt pattern to a regular expression, where * matches
+// any sequence of characters and a trailing $ anchors the end of the path
+func compileRobotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// robotsRulesFor returns the robots.txt rules of the host of u, fetching them on first use.
+// A missing robots.txt allows everything. The rate limiter is slowed down to the crawl delay.
+func (f *Fetcher) robotsRulesFor(ctx context.Context, u *url.URL) (*RobotsRules, error) {
+	f.robotsMu.Lock()
+	defer f.robotsMu.Unlock()
+
+	host := u.Scheme + "://" + u.Host
+	if rules, ok := f.robots[host]; ok {
+		return rules, nil
+	}
+
+	if err := f.RateLimiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	rules := &RobotsRules{}
+	body, err := f.fetch(ctx, host+"/robots.txt")
+	if err != nil {
+		// Like a missing robots.txt, client errors allow everything
+		var fetchErr *FetchError
+		if !errors.As(err, &fetchErr) || fetchErr.TooManyRequests || fetchErr.StatusCode < 400 || fetchErr.StatusCode >= 500 {
+			return nil, fmt.Errorf("error fetching robots.txt of %s: %w", u.Host, err)
+		}
+	} else {
+		rules = ParseRobots(body)
+		body.Close()
+	}
+
+	if rules.CrawlDelay > 0 {
+		if limit := rate.Every(rules.CrawlDelay); limit < f.RateLimiter.Limit() {
+			f.RateLimiter.SetLimit(limit)
+			f.RateLimiter.SetBurst(1)
+		}
+	}
+	if f.robots == nil {
+		f.robots = make(map[string]*RobotsRules)
+	}
+	f.robots[host] = rules
+	return rules, nil
+}
+
+// checkRobots returns ErrDisallowedByRobots if robots.txt disallows fetching rawURL
+func (f *Fetcher) checkRobots(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil // Left to the request to fail
+	}
+	rules, err := f.robotsRulesFor(ctx, u)
+	if err != nil {
+		return err
+	}
+	if !rules.Allowed(u.RequestURI()) {
+		return fmt.Errorf("%w: %s", ErrDisallowedByRobots, rawURL)
+	}
+	return nil
+}
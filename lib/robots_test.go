@@ -0,0 +1,119 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+// Test parsing robots.txt groups and matching paths against their rules
+func TestParseRobots(t *testing.T) {
+	robots := `# Example robots.txt
+User-agent: *
+Disallow: /private
+Crawl-delay: 1
+
+User-agent: Googlebot
+User-agent: sbstck-dl
+Disallow: /api/
+Allow: /api/v1/archive
+Disallow: /*.pdf$
+Crawl-delay: 2.5
+`
+	rules := ParseRobots(strings.NewReader(robots))
+	assert.Equal(t, 2500*time.Millisecond, rules.CrawlDelay)
+	assert.True(t, rules.Allowed("/p/post"))
+	assert.True(t, rules.Allowed("/private"), "only the sbstck-dl group applies")
+	assert.False(t, rules.Allowed("/api/v1/posts"))
+	assert.True(t, rules.Allowed("/api/v1/archive?offset=0"))
+	assert.False(t, rules.Allowed("/files/book.pdf"))
+	assert.True(t, rules.Allowed("/files/book.pdf?download=1"))
+
+	t.Run("wildcard group", func(t *testing.T) {
+		rules := ParseRobots(strings.NewReader("User-agent: *\nDisallow: /private\nAllow: /private/ok\n\nUser-agent: other\nDisallow: /\n"))
+		assert.Equal(t, time.Duration(0), rules.CrawlDelay)
+		assert.True(t, rules.Allowed("/"))
+		assert.False(t, rules.Allowed("/private/post"))
+		assert.True(t, rules.Allowed("/private/ok"))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		rules := ParseRobots(strings.NewReader("User-agent: *\nDisallow:\n"))
+		assert.True(t, rules.Allowed("/anything"))
+	})
+}
+
+// Test a fetcher obeying robots.txt
+func TestFetcherRespectRobots(t *testing.T) {
+	var robotsFetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			atomic.AddInt32(&robotsFetches, 1)
+			w.Write([]byte("User-agent: *\nDisallow: /private\nCrawl-delay: 2\n"))
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	f := NewFetcher(WithRespectRobots(true), WithRatePerSecond(100))
+
+	body, err := f.FetchURL(ctx, server.URL+"/p/post")
+	require.NoError(t, err)
+	body.Close()
+
+	_, err = f.FetchURL(ctx, server.URL+"/private/post")
+	assert.True(t, errors.Is(err, ErrDisallowedByRobots))
+
+	// robots.txt is fetched once per host and its Crawl-delay slows down the rate
+	assert.Equal(t, int32(1), atomic.LoadInt32(&robotsFetches))
+	assert.Equal(t, rate.Every(2*time.Second), f.RateLimiter.Limit())
+	assert.Equal(t, 1, f.RateLimiter.Burst())
+
+	t.Run("disabled", func(t *testing.T) {
+		f := NewFetcher()
+		body, err := f.FetchURL(ctx, server.URL+"/private/post")
+		require.NoError(t, err)
+		body.Close()
+	})
+
+	t.Run("missing robots.txt", func(t *testing.T) {
+		missing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+		defer missing.Close()
+
+		f := NewFetcher(WithRespectRobots(true))
+		body, err := f.FetchURL(ctx, missing.URL+"/private/post")
+		require.NoError(t, err)
+		body.Close()
+		assert.Equal(t, rate.Limit(DefaultRatePerSecond), f.RateLimiter.Limit())
+	})
+
+	t.Run("unavailable robots.txt", func(t *testing.T) {
+		broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer broken.Close()
+
+		f := NewFetcher(WithRespectRobots(true))
+		_, err := f.FetchURL(ctx, broken.URL+"/p/post")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "robots.txt")
+	})
+}
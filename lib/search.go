@@ -0,0 +1,210 @@
+package lib
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	// pure Go SQLite driver, built with FTS5
+	_ "modernc.org/sqlite"
+)
+
+// SearchIndexFile is the file name of the full-text index of the posts of a directory, built
+// by the index command
+const SearchIndexFile = "search-index.db"
+
+// searchSchema creates the FTS5 table of the index. Only the title and text of the posts are
+// indexed, accents being ignored.
+const searchSchema = `
+CREATE VIRTUAL TABLE IF NOT EXISTS documents USING fts5(
+	title,
+	text,
+	path UNINDEXED,
+	slug UNINDEXED,
+	date UNINDEXED,
+	tokenize = 'unicode61 remove_diacritics 2'
+);
+`
+
+// searchTitleWeight boosts the matches in the title of the posts over the ones in their text
+const searchTitleWeight = 3.0
+
+// snippetTokens is the number of words of the snippets of the results
+const snippetTokens = 24
+
+// SearchDocument is a single indexed post
+type SearchDocument struct {
+	Path  string
+	Slug  string
+	Title string
+	Date  string
+	Text  string
+}
+
+// SearchResult is a document matching a query along with a text snippet
+type SearchResult struct {
+	Document SearchDocument
+	Score    float64
+	Snippet  string
+}
+
+// SearchIndex is a full-text index of downloaded posts in a SQLite FTS5 table
+type SearchIndex struct {
+	db *sql.DB
+}
+
+// BuildSearchIndex indexes posts at path, replacing the posts indexed there before
+func BuildSearchIndex(path string, posts []LocalPost) (*SearchIndex, error) {
+	idx, err := openSearchIndex(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := idx.replace(posts); err != nil {
+		idx.Close()
+		return nil, fmt.Errorf("failed to build search index %s: %w", path, err)
+	}
+	return idx, nil
+}
+
+// NewSearchIndex indexes posts in memory, for a process searching them as long as it runs
+func NewSearchIndex(posts []LocalPost) (*SearchIndex, error) {
+	// the database lives as long as its single connection, kept open
+	return BuildSearchIndex(":memory:", posts)
+}
+
+// OpenSearchIndex opens the index built at path by BuildSearchIndex
+func OpenSearchIndex(path string) (*SearchIndex, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to open search index: %w", err)
+	}
+	return openSearchIndex(path)
+}
+
+// openSearchIndex opens the index at path, creating the database if it doesn't exist
+func openSearchIndex(path string) (*SearchIndex, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open search index %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	if _, err := db.Exec(searchSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open search index %s: %w", path, err)
+	}
+	return &SearchIndex{db: db}, nil
+}
+
+// Close closes the database of the index
+func (idx *SearchIndex) Close() error {
+	return idx.db.Close()
+}
+
+// replace indexes posts in place of the indexed ones
+func (idx *SearchIndex) replace(posts []LocalPost) error {
+	tx, err := idx.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM documents"); err != nil {
+		return err
+	}
+	for _, post := range posts {
+		doc := NewSearchDocument(post)
+		if _, err := tx.Exec("INSERT INTO documents (title, text, path, slug, date) VALUES (?, ?, ?, ?, ?)",
+			doc.Title, doc.Text, doc.Path, doc.Slug, doc.Date); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Len returns the number of indexed posts
+func (idx *SearchIndex) Len() (int, error) {
+	var n int
+	err := idx.db.QueryRow("SELECT COUNT(*) FROM documents").Scan(&n)
+	return n, err
+}
+
+// Search returns the posts containing every word of the query, best matches first (BM25,
+// matches in the title counting more), with a snippet of their text around the matches.
+// A limit of 0 or less returns all matches.
+func (idx *SearchIndex) Search(query string, limit int) ([]SearchResult, error) {
+	match := matchQuery(query)
+	if match == "" {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := idx.db.Query(`SELECT path, slug, title, date, text, bm25(documents, ?, 1.0) AS score,
+			snippet(documents, 1, '', '', '...', ?)
+		FROM documents WHERE documents MATCH ? ORDER BY score, date DESC LIMIT ?`,
+		searchTitleWeight, snippetTokens, match, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search %q: %w", query, err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var result SearchResult
+		doc := &result.Document
+		if err := rows.Scan(&doc.Path, &doc.Slug, &doc.Title, &doc.Date, &doc.Text, &result.Score, &result.Snippet); err != nil {
+			return nil, err
+		}
+		// BM25 ranks are lower for better matches
+		result.Score = -result.Score
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// NewSearchDocument returns the document indexing a local post: its plain text and metadata
+func NewSearchDocument(post LocalPost) SearchDocument {
+	doc := SearchDocument{
+		Path:  post.Path,
+		Slug:  post.Slug,
+		Title: post.Title,
+		Text:  normalizeWhitespace(post.PlainText()),
+	}
+	if !post.Date.IsZero() {
+		doc.Date = post.Date.Format("2006-01-02")
+	}
+	return doc
+}
+
+// matchQuery turns the terms of query into an FTS5 query matching the posts containing all
+// of them, so that the syntax of FTS5 queries isn't interpreted
+func matchQuery(query string) string {
+	terms := tokenize(query)
+	for i, term := range terms {
+		terms[i] = `"` + term + `"`
+	}
+	return strings.Join(terms, " ")
+}
+
+// tokenize splits text into lowercase terms of letters and digits
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := fields[:0]
+	for _, f := range fields {
+		if len([]rune(f)) >= 2 {
+			terms = append(terms, f)
+		}
+	}
+	return terms
+}
+
+// normalizeWhitespace collapses all runs of whitespace into single spaces
+func normalizeWhitespace(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
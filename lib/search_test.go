@@ -0,0 +1,116 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test tokenization of text into search terms
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"simple words", "Hello World", []string{"hello", "world"}},
+		{"punctuation", "climate-policy, energy!", []string{"climate", "policy", "energy"}},
+		{"short tokens dropped", "a b cd", []string{"cd"}},
+		{"unicode", "Über café", []string{"über", "café"}},
+		{"empty", "", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ElementsMatch(t, tt.expected, tokenize(tt.input))
+		})
+	}
+}
+
+// Test building and querying the search index
+func TestSearchIndex(t *testing.T) {
+	tempDir := createLocalArchive(t)
+	defer os.RemoveAll(tempDir)
+
+	posts, err := ScanLocalPosts(tempDir)
+	require.NoError(t, err)
+
+	indexPath := filepath.Join(t.TempDir(), SearchIndexFile)
+	idx, err := BuildSearchIndex(indexPath, posts)
+	require.NoError(t, err)
+	n, err := idx.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	search := func(query string, limit int) []SearchResult {
+		results, err := idx.Search(query, limit)
+		require.NoError(t, err)
+		return results
+	}
+
+	t.Run("single term ranks by relevance", func(t *testing.T) {
+		results := search("climate", 0)
+		require.Len(t, results, 2)
+		assert.Equal(t, "third-post", results[0].Document.Slug)
+		assert.Equal(t, "second-post", results[1].Document.Slug)
+		assert.Contains(t, results[0].Snippet, "Climate")
+	})
+
+	t.Run("all terms must match", func(t *testing.T) {
+		results := search("climate energy", 0)
+		require.Len(t, results, 1)
+		assert.Equal(t, "second-post", results[0].Document.Slug)
+		assert.Equal(t, "2023-02-15", results[0].Document.Date)
+	})
+
+	t.Run("title matches", func(t *testing.T) {
+		results := search("undated", 0)
+		require.Len(t, results, 1)
+		assert.Equal(t, "Undated Post", results[0].Document.Title)
+		assert.Empty(t, results[0].Document.Date)
+	})
+
+	t.Run("accents and query syntax are ignored", func(t *testing.T) {
+		assert.Len(t, search("CLIMATE", 0), 2)
+		assert.Empty(t, search(`fox AND "lazy OR`, 0))
+		assert.Len(t, search("fox, lazy!", 0), 1)
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		assert.Len(t, search("post", 2), 2)
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		assert.Empty(t, search("nonexistent", 0))
+		assert.Empty(t, search("", 0))
+	})
+
+	t.Run("rebuild and open", func(t *testing.T) {
+		require.NoError(t, idx.Close())
+		rebuilt, err := BuildSearchIndex(indexPath, posts[:1])
+		require.NoError(t, err)
+		require.NoError(t, rebuilt.Close())
+
+		opened, err := OpenSearchIndex(indexPath)
+		require.NoError(t, err)
+		defer opened.Close()
+		n, err := opened.Len()
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		_, err = OpenSearchIndex(filepath.Join(tempDir, "missing.db"))
+		assert.Error(t, err)
+	})
+
+	t.Run("in memory", func(t *testing.T) {
+		mem, err := NewSearchIndex(posts)
+		require.NoError(t, err)
+		defer mem.Close()
+		results, err := mem.Search("climate", 0)
+		require.NoError(t, err)
+		assert.Len(t, results, 2)
+	})
+}
@@ -0,0 +1,168 @@
+package lib
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// SectionCount is a section of a publication with its number of posts.
+// Posts outside any section are counted in a section with an empty slug.
+type SectionCount struct {
+	Name  string `json:"name"`
+	Slug  string `json:"slug"`
+	Posts int    `json:"posts"`
+}
+
+// AuthorCount is a contributor of a publication with the number of posts they're credited on
+type AuthorCount struct {
+	Name   string `json:"name"`
+	Handle string `json:"handle"`
+	Posts  int    `json:"posts"`
+}
+
+// CountSections counts the posts of each section, most used sections first
+func CountSections(posts []Post) []SectionCount {
+	index := make(map[string]int)
+	var counts []SectionCount
+	for _, post := range posts {
+		key := post.SectionSlug
+		if key == "" && post.SectionName != "" {
+			key = strings.ToLower(post.SectionName)
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(counts)
+			index[key] = i
+			name := post.SectionName
+			if post.SectionSlug == "" && name == "" {
+				name = "(no section)"
+			}
+			counts = append(counts, SectionCount{Name: name, Slug: post.SectionSlug})
+		}
+		counts[i].Posts++
+	}
+
+	sort.SliceStable(counts, func(i, j int) bool {
+		if counts[i].Posts != counts[j].Posts {
+			return counts[i].Posts > counts[j].Posts
+		}
+		return counts[i].Name < counts[j].Name
+	})
+	return counts
+}
+
+// CountAuthors counts the posts each contributor is credited on, most prolific first
+func CountAuthors(posts []Post) []AuthorCount {
+	index := make(map[string]int)
+	var counts []AuthorCount
+	for _, post := range posts {
+		for _, byline := range post.Bylines {
+			key := byline.Handle
+			if key == "" {
+				key = strconv.Itoa(byline.Id) + ":" + byline.Name
+			}
+			i, ok := index[key]
+			if !ok {
+				i = len(counts)
+				index[key] = i
+				counts = append(counts, AuthorCount{Name: byline.Name, Handle: byline.Handle})
+			}
+			counts[i].Posts++
+		}
+	}
+
+	sort.SliceStable(counts, func(i, j int) bool {
+		if counts[i].Posts != counts[j].Posts {
+			return counts[i].Posts > counts[j].Posts
+		}
+		return counts[i].Name < counts[j].Name
+	})
+	return counts
+}
+
+// MatchesPostFilters reports whether a post is in one of the sections and credits one of the
+// authors. Sections match on slug or name, authors on handle or name, ignoring case.
+// An empty list matches every post.
+func MatchesPostFilters(post Post, sections []string, authors []string) bool {
+	if len(sections) > 0 && !matchesAny(sections, post.SectionSlug, post.SectionName) {
+		return false
+	}
+	if len(authors) == 0 {
+		return true
+	}
+	for _, byline := range post.Bylines {
+		if matchesAny(authors, byline.Handle, byline.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny reports whether one of the non-empty values is in the list, ignoring case
+func matchesAny(list []string, values ...string) bool {
+	for _, item := range list {
+		for _, value := range values {
+			if value != "" && strings.EqualFold(strings.TrimSpace(item), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteSectionCounts writes the sections of a publication as a table, JSON or CSV
+func WriteSectionCounts(w io.Writer, counts []SectionCount, format string) error {
+	rows := make([][]string, len(counts))
+	for i, c := range counts {
+		rows[i] = []string{c.Name, c.Slug, strconv.Itoa(c.Posts)}
+	}
+	if counts == nil {
+		counts = []SectionCount{}
+	}
+	return writeRecords(w, format, []string{"name", "slug", "posts"}, rows, counts)
+}
+
+// WriteAuthorCounts writes the contributors of a publication as a table, JSON or CSV
+func WriteAuthorCounts(w io.Writer, counts []AuthorCount, format string) error {
+	rows := make([][]string, len(counts))
+	for i, c := range counts {
+		rows[i] = []string{c.Name, c.Handle, strconv.Itoa(c.Posts)}
+	}
+	if counts == nil {
+		counts = []AuthorCount{}
+	}
+	return writeRecords(w, format, []string{"name", "handle", "posts"}, rows, counts)
+}
+
+// writeRecords writes rows as a table or CSV with the given header, or value as JSON
+func writeRecords(w io.Writer, format string, header []string, rows [][]string, value interface{}) error {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t")))
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(value)
+
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(header)
+		cw.WriteAll(rows)
+		return cw.Error()
+
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+}
@@ -0,0 +1,126 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sectionTestPosts returns posts spread over two sections and three contributors
+func sectionTestPosts() []Post {
+	alice := PostByline{Id: 1, Name: "Alice Martin", Handle: "alice"}
+	bob := PostByline{Id: 2, Name: "Bob Stone", Handle: "bob"}
+	guest := PostByline{Id: 3, Name: "Guest Writer"}
+	return []Post{
+		{Slug: "weekly-1", SectionId: 10, SectionName: "Weekly", SectionSlug: "weekly", Bylines: []PostByline{alice}},
+		{Slug: "weekly-2", SectionId: 10, SectionName: "Weekly", SectionSlug: "weekly", Bylines: []PostByline{alice, bob}},
+		{Slug: "essay", SectionId: 11, SectionName: "Long Reads", SectionSlug: "long-reads", Bylines: []PostByline{bob}},
+		{Slug: "note", Bylines: []PostByline{guest}},
+	}
+}
+
+// Test counting the posts of each section and contributor
+func TestCountSectionsAndAuthors(t *testing.T) {
+	posts := sectionTestPosts()
+
+	assert.Equal(t, []SectionCount{
+		{Name: "Weekly", Slug: "weekly", Posts: 2},
+		{Name: "(no section)", Posts: 1},
+		{Name: "Long Reads", Slug: "long-reads", Posts: 1},
+	}, CountSections(posts))
+
+	assert.Equal(t, []AuthorCount{
+		{Name: "Alice Martin", Handle: "alice", Posts: 2},
+		{Name: "Bob Stone", Handle: "bob", Posts: 2},
+		{Name: "Guest Writer", Posts: 1},
+	}, CountAuthors(posts))
+
+	assert.Empty(t, CountSections(nil))
+	assert.Empty(t, CountAuthors(nil))
+}
+
+// Test filtering posts by section and author
+func TestMatchesPostFilters(t *testing.T) {
+	posts := sectionTestPosts()
+	match := func(sections, authors []string) []string {
+		var slugs []string
+		for _, post := range posts {
+			if MatchesPostFilters(post, sections, authors) {
+				slugs = append(slugs, post.Slug)
+			}
+		}
+		return slugs
+	}
+
+	assert.Len(t, match(nil, nil), 4)
+	assert.Equal(t, []string{"weekly-1", "weekly-2"}, match([]string{"weekly"}, nil))
+	assert.Equal(t, []string{"essay"}, match([]string{"long reads"}, nil))
+	assert.Equal(t, []string{"weekly-2", "essay"}, match(nil, []string{"BOB"}))
+	assert.Equal(t, []string{"note"}, match(nil, []string{"Guest Writer"}))
+	assert.Equal(t, []string{"weekly-2"}, match([]string{"weekly"}, []string{"bob"}))
+	assert.Empty(t, match([]string{"unknown"}, nil))
+}
+
+// Test writing section and author counts in the supported formats
+func TestWriteSectionCounts(t *testing.T) {
+	counts := CountSections(sectionTestPosts())
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteSectionCounts(&buf, counts, "table"))
+	assert.Equal(t, "NAME          SLUG        POSTS\n"+
+		"Weekly        weekly      2\n"+
+		"(no section)              1\n"+
+		"Long Reads    long-reads  1\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteSectionCounts(&buf, counts[:1], "csv"))
+	assert.Equal(t, "name,slug,posts\nWeekly,weekly,2\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteSectionCounts(&buf, nil, "json"))
+	assert.JSONEq(t, `[]`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteAuthorCounts(&buf, CountAuthors(sectionTestPosts())[:1], "json"))
+	assert.JSONEq(t, `[{"name": "Alice Martin", "handle": "alice", "posts": 2}]`, buf.String())
+
+	assert.Error(t, WriteAuthorCounts(&bytes.Buffer{}, nil, "xml"))
+}
+
+// Test listing the posts to download with section and author filters
+func TestDownloaderListPostURLsFilters(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/archive" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var page []Post
+		if r.URL.Query().Get("offset") == "0" {
+			for _, post := range sectionTestPosts() {
+				post.CanonicalUrl = server.URL + "/p/" + post.Slug
+				post.PostDate = "2023-01-01T10:00:00Z"
+				page = append(page, post)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+
+	opts := DefaultDownloadOptions()
+	opts.Sections = []string{"weekly"}
+	opts.Authors = []string{"bob"}
+	downloader := NewDownloader(nil, opts)
+
+	all, pending, err := downloader.ListPostURLs(context.Background(), server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, []string{server.URL + "/p/weekly-2"}, all)
+	assert.Equal(t, all, pending)
+}
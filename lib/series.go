@@ -0,0 +1,206 @@
+package lib
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ArchiveSeriesDir is the directory of the archive pages listing the posts of a series
+const ArchiveSeriesDir = "series"
+
+// seriesPart matches a title numbering its part of a series, e.g. "The Crisis, Part 2",
+// "The Crisis (Pt. II): Origins" or "The Crisis #3"
+var seriesPart = regexp.MustCompile(`(?i)^(.+?)[\s,:;|(\[–—-]*(?:\bpart|\bpt\.?|\bchapter|\bepisode|#)\s*(\d+|[ivxlc]+)\b`)
+
+// seriesSeparators separate the name of a series from the title of a post, e.g. "The Crisis: Origins"
+var seriesSeparators = []string{": ", " | ", " — ", " – ", " - "}
+
+// Series is a group of posts whose titles name the same series, e.g. the parts of a multi-part essay
+type Series struct {
+	Name  string
+	Slug  string
+	Posts []Post // in reading order: by part number, then oldest first
+}
+
+// SeriesCount is a series of a publication with its number of posts
+type SeriesCount struct {
+	Name  string `json:"name"`
+	Slug  string `json:"slug"`
+	Posts int    `json:"posts"`
+}
+
+// seriesCandidate returns the name of the series a title suggests, with the number of the
+// part it gives, 0 if none. The name is "" for a title that doesn't suggest any.
+func seriesCandidate(title string) (string, int) {
+	title = strings.TrimSpace(title)
+	if match := seriesPart.FindStringSubmatch(title); match != nil {
+		if name := trimSeriesName(match[1]); name != "" {
+			return name, partNumber(match[2])
+		}
+	}
+	for _, separator := range seriesSeparators {
+		if i := strings.Index(title, separator); i > 0 {
+			return trimSeriesName(title[:i]), 0
+		}
+	}
+	return "", 0
+}
+
+// trimSeriesName removes the punctuation and quotes around the name of a series
+func trimSeriesName(name string) string {
+	return strings.Trim(name, " \t,:;|([–—-\"'“”‘’")
+}
+
+// partNumber parses the number of a part, in digits or roman numerals
+func partNumber(s string) int {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	values := map[rune]int{'i': 1, 'v': 5, 'x': 10, 'l': 50, 'c': 100}
+	n, prev := 0, 0
+	runes := []rune(strings.ToLower(s))
+	for i := len(runes) - 1; i >= 0; i-- {
+		value := values[runes[i]]
+		if value < prev {
+			n -= value
+		} else {
+			n += value
+			prev = value
+		}
+	}
+	return n
+}
+
+// seriesGroup is a series as the indexes of its posts, in reading order
+type seriesGroup struct {
+	name    string
+	indexes []int
+}
+
+// groupSeries groups posts by the series their titles suggest, sorted by name. A name
+// becomes a series when at least two posts share it, ignoring case.
+func groupSeries(posts []Post) []seriesGroup {
+	byKey := make(map[string]*seriesGroup)
+	parts := make(map[int]int)
+	var keys []string
+	for i, post := range posts {
+		name, part := seriesCandidate(post.Title)
+		if name == "" {
+			continue
+		}
+		key := strings.ToLower(name)
+		group, ok := byKey[key]
+		if !ok {
+			group = &seriesGroup{name: name}
+			byKey[key] = group
+			keys = append(keys, key)
+		}
+		group.indexes = append(group.indexes, i)
+		parts[i] = part
+	}
+
+	var groups []seriesGroup
+	for _, key := range keys {
+		group := byKey[key]
+		if len(group.indexes) < 2 {
+			continue
+		}
+		sort.SliceStable(group.indexes, func(i, j int) bool {
+			a, b := group.indexes[i], group.indexes[j]
+			if parts[a] != parts[b] && parts[a] > 0 && parts[b] > 0 {
+				return parts[a] < parts[b]
+			}
+			return postTime(posts[a]).Before(postTime(posts[b]))
+		})
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return strings.ToLower(groups[i].name) < strings.ToLower(groups[j].name)
+	})
+	return groups
+}
+
+// postTime returns the publication time of a post, zero if it can't be parsed
+func postTime(post Post) time.Time {
+	t, _ := time.Parse(time.RFC3339, post.PostDate)
+	return t
+}
+
+// DetectSeries returns the series of posts, detected from their titles: posts numbering their
+// part of the same name ("The Crisis, Part 2") or sharing a prefix ("The Crisis: Origins").
+// Series are sorted by name.
+func DetectSeries(posts []Post) []Series {
+	var series []Series
+	for _, group := range groupSeries(posts) {
+		s := Series{Name: group.name, Slug: groupSlug("", group.name)}
+		for _, i := range group.indexes {
+			s.Posts = append(s.Posts, posts[i])
+		}
+		series = append(series, s)
+	}
+	return series
+}
+
+// FilterSeries returns the posts belonging to one of the named series (name or slug, ignoring
+// case) among the series detected in posts, or to a section of one of these names, as
+// publications also use sections for their series
+func FilterSeries(posts []Post, names []string) []Post {
+	inSeries := make(map[int]bool)
+	for _, group := range groupSeries(posts) {
+		if matchesAny(names, group.name, groupSlug("", group.name)) {
+			for _, i := range group.indexes {
+				inSeries[i] = true
+			}
+		}
+	}
+	var filtered []Post
+	for i, post := range posts {
+		if inSeries[i] || matchesAny(names, post.SectionSlug, post.SectionName) {
+			filtered = append(filtered, post)
+		}
+	}
+	return filtered
+}
+
+// CountSeries counts the posts of each series of posts, sorted by name
+func CountSeries(posts []Post) []SeriesCount {
+	var counts []SeriesCount
+	for _, s := range DetectSeries(posts) {
+		counts = append(counts, SeriesCount{Name: s.Name, Slug: s.Slug, Posts: len(s.Posts)})
+	}
+	return counts
+}
+
+// WriteSeriesCounts writes the series of a publication as a table, JSON or CSV
+func WriteSeriesCounts(w io.Writer, counts []SeriesCount, format string) error {
+	rows := make([][]string, len(counts))
+	for i, c := range counts {
+		rows[i] = []string{c.Name, c.Slug, strconv.Itoa(c.Posts)}
+	}
+	if counts == nil {
+		counts = []SeriesCount{}
+	}
+	return writeRecords(w, format, []string{"name", "slug", "posts"}, rows, counts)
+}
+
+// seriesGroups returns the series of the archive posts, sorted by name, each with its posts
+// in reading order
+func (a *Archive) seriesGroups() []*archiveGroup {
+	posts := make([]Post, len(a.Entries))
+	for i, entry := range a.Entries {
+		posts[i] = entry.Post
+	}
+	var groups []*archiveGroup
+	for _, s := range groupSeries(posts) {
+		group := &archiveGroup{Name: s.name, Slug: groupSlug("", s.name)}
+		for _, i := range s.indexes {
+			group.Entries = append(group.Entries, a.Entries[i])
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
@@ -0,0 +1,94 @@
+package lib
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeriesCandidate(t *testing.T) {
+	tests := []struct {
+		title string
+		name  string
+		part  int
+	}{
+		{"The Crisis, Part 2", "The Crisis", 2},
+		{"The Crisis (Part II): Origins", "The Crisis", 2},
+		{"The Crisis - Pt. 3", "The Crisis", 3},
+		{"The Crisis #4", "The Crisis", 4},
+		{"Chapter 1 of nothing", "", 0},
+		{"Weekly Links: March", "Weekly Links", 0},
+		{"Weekly Links | April", "Weekly Links", 0},
+		{"A Departmental Review 5", "", 0},
+		{"Just a title", "", 0},
+	}
+	for _, tt := range tests {
+		name, part := seriesCandidate(tt.title)
+		assert.Equal(t, tt.name, name, tt.title)
+		assert.Equal(t, tt.part, part, tt.title)
+	}
+}
+
+func TestDetectSeries(t *testing.T) {
+	posts := []Post{
+		{Title: "The Crisis, Part 3", PostDate: "2024-01-01T10:00:00Z"},
+		{Title: "Weekly Links: March", PostDate: "2024-03-01T10:00:00Z"},
+		{Title: "the crisis, part 1", PostDate: "2024-01-03T10:00:00Z"},
+		{Title: "The Crisis: Epilogue", PostDate: "2024-02-01T10:00:00Z"},
+		{Title: "Weekly Links: February", PostDate: "2024-02-01T10:00:00Z"},
+		{Title: "Interview: Someone", PostDate: "2024-02-01T10:00:00Z"},
+		{Title: "Standalone", PostDate: "2024-02-01T10:00:00Z"},
+	}
+
+	series := DetectSeries(posts)
+	require.Len(t, series, 2)
+	assert.Equal(t, "The Crisis", series[0].Name)
+	assert.Equal(t, "the-crisis", series[0].Slug)
+	var titles []string
+	for _, post := range series[0].Posts {
+		titles = append(titles, post.Title)
+	}
+	// Numbered parts are in order, the others by date
+	assert.Equal(t, []string{"the crisis, part 1", "The Crisis, Part 3", "The Crisis: Epilogue"}, titles)
+	assert.Equal(t, "Weekly Links", series[1].Name)
+	assert.Equal(t, "Weekly Links: February", series[1].Posts[0].Title)
+
+	posts = append(posts, Post{Title: "Rebuilding", SectionName: "Weekly Links", SectionSlug: "links"})
+	filtered := FilterSeries(posts, []string{"Weekly Links"})
+	require.Len(t, filtered, 3)
+	assert.Equal(t, "Rebuilding", filtered[2].Title, "a section of the name is a series too")
+	assert.Len(t, FilterSeries(posts, []string{"The Crisis"}), 3)
+	assert.Empty(t, FilterSeries(posts, []string{"Interview"}))
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteSeriesCounts(&buf, CountSeries(posts), "csv"))
+	assert.Equal(t, "name,slug,posts\nThe Crisis,the-crisis,3\nWeekly Links,weekly-links,2\n", buf.String())
+}
+
+func TestArchiveSeriesPages(t *testing.T) {
+	dir := t.TempDir()
+	downloadTime := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	archive := NewArchive()
+	archive.AddEntry(Post{Title: "The Crisis, Part 2", PostDate: "2024-01-02T10:00:00Z"}, filepath.Join(dir, "part2.html"), downloadTime)
+	archive.AddEntry(Post{Title: "The Crisis, Part 1", PostDate: "2024-01-01T10:00:00Z"}, filepath.Join(dir, "part1.html"), downloadTime)
+	archive.AddEntry(Post{Title: "Other", PostDate: "2024-01-03T10:00:00Z"}, filepath.Join(dir, "other.html"), downloadTime)
+	require.NoError(t, archive.GenerateHTML(dir))
+
+	index, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(index), `Series: <a href="series/the-crisis.html" title="2 posts">The Crisis</a>`)
+
+	page, err := os.ReadFile(filepath.Join(dir, "series", "the-crisis.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(page), "<h1>The Crisis</h1>")
+	assert.NotContains(t, string(page), "Other")
+	// The parts are listed in reading order, unlike the archive page
+	assert.Less(t, strings.Index(string(page), "part1.html"), strings.Index(string(page), "part2.html"))
+}
@@ -0,0 +1,359 @@
+package lib
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// MonthCount is the number of posts published in a month (YYYY-MM)
+type MonthCount struct {
+	Month string `json:"month"`
+	Count int    `json:"count"`
+}
+
+// TagCount is the number of posts with a tag
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// PostLength identifies a post and its word count
+type PostLength struct {
+	Title     string `json:"title"`
+	URL       string `json:"url,omitempty"`
+	Date      string `json:"date,omitempty"`
+	WordCount int    `json:"wordcount"`
+}
+
+// Streak is a run of consecutive weeks with at least one post
+type Streak struct {
+	Weeks int    `json:"weeks"`
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// ArchiveStats holds statistics computed over the posts of a publication
+type ArchiveStats struct {
+	TotalPosts    int          `json:"total_posts"`
+	FirstPost     string       `json:"first_post,omitempty"`
+	LastPost      string       `json:"last_post,omitempty"`
+	TotalWords    int          `json:"total_words"`
+	AverageWords  int          `json:"average_words"`
+	PaidPosts     int          `json:"paid_posts"`
+	FreePosts     int          `json:"free_posts"`
+	UnknownPosts  int          `json:"unknown_audience_posts"`
+	PaidRatio     float64      `json:"paid_ratio"`
+	PostsPerMonth []MonthCount `json:"posts_per_month"`
+	TopTags       []TagCount   `json:"top_tags"`
+	LongestPosts  []PostLength `json:"longest_posts"`
+	LongestStreak Streak       `json:"longest_streak"`
+	CurrentStreak Streak       `json:"current_streak"`
+}
+
+// ComputeStats computes statistics over the given posts.
+// top limits the number of tags and longest posts reported.
+// now is used to decide whether the last streak is still ongoing.
+func ComputeStats(entries []ManifestEntry, top int, now time.Time) ArchiveStats {
+	stats := ArchiveStats{
+		TotalPosts:    len(entries),
+		PostsPerMonth: make([]MonthCount, 0),
+		TopTags:       make([]TagCount, 0),
+		LongestPosts:  make([]PostLength, 0),
+	}
+	if len(entries) == 0 {
+		return stats
+	}
+
+	months := make(map[string]int)
+	tags := make(map[string]int)
+	weeks := make(map[time.Time]bool)
+	var first, last time.Time
+
+	for _, entry := range entries {
+		stats.TotalWords += entry.WordCount
+
+		switch {
+		case entry.Audience == "":
+			stats.UnknownPosts++
+		case IsPaidAudience(entry.Audience):
+			stats.PaidPosts++
+		default:
+			stats.FreePosts++
+		}
+
+		for _, tag := range entry.Tags {
+			tags[tag]++
+		}
+
+		date, err := time.Parse(time.RFC3339, entry.PostDate)
+		if err != nil {
+			continue
+		}
+		date = date.UTC()
+		months[date.Format("2006-01")]++
+		weeks[weekStart(date)] = true
+		if first.IsZero() || date.Before(first) {
+			first = date
+		}
+		if date.After(last) {
+			last = date
+		}
+	}
+
+	stats.AverageWords = stats.TotalWords / len(entries)
+	if known := stats.PaidPosts + stats.FreePosts; known > 0 {
+		stats.PaidRatio = float64(stats.PaidPosts) / float64(known)
+	}
+
+	if !first.IsZero() {
+		stats.FirstPost = first.Format("2006-01-02")
+		stats.LastPost = last.Format("2006-01-02")
+
+		// Include months without posts so gaps are visible
+		for m := time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, time.UTC); !m.After(last); m = m.AddDate(0, 1, 0) {
+			key := m.Format("2006-01")
+			stats.PostsPerMonth = append(stats.PostsPerMonth, MonthCount{Month: key, Count: months[key]})
+		}
+	}
+
+	for tag, count := range tags {
+		stats.TopTags = append(stats.TopTags, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(stats.TopTags, func(i, j int) bool {
+		if stats.TopTags[i].Count != stats.TopTags[j].Count {
+			return stats.TopTags[i].Count > stats.TopTags[j].Count
+		}
+		return stats.TopTags[i].Tag < stats.TopTags[j].Tag
+	})
+	if top > 0 && len(stats.TopTags) > top {
+		stats.TopTags = stats.TopTags[:top]
+	}
+
+	for _, entry := range entries {
+		stats.LongestPosts = append(stats.LongestPosts, PostLength{
+			Title:     entry.Title,
+			URL:       entry.URL,
+			Date:      dateOnly(entry.PostDate),
+			WordCount: entry.WordCount,
+		})
+	}
+	sort.SliceStable(stats.LongestPosts, func(i, j int) bool {
+		return stats.LongestPosts[i].WordCount > stats.LongestPosts[j].WordCount
+	})
+	if top > 0 && len(stats.LongestPosts) > top {
+		stats.LongestPosts = stats.LongestPosts[:top]
+	}
+
+	stats.LongestStreak, stats.CurrentStreak = computeStreaks(weeks, now)
+
+	return stats
+}
+
+// weekStart returns the Monday starting the week of the given date
+func weekStart(date time.Time) time.Time {
+	offset := (int(date.Weekday()) + 6) % 7
+	return time.Date(date.Year(), date.Month(), date.Day()-offset, 0, 0, 0, 0, time.UTC)
+}
+
+// computeStreaks finds the longest run of consecutive posting weeks, and the run
+// ending this week or last week (the current streak)
+func computeStreaks(weeks map[time.Time]bool, now time.Time) (Streak, Streak) {
+	starts := make([]time.Time, 0, len(weeks))
+	for week := range weeks {
+		starts = append(starts, week)
+	}
+	sort.Slice(starts, func(i, j int) bool {
+		return starts[i].Before(starts[j])
+	})
+
+	var longest, current Streak
+	for i := 0; i < len(starts); {
+		j := i
+		for j+1 < len(starts) && starts[j+1].Equal(starts[j].AddDate(0, 0, 7)) {
+			j++
+		}
+		streak := Streak{
+			Weeks: j - i + 1,
+			Start: starts[i].Format("2006-01-02"),
+			End:   starts[j].AddDate(0, 0, 6).Format("2006-01-02"),
+		}
+		if streak.Weeks > longest.Weeks {
+			longest = streak
+		}
+		current = streak
+		i = j + 1
+	}
+
+	// The last streak is only current if it includes this week or the previous one
+	if len(starts) > 0 && starts[len(starts)-1].Before(weekStart(now.UTC()).AddDate(0, 0, -7)) {
+		current = Streak{}
+	}
+
+	return longest, current
+}
+
+// WriteTable writes the statistics as human readable tables
+func (s ArchiveStats) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Posts:\t%d\n", s.TotalPosts)
+	if s.FirstPost != "" {
+		fmt.Fprintf(tw, "Published:\t%s to %s\n", s.FirstPost, s.LastPost)
+	}
+	fmt.Fprintf(tw, "Total words:\t%d\n", s.TotalWords)
+	fmt.Fprintf(tw, "Average words:\t%d\n", s.AverageWords)
+	fmt.Fprintf(tw, "Paid / free:\t%d / %d (%.0f%% paid)\n", s.PaidPosts, s.FreePosts, s.PaidRatio*100)
+	if s.UnknownPosts > 0 {
+		fmt.Fprintf(tw, "Unknown audience:\t%d\n", s.UnknownPosts)
+	}
+	fmt.Fprintf(tw, "Longest streak:\t%s\n", s.LongestStreak)
+	fmt.Fprintf(tw, "Current streak:\t%s\n", s.CurrentStreak)
+
+	if len(s.PostsPerMonth) > 0 {
+		fmt.Fprintln(tw, "\nMONTH\tPOSTS\t")
+		max := maxMonthCount(s.PostsPerMonth)
+		for _, m := range s.PostsPerMonth {
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", m.Month, m.Count, strings.Repeat("#", scaleBar(m.Count, max, 40)))
+		}
+	}
+
+	if len(s.TopTags) > 0 {
+		fmt.Fprintln(tw, "\nTAG\tPOSTS")
+		for _, t := range s.TopTags {
+			fmt.Fprintf(tw, "%s\t%d\n", t.Tag, t.Count)
+		}
+	}
+
+	if len(s.LongestPosts) > 0 {
+		fmt.Fprintln(tw, "\nLONGEST POSTS\tWORDS\tDATE")
+		for _, p := range s.LongestPosts {
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", p.Title, p.WordCount, p.Date)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// WriteHTML writes the statistics as a standalone HTML report with bar charts
+func (s ArchiveStats) WriteHTML(w io.Writer, title string) error {
+	return statsTemplate.Execute(w, struct {
+		Title string
+		Stats ArchiveStats
+		Max   int
+	}{title, s, maxMonthCount(s.PostsPerMonth)})
+}
+
+// String describes the streak, e.g. "5 weeks (2023-01-02 to 2023-02-05)"
+func (s Streak) String() string {
+	if s.Weeks == 0 {
+		return "none"
+	}
+	unit := "weeks"
+	if s.Weeks == 1 {
+		unit = "week"
+	}
+	return fmt.Sprintf("%d %s (%s to %s)", s.Weeks, unit, s.Start, s.End)
+}
+
+// maxMonthCount returns the highest number of posts in a month
+func maxMonthCount(months []MonthCount) int {
+	max := 0
+	for _, m := range months {
+		if m.Count > max {
+			max = m.Count
+		}
+	}
+	return max
+}
+
+// scaleBar scales a value to a bar length between 0 and width
+func scaleBar(value, max, width int) int {
+	if max == 0 {
+		return 0
+	}
+	return value * width / max
+}
+
+var statsTemplate = template.Must(template.New("stats").Funcs(template.FuncMap{
+	"percent": func(value, max int) int { return scaleBar(value, max, 100) },
+	"ratio":   func(r float64) string { return fmt.Sprintf("%.0f%%", r*100) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>{{.Title}} - Statistics</title>
+	<style>
+		body { font-family: Arial, sans-serif; max-width: 960px; margin: 0 auto; padding: 20px; color: #222; }
+		h1 { border-bottom: 2px solid #ff6719; padding-bottom: 10px; }
+		.cards { display: flex; flex-wrap: wrap; gap: 12px; }
+		.card { background: #f7f7f7; border-radius: 6px; padding: 12px 16px; min-width: 140px; }
+		.card .value { font-size: 24px; font-weight: bold; color: #ff6719; }
+		.card .label { font-size: 13px; color: #666; }
+		.chart { display: flex; align-items: flex-end; gap: 2px; height: 200px; border-bottom: 1px solid #ccc; margin-top: 10px; }
+		.chart .bar { flex: 1; background: #ff6719; min-width: 3px; position: relative; }
+		.chart .bar:hover { background: #c94f12; }
+		.axis { display: flex; justify-content: space-between; font-size: 12px; color: #777; }
+		table { border-collapse: collapse; width: 100%; }
+		th, td { text-align: left; padding: 6px 8px; border-bottom: 1px solid #eee; }
+		td.num { text-align: right; }
+		.hbar { background: #ff6719; height: 12px; }
+		.split { display: flex; height: 24px; border-radius: 4px; overflow: hidden; }
+		.split .paid { background: #ff6719; }
+		.split .free { background: #ffd2b8; }
+	</style>
+</head>
+<body>
+	<h1>{{.Title}}</h1>
+	{{with .Stats}}
+	<div class="cards">
+		<div class="card"><div class="value">{{.TotalPosts}}</div><div class="label">posts</div></div>
+		<div class="card"><div class="value">{{.AverageWords}}</div><div class="label">average words</div></div>
+		<div class="card"><div class="value">{{.TotalWords}}</div><div class="label">total words</div></div>
+		<div class="card"><div class="value">{{ratio .PaidRatio}}</div><div class="label">paid posts</div></div>
+		<div class="card"><div class="value">{{.LongestStreak.Weeks}}</div><div class="label">longest weekly streak</div></div>
+		<div class="card"><div class="value">{{.CurrentStreak.Weeks}}</div><div class="label">current weekly streak</div></div>
+	</div>
+	{{if .FirstPost}}<p>Published from {{.FirstPost}} to {{.LastPost}}.</p>{{end}}
+
+	{{if .PostsPerMonth}}
+	<h2>Posts per month</h2>
+	<div class="chart">
+		{{range .PostsPerMonth}}<div class="bar" style="height: {{percent .Count $.Max}}%" title="{{.Month}}: {{.Count}}"></div>
+		{{end}}
+	</div>
+	<div class="axis"><span>{{.FirstPost}}</span><span>{{.LastPost}}</span></div>
+	{{end}}
+
+	<h2>Paid vs free</h2>
+	<div class="split">
+		<div class="paid" style="flex: {{.PaidPosts}}" title="paid: {{.PaidPosts}}"></div>
+		<div class="free" style="flex: {{.FreePosts}}" title="free: {{.FreePosts}}"></div>
+	</div>
+	<p>{{.PaidPosts}} paid, {{.FreePosts}} free{{if .UnknownPosts}}, {{.UnknownPosts}} unknown{{end}}</p>
+
+	{{if .TopTags}}
+	<h2>Top tags</h2>
+	<table>
+		{{$max := (index .TopTags 0).Count}}
+		{{range .TopTags}}<tr><td>{{.Tag}}</td><td class="num">{{.Count}}</td><td style="width: 50%"><div class="hbar" style="width: {{percent .Count $max}}%"></div></td></tr>
+		{{end}}
+	</table>
+	{{end}}
+
+	{{if .LongestPosts}}
+	<h2>Longest posts</h2>
+	<table>
+		<tr><th>Title</th><th>Date</th><th>Words</th></tr>
+		{{range .LongestPosts}}<tr><td>{{if .URL}}<a href="{{.URL}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}</td><td>{{.Date}}</td><td class="num">{{.WordCount}}</td></tr>
+		{{end}}
+	</table>
+	{{end}}
+	{{end}}
+</body>
+</html>`))
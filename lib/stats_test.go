@@ -0,0 +1,190 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function to create manifest entries for statistics tests
+func createStatsEntries() []ManifestEntry {
+	return []ManifestEntry{
+		{Title: "First", PostDate: "2023-01-02T10:00:00Z", WordCount: 1000, Audience: "everyone", Tags: []string{"Politics"}},
+		{Title: "Second", PostDate: "2023-01-09T10:00:00Z", WordCount: 3000, Audience: "only_paid", Tags: []string{"Politics", "Economy"}},
+		{Title: "Third", PostDate: "2023-01-16T10:00:00Z", WordCount: 2000, Audience: "everyone"},
+		{Title: "Fourth", PostDate: "2023-03-06T10:00:00Z", WordCount: 500, Audience: "founding", Tags: []string{"Economy"}},
+		{Title: "Undated", WordCount: 1500},
+	}
+}
+
+// Test ComputeStats
+func TestComputeStats(t *testing.T) {
+	now := time.Date(2023, 3, 8, 12, 0, 0, 0, time.UTC)
+	stats := ComputeStats(createStatsEntries(), 2, now)
+
+	assert.Equal(t, 5, stats.TotalPosts)
+	assert.Equal(t, "2023-01-02", stats.FirstPost)
+	assert.Equal(t, "2023-03-06", stats.LastPost)
+	assert.Equal(t, 8000, stats.TotalWords)
+	assert.Equal(t, 1600, stats.AverageWords)
+	assert.Equal(t, 2, stats.PaidPosts)
+	assert.Equal(t, 2, stats.FreePosts)
+	assert.Equal(t, 1, stats.UnknownPosts)
+	assert.InDelta(t, 0.5, stats.PaidRatio, 0.001)
+
+	assert.Equal(t, []MonthCount{{"2023-01", 3}, {"2023-02", 0}, {"2023-03", 1}}, stats.PostsPerMonth)
+	assert.Equal(t, []TagCount{{"Economy", 2}, {"Politics", 2}}, stats.TopTags)
+
+	require.Len(t, stats.LongestPosts, 2)
+	assert.Equal(t, "Second", stats.LongestPosts[0].Title)
+	assert.Equal(t, "2023-01-09", stats.LongestPosts[0].Date)
+	assert.Equal(t, "Third", stats.LongestPosts[1].Title)
+
+	assert.Equal(t, Streak{Weeks: 3, Start: "2023-01-02", End: "2023-01-22"}, stats.LongestStreak)
+	assert.Equal(t, Streak{Weeks: 1, Start: "2023-03-06", End: "2023-03-12"}, stats.CurrentStreak)
+
+	t.Run("streak ended", func(t *testing.T) {
+		stats := ComputeStats(createStatsEntries(), 2, now.AddDate(0, 1, 0))
+		assert.Equal(t, 0, stats.CurrentStreak.Weeks)
+		assert.Equal(t, "none", stats.CurrentStreak.String())
+	})
+
+	t.Run("no posts", func(t *testing.T) {
+		stats := ComputeStats(nil, 10, now)
+		assert.Equal(t, 0, stats.TotalPosts)
+		assert.Empty(t, stats.PostsPerMonth)
+	})
+}
+
+// Test the statistics output formats
+func TestStatsOutput(t *testing.T) {
+	stats := ComputeStats(createStatsEntries(), 10, time.Now())
+
+	t.Run("table", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, stats.WriteTable(&buf))
+		out := buf.String()
+		assert.Contains(t, out, "Posts:")
+		assert.Contains(t, out, "2023-01")
+		assert.Contains(t, out, "Politics")
+		assert.Contains(t, out, "3 weeks (2023-01-02 to 2023-01-22)")
+	})
+
+	t.Run("html", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, stats.WriteHTML(&buf, "My <Newsletter>"))
+		out := buf.String()
+		assert.Contains(t, out, "<!DOCTYPE html>")
+		assert.Contains(t, out, "My &lt;Newsletter&gt;")
+		assert.Contains(t, out, `title="2023-01: 3"`)
+		assert.Contains(t, out, "Economy")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		data, err := json.Marshal(stats)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"posts_per_month"`)
+		assert.Contains(t, string(data), `"longest_streak":{"weeks":3`)
+	})
+}
+
+// Test LocalManifestEntries
+func TestLocalManifestEntries(t *testing.T) {
+	dir := createLocalArchive(t)
+	defer os.RemoveAll(dir)
+
+	m, err := LoadManifest(dir)
+	require.NoError(t, err)
+	post := createSamplePost()
+	post.Slug = "first-post"
+	post.Title = "First Post From Manifest"
+	post.PostDate = "2023-01-01T10:00:00Z"
+	m.AddEntry(NewManifestEntry(post, map[string]string{"md": "20230101_100000_first-post.md"}, time.Now()))
+	require.NoError(t, m.Save())
+
+	entries, err := LocalManifestEntries(dir)
+	require.NoError(t, err)
+
+	bySlug := make(map[string]ManifestEntry)
+	for _, entry := range entries {
+		bySlug[entry.Slug] = entry
+	}
+	assert.Equal(t, "First Post From Manifest", bySlug["first-post"].Title)
+	assert.Equal(t, 100, bySlug["first-post"].WordCount)
+
+	// Posts missing from the manifest are described from their files
+	undated, ok := bySlug["undated-post"]
+	require.True(t, ok)
+	assert.Empty(t, undated.PostDate)
+	assert.Greater(t, undated.WordCount, 0)
+	assert.Equal(t, "_undated-post.md", undated.Files["md"])
+
+	_, err = LocalManifestEntries(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+// Test Extractor.GetArchivePosts
+func TestExtractorGetArchivePosts(t *testing.T) {
+	total := 120
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/archive" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+		var page []Post
+		for i := offset; i < offset+limit && i < total; i++ {
+			// Newest first: one post per day going back from 2023-12-31
+			date := time.Date(2023, 12, 31, 10, 0, 0, 0, time.UTC).AddDate(0, 0, -i)
+			page = append(page, Post{
+				Id:       i,
+				Slug:     fmt.Sprintf("post-%d", i),
+				Title:    fmt.Sprintf("Post %d", i),
+				PostDate: date.Format(time.RFC3339),
+				Audience: "everyone",
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+
+	extractor := NewExtractor(nil)
+	ctx := context.Background()
+
+	posts, err := extractor.GetArchivePosts(ctx, server.URL, nil)
+	require.NoError(t, err)
+	assert.Len(t, posts, total)
+	assert.Equal(t, "post-0", posts[0].Slug)
+
+	posts, err = extractor.GetArchivePosts(ctx, server.URL, NewDateFilter("", "2023-12-28"))
+	require.NoError(t, err)
+	assert.Len(t, posts, 3)
+
+	_, err = extractor.GetArchivePosts(ctx, server.URL+"/missing", nil)
+	assert.Error(t, err)
+}
+
+// Test that an empty directory produces empty statistics
+func TestComputeStatsEmptyDirectory(t *testing.T) {
+	dir, err := os.MkdirTemp("", "stats-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	entries, err := LocalManifestEntries(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 0, ComputeStats(entries, 10, time.Now()).TotalPosts)
+}
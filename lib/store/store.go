@@ -0,0 +1,254 @@
+// Package store keeps an index of the downloaded posts in a SQLite database, across output
+// directories and runs, to look posts up without reading the manifests of the directories.
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alexferrari88/sbstck-dl/lib"
+
+	// pure Go SQLite driver, so that the binary is still built without cgo
+	_ "modernc.org/sqlite"
+)
+
+// schema creates the tables of the index. A post is identified by its URL, and has a file per
+// format it was written in.
+const schema = `
+CREATE TABLE IF NOT EXISTS posts (
+	url           TEXT PRIMARY KEY,
+	id            INTEGER NOT NULL DEFAULT 0,
+	publication   TEXT NOT NULL,
+	slug          TEXT NOT NULL,
+	title         TEXT NOT NULL,
+	subtitle      TEXT NOT NULL DEFAULT '',
+	authors       TEXT NOT NULL DEFAULT '',
+	post_date     TEXT NOT NULL DEFAULT '',
+	audience      TEXT NOT NULL DEFAULT '',
+	word_count    INTEGER NOT NULL DEFAULT 0,
+	text_hash     TEXT NOT NULL DEFAULT '',
+	downloaded_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS posts_publication ON posts (publication);
+CREATE INDEX IF NOT EXISTS posts_text_hash ON posts (text_hash);
+CREATE TABLE IF NOT EXISTS files (
+	url    TEXT NOT NULL REFERENCES posts (url) ON DELETE CASCADE,
+	format TEXT NOT NULL,
+	path   TEXT NOT NULL,
+	PRIMARY KEY (url, format)
+);
+`
+
+// Record is a downloaded post in the index
+type Record struct {
+	URL          string
+	ID           int
+	Publication  string // host of the publication, e.g. example.substack.com
+	Slug         string
+	Title        string
+	Subtitle     string
+	Authors      string // names of the authors, comma-separated
+	PostDate     string
+	Audience     string
+	WordCount    int
+	TextHash     string            // hash of the canonical text of the post, see lib.Post.TextHash
+	Files        map[string]string // absolute paths of the files of the post by format
+	DownloadedAt time.Time
+}
+
+// Store is an index of downloaded posts in a SQLite database
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens the index at path, creating the database if it doesn't exist
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index %s: %w", path, err)
+	}
+	// a single connection serializes the writes, which SQLite would reject when concurrent
+	db.SetMaxOpenConns(1)
+	for _, stmt := range []string{"PRAGMA foreign_keys = ON", "PRAGMA busy_timeout = 5000", schema} {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to open index %s: %w", path, err)
+		}
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database of the index
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// NewRecord returns the record of post, written to the given files by format
+func NewRecord(post lib.Post, files map[string]string, downloadedAt time.Time) Record {
+	var authors []string
+	for _, byline := range post.Bylines {
+		if byline.Name != "" {
+			authors = append(authors, byline.Name)
+		}
+	}
+	subtitle := post.Subtitle
+	if subtitle == "" {
+		subtitle = post.Description
+	}
+	paths := make(map[string]string, len(files))
+	for format, path := range files {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		paths[format] = path
+	}
+	return Record{
+		URL:          post.CanonicalUrl,
+		ID:           post.Id,
+		Publication:  publicationHost(post.CanonicalUrl),
+		Slug:         post.Slug,
+		Title:        post.Title,
+		Subtitle:     subtitle,
+		Authors:      strings.Join(authors, ", "),
+		PostDate:     post.PostDate,
+		Audience:     post.Audience,
+		WordCount:    post.WordCount,
+		TextHash:     post.TextHash(),
+		Files:        paths,
+		DownloadedAt: downloadedAt,
+	}
+}
+
+// RecordPost records post, written to the given files by format, replacing what was recorded
+// of it by a previous download
+func (s *Store) RecordPost(post lib.Post, files map[string]string, downloadedAt time.Time) error {
+	return s.Add(NewRecord(post, files, downloadedAt))
+}
+
+// Add records r, replacing the record of the same URL if any
+func (s *Store) Add(r Record) error {
+	if r.URL == "" {
+		return errors.New("post has no URL")
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO posts (url, id, publication, slug, title, subtitle, authors, post_date, audience, word_count, text_hash, downloaded_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (url) DO UPDATE SET id = excluded.id, publication = excluded.publication, slug = excluded.slug,
+			title = excluded.title, subtitle = excluded.subtitle, authors = excluded.authors, post_date = excluded.post_date,
+			audience = excluded.audience, word_count = excluded.word_count, text_hash = excluded.text_hash,
+			downloaded_at = excluded.downloaded_at`,
+		r.URL, r.ID, r.Publication, r.Slug, r.Title, r.Subtitle, r.Authors, r.PostDate, r.Audience, r.WordCount, r.TextHash,
+		r.DownloadedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to record post %s: %w", r.URL, err)
+	}
+	if _, err := tx.Exec("DELETE FROM files WHERE url = ?", r.URL); err != nil {
+		return fmt.Errorf("failed to record post %s: %w", r.URL, err)
+	}
+	for format, path := range r.Files {
+		if _, err := tx.Exec("INSERT INTO files (url, format, path) VALUES (?, ?, ?)", r.URL, format, path); err != nil {
+			return fmt.Errorf("failed to record post %s: %w", r.URL, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Has tells whether the post at postURL is recorded
+func (s *Store) Has(postURL string) (bool, error) {
+	var n int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM posts WHERE url = ?", postURL).Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Post returns the record of the post at postURL, and false if it isn't recorded
+func (s *Store) Post(postURL string) (Record, bool, error) {
+	records, err := s.query("WHERE posts.url = ?", postURL)
+	if err != nil || len(records) == 0 {
+		return Record{}, false, err
+	}
+	return records[0], true, nil
+}
+
+// Posts returns the posts recorded for the publication at host, or for every publication if
+// host is empty, newest first
+func (s *Store) Posts(host string) ([]Record, error) {
+	if host == "" {
+		return s.query("")
+	}
+	return s.query("WHERE publication = ?", host)
+}
+
+// PostsWithText returns the posts whose canonical text has the given hash, e.g. a post
+// republished under another URL, newest first
+func (s *Store) PostsWithText(textHash string) ([]Record, error) {
+	if textHash == "" {
+		return nil, nil
+	}
+	return s.query("WHERE text_hash = ?", textHash)
+}
+
+// query returns the records of the posts matching where, with their files
+func (s *Store) query(where string, args ...any) ([]Record, error) {
+	rows, err := s.db.Query(`SELECT url, id, publication, slug, title, subtitle, authors, post_date, audience, word_count, text_hash, downloaded_at
+		FROM posts `+where+` ORDER BY post_date DESC, posts.url`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []Record
+	byURL := make(map[string]int)
+	for rows.Next() {
+		var r Record
+		var downloadedAt string
+		if err := rows.Scan(&r.URL, &r.ID, &r.Publication, &r.Slug, &r.Title, &r.Subtitle, &r.Authors, &r.PostDate,
+			&r.Audience, &r.WordCount, &r.TextHash, &downloadedAt); err != nil {
+			return nil, err
+		}
+		r.DownloadedAt, _ = time.Parse(time.RFC3339, downloadedAt)
+		r.Files = make(map[string]string)
+		byURL[r.URL] = len(records)
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return records, nil
+	}
+
+	files, err := s.db.Query("SELECT files.url, format, path FROM files JOIN posts ON posts.url = files.url "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer files.Close()
+	for files.Next() {
+		var u, format, path string
+		if err := files.Scan(&u, &format, &path); err != nil {
+			return nil, err
+		}
+		records[byURL[u]].Files[format] = path
+	}
+	return records, files.Err()
+}
+
+// publicationHost returns the host of the publication of the post at postURL
+func publicationHost(postURL string) string {
+	u, err := url.Parse(postURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(u.Host, "www.")
+}
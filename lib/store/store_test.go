@@ -0,0 +1,103 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alexferrari88/sbstck-dl/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPost(slug string, date string) lib.Post {
+	return lib.Post{
+		Id:           len(slug),
+		Slug:         slug,
+		Title:        "Post " + slug,
+		Subtitle:     "About " + slug,
+		PostDate:     date,
+		Audience:     "everyone",
+		WordCount:    3,
+		CanonicalUrl: "https://www.example.com/p/" + slug,
+		BodyHTML:     "<p>Body of " + slug + "</p>",
+		Bylines:      []lib.PostByline{{Name: "Jane Doe"}, {Name: "John Roe"}},
+	}
+}
+
+// Test recording downloaded posts and looking them up
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index.db")
+	s, err := Open(path)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	first := testPost("first", "2024-01-01T12:00:00Z")
+	second := testPost("second", "2024-02-01T12:00:00Z")
+	require.NoError(t, s.RecordPost(first, map[string]string{"html": filepath.Join(dir, "first.html")}, now))
+	require.NoError(t, s.RecordPost(second, map[string]string{"html": filepath.Join(dir, "second.html"), "md": filepath.Join(dir, "second.md")}, now))
+
+	ok, err := s.Has(first.CanonicalUrl)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = s.Has("https://www.example.com/p/missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	record, ok, err := s.Post(second.CanonicalUrl)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, Record{
+		URL:          second.CanonicalUrl,
+		ID:           6,
+		Publication:  "example.com",
+		Slug:         "second",
+		Title:        "Post second",
+		Subtitle:     "About second",
+		Authors:      "Jane Doe, John Roe",
+		PostDate:     "2024-02-01T12:00:00Z",
+		Audience:     "everyone",
+		WordCount:    3,
+		TextHash:     second.TextHash(),
+		Files:        map[string]string{"html": filepath.Join(dir, "second.html"), "md": filepath.Join(dir, "second.md")},
+		DownloadedAt: now,
+	}, record)
+
+	records, err := s.Posts("example.com")
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "second", records[0].Slug, "newest first")
+	assert.Equal(t, map[string]string{"html": filepath.Join(dir, "first.html")}, records[1].Files)
+	records, err = s.Posts("other.substack.com")
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	// A post downloaded again replaces its record, files included
+	second.Title = "Updated"
+	require.NoError(t, s.RecordPost(second, map[string]string{"txt": filepath.Join(dir, "second.txt")}, now.Add(time.Hour)))
+	record, _, err = s.Post(second.CanonicalUrl)
+	require.NoError(t, err)
+	assert.Equal(t, "Updated", record.Title)
+	assert.Equal(t, map[string]string{"txt": filepath.Join(dir, "second.txt")}, record.Files)
+	assert.Equal(t, now.Add(time.Hour), record.DownloadedAt)
+
+	// The same text under another URL is found by its hash
+	copied := testPost("first", "2024-01-01T12:00:00Z")
+	copied.CanonicalUrl = "https://other.substack.com/p/first"
+	require.NoError(t, s.RecordPost(copied, nil, now))
+	records, err = s.PostsWithText(first.TextHash())
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	assert.Error(t, s.RecordPost(lib.Post{Slug: "no-url"}, nil, now))
+
+	// The index is kept across runs
+	require.NoError(t, s.Close())
+	s, err = Open(path)
+	require.NoError(t, err)
+	defer s.Close()
+	records, err = s.Posts("")
+	require.NoError(t, err)
+	assert.Len(t, records, 3)
+}
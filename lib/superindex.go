@@ -0,0 +1,181 @@
+package lib
+
+import (
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// PublicationIndexEntry is a publication downloaded into a subdirectory of a root directory,
+// as listed in the super-index of the root
+type PublicationIndexEntry struct {
+	Name   string
+	Dir    string // path of the publication directory
+	Posts  int
+	Latest ManifestEntry // most recent post by publication date
+	Index  string        // path of the archive page of the publication, if any
+	Logo   string        // path of the publication logo, if any
+}
+
+// FindPublications returns the publications downloaded into the subdirectories of root, that is
+// the subdirectories holding a manifest with at least one post, sorted by name.
+// Publications are named after their directory.
+func FindPublications(root string) ([]PublicationIndexEntry, error) {
+	dirs, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var pubs []PublicationIndexEntry
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, d.Name())
+		if _, err := os.Stat(filepath.Join(dir, ManifestFile)); err != nil {
+			continue
+		}
+		manifest, err := LoadManifest(dir)
+		if err != nil {
+			return nil, err
+		}
+		if len(manifest.Posts) == 0 {
+			continue
+		}
+
+		pub := PublicationIndexEntry{
+			Name:  d.Name(),
+			Dir:   dir,
+			Posts: len(manifest.Posts),
+			Logo:  FindPublicationLogo(dir),
+		}
+		var latest time.Time
+		for i, entry := range manifest.Posts {
+			date, err := time.Parse(time.RFC3339, entry.PostDate)
+			if i == 0 || err == nil && date.After(latest) {
+				pub.Latest = entry
+				latest = date
+			}
+		}
+		for _, format := range []string{"html", "md", "txt"} {
+			if path := filepath.Join(dir, "index."+format); fileExists(path) {
+				pub.Index = path
+				break
+			}
+		}
+		pubs = append(pubs, pub)
+	}
+
+	sort.Slice(pubs, func(i, j int) bool { return pubs[i].Name < pubs[j].Name })
+	return pubs, nil
+}
+
+// superIndexPage is the data of the super-index template, with paths relative to the root
+type superIndexPage struct {
+	Publications []superIndexPublication
+	Total        int
+}
+
+type superIndexPublication struct {
+	Name        string
+	Link        string
+	Logo        string
+	Posts       int
+	LatestTitle string
+	LatestLink  string
+	LatestDate  string
+}
+
+// GenerateSuperIndex writes an index.html page in root listing the publications downloaded
+// into its subdirectories, with their number of posts, their latest post and a link to
+// their own archive page
+func GenerateSuperIndex(root string, pubs []PublicationIndexEntry) error {
+	rel := func(path string) string {
+		if path == "" {
+			return ""
+		}
+		if r, err := filepath.Rel(root, path); err == nil {
+			return filepath.ToSlash(r)
+		}
+		return filepath.ToSlash(path)
+	}
+
+	var page superIndexPage
+	for _, pub := range pubs {
+		latestDate := pub.Latest.PostDate
+		if date, err := time.Parse(time.RFC3339, latestDate); err == nil {
+			latestDate = date.Format("January 2, 2006")
+		}
+		latestPath := pub.Latest.Files["html"]
+		for _, format := range []string{"md", "txt"} {
+			if latestPath == "" {
+				latestPath = pub.Latest.Files[format]
+			}
+		}
+		if latestPath != "" && !filepath.IsAbs(latestPath) {
+			latestPath = filepath.Join(pub.Dir, latestPath)
+		}
+
+		link := rel(pub.Index)
+		if link == "" {
+			link = rel(pub.Dir) + "/"
+		}
+		page.Publications = append(page.Publications, superIndexPublication{
+			Name:        pub.Name,
+			Link:        link,
+			Logo:        rel(pub.Logo),
+			Posts:       pub.Posts,
+			LatestTitle: pub.Latest.Title,
+			LatestLink:  rel(latestPath),
+			LatestDate:  latestDate,
+		})
+		page.Total += pub.Posts
+	}
+
+	f, err := os.Create(filepath.Join(root, "index.html"))
+	if err != nil {
+		return err
+	}
+	if err := superIndexTemplate.Execute(f, page); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// fileExists reports whether path exists and is a regular file
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+var superIndexTemplate = template.Must(template.New("superindex").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>Substack Archives</title>
+	<style>
+		body { font-family: Arial, sans-serif; max-width: 800px; margin: 0 auto; padding: 20px; }
+		h1 { color: #333; }
+		.summary { color: #666; margin-bottom: 20px; }
+		.publication { margin-bottom: 20px; padding: 20px; border: 1px solid #eee; border-radius: 8px; }
+		.publication h2 { margin-top: 0; }
+		.publication h2 a { text-decoration: none; color: #ff6719; }
+		.publication h2 a:hover { text-decoration: underline; }
+		.meta { color: #666; font-size: 14px; }
+		.logo { height: 32px; width: 32px; border-radius: 6px; vertical-align: middle; margin-right: 10px; }
+	</style>
+</head>
+<body>
+	<h1>Substack Archives</h1>
+	<div class="summary">{{len .Publications}} publications, {{.Total}} posts</div>
+	{{range .Publications}}<div class="publication">
+		<h2><a href="{{.Link}}">{{if .Logo}}<img src="{{.Logo}}" alt="" class="logo">{{end}}{{.Name}}</a></h2>
+		<div class="meta">{{.Posts}} posts{{if .LatestTitle}} | Latest: {{if .LatestLink}}<a href="{{.LatestLink}}">{{.LatestTitle}}</a>{{else}}{{.LatestTitle}}{{end}}{{if .LatestDate}} ({{.LatestDate}}){{end}}{{end}}</div>
+	</div>
+	{{end}}
+</body>
+</html>`))
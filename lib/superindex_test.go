@@ -0,0 +1,66 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuperIndex(t *testing.T) {
+	root := t.TempDir()
+
+	// Two downloaded publications, the first with an archive page and a logo
+	writePub := func(name string, posts ...Post) string {
+		dir := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		manifest, err := LoadManifest(dir)
+		require.NoError(t, err)
+		for _, post := range posts {
+			path := PostFilePath(post, dir, "html")
+			manifest.AddEntry(NewManifestEntry(post, map[string]string{"html": manifest.RelPath(path)}, time.Now()))
+		}
+		require.NoError(t, manifest.Save())
+		return dir
+	}
+	alpha := writePub("alpha",
+		Post{Id: 1, Slug: "old", Title: "Old post", PostDate: "2023-01-01T10:00:00Z"},
+		Post{Id: 2, Slug: "new", Title: "New <post>", PostDate: "2024-03-05T10:00:00Z"},
+		Post{Id: 3, Slug: "middle", Title: "Middle post", PostDate: "2023-06-01T10:00:00Z"},
+	)
+	require.NoError(t, os.WriteFile(filepath.Join(alpha, "index.html"), []byte("archive"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(alpha, "logo.png"), []byte("png"), 0644))
+	writePub("beta", Post{Id: 4, Slug: "only", Title: "Only post", PostDate: "2022-02-02T10:00:00Z"})
+
+	// Directories without a manifest, or without posts, are not publications
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "images"), 0755))
+	writePub("empty")
+
+	pubs, err := FindPublications(root)
+	require.NoError(t, err)
+	require.Len(t, pubs, 2)
+
+	assert.Equal(t, "alpha", pubs[0].Name)
+	assert.Equal(t, 3, pubs[0].Posts)
+	assert.Equal(t, "new", pubs[0].Latest.Slug)
+	assert.Equal(t, filepath.Join(alpha, "index.html"), pubs[0].Index)
+	assert.Equal(t, filepath.Join(alpha, "logo.png"), pubs[0].Logo)
+
+	assert.Equal(t, "beta", pubs[1].Name)
+	assert.Equal(t, 1, pubs[1].Posts)
+	assert.Empty(t, pubs[1].Index)
+
+	pubs[0].Name = "Alpha & Co"
+	require.NoError(t, GenerateSuperIndex(root, pubs))
+	page, err := os.ReadFile(filepath.Join(root, "index.html"))
+	require.NoError(t, err)
+	html := string(page)
+	assert.Contains(t, html, "2 publications, 4 posts")
+	assert.Contains(t, html, `<a href="alpha/index.html"><img src="alpha/logo.png" alt="" class="logo">Alpha &amp; Co</a>`)
+	assert.Contains(t, html, `<a href="alpha/20240305_100000_new.html">New &lt;post&gt;</a> (March 5, 2024)`)
+	assert.Contains(t, html, `<a href="beta/">beta</a>`)
+	assert.Contains(t, html, "1 posts | Latest:")
+}
@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// PostTransformer changes the content of a post before it is written, e.g. to translate it
+type PostTransformer interface {
+	TransformPost(ctx context.Context, post Post) (Post, error)
+}
+
+// TransformError is returned when a post couldn't be transformed, in which case it isn't written
+type TransformError struct {
+	Err error
+}
+
+// Error returns the error message for the TransformError.
+func (e *TransformError) Error() string {
+	return fmt.Sprintf("error transforming post: %s", e.Err)
+}
+
+// Unwrap returns the error of the transformer
+func (e *TransformError) Unwrap() error {
+	return e.Err
+}
+
+// TransformPost runs the transformers in turn on a post, each receiving the output of the previous one
+func TransformPost(ctx context.Context, transformers []PostTransformer, post Post) (Post, error) {
+	for _, t := range transformers {
+		var err error
+		if post, err = t.TransformPost(ctx, post); err != nil {
+			return post, &TransformError{Err: err}
+		}
+	}
+	return post, nil
+}
+
+// ExecTransformer transforms the HTML body of posts with a shell command, such as a machine
+// translation tool. The command receives the HTML on its standard input and must write the
+// new HTML on its standard output. The title, subtitle and URL of the post are available
+// as $SBSTCK_DL_TITLE, $SBSTCK_DL_SUBTITLE and $SBSTCK_DL_URL.
+type ExecTransformer struct {
+	Command string
+}
+
+// NewExecTransformer creates a transformer running command through the shell
+func NewExecTransformer(command string) *ExecTransformer {
+	return &ExecTransformer{Command: command}
+}
+
+// TransformPost replaces the body of the post by the output of the command
+func (t *ExecTransformer) TransformPost(ctx context.Context, post Post) (Post, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", t.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", t.Command)
+	}
+	cmd.Env = append(os.Environ(),
+		"SBSTCK_DL_TITLE="+post.Title,
+		"SBSTCK_DL_SUBTITLE="+post.Subtitle,
+		"SBSTCK_DL_URL="+post.CanonicalUrl)
+	cmd.Stdin = strings.NewReader(post.BodyHTML)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return post, fmt.Errorf("command %q failed: %w: %s", t.Command, err, msg)
+		}
+		return post, fmt.Errorf("command %q failed: %w", t.Command, err)
+	}
+	if strings.TrimSpace(stdout.String()) == "" {
+		return post, fmt.Errorf("command %q returned no content", t.Command)
+	}
+
+	post.BodyHTML = stdout.String()
+	return post, nil
+}
@@ -0,0 +1,99 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// upperTransformer upper-cases the title and body of posts
+type upperTransformer struct{}
+
+func (upperTransformer) TransformPost(ctx context.Context, post Post) (Post, error) {
+	post.Title = strings.ToUpper(post.Title)
+	post.BodyHTML = strings.ToUpper(post.BodyHTML)
+	return post, nil
+}
+
+// failingTransformer always fails
+type failingTransformer struct{}
+
+func (failingTransformer) TransformPost(ctx context.Context, post Post) (Post, error) {
+	return post, errors.New("quota exceeded")
+}
+
+// Test transforming posts before they are written
+func TestDownloaderTransformers(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "transform-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	post := createSamplePost()
+	post.PostDate = "2023-01-01T10:00:00Z"
+
+	opts := DefaultDownloadOptions()
+	opts.OutputDir = tempDir
+	opts.Format = "html"
+	opts.Transformers = []PostTransformer{upperTransformer{}}
+	downloader := NewDownloader(nil, opts)
+
+	result := downloader.WritePost(context.Background(), post)
+	require.NoError(t, result.Err)
+	assert.Equal(t, "TEST POST", result.Post.Title)
+	content, err := os.ReadFile(result.Path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), strings.ToUpper(post.BodyHTML))
+
+	t.Run("failure", func(t *testing.T) {
+		opts.Transformers = []PostTransformer{upperTransformer{}, failingTransformer{}}
+		opts.OutputDir = tempDir + "/failed"
+		downloader := NewDownloader(nil, opts)
+
+		result := downloader.WritePost(context.Background(), post)
+		var transformErr *TransformError
+		require.True(t, errors.As(result.Err, &transformErr))
+		assert.Contains(t, result.Err.Error(), "quota exceeded")
+		assert.NoFileExists(t, result.Path)
+
+		manifest, err := LoadManifest(opts.OutputDir)
+		require.NoError(t, err)
+		downloader.record(&DownloadSummary{}, manifest, nil, result)
+		require.Len(t, manifest.Failures, 1)
+		assert.Equal(t, FailureTransform, manifest.Failures[0].Stage)
+		assert.Empty(t, manifest.Posts)
+	})
+}
+
+// Test transforming the body of posts with a shell command
+func TestExecTransformer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	post := createSamplePost()
+	post.BodyHTML = "<p>Bonjour</p>"
+
+	transformed, err := NewExecTransformer(`sed "s/Bonjour/Hello/"; echo "<p>$SBSTCK_DL_TITLE</p>"`).TransformPost(context.Background(), post)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(transformed.BodyHTML, "<p>Hello</p>"))
+	assert.True(t, strings.HasSuffix(transformed.BodyHTML, "<p>Test Post</p>\n"))
+	assert.Equal(t, post.Title, transformed.Title)
+
+	_, err = NewExecTransformer("echo 'no API key' >&2; exit 1").TransformPost(context.Background(), post)
+	assert.ErrorContains(t, err, "no API key")
+
+	_, err = NewExecTransformer("cat > /dev/null").TransformPost(context.Background(), post)
+	assert.ErrorContains(t, err, "returned no content")
+
+	opts := DefaultDownloadOptions()
+	opts.Transformers = []PostTransformer{NewExecTransformer("translate --to fr"), upperTransformer{}}
+	manifestOpts := opts.ManifestOptions()
+	assert.Equal(t, []string{"translate --to fr"}, manifestOpts.Transform)
+	assert.Len(t, manifestOpts.DownloadOptions(".").Transformers, 1)
+	assert.Contains(t, ReproduceCommand("https://example.com/p/a", manifestOpts, "."), "--transform 'translate --to fr'")
+}
@@ -0,0 +1,225 @@
+package lib
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// defaultDialTimeout is the timeout to establish a TCP connection
+const defaultDialTimeout = 30 * time.Second
+
+// defaultKeepAlive is the default period of TCP keep-alive probes
+const defaultKeepAlive = 30 * time.Second
+
+// WithMaxIdleConnsPerHost sets the number of idle connections kept per host for reuse.
+// It defaults to the number of workers.
+func WithMaxIdleConnsPerHost(n int) FetcherOption {
+	return func(o *FetcherOptions) {
+		o.MaxIdleConnsPerHost = n
+	}
+}
+
+// WithKeepAlive sets the period of TCP keep-alive probes. A negative period disables
+// keep-alives altogether, opening a new connection for every request.
+func WithKeepAlive(period time.Duration) FetcherOption {
+	return func(o *FetcherOptions) {
+		o.KeepAlive = period
+	}
+}
+
+// WithDNSCache caches the addresses of the hosts for ttl instead of resolving them
+// for every new connection. 0 disables the cache.
+func WithDNSCache(ttl time.Duration) FetcherOption {
+	return func(o *FetcherOptions) {
+		o.DNSCacheTTL = ttl
+	}
+}
+
+// WithResolver resolves host names with the DNS server at addr ("host:port")
+// instead of the system resolver.
+func WithResolver(addr string) FetcherOption {
+	return func(o *FetcherOptions) {
+		o.Resolver = addr
+	}
+}
+
+// WithHTTP2 enables or disables HTTP/2 (enabled by default).
+func WithHTTP2(enabled bool) FetcherOption {
+	return func(o *FetcherOptions) {
+		o.DisableHTTP2 = !enabled
+	}
+}
+
+// WithBrotli makes the Fetcher accept brotli compressed responses besides gzip ones
+// (only gzip by default). Responses are decompressed before being read.
+func WithBrotli(enabled bool) FetcherOption {
+	return func(o *FetcherOptions) {
+		o.Brotli = enabled
+	}
+}
+
+// configureTransport applies the connection options to transport
+func configureTransport(transport *http.Transport, options FetcherOptions) {
+	dialer := &net.Dialer{Timeout: defaultDialTimeout, KeepAlive: defaultKeepAlive}
+	if options.KeepAlive != 0 {
+		dialer.KeepAlive = options.KeepAlive
+	}
+	transport.DisableKeepAlives = options.KeepAlive < 0
+
+	var resolver *net.Resolver
+	if options.Resolver != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, options.Resolver)
+			},
+		}
+		dialer.Resolver = resolver
+	}
+
+	transport.DialContext = dialer.DialContext
+	if options.DNSCacheTTL > 0 {
+		cache := &dnsCache{resolver: resolver, ttl: options.DNSCacheTTL, entries: make(map[string]dnsEntry)}
+		transport.DialContext = cache.dialContext(dialer)
+	}
+
+	transport.MaxIdleConnsPerHost = options.MaxWorkers
+	if options.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = options.MaxIdleConnsPerHost
+	}
+
+	if options.DisableHTTP2 {
+		// A non-nil empty map prevents the transport from upgrading to HTTP/2
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+}
+
+// brotliTransport asks for brotli or gzip compressed responses and decompresses them, as
+// http.Transport does for gzip alone
+type brotliTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper. Like http.Transport, it leaves alone the requests
+// choosing their own encoding, range requests and HEAD requests.
+func (t *brotliTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") != "" || req.Header.Get("Range") != "" || req.Method == http.MethodHead {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept-Encoding", "br, gzip")
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	switch strings.ToLower(res.Header.Get("Content-Encoding")) {
+	case "br":
+		body = brotli.NewReader(res.Body)
+	case "gzip":
+		zr, err := gzip.NewReader(res.Body)
+		if err != nil && err != io.EOF {
+			res.Body.Close()
+			return nil, fmt.Errorf("error decompressing %s: %w", req.URL, err)
+		}
+		if zr != nil {
+			body = zr
+		}
+	default:
+		return res, nil
+	}
+	if body == nil {
+		// An empty gzip body
+		body = strings.NewReader("")
+	}
+	res.Body = decodedBody{Reader: body, Closer: res.Body}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = true
+	return res, nil
+}
+
+// decodedBody reads a decompressed response body and closes the original one
+type decodedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// dnsCache resolves host names once per TTL for the dialer
+type dnsCache struct {
+	resolver *net.Resolver // nil for the default resolver
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+}
+
+// dnsEntry is the cached addresses of a host
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// lookup returns the addresses of host, from the cache when they haven't expired
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	resolver := c.resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[host] = dnsEntry{addrs: addrs, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return addrs, nil
+}
+
+// dialContext returns a DialContext function dialing the cached addresses in turn
+func (c *dnsCache) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		addrs, err := c.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range addrs {
+			var conn net.Conn
+			conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+		if err == nil {
+			err = fmt.Errorf("no addresses found for %s", host)
+		}
+		return nil, err
+	}
+}
@@ -0,0 +1,138 @@
+package lib
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the connection tuning options of the Fetcher
+func TestFetcherTransportOptions(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		transport := NewFetcher(WithMaxWorkers(4)).Client.Transport.(*http.Transport)
+		assert.Equal(t, 4, transport.MaxIdleConnsPerHost)
+		assert.False(t, transport.DisableKeepAlives)
+		assert.True(t, transport.ForceAttemptHTTP2)
+		assert.Nil(t, transport.TLSNextProto)
+	})
+
+	t.Run("Custom", func(t *testing.T) {
+		transport := NewFetcher(
+			WithMaxIdleConnsPerHost(32),
+			WithKeepAlive(-1),
+			WithHTTP2(false),
+		).Client.Transport.(*http.Transport)
+		assert.Equal(t, 32, transport.MaxIdleConnsPerHost)
+		assert.True(t, transport.DisableKeepAlives)
+		assert.False(t, transport.ForceAttemptHTTP2)
+		assert.NotNil(t, transport.TLSNextProto)
+		assert.Empty(t, transport.TLSNextProto)
+	})
+
+	t.Run("DNSCache", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+
+		f := NewFetcher(WithDNSCache(time.Minute))
+		body, err := f.FetchURL(context.Background(), strings.Replace(server.URL, "127.0.0.1", "localhost", 1))
+		require.NoError(t, err)
+		data, _ := io.ReadAll(body)
+		body.Close()
+		assert.Equal(t, "ok", string(data))
+	})
+}
+
+// Test that the DNS cache resolves hosts once per TTL
+func TestDNSCache(t *testing.T) {
+	cache := &dnsCache{ttl: time.Minute, entries: make(map[string]dnsEntry)}
+	cache.entries["example.test"] = dnsEntry{addrs: []string{"127.0.0.1"}, expires: time.Now().Add(time.Minute)}
+
+	addrs, err := cache.lookup(context.Background(), "example.test")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1"}, addrs)
+
+	// Dialing a cached host connects to its cached address
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	dial := cache.dialContext(&net.Dialer{Timeout: time.Second})
+	conn, err := dial(context.Background(), "tcp", net.JoinHostPort("example.test", port))
+	require.NoError(t, err)
+	conn.Close()
+
+	// Expired entries are resolved again
+	cache.entries["example.test"] = dnsEntry{addrs: []string{"127.0.0.1"}, expires: time.Now().Add(-time.Second)}
+	_, err = cache.lookup(context.Background(), "example.test")
+	assert.Error(t, err)
+}
+
+// Test that brotli and gzip responses are decompressed when brotli is accepted
+func TestBrotliTransport(t *testing.T) {
+	const content = "<p>compressed content</p>"
+	var acceptEncoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		switch {
+		case r.Header.Get("Range") != "":
+			w.Write([]byte(content))
+		case strings.Contains(acceptEncoding, "br") && r.URL.Path == "/br":
+			w.Header().Set("Content-Encoding", "br")
+			bw := brotli.NewWriter(w)
+			bw.Write([]byte(content))
+			bw.Close()
+		case strings.Contains(acceptEncoding, "gzip"):
+			w.Header().Set("Content-Encoding", "gzip")
+			gw := gzip.NewWriter(w)
+			gw.Write([]byte(content))
+			gw.Close()
+		default:
+			w.Write([]byte(content))
+		}
+	}))
+	defer server.Close()
+
+	fetch := func(f *Fetcher, path string, header http.Header) *http.Response {
+		res, err := f.fetchResponse(context.Background(), server.URL+path, header)
+		require.NoError(t, err)
+		return res
+	}
+	read := func(res *http.Response) string {
+		defer res.Body.Close()
+		data, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	f := NewFetcher(WithRatePerSecond(100), WithBrotli(true))
+	for _, path := range []string{"/br", "/gzip"} {
+		res := fetch(f, path, nil)
+		assert.Equal(t, "br, gzip", acceptEncoding)
+		assert.True(t, res.Uncompressed, path)
+		assert.Empty(t, res.Header.Get("Content-Encoding"), path)
+		assert.Equal(t, content, read(res), path)
+	}
+
+	// Range requests aren't compressed
+	res := fetch(f, "/br", http.Header{"Range": []string{"bytes=0-"}})
+	assert.Empty(t, acceptEncoding)
+	assert.Equal(t, content, read(res))
+
+	// Without the option, only gzip is accepted
+	res = fetch(NewFetcher(WithRatePerSecond(100)), "/br", nil)
+	assert.Equal(t, "gzip", acceptEncoding)
+	assert.Equal(t, content, read(res))
+}
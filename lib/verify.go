@@ -0,0 +1,25 @@
+package lib
+
+import "strings"
+
+// IncompleteRatio is the share of the words reported by Substack below which the extracted
+// body of a post is considered incomplete
+const IncompleteRatio = 0.6
+
+// minCheckedWords is the word count under which posts aren't checked, a few words of
+// difference being enough to fall under the ratio
+const minCheckedWords = 100
+
+// ExtractedWordCount returns the number of words of the body of the post
+func (p *Post) ExtractedWordCount() int {
+	return len(strings.Fields(p.ToText(false)))
+}
+
+// Incomplete reports whether far fewer words were extracted than Substack reports for the
+// post, which usually means it was truncated by the paywall or only partially extracted
+func (p *Post) Incomplete() bool {
+	if p.WordCount < minCheckedWords {
+		return false
+	}
+	return float64(p.ExtractedWordCount()) < float64(p.WordCount)*IncompleteRatio
+}
@@ -0,0 +1,50 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostIncomplete(t *testing.T) {
+	words := func(n int) string {
+		return strings.Repeat("word ", n)
+	}
+
+	post := Post{WordCount: 1000, BodyHTML: words(950)}
+	assert.Equal(t, 950, post.ExtractedWordCount())
+	assert.False(t, post.Incomplete())
+
+	// A paywalled post only has its first paragraphs
+	post = Post{WordCount: 1000, BodyHTML: words(200)}
+	assert.True(t, post.Incomplete())
+
+	// Short posts and posts without a reported count aren't checked
+	assert.False(t, (&Post{WordCount: 50, BodyHTML: words(10)}).Incomplete())
+	assert.False(t, (&Post{BodyHTML: words(10)}).Incomplete())
+}
+
+func TestDownloaderRecordsIncompletePosts(t *testing.T) {
+	dir := t.TempDir()
+	d := NewDownloader(nil, DownloadOptions{OutputDir: dir, Format: "html"})
+	manifest, err := LoadManifest(dir)
+	require.NoError(t, err)
+
+	summary := &DownloadSummary{}
+	full := Post{Id: 1, Slug: "full", WordCount: 120, BodyHTML: strings.Repeat("word ", 120)}
+	truncated := Post{Id: 2, Slug: "truncated", WordCount: 2000, BodyHTML: strings.Repeat("word ", 300)}
+	d.record(summary, manifest, nil, PostResult{URL: "https://example.com/p/full", Post: full, Path: dir + "/full.html"})
+	d.record(summary, manifest, nil, PostResult{URL: "https://example.com/p/truncated", Post: truncated, Path: dir + "/truncated.html"})
+
+	assert.Equal(t, 1, summary.Incomplete)
+	entry, ok := manifest.Entry("truncated")
+	require.True(t, ok)
+	assert.True(t, entry.Incomplete)
+	assert.Equal(t, 300, entry.Extracted)
+	entry, ok = manifest.Entry("full")
+	require.True(t, ok)
+	assert.False(t, entry.Incomplete)
+	assert.Equal(t, 120, entry.Extracted)
+}
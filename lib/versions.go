@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// versionPattern matches the files of the previous versions of a post, e.g. 20230101_100000_slug.v2.md
+var versionPattern = regexp.MustCompile(`\.v(\d+)\.[^.]+$`)
+
+// VersionPath returns the path of the nth previous version of the post written at path,
+// e.g. 20230101_100000_slug.v2.md for 20230101_100000_slug.md
+func VersionPath(path string, n int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.v%d%s", strings.TrimSuffix(path, ext), n, ext)
+}
+
+// PostVersions returns the paths of the previous versions kept of the post written at path, oldest first
+func PostVersions(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	matches, err := filepath.Glob(escapeGlob(strings.TrimSuffix(path, ext)) + ".v*" + escapeGlob(ext))
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	numbers := make(map[string]int)
+	for _, match := range matches {
+		m := versionPattern.FindStringSubmatch(match)
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		numbers[match] = n
+		versions = append(versions, match)
+	}
+	sort.Slice(versions, func(i, j int) bool { return numbers[versions[i]] < numbers[versions[j]] })
+	return versions, nil
+}
+
+// SavePreviousVersion keeps previous, the content a post file had before being written again,
+// as the next version of the post when the new content differs in its text: changes of the
+// markup alone, such as new image URLs, don't make a version (see CanonicalText).
+// It returns the path of the version written, or "" if the post didn't change.
+func SavePreviousVersion(path string, previous []byte) (string, error) {
+	current, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if bytes.Equal(current, previous) {
+		return "", nil
+	}
+	format := strings.TrimPrefix(filepath.Ext(path), ".")
+	before := LocalPost{Format: format, Content: string(previous)}
+	after := LocalPost{Format: format, Content: string(current)}
+	if before.CanonicalText() == after.CanonicalText() {
+		return "", nil
+	}
+
+	versions, err := PostVersions(path)
+	if err != nil {
+		return "", err
+	}
+	next := 1
+	if len(versions) > 0 {
+		last := versionPattern.FindStringSubmatch(versions[len(versions)-1])
+		n, _ := strconv.Atoi(last[1])
+		next = n + 1
+	}
+	versionPath := VersionPath(path, next)
+	if err := os.WriteFile(versionPath, previous, 0644); err != nil {
+		return "", err
+	}
+	return versionPath, nil
+}
+
+// escapeGlob escapes the characters of a path that have a meaning in glob patterns
+func escapeGlob(path string) string {
+	var sb strings.Builder
+	for _, r := range path {
+		if strings.ContainsRune(`*?[\`, r) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test keeping the previous versions of a post
+func TestSavePreviousVersion(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "20230101_100000_my-post.md")
+	assert.Equal(t, filepath.Join(dir, "20230101_100000_my-post.v2.md"), VersionPath(path, 2))
+
+	write := func(content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	write("first")
+	version, err := SavePreviousVersion(path, []byte("first"))
+	require.NoError(t, err)
+	assert.Empty(t, version, "unchanged posts have no new version")
+
+	write("second")
+	version, err = SavePreviousVersion(path, []byte("first"))
+	require.NoError(t, err)
+	assert.Equal(t, VersionPath(path, 1), version)
+
+	write("third")
+	version, err = SavePreviousVersion(path, []byte("second"))
+	require.NoError(t, err)
+	assert.Equal(t, VersionPath(path, 2), version)
+
+	// Versions are numbered, not sorted by name
+	for n := 3; n <= 10; n++ {
+		require.NoError(t, os.WriteFile(VersionPath(path, n), []byte("old"), 0644))
+	}
+	versions, err := PostVersions(path)
+	require.NoError(t, err)
+	require.Len(t, versions, 10)
+	assert.Equal(t, VersionPath(path, 1), versions[0])
+	assert.Equal(t, VersionPath(path, 10), versions[9])
+
+	data, err := os.ReadFile(VersionPath(path, 2))
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+
+	// Versions aren't taken for posts
+	posts, err := ScanLocalPosts(dir)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, "my-post", posts[0].Slug)
+
+	// Changes of the markup alone make no version
+	write("[third](https://example.com/b)")
+	version, err = SavePreviousVersion(path, []byte("[third](https://example.com/a)"))
+	require.NoError(t, err)
+	assert.Empty(t, version)
+
+	_, err = SavePreviousVersion(filepath.Join(dir, "missing.md"), []byte("x"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,174 @@
+package lib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WARCFileName returns the name of the WARC file of a run started at t
+func WARCFileName(t time.Time) string {
+	return fmt.Sprintf("sbstck-dl-%s.warc.gz", t.UTC().Format("20060102150405"))
+}
+
+// WARCWriter records HTTP exchanges in a WARC 1.1 file, each record being compressed
+// in its own gzip member as usual for .warc.gz files
+type WARCWriter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	file *os.File
+}
+
+// CreateWARC creates the WARC file at path, starting with a warcinfo record
+func CreateWARC(path string) (*WARCWriter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error creating WARC file: %w", err)
+	}
+	w := NewWARCWriter(file)
+	w.file = file
+
+	info := "software: sbstck-dl\r\nformat: WARC File Format 1.1\r\n"
+	headers := warcHeaders{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Filename", filepath.Base(path)},
+		{"Content-Type", "application/warc-fields"},
+	}
+	if err := w.writeRecord(headers, []byte(info)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// NewWARCWriter creates a WARCWriter writing records to w
+func NewWARCWriter(w io.Writer) *WARCWriter {
+	return &WARCWriter{w: w}
+}
+
+// WriteExchange records a request and its response, whose body has already been read
+func (w *WARCWriter) WriteExchange(req *http.Request, res *http.Response, body []byte) error {
+	// The session cookie isn't recorded, WARC files being meant to be shared
+	recordedReq := req.Clone(req.Context())
+	recordedReq.Header.Del("Cookie")
+	var reqBlock bytes.Buffer
+	if err := recordedReq.Write(&reqBlock); err != nil {
+		return fmt.Errorf("error recording request: %w", err)
+	}
+
+	// Record the body as received, without the transfer encoding
+	recorded := *res
+	recorded.Header = res.Header.Clone()
+	recorded.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	recorded.ContentLength = int64(len(body))
+	recorded.TransferEncoding = nil
+	recorded.Body = io.NopCloser(bytes.NewReader(body))
+	var resBlock bytes.Buffer
+	if err := recorded.Write(&resBlock); err != nil {
+		return fmt.Errorf("error recording response: %w", err)
+	}
+
+	uri := req.URL.String()
+	date := time.Now().UTC().Format(time.RFC3339)
+	responseID := newWARCRecordID()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.writeRecord(warcHeaders{
+		{"WARC-Type", "response"},
+		{"WARC-Record-ID", responseID},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", uri},
+		{"WARC-Payload-Digest", warcDigest(body)},
+		{"Content-Type", "application/http; msgtype=response"},
+	}, resBlock.Bytes()); err != nil {
+		return err
+	}
+	return w.writeRecord(warcHeaders{
+		{"WARC-Type", "request"},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", uri},
+		{"WARC-Concurrent-To", responseID},
+		{"Content-Type", "application/http; msgtype=request"},
+	}, reqBlock.Bytes())
+}
+
+// Close closes the WARC file
+func (w *WARCWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Close()
+}
+
+// warcHeaders are the named fields of a WARC record, in order
+type warcHeaders [][2]string
+
+// writeRecord writes a record in its own gzip member. The caller must hold mu, except while creating the file.
+func (w *WARCWriter) writeRecord(headers warcHeaders, block []byte) error {
+	var record bytes.Buffer
+	record.WriteString("WARC/1.1\r\n")
+	if !headers.has("WARC-Record-ID") {
+		headers = append(headers, [2]string{"WARC-Record-ID", newWARCRecordID()})
+	}
+	if !headers.has("WARC-Date") {
+		headers = append(headers, [2]string{"WARC-Date", time.Now().UTC().Format(time.RFC3339)})
+	}
+	headers = append(headers,
+		[2]string{"WARC-Block-Digest", warcDigest(block)},
+		[2]string{"Content-Length", strconv.Itoa(len(block))})
+	for _, h := range headers {
+		fmt.Fprintf(&record, "%s: %s\r\n", h[0], h[1])
+	}
+	record.WriteString("\r\n")
+	record.Write(block)
+	record.WriteString("\r\n\r\n")
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write(record.Bytes()); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(compressed.Bytes()); err != nil {
+		return fmt.Errorf("error writing WARC record: %w", err)
+	}
+	return nil
+}
+
+// has reports whether the headers contain the named field
+func (h warcHeaders) has(name string) bool {
+	for _, field := range h {
+		if field[0] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// newWARCRecordID returns a random UUID URN
+func newWARCRecordID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// warcDigest returns the SHA-1 digest of data in the usual WARC notation
+func warcDigest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
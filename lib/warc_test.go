@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test recording the HTTP exchanges of a Fetcher in a WARC file
+func TestFetcherWARC(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html>post</html>"))
+	}))
+	defer server.Close()
+
+	tempDir, err := os.MkdirTemp("", "warc-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, WARCFileName(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)))
+	assert.Equal(t, "sbstck-dl-20230102030405.warc.gz", filepath.Base(path))
+	w, err := CreateWARC(path)
+	require.NoError(t, err)
+
+	fetcher := NewFetcher(WithCookie(&http.Cookie{Name: "substack.sid", Value: "secret"}))
+	fetcher.WARC = w
+	body, err := fetcher.FetchURL(context.Background(), server.URL+"/p/post")
+	require.NoError(t, err)
+	content, err := io.ReadAll(body)
+	require.NoError(t, err)
+	body.Close()
+	assert.Equal(t, "<html>post</html>", string(content))
+
+	_, err = fetcher.FetchURL(context.Background(), server.URL+"/missing")
+	require.Error(t, err)
+	require.NoError(t, w.Close())
+
+	// Each record is a gzip member, read back as a single stream
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	require.NoError(t, err)
+	data, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	warc := string(data)
+
+	records := strings.Split(warc, "WARC/1.1\r\n")[1:]
+	require.Len(t, records, 5)
+	assert.Contains(t, records[0], "WARC-Type: warcinfo")
+	assert.Contains(t, records[1], "WARC-Type: response")
+	assert.Contains(t, records[1], "WARC-Target-URI: "+server.URL+"/p/post")
+	assert.Contains(t, records[1], "HTTP/1.1 200 OK")
+	assert.Contains(t, records[1], "<html>post</html>")
+	assert.Contains(t, records[1], "WARC-Payload-Digest: "+warcDigest([]byte("<html>post</html>")))
+	assert.Contains(t, records[2], "WARC-Type: request")
+	assert.Contains(t, records[2], "GET /p/post HTTP/1.1")
+	assert.NotContains(t, records[2], "secret")
+	assert.Contains(t, records[3], "HTTP/1.1 404 Not Found")
+}
+
+// Test the length and digest of WARC records
+func TestWARCRecord(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWARCWriter(&buf)
+	require.NoError(t, w.writeRecord(warcHeaders{{"WARC-Type", "resource"}}, []byte("hello")))
+
+	gz, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	data, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	record := string(data)
+	assert.True(t, strings.HasPrefix(record, "WARC/1.1\r\nWARC-Type: resource\r\nWARC-Record-ID: <urn:uuid:"))
+	assert.Contains(t, record, "Content-Length: 5\r\n")
+	assert.Contains(t, record, "WARC-Block-Digest: sha1:"+warcDigest([]byte("hello"))[5:])
+	assert.True(t, strings.HasSuffix(record, "\r\n\r\nhello\r\n\r\n"))
+}
@@ -0,0 +1,399 @@
+package lib
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ArchiveServer serves a directory of downloaded posts as a small browseable website
+type ArchiveServer struct {
+	dir     string
+	posts   []LocalPost
+	keys    []string       // key of each post in the /read/ URLs
+	byKey   map[string]int // index of the post of each key
+	byPath  map[string]int
+	index   *SearchIndex
+	related [][]int // indexes of the posts related to each post
+	mux     *http.ServeMux
+}
+
+// webuiRelatedPosts is the number of related posts shown under a post
+const webuiRelatedPosts = 5
+
+// NewArchiveServer scans the given directory and prepares the website.
+// Posts are loaded and indexed once at startup.
+func NewArchiveServer(dir string) (*ArchiveServer, error) {
+	posts, err := ScanLocalPosts(dir)
+	if err != nil {
+		return nil, err
+	}
+	// The posts are searched as by the search command, the index being kept in memory
+	index, err := NewSearchIndex(posts)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ArchiveServer{
+		dir:    dir,
+		posts:  posts,
+		keys:   make([]string, len(posts)),
+		byKey:  make(map[string]int, len(posts)),
+		byPath: make(map[string]int, len(posts)),
+		index:  index,
+		mux:    http.NewServeMux(),
+	}
+	docs := make([]relatedDoc, len(posts))
+	for i, post := range posts {
+		s.keys[i] = path.Join(s.relDir(post), post.Slug)
+		s.byKey[s.keys[i]] = i
+		s.byPath[post.Path] = i
+		docs[i] = newRelatedDoc(post.Title, post.Tags, post.Date.Format(time.RFC3339))
+	}
+	s.related = findRelated(docs, webuiRelatedPosts)
+
+	s.mux.HandleFunc("/", s.handleIndex)
+	s.mux.HandleFunc("/read/", s.handleRead)
+	s.mux.Handle("/files/", http.StripPrefix("/files/", http.FileServer(http.Dir(dir))))
+
+	return s, nil
+}
+
+// PostCount returns the number of posts served
+func (s *ArchiveServer) PostCount() int {
+	return len(s.posts)
+}
+
+// Close releases the search index of the posts
+func (s *ArchiveServer) Close() error {
+	return s.index.Close()
+}
+
+// relDir returns the directory of a post relative to the served directory, with forward
+// slashes, "." for the posts at its root. Posts of several publications can share a slug, so
+// the directory tells them apart in the URLs.
+func (s *ArchiveServer) relDir(post LocalPost) string {
+	rel, err := filepath.Rel(s.dir, filepath.Dir(post.Path))
+	if err != nil {
+		return "."
+	}
+	return filepath.ToSlash(rel)
+}
+
+// link returns the link to the reading view of the i-th post
+func (s *ArchiveServer) link(i int) postLink {
+	post := s.posts[i]
+	return postLink{Key: s.keys[i], Title: post.Title, Date: post.Date}
+}
+
+// ServeHTTP implements http.Handler
+func (s *ArchiveServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// facet is a filter value shown in the sidebar with the number of matching posts
+type facet struct {
+	Value    string
+	Count    int
+	Selected bool
+}
+
+// indexItem is a post shown on the index page
+type indexItem struct {
+	Key     string
+	Post    LocalPost
+	Snippet string
+}
+
+// postLink is a link to the reading view of a post
+type postLink struct {
+	Key   string
+	Title string
+	Date  time.Time
+}
+
+// indexPage holds the data rendered by the index template
+type indexPage struct {
+	Query string
+	Tag   string
+	Year  string
+	Items []indexItem
+	Tags  []facet
+	Years []facet
+	Total int
+}
+
+// handleIndex renders the list of posts, filtered by the search query, tag and year
+func (s *ArchiveServer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	page := indexPage{
+		Query: strings.TrimSpace(r.URL.Query().Get("q")),
+		Tag:   r.URL.Query().Get("tag"),
+		Year:  r.URL.Query().Get("year"),
+		Total: len(s.posts),
+	}
+
+	var candidates []indexItem
+	if page.Query != "" {
+		results, err := s.index.Search(page.Query, 0)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, result := range results {
+			if i, ok := s.byPath[result.Document.Path]; ok {
+				candidates = append(candidates, indexItem{Key: s.keys[i], Post: s.posts[i], Snippet: result.Snippet})
+			}
+		}
+	} else {
+		for i, post := range s.posts {
+			candidates = append(candidates, indexItem{Key: s.keys[i], Post: post})
+		}
+	}
+
+	for _, item := range candidates {
+		if page.Tag != "" && !containsString(item.Post.Tags, page.Tag) {
+			continue
+		}
+		if page.Year != "" && postYear(item.Post) != page.Year {
+			continue
+		}
+		page.Items = append(page.Items, item)
+	}
+
+	page.Tags, page.Years = s.facets(page.Tag, page.Year)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, page); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// facets counts the posts per tag and per year
+func (s *ArchiveServer) facets(selectedTag, selectedYear string) ([]facet, []facet) {
+	tagCounts := make(map[string]int)
+	yearCounts := make(map[string]int)
+	for _, post := range s.posts {
+		for _, tag := range post.Tags {
+			tagCounts[tag]++
+		}
+		if year := postYear(post); year != "" {
+			yearCounts[year]++
+		}
+	}
+
+	var tags []facet
+	for tag, count := range tagCounts {
+		tags = append(tags, facet{Value: tag, Count: count, Selected: tag == selectedTag})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Value < tags[j].Value
+	})
+
+	var years []facet
+	for year, count := range yearCounts {
+		years = append(years, facet{Value: year, Count: count, Selected: year == selectedYear})
+	}
+	sort.Slice(years, func(i, j int) bool {
+		return years[i].Value > years[j].Value
+	})
+
+	return tags, years
+}
+
+// readPage holds the data rendered by the reading view template
+type readPage struct {
+	Post    LocalPost
+	Base    string // URL of the directory of the post, which its media links are relative to
+	HTML    template.HTML
+	Text    string
+	Prev    *postLink
+	Next    *postLink
+	Related []postLink
+}
+
+// handleRead renders a single post in a clean reading view
+func (s *ArchiveServer) handleRead(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/read/")
+	i, ok := s.byKey[key]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	post := s.posts[i]
+	base := "/files/"
+	if rel := s.relDir(post); rel != "." {
+		base += rel + "/"
+	}
+	page := readPage{Post: post, Base: (&url.URL{Path: base}).EscapedPath()}
+	if post.Format == "html" {
+		// The archive is local content written by sbstck-dl, so it is trusted. Its related
+		// posts link the files, they are shown as links to their reading view instead.
+		page.HTML = template.HTML(relatedBlockRegex.ReplaceAllString(post.Content, ""))
+	} else {
+		page.Text = post.Content
+	}
+
+	// Posts are sorted newest first
+	if i+1 < len(s.posts) {
+		prev := s.link(i + 1)
+		page.Prev = &prev
+	}
+	if i > 0 {
+		next := s.link(i - 1)
+		page.Next = &next
+	}
+	for _, j := range s.related[i] {
+		page.Related = append(page.Related, s.link(j))
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := readTemplate.Execute(w, page); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// postYear returns the publication year of a post, or an empty string if unknown
+func postYear(post LocalPost) string {
+	if post.Date.IsZero() {
+		return ""
+	}
+	return strconv.Itoa(post.Date.Year())
+}
+
+// containsString reports whether the slice contains the value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+var webuiFuncs = template.FuncMap{
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("January 2, 2006")
+	},
+	"count": func(n int, word string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, word)
+		}
+		return fmt.Sprintf("%d %ss", n, word)
+	},
+}
+
+const webuiStyle = `
+	body { font-family: Arial, sans-serif; margin: 0; color: #222; }
+	header { background: #ff6719; padding: 12px 20px; }
+	header a { color: white; text-decoration: none; font-weight: bold; font-size: 20px; }
+	header form { display: inline; margin-left: 20px; }
+	header input[type=text] { padding: 6px; width: 260px; border: none; border-radius: 4px; }
+	.layout { display: flex; max-width: 1100px; margin: 0 auto; padding: 20px; gap: 30px; }
+	.sidebar { width: 220px; flex-shrink: 0; font-size: 14px; }
+	.sidebar h3 { margin-bottom: 6px; }
+	.sidebar a { color: #444; text-decoration: none; display: block; padding: 2px 0; }
+	.sidebar a.selected { font-weight: bold; color: #ff6719; }
+	.posts { flex-grow: 1; }
+	.post { margin-bottom: 24px; }
+	.post h2 { margin: 0 0 4px 0; font-size: 20px; }
+	.post h2 a { color: #222; text-decoration: none; }
+	.post h2 a:hover { color: #ff6719; }
+	.meta { color: #777; font-size: 13px; }
+	.subtitle { color: #555; font-style: italic; }
+	.snippet { color: #444; font-size: 14px; }
+	.tag { background: #f2f2f2; border-radius: 3px; padding: 1px 6px; margin-right: 4px; font-size: 12px; color: #555; text-decoration: none; }
+	article { max-width: 720px; margin: 0 auto; padding: 20px; font-family: Georgia, serif; font-size: 19px; line-height: 1.6; }
+	article img { max-width: 100%; height: auto; }
+	article pre.plain { white-space: pre-wrap; font-family: Georgia, serif; }
+	nav.pager { max-width: 720px; margin: 0 auto 40px auto; padding: 0 20px; display: flex; justify-content: space-between; font-size: 15px; }
+	nav.pager a { color: #ff6719; text-decoration: none; }
+	aside.related { max-width: 720px; margin: 0 auto 30px auto; padding: 0 20px; font-size: 15px; }
+	aside.related a { color: #ff6719; text-decoration: none; }
+`
+
+var indexTemplate = template.Must(template.New("index").Funcs(webuiFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>Substack Archive</title>
+	<style>` + webuiStyle + `</style>
+</head>
+<body>
+	<header>
+		<a href="/">Substack Archive</a>
+		<form action="/" method="get">
+			<input type="text" name="q" value="{{.Query}}" placeholder="Search posts">
+			{{if .Tag}}<input type="hidden" name="tag" value="{{.Tag}}">{{end}}
+			{{if .Year}}<input type="hidden" name="year" value="{{.Year}}">{{end}}
+		</form>
+	</header>
+	<div class="layout">
+		<div class="sidebar">
+			<h3>Years</h3>
+			<a href="/?q={{.Query}}&tag={{.Tag}}"{{if not .Year}} class="selected"{{end}}>All years</a>
+			{{range .Years}}<a href="/?q={{$.Query}}&tag={{$.Tag}}&year={{.Value}}"{{if .Selected}} class="selected"{{end}}>{{.Value}} ({{.Count}})</a>
+			{{end}}
+			{{if .Tags}}<h3>Tags</h3>
+			<a href="/?q={{.Query}}&year={{.Year}}"{{if not .Tag}} class="selected"{{end}}>All tags</a>
+			{{range .Tags}}<a href="/?q={{$.Query}}&year={{$.Year}}&tag={{.Value}}"{{if .Selected}} class="selected"{{end}}>{{.Value}} ({{.Count}})</a>
+			{{end}}{{end}}
+		</div>
+		<div class="posts">
+			<p class="meta">Showing {{count (len .Items) "post"}} of {{.Total}}{{if .Query}} matching &ldquo;{{.Query}}&rdquo;{{end}}</p>
+			{{range .Items}}<div class="post">
+				<h2><a href="/read/{{.Key}}">{{.Post.Title}}</a></h2>
+				<div class="meta">{{date .Post.Date}} {{range .Post.Tags}}<a class="tag" href="/?tag={{.}}">{{.}}</a>{{end}}</div>
+				{{if .Post.Subtitle}}<div class="subtitle">{{.Post.Subtitle}}</div>{{end}}
+				{{if .Snippet}}<div class="snippet">{{.Snippet}}</div>{{end}}
+			</div>
+			{{end}}
+		</div>
+	</div>
+</body>
+</html>`))
+
+var readTemplate = template.Must(template.New("read").Funcs(webuiFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<base href="{{.Base}}">
+	<title>{{.Post.Title}}</title>
+	<style>` + webuiStyle + `</style>
+</head>
+<body>
+	<header><a href="/">Substack Archive</a></header>
+	<article>
+		<div class="meta">{{date .Post.Date}}{{if .Post.URL}} &middot; <a href="{{.Post.URL}}">original</a>{{end}}</div>
+		{{if .HTML}}{{.HTML}}{{else}}<pre class="plain">{{.Text}}</pre>{{end}}
+	</article>
+	{{if .Related}}<aside class="related">
+		<h3>Related posts</h3>
+		<ul>{{range .Related}}<li><a href="/read/{{.Key}}">{{.Title}}</a> <span class="meta">{{date .Date}}</span></li>{{end}}</ul>
+	</aside>{{end}}
+	<nav class="pager">
+		<span>{{with .Prev}}<a href="/read/{{.Key}}">&larr; {{.Title}}</a>{{end}}</span>
+		<span>{{with .Next}}<a href="/read/{{.Key}}">{{.Title}} &rarr;</a>{{end}}</span>
+	</nav>
+</body>
+</html>`))
@@ -0,0 +1,170 @@
+package lib
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the archive web interface
+func TestArchiveServer(t *testing.T) {
+	tempDir := createLocalArchive(t)
+	defer os.RemoveAll(tempDir)
+
+	// Record tags for one of the posts
+	m, err := LoadManifest(tempDir)
+	require.NoError(t, err)
+	post := Post{Slug: "third-post", Title: "Third Post", PostDate: "2023-03-10T08:00:00Z", Tags: []PostTag{{Name: "Climate"}}}
+	m.AddEntry(NewManifestEntry(post, map[string]string{"md": "20230310_080000_third-post.md"}, time.Now()))
+	require.NoError(t, m.Save())
+
+	require.NoError(t, os.MkdirAll(filepath.Join(tempDir, "images", "third-post"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "images", "third-post", "a.jpg"), []byte("jpeg"), 0644))
+
+	server, err := NewArchiveServer(tempDir)
+	require.NoError(t, err)
+	defer server.Close()
+	assert.Equal(t, 4, server.PostCount())
+
+	get := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		body, _ := io.ReadAll(rec.Result().Body)
+		return rec.Code, string(body)
+	}
+
+	t.Run("index lists all posts", func(t *testing.T) {
+		code, body := get("/")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Contains(t, body, "First Post")
+		assert.Contains(t, body, "Undated Post")
+		assert.Contains(t, body, "2023 (3)")
+		assert.Contains(t, body, "Climate (1)")
+	})
+
+	t.Run("search", func(t *testing.T) {
+		code, body := get("/?q=energy")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Contains(t, body, "Second Post")
+		assert.NotContains(t, body, "/read/first-post")
+	})
+
+	t.Run("tag filter", func(t *testing.T) {
+		_, body := get("/?tag=Climate")
+		assert.Contains(t, body, "/read/third-post")
+		assert.NotContains(t, body, "/read/second-post")
+	})
+
+	t.Run("year filter", func(t *testing.T) {
+		_, body := get("/?year=2023")
+		assert.Contains(t, body, "/read/first-post")
+		assert.NotContains(t, body, "/read/undated-post")
+	})
+
+	t.Run("reading view", func(t *testing.T) {
+		code, body := get("/read/second-post")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Contains(t, body, "climate policy and energy")
+		assert.Contains(t, body, "/read/third-post")
+		assert.Contains(t, body, "/read/first-post")
+	})
+
+	t.Run("media files", func(t *testing.T) {
+		code, body := get("/files/images/third-post/a.jpg")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "jpeg", body)
+	})
+
+	t.Run("unknown post", func(t *testing.T) {
+		code, _ := get("/read/missing")
+		assert.Equal(t, http.StatusNotFound, code)
+		code, _ = get("/unknown")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+// Test the related posts of the reading view
+func TestArchiveServerRelatedPosts(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"20230101_100000_energy-policy.html": "<h1>Energy Policy</h1>" +
+			RelatedPostsHTML([]string{"Energy Policy Again"}, []string{"20230201_100000_energy-policy-again.md"}),
+		"20230201_100000_energy-policy-again.md": "# Energy Policy Again\n\nMore.",
+		"20230301_100000_gardening.md":           "# Gardening\n\nTomatoes.",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	server, err := NewArchiveServer(dir)
+	require.NoError(t, err)
+	defer server.Close()
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/read/energy-policy", nil))
+	body := rec.Body.String()
+
+	assert.Contains(t, body, `<h3>Related posts</h3>`)
+	assert.Contains(t, body, `<a href="/read/energy-policy-again">Energy Policy Again</a>`)
+	assert.NotContains(t, body, "related-posts", "the block of the file links the files")
+	assert.NotContains(t, body, `<a href="/read/gardening">`)
+}
+
+// Test posts of several publications sharing a slug, and the media of posts in subfolders
+func TestArchiveServerSubfolders(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"alpha/20230101_100000_welcome.html": `<h1>Welcome to Alpha</h1><img src="images/welcome/a.jpg">`,
+		"alpha/images/welcome/a.jpg":         "alpha jpeg",
+		"beta/20230201_100000_welcome.md":    "# Welcome to Beta\n\nHello.",
+		"20230301_100000_root-post.md":       "# Root Post\n\nAt the root.",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	server, err := NewArchiveServer(dir)
+	require.NoError(t, err)
+	defer server.Close()
+	require.Equal(t, 3, server.PostCount())
+
+	get := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	_, body := get("/")
+	assert.Contains(t, body, `<a href="/read/alpha/welcome">Welcome to Alpha</a>`)
+	assert.Contains(t, body, `<a href="/read/beta/welcome">Welcome to Beta</a>`)
+	assert.Contains(t, body, `<a href="/read/root-post">Root Post</a>`)
+
+	code, body := get("/read/alpha/welcome")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "Welcome to Alpha")
+	assert.Contains(t, body, `<base href="/files/alpha/">`)
+
+	code, body = get("/read/beta/welcome")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "Welcome to Beta")
+
+	code, body = get("/read/root-post")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `<base href="/files/">`)
+
+	// The image link of the post resolves against its base
+	code, body = get("/files/alpha/images/welcome/a.jpg")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "alpha jpeg", body)
+
+	code, _ = get("/read/welcome")
+	assert.Equal(t, http.StatusNotFound, code)
+}